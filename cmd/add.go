@@ -9,296 +9,1614 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/go-git/go-git/v5"
 	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/exclude"
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/noosxe/dotman/internal/scan"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/noosxe/dotman/internal/trash"
 	"github.com/spf13/cobra"
 )
 
+// symlinkPolicy decides how add treats a source path that is a symlink
+type symlinkPolicy int
+
+const (
+	// symlinkRefuse fails the add and asks for an explicit choice
+	symlinkRefuse symlinkPolicy = iota
+	// symlinkFollow tracks the content the symlink points to
+	symlinkFollow
+	// symlinkKeep tracks the symlink itself
+	symlinkKeep
+)
+
 // addOperation represents the state of an add operation
 type addOperation struct {
 	path   string
 	config *config.Config
 	fsys   dotmanfs.FileSystem
 	ctx    context.Context
+
+	// path relative to the home directory, also used below the data directory
+	relPath string
+	// where the manifest keeps the copies
+	layout manifest.Layout
+	// the repository tracks entries in place with the worktree backend, so
+	// the source is staged where it is instead of copied and linked
+	inPlace bool
+	// puts the copy in place of the source, by link_mode
+	linker linker
+	// package the entry is recorded in, if any
+	pkg string
+	// track a file outside the home directory under system/
+	system bool
+	// the copy was made with sudo because the source was not readable
+	sudoCopied bool
+	// the copy's files were moved into the content-addressed store
+	deduped bool
+	// large files of the copy were moved to the offload store
+	offloaded bool
+	// junk entries below a directory source that were not copied
+	skipped []string
+	// regular files and bytes the copy is made of, to show its progress
+	sourceCount int
+	sourceBytes int64
+	// how a source that is a symlink is tracked
+	symlinks symlinkPolicy
+	// add files larger than max_file_size anyway
+	forceLarge bool
+	// line endings of the copy, overriding the line_endings config key
+	lineEndings string
+	// copy nested git repositories without their history instead of
+	// recording them as externals
+	copyNested bool
+	// nested git repositories below a directory source that are moved
+	// along instead of copied, and recorded to be cloned elsewhere
+	externals []manifest.External
+	// paths inside a directory source to track, linked one by one instead
+	// of the whole directory, with forward slashes
+	include []string
+
+	// the source already resolves to the copy in the repository, e.g. after
+	// an earlier add stopped before recording the entry
+	linked bool
+	// the source is linked and recorded in the manifest, nothing to do
+	alreadyTracked bool
+	// the tracked directory the source lies in, which already tracks it
+	parent string
 }
 
 var addCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Add a new dotfile to the dotman repository",
-	Long:  `Add a new dotfile to the dotman repository by specifying the path to the file or the directory.`,
+	Long: `Add a new dotfile to the dotman repository by specifying the path to the file or the directory.
+
+With --interactive, the home directory is scanned for well-known dotfiles and
+untracked entries under ~/.config, and the chosen set is added in one operation.
+
+With --from-file, the paths listed one per line in a file, or stdin for -, are
+added in one operation after a single confirmation. Blank lines and lines
+starting with # are skipped. --dry-run adds nothing and prints the plan of
+what would be added instead, which 'dotman apply-plan' carries out later or on
+another machine.
+
+On a terminal, dotman asks before moving the original into the repository
+and replacing it with a symlink. --yes skips the question. With the trash
+config key set, the original is moved to the desktop trash instead of being
+deleted once it is copied.
+
+A repository created with "dotman init --worktree" tracks the path in place
+instead: it is recorded in the manifest and staged where it is, without
+asking, as nothing is moved. --system is not available there.
+
+With --system, an absolute path outside the home directory such as /etc/hosts
+is tracked under the system/ tree of the repository. The original is replaced
+by a symlink after confirmation, asked even without a terminal unless --yes
+is given, using sudo where the current user lacks permission.
+
+A path that is itself a symlink, e.g. one managed by stow, is only added with
+--follow, which tracks the content it points to, or --no-follow, which tracks
+the symlink itself. Symlinks inside added directories are always kept as
+symlinks.
+
+Junk inside added directories, such as .DS_Store, editor swap files,
+__pycache__ and nested .git directories, is skipped. The exclude config key
+adds more patterns.
+
+Files larger than the max_file_size config key, 100MB by default, are refused
+before anything is copied unless --force-large is given. Binary files are
+added with a warning, as git cannot show readable diffs of them.
+
+With the offload_size config key set, files larger than it are not committed:
+their content is uploaded to offload_store, a local directory, an
+rsync://[user@]host/path target or an s3://bucket/prefix location, and git
+only records a link to it. link fetches that content on other machines.
+
+With --line-endings lf, or the line_endings config key set to lf, CRLF line
+endings in added text files are converted to LF, so dotfiles shared between
+Windows and Unix machines do not produce noisy diffs. With link_mode copy,
+Windows machines get the copies rendered with CRLF line endings.
+
+Git repositories nested in an added directory, such as plugin checkouts, are
+not copied: their checkouts are moved into the repository as they are, left
+out of dotman's history by .gitignore, and recorded in the manifest with their
+origin URL and commit. link clones them on other machines. Repositories
+without an origin remote are copied without their history. Use --copy-nested
+to copy all of them without history instead.
+
+A path inside a tracked directory, such as ~/.config/nvim with ~/.config
+tracked, is already tracked as part of it and nothing is done. A directory
+holding tracked entries is refused, as it cannot be tracked along with
+them: add the other paths inside it one by one instead.
+
+With --include, only the given paths inside a directory are tracked, such as
+functions and config.fish for ~/.config/fish. Each is linked on its own into
+the directory, which stays in place: its other contents, such as caches and
+generated completions, are left alone by link, status and doctor.
+
+With --secret, the path is tracked in the repository of the profile named by
+the secrets_profile config key instead of the active one, e.g. a repository
+with a private remote for ~/.ssh/config while the other dotfiles are public.
+--repo tracks it in the repository of any profile. Commit and push it with
+--profile <name>.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		path, _ := cmd.Flags().GetString("path")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		pkg, _ := cmd.Flags().GetString("package")
+		system, _ := cmd.Flags().GetBool("system")
+		follow, _ := cmd.Flags().GetBool("follow")
+		noFollow, _ := cmd.Flags().GetBool("no-follow")
+		forceLarge, _ := cmd.Flags().GetBool("force-large")
+		lineEndings, _ := cmd.Flags().GetString("line-endings")
+		copyNested, _ := cmd.Flags().GetBool("copy-nested")
+		secret, _ := cmd.Flags().GetBool("secret")
+		repo, _ := cmd.Flags().GetString("repo")
+		fromFile, _ := cmd.Flags().GetString("from-file")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		include, _ := cmd.Flags().GetStringArray("include")
+
+		symlinks := symlinkRefuse
+		if follow {
+			symlinks = symlinkFollow
+		} else if noFollow {
+			symlinks = symlinkKeep
+		}
+
+		if path == "" && !interactive && fromFile == "" {
+			fmt.Println("Error: either --path, --from-file or --interactive is required")
+			exit(1)
+		}
+
+		if lineEndings != "" {
+			if err := manifest.ValidateLineEndings(lineEndings); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exit(1)
+			}
+		}
+
+		if pkg != "" {
+			if err := manifest.ValidatePackageName(pkg); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exit(1)
+			}
+		}
 
 		// Load config
 		cfg, err := config.LoadConfig(configPath, fsys)
 		if err != nil {
 			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		// Sensitive entries go to a separate, private repository
+		cfg, err = repoConfig(cfg, repo, secret)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+
+		if interactive {
+			runInteractiveAdd(cfg, pkg, symlinks, forceLarge, lineEndings, copyNested)
+			return
+		}
+
+		if fromFile != "" || dryRun {
+			paths := []string{path}
+			if fromFile != "" {
+				if paths, err = readPathList(fromFile); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					exit(1)
+				}
+			}
+			runBatchAdd(&addBatchOperation{
+				paths:       paths,
+				fsys:        fsys,
+				config:      cfg,
+				pkg:         pkg,
+				symlinks:    symlinks,
+				forceLarge:  forceLarge,
+				lineEndings: lineEndings,
+				copyNested:  copyNested,
+			}, dryRun)
+			return
+		}
+
+		// System files are never replaced without asking, even in scripts
+		if system && !assumeYes && !confirm(promptInput, terminalOutput(), fmt.Sprintf("Replace %s with a symlink into the dotman repository? This may require sudo.", path)) {
+			fmt.Println("Aborted")
+			exit(1)
+		}
+		if !system && !tracksInPlace(cfg) && !confirmDestructive(fmt.Sprintf("Move %s into the dotman repository and replace it with a symlink?", path)) {
+			fmt.Println("Aborted")
+			exit(1)
 		}
 
 		op := &addOperation{
-			path:   path,
-			fsys:   fsys,
-			config: cfg,
+			path:        path,
+			fsys:        fsys,
+			config:      cfg,
+			pkg:         pkg,
+			system:      system,
+			symlinks:    symlinks,
+			forceLarge:  forceLarge,
+			lineEndings: lineEndings,
+			copyNested:  copyNested,
+			include:     include,
 		}
 
 		if err := op.run(); err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		if op.parent != "" {
+			fmt.Printf("%s is already tracked as part of %s\n", path, op.parent)
+			return
+		}
+		if op.alreadyTracked {
+			fmt.Printf("%s is already tracked\n", path)
+			return
 		}
 
 		fmt.Printf("Successfully added and verified %s to dotman repository\n", path)
 	},
 }
 
+// runInteractiveAdd lets the user pick untracked dotfile candidates and adds them
+func runInteractiveAdd(cfg *config.Config, pkg string, symlinks symlinkPolicy, forceLarge bool, lineEndings string, copyNested bool) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		fmt.Printf("Error getting user home directory: %v\n", err)
+		exit(1)
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		fmt.Printf("Error loading manifest: %v\n", err)
+		exit(1)
+	}
+
+	candidates, err := scan.Scan(fsys, homeDir, m)
+	if err != nil {
+		fmt.Printf("Error scanning home directory: %v\n", err)
+		exit(1)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("No untracked dotfiles found")
+		return
+	}
+
+	items := make([]string, len(candidates))
+	for i, c := range candidates {
+		items[i] = c.Path
+	}
+
+	chosen, err := runPicker("Select dotfiles to add", items)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if len(chosen) == 0 {
+		fmt.Println("Nothing selected")
+		return
+	}
+
+	paths := make([]string, len(chosen))
+	for i, relPath := range chosen {
+		paths[i] = filepath.Join(homeDir, relPath)
+	}
+
+	op := &addBatchOperation{
+		paths:       paths,
+		fsys:        fsys,
+		config:      cfg,
+		pkg:         pkg,
+		symlinks:    symlinks,
+		forceLarge:  forceLarge,
+		lineEndings: lineEndings,
+		copyNested:  copyNested,
+	}
+
+	if err := op.run(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if len(op.items) == 0 {
+		fmt.Println("All selected paths are already tracked")
+		return
+	}
+
+	fmt.Printf("Successfully added and verified %d paths to dotman repository\n", len(op.items))
+}
+
 func (op *addOperation) run() error {
 	if err := op.initialize(); err != nil {
 		return err
 	}
 
+	if op.alreadyTracked {
+		return nil
+	}
+
+	if err := op.addPath(); err != nil {
+		return err
+	}
+
+	return op.complete()
+}
+
+// addPath runs the steps that move a single path into the repository,
+// recording them in the journal entry held by the context
+func (op *addOperation) addPath() error {
+	// A source already linked into the repository, or tracked in place,
+	// only needs to be recorded and staged
+	if op.linked || op.inPlace {
+		if err := op.updateManifest(); err != nil {
+			return err
+		}
+		return op.gitAdd()
+	}
+
 	if err := op.verifySource(); err != nil {
 		return err
 	}
 
+	if err := op.preflight(); err != nil {
+		return err
+	}
+
 	if err := op.copyAndVerify(); err != nil {
 		return err
 	}
 
+	if err := op.normalize(); err != nil {
+		return err
+	}
+
+	if err := op.offload(); err != nil {
+		return err
+	}
+
+	if err := op.dedup(); err != nil {
+		return err
+	}
+
+	if err := op.moveExternals(); err != nil {
+		return err
+	}
+
 	if err := op.createSymlink(); err != nil {
 		return err
 	}
 
-	if err := op.gitAdd(); err != nil {
+	if err := op.updateManifest(); err != nil {
 		return err
 	}
 
-	return op.complete()
+	recordChecksums(op.fsys, op.config.DotmanDir, op.repoPath(op.config.DotmanDir))
+
+	return op.gitAdd()
 }
 
 func (op *addOperation) initialize() error {
-	// Get user's home directory using fsys
-	homeDir, err := op.fsys.UserHomeDir()
+	relPath, err := op.trackedPath()
 	if err != nil {
-		return fmt.Errorf("error getting user home directory: %v", err)
+		return err
 	}
+	op.relPath = relPath
 
-	// Check if the path is within the home directory
-	absPath, err := op.fsys.Abs(op.path)
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	op.layout = m.Layout
+	op.inPlace = m.InPlace()
+	op.linker = newLinker(op.fsys, op.config, m)
+	if err := op.linker.available(); err != nil {
+		return err
+	}
+	if op.inPlace && op.system {
+		return fmt.Errorf("the worktree backend tracks the home directory, system files cannot be added")
+	}
+
+	if err := op.detectTracked(); err != nil {
+		return err
+	}
+	if err := op.checkNested(m); err != nil {
+		return err
+	}
+
+	// Re-adding a tracked path is a no-op and is not journaled
+	if op.alreadyTracked {
+		return nil
+	}
+
+	if err := op.checkDotmanDir(); err != nil {
+		return err
+	}
+	if err := op.checkInclude(m); err != nil {
+		return err
+	}
+
+	if err := op.detectExternals(); err != nil {
+		return err
+	}
+
+	// Oversized files are refused before anything is journaled or copied
+	if err := op.checkSizes(); err != nil {
+		return err
+	}
+
+	// Initialize journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("error initializing journal: %v", err)
+	}
+
+	// Create journal entry with the relative path as target
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, relPath)
+	if err != nil {
+		return fmt.Errorf("error creating journal entry: %v", err)
+	}
+
+	// Add journal manager and entry to context
+	op.ctx = journal.WithJournalManager(context.Background(), jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// detectTracked checks whether the source already resolves to its copy in
+// the repository and whether the manifest records it
+func (op *addOperation) detectTracked() error {
+	op.linked = false
+	op.alreadyTracked = false
+
+	// An entry tracked in place only needs to be in the manifest
+	if op.inPlace {
+		m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+		if err != nil {
+			return err
+		}
+		_, op.alreadyTracked = m.Find(op.relPath)
+		return nil
+	}
+
+	// Missing sources are not linked, the verification step reports them
+	homePaths, repoPaths := op.linkPaths()
+	for i := range homePaths {
+		if op.entryLinker().state(homePaths[i], repoPaths[i]) != "linked" {
+			return nil
+		}
+	}
+	op.linked = true
+
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	_, op.alreadyTracked = m.Find(op.relPath)
+
+	return nil
+}
+
+// checkSizes refuses sources holding files larger than max_file_size, unless
+// forced or offloaded, and warns about binary files whose diffs will not be
+// readable. Sources that are already linked or do not exist are left to the
+// other steps.
+func (op *addOperation) checkSizes() error {
+	if op.linked {
+		return nil
+	}
+
+	maxSize, err := op.config.MaxFileSizeBytes()
+	if err != nil {
+		return fmt.Errorf("invalid max_file_size: %v", err)
+	}
+	offloadSize, err := op.config.OffloadSizeBytes()
+	if err != nil {
+		return fmt.Errorf("invalid offload_size: %v", err)
+	}
+	if !op.offloads() {
+		offloadSize = 0
+	} else if _, err := offload.New(op.fsys, op.config.OffloadStore); err != nil {
+		return err
+	}
+
+	files, err := op.sourceFiles()
+	if err != nil {
+		return nil
+	}
+
+	op.sourceCount, op.sourceBytes = 0, 0
+	var binary []string
+	for _, file := range files {
+		info, err := op.fsys.Stat(file)
+		if err != nil {
+			continue
+		}
+		op.sourceCount++
+		op.sourceBytes += info.Size()
+
+		// Offloaded files never reach git
+		if offloadSize > 0 && info.Size() > offloadSize {
+			continue
+		}
+
+		if maxSize > 0 && info.Size() > maxSize && !op.forceLarge {
+			return fmt.Errorf("%s is %s, larger than max_file_size of %s; use --force-large to add it anyway",
+				file, config.FormatSize(info.Size()), config.FormatSize(maxSize))
+		}
+
+		if isBinary, err := dotmanfs.IsBinary(op.fsys, file); err == nil && isBinary {
+			binary = append(binary, file)
+		}
+	}
+
+	for _, file := range binary {
+		fmt.Fprintf(os.Stderr, "Warning: %s is a binary file, git diffs of it will not be readable\n", file)
+	}
+
+	return nil
+}
+
+// sourceFiles returns the regular files that copying the source would add:
+// the source itself or the files below it when it is a directory, except junk
+func (op *addOperation) sourceFiles() ([]string, error) {
+	info, err := op.fsys.Lstat(op.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Symlinks are only copied as content when followed
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if op.symlinks != symlinkFollow {
+			return nil, nil
+		}
+		if info, err = op.fsys.Stat(op.path); err != nil {
+			return nil, err
+		}
+	}
+
+	if !info.IsDir() {
+		return []string{op.path}, nil
+	}
+
+	junk := exclude.New(op.config.Exclude)
+	var files []string
+	err = op.fsys.WalkDir(op.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != op.path && junk.Match(d.Name(), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel, err := op.fsys.Rel(op.path, path); err == nil && rel != "." {
+			if d.IsDir() && isExternal(op.externals, rel) {
+				return filepath.SkipDir
+			}
+			if !op.included(rel, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// included reports whether the entry at rel below a directory source is
+// copied: every entry without an include list, otherwise the included
+// paths, what lies below them and the directories leading to them
+func (op *addOperation) included(rel string, isDir bool) bool {
+	if len(op.include) == 0 {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	for _, include := range op.include {
+		if rel == include || strings.HasPrefix(rel, include+"/") || (isDir && strings.HasPrefix(include, rel+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkPaths returns the paths put in place of the source and the copies they
+// link to: the source itself, or each included path of a directory source
+func (op *addOperation) linkPaths() (homePaths, repoPaths []string) {
+	targetPath := op.repoPath(op.config.DotmanDir)
+	if len(op.include) == 0 {
+		return []string{op.path}, []string{targetPath}
+	}
+	for _, include := range op.include {
+		homePaths = append(homePaths, filepath.Join(op.path, filepath.FromSlash(include)))
+		repoPaths = append(repoPaths, filepath.Join(targetPath, filepath.FromSlash(include)))
+	}
+	return homePaths, repoPaths
+}
+
+// checkInclude validates the include list of a directory source against the
+// source and m, and sorts it. Include lists are set when a directory is
+// first tracked.
+func (op *addOperation) checkInclude(m *manifest.Manifest) error {
+	if len(op.include) == 0 {
+		return nil
+	}
+	if op.inPlace {
+		return fmt.Errorf("the worktree backend tracks paths in place, add the paths to include themselves instead")
+	}
+	if _, ok := m.Find(op.relPath); ok {
+		return fmt.Errorf("%s is already tracked, an include list is only given when a directory is first added", op.path)
+	}
+	info, err := op.fsys.Lstat(op.path)
+	if err != nil {
+		return fmt.Errorf("source path does not exist: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--include needs a directory, %s is not one", op.path)
+	}
+
+	include := make([]string, 0, len(op.include))
+	for _, path := range op.include {
+		if err := manifest.ValidateInclude(filepath.ToSlash(path)); err != nil {
+			return err
+		}
+		path = filepath.ToSlash(filepath.Clean(path))
+		if _, err := op.fsys.Lstat(filepath.Join(op.path, filepath.FromSlash(path))); err != nil {
+			return fmt.Errorf("%s is not inside %s: %v", path, op.path, err)
+		}
+		if !slices.Contains(include, path) {
+			include = append(include, path)
+		}
+	}
+	slices.Sort(include)
+	// A path inside another included path is linked along with it
+	for i := 1; i < len(include); i++ {
+		for _, other := range include[:i] {
+			if strings.HasPrefix(include[i], other+"/") {
+				return fmt.Errorf("include %s is inside include %s", include[i], other)
+			}
+		}
+	}
+	op.include = include
+	return nil
+}
+
+// trackedPath returns the path recorded in the manifest: relative to the home
+// directory, or absolute in system mode
+func (op *addOperation) trackedPath() (string, error) {
+	if op.system {
+		return systemPath(op.fsys, op.path, op.config.DotmanDir)
+	}
+	return homeRelativePath(op.fsys, op.path)
+}
+
+// checkNested compares the source with the entries of m it would nest with.
+// A source inside a tracked directory is already tracked as part of it. A
+// source holding tracked entries is refused, as its copy would hold theirs
+// and the links of both would fight over the same files.
+func (op *addOperation) checkNested(m *manifest.Manifest) error {
+	if op.alreadyTracked {
+		return nil
+	}
+	if parent, ok := m.FindParent(op.relPath); ok {
+		op.parent = parent.Path
+		op.alreadyTracked = true
+		return nil
+	}
+	if children := m.Children(op.relPath); len(children) > 0 {
+		return fmt.Errorf("%s holds the tracked entries %s: a directory cannot be tracked along with paths inside it, add its other files one by one instead", op.path, strings.Join(children, ", "))
+	}
+	return nil
+}
+
+// checkDotmanDir refuses sources that are the dotman directory, lie inside
+// it or hold it, which would make the repository track itself. Symlinks are
+// followed, except for a source already linked to its own copy.
+func (op *addOperation) checkDotmanDir() error {
+	if op.linked {
+		return nil
+	}
+
+	path, err := dotmanfs.AbsHome(op.fsys, op.path)
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %v", err)
+	}
+	dotmanDir, err := op.fsys.Abs(op.config.DotmanDir)
 	if err != nil {
 		return fmt.Errorf("error getting absolute path: %v", err)
 	}
 
-	// Get relative path from home directory
-	relPath, err := op.fsys.Rel(homeDir, absPath)
+	// Symlinks can lead into the dotman directory, or to a directory
+	// holding it, from anywhere. Paths are compared as given and resolved.
+	paths, dirs := []string{filepath.Clean(path)}, []string{filepath.Clean(dotmanDir)}
+	if resolved, err := op.fsys.EvalSymlinks(path); err == nil {
+		paths = append(paths, resolved)
+	}
+	if resolved, err := op.fsys.EvalSymlinks(dotmanDir); err == nil {
+		dirs = append(dirs, resolved)
+	}
+	for _, path := range paths {
+		for _, dir := range dirs {
+			if isWithin(dir, path) {
+				return fmt.Errorf("%s is inside the dotman directory %s", op.path, op.config.DotmanDir)
+			}
+			if isWithin(path, dir) {
+				return fmt.Errorf("%s holds the dotman directory %s", op.path, op.config.DotmanDir)
+			}
+		}
+	}
+	return nil
+}
+
+// repoPath returns the location of the copy below dir, which is the dotman
+// directory or empty for a path relative to it
+func (op *addOperation) repoPath(dir string) string {
+	return op.layout.RepoPath(dir, manifest.Entry{Path: op.relPath})
+}
+
+// entryLinker returns the linker putting the copy in place of the source
+func (op *addOperation) entryLinker() linker {
+	return entryLinker(op.fsys, op.linker, manifest.Entry{Path: op.relPath, LineEndings: op.entryLineEndings()})
+}
+
+// trackedFile returns the file the repository tracks: the copy in the
+// dotman directory, or the source itself when it is tracked in place
+func (op *addOperation) trackedFile() string {
+	if op.inPlace {
+		return op.path
+	}
+	return op.repoPath(op.config.DotmanDir)
+}
+
+// homeRelativePath returns path relative to the user's home directory,
+// failing if the path lies outside of it
+func homeRelativePath(fsys dotmanfs.FileSystem, path string) (string, error) {
+	// Get user's home directory using fsys
+	homeDir, err := fsys.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("error getting relative path: %v", err)
+		return "", fmt.Errorf("error getting user home directory: %v", err)
 	}
 
-	// If the path is not within home directory, return error
+	// Check if the path is within the home directory
+	absPath, err := dotmanfs.AbsHome(fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %v", err)
+	}
+
+	// Get relative path from home directory
+	relPath, err := fsys.Rel(homeDir, absPath)
+	if err != nil {
+		return "", fmt.Errorf("error getting relative path: %v", err)
+	}
+
+	// If the path is not within home directory, return error
 	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
-		return fmt.Errorf("path must be within user's home directory")
+		return "", fmt.Errorf("path must be within user's home directory")
+	}
+
+	return relPath, nil
+}
+
+func (op *addOperation) verifySource() error {
+	// Create verification step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify source path exists", op.path, "")
+	if err != nil {
+		return err
+	}
+
+	// Start verification step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return err
+	}
+
+	// Perform verification
+	info, err := op.fsys.Lstat(op.path)
+	if err != nil {
+		// Fail the entire entry
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("source path does not exist: %v", err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return op.verifySymlinkSource(step)
+	}
+
+	// Complete verification step
+	details := fmt.Sprintf("Path exists and is a %s", map[bool]string{true: "directory", false: "file"}[info.IsDir()])
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// preflight checks that the copy fits in the dotman directory and that the
+// copy and the symlink replacing the source can be written, so problems
+// surface before anything is changed instead of halfway through a copy
+func (op *addOperation) preflight() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Pre-flight checks", op.path, op.repoPath(op.config.DotmanDir))
+	if err != nil {
+		return err
+	}
+
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return err
+	}
+
+	var problems []string
+
+	files, err := op.sourceFiles()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("error listing source files: %v", err))
+	}
+	var size int64
+	for _, file := range files {
+		if info, err := op.fsys.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	if err := checkFreeSpace(op.fsys, op.config.DotmanDir, size); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := dotmanfs.CheckWritable(op.fsys, filepath.Dir(op.repoPath(op.config.DotmanDir))); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	// System paths fall back to sudo when they are not writable
+	if !op.system {
+		if err := dotmanfs.CheckWritable(op.fsys, filepath.Dir(op.path)); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		err := preflightFailed(problems)
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return err
+	}
+
+	details := fmt.Sprintf("%d files, %s to copy", len(files), config.FormatSize(size))
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// verifySymlinkSource completes the verification step for a source that is a
+// symlink, which is only added once the user chose how to treat it
+func (op *addOperation) verifySymlinkSource(step *journal.Step) error {
+	target, err := op.fsys.Readlink(op.path)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error reading symlink: %v", err)
+	}
+
+	var details string
+	switch op.symlinks {
+	case symlinkFollow:
+		info, err := op.fsys.Stat(op.path)
+		if err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("symlink target %s does not exist: %v", target, err)
+		}
+		details = fmt.Sprintf("Path is a symlink to %s, following it to a %s", target, map[bool]string{true: "directory", false: "file"}[info.IsDir()])
+	case symlinkKeep:
+		details = fmt.Sprintf("Path is a symlink to %s, tracking the symlink itself", target)
+	default:
+		err := fmt.Errorf("%s is a symlink to %s, use --follow to track what it points to or --no-follow to track the symlink itself", op.path, target)
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return err
+	}
+
+	return journal.CompleteStep(op.ctx, step, details)
+}
+
+// keepsSymlink reports whether the source is a symlink tracked as such
+func (op *addOperation) keepsSymlink() bool {
+	if op.symlinks != symlinkKeep {
+		return false
+	}
+	info, err := op.fsys.Lstat(op.path)
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
+
+func (op *addOperation) copyAndVerify() error {
+	targetPath := op.repoPath(op.config.DotmanDir)
+	if op.keepsSymlink() {
+		return op.copyAndVerifySymlink(targetPath)
+	}
+
+	info, _ := op.fsys.Stat(op.path)
+	if info.IsDir() {
+		return op.copyAndVerifyDirectory(targetPath)
+	}
+	return op.copyAndVerifyFile(targetPath)
+}
+
+func (op *addOperation) copyAndVerifyDirectory(targetPath string) error {
+	// Add directory copy step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Copy directory contents", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start copy step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return err
+	}
+
+	if err := op.recordCopyRollback(step, targetPath); err != nil {
+		return err
+	}
+
+	// Copy directory
+	copyDir := func(fsys dotmanfs.FileSystem, src, dst string) error {
+		progress := newProgress("Copying "+src, op.sourceCount, op.sourceBytes)
+		defer progress.finish()
+
+		opts := op.copyOptions()
+		opts.Progress = progress.add
+		return dotmanfs.CopyDir(fsys, src, dst, opts)
+	}
+	if err := op.copyPath(targetPath, copyDir); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error copying directory: %v", err)
+	}
+
+	// Complete copy step
+	details := "Successfully copied all directory contents"
+	if len(op.skipped) > 0 {
+		details = fmt.Sprintf("%s, skipped %d junk entries: %s", details, len(op.skipped), strings.Join(op.skipped, ", "))
+	}
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return err
+	}
+
+	// Add verification step
+	verifyStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify directory copy", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start verification step
+	if err := journal.StartStep(op.ctx, verifyStep); err != nil {
+		return err
+	}
+
+	// Verify directory copy
+	verifyDir := func(fsys dotmanfs.FileSystem, src, dst string) error {
+		progress := newProgress("Verifying "+dst, op.sourceCount, op.sourceBytes)
+		defer progress.finish()
+
+		opts := op.copyOptions()
+		opts.Progress = progress.add
+		return dotmanfs.VerifyDir(fsys, src, dst, opts)
+	}
+	if err := op.verifyPath(targetPath, verifyDir); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error verifying directory copy: %v", err)
+	}
+
+	// Complete verification step
+	if err := journal.CompleteStep(op.ctx, verifyStep, "Successfully verified all directory contents match"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// recordCopyRollback records that undoing a copy step removes the copy
+func (op *addOperation) recordCopyRollback(step *journal.Step, targetPath string) error {
+	rollback := pathRollback(op.fsys, op.path)
+	rollback.Created = []string{targetPath}
+	return journal.RecordRollback(op.ctx, step, rollback)
+}
+
+func (op *addOperation) copyAndVerifySymlink(targetPath string) error {
+	// Add symlink copy step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Copy symlink", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start copy step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return err
+	}
+
+	if err := op.recordCopyRollback(step, targetPath); err != nil {
+		return err
+	}
+
+	// Copy the symlink
+	if err := op.copyPath(targetPath, dotmanfs.CopySymlink); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error copying symlink: %v", err)
+	}
+
+	// Complete copy step
+	if err := journal.CompleteStep(op.ctx, step, "Successfully copied symlink"); err != nil {
+		return err
+	}
+
+	// Add verification step
+	verifyStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify symlink copy", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start verification step
+	if err := journal.StartStep(op.ctx, verifyStep); err != nil {
+		return err
+	}
+
+	// Verify symlink copy
+	if err := op.verifyPath(targetPath, dotmanfs.VerifySymlink); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error verifying symlink copy: %v", err)
+	}
+
+	// Complete verification step
+	if err := journal.CompleteStep(op.ctx, verifyStep, "Successfully verified symlink target matches"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (op *addOperation) copyAndVerifyFile(targetPath string) error {
+	// Add file copy step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Copy file contents", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start copy step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return err
+	}
+
+	if err := op.recordCopyRollback(step, targetPath); err != nil {
+		return err
+	}
+
+	// Copy file, large ones take a while
+	copyFile := func(fsys dotmanfs.FileSystem, src, dst string) error {
+		progress := newProgress("Copying "+src, 0, 0)
+		defer progress.finish()
+		return dotmanfs.CopyFile(fsys, src, dst, op.config.Perm())
+	}
+	if err := op.copyPath(targetPath, copyFile); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error copying file: %v", err)
+	}
+
+	// Complete copy step
+	if err := journal.CompleteStep(op.ctx, step, "Successfully copied file contents"); err != nil {
+		return err
+	}
+
+	// Add verification step
+	verifyStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify file copy", op.path, targetPath)
+	if err != nil {
+		return err
+	}
+
+	// Start verification step
+	if err := journal.StartStep(op.ctx, verifyStep); err != nil {
+		return err
+	}
+
+	// Verify file copy
+	verifyFile := func(fsys dotmanfs.FileSystem, src, dst string) error {
+		progress := newProgress("Verifying "+dst, 0, 0)
+		defer progress.finish()
+		return dotmanfs.VerifyFile(fsys, src, dst)
+	}
+	if err := op.verifyPath(targetPath, verifyFile); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error verifying file copy: %v", err)
+	}
+
+	// Complete verification step
+	if err := journal.CompleteStep(op.ctx, verifyStep, "Successfully verified file contents match"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// copyOptions returns the options used to copy and verify a directory
+// source, skipping junk entries. Entries skipped while copying are recorded.
+func (op *addOperation) copyOptions() dotmanfs.CopyOptions {
+	junk := exclude.New(op.config.Exclude)
+	return dotmanfs.CopyOptions{
+		Exclude: func(rel string, d fs.DirEntry) bool {
+			// Externals are moved along after the copy
+			if d.IsDir() && isExternal(op.externals, rel) {
+				return true
+			}
+			// Siblings of the included paths are left in place
+			if !op.included(rel, d.IsDir()) {
+				return true
+			}
+			if !junk.Match(d.Name(), d.IsDir()) {
+				return false
+			}
+			if !slices.Contains(op.skipped, rel) {
+				op.skipped = append(op.skipped, rel)
+			}
+			return true
+		},
+		Perm: op.config.Perm(),
+	}
+}
+
+// copyPath copies the source to targetPath with copy. System files the
+// current user cannot read are copied with sudo instead.
+func (op *addOperation) copyPath(targetPath string, copy func(fsys dotmanfs.FileSystem, src, dst string) error) error {
+	// Drop a copy left behind by an earlier add that did not finish
+	if err := op.fsys.RemoveAll(targetPath); err != nil {
+		return err
+	}
+
+	if err := op.fsys.MkdirAll(filepath.Dir(targetPath), op.config.DirPerm()); err != nil {
+		return err
+	}
+
+	err := copy(op.fsys, op.path, targetPath)
+	if err == nil || !op.system || !os.IsPermission(err) {
+		return err
+	}
+
+	op.sudoCopied = true
+	return sudoCopy(op.fsys, op.path, targetPath)
+}
+
+// verifyPath checks the copy at targetPath with verify, or with sudo when the
+// copy needed it
+func (op *addOperation) verifyPath(targetPath string, verify func(fsys dotmanfs.FileSystem, src, dst string) error) error {
+	if op.sudoCopied {
+		return sudoVerify(op.path, targetPath)
 	}
+	return verify(op.fsys, op.path, targetPath)
+}
 
-	// Initialize journal manager
-	jm := journal.NewJournalManager(op.fsys, filepath.Join(op.config.DotmanDir, "journal"))
-	if err := jm.Initialize(); err != nil {
-		return fmt.Errorf("error initializing journal: %v", err)
+// normalizes reports whether CRLF line endings in the copy are converted to
+// LF, as chosen by --line-endings or the line_endings config key
+func (op *addOperation) normalizes() bool {
+	mode := op.lineEndings
+	if mode == "" {
+		mode = op.config.LineEndings
 	}
+	return mode == manifest.LineEndingsLF && !op.keepsSymlink() && !op.inPlace
+}
 
-	// Create journal entry with the relative path as target
-	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, relPath)
-	if err != nil {
-		return fmt.Errorf("error creating journal entry: %v", err)
+// entryLineEndings returns the line ending mode recorded in the manifest
+// entry: LineEndingsLF when the copy is normalized, empty otherwise
+func (op *addOperation) entryLineEndings() string {
+	if op.normalizes() {
+		return manifest.LineEndingsLF
 	}
+	return ""
+}
 
-	// Add journal manager and entry to context
-	op.ctx = journal.WithJournalManager(context.Background(), jm)
-	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+// normalize converts CRLF line endings in the text files of the copy to LF.
+// It runs after the copy was verified against the source, which it changes.
+func (op *addOperation) normalize() error {
+	if !op.normalizes() {
+		return nil
+	}
 
-	return nil
-}
+	targetPath := op.repoPath(op.config.DotmanDir)
 
-func (op *addOperation) verifySource() error {
-	// Create verification step
-	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify source path exists", op.path, "")
+	// Add normalize step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Normalize line endings", targetPath, "")
 	if err != nil {
 		return err
 	}
 
-	// Start verification step
+	// Start normalize step
 	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Perform verification
-	info, err := op.fsys.Stat(op.path)
+	count, err := dotmanfs.NormalizeLineEndings(op.fsys, targetPath)
 	if err != nil {
-		// Fail the entire entry
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
 		}
-		return fmt.Errorf("source path does not exist: %v", err)
+		return fmt.Errorf("error normalizing line endings: %v", err)
 	}
 
-	// Complete verification step
-	details := fmt.Sprintf("Path exists and is a %s", map[bool]string{true: "directory", false: "file"}[info.IsDir()])
-	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+	// Complete normalize step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Converted CRLF to LF in %d files", count)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (op *addOperation) copyAndVerify() error {
-	info, _ := op.fsys.Stat(op.path)
-	entry, _ := journal.GetJournalEntry(op.ctx)
-	targetPath := filepath.Join(op.config.DotmanDir, "data", entry.Target)
+// offloads reports whether the large files of the copy are moved to the
+// offload store, as set by offload_size. Like deduplication, only regular
+// files and directories copied below data/ are.
+func (op *addOperation) offloads() bool {
+	size, err := op.config.OffloadSizeBytes()
+	return err == nil && size > 0 && !op.system && !op.keepsSymlink() && !op.inPlace
+}
 
-	if info.IsDir() {
-		return op.copyAndVerifyDirectory(targetPath)
+// offload replaces the files of the copy larger than offload_size with
+// pointers to their content, uploaded to the offload store
+func (op *addOperation) offload() error {
+	if !op.offloads() {
+		return nil
 	}
-	return op.copyAndVerifyFile(targetPath)
-}
 
-func (op *addOperation) copyAndVerifyDirectory(targetPath string) error {
-	// Add directory copy step
-	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Copy directory contents", op.path, targetPath)
+	targetPath := op.repoPath(op.config.DotmanDir)
+
+	// Add offload step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Move large files to offload store", targetPath, op.config.OffloadStore)
 	if err != nil {
 		return err
 	}
 
-	// Start copy step
+	// Start offload step
 	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Copy directory
-	if err := copyDir(op.path, targetPath, op.fsys); err != nil {
+	count, err := op.offloadFiles(targetPath)
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
 		}
-		return fmt.Errorf("error copying directory: %v", err)
+		return fmt.Errorf("error offloading large files: %v", err)
 	}
+	op.offloaded = count > 0
 
-	// Complete copy step
-	if err := journal.CompleteStep(op.ctx, step, "Successfully copied all directory contents"); err != nil {
+	// Complete offload step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Offloaded %d files", count)); err != nil {
 		return err
 	}
 
-	// Add verification step
-	verifyStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify directory copy", op.path, targetPath)
+	return nil
+}
+
+// offloadFiles uploads the large files below targetPath and keeps the local
+// copies of their content out of git. It returns the number of files
+// offloaded.
+func (op *addOperation) offloadFiles(targetPath string) (int, error) {
+	size, _ := op.config.OffloadSizeBytes()
+	blobs, err := offload.New(op.fsys, op.config.OffloadStore)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := offload.Offload(op.fsys, op.config.DotmanDir, targetPath, size, blobs)
+	if err != nil || count == 0 {
+		return count, err
+	}
+	if _, err := ignorePatterns(op.fsys, op.config.DotmanDir, offload.Dir+"/"); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// deduplicates reports whether the copy is moved into the content-addressed
+// store. Only regular files and directories copied below data/ are.
+func (op *addOperation) deduplicates() bool {
+	return op.config.Dedup && !op.system && !op.keepsSymlink()
+}
+
+// dedup replaces the files of the copy with links into the store
+func (op *addOperation) dedup() error {
+	if !op.deduplicates() {
+		return nil
+	}
+
+	targetPath := op.repoPath(op.config.DotmanDir)
+
+	// Add dedup step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Move contents into store", targetPath, filepath.Join(op.config.DotmanDir, store.Dir))
 	if err != nil {
 		return err
 	}
 
-	// Start verification step
-	if err := journal.StartStep(op.ctx, verifyStep); err != nil {
+	// Start dedup step
+	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Verify directory copy
-	if err := verifyDirCopy(op.path, targetPath, op.fsys); err != nil {
+	count, err := store.Dedup(op.fsys, op.config.DotmanDir, targetPath)
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
 		}
-		return fmt.Errorf("error verifying directory copy: %v", err)
+		return fmt.Errorf("error moving contents into store: %v", err)
 	}
+	op.deduped = true
 
-	// Complete verification step
-	if err := journal.CompleteStep(op.ctx, verifyStep, "Successfully verified all directory contents match"); err != nil {
+	// Complete dedup step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Linked %d files to the store", count)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (op *addOperation) copyAndVerifyFile(targetPath string) error {
-	// Add file copy step
-	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Copy file contents", op.path, targetPath)
+// detectExternals finds the nested git repositories of a directory source to
+// record as externals instead of copying them
+func (op *addOperation) detectExternals() error {
+	if op.copyNested || op.keepsSymlink() || op.inPlace {
+		return nil
+	}
+	if info, err := op.fsys.Stat(op.path); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	externals, local, err := findExternals(op.fsys, op.path)
 	if err != nil {
-		return err
+		return fmt.Errorf("error looking for nested git repositories: %v", err)
+	}
+	// Repositories outside the included paths stay where they are
+	externals = slices.DeleteFunc(externals, func(external manifest.External) bool {
+		return !op.included(external.Path, true)
+	})
+	for _, rel := range local {
+		if op.included(rel, true) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is a git repository without an origin remote, its files are copied without its history\n", filepath.Join(op.path, rel))
+		}
 	}
+	op.externals = externals
+	return nil
+}
 
-	// Start copy step
+// moveExternals moves the checkouts of the externals into the copy, where
+// the symlink replacing the source finds them
+func (op *addOperation) moveExternals() error {
+	if len(op.externals) == 0 {
+		return nil
+	}
+
+	targetPath := op.repoPath(op.config.DotmanDir)
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeMove, "Move nested git repositories", op.path, targetPath)
+	if err != nil {
+		return err
+	}
 	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Copy file
-	if err := copyFile(op.path, targetPath, op.fsys); err != nil {
-		if err := journal.FailEntry(op.ctx, err); err != nil {
-			return err
+	var rollback journal.Rollback
+	for _, external := range op.externals {
+		rollback.Created = append(rollback.Created, filepath.Join(targetPath, filepath.FromSlash(external.Path)))
+	}
+	if err := journal.RecordRollback(op.ctx, step, rollback); err != nil {
+		return err
+	}
+
+	var moved []string
+	for _, external := range op.externals {
+		src := filepath.Join(op.path, filepath.FromSlash(external.Path))
+		dst := filepath.Join(targetPath, filepath.FromSlash(external.Path))
+		err := op.fsys.MkdirAll(filepath.Dir(dst), op.config.DirPerm())
+		if err == nil {
+			err = op.fsys.Rename(src, dst)
 		}
-		return fmt.Errorf("error copying file: %v", err)
+		if err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error moving nested git repository %s: %v", src, err)
+		}
+		moved = append(moved, external.Path)
 	}
 
-	// Complete copy step
-	if err := journal.CompleteStep(op.ctx, step, "Successfully copied file contents"); err != nil {
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Moved %d nested git repositories: %s", len(moved), strings.Join(moved, ", "))); err != nil {
 		return err
 	}
 
-	// Add verification step
-	verifyStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify file copy", op.path, targetPath)
+	return nil
+}
+
+func (op *addOperation) createSymlink() error {
+	targetPath := op.repoPath(op.config.DotmanDir)
+	l := op.entryLinker()
+
+	removeAll := op.fsys.RemoveAll
+	if op.system {
+		removeAll = func(path string) error { return systemRemoveAll(op.fsys, path) }
+	} else if op.config.Trash {
+		// The original can still be restored from the file manager
+		removeAll = func(path string) error {
+			_, err := trash.Move(op.fsys, path)
+			return err
+		}
+	}
+
+	// Add symlink step, named after the link mode
+	description := "Create symlink"
+	if l.mode() != config.LinkSymlink {
+		description = fmt.Sprintf("Create %s", l.mode())
+	}
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, description, op.path, targetPath)
 	if err != nil {
 		return err
 	}
 
-	// Start verification step
-	if err := journal.StartStep(op.ctx, verifyStep); err != nil {
+	// Start symlink step
+	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Verify file copy
-	if err := verifyFileCopy(op.path, targetPath, op.fsys); err != nil {
-		if err := journal.FailEntry(op.ctx, err); err != nil {
-			return err
+	// The tracked copy is the backup of the source the symlink replaces
+	homePaths, repoPaths := op.linkPaths()
+	rollback := pathRollback(op.fsys, op.path)
+	// Recording rewrites the paths of the rollback in place
+	rollback.Created = slices.Clone(homePaths)
+	rollback.Backup = targetPath
+	if err := journal.RecordRollback(op.ctx, step, rollback); err != nil {
+		return err
+	}
+
+	for i, homePath := range homePaths {
+		// Remove original file/directory
+		if err := removeAll(homePath); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error removing original file/directory: %v", err)
+		}
+
+		// Put the copy in place of the source
+		if err := l.link(repoPaths[i], homePath); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error creating %s: %v", l.mode(), err)
 		}
-		return fmt.Errorf("error verifying file copy: %v", err)
 	}
 
-	// Complete verification step
-	if err := journal.CompleteStep(op.ctx, verifyStep, "Successfully verified file contents match"); err != nil {
+	// Complete symlink step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Successfully created %s", l.mode())); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (op *addOperation) createSymlink() error {
+func (op *addOperation) updateManifest() error {
 	entry, _ := journal.GetJournalEntry(op.ctx)
-	targetPath := filepath.Join(op.config.DotmanDir, "data", entry.Target)
 
-	// Add symlink step
-	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, "Create symlink", op.path, targetPath)
+	// Add manifest step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeManifest, "Record entry in manifest", op.relPath, manifest.Path(op.config.DotmanDir))
 	if err != nil {
 		return err
 	}
 
-	// Start symlink step
+	// Start manifest step
 	if err := journal.StartStep(op.ctx, step); err != nil {
 		return err
 	}
 
-	// Remove original file/directory
-	if err := op.fsys.RemoveAll(op.path); err != nil {
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
 		}
-		return fmt.Errorf("error removing original file/directory: %v", err)
+		return fmt.Errorf("error loading manifest: %v", err)
 	}
 
-	// Create symlink
-	if err := op.fsys.Symlink(targetPath, op.path); err != nil {
+	// The data copy mirrors the source, so its type decides the entry type
+	info, err := op.fsys.Lstat(op.trackedFile())
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
 		}
-		return fmt.Errorf("error creating symlink: %v", err)
+		return fmt.Errorf("error reading tracked copy: %v", err)
 	}
 
-	// Complete symlink step
-	if err := journal.CompleteStep(op.ctx, step, "Successfully created symlink"); err != nil {
+	// A deduplicated or offloaded file is a link to its content but tracks
+	// file content
+	_, isBlob := store.Resolve(op.fsys, op.config.DotmanDir, op.trackedFile())
+	if _, offloaded := offload.Resolve(op.fsys, op.trackedFile()); offloaded {
+		isBlob = true
+	}
+	entryType := manifest.EntryTypeFile
+	if info.Mode()&fs.ModeSymlink != 0 && !isBlob {
+		entryType = manifest.EntryTypeSymlink
+	} else if info.IsDir() {
+		entryType = manifest.EntryTypeDirectory
+	}
+
+	added := manifest.Entry{
+		Path:        op.relPath,
+		Type:        entryType,
+		AddedAt:     entry.Timestamp,
+		Package:     op.pkg,
+		LineEndings: op.entryLineEndings(),
+		Externals:   op.externals,
+		Include:     op.include,
+	}
+	m.Add(added)
+
+	if err := manifest.Save(op.fsys, op.config.DotmanDir, m); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error saving manifest: %v", err)
+	}
+	recordState(op.fsys, op.config)
+
+	// Keep the checkouts of externals out of the dotman repository
+	if _, err := ignoreExternals(op.fsys, op.config.DotmanDir, m.Layout, added); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return err
+	}
+
+	// Complete manifest step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Recorded %s %s in manifest", entryType, op.relPath)); err != nil {
 		return err
 	}
 
@@ -317,8 +1635,16 @@ func (op *addOperation) gitAdd() error {
 		return err
 	}
 
-	// Open the repository
-	repo, err := git.PlainOpen(op.config.DotmanDir)
+	// Open the repository on the worktree of its backend, which the
+	// manifest now lists the entry in
+	b, err := loadBackend(op.fsys, op.config.DotmanDir, op.config.Perm())
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return err
+	}
+	repo, err := openRepo(op.fsys, op.config.DotmanDir, b)
 	if err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return err
@@ -326,6 +1652,10 @@ func (op *addOperation) gitAdd() error {
 		return fmt.Errorf("error opening repository: %v", err)
 	}
 
+	if err := journal.RecordRollback(op.ctx, step, headRollback(repo)); err != nil {
+		return err
+	}
+
 	// Get the worktree
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -336,8 +1666,7 @@ func (op *addOperation) gitAdd() error {
 	}
 
 	// Add the file to git using the relative path
-	entry, _ := journal.GetJournalEntry(op.ctx)
-	targetPath := filepath.Join("data", entry.Target)
+	targetPath := b.gitPath(manifest.Entry{Path: op.relPath})
 	fmt.Println("Adding file to git:", targetPath)
 	if _, err := worktree.Add(targetPath); err != nil {
 		if err := journal.FailEntry(op.ctx, err); err != nil {
@@ -346,6 +1675,35 @@ func (op *addOperation) gitAdd() error {
 		return fmt.Errorf("error adding file to git: %v", err)
 	}
 
+	// Stage the blobs the tracked data links to
+	if op.deduped {
+		if _, err := worktree.Add(store.Dir); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error adding store to git: %v", err)
+		}
+	}
+
+	// Stage the patterns ignoring the checkouts of externals and the local
+	// copies of offloaded files
+	if len(op.externals) > 0 || op.offloaded {
+		if _, err := worktree.Add(".gitignore"); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error adding .gitignore to git: %v", err)
+		}
+	}
+
+	// Stage the manifest alongside the tracked data
+	if _, err := worktree.Add(b.manifestPath()); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return err
+		}
+		return fmt.Errorf("error adding manifest to git: %v", err)
+	}
+
 	// Complete git add step
 	if err := journal.CompleteStep(op.ctx, step, "Successfully added file to git"); err != nil {
 		return err
@@ -358,173 +1716,199 @@ func (op *addOperation) complete() error {
 	return journal.CompleteEntry(op.ctx)
 }
 
-func copyFile(src, dst string, fsys dotmanfs.FileSystem) error {
-	file, err := fsys.Open(src)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	info, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	data := make([]byte, info.Size())
-	if _, err := file.Read(data); err != nil {
-		return err
-	}
+// addBatchOperation adds several paths under a single journal entry
+type addBatchOperation struct {
+	paths  []string
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
 
-	return fsys.WriteFile(dst, data, info.Mode())
+	// package every path is recorded in, if any
+	pkg string
+	// how sources that are symlinks are tracked
+	symlinks symlinkPolicy
+	// add files larger than max_file_size anyway
+	forceLarge bool
+	// line endings of the copies, overriding the line_endings config key
+	lineEndings string
+	// copy nested git repositories instead of recording them as externals
+	copyNested bool
+
+	// one add operation per path, sharing the batch context
+	items []*addOperation
 }
 
-func verifyFileCopy(src, dst string, fsys dotmanfs.FileSystem) error {
-	srcFile, err := fsys.Open(src)
-	if err != nil {
-		return fmt.Errorf("error reading source file: %v", err)
-	}
-	defer srcFile.Close()
-
-	dstFile, err := fsys.Open(dst)
-	if err != nil {
-		return fmt.Errorf("error reading destination file: %v", err)
-	}
-	defer dstFile.Close()
-
-	srcInfo, err := srcFile.Stat()
-	if err != nil {
-		return fmt.Errorf("error getting source file info: %v", err)
-	}
-
-	dstInfo, err := dstFile.Stat()
-	if err != nil {
-		return fmt.Errorf("error getting destination file info: %v", err)
-	}
-
-	if srcInfo.Size() != dstInfo.Size() {
-		return fmt.Errorf("file sizes differ: source=%d bytes, destination=%d bytes", srcInfo.Size(), dstInfo.Size())
-	}
-
-	srcData := make([]byte, srcInfo.Size())
-	dstData := make([]byte, dstInfo.Size())
-
-	if _, err := srcFile.Read(srcData); err != nil {
-		return fmt.Errorf("error reading source file content: %v", err)
+func (op *addBatchOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
 	}
 
-	if _, err := dstFile.Read(dstData); err != nil {
-		return fmt.Errorf("error reading destination file content: %v", err)
+	if len(op.items) == 0 {
+		return nil
 	}
 
-	for i := range srcData {
-		if srcData[i] != dstData[i] {
-			return fmt.Errorf("file contents differ at byte %d", i)
+	for _, item := range op.items {
+		if err := op.addItem(item); err != nil {
+			// The failed path is recorded by its own entry, the group
+			// fails as a whole
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return err
+			}
+			return fmt.Errorf("error adding %s: %v", item.path, err)
 		}
 	}
 
-	return nil
+	return op.complete()
 }
 
-func copyDir(src, dst string, fsys dotmanfs.FileSystem) error {
-	// Create destination directory
-	if err := fsys.MkdirAll(dst, 0755); err != nil {
+// addItem adds a single path of the batch, recorded in its own entry grouped
+// under the batch entry
+func (op *addBatchOperation) addItem(item *addOperation) error {
+	ctx, err := journal.StartChildEntry(op.ctx, journal.OperationTypeAdd, item.path, item.trackedFile())
+	if err != nil {
 		return err
 	}
+	item.ctx = ctx
 
-	// Read source directory
-	dir, err := fsys.Open(src)
-	if err != nil {
+	if err := item.addPath(); err != nil {
 		return err
 	}
-	defer dir.Close()
 
-	entries, err := dir.ReadDir(-1)
+	return item.complete()
+}
+
+// prepare validates every path before anything is recorded, collecting the
+// ones not tracked yet in op.items, and returns the manifest they are added
+// to
+func (op *addBatchOperation) prepare() (*manifest.Manifest, error) {
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Copy each entry
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+	op.items = nil
+	for _, path := range op.paths {
+		relPath, err := homeRelativePath(op.fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
 
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath, fsys); err != nil {
-				return err
-			}
-		} else {
-			if err := copyFile(srcPath, dstPath, fsys); err != nil {
-				return err
+		item := &addOperation{
+			path:        path,
+			relPath:     relPath,
+			layout:      m.Layout,
+			inPlace:     m.InPlace(),
+			linker:      newLinker(op.fsys, op.config, m),
+			config:      op.config,
+			fsys:        op.fsys,
+			pkg:         op.pkg,
+			symlinks:    op.symlinks,
+			forceLarge:  op.forceLarge,
+			lineEndings: op.lineEndings,
+			copyNested:  op.copyNested,
+		}
+		if err := item.detectTracked(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if err := item.checkNested(m); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if item.alreadyTracked {
+			continue
+		}
+		if err := item.checkDotmanDir(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		// Paths of the batch nest like tracked ones would
+		for _, other := range op.items {
+			if isWithin(other.relPath, relPath) || isWithin(relPath, other.relPath) {
+				return nil, fmt.Errorf("%s: %s is also added, add only one of a directory and the paths inside it", path, other.path)
 			}
 		}
+		if err := item.detectExternals(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if err := item.checkSizes(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		op.items = append(op.items, item)
 	}
 
-	return nil
+	return m, nil
 }
 
-func verifyDirCopy(src, dst string, fsys dotmanfs.FileSystem) error {
-	srcDir, err := fsys.Open(src)
+func (op *addBatchOperation) initialize() error {
+	m, err := op.prepare()
 	if err != nil {
-		return fmt.Errorf("error reading source directory: %v", err)
+		return err
 	}
-	defer srcDir.Close()
 
-	dstDir, err := fsys.Open(dst)
-	if err != nil {
-		return fmt.Errorf("error reading destination directory: %v", err)
+	if len(op.items) == 0 {
+		return nil
 	}
-	defer dstDir.Close()
 
-	srcEntries, err := srcDir.ReadDir(-1)
+	homeDir, err := op.fsys.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("error reading source directory entries: %v", err)
+		return fmt.Errorf("error getting user home directory: %v", err)
 	}
 
-	dstEntries, err := dstDir.ReadDir(-1)
-	if err != nil {
-		return fmt.Errorf("error reading destination directory entries: %v", err)
+	// Initialize journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("error initializing journal: %v", err)
 	}
 
-	if len(srcEntries) != len(dstEntries) {
-		return fmt.Errorf("directory contents differ: source has %d entries, destination has %d entries", len(srcEntries), len(dstEntries))
+	// The entry groups the whole batch, each path gets a child entry
+	target := m.Layout.HomeDir(op.config.DotmanDir)
+	if m.InPlace() {
+		target = homeDir
 	}
-
-	for _, srcEntry := range srcEntries {
-		dstIndex := slices.IndexFunc(dstEntries, func(elem fs.DirEntry) bool {
-			return elem.Name() == srcEntry.Name()
-		})
-		if dstIndex == -1 {
-			return fmt.Errorf("directory entries differ: source has %s, destination does not", srcEntry.Name())
-		}
-
-		dstEntry := dstEntries[dstIndex]
-
-		srcPath := filepath.Join(src, srcEntry.Name())
-		dstPath := filepath.Join(dst, dstEntry.Name())
-
-		if srcEntry.IsDir() {
-			if !dstEntry.IsDir() {
-				return fmt.Errorf("entry type mismatch: %s is a directory in source but not in destination", srcEntry.Name())
-			}
-			if err := verifyDirCopy(srcPath, dstPath, fsys); err != nil {
-				return err
-			}
-		} else {
-			if dstEntry.IsDir() {
-				return fmt.Errorf("entry type mismatch: %s is a file in source but a directory in destination", srcEntry.Name())
-			}
-			if err := verifyFileCopy(srcPath, dstPath, fsys); err != nil {
-				return fmt.Errorf("error verifying file %s: %v", srcEntry.Name(), err)
-			}
-		}
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, homeDir, target)
+	if err != nil {
+		return fmt.Errorf("error creating journal entry: %v", err)
 	}
 
+	// Add journal manager and entry to context
+	op.ctx = journal.WithJournalManager(context.Background(), jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
 	return nil
 }
 
+func (op *addBatchOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
+
 func init() {
 	rootCmd.AddCommand(addCmd)
 
 	addCmd.Flags().StringP("path", "p", "", "path to the dotfile")
-	addCmd.MarkFlagRequired("path")
+	addCmd.Flags().BoolP("interactive", "i", false, "pick dotfiles to add from a scan of the home directory")
+	addCmd.Flags().String("from-file", "", "add the paths listed one per line in this file, - for stdin")
+	addCmd.Flags().Bool("dry-run", false, "print the plan of what would be added for apply-plan, without adding anything")
+	addCmd.MarkFlagsMutuallyExclusive("path", "interactive", "from-file")
+	addCmd.MarkFlagsMutuallyExclusive("dry-run", "interactive")
+	addCmd.RegisterFlagCompletionFunc("path", completeUntrackedPaths)
+	addCmd.Flags().String("package", "", "record the dotfile in this package")
+	addCmd.RegisterFlagCompletionFunc("package", completePackages)
+	addCmd.Flags().Bool("system", false, "track an absolute path outside the home directory")
+	addCmd.MarkFlagsMutuallyExclusive("system", "interactive")
+	addCmd.MarkFlagsMutuallyExclusive("from-file", "system")
+	addCmd.MarkFlagsMutuallyExclusive("dry-run", "system")
+	addCmd.Flags().Bool("follow", false, "if the path is a symlink, track the content it points to")
+	addCmd.Flags().Bool("no-follow", false, "if the path is a symlink, track the symlink itself")
+	addCmd.Flags().Bool("force-large", false, "add files larger than max_file_size")
+	addCmd.Flags().String("line-endings", "", "line endings of added text files, keep or lf; defaults to the line_endings config key")
+	addCmd.Flags().Bool("copy-nested", false, "copy nested git repositories without their history instead of recording them as externals")
+	addCmd.MarkFlagsMutuallyExclusive("follow", "no-follow")
+	addCmd.Flags().Bool("secret", false, "track the dotfile in the secrets repository named by secrets_profile")
+	addCmd.Flags().String("repo", "", "track the dotfile in the repository of this profile")
+	addCmd.RegisterFlagCompletionFunc("repo", completeProfiles)
+	addCmd.MarkFlagsMutuallyExclusive("secret", "repo")
+	addCmd.Flags().StringArray("include", nil, "track only this path inside the directory, may be repeated")
+	addCmd.MarkFlagsMutuallyExclusive("include", "interactive")
+	addCmd.MarkFlagsMutuallyExclusive("include", "from-file")
+	addCmd.MarkFlagsMutuallyExclusive("include", "dry-run")
+	addCmd.MarkFlagsMutuallyExclusive("include", "system")
 }
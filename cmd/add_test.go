@@ -2,13 +2,20 @@ package cmd
 
 import (
 	"context"
+	"io/fs"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	stdFstest "testing/fstest"
 
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/noosxe/dotman/internal/config"
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/noosxe/dotman/internal/store"
 	"github.com/noosxe/dotman/internal/testutil"
 )
 
@@ -51,9 +58,98 @@ func TestAddOperation_Initialize(t *testing.T) {
 		t.Fatalf("failed to get journal entry: %v", err)
 	}
 
+	// The source is recorded relative to the home directory
 	testutil.VerifyEntry(t, entry, journal.OperationTypeAdd, journal.EntryStateCurrent)
-	if entry.Source != sourcePath {
-		t.Fatalf("expected source '%s', got '%s'", sourcePath, entry.Source)
+	if entry.Source != "~/test/file" {
+		t.Fatalf("expected source '~/test/file', got '%s'", entry.Source)
+	}
+}
+
+func TestAddOperation_MaxFileSize(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+	cfg.MaxFileSize = "1K"
+
+	sourcePath := filepath.Join(testutil.TestHomeDir, ".cache")
+	memFS.MkdirAll(filepath.Join(sourcePath, "sub"), 0755)
+	memFS.WriteFile(filepath.Join(sourcePath, "small"), []byte("small"), 0644)
+	memFS.WriteFile(filepath.Join(sourcePath, "sub", "large"), make([]byte, 2048), 0644)
+
+	// A large file anywhere below the source refuses the add before it starts
+	op := &addOperation{path: sourcePath, fsys: memFS, config: cfg}
+	err = op.initialize()
+	if err == nil || !strings.Contains(err.Error(), "--force-large") {
+		t.Fatalf("expected the large file to be refused, got %v", err)
+	}
+	if op.ctx != nil {
+		t.Fatal("expected no journal entry for a refused add")
+	}
+
+	op = &addOperation{path: sourcePath, fsys: memFS, config: cfg, forceLarge: true}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("expected --force-large to allow the add, got %v", err)
+	}
+
+	// A limit of 0 turns the check off
+	cfg.MaxFileSize = "0"
+	op = &addOperation{path: sourcePath, fsys: memFS, config: cfg}
+	if err := op.checkSizes(); err != nil {
+		t.Fatalf("expected no limit with max_file_size 0, got %v", err)
+	}
+}
+
+func TestAddOperation_Preflight(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+
+	sourcePath := filepath.Join(testutil.TestHomeDir, ".cache")
+	memFS.MkdirAll(sourcePath, 0755)
+	memFS.WriteFile(filepath.Join(sourcePath, "a"), make([]byte, 600), 0644)
+	memFS.WriteFile(filepath.Join(sourcePath, "b"), make([]byte, 600), 0644)
+
+	// Each file fits, both together do not
+	memFS.SetFreeSpace(1000)
+
+	op := &addOperation{path: sourcePath, fsys: memFS, config: cfg}
+	err = op.run()
+	if err == nil || !strings.Contains(err.Error(), "not enough space") {
+		t.Fatalf("expected the add to be refused for lack of space, got %v", err)
+	}
+
+	if _, err := memFS.Stat(filepath.Join(dotmanDir, "data/.cache")); err == nil {
+		t.Fatal("expected nothing to be copied after a failed pre-flight check")
+	}
+	if info, err := memFS.Lstat(sourcePath); err != nil || !info.IsDir() {
+		t.Fatalf("expected the source to be left alone, got %v", err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeAdd, journal.EntryStateFailed, 2)
+	testutil.VerifyStep(t, entry.Steps[1], journal.StepTypeVerify, journal.StepStatusFailed, "Pre-flight checks")
+
+	memFS.SetFreeSpace(2000)
+	op = &addOperation{path: sourcePath, fsys: memFS, config: cfg}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	if err := op.verifySource(); err != nil {
+		t.Fatalf("verifySource() returned error: %v", err)
+	}
+	if err := op.preflight(); err != nil {
+		t.Fatalf("expected the pre-flight checks to pass with enough space, got %v", err)
 	}
 }
 
@@ -289,6 +385,198 @@ func TestAddOperation_CopyAndVerifyDirectory(t *testing.T) {
 	testutil.VerifyStep(t, entry.Steps[1], journal.StepTypeVerify, journal.StepStatusCompleted, "Verify directory copy")
 }
 
+func TestAddOperation_SkipsJunk(t *testing.T) {
+	memFS, err := dotmanfs.NewMemoryFileSystem(map[string]*stdFstest.MapFile{
+		"test/source/init.lua":              {Data: []byte("init"), Mode: 0644},
+		"test/source/.DS_Store":             {Data: []byte("junk"), Mode: 0644},
+		"test/source/.init.lua.swp":         {Data: []byte("junk"), Mode: 0644},
+		"test/source/lua/__pycache__/a.pyc": {Data: []byte("junk"), Mode: 0644},
+		"test/source/.git/HEAD":             {Data: []byte("junk"), Mode: 0644},
+		"test/source/lua/debug.log":         {Data: []byte("junk"), Mode: 0644},
+		"test/source/lua/plugins.lua":       {Data: []byte("plugins"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	targetPath := "dotman/data/source"
+	op := &addOperation{
+		path:    "test/source",
+		relPath: "source",
+		fsys:    memFS,
+		ctx:     context.Background(),
+		config: &config.Config{
+			DotmanDir: "dotman",
+			Exclude:   []string{"*.log"},
+		},
+	}
+
+	jm := testutil.SetupJournalManager(t, memFS, "dotman")
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, targetPath)
+	if err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	if err := op.copyAndVerifyDirectory(targetPath); err != nil {
+		t.Fatalf("copyAndVerifyDirectory() returned error: %v", err)
+	}
+
+	for _, path := range []string{"init.lua", "lua/plugins.lua", "lua"} {
+		if _, err := memFS.Stat(filepath.Join(targetPath, path)); err != nil {
+			t.Errorf("expected %s to be copied: %v", path, err)
+		}
+	}
+	for _, path := range []string{".DS_Store", ".init.lua.swp", "lua/__pycache__", ".git", "lua/debug.log"} {
+		if _, err := memFS.Lstat(filepath.Join(targetPath, path)); err == nil {
+			t.Errorf("expected junk entry %s to be skipped", path)
+		}
+	}
+
+	entry, err = journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	if !strings.Contains(entry.Steps[0].Details, "skipped 5 junk entries") {
+		t.Errorf("expected the copy step to record the skipped entries, got %q", entry.Steps[0].Details)
+	}
+}
+
+func TestAddOperation_NormalizeLineEndings(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+	cfg.LineEndings = manifest.LineEndingsLF
+
+	sourcePath := filepath.Join(testutil.TestHomeDir, ".gitconfig")
+	memFS.WriteFile(sourcePath, []byte("[user]\r\n\tname = test\r\n"), 0644)
+
+	op := &addOperation{path: sourcePath, fsys: memFS, config: cfg}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	if err := op.verifySource(); err != nil {
+		t.Fatalf("verifySource() returned error: %v", err)
+	}
+	if err := op.copyAndVerify(); err != nil {
+		t.Fatalf("copyAndVerify() returned error: %v", err)
+	}
+	if err := op.normalize(); err != nil {
+		t.Fatalf("normalize() returned error: %v", err)
+	}
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+
+	data, err := memFS.ReadFile(op.repoPath(dotmanDir))
+	if err != nil || string(data) != "[user]\n\tname = test\n" {
+		t.Fatalf("expected LF line endings in the copy, got %q (%v)", data, err)
+	}
+
+	m, err := manifest.Load(memFS, dotmanDir)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	if tracked, ok := m.Find(".gitconfig"); !ok || tracked.LineEndings != manifest.LineEndingsLF {
+		t.Fatalf("expected the entry to record LF line endings, got %+v", tracked)
+	}
+
+	// --line-endings keep overrides the config key
+	op = &addOperation{path: sourcePath, fsys: memFS, config: cfg, lineEndings: manifest.LineEndingsKeep}
+	if op.normalizes() {
+		t.Fatal("expected --line-endings keep to turn normalization off")
+	}
+}
+
+func TestAddOperation_Dedup(t *testing.T) {
+	memFS, err := dotmanfs.NewMemoryFileSystem(map[string]*stdFstest.MapFile{
+		"test/source/a.ttf":     {Data: []byte("font"), Mode: 0644},
+		"test/source/b/b.ttf":   {Data: []byte("font"), Mode: 0644},
+		"test/source/other.ttf": {Data: []byte("other"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	targetPath := "dotman/data/source"
+	op := &addOperation{
+		path:    "test/source",
+		relPath: "source",
+		fsys:    memFS,
+		ctx:     context.Background(),
+		config: &config.Config{
+			DotmanDir: "dotman",
+			Dedup:     true,
+		},
+	}
+
+	jm := testutil.SetupJournalManager(t, memFS, "dotman")
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, targetPath)
+	if err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	if err := op.copyAndVerifyDirectory(targetPath); err != nil {
+		t.Fatalf("copyAndVerifyDirectory() returned error: %v", err)
+	}
+	if err := op.dedup(); err != nil {
+		t.Fatalf("dedup() returned error: %v", err)
+	}
+	if !op.deduped {
+		t.Fatal("expected the copy to be marked as deduplicated")
+	}
+
+	// Identical files link to the same blob
+	blobA, okA := store.Resolve(memFS, "dotman", filepath.Join(targetPath, "a.ttf"))
+	blobB, okB := store.Resolve(memFS, "dotman", filepath.Join(targetPath, "b", "b.ttf"))
+	blobOther, okOther := store.Resolve(memFS, "dotman", filepath.Join(targetPath, "other.ttf"))
+	if !okA || !okB || !okOther {
+		t.Fatal("expected every copied file to link into the store")
+	}
+	if blobA != blobB || blobA == blobOther {
+		t.Fatalf("expected only identical files to share a blob, got %s, %s and %s", blobA, blobB, blobOther)
+	}
+	if data, err := memFS.ReadFile(blobA); err != nil || string(data) != "font" {
+		t.Fatalf("expected the blob to hold the file content, got %q (%v)", data, err)
+	}
+
+	entry, err = journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	if len(entry.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(entry.Steps))
+	}
+	testutil.VerifyStep(t, entry.Steps[2], journal.StepTypeCopy, journal.StepStatusCompleted, "Move contents into store")
+
+	// A single deduplicated file is a blob link but is recorded as a file
+	op.path = "test/source/other.ttf"
+	op.relPath = "other.ttf"
+	if err := op.copyAndVerifyFile(op.repoPath("dotman")); err != nil {
+		t.Fatalf("copyAndVerifyFile() returned error: %v", err)
+	}
+	if err := op.dedup(); err != nil {
+		t.Fatalf("dedup() returned error: %v", err)
+	}
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+	m, err := manifest.Load(memFS, "dotman")
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	if tracked, ok := m.Find("other.ttf"); !ok || tracked.Type != manifest.EntryTypeFile {
+		t.Fatalf("expected a file entry for a deduplicated file, got %+v", tracked)
+	}
+}
+
 func TestAddOperation_Complete(t *testing.T) {
 	mockFS, err := dotmanfs.NewMockFileSystem(nil)
 	if err != nil {
@@ -350,12 +638,14 @@ func TestAddOperation_CreateSymlink(t *testing.T) {
 
 	// Initialize operation
 	op := &addOperation{
-		path: sourcePath,
-		fsys: mockFS,
-		ctx:  context.Background(),
+		path:    sourcePath,
+		relPath: ".config/nvim/init.lua",
+		fsys:    mockFS,
+		ctx:     context.Background(),
 		config: &config.Config{
 			DotmanDir: "dotman",
 		},
+		linker: &symlinkLinker{fsys: mockFS},
 	}
 
 	// Set up journal manager and entry in context
@@ -394,4 +684,681 @@ func TestAddOperation_CreateSymlink(t *testing.T) {
 	}
 
 	testutil.VerifyStep(t, entry.Steps[0], journal.StepTypeSymlink, journal.StepStatusCompleted, "Create symlink")
+
+	// The step records how to put the original file back
+	rollback := entry.Steps[0].Rollback
+	if rollback == nil {
+		t.Fatal("expected the symlink step to record rollback data")
+	}
+	if rollback.Backup != targetPath || rollback.Mode != 0644 || len(rollback.Created) != 1 || rollback.Created[0] != "~/.config/nvim/init.lua" {
+		t.Errorf("unexpected rollback data %+v", *rollback)
+	}
+}
+
+func TestAddOperation_UpdateManifest(t *testing.T) {
+	initialState := map[string]*stdFstest.MapFile{
+		"dotman/.manfile": &stdFstest.MapFile{
+			Data: []byte("{}"),
+			Mode: 0644,
+		},
+		"dotman/data/.config/nvim/init.lua": &stdFstest.MapFile{
+			Data: []byte("test content"),
+			Mode: 0644,
+		},
+	}
+	mockFS, err := dotmanfs.NewMockFileSystemWithHome(initialState, "home/test")
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	op := &addOperation{
+		path:    "home/test/.config/nvim",
+		relPath: ".config/nvim",
+		fsys:    mockFS,
+		ctx:     context.Background(),
+		config: &config.Config{
+			DotmanDir: "dotman",
+		},
+	}
+
+	jm := testutil.SetupJournalManager(t, mockFS, "dotman")
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, ".config/nvim")
+	if err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+
+	m, err := manifest.Load(mockFS, "dotman")
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+
+	tracked, ok := m.Find(".config/nvim")
+	if !ok {
+		t.Fatal("expected .config/nvim to be recorded in manifest")
+	}
+	if tracked.Type != manifest.EntryTypeDirectory {
+		t.Fatalf("expected entry type '%s', got '%s'", manifest.EntryTypeDirectory, tracked.Type)
+	}
+
+	if len(entry.Steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(entry.Steps))
+	}
+
+	testutil.VerifyStep(t, entry.Steps[0], journal.StepTypeManifest, journal.StepStatusCompleted, "Record entry in manifest")
+}
+
+func TestAddBatchOperation_Initialize(t *testing.T) {
+	mockFS, err := dotmanfs.NewMockFileSystemWithHome(map[string]*stdFstest.MapFile{
+		"home/test/.zshrc":                {Data: []byte("zsh"), Mode: 0644},
+		"home/test/.config/nvim/init.lua": {Data: []byte("nvim"), Mode: 0644},
+	}, "home/test")
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, "dotman")
+
+	op := &addBatchOperation{
+		paths:  []string{"home/test/.zshrc", "home/test/.config/nvim"},
+		fsys:   mockFS,
+		config: cfg,
+	}
+
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntry(t, entry, journal.OperationTypeAdd, journal.EntryStateCurrent)
+
+	expected := []string{".zshrc", ".config/nvim"}
+	if len(op.items) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(op.items))
+	}
+	for i, relPath := range expected {
+		if op.items[i].relPath != relPath {
+			t.Fatalf("item %d: expected relative path %s, got %s", i, relPath, op.items[i].relPath)
+		}
+	}
+
+	// A path outside the home directory rejects the whole batch
+	op.paths = append(op.paths, "etc/hosts")
+	if err := op.initialize(); err == nil {
+		t.Fatal("expected error for path outside home directory")
+	}
+}
+
+func TestAddBatchOperation_Group(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+
+	large := filepath.Join(testutil.TestHomeDir, ".histfile")
+	small := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	memFS.WriteFile(large, make([]byte, 500), 0644)
+	memFS.WriteFile(small, make([]byte, 50), 0644)
+
+	// The first path does not fit, which fails the batch as a whole
+	memFS.SetFreeSpace(100)
+
+	op := &addBatchOperation{
+		paths:  []string{large, small},
+		fsys:   memFS,
+		config: cfg,
+	}
+	if err := op.run(); err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+
+	group, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, group, journal.OperationTypeAdd, journal.EntryStateFailed, 0)
+	if group.Error == "" {
+		t.Error("expected the group to record why it failed")
+	}
+
+	// The batch stops at the failed path, the rest is never started
+	jm, _ := journal.GetJournalManager(op.ctx)
+	children, err := jm.ChildEntries(group)
+	if err != nil || len(children) != 1 {
+		t.Fatalf("expected 1 grouped entry, got %d (%v)", len(children), err)
+	}
+	if children[0].Source != "~/.histfile" || children[0].State != journal.EntryStateFailed {
+		t.Errorf("expected %s to fail, got %s %s", large, children[0].Source, children[0].State)
+	}
+	testutil.VerifyJournalEntryCount(t, jm, journal.EntryStateFailed, 2)
+}
+
+func TestAddOperation_System(t *testing.T) {
+	initialState := map[string]*stdFstest.MapFile{
+		"etc/hosts": &stdFstest.MapFile{
+			Data: []byte("127.0.0.1 localhost"),
+			Mode: 0644,
+		},
+	}
+	mockFS, err := dotmanfs.NewMockFileSystemWithHome(initialState, "/home/test")
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, "/home/test/.dotman")
+
+	// Paths inside the home directory are not system paths
+	op := &addOperation{path: "/home/test/.zshrc", fsys: mockFS, config: cfg, system: true}
+	if err := op.initialize(); err == nil {
+		t.Fatal("expected error for a home path in system mode")
+	}
+
+	op = &addOperation{path: "/etc/hosts", fsys: mockFS, config: cfg, system: true}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	if op.relPath != "/etc/hosts" {
+		t.Fatalf("expected tracked path '/etc/hosts', got '%s'", op.relPath)
+	}
+
+	if err := op.copyAndVerify(); err != nil {
+		t.Fatalf("copyAndVerify() returned error: %v", err)
+	}
+
+	data, err := mockFS.ReadFile("/home/test/.dotman/system/etc/hosts")
+	if err != nil {
+		t.Fatalf("expected copy under the system tree: %v", err)
+	}
+	if string(data) != "127.0.0.1 localhost" {
+		t.Fatalf("unexpected copy content '%s'", data)
+	}
+
+	if err := op.createSymlink(); err != nil {
+		t.Fatalf("createSymlink() returned error: %v", err)
+	}
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+
+	m, err := manifest.Load(mockFS, cfg.DotmanDir)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	tracked, ok := m.Find("/etc/hosts")
+	if !ok || !tracked.IsSystem() {
+		t.Fatal("expected /etc/hosts to be recorded as a system entry")
+	}
+	if tracked.TargetPath("/home/test") != "/etc/hosts" {
+		t.Fatalf("expected target '/etc/hosts', got '%s'", tracked.TargetPath("/home/test"))
+	}
+}
+
+func TestAddOperation_AlreadyTracked(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	// Simulate an add that stopped after linking, before recording the entry
+	sourcePath := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	dataPath := filepath.Join(dotmanDir, "data", ".zshrc")
+	if err := mockFS.WriteFile(dataPath, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := mockFS.Symlink(dataPath, sourcePath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	op := &addOperation{path: sourcePath, fsys: mockFS, config: cfg}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	if !op.linked || op.alreadyTracked {
+		t.Fatalf("expected a linked but unrecorded source, got linked=%v alreadyTracked=%v", op.linked, op.alreadyTracked)
+	}
+
+	// Recording the entry is all that is left; git is not set up here
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+
+	op = &addOperation{path: sourcePath, fsys: mockFS, config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !op.alreadyTracked {
+		t.Fatal("expected the second add to detect an already tracked path")
+	}
+	if op.ctx != nil {
+		t.Fatal("expected no journal entry for an already tracked path")
+	}
+
+	data, err := mockFS.ReadFile(sourcePath)
+	if err != nil || string(data) != "zsh" {
+		t.Fatalf("expected the symlink to be left in place, got %q (%v)", data, err)
+	}
+}
+
+func TestAddOperation_DotmanDir(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	home := testutil.TestHomeDir
+	mockFS.WriteFile(filepath.Join(dotmanDir, "data/.vimrc"), []byte("vim"), 0644)
+	mockFS.WriteFile(filepath.Join(home, ".zshrc"), []byte("zsh"), 0644)
+	mockFS.MkdirAll(filepath.Join(home, ".config"), 0755)
+	// Symlinks to the dotman directory, into it and to the directory holding it
+	mockFS.Symlink(dotmanDir, filepath.Join(home, "dots"))
+	mockFS.Symlink(filepath.Join(dotmanDir, "data"), filepath.Join(home, ".config/data"))
+	mockFS.Symlink(home, filepath.Join(home, ".config/home"))
+
+	tests := []struct {
+		path    string
+		refused string
+	}{
+		{path: dotmanDir, refused: "inside"},
+		{path: filepath.Join(dotmanDir, "data/.vimrc"), refused: "inside"},
+		{path: filepath.Join(dotmanDir, "journal"), refused: "inside"},
+		{path: home, refused: "holds"},
+		{path: filepath.Join(home, "dots"), refused: "inside"},
+		{path: filepath.Join(home, "dots/data/.vimrc"), refused: "inside"},
+		{path: filepath.Join(home, ".config/data"), refused: "inside"},
+		{path: filepath.Join(home, ".config/home"), refused: "holds"},
+		{path: filepath.Join(home, ".config/home/.dotman"), refused: "inside"},
+		{path: filepath.Join(home, ".zshrc")},
+		{path: filepath.Join(home, ".config")},
+	}
+	for _, tt := range tests {
+		op := &addOperation{path: tt.path, fsys: mockFS, config: cfg}
+		err := op.initialize()
+		switch {
+		case tt.refused == "" && err != nil:
+			t.Errorf("%s: expected to be added, got %v", tt.path, err)
+		case tt.refused != "" && (err == nil || !strings.Contains(err.Error(), tt.refused+" the dotman directory")):
+			t.Errorf("%s: expected to be refused as %s the dotman directory, got %v", tt.path, tt.refused, err)
+		}
+	}
+}
+
+func TestAddOperation_Nested(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	// ~/.local is tracked and linked, ~/.config/nvim is tracked inside the
+	// untracked ~/.config
+	home := testutil.TestHomeDir
+	mockFS.MkdirAll(filepath.Join(dotmanDir, "data/.local/share"), 0755)
+	mockFS.WriteFile(filepath.Join(dotmanDir, "data/.local/share/notes"), []byte("notes"), 0644)
+	mockFS.Symlink(filepath.Join(dotmanDir, "data/.local"), filepath.Join(home, ".local"))
+	mockFS.MkdirAll(filepath.Join(home, ".config/nvim"), 0755)
+	mockFS.MkdirAll(filepath.Join(home, ".config/fish/conf.d"), 0755)
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".local", Type: manifest.EntryTypeDirectory})
+	m.Add(manifest.Entry{Path: ".config/nvim", Type: manifest.EntryTypeDirectory})
+	if err := manifest.Save(mockFS, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+
+	op := &addOperation{path: filepath.Join(home, ".local/share/notes"), fsys: mockFS, config: cfg}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("expected a path inside a tracked directory to be accepted, got %v", err)
+	}
+	if !op.alreadyTracked || op.parent != ".local" {
+		t.Errorf("expected the path to be tracked as part of .local, got tracked %v parent %q", op.alreadyTracked, op.parent)
+	}
+
+	op = &addOperation{path: filepath.Join(home, ".config"), fsys: mockFS, config: cfg}
+	if err := op.initialize(); err == nil || !strings.Contains(err.Error(), "holds the tracked entries .config/nvim") {
+		t.Errorf("expected a directory holding a tracked entry to be refused, got %v", err)
+	}
+
+	batch := &addBatchOperation{
+		fsys:   mockFS,
+		config: cfg,
+		paths:  []string{filepath.Join(home, ".config/fish"), filepath.Join(home, ".config/fish/conf.d")},
+	}
+	if _, err := batch.prepare(); err == nil || !strings.Contains(err.Error(), "is also added") {
+		t.Errorf("expected nested paths of a batch to be refused, got %v", err)
+	}
+}
+
+func TestAddOperation_Include(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	sourcePath := filepath.Join(testutil.TestHomeDir, ".config/fish")
+	mockFS.MkdirAll(filepath.Join(sourcePath, "functions"), 0755)
+	mockFS.MkdirAll(filepath.Join(sourcePath, "completions"), 0755)
+	mockFS.WriteFile(filepath.Join(sourcePath, "functions/ll.fish"), []byte("ll"), 0644)
+	mockFS.WriteFile(filepath.Join(sourcePath, "config.fish"), []byte("config"), 0644)
+	mockFS.WriteFile(filepath.Join(sourcePath, "fish_variables"), []byte("variables"), 0644)
+	mockFS.WriteFile(filepath.Join(sourcePath, "completions/git.fish"), []byte("generated"), 0644)
+
+	for _, include := range [][]string{{"missing"}, {"../fish"}, {"functions", "functions/ll.fish"}} {
+		op := &addOperation{path: sourcePath, fsys: mockFS, config: cfg, include: include}
+		if err := op.initialize(); err == nil {
+			t.Errorf("expected include %v to be refused", include)
+		}
+	}
+
+	op := &addOperation{path: sourcePath, fsys: mockFS, config: cfg, include: []string{"functions/", "config.fish"}}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	// git is not set up here, the steps before staging do the work
+	for _, step := range []func() error{op.verifySource, op.preflight, op.copyAndVerify, op.createSymlink, op.updateManifest} {
+		if err := step(); err != nil {
+			t.Fatalf("add step returned error: %v", err)
+		}
+	}
+
+	// Only the included paths are copied and linked
+	repoPath := filepath.Join(dotmanDir, "data/.config/fish")
+	for _, rel := range []string{"fish_variables", "completions"} {
+		if _, err := mockFS.Lstat(filepath.Join(repoPath, rel)); err == nil {
+			t.Errorf("expected %s not to be copied", rel)
+		}
+		if info, err := mockFS.Lstat(filepath.Join(sourcePath, rel)); err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			t.Errorf("expected %s to be left in place, got %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"functions", "config.fish"} {
+		if info, err := mockFS.Lstat(filepath.Join(sourcePath, rel)); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("expected %s to be linked, got %v", rel, err)
+		}
+	}
+
+	m, err := manifest.Load(mockFS, dotmanDir)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	entry, ok := m.Find(".config/fish")
+	if !ok || !reflect.DeepEqual(entry.Include, []string{"config.fish", "functions"}) {
+		t.Fatalf("expected the include list to be recorded sorted, got %+v", entry)
+	}
+	if state := entryState(mockFS, newLinker(mockFS, cfg, m), dotmanDir, m, *entry, testutil.TestHomeDir); state != "linked" {
+		t.Errorf("expected the entry to be linked, got %s", state)
+	}
+	if _, ok := m.FindParent(".config/fish/completions/git.fish"); ok {
+		t.Error("expected a sibling of the included paths not to be tracked")
+	}
+
+	// The same add again is a no-op
+	op = &addOperation{path: sourcePath, fsys: mockFS, config: cfg, include: []string{"config.fish", "functions"}}
+	if err := op.initialize(); err != nil || !op.alreadyTracked {
+		t.Errorf("expected the entry to be already tracked, got %v", err)
+	}
+}
+
+func TestAddOperation_SymlinkSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		symlinks    symlinkPolicy
+		expectError bool
+		entryType   manifest.EntryType
+	}{
+		{name: "refuse by default", symlinks: symlinkRefuse, expectError: true},
+		{name: "follow", symlinks: symlinkFollow, entryType: manifest.EntryTypeFile},
+		{name: "no follow", symlinks: symlinkKeep, entryType: manifest.EntryTypeSymlink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+			if err != nil {
+				t.Fatalf("failed to create mock filesystem: %v", err)
+			}
+			defer mockFS.CleanUp()
+
+			cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+			// The dotfile is a symlink managed by another tool
+			if err := mockFS.MkdirAll("stow", 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			if err := mockFS.WriteFile("stow/zshrc", []byte("zsh"), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			sourcePath := filepath.Join(testutil.TestHomeDir, ".zshrc")
+			if err := mockFS.Symlink("stow/zshrc", sourcePath); err != nil {
+				t.Fatalf("failed to create symlink: %v", err)
+			}
+
+			op := &addOperation{path: sourcePath, fsys: mockFS, config: cfg, symlinks: tt.symlinks}
+			if err := op.initialize(); err != nil {
+				t.Fatalf("initialize() returned error: %v", err)
+			}
+
+			err = op.verifySource()
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySource() returned error: %v", err)
+			}
+
+			if err := op.copyAndVerify(); err != nil {
+				t.Fatalf("copyAndVerify() returned error: %v", err)
+			}
+			if err := op.createSymlink(); err != nil {
+				t.Fatalf("createSymlink() returned error: %v", err)
+			}
+			if err := op.updateManifest(); err != nil {
+				t.Fatalf("updateManifest() returned error: %v", err)
+			}
+
+			m, err := manifest.Load(mockFS, dotmanDir)
+			if err != nil {
+				t.Fatalf("failed to load manifest: %v", err)
+			}
+			tracked, ok := m.Find(".zshrc")
+			if !ok || tracked.Type != tt.entryType {
+				t.Fatalf("expected entry of type '%s', got %+v", tt.entryType, tracked)
+			}
+
+			// The file managed by the other tool is left alone
+			if data, err := mockFS.ReadFile("stow/zshrc"); err != nil || string(data) != "zsh" {
+				t.Fatalf("expected stow/zshrc to be untouched, got %q (%v)", data, err)
+			}
+		})
+	}
+}
+
+func TestAddOperation_Offload(t *testing.T) {
+	memFS, err := dotmanfs.NewMemoryFileSystem(map[string]*stdFstest.MapFile{
+		"test/source/wallpaper.png": {Data: []byte(strings.Repeat("x", 2048)), Mode: 0644},
+		"test/source/theme.conf":    {Data: []byte("dark"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	targetPath := "dotman/data/source"
+	op := &addOperation{
+		path:    "test/source",
+		relPath: "source",
+		fsys:    memFS,
+		ctx:     context.Background(),
+		config: &config.Config{
+			DotmanDir:    "dotman",
+			MaxFileSize:  "1K",
+			OffloadSize:  "1K",
+			OffloadStore: "/blobs",
+		},
+	}
+
+	// Files offloaded never reach git, so max_file_size does not apply
+	if err := op.checkSizes(); err != nil {
+		t.Fatalf("checkSizes() returned error: %v", err)
+	}
+
+	jm := testutil.SetupJournalManager(t, memFS, "dotman")
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, op.path, targetPath)
+	if err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	if err := op.copyAndVerifyDirectory(targetPath); err != nil {
+		t.Fatalf("copyAndVerifyDirectory() returned error: %v", err)
+	}
+	if err := op.offload(); err != nil {
+		t.Fatalf("offload() returned error: %v", err)
+	}
+	if !op.offloaded {
+		t.Fatal("expected the copy to be marked as offloaded")
+	}
+
+	hash, ok := offload.Resolve(memFS, filepath.Join(targetPath, "wallpaper.png"))
+	if !ok {
+		t.Fatal("expected the large file to be replaced with a pointer")
+	}
+	if _, ok := offload.Resolve(memFS, filepath.Join(targetPath, "theme.conf")); ok {
+		t.Error("expected the small file to stay in the repository")
+	}
+	if _, err := memFS.Stat(filepath.Join("blobs", hash[:2], hash[2:])); err != nil {
+		t.Errorf("expected the content to be uploaded to the offload store: %v", err)
+	}
+	gitignore, err := memFS.ReadFile("dotman/.gitignore")
+	if err != nil || !strings.Contains(string(gitignore), offload.Dir+"/") {
+		t.Errorf("expected .gitignore to ignore the local copies, got %q (%v)", gitignore, err)
+	}
+
+	entry, err = journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	if len(entry.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(entry.Steps))
+	}
+	testutil.VerifyStepWithDetails(t, entry.Steps[2], journal.StepTypeCopy, journal.StepStatusCompleted, "Move large files to offload store", "Offloaded 1 files")
+
+	// Without a usable store the add is refused before anything is copied
+	op.config.OffloadStore = "ftp://example.com/blobs"
+	if err := op.checkSizes(); err == nil {
+		t.Error("expected an invalid offload_store to be refused")
+	}
+}
+
+func TestAddOperation_Externals(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	// A plugin checkout with an origin, and a local repository without one
+	source := filepath.Join(testutil.TestHomeDir, ".config/nvim")
+	if err := mockFS.MkdirAll(source, 0755); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	if err := mockFS.WriteFile(filepath.Join(source, "init.lua"), []byte("nvim"), 0644); err != nil {
+		t.Fatalf("failed to write init.lua: %v", err)
+	}
+	plugin := filepath.Join(source, "pack/plugins/start/foo")
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, mockFS, plugin)
+	testutil.CreateTestFileAndCommit(t, mockFS, worktree, plugin, "plugin/foo.lua", "foo")
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/foo.git"}}); err != nil {
+		t.Fatalf("failed to create remote: %v", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	local := filepath.Join(source, "pack/local/start/bar")
+	_, localWorktree, _ := testutil.SetupTestGitRepo(t, mockFS, local)
+	testutil.CreateTestFileAndCommit(t, mockFS, localWorktree, local, "plugin/bar.lua", "bar")
+
+	op := &addOperation{path: source, fsys: mockFS, config: cfg}
+	if err := op.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	expected := manifest.External{Path: "pack/plugins/start/foo", URL: "https://example.com/foo.git", Commit: head.Hash().String()}
+	if len(op.externals) != 1 || op.externals[0] != expected {
+		t.Fatalf("expected external %+v, got %+v", expected, op.externals)
+	}
+
+	targetPath := op.repoPath(dotmanDir)
+	if err := op.copyAndVerify(); err != nil {
+		t.Fatalf("copyAndVerify() returned error: %v", err)
+	}
+	if _, err := mockFS.Lstat(filepath.Join(targetPath, "pack/plugins/start/foo")); err == nil {
+		t.Error("expected the plugin checkout not to be copied")
+	}
+	if _, err := mockFS.Stat(filepath.Join(targetPath, "pack/local/start/bar/plugin/bar.lua")); err != nil {
+		t.Errorf("expected the local repository's files to be copied: %v", err)
+	}
+	if _, err := mockFS.Lstat(filepath.Join(targetPath, "pack/local/start/bar/.git")); err == nil {
+		t.Error("expected the local repository's history to be skipped")
+	}
+
+	// The checkout moves into the copy with its history
+	if err := op.moveExternals(); err != nil {
+		t.Fatalf("moveExternals() returned error: %v", err)
+	}
+	if _, err := mockFS.Stat(filepath.Join(targetPath, "pack/plugins/start/foo/.git/HEAD")); err != nil {
+		t.Errorf("expected the plugin checkout to be moved with its history: %v", err)
+	}
+
+	// The manifest records it and .gitignore keeps it out of the repository
+	if err := op.updateManifest(); err != nil {
+		t.Fatalf("updateManifest() returned error: %v", err)
+	}
+	m, err := manifest.Load(mockFS, dotmanDir)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	entry, ok := m.Find(".config/nvim")
+	if !ok || len(entry.Externals) != 1 || entry.Externals[0] != expected {
+		t.Fatalf("expected the external in the manifest, got %+v", entry)
+	}
+	gitignore, err := mockFS.ReadFile(filepath.Join(dotmanDir, ".gitignore"))
+	if err != nil || !strings.Contains(string(gitignore), "/data/.config/nvim/pack/plugins/start/foo/\n") {
+		t.Errorf("expected the checkout to be ignored, got %q (%v)", gitignore, err)
+	}
+
+	jEntry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyStepWithDetails(t, jEntry.Steps[2], journal.StepTypeMove, journal.StepStatusCompleted, "Move nested git repositories", "Moved 1 nested git repositories: pack/plugins/start/foo")
 }
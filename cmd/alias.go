@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias [name] [path]",
+	Short: "Give a tracked dotfile a short name",
+	Long: `Give a tracked dotfile a short name that commands accept in place of its
+path, such as nvim for ~/.config/nvim. Aliases are kept in the manifest, so
+every machine using the repository knows them.
+
+Without arguments, alias lists the aliases. An entry has at most one alias,
+giving it another replaces it. --remove removes an alias.
+
+which, annotate, chmod, mv and commit --path take an alias wherever they take
+the path of a tracked dotfile. A name that is an alias always means the
+entry, use ./name for a file of that name in the current directory.`,
+	Example: `  dotman alias nvim ~/.config/nvim
+  dotman which nvim
+  dotman alias --remove nvim`,
+	Args: cobra.MaximumNArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 1 {
+			return completeTrackedPaths(cmd, nil, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		switch {
+		case len(args) == 0 && !remove:
+			return listAliases()
+		case len(args) == 1 && remove:
+			name := args[0]
+			err := runManifestOperation(journal.OperationTypeAlias, fmt.Sprintf("Remove alias %s", name), func(m *manifest.Manifest) (string, error) {
+				entry, ok := m.FindAlias(name)
+				if !ok {
+					return "", fmt.Errorf("no alias named %s", name)
+				}
+				entry.Alias = ""
+				return fmt.Sprintf("Removed alias %s of %s", name, entry.Path), nil
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed alias %s\n", name)
+			return nil
+		case len(args) == 2 && !remove:
+		default:
+			return errors.New("give a name and a path, --remove and a name, or nothing to list the aliases")
+		}
+
+		name := args[0]
+		if err := manifest.ValidateAlias(name); err != nil {
+			return err
+		}
+		path, err := entryPath(args[1])
+		if err != nil {
+			return err
+		}
+
+		err = runManifestOperation(journal.OperationTypeAlias, fmt.Sprintf("Alias %s as %s", path, name), func(m *manifest.Manifest) (string, error) {
+			entry, ok := m.Find(path)
+			if !ok {
+				return "", fmt.Errorf("%s is not tracked", path)
+			}
+			if other, ok := m.FindAlias(name); ok && other.Path != entry.Path {
+				return "", fmt.Errorf("%s is already the alias of %s", name, other.Path)
+			}
+			entry.Alias = name
+			return fmt.Sprintf("Aliased %s as %s", path, name), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Aliased %s as %s\n", path, name)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+
+	aliasCmd.Flags().Bool("remove", false, "remove the alias with the given name")
+}
+
+// listAliases prints the aliases of the tracked entries with their paths
+func listAliases() error {
+	cfg, err := config.LoadConfig(configPath, fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	found := false
+	for _, entry := range m.Entries {
+		if entry.Alias != "" {
+			fmt.Fprintf(w, "%s\t%s\n", entry.Alias, entry.Path)
+			found = true
+		}
+	}
+	if !found {
+		fmt.Println("No aliases")
+		return nil
+	}
+	return w.Flush()
+}
+
+// aliasPath returns the home path of the entry arg is the alias of, and arg
+// itself when it is not an alias. Lookup failures are left to the command,
+// which reports them for the path as given.
+func aliasPath(arg string) string {
+	if manifest.ValidateAlias(arg) != nil {
+		return arg
+	}
+	cfg, ok := completionConfig()
+	if !ok {
+		return arg
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return arg
+	}
+	entry, ok := m.FindAlias(arg)
+	if !ok {
+		return arg
+	}
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return arg
+	}
+	return entry.TargetPath(homeDir)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestAliasPath(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	// Point the command globals at the mock filesystem
+	oldFsys, oldConfigPath := fsys, configPath
+	fsys, configPath = mockFS, filepath.Join(testutil.TestHomeDir, ".dotconfig")
+	defer func() { fsys, configPath = oldFsys, oldConfigPath }()
+
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".config/nvim", Type: manifest.EntryTypeDirectory, AddedAt: time.Now(), Alias: "nvim"})
+	m.Add(manifest.Entry{Path: "/etc/hosts", Type: manifest.EntryTypeFile, AddedAt: time.Now(), Alias: "hosts"})
+	if err := manifest.Save(mockFS, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+
+	tests := map[string]string{
+		"nvim":     filepath.Join(testutil.TestHomeDir, ".config/nvim"),
+		"hosts":    "/etc/hosts",
+		"vim":      "vim",
+		"./nvim":   "./nvim",
+		"~/.zshrc": "~/.zshrc",
+	}
+	for arg, expected := range tests {
+		if got := aliasPath(arg); got != expected {
+			t.Errorf("aliasPath(%q) = %q, expected %q", arg, got, expected)
+		}
+	}
+
+	// Commands taking entry paths take aliases
+	if path, err := entryPath("nvim"); err != nil || path != ".config/nvim" {
+		t.Errorf("expected entryPath of the alias to be .config/nvim, got %q (%v)", path, err)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var annotateCmd = &cobra.Command{
+	Use:   "annotate <path> [note]",
+	Short: "Describe a tracked dotfile with a note and tags",
+	Long: `Attach a free-text note and tags to a tracked dotfile, so a repository
+shared with others describes itself. Notes and tags are kept in the manifest
+and shown by list and which.
+
+The note replaces any earlier one, use "" to remove it. --tag and --untag add
+and remove tags, --clear removes the note and all tags.`,
+	Example: `  dotman annotate ~/.config/karabiner "needs Karabiner 14+" --tag macos
+  dotman annotate ~/.config/karabiner --untag macos
+  dotman annotate ~/.config/karabiner --clear`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completeFirstArg(completeTrackedPaths),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		untags, _ := cmd.Flags().GetStringSlice("untag")
+		clear, _ := cmd.Flags().GetBool("clear")
+
+		if len(args) == 1 && len(tags) == 0 && len(untags) == 0 && !clear {
+			return errors.New("nothing to annotate, give a note, --tag, --untag or --clear")
+		}
+		for _, tag := range append(tags, untags...) {
+			if err := manifest.ValidateTag(tag); err != nil {
+				return err
+			}
+		}
+
+		path, err := entryPath(args[0])
+		if err != nil {
+			return err
+		}
+
+		var note *string
+		if len(args) == 2 {
+			note = &args[1]
+		}
+
+		err = runManifestOperation(journal.OperationTypeAnnotate, fmt.Sprintf("Annotate %s", path), func(m *manifest.Manifest) (string, error) {
+			entry, ok := m.Find(path)
+			if !ok {
+				return "", fmt.Errorf("%s is not tracked", path)
+			}
+			annotate(entry, note, tags, untags, clear)
+			return fmt.Sprintf("Annotated %s", path), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Annotated %s\n", path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(annotateCmd)
+
+	annotateCmd.Flags().StringSlice("tag", nil, "add a tag to the entry. Can be specified multiple times.")
+	annotateCmd.Flags().StringSlice("untag", nil, "remove a tag from the entry. Can be specified multiple times.")
+	annotateCmd.Flags().Bool("clear", false, "remove the note and all tags before applying the others")
+}
+
+// annotate changes the annotations of entry: clear removes them first, a
+// non-nil note replaces the note and tags and untags are added and removed
+func annotate(entry *manifest.Entry, note *string, tags, untags []string, clear bool) {
+	if clear {
+		entry.Note = ""
+		entry.Tags = nil
+	}
+	if note != nil {
+		entry.Note = strings.TrimSpace(*note)
+	}
+	entry.AddTags(tags...)
+	entry.RemoveTags(untags...)
+}
+
+// entryPath returns the manifest path of an entry given as a path on this
+// machine or an alias: relative to the home directory, or absolute for
+// system files
+func entryPath(path string) (string, error) {
+	path = aliasPath(path)
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %v", err)
+	}
+
+	absPath, err := dotmanfs.AbsHome(fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %v", err)
+	}
+	absPath = filepath.Clean(absPath)
+
+	if !isWithin(homeDir, absPath) {
+		return absPath, nil
+	}
+	return filepath.Rel(homeDir, absPath)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestAnnotate(t *testing.T) {
+	entry := manifest.Entry{Path: ".config/karabiner", Type: manifest.EntryTypeDirectory}
+
+	note := " needs Karabiner 14+ "
+	annotate(&entry, &note, []string{"macos", "gui"}, nil, false)
+	if entry.Note != "needs Karabiner 14+" {
+		t.Errorf("unexpected note %q", entry.Note)
+	}
+	if got := annotation(entry); got != "[gui, macos] needs Karabiner 14+" {
+		t.Errorf("unexpected annotation %q", got)
+	}
+
+	// Without a note only the tags change
+	annotate(&entry, nil, []string{"work"}, []string{"gui"}, false)
+	if got := annotation(entry); got != "[macos, work] needs Karabiner 14+" {
+		t.Errorf("unexpected annotation %q", got)
+	}
+
+	// An empty note removes it
+	empty := ""
+	annotate(&entry, &empty, nil, nil, false)
+	if got := annotation(entry); got != "[macos, work]" {
+		t.Errorf("unexpected annotation %q", got)
+	}
+
+	// --clear removes everything before the other changes apply
+	annotate(&entry, nil, []string{"linux"}, nil, true)
+	if got := annotation(entry); got != "[linux]" {
+		t.Errorf("unexpected annotation %q", got)
+	}
+	annotate(&entry, nil, nil, nil, true)
+	if entry.Note != "" || entry.Tags != nil || annotation(entry) != "" {
+		t.Errorf("expected no annotations, got %+v", entry)
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	mockFS, _, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	oldFsys := fsys
+	fsys = mockFS
+	defer func() { fsys = oldFsys }()
+
+	tests := map[string]string{
+		filepath.Join(testutil.TestHomeDir, ".config/karabiner"): ".config/karabiner",
+		filepath.Join(testutil.TestHomeDir, ".zshrc/"):           ".zshrc",
+		"~/.config/karabiner":                                    ".config/karabiner",
+		"/etc/hosts":                                             "/etc/hosts",
+		filepath.Join(testutil.TestHomeDir, "../other/.zshrc"):   filepath.Join(filepath.Dir(testutil.TestHomeDir), "other/.zshrc"),
+	}
+	for path, want := range tests {
+		got, err := entryPath(path)
+		if err != nil {
+			t.Errorf("entryPath(%s) failed: %v", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("entryPath(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/machines"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// backend is how the dotman repository holds the entries of its manifest.
+// The symlink backend keeps copies of them in the repository and links them
+// into place. The worktree backend tracks them where they are, with the home
+// directory as the worktree of the repository, like yadm does. Commands that
+// stage, commit or report the tracked files go through it.
+type backend interface {
+	// worktree returns the worktree of the repository, holding the entries
+	worktree() billy.Filesystem
+	// gitPath returns the path git stages entry as, with forward slashes
+	gitPath(entry manifest.Entry) string
+	// manifestPath returns the path git stages the manifest as
+	manifestPath() string
+	// entryPath returns the entry path of a file as git reports it, and
+	// whether the file belongs to an entry rather than to dotman
+	entryPath(file string) (string, bool)
+	// filePath returns the location of a file as git reports it
+	filePath(file string) string
+	// links reports whether the entries are symlinks to their copies
+	links() bool
+}
+
+// newBackend returns the backend of the repository in dotmanDir, as its
+// manifest m names it. Its worktree creates files within perm.
+func newBackend(fsys dotmanfs.FileSystem, dotmanDir string, m *manifest.Manifest, perm dotmanfs.Perm) (backend, error) {
+	if !m.InPlace() {
+		return &symlinkBackend{fsys: fsys, dotmanDir: dotmanDir, layout: m.Layout, perm: perm}, nil
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+	dotmanRel, err := homeRel(homeDir, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{path.Join(dotmanRel, manifest.FileName), path.Join(dotmanRel, machines.Dir)}
+	for _, entry := range m.Entries {
+		paths = append(paths, filepath.ToSlash(entry.Path))
+	}
+	return &worktreeBackend{
+		fsys:      fsys,
+		dotmanDir: dotmanDir,
+		homeDir:   homeDir,
+		dotmanRel: dotmanRel,
+		paths:     paths,
+		perm:      perm,
+	}, nil
+}
+
+// loadBackend loads the manifest of dotmanDir and returns its backend
+func loadBackend(fsys dotmanfs.FileSystem, dotmanDir string, perm dotmanfs.Perm) (backend, error) {
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	return newBackend(fsys, dotmanDir, m, perm)
+}
+
+// openRepo opens the repository in dotmanDir on the worktree of b
+func openRepo(fsys dotmanfs.FileSystem, dotmanDir string, b backend) (*git.Repository, error) {
+	return git.Open(newGitStorage(fsys, dotmanDir), b.worktree())
+}
+
+// homeRel returns dir relative to the home directory with forward slashes.
+// The worktree backend needs the dotman directory below it, to track the
+// manifest along with the entries.
+func homeRel(homeDir, dir string) (string, error) {
+	rel, err := filepath.Rel(homeDir, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the worktree backend needs the dotman directory %s inside the home directory %s", dir, homeDir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// symlinkBackend keeps copies of the entries below the layout directories of
+// the dotman directory, which is the worktree of the repository
+type symlinkBackend struct {
+	fsys      dotmanfs.FileSystem
+	dotmanDir string
+	layout    manifest.Layout
+	perm      dotmanfs.Perm
+}
+
+func (b *symlinkBackend) worktree() billy.Filesystem {
+	return dotmanfs.NewBillyFileSystem(b.fsys, b.dotmanDir, b.perm)
+}
+
+func (b *symlinkBackend) gitPath(entry manifest.Entry) string {
+	return filepath.ToSlash(b.layout.RepoPath("", entry))
+}
+
+func (b *symlinkBackend) manifestPath() string {
+	return manifest.FileName
+}
+
+func (b *symlinkBackend) entryPath(file string) (string, bool) {
+	return b.layout.HomeRel(file)
+}
+
+func (b *symlinkBackend) filePath(file string) string {
+	return filepath.Join(b.dotmanDir, filepath.FromSlash(file))
+}
+
+func (b *symlinkBackend) links() bool {
+	return true
+}
+
+// worktreeBackend tracks the entries in place. The worktree of the
+// repository is the home directory, seen through a sparse view holding only
+// the entries and the manifest, so git never walks the rest of it.
+type worktreeBackend struct {
+	fsys      dotmanfs.FileSystem
+	dotmanDir string
+	homeDir   string
+	// the dotman directory relative to the home directory
+	dotmanRel string
+	// the paths the worktree shows, relative to the home directory
+	paths []string
+	perm  dotmanfs.Perm
+}
+
+func (b *worktreeBackend) worktree() billy.Filesystem {
+	return dotmanfs.NewSparseFileSystem(b.fsys, b.homeDir, b.paths, b.perm)
+}
+
+func (b *worktreeBackend) gitPath(entry manifest.Entry) string {
+	return filepath.ToSlash(entry.Path)
+}
+
+func (b *worktreeBackend) manifestPath() string {
+	return path.Join(b.dotmanRel, manifest.FileName)
+}
+
+func (b *worktreeBackend) entryPath(file string) (string, bool) {
+	return file, file != b.manifestPath() && !strings.HasPrefix(file, path.Join(b.dotmanRel, machines.Dir)+"/")
+}
+
+func (b *worktreeBackend) filePath(file string) string {
+	return filepath.Join(b.homeDir, filepath.FromSlash(file))
+}
+
+func (b *worktreeBackend) links() bool {
+	return false
+}
+
+// initWorktreeRepo initializes the repository of the worktree backend in
+// dotmanDir. The repository is created without a worktree, so nothing is
+// written to the home directory, then pointed at it the way git's
+// core.worktree does, which also lets the git command line use it.
+func initWorktreeRepo(fsys dotmanfs.FileSystem, dotmanDir string) error {
+	repo, err := git.InitWithOptions(newGitStorage(fsys, dotmanDir), nil, git.InitOptions{
+		DefaultBranch: "refs/heads/main",
+	})
+	if err != nil {
+		return err
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error getting user home directory: %w", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Core.IsBare = false
+	cfg.Core.Worktree = homeDir
+	return repo.Storer.SetConfig(cfg)
+}
+
+// tracksInPlace reports whether the repository of cfg uses the worktree
+// backend, which leaves the files it tracks where they are
+func tracksInPlace(cfg *config.Config) bool {
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	return err == nil && m.InPlace()
+}
+
+// requireSymlinks refuses commands that move the copies of entries around
+// in a repository tracking them in place
+func requireSymlinks(m *manifest.Manifest, command string) error {
+	if m.InPlace() {
+		return fmt.Errorf("%s works on the copies of the symlink backend, the worktree backend tracks the entries in place", command)
+	}
+	return nil
+}
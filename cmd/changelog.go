@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// changelog is what landed in the repository between two commits, e.g.
+// merged from another machine since the last link
+type changelog struct {
+	// Commits are the new commits as "<hash> <subject>", newest first
+	Commits []string
+	// Files holds the changed files of entries by package, "" for entries
+	// without one
+	Files map[string][]changedFile
+}
+
+// changedFile is a file of an entry a changelog added, modified or removed
+type changedFile struct {
+	Path   string
+	Change string
+}
+
+// newChangelog returns what the commits reachable from to and not from from
+// changed in the files of entries. It is nil without such commits, or when
+// from is not in the history of to, e.g. after a rewrite.
+func newChangelog(repo *git.Repository, b backend, from, to plumbing.Hash) (*changelog, error) {
+	if from == to {
+		return nil, nil
+	}
+	fromCommit, err := repo.CommitObject(from)
+	if err != nil {
+		return nil, nil
+	}
+	toCommit, err := repo.CommitObject(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+	if ok, err := fromCommit.IsAncestor(toCommit); err != nil || !ok {
+		return nil, err
+	}
+
+	// Commits reachable from from are already known here
+	known := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(fromCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		known[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	log := &changelog{Files: make(map[string][]changedFile)}
+	err = object.NewCommitPreorderIter(toCommit, known, nil).ForEach(func(c *object.Commit) error {
+		subject, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+		log.Commits = append(log.Commits, fmt.Sprintf("%s %s", c.Hash.String()[:8], subject))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+	changes, err := fromTree.Diff(toTree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare commits: %w", err)
+	}
+
+	// Files of removed entries are only in the manifest they were removed from
+	manifests := make([]*manifest.Manifest, 0, 2)
+	for _, c := range []*object.Commit{toCommit, fromCommit} {
+		m, err := manifestAtCommit(repo, c.Hash)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare commits: %w", err)
+		}
+		name := change.To.Name
+		kind := "modified"
+		switch action {
+		case merkletrie.Insert:
+			kind = "added"
+		case merkletrie.Delete:
+			name, kind = change.From.Name, "removed"
+		}
+		rel, ok := b.entryPath(name)
+		if !ok {
+			continue
+		}
+		pkg := filePackage(manifests, rel)
+		log.Files[pkg] = append(log.Files[pkg], changedFile{Path: rel, Change: kind})
+	}
+	return log, nil
+}
+
+// filePackage returns the package of the entry holding the file at rel, as
+// the first of manifests tracking it records it
+func filePackage(manifests []*manifest.Manifest, rel string) string {
+	for _, m := range manifests {
+		if entry, ok := m.Find(rel); ok {
+			return entry.Package
+		}
+		if entry, ok := m.FindParent(rel); ok {
+			return entry.Package
+		}
+	}
+	return ""
+}
+
+// String formats the changelog for people, the files grouped by package
+func (c *changelog) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d new commits:\n", len(c.Commits))
+	for _, commit := range c.Commits {
+		fmt.Fprintf(&sb, "  %s\n", commit)
+	}
+
+	packages := make([]string, 0, len(c.Files))
+	for pkg := range c.Files {
+		packages = append(packages, pkg)
+	}
+	// Files of entries without a package come last
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i] == "" || packages[j] == "" {
+			return packages[j] == ""
+		}
+		return packages[i] < packages[j]
+	})
+	for _, pkg := range packages {
+		name := pkg
+		if name == "" {
+			name = "no package"
+		}
+		fmt.Fprintf(&sb, "%s:\n", name)
+		for _, file := range c.Files[pkg] {
+			fmt.Fprintf(&sb, "  %-8s %s\n", file.Change, file.Path)
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestChangelog(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file","package":"zsh"},{"path":".vimrc","type":"file","package":"vim"}]}`)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.vimrc", "set nu")
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+	head := func() plumbing.Hash {
+		ref, err := repo.Head()
+		if err != nil {
+			t.Fatalf("failed to resolve HEAD: %v", err)
+		}
+		return ref.Hash()
+	}
+	from := head()
+
+	b, err := loadBackend(fsys, dotmanDir, dotmanfs.Perm{})
+	if err != nil {
+		t.Fatalf("failed to load backend: %v", err)
+	}
+	if log, err := newChangelog(repo, b, from, from); err != nil || log != nil {
+		t.Fatalf("expected no changelog without new commits, got %+v (%v)", log, err)
+	}
+
+	// Another machine edits .zshrc, adds .zshenv and drops .vimrc
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file","package":"zsh"},{"path":".zshenv","type":"file","package":"zsh"},{"path":".notes","type":"file"}]}`)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshenv", "export EDITOR=vim")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.notes", "todo")
+	if _, err := worktree.Remove("data/.vimrc"); err != nil {
+		t.Fatalf("failed to remove .vimrc: %v", err)
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "changed")
+	if _, err := worktree.Commit("Tweak prompt\n\nAnd more.", &git.CommitOptions{
+		Author:            &object.Signature{Name: "dotman", Email: "dotman@localhost"},
+		AllowEmptyCommits: true,
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	log, err := newChangelog(repo, b, from, head())
+	if err != nil || log == nil {
+		t.Fatalf("expected a changelog, got %+v (%v)", log, err)
+	}
+	if len(log.Commits) != 2 || !strings.HasSuffix(log.Commits[0], " Tweak prompt") {
+		t.Errorf("expected two commits, the newest first, got %v", log.Commits)
+	}
+	expected := map[string][]changedFile{
+		"zsh": {{Path: ".zshenv", Change: "added"}, {Path: ".zshrc", Change: "modified"}},
+		"vim": {{Path: ".vimrc", Change: "removed"}},
+		"":    {{Path: ".notes", Change: "added"}},
+	}
+	for pkg, files := range expected {
+		if len(log.Files[pkg]) != len(files) {
+			t.Errorf("package %q: expected %+v, got %+v", pkg, files, log.Files[pkg])
+			continue
+		}
+		for i, file := range files {
+			if log.Files[pkg][i] != file {
+				t.Errorf("package %q: expected %+v, got %+v", pkg, file, log.Files[pkg][i])
+			}
+		}
+	}
+	if len(log.Files) != len(expected) {
+		t.Errorf("expected only the files of entries, got %+v", log.Files)
+	}
+
+	summary := log.String()
+	if !strings.HasPrefix(summary, "2 new commits:") || strings.Index(summary, "vim:") > strings.Index(summary, "zsh:") || !strings.HasSuffix(summary, "no package:\n  added    .notes") {
+		t.Errorf("unexpected summary:\n%s", summary)
+	}
+
+	// History rewritten since is not summarized
+	if log, err := newChangelog(repo, b, head(), from); err != nil || log != nil {
+		t.Errorf("expected no changelog going back in history, got %+v (%v)", log, err)
+	}
+}
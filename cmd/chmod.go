@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var chmodCmd = &cobra.Command{
+	Use:   "chmod <mode> <path>",
+	Short: "Record the permission a tracked dotfile must have",
+	Long: `Record the permission a tracked dotfile must have in place, whatever mode its
+copy in the repository has, such as 0600 for ~/.ssh/config. The mode is kept
+in the manifest and applied right away when the entry is in place.
+
+link applies recorded modes to every entry it links or finds linked, and
+doctor reports entries whose mode differs. --unset removes the recorded mode
+and leaves the file as it is.`,
+	Example: `  dotman chmod 0600 ~/.ssh/config
+  dotman chmod --unset ~/.ssh/config`,
+	Args: cobra.RangeArgs(1, 2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if unset, _ := cmd.Flags().GetBool("unset"); unset {
+			return completeFirstArg(completeTrackedPaths)(cmd, args, toComplete)
+		}
+		if len(args) == 1 {
+			return completeTrackedPaths(cmd, nil, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unset, _ := cmd.Flags().GetBool("unset")
+
+		var mode string
+		switch {
+		case unset && len(args) == 1:
+		case !unset && len(args) == 2:
+			perm, err := manifest.ParseMode(args[0])
+			if err != nil {
+				return err
+			}
+			mode = manifest.FormatMode(perm)
+			args = args[1:]
+		default:
+			return errors.New("give a mode and a path, or --unset and a path")
+		}
+
+		path, err := entryPath(args[0])
+		if err != nil {
+			return err
+		}
+
+		var entry manifest.Entry
+		err = runManifestOperation(journal.OperationTypeChmod, fmt.Sprintf("Set mode of %s", path), func(m *manifest.Manifest) (string, error) {
+			e, ok := m.Find(path)
+			if !ok {
+				return "", fmt.Errorf("%s is not tracked", path)
+			}
+			e.Mode = mode
+			entry = *e
+			if mode == "" {
+				return fmt.Sprintf("Removed the mode of %s", path), nil
+			}
+			return fmt.Sprintf("Set the mode of %s to %s", path, mode), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if mode == "" {
+			fmt.Printf("Removed the mode of %s\n", path)
+			return nil
+		}
+
+		homeDir, err := fsys.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("error getting user home directory: %w", err)
+		}
+		if _, err := enforceMode(fsys, entry, entry.TargetPath(homeDir)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error applying mode to %s: %w", path, err)
+		}
+		fmt.Printf("Set the mode of %s to %s\n", path, mode)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(chmodCmd)
+
+	chmodCmd.Flags().Bool("unset", false, "remove the recorded mode")
+}
+
+// modeDiffers returns the mode of the entry at homePath when it is not the
+// one recorded for entry, and whether it is not. Links are followed, so a
+// symlinked entry is checked through its copy.
+func modeDiffers(fsys dotmanfs.FileSystem, entry manifest.Entry, homePath string) (os.FileMode, bool, error) {
+	mode, ok := entry.FileMode()
+	if !ok {
+		return 0, false, nil
+	}
+	info, err := fsys.Stat(homePath)
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Mode().Perm(), info.Mode().Perm() != mode, nil
+}
+
+// enforceMode gives the entry at homePath the mode recorded for entry, and
+// reports whether it had another one
+func enforceMode(fsys dotmanfs.FileSystem, entry manifest.Entry, homePath string) (bool, error) {
+	_, differs, err := modeDiffers(fsys, entry, homePath)
+	if err != nil || !differs {
+		return false, err
+	}
+	mode, _ := entry.FileMode()
+	if entry.IsSystem() {
+		return true, systemChmod(fsys, homePath, mode)
+	}
+	return true, fsys.Chmod(homePath, mode)
+}
+
+// enforceModes gives the entries matching filter that are in place the
+// modes recorded for them, and returns how many needed it
+func enforceModes(fsys dotmanfs.FileSystem, cfg *config.Config, filter entryFilter) (int, error) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return 0, fmt.Errorf("error getting user home directory: %w", err)
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, entry := range m.Entries {
+		if !filter.match(m, entry) {
+			continue
+		}
+		ok, err := enforceMode(fsys, entry, entry.TargetPath(homeDir))
+		if err != nil && !os.IsNotExist(err) {
+			return changed, fmt.Errorf("error applying mode to %s: %w", entry.Path, err)
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
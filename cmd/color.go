@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// noColor is set by --no-color
+var noColor bool
+
+// isTerminalOutput reports whether stdout is a terminal, replaced in tests
+var isTerminalOutput = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorOutput reports whether output is colored: only on a terminal, and
+// not with --no-color, NO_COLOR set (https://no-color.org) or TERM=dumb
+func colorOutput() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminalOutput()
+}
+
+// ANSI escape codes of the colors dotman uses
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBold   = "\033[1m"
+)
+
+// paint wraps s in the color code when output is colored. Blank strings
+// stay as they are.
+func paint(color, s string) string {
+	if color == "" || strings.TrimSpace(s) == "" || !colorOutput() {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// stateColor returns the color of a state dotman prints, by what it means:
+// green for done, red for failures and conflicts, yellow for drift and work
+// not finished. Other states are not colored.
+func stateColor(state string) string {
+	switch state {
+	case "completed", "linked", "in place", "clean":
+		return colorGreen
+	case "failed", "broken", "hijacked", "replaced", "error":
+		return colorRed
+	case "current", "pending", "running", "missing", "no data", "dirty", "unpushed", "dirty+unpushed":
+		return colorYellow
+	}
+	return ""
+}
+
+// paintState colors the state padded to width, padding it before adding the
+// escape codes so columns stay aligned
+func paintState(state string, width int) string {
+	return paint(stateColor(state), fmt.Sprintf("%-*s", width, state))
+}
+
+// outputSymbols are the marks dotman decorates output with
+type outputSymbols struct {
+	ok, problem, warning string
+	// dir marks a directory in the status tree
+	dir string
+	// tee, corner and pipe draw the status tree
+	tee, corner, pipe string
+}
+
+var (
+	terminalSymbols = outputSymbols{
+		ok:      "✓ ",
+		problem: "✗ ",
+		warning: "⚠ ",
+		dir:     "📁",
+		tee:     "├── ",
+		corner:  "└── ",
+		pipe:    "│   ",
+	}
+	// asciiSymbols are used when stdout is not a terminal, for pipes, logs
+	// and mail from cron that may not render anything else
+	asciiSymbols = outputSymbols{
+		dir:    "+ ",
+		tee:    "|-- ",
+		corner: "`-- ",
+		pipe:   "|   ",
+	}
+)
+
+// symbols returns the marks for the output, ASCII unless it is a terminal
+func symbols() outputSymbols {
+	if isTerminalOutput() {
+		return terminalSymbols
+	}
+	return asciiSymbols
+}
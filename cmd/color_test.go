@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestColorOutput(t *testing.T) {
+	oldTerminal, oldNoColor := isTerminalOutput, noColor
+	defer func() { isTerminalOutput, noColor = oldTerminal, oldNoColor }()
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm-256color")
+
+	// Not a terminal: no colors, ASCII marks
+	isTerminalOutput = func() bool { return false }
+	if got := paintState("failed", 8); got != "failed  " {
+		t.Errorf("expected plain padded state, got %q", got)
+	}
+	if symbols() != asciiSymbols {
+		t.Error("expected ASCII symbols when not on a terminal")
+	}
+
+	// A terminal: states colored by meaning, padding kept out of the codes
+	isTerminalOutput = func() bool { return true }
+	if got := paintState("completed", 10); got != colorGreen+"completed "+colorReset {
+		t.Errorf("unexpected completed state %q", got)
+	}
+	if got := paintState("failed", 0); got != colorRed+"failed"+colorReset {
+		t.Errorf("unexpected failed state %q", got)
+	}
+	if got := paintState("missing", 0); got != colorYellow+"missing"+colorReset {
+		t.Errorf("unexpected missing state %q", got)
+	}
+	if got := paintState("other host", 0); got != "other host" {
+		t.Errorf("expected states without meaning to stay plain, got %q", got)
+	}
+	if got := paintStatusCode("M "); got != colorGreen+"M"+colorReset+" " {
+		t.Errorf("unexpected staged status code %q", got)
+	}
+	if got := paintStatusCode(" M"); got != " "+colorRed+"M"+colorReset {
+		t.Errorf("unexpected unstaged status code %q", got)
+	}
+	if symbols() != terminalSymbols {
+		t.Error("expected terminal symbols on a terminal")
+	}
+
+	// --no-color, NO_COLOR and TERM=dumb turn colors off, not the symbols
+	noColor = true
+	if colorOutput() {
+		t.Error("expected --no-color to turn colors off")
+	}
+	noColor = false
+	t.Setenv("NO_COLOR", "1")
+	if colorOutput() {
+		t.Error("expected NO_COLOR to turn colors off")
+	}
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "dumb")
+	if colorOutput() {
+		t.Error("expected TERM=dumb to turn colors off")
+	}
+	if symbols() != terminalSymbols {
+		t.Error("expected terminal symbols without colors")
+	}
+}
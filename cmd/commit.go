@@ -1,19 +1,23 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
-	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage"
-	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/noosxe/dotman/internal/config"
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
 	"github.com/spf13/cobra"
 )
 
@@ -25,7 +29,22 @@ type commitOperation struct {
 
 	// additional fields required for commit operation
 	message string
+	// "Name <email>" to commit as instead of the configured identity
+	author string
+	// dotfiles to commit the changes of, all changes when empty
+	paths []string
+	// print the staged changes before committing them
+	showDiff bool
+	// ask for each staged change whether to commit it
+	interactive bool
+	// replace the last commit instead of adding one
+	amend   bool
 	storage storage.Storer
+	// how the repository holds the entries, by its manifest
+	backend backend
+
+	// paths below the dotman directory to commit, resolved from paths
+	repoPaths []string
 }
 
 // commitCmd represents the commit command
@@ -33,10 +52,23 @@ var commitCmd = &cobra.Command{
 	Use:   "commit",
 	Short: "Commit changes to the journal",
 	Long: `Commit changes to the journal with a descriptive message.
-This command will record the current state of tracked files in the journal.`,
+This command will record the current state of tracked files in the journal.
+
+Use --path to commit only the changes of some dotfiles, given by their
+location in the home directory, e.g. --path ~/.config/nvim. Other changes are
+left for a later commit, staged ones stay staged.
+
+Use --show-diff to print the changes being committed, or --interactive to be
+asked for each changed file whether to commit it. Files left out stay changed
+in the dotman directory for a later commit.
+
+Use --amend to fix the last commit: its message is replaced by --message when
+given and the current changes are added to it. A commit that is already on
+the remote is not amended, as that would rewrite history others may have.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		message, _ := cmd.Flags().GetString("message")
-		if message == "" {
+		amend, _ := cmd.Flags().GetBool("amend")
+		if message == "" && !amend {
 			return fmt.Errorf("commit message is required")
 		}
 
@@ -45,24 +77,55 @@ This command will record the current state of tracked files in the journal.`,
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		// Create billy filesystem adapter
-		billyFs := dotmanfs.NewBillyFileSystem(fsys, cfg.DotmanDir)
+		author, _ := cmd.Flags().GetString("author")
+		paths, _ := cmd.Flags().GetStringArray("path")
+		for i, path := range paths {
+			paths[i] = aliasPath(path)
+		}
+		showDiff, _ := cmd.Flags().GetBool("show-diff")
+		interactive, _ := cmd.Flags().GetBool("interactive")
 
 		op := &commitOperation{
-			message: message,
+			message:     message,
+			author:      author,
+			paths:       paths,
+			showDiff:    showDiff,
+			interactive: interactive,
+			amend:       amend,
+			fsys:        fsys,
+			ctx:         context.Background(),
+			config:      cfg,
+			storage:     newGitStorage(fsys, cfg.DotmanDir),
+		}
+
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		if !cfg.AutoPush {
+			return nil
+		}
+
+		push := &pushOperation{
 			fsys:    fsys,
 			ctx:     context.Background(),
 			config:  cfg,
-			storage: filesystem.NewStorage(billyFs, nil),
+			storage: op.storage,
 		}
 
-		return op.run()
+		return push.run()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(commitCmd)
 	commitCmd.Flags().StringP("message", "m", "", "commit message")
+	commitCmd.Flags().StringArray("path", nil, "commit only the changes of this tracked dotfile or directory, can be repeated")
+	commitCmd.RegisterFlagCompletionFunc("path", completeTrackedPaths)
+	commitCmd.Flags().String("author", "", "commit as \"Name <email>\" instead of the configured identity")
+	commitCmd.Flags().Bool("show-diff", false, "print the changes being committed")
+	commitCmd.Flags().BoolP("interactive", "i", false, "ask for each changed file whether to commit it")
+	commitCmd.Flags().Bool("amend", false, "replace the last commit, when it is not pushed yet")
 }
 
 func (op *commitOperation) run() error {
@@ -74,12 +137,20 @@ func (op *commitOperation) run() error {
 		return err
 	}
 
-	return op.complete()
+	if err := op.complete(); err != nil {
+		return err
+	}
+	recordCommit(op.fsys, op.config)
+	return nil
 }
 
 func (op *commitOperation) initialize() error {
+	if err := op.resolvePaths(); err != nil {
+		return err
+	}
+
 	// Create journal manager
-	jm := journal.NewJournalManager(op.fsys, filepath.Join(op.config.DotmanDir, "journal"))
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
 	if err := jm.Initialize(); err != nil {
 		return fmt.Errorf("failed to initialize journal: %w", err)
 	}
@@ -88,7 +159,7 @@ func (op *commitOperation) initialize() error {
 	op.ctx = journal.WithJournalManager(op.ctx, jm)
 
 	// Create journal entry
-	entry, err := jm.CreateEntry(journal.OperationTypeCommit, "", "")
+	entry, err := jm.CreateEntry(journal.OperationTypeCommit, strings.Join(op.repoPaths, ", "), "")
 	if err != nil {
 		return fmt.Errorf("failed to create journal entry: %w", err)
 	}
@@ -100,8 +171,13 @@ func (op *commitOperation) initialize() error {
 }
 
 func (op *commitOperation) commit() error {
+	description := op.message
+	if op.amend && description == "" {
+		description = "Amend last commit"
+	}
+
 	// Add commit step
-	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, op.message, "", "")
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, description, "", "")
 	if err != nil {
 		return fmt.Errorf("failed to add commit step: %w", err)
 	}
@@ -111,11 +187,8 @@ func (op *commitOperation) commit() error {
 		return fmt.Errorf("failed to start step: %w", err)
 	}
 
-	// Create billy filesystem adapter
-	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir)
-
-	// Open git repository with our filesystem
-	repo, err := git.Open(op.storage, billyFs)
+	// Open git repository on the worktree of the backend
+	repo, err := git.Open(op.storage, op.backend.worktree())
 	if err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to open git repository: %w", err)); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
@@ -123,6 +196,22 @@ func (op *commitOperation) commit() error {
 		return fmt.Errorf("failed to open git repository: %w", err)
 	}
 
+	// Undoing the commit resets HEAD to where it was
+	if err := journal.RecordRollback(op.ctx, step, headRollback(repo)); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	// Only a commit the remote does not have yet can be amended
+	var amended *object.Commit
+	if op.amend {
+		if amended, err = amendableCommit(repo); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return err
+		}
+	}
+
 	// Get worktree
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -132,31 +221,56 @@ func (op *commitOperation) commit() error {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	// Add all changes
-	if err := worktree.AddGlob("."); err != nil {
+	// Add all changes, or only those of the given paths
+	restoreIndex := func() error { return nil }
+	if len(op.repoPaths) > 0 {
+		restoreIndex, err = stageOnly(repo, worktree, op.repoPaths)
+	} else {
+		err = worktree.AddGlob(".")
+	}
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to add changes: %w", err)); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
 		}
 		return fmt.Errorf("failed to add changes: %w", err)
 	}
 
-	// Get author info from git config
-	gitCfg, err := repo.ConfigScoped(gitconfig.GlobalScope)
+	// Show the staged changes, leaving out those the user declines
+	if err := op.review(repo); err != nil {
+		if restoreErr := restoreIndex(); restoreErr != nil {
+			err = fmt.Errorf("%w (and failed to restore the index: %v)", err, restoreErr)
+		}
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	// Get the author to commit as
+	signature, err := gitIdentity(op.fsys, op.config, repo, op.author)
 	if err != nil {
-		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to get git config: %w", err)); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
 		}
-		return fmt.Errorf("failed to get git config: %w", err)
+		return err
 	}
 
-	// Commit changes
-	commit, err := worktree.Commit(op.message, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  gitCfg.User.Name,
-			Email: gitCfg.User.Email,
-			When:  time.Now(),
-		},
-	})
+	// Commit changes, keeping the message and author of an amended commit
+	message, options := op.message, &git.CommitOptions{Author: signature}
+	if amended != nil {
+		if message == "" {
+			message = amended.Message
+		}
+		if op.author == "" {
+			options.Author = &amended.Author
+		}
+		options.Committer = signature
+		options.Amend = true
+	}
+	commit, err := worktree.Commit(message, options)
+	if restoreErr := restoreIndex(); err == nil && restoreErr != nil {
+		err = restoreErr
+	}
 	if err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to commit changes: %w", err)); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
@@ -173,18 +287,190 @@ func (op *commitOperation) commit() error {
 		return fmt.Errorf("failed to get commit object: %w", err)
 	}
 
+	verb := "Committed changes"
+	if amended != nil {
+		verb = fmt.Sprintf("Amended %s", amended.Hash.String()[:7])
+	}
+
 	// Complete the step with commit hash
-	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Committed changes with hash: %s", commitObj.Hash.String())); err != nil {
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("%s with hash: %s", verb, commitObj.Hash.String())); err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to complete step: %w", err)); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
 		}
 		return fmt.Errorf("failed to complete step: %w", err)
 	}
 
+	if amended != nil {
+		fmt.Printf("Last commit amended, new hash: %s\n", commitObj.Hash.String())
+		return nil
+	}
 	fmt.Printf("Changes committed successfully with hash: %s\n", commitObj.Hash.String())
 	return nil
 }
 
+// amendableCommit returns the commit HEAD points at when it can be amended:
+// it exists and the remote-tracking branch of origin does not contain it
+func amendableCommit(repo *git.Repository) (*object.Commit, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("there is no commit to amend")
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+
+	name := plumbing.NewRemoteReferenceName("origin", head.Name().Short())
+	ref, err := repo.Reference(name, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return commit, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", name.Short(), err)
+	}
+	remote, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+	pushed, err := commit.IsAncestor(remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare with %s: %w", name.Short(), err)
+	}
+	if pushed {
+		return nil, fmt.Errorf("the last commit is already pushed to %s, amending it would rewrite published history", name.Short())
+	}
+	return commit, nil
+}
+
+// review prints the staged changes with --show-diff and, with --interactive,
+// asks for each one whether to commit it, unstaging those declined
+func (op *commitOperation) review(repo *git.Repository) error {
+	if !op.showDiff && !op.interactive {
+		return nil
+	}
+	if op.interactive && !isInteractive() {
+		return fmt.Errorf("--interactive needs a terminal to ask on")
+	}
+
+	changes, err := stagedChanges(repo)
+	if err != nil {
+		return fmt.Errorf("failed to diff staged changes: %w", err)
+	}
+	if !op.interactive {
+		if err := writeDiff(os.Stdout, changes...); err != nil {
+			return fmt.Errorf("failed to print staged changes: %w", err)
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(promptInput)
+	committed := 0
+	for _, change := range changes {
+		if err := writeDiff(terminalOutput(), change); err != nil {
+			return fmt.Errorf("failed to print staged changes: %w", err)
+		}
+
+		answer, err := askCommitChange(reader, change.path())
+		if err != nil {
+			return err
+		}
+		switch answer {
+		case "y":
+			committed++
+		case "n":
+			if err := unstage(repo, change); err != nil {
+				return fmt.Errorf("failed to leave out %s: %w", change.path(), err)
+			}
+		case "q":
+			return fmt.Errorf("commit aborted")
+		}
+	}
+
+	if committed == 0 {
+		return fmt.Errorf("no changes selected to commit")
+	}
+	return nil
+}
+
+// askCommitChange asks whether to commit the change to path until it gets
+// y, n or q
+func askCommitChange(reader *bufio.Reader, path string) (string, error) {
+	for {
+		fmt.Fprintf(terminalOutput(), "Commit the change to %s? [y/n/q] ", path)
+		line, err := reader.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch answer {
+		case "y", "yes":
+			return "y", nil
+		case "n", "no":
+			return "n", nil
+		case "q", "quit":
+			return "q", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("commit aborted")
+		}
+	}
+}
+
+// resolvePaths translates the dotfiles given with --path to the paths git
+// stages them as
+func (op *commitOperation) resolvePaths() error {
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	if op.backend, err = newBackend(op.fsys, op.config.DotmanDir, m, op.config.Perm()); err != nil {
+		return err
+	}
+
+	for _, path := range op.paths {
+		repoPath, err := commitPath(op.fsys, m, op.backend, path)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(op.repoPaths, repoPath) {
+			op.repoPaths = append(op.repoPaths, repoPath)
+		}
+	}
+	return nil
+}
+
+// commitPath returns the path git stages, by backend b, of path: a tracked
+// dotfile, a file inside a tracked directory or a directory holding tracked
+// dotfiles
+func commitPath(fsys dotmanfs.FileSystem, m *manifest.Manifest, b backend, path string) (string, error) {
+	absPath, err := dotmanfs.AbsHome(fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %w", err)
+	}
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	// System files are tracked by their absolute path
+	rel := filepath.Clean(absPath)
+	if isWithin(homeDir, absPath) {
+		if rel, err = fsys.Rel(homeDir, absPath); err != nil {
+			return "", fmt.Errorf("error getting relative path: %w", err)
+		}
+	}
+
+	tracked := false
+	for _, entry := range m.Entries {
+		if isWithin(entry.Path, rel) || isWithin(rel, entry.Path) {
+			tracked = true
+			break
+		}
+	}
+	if !tracked {
+		return "", fmt.Errorf("%s is not tracked by dotman", path)
+	}
+
+	return b.gitPath(manifest.Entry{Path: rel}), nil
+}
+
 func (op *commitOperation) complete() error {
 	return journal.CompleteEntry(op.ctx)
 }
@@ -1,15 +1,22 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
 	"github.com/noosxe/dotman/internal/testutil"
 )
 
 func TestCommitOperation(t *testing.T) {
 	// Create mock filesystem with dotman structure
-	fsys, dotmanDir, err := testutil.NewMockFSWithDotman()
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
 	if err != nil {
 		t.Fatalf("failed to create mock filesystem: %v", err)
 	}
@@ -24,6 +31,12 @@ func TestCommitOperation(t *testing.T) {
 	// Create initial commit with sample file
 	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/sample.txt", "sample content")
 
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	initial := head.Hash()
+
 	// Create a test file and add it to git (without committing)
 	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/test.txt", "test content")
 
@@ -64,4 +77,283 @@ func TestCommitOperation(t *testing.T) {
 
 	step := lastEntry.Steps[0]
 	testutil.VerifyStep(t, step, journal.StepTypeGit, journal.StepStatusCompleted, "test commit")
+
+	// Undoing the commit resets HEAD to the initial commit
+	if step.Rollback == nil || step.Rollback.GitRef != initial.String() {
+		t.Errorf("expected rollback to the initial commit %s, got %+v", initial, step.Rollback)
+	}
+}
+
+func TestCommitOperation_Paths(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".bashrc", Type: manifest.EntryTypeFile, AddedAt: time.Now()})
+	m.Add(manifest.Entry{Path: ".config/nvim", Type: manifest.EntryTypeDirectory, AddedAt: time.Now()})
+	if err := manifest.Save(fsys, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+	if _, err := worktree.Add(".manfile"); err != nil {
+		t.Fatalf("failed to add manifest: %v", err)
+	}
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.bashrc", "alias ll='ls -l'")
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.config/nvim/init.lua", "set number")
+
+	// Drift in both dotfiles, and an unrelated staged change
+	if err := fsys.WriteFile(dotmanDir+"/data/.config/nvim/init.lua", []byte("set relativenumber"), 0644); err != nil {
+		t.Fatalf("failed to write init.lua: %v", err)
+	}
+	if err := fsys.WriteFile(dotmanDir+"/data/.bashrc", []byte("alias la='ls -a'"), 0644); err != nil {
+		t.Fatalf("failed to write .bashrc: %v", err)
+	}
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshrc", "export EDITOR=nvim")
+
+	newOp := func(paths ...string) *commitOperation {
+		return &commitOperation{
+			message: "nvim tweaks",
+			fsys:    fsys,
+			ctx:     context.Background(),
+			config:  cfg,
+			paths:   paths,
+			storage: storage,
+		}
+	}
+
+	if err := newOp(testutil.TestHomeDir + "/.profile").run(); err == nil {
+		t.Fatal("expected committing an untracked path to fail")
+	}
+
+	if err := newOp(testutil.TestHomeDir + "/.config/nvim/").run(); err != nil {
+		t.Fatalf("failed to execute commit: %v", err)
+	}
+	testutil.VerifyLastCommit(t, repo, "nvim tweaks")
+
+	// Only the nvim change is committed
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	for path, want := range map[string]string{
+		"data/.config/nvim/init.lua": "set relativenumber",
+		"data/.bashrc":               "alias ll='ls -l'",
+	} {
+		file, err := commit.File(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if got, _ := file.Contents(); got != want {
+			t.Errorf("expected %s to be committed as %q, got %q", path, want, got)
+		}
+	}
+	if _, err := commit.File("data/.zshrc"); err == nil {
+		t.Error("expected the unrelated staged file to be left out")
+	}
+
+	// The unrelated changes are left as they were
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if s := status.File("data/.zshrc"); s.Staging != git.Added {
+		t.Errorf("expected data/.zshrc to stay staged, got %q", s.Staging)
+	}
+	if s := status.File("data/.bashrc"); s.Worktree != git.Modified || s.Staging != git.Unmodified {
+		t.Errorf("expected data/.bashrc to stay modified, got %q%q", s.Staging, s.Worktree)
+	}
+	if s, ok := status["data/.config/nvim/init.lua"]; ok && (s.Worktree != git.Unmodified || s.Staging != git.Unmodified) {
+		t.Errorf("expected init.lua to be clean, got %q%q", s.Staging, s.Worktree)
+	}
+}
+
+func TestCommitOperation_Interactive(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	oldInput, oldInteractive := promptInput, isInteractive
+	defer func() { promptInput, isInteractive = oldInput, oldInteractive }()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".gitignore", "journal/\n")
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.bashrc", "alias ll='ls -l'\n")
+	if err := fsys.WriteFile(dotmanDir+"/data/.bashrc", []byte("alias la='ls -a'\n"), 0644); err != nil {
+		t.Fatalf("failed to write .bashrc: %v", err)
+	}
+	if err := fsys.WriteFile(dotmanDir+"/data/.zshrc", []byte("export EDITOR=nvim\n"), 0644); err != nil {
+		t.Fatalf("failed to write .zshrc: %v", err)
+	}
+
+	newOp := func() *commitOperation {
+		return &commitOperation{
+			message:     "zsh setup",
+			interactive: true,
+			fsys:        fsys,
+			ctx:         context.Background(),
+			config:      cfg,
+			storage:     storage,
+		}
+	}
+
+	isInteractive = func() bool { return false }
+	if err := newOp().run(); err == nil {
+		t.Fatal("expected --interactive without a terminal to fail")
+	}
+
+	// The staged changes are diffed against HEAD
+	isInteractive = func() bool { return true }
+	if err := worktree.AddGlob("."); err != nil {
+		t.Fatalf("failed to stage changes: %v", err)
+	}
+	changes, err := stagedChanges(repo)
+	if err != nil {
+		t.Fatalf("failed to diff staged changes: %v", err)
+	}
+	var out bytes.Buffer
+	if err := writeDiff(&out, changes...); err != nil {
+		t.Fatalf("failed to write diff: %v", err)
+	}
+	for _, want := range []string{"-alias ll='ls -l'", "+alias la='ls -a'", "new file mode", "+export EDITOR=nvim"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the diff, got:\n%s", want, out.String())
+		}
+	}
+
+	// Quitting commits nothing
+	promptInput = strings.NewReader("q\n")
+	if err := newOp().run(); err == nil {
+		t.Fatal("expected quitting to abort the commit")
+	}
+	testutil.VerifyLastCommit(t, repo, "test commit")
+
+	// Declining .bashrc leaves it out of the commit but changed on disk
+	promptInput = strings.NewReader("maybe\nn\ny\n")
+	if err := newOp().run(); err != nil {
+		t.Fatalf("failed to execute commit: %v", err)
+	}
+	testutil.VerifyLastCommit(t, repo, "zsh setup")
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	if _, err := commit.File("data/.zshrc"); err != nil {
+		t.Errorf("expected data/.zshrc to be committed: %v", err)
+	}
+	file, err := commit.File("data/.bashrc")
+	if err != nil {
+		t.Fatalf("failed to read data/.bashrc: %v", err)
+	}
+	if got, _ := file.Contents(); got != "alias ll='ls -l'\n" {
+		t.Errorf("expected data/.bashrc to be left out, got %q", got)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if s := status.File("data/.bashrc"); s.Worktree != git.Modified || s.Staging != git.Unmodified {
+		t.Errorf("expected data/.bashrc to stay modified, got %q%q", s.Staging, s.Worktree)
+	}
+}
+
+func TestCommitOperation_Amend(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.bashrc", "alias ll='ls -l'")
+
+	newOp := func(message string) *commitOperation {
+		return &commitOperation{
+			message: message,
+			amend:   true,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			config:  cfg,
+			storage: storage,
+		}
+	}
+
+	// Fixing a typo in the message keeps the parent and the author
+	before, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	original, err := repo.CommitObject(before.Hash())
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	if err := newOp("Add bashrc").run(); err != nil {
+		t.Fatalf("failed to amend: %v", err)
+	}
+	testutil.VerifyLastCommit(t, repo, "Add bashrc")
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	amended, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	if amended.Hash == original.Hash || len(amended.ParentHashes) != len(original.ParentHashes) {
+		t.Errorf("expected the commit to be replaced, got %s with parents %v", amended.Hash, amended.ParentHashes)
+	}
+	if amended.Author.Name != original.Author.Name || !amended.Author.When.Equal(original.Author.When) {
+		t.Errorf("expected the original author to be kept, got %s at %s", amended.Author.Name, amended.Author.When)
+	}
+
+	// Without a message, the changes are added under the same message
+	if err := fsys.WriteFile(dotmanDir+"/data/.bashrc", []byte("alias la='ls -a'"), 0644); err != nil {
+		t.Fatalf("failed to write .bashrc: %v", err)
+	}
+	if err := newOp("").run(); err != nil {
+		t.Fatalf("failed to amend: %v", err)
+	}
+	testutil.VerifyLastCommit(t, repo, "Add bashrc")
+	head, err = repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	amended, err = repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to get commit: %v", err)
+	}
+	file, err := amended.File("data/.bashrc")
+	if err != nil {
+		t.Fatalf("failed to read data/.bashrc: %v", err)
+	}
+	if got, _ := file.Contents(); got != "alias la='ls -a'" {
+		t.Errorf("expected the change to be amended in, got %q", got)
+	}
+
+	// Once the remote has the commit it is left alone
+	pushed := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), head.Hash())
+	if err := repo.Storer.SetReference(pushed); err != nil {
+		t.Fatalf("failed to set remote-tracking branch: %v", err)
+	}
+	if err := newOp("Add bash config").run(); err == nil || !strings.Contains(err.Error(), "already pushed") {
+		t.Fatalf("expected amending a pushed commit to fail, got %v", err)
+	}
+	testutil.VerifyLastCommit(t, repo, "Add bashrc")
 }
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/scan"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for the given shell. Completions include tracked
+paths and journal entry IDs, which are looked up when completing.
+
+To load completions:
+
+Bash:
+  $ source <(dotman completion bash)
+
+Zsh:
+  $ dotman completion zsh > "${fpath[1]}/_dotman"
+
+Fish:
+  $ dotman completion fish > ~/.config/fish/completions/dotman.fish
+
+PowerShell:
+  PS> dotman completion powershell | Out-String | Invoke-Expression`,
+	Args:                  cobra.ExactArgs(1),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(out, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(out)
+		case "fish":
+			return rootCmd.GenFishCompletion(out, true)
+		case "powershell":
+			return rootCmd.GenPowerShellCompletionWithDesc(out)
+		default:
+			return fmt.Errorf("unsupported shell '%s'. Supported shells are: bash, zsh, fish, powershell", args[0])
+		}
+	},
+}
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
+}
+
+// completionConfig reads the config for completion functions, which must not
+// create files or print anything
+func completionConfig() (*config.Config, bool) {
+	cfg, err := config.ReadConfig(configPath, fsys)
+	if err != nil {
+		return nil, false
+	}
+	if err := applyProfileFlag(); err != nil {
+		return nil, false
+	}
+	if err := config.Resolve(cfg); err != nil {
+		return nil, false
+	}
+	return cfg, true
+}
+
+// asTyped returns path in the form the user is typing it: below ~ when what
+// is typed so far starts with ~, as in ~/.con, absolute otherwise
+func asTyped(toComplete, path string) string {
+	if strings.HasPrefix(toComplete, "~") {
+		return dotmanfs.ContractHome(fsys, path)
+	}
+	return path
+}
+
+// completeTrackedPaths completes the home paths and aliases of tracked
+// entries
+func completeTrackedPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	var paths []string
+	for _, entry := range m.Entries {
+		path := asTyped(toComplete, entry.TargetPath(homeDir))
+		if strings.HasPrefix(path, toComplete) {
+			paths = append(paths, path)
+		}
+		if entry.Alias != "" && strings.HasPrefix(entry.Alias, toComplete) {
+			paths = append(paths, entry.Alias)
+		}
+	}
+
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeUntrackedPaths completes well-known dotfiles that are not tracked
+// yet, falling back to regular file completion
+func completeUntrackedPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	candidates, err := scan.Scan(fsys, homeDir, m)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	var paths []string
+	for _, c := range candidates {
+		path := asTyped(toComplete, filepath.Join(homeDir, c.Path))
+		if strings.HasPrefix(path, toComplete) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, cobra.ShellCompDirectiveDefault
+}
+
+// completeJournalIDs completes journal entry IDs, newest first, described by
+// their operation and state
+func completeJournalIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	records, err := jm.Index()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// Newest first
+	var ids []string
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if strings.HasPrefix(record.ID, toComplete) {
+			ids = append(ids, fmt.Sprintf("%s\t%s (%s)", record.ID, record.Operation, record.State))
+		}
+	}
+
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstArg applies complete to the first positional argument only
+func completeFirstArg(complete cobra.CompletionFunc) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
+
+// completePackages completes the package names used in the manifest
+func completePackages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return m.PackageNames(), cobra.ShellCompDirectiveNoFileComp
+}
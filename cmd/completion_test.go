@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+	"github.com/spf13/cobra"
+)
+
+func TestCompletions(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	// Point the command globals at the mock filesystem
+	oldFsys, oldConfigPath := fsys, configPath
+	fsys, configPath = mockFS, filepath.Join(testutil.TestHomeDir, ".dotconfig")
+	defer func() { fsys, configPath = oldFsys, oldConfigPath }()
+
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".zshrc", Type: manifest.EntryTypeFile, AddedAt: time.Now()})
+	m.Add(manifest.Entry{Path: ".config/nvim", Type: manifest.EntryTypeDirectory, AddedAt: time.Now()})
+	if err := manifest.Save(mockFS, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+
+	jm := testutil.SetupJournalManager(t, mockFS, dotmanDir)
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, "", "")
+	if err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+
+	paths, directive := completeTrackedPaths(mvCmd, nil, filepath.Join(testutil.TestHomeDir, ".z"))
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Fatalf("expected no file completion directive, got %v", directive)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(testutil.TestHomeDir, ".zshrc") {
+		t.Fatalf("expected only .zshrc to be completed, got %v", paths)
+	}
+
+	// Paths typed below ~ complete in the same form
+	for _, typed := range []string{"~/.z", "~"} {
+		paths, _ := completeTrackedPaths(mvCmd, nil, typed)
+		if !slices.Contains(paths, "~/.zshrc") {
+			t.Errorf("expected ~/.zshrc to be completed for %q, got %v", typed, paths)
+		}
+	}
+	if paths, _ := completeTrackedPaths(mvCmd, nil, "~/.config/n"); len(paths) != 1 || paths[0] != "~/.config/nvim" {
+		t.Errorf("expected ~/.config/nvim to be completed, got %v", paths)
+	}
+
+	// commit --path completes tracked paths too
+	complete, ok := commitCmd.GetFlagCompletionFunc("path")
+	if !ok {
+		t.Fatal("expected commit --path to have a completion")
+	}
+	if paths, _ := complete(commitCmd, nil, filepath.Join(testutil.TestHomeDir, ".z")); len(paths) != 1 {
+		t.Fatalf("expected .zshrc to be completed for commit --path, got %v", paths)
+	}
+
+	ids, _ := completeJournalIDs(journalCmd, nil, "")
+	if len(ids) != 1 || !strings.HasPrefix(ids[0], entry.ID+"\t") {
+		t.Fatalf("expected journal entry %s to be completed, got %v", entry.ID, ids)
+	}
+
+	if ids, _ := completeJournalIDs(journalCmd, []string{entry.ID}, ""); len(ids) != 0 {
+		t.Fatalf("expected no completions after the ID argument, got %v", ids)
+	}
+}
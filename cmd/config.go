@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and change the dotman configuration",
+	Long:  `Read and change individual configuration keys, list the effective configuration or edit the config file.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:               "get <key>",
+	Short:             "Print the effective value of a configuration key",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigKeys,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		value, err := cfg.Effective(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:               "set <key> <value>",
+	Short:             "Validate and store a configuration key",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeConfigKeys,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.Set(args[0], args[1]); err != nil {
+			return err
+		}
+
+		if err := config.SaveConfig(configPath, cfg, fsys); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+
+		value, _ := cfg.Effective(args[0])
+		fmt.Printf("%s = %s\n", args[0], value)
+
+		key, _ := config.FindKey(args[0])
+		if _, ok := os.LookupEnv(key.Env); ok {
+			fmt.Printf("Note: %s is set and overrides this value\n", key.Env)
+		}
+
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the effective configuration",
+	Long: `Print every configuration key with its effective value and where the value
+comes from: the config file, an environment variable or the built-in default.
+Keys left unset show the default that applies.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		fileKeys, err := config.FileKeys(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+
+		for _, name := range config.KeyNames() {
+			key, _ := config.FindKey(name)
+			value, _ := cfg.Effective(name)
+
+			source := "default"
+			if _, ok := os.LookupEnv(key.Env); ok {
+				source = "env " + key.Env
+			} else if fileKeys[name] {
+				source = "file"
+			}
+
+			fmt.Printf("%s = %s (%s)\n", name, value, source)
+		}
+
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the config file in $EDITOR",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Make sure the file exists before opening it
+		if _, err := config.LoadConfig(configPath, fsys); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		editCmd := exec.Command("sh", "-c", editorCommand()+` "$1"`, "sh", configPath)
+		editCmd.Stdin = os.Stdin
+		editCmd.Stdout = terminalOutput()
+		editCmd.Stderr = terminalOutput()
+		if err := editCmd.Run(); err != nil {
+			return fmt.Errorf("failed to run editor: %w", err)
+		}
+
+		if _, err := config.ReadConfig(configPath, fsys); err != nil {
+			return fmt.Errorf("config is invalid after editing: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configEditCmd)
+}
+
+// readConfigFile reads the config file as stored, without environment
+// overrides or the active profile applied, so that it can be changed and
+// saved back. A default config is returned if the file does not exist.
+func readConfigFile() (*config.Config, error) {
+	cfg, err := config.ReadConfig(configPath, fsys)
+	if err != nil {
+		if _, statErr := fsys.Stat(configPath); !os.IsNotExist(statErr) {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		return config.DefaultConfig(fsys), nil
+	}
+	return cfg, nil
+}
+
+// completeConfigKeys completes configuration key names for the first argument
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, name := range config.KeyNames() {
+		key, _ := config.FindKey(name)
+		names = append(names, name+"\t"+key.Description)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
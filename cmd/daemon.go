@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocket     string
+	daemonGCInterval time.Duration
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Serve dotman operations over a local API socket",
+	Long: `Serve dotman operations as a JSON API over a unix socket, so editors and
+provisioning tools can drive dotman without running it and parsing its output.
+
+  GET  /v1/status         the document of 'dotman status --json'
+  GET  /v1/entries        tracked files with their package and link state
+  GET  /v1/journal        journal entries, newest first, ?limit=N
+  GET  /v1/journal/{id}   a single journal entry
+  POST /v1/add            add a path, e.g. {"path": "/home/me/.zshrc"}
+  POST /v1/link           create missing symlinks, {"packages": [...]} optional
+
+An add request takes the options of 'dotman add' as fields: package, follow,
+no_follow, force_large, line_endings, copy_nested, secret and repo. Failed
+requests answer with {"error": "..."}. Operations run one at a time.
+
+Every --gc-interval, 24h by default, the daemon runs 'dotman gc --auto'
+between requests, packing the git objects once there are many loose ones and
+archiving old journal entries and backups. Use --gc-interval 0 to turn it off.
+
+Set notify to failures or always to get a desktop notification when an
+operation run by the daemon fails, or also when it completes.
+
+The socket is only accessible to the current user. It is created at
+$XDG_RUNTIME_DIR/dotman.sock, or ~/.dotman.sock without XDG_RUNTIME_DIR, unless
+--socket says otherwise. Try it with:
+
+  curl --unix-socket ~/.dotman.sock http://dotman/v1/status`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		socket := daemonSocket
+		if socket == "" {
+			var err error
+			if socket, err = defaultDaemonSocket(); err != nil {
+				return err
+			}
+		}
+
+		// Nobody watches the operations the daemon runs
+		background = true
+
+		listener, err := listenSocket(socket)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(socket)
+
+		loadConfig := func() (*config.Config, error) {
+			return config.LoadConfig(configPath, fsys)
+		}
+		var mu sync.Mutex
+		server := &http.Server{
+			Handler:           newDaemonHandler(fsys, loadConfig, &mu),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if daemonGCInterval > 0 {
+			go autoGC(ctx, fsys, daemonGCInterval, &mu, loadConfig)
+		}
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		fmt.Printf("Listening on %s\n", socket)
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().StringVar(&daemonSocket, "socket", "", "path of the unix socket to listen on")
+	daemonCmd.Flags().DurationVar(&daemonGCInterval, "gc-interval", 24*time.Hour, "how often to run 'dotman gc --auto', 0 to never")
+}
+
+// defaultDaemonSocket returns where the daemon listens without --socket
+func defaultDaemonSocket() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "dotman.sock"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(home, ".dotman.sock"), nil
+}
+
+// listenSocket listens on the unix socket at path, readable and writable by
+// the current user only. A socket left behind by a daemon that did not shut
+// down cleanly is replaced, one that still answers is not.
+func listenSocket(path string) (net.Listener, error) {
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	// Nobody else may connect between creating the socket and restricting it
+	restore := privateUmask()
+	listener, err := net.Listen("unix", path)
+	restore()
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error restricting %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// daemonAddRequest is the body of POST /v1/add
+type daemonAddRequest struct {
+	Path        string `json:"path"`
+	Package     string `json:"package,omitempty"`
+	Follow      bool   `json:"follow,omitempty"`
+	NoFollow    bool   `json:"no_follow,omitempty"`
+	ForceLarge  bool   `json:"force_large,omitempty"`
+	LineEndings string `json:"line_endings,omitempty"`
+	CopyNested  bool   `json:"copy_nested,omitempty"`
+	Secret      bool   `json:"secret,omitempty"`
+	Repo        string `json:"repo,omitempty"`
+}
+
+// daemonAddResult is the answer to POST /v1/add
+type daemonAddResult struct {
+	// Entry is the path of the entry in the manifest
+	Entry          string `json:"entry"`
+	AlreadyTracked bool   `json:"already_tracked"`
+}
+
+// daemonLinkRequest is the body of POST /v1/link
+type daemonLinkRequest struct {
+	Packages []string `json:"packages,omitempty"`
+}
+
+// daemonLinkResult is the answer to POST /v1/link
+type daemonLinkResult struct {
+	Linked  int `json:"linked"`
+	Cloned  int `json:"cloned"`
+	Fetched int `json:"fetched"`
+}
+
+// errBadRequest marks errors caused by the request rather than the operation
+var errBadRequest = errors.New("bad request")
+
+// newDaemonHandler returns the handler of the daemon's API. The config is
+// loaded again for every request, so changes to it apply without a restart.
+// Requests are served one at a time, holding mu, operations must not run
+// concurrently.
+func newDaemonHandler(fsys dotmanfs.FileSystem, loadConfig func() (*config.Config, error), mu *sync.Mutex) http.Handler {
+	handle := func(fn func(cfg *config.Config, r *http.Request) (any, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			cfg, err := loadConfig()
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("failed to load config: %w", err))
+				return
+			}
+			v, err := fn(cfg, r)
+			switch {
+			case errors.Is(err, errBadRequest):
+				writeAPIError(w, http.StatusBadRequest, err)
+			case err != nil:
+				writeAPIError(w, http.StatusInternalServerError, err)
+			default:
+				writeJSON(w, v, nil)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		return loadStatus(fsys, cfg)
+	}))
+	mux.HandleFunc("GET /v1/entries", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		return servedEntries(fsys, cfg)
+	}))
+	mux.HandleFunc("GET /v1/journal", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		return servedJournal(fsys, cfg, queryLimit(r, defaultServedEntries))
+	}))
+	mux.HandleFunc("GET /v1/journal/{id}", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		return newJournalManager(fsys, cfg, cfg.DotmanDir).GetEntry(r.PathValue("id"))
+	}))
+	mux.HandleFunc("POST /v1/add", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		var req daemonAddRequest
+		if err := decodeRequest(r, &req); err != nil {
+			return nil, err
+		}
+		return daemonAdd(fsys, cfg, req)
+	}))
+	mux.HandleFunc("POST /v1/link", handle(func(cfg *config.Config, r *http.Request) (any, error) {
+		var req daemonLinkRequest
+		if err := decodeRequest(r, &req); err != nil {
+			return nil, err
+		}
+		op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg, packages: req.Packages}
+		if err := op.run(); err != nil {
+			return nil, err
+		}
+		return daemonLinkResult{Linked: op.linked, Cloned: op.cloned, Fetched: op.fetched}, nil
+	}))
+
+	return mux
+}
+
+// autoGC runs gc --auto every interval until ctx is done, holding mu so it
+// never runs during a request
+func autoGC(ctx context.Context, fsys dotmanfs.FileSystem, interval time.Duration, mu *sync.Mutex, loadConfig func() (*config.Config, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mu.Lock()
+		cfg, err := loadConfig()
+		if err == nil {
+			_, err = runGC(fsys, cfg, true, defaultGCAge, time.Now())
+		}
+		mu.Unlock()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: gc failed: %v\n", err)
+		}
+	}
+}
+
+// decodeRequest decodes the JSON body of r into v. An empty body leaves v as
+// it is.
+func decodeRequest(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	return nil
+}
+
+// daemonAdd adds the path of an add request like `dotman add` does
+func daemonAdd(fsys dotmanfs.FileSystem, cfg *config.Config, req daemonAddRequest) (*daemonAddResult, error) {
+	if req.Path == "" {
+		return nil, fmt.Errorf("%w: path is required", errBadRequest)
+	}
+	if req.Follow && req.NoFollow {
+		return nil, fmt.Errorf("%w: follow and no_follow are mutually exclusive", errBadRequest)
+	}
+	if req.LineEndings != "" {
+		if err := manifest.ValidateLineEndings(req.LineEndings); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+	}
+	if req.Package != "" {
+		if err := manifest.ValidatePackageName(req.Package); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+	}
+	cfg, err := repoConfig(cfg, req.Repo, req.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	symlinks := symlinkRefuse
+	if req.Follow {
+		symlinks = symlinkFollow
+	} else if req.NoFollow {
+		symlinks = symlinkKeep
+	}
+
+	op := &addOperation{
+		path:        req.Path,
+		fsys:        fsys,
+		config:      cfg,
+		pkg:         req.Package,
+		symlinks:    symlinks,
+		forceLarge:  req.ForceLarge,
+		lineEndings: req.LineEndings,
+		copyNested:  req.CopyNested,
+	}
+	if err := op.run(); err != nil {
+		return nil, err
+	}
+	return &daemonAddResult{Entry: op.relPath, AlreadyTracked: op.alreadyTracked}, nil
+}
+
+// writeAPIError answers a daemon request with err as a JSON document
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
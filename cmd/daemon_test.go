@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestDaemonHandler(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	manfile := `{"entries":[{"path":".zshrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	handler := newDaemonHandler(fsys, func() (*config.Config, error) { return cfg, nil }, &sync.Mutex{})
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	var entries []servedEntry
+	if err := json.Unmarshal(request(http.MethodGet, "/v1/entries", "").Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to decode entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].State != "missing" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	rec := request(http.MethodPost, "/v1/link", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("link returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var linked daemonLinkResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &linked); err != nil || linked.Linked != 1 {
+		t.Errorf("expected one symlink to be created, got %+v (%v)", linked, err)
+	}
+	if data, err := fsys.ReadFile(filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil || string(data) != "zsh" {
+		t.Errorf("expected .zshrc to be linked, got %q (%v)", data, err)
+	}
+
+	var timeline []servedJournalEntry
+	if err := json.Unmarshal(request(http.MethodGet, "/v1/journal", "").Body.Bytes(), &timeline); err != nil || len(timeline) != 1 {
+		t.Fatalf("expected the link in the journal, got %+v (%v)", timeline, err)
+	}
+	var entry journal.JournalEntry
+	if err := json.Unmarshal(request(http.MethodGet, "/v1/journal/"+timeline[0].ID, "").Body.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode journal entry: %v", err)
+	}
+	if entry.ID != timeline[0].ID || entry.State != journal.EntryStateCompleted {
+		t.Errorf("unexpected journal entry %+v", entry)
+	}
+	if rec := request(http.MethodGet, "/v1/journal/unknown", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected an unknown journal entry to fail, got %d", rec.Code)
+	}
+
+	// Mistakes in the request are told apart from failed operations
+	for _, body := range []string{`{}`, `{"path": "x", "bogus": true}`, `{"path": "x", "follow": true, "no_follow": true}`, `{"path": "x", "line_endings": "cr"}`} {
+		rec := request(http.MethodPost, "/v1/add", body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("expected %s to be a bad request, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	rec = request(http.MethodPost, "/v1/add", `{"path": "`+filepath.Join(testutil.TestHomeDir, ".missing")+`"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected adding a missing path to fail, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := request(http.MethodDelete, "/v1/entries", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected DELETE to be refused, got %d", rec.Code)
+	}
+}
+
+func TestListenSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotman.sock")
+
+	listener, err := listenSocket(path)
+	if err != nil {
+		t.Fatalf("listenSocket failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("expected the socket to be private, got %v", info.Mode().Perm())
+	}
+
+	// A running daemon is not replaced
+	if _, err := listenSocket(path); err == nil {
+		t.Error("expected an error while another daemon listens")
+	}
+
+	// A socket left behind is
+	listener.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	listener.Close()
+	listener, err = listenSocket(path)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced: %v", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the dotman repository for inconsistencies",
+	Long: `Check the dotman repository for state that is broken here and would be broken
+on every machine it is pushed to:
+
+  - operations the journal records as interrupted
+  - journal entries that do not match the hash chain, with journal_chain set
+  - tracked entries without a copy in the repository
+  - a link_mode this platform cannot use
+  - entries in place without the mode recorded by 'dotman chmod'
+  - deduplicated files whose blob is missing from the store
+  - blobs whose content does not match their checksum, and the deduplicated
+    files sharing them
+
+With verify_before_push set, push runs the same checks first and refuses to
+push when they find a problem.
+
+Doctor exits with 4 when an operation was interrupted and 2 for any other
+problem, see 'dotman help exit-codes'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		problems, err := checkHealth(fsys, cfg)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			fmt.Println(paint(colorGreen, symbols().ok+"No problems found"))
+			return nil
+		}
+
+		printProblems(problems)
+		fmt.Println(paint(colorYellow, fmt.Sprintf("%sFound %d problems", symbols().problem, len(problems))))
+
+		interrupted, err := interruptedOperations(fsys, cfg)
+		if err != nil {
+			return fmt.Errorf("error reading journal: %w", err)
+		}
+		if len(interrupted) > 0 {
+			return exitWith(cmd, exitLocked)
+		}
+		return exitWith(cmd, exitDrift)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// healthProblem is an inconsistency found in the dotman directory
+type healthProblem struct {
+	Check string `json:"check"`
+	// Path is the file the problem is about, empty when there is none
+	Path    string `json:"path,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// checkHealth runs the doctor checks on the dotman directory
+func checkHealth(fsys dotmanfs.FileSystem, cfg *config.Config) ([]healthProblem, error) {
+	var problems []healthProblem
+
+	interrupted, err := interruptedOperations(fsys, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	for _, record := range interrupted {
+		problems = append(problems, healthProblem{
+			Check:   "journal",
+			Problem: fmt.Sprintf("%s %s started %s was interrupted", record.Operation, record.ID, record.Timestamp.Format(time.RFC3339)),
+		})
+	}
+
+	integrity, _, err := newJournalManager(fsys, cfg, cfg.DotmanDir).VerifyIntegrity()
+	if err != nil {
+		return nil, fmt.Errorf("error verifying journal: %w", err)
+	}
+	for _, p := range integrity {
+		problems = append(problems, healthProblem{Check: "journal", Problem: fmt.Sprintf("#%d %s: %s", p.Sequence, p.ID, p.Problem)})
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := newLinker(fsys, cfg, m).available(); err != nil {
+		problems = append(problems, healthProblem{Check: "link", Problem: err.Error()})
+	}
+
+	// Entries tracked in place have no copy, the file itself has to be there
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+	for _, entry := range m.Entries {
+		if mode, differs, err := modeDiffers(fsys, entry, entry.TargetPath(homeDir)); err == nil && differs {
+			problems = append(problems, healthProblem{Check: "mode", Path: entry.Path, Problem: fmt.Sprintf("has mode %s, the manifest asks for %s", manifest.FormatMode(mode), entry.Mode)})
+		}
+		if m.InPlace() {
+			if _, err := fsys.Lstat(entry.TargetPath(homeDir)); os.IsNotExist(err) {
+				problems = append(problems, healthProblem{Check: "manifest", Path: entry.Path, Problem: "tracked in place but missing from the home directory"})
+			}
+			continue
+		}
+		for _, link := range entry.Links() {
+			if _, err := fsys.Lstat(m.Layout.RepoPath(cfg.DotmanDir, link)); os.IsNotExist(err) {
+				problems = append(problems, healthProblem{Check: "manifest", Path: link.Path, Problem: "tracked but has no copy in the repository"})
+			}
+		}
+	}
+
+	for _, dir := range []string{m.Layout.HomeDir(cfg.DotmanDir), m.Layout.SystemDir(cfg.DotmanDir)} {
+		missing, err := store.Missing(fsys, cfg.DotmanDir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error checking blob links: %w", err)
+		}
+		for _, link := range missing {
+			problems = append(problems, healthProblem{Check: "store", Path: link, Problem: "links to a blob missing from the store"})
+		}
+	}
+
+	corrupt, err := store.Corrupt(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying blobs: %w", err)
+	}
+	changed := make(map[string]bool)
+	for _, blob := range corrupt {
+		problems = append(problems, healthProblem{Check: "checksum", Path: blob, Problem: "content does not match its checksum"})
+		changed[blob] = true
+	}
+	// Every copy sharing a changed blob changed with it
+	for _, dir := range []string{m.Layout.HomeDir(cfg.DotmanDir), m.Layout.SystemDir(cfg.DotmanDir)} {
+		links, err := store.LinksTo(fsys, cfg.DotmanDir, dir, changed)
+		if err != nil {
+			return nil, fmt.Errorf("error checking blob links: %w", err)
+		}
+		for _, link := range links {
+			problems = append(problems, healthProblem{Check: "store", Path: link, Problem: "shares a blob changed in place, as by an edit through its link"})
+		}
+	}
+
+	return problems, nil
+}
+
+// printProblems lists the problems the doctor checks found
+func printProblems(problems []healthProblem) {
+	for _, p := range problems {
+		check := paint(colorRed, fmt.Sprintf("%-9s", p.Check))
+		if p.Path == "" {
+			fmt.Printf("%s %s\n", check, p.Problem)
+			continue
+		}
+		fmt.Printf("%s %s: %s\n", check, p.Path, p.Problem)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestCheckHealth(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMockFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	zshrc := filepath.Join(dotmanDir, "data/.zshrc")
+	if err := fsys.WriteFile(zshrc, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if _, err := store.Dedup(fsys, dotmanDir, zshrc); err != nil {
+		t.Fatalf("failed to dedup: %v", err)
+	}
+	vimrc := filepath.Join(dotmanDir, "data/.vimrc")
+	if err := fsys.WriteFile(vimrc, []byte("vim"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	problems, err := checkHealth(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected a healthy repository, got %+v", problems)
+	}
+
+	// An interrupted operation, a tracked file without its copy and a blob
+	// changed behind dotman's back, with the copy sharing it
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	if _, err := jm.CreateEntry(journal.OperationTypeLink, "", ""); err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := fsys.Remove(vimrc); err != nil {
+		t.Fatalf("failed to remove data file: %v", err)
+	}
+	blob, _ := store.Resolve(fsys, dotmanDir, zshrc)
+	if err := fsys.Chmod(blob, 0644); err != nil {
+		t.Fatalf("failed to chmod blob: %v", err)
+	}
+	if err := fsys.WriteFile(blob, []byte("bash"), 0644); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+
+	problems, err = checkHealth(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+	checks := make(map[string]int)
+	for _, p := range problems {
+		checks[p.Check]++
+	}
+	if len(problems) != 4 || checks["journal"] != 1 || checks["manifest"] != 1 || checks["checksum"] != 1 || checks["store"] != 1 {
+		t.Errorf("expected a journal, a manifest, a checksum and a store problem, got %+v", problems)
+	}
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// Severities of drift findings, from the most to the least urgent
+const (
+	// driftCritical needs attention before dotman can be used safely
+	driftCritical = "critical"
+	// driftWarning loses work or leaves dotfiles unlinked if left alone
+	driftWarning = "warning"
+	// driftInfo is worth knowing but harmless
+	driftInfo = "info"
+)
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Report everything that is out of sync, by severity",
+	Long: `Summarize every way the dotfiles have drifted from the repository and the
+remote, each with a severity and the commands that fix it:
+
+  critical  interrupted operations, which may have left files half
+            changed, and files in the way of links, hijacked or replaced
+  warning   links that are missing, broken or have no copy, a dotman
+            directory moved by hand or a manifest changed outside dotman
+            since the last link, changes not committed, operations queued
+            to be retried, commits left unpushed for longer than
+            push_reminder and commits on origin that cannot be
+            fast-forwarded when pull_strategy is ff-only
+  info      other unpushed commits, and commits on origin not merged yet
+            as of the last fetch, with the command pull_strategy picks
+            to bring them in
+
+Meant as a morning "is everything in sync?" check, it prints a single line
+when nothing drifted. Use --json to get the findings as a JSON array.
+
+The exit code is the one status would exit with, see 'dotman help
+exit-codes'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		report, err := loadStatus(fsys, cfg)
+		if err != nil {
+			return fmt.Errorf("error getting status: %w", err)
+		}
+		findings := driftFindings(report, cfg.DotmanDir, cfg.PullStrategy)
+
+		if asJSON {
+			data, err := json.MarshalIndent(findings, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding drift: %w", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printDrift(findings)
+		}
+		return exitWith(cmd, statusExitCode(report))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+
+	driftCmd.Flags().Bool("json", false, "print the findings as JSON")
+}
+
+// driftFinding is one category of drift found by dotman drift
+type driftFinding struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	// Paths are the files or operations the finding is about
+	Paths []string `json:"paths,omitempty"`
+	// Fix holds the steps that remediate the finding, in order
+	Fix []string `json:"fix"`
+}
+
+// driftFindings sorts what report found into findings, most severe first.
+// A report without drift has none. Commits on the remote are brought in by
+// strategy, a pull_strategy value.
+func driftFindings(report *statusReport, dotmanDir, strategy string) []driftFinding {
+	findings := []driftFinding{}
+
+	if len(report.Interrupted) > 0 {
+		finding := driftFinding{
+			Category: "interrupted",
+			Severity: driftCritical,
+			Summary:  fmt.Sprintf("%d interrupted operations, files may be in a half-changed state", len(report.Interrupted)),
+		}
+		for _, record := range report.Interrupted {
+			finding.Paths = append(finding.Paths, fmt.Sprintf("%s %s", record.ID, record.Operation))
+			finding.Fix = append(finding.Fix, "dotman journal "+record.ID)
+		}
+		findings = append(findings, finding)
+	}
+
+	var conflicts, unlinked []string
+	for _, link := range report.Links {
+		switch link.State {
+		case "linked":
+		case "hijacked", "replaced":
+			conflicts = append(conflicts, fmt.Sprintf("%s (%s)", link.Path, link.State))
+		default:
+			unlinked = append(unlinked, fmt.Sprintf("%s (%s)", link.Path, link.State))
+		}
+	}
+	if len(conflicts) > 0 {
+		findings = append(findings, driftFinding{
+			Category: "conflicts",
+			Severity: driftCritical,
+			Summary:  fmt.Sprintf("%d home paths are not the tracked copies", len(conflicts)),
+			Paths:    conflicts,
+			Fix:      []string{"dotman which <path>", "move the file aside, then dotman link"},
+		})
+	}
+	if len(unlinked) > 0 {
+		findings = append(findings, driftFinding{
+			Category: "links",
+			Severity: driftWarning,
+			Summary:  fmt.Sprintf("%d tracked entries are not linked", len(unlinked)),
+			Paths:    unlinked,
+			Fix:      []string{"dotman link", "dotman doctor"},
+		})
+	}
+
+	for _, problem := range report.State {
+		findings = append(findings, driftFinding{
+			Category: "state",
+			Severity: driftWarning,
+			Summary:  problem.Problem,
+			Fix:      []string{problem.Fix},
+		})
+	}
+
+	if reportDirty(report) {
+		finding := driftFinding{
+			Category: "uncommitted",
+			Severity: driftWarning,
+			Fix:      []string{"dotman status", `dotman commit -m "<message>"`},
+		}
+		for _, file := range report.Files {
+			if file.Staging != "unmodified" || file.Worktree != "unmodified" {
+				finding.Paths = append(finding.Paths, file.Path)
+			}
+		}
+		finding.Summary = fmt.Sprintf("%d changed files not committed", len(finding.Paths))
+		findings = append(findings, finding)
+	}
+
+	if report.Unpushed != nil || len(report.Pending) > 0 {
+		finding := driftFinding{
+			Category: "unpushed",
+			Severity: driftInfo,
+			Fix:      []string{"dotman push"},
+		}
+		var summary []string
+		if report.Unpushed != nil {
+			summary = append(summary, fmt.Sprintf("%d commits not pushed since %s", report.Unpushed.Commits, report.Unpushed.Since.Format("2006-01-02")))
+			if report.Unpushed.Overdue {
+				finding.Severity = driftWarning
+			}
+		}
+		if len(report.Pending) > 0 {
+			summary = append(summary, fmt.Sprintf("%d operations queued to be retried", len(report.Pending)))
+			finding.Severity = driftWarning
+			for _, marker := range report.Pending {
+				finding.Paths = append(finding.Paths, string(marker.Operation))
+			}
+		}
+		finding.Summary = strings.Join(summary, ", ")
+		findings = append(findings, finding)
+	}
+
+	if report.Branch.Behind > 0 {
+		finding := driftFinding{
+			Category: "remote",
+			Severity: driftInfo,
+			Summary:  fmt.Sprintf("%d commits on %s not merged, as of the last fetch", report.Branch.Behind, report.Branch.Upstream),
+		}
+		merge := fmt.Sprintf("git -C %s merge %s", dotmanDir, report.Branch.Upstream)
+		rebase := fmt.Sprintf("git -C %s rebase %s", dotmanDir, report.Branch.Upstream)
+		switch {
+		case strategy == config.PullRebase:
+			finding.Fix = []string{rebase}
+		case strategy == config.PullFFOnly && report.Branch.Ahead > 0:
+			// The histories diverged, only rebasing or merging brings the
+			// commits in
+			finding.Severity = driftWarning
+			finding.Summary += fmt.Sprintf(", a fast-forward is not possible with %d local commits and pull_strategy is ff-only", report.Branch.Ahead)
+			finding.Fix = []string{rebase, `or "dotman config set pull_strategy merge", then ` + merge}
+		case strategy == config.PullFFOnly:
+			finding.Fix = []string{fmt.Sprintf("git -C %s merge --ff-only %s", dotmanDir, report.Branch.Upstream)}
+		default:
+			finding.Fix = []string{merge}
+		}
+		finding.Fix = append(finding.Fix, "dotman link")
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// printDrift prints the findings with their paths and fixes
+func printDrift(findings []driftFinding) {
+	if len(findings) == 0 {
+		fmt.Println(paint(colorGreen, symbols().ok+"Everything is in sync"))
+		return
+	}
+
+	for i, finding := range findings {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s %s: %s\n", paint(driftColor(finding.Severity), fmt.Sprintf("%-8s", finding.Severity)), finding.Category, finding.Summary)
+		for _, path := range finding.Paths {
+			fmt.Printf("  %s\n", path)
+		}
+		for _, fix := range finding.Fix {
+			fmt.Printf("  fix: %s\n", fix)
+		}
+	}
+}
+
+// driftColor returns the color of a severity
+func driftColor(severity string) string {
+	switch severity {
+	case driftCritical:
+		return colorRed
+	case driftWarning:
+		return colorYellow
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+func TestDriftFindings(t *testing.T) {
+	clean := &statusReport{
+		Links: []linkStatus{{Entry: ".zshrc", Path: "home/test/.zshrc", State: "linked"}},
+		Files: []statusFile{{Path: ".zshrc", Staging: "unmodified", Worktree: "unmodified"}},
+	}
+	if findings := driftFindings(clean, "dotman", ""); len(findings) != 0 {
+		t.Fatalf("expected no drift, got %+v", findings)
+	}
+
+	report := &statusReport{
+		Interrupted: []journal.IndexRecord{{ID: "abc", Operation: journal.OperationTypeAdd}},
+		Branch:      statusBranch{Name: "main", Upstream: "origin/main", Ahead: 1, Behind: 2},
+		Unpushed:    &unpushedReport{Commits: 1, Since: time.Now()},
+		Files:       []statusFile{{Path: ".vimrc", Staging: "unmodified", Worktree: "modified"}},
+		Links: []linkStatus{
+			{Entry: ".zshrc", Path: "home/test/.zshrc", State: "linked"},
+			{Entry: ".vimrc", Path: "home/test/.vimrc", State: "hijacked"},
+			{Entry: ".gitconfig", Path: "home/test/.gitconfig", State: "missing"},
+		},
+	}
+
+	expected := []struct{ category, severity string }{
+		{"interrupted", driftCritical},
+		{"conflicts", driftCritical},
+		{"links", driftWarning},
+		{"uncommitted", driftWarning},
+		{"unpushed", driftInfo},
+		{"remote", driftInfo},
+	}
+	findings := driftFindings(report, "dotman", "")
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %+v", len(expected), findings)
+	}
+	for i, e := range expected {
+		if findings[i].Category != e.category || findings[i].Severity != e.severity {
+			t.Errorf("finding %d: expected %s %s, got %s %s", i, e.category, e.severity, findings[i].Category, findings[i].Severity)
+		}
+		if len(findings[i].Fix) == 0 {
+			t.Errorf("finding %s has no fix", findings[i].Category)
+		}
+	}
+	if len(findings[2].Paths) != 1 || findings[2].Paths[0] != "home/test/.gitconfig (missing)" {
+		t.Errorf("expected the missing link to be listed, got %v", findings[2].Paths)
+	}
+
+	// Commits left unpushed too long and queued pushes need attention
+	report.Unpushed.Overdue = true
+	if findings := driftFindings(report, "dotman", ""); findings[4].Severity != driftWarning {
+		t.Errorf("expected overdue commits to be a warning, got %s", findings[4].Severity)
+	}
+
+	// Diverged histories cannot be fast-forwarded
+	findings = driftFindings(report, "dotman", config.PullFFOnly)
+	if remote := findings[5]; remote.Severity != driftWarning || !strings.Contains(remote.Summary, "fast-forward is not possible") || remote.Fix[0] != "git -C dotman rebase origin/main" {
+		t.Errorf("expected a diverged ff-only remote to be a warning suggesting a rebase, got %+v", remote)
+	}
+	report.Branch.Ahead = 0
+	findings = driftFindings(report, "dotman", config.PullFFOnly)
+	if remote := findings[len(findings)-1]; remote.Severity != driftInfo || remote.Fix[0] != "git -C dotman merge --ff-only origin/main" {
+		t.Errorf("expected a fast-forward to be suggested, got %+v", remote)
+	}
+	findings = driftFindings(report, "dotman", config.PullRebase)
+	if remote := findings[len(findings)-1]; remote.Fix[0] != "git -C dotman rebase origin/main" {
+		t.Errorf("expected a rebase to be suggested, got %+v", remote)
+	}
+}
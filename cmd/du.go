@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/spf13/cobra"
+)
+
+// duPruneAge is the age past which du suggests pruning journal entries and
+// backups, the default of 'dotman journal prune'
+const duPruneAge = 90 * 24 * time.Hour
+
+// duLargeFile is the size from which a binary copy is suggested
+// for the offload store when offload_size is not set
+const duLargeFile int64 = 1 << 20
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Report the disk space taken by the repository, journal and backups",
+	Long: `Report the disk space taken by the copies in the directories of the layout,
+data/ and system/ by default, by package, the git object store, the journal,
+the backups of link and the local copies of offloaded files, followed by
+suggestions to reclaim space:
+
+  - journal entries and backups older than 90 days, which 'dotman journal
+    prune' moves to compressed archives
+  - binary copies larger than offload_size, or 1 MB without it, which
+    belong in the offload store
+  - more than 1000 loose git objects, which 'dotman gc' packs
+
+Dotfile repositories grow silently over the years, this shows where to. Use
+--json to get the report as JSON.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		report, err := collectDiskUsage(fsys, cfg, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding disk usage: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		printDiskUsage(os.Stdout, report)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(duCmd)
+
+	duCmd.Flags().Bool("json", false, "print the report as JSON")
+}
+
+// duReport is the disk space taken by a dotman repository and what goes
+// with it, in bytes
+type duReport struct {
+	// DataDirs are the directories of the layout Data is the size of
+	DataDirs []string    `json:"data_dirs"`
+	Data     int64       `json:"data"`
+	Packages []duPackage `json:"packages"`
+	Git      int64       `json:"git"`
+	Journal  int64       `json:"journal"`
+	Backups  int64       `json:"backups"`
+	Offload  int64       `json:"offload"`
+	Total    int64       `json:"total"`
+	// Suggestions are the ways to reclaim space, each with its command
+	Suggestions []string `json:"suggestions"`
+}
+
+// duPackage is the space taken by the copies of the entries of a package,
+// the empty name standing for entries without one
+type duPackage struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	Size    int64  `json:"size"`
+}
+
+// collectDiskUsage measures the repository of cfg and looks for space to
+// reclaim, judging ages as of now
+func collectDiskUsage(fsys dotmanfs.FileSystem, cfg *config.Config, now time.Time) (*duReport, error) {
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	backups, err := backupRoot(fsys, cfg)
+	if err != nil {
+		return nil, err
+	}
+	gitDir := filepath.Join(cfg.DotmanDir, ".git")
+
+	report := &duReport{
+		DataDirs:    m.Layout.Dirs(),
+		Data:        diskUsage(fsys, m.Layout.HomeDir(cfg.DotmanDir)) + diskUsage(fsys, m.Layout.SystemDir(cfg.DotmanDir)),
+		Git:         diskUsage(fsys, filepath.Join(gitDir, "objects")),
+		Journal:     diskUsage(fsys, cfg.JournalPath(cfg.DotmanDir)),
+		Backups:     diskUsage(fsys, backups),
+		Offload:     diskUsage(fsys, filepath.Join(cfg.DotmanDir, offload.Dir)),
+		Suggestions: []string{},
+	}
+	report.Total = report.Data + report.Git + report.Journal + report.Backups + report.Offload
+
+	packages := make(map[string]*duPackage)
+	for _, entry := range m.Entries {
+		pkg, ok := packages[entry.Package]
+		if !ok {
+			pkg = &duPackage{Name: entry.Package}
+			packages[entry.Package] = pkg
+		}
+		pkg.Entries++
+		pkg.Size += diskUsage(fsys, m.Layout.RepoPath(cfg.DotmanDir, entry))
+	}
+	for _, pkg := range packages {
+		report.Packages = append(report.Packages, *pkg)
+	}
+	// Largest first, entries without a package last
+	sort.Slice(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		if (a.Name == "") != (b.Name == "") {
+			return b.Name == ""
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Name < b.Name
+	})
+
+	cutoff := now.Add(-duPruneAge)
+	if records, err := newJournalManager(fsys, cfg, cfg.DotmanDir).Index(); err == nil {
+		old := 0
+		for _, record := range records {
+			if record.ParentID == "" && record.State != journal.EntryStateCurrent && record.Timestamp.Before(cutoff) {
+				old++
+			}
+		}
+		if old > 0 {
+			report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d journal entries are older than 90 days, 'dotman journal prune' moves them to a compressed archive", old))
+		}
+	}
+	if old := oldBackups(fsys, backups, cutoff); old > 0 {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d backups are older than 90 days, 'dotman journal prune' compresses them", old))
+	}
+
+	threshold, err := cfg.OffloadSizeBytes()
+	if err != nil || threshold == 0 {
+		threshold = duLargeFile
+	}
+	for _, dir := range []string{m.Layout.HomeDir(cfg.DotmanDir), m.Layout.SystemDir(cfg.DotmanDir)} {
+		for _, large := range largeBinaries(fsys, dir, threshold) {
+			rel, _ := filepath.Rel(cfg.DotmanDir, large.path)
+			report.Suggestions = append(report.Suggestions, fmt.Sprintf("%s is %s of binary data, set offload_size and add it again to keep it in the offload store", rel, config.FormatSize(large.size)))
+		}
+	}
+
+	if loose := looseObjects(fsys, gitDir); loose >= gcLooseObjects {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d loose git objects, 'dotman gc' packs them", loose))
+	}
+
+	return report, nil
+}
+
+// oldBackups returns the number of backup directories of link in root made
+// before cutoff and not compressed yet
+func oldBackups(fsys dotmanfs.FileSystem, root string, cutoff time.Time) int {
+	infos, err := fsys.Readdir(root)
+	if err != nil {
+		return 0
+	}
+	old := 0
+	for _, info := range infos {
+		made, err := time.ParseInLocation(backupTimeFormat, info.Name(), time.Local)
+		if err == nil && info.IsDir() && made.Before(cutoff) {
+			old++
+		}
+	}
+	return old
+}
+
+// largeFile is a file and its size in bytes
+type largeFile struct {
+	path string
+	size int64
+}
+
+// largeBinaries returns the binary regular files below dir of at least
+// threshold bytes, largest first. Offloaded files are symlinks and are not
+// among them.
+func largeBinaries(fsys dotmanfs.FileSystem, dir string, threshold int64) []largeFile {
+	var files []largeFile
+	fsys.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() < threshold {
+			return nil
+		}
+		if binary, err := dotmanfs.IsBinary(fsys, path); err == nil && binary {
+			files = append(files, largeFile{path: path, size: info.Size()})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].size > files[j].size })
+	return files
+}
+
+// looseObjects returns the number of loose objects in the git directory
+// gitDir, which git stores in objects/ under the first two hex digits of
+// their hash
+func looseObjects(fsys dotmanfs.FileSystem, gitDir string) int {
+	dirs, err := fsys.Readdir(filepath.Join(gitDir, "objects"))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || strings.Trim(dir.Name(), "0123456789abcdef") != "" {
+			continue
+		}
+		if objects, err := fsys.Readdir(filepath.Join(gitDir, "objects", dir.Name())); err == nil {
+			n += len(objects)
+		}
+	}
+	return n
+}
+
+// printDiskUsage prints the report as aligned columns, followed by the
+// suggestions
+func printDiskUsage(w io.Writer, report *duReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	dirs := make([]string, len(report.DataDirs))
+	for i, dir := range report.DataDirs {
+		dirs[i] = dir + "/"
+	}
+	fmt.Fprintf(tw, "%s\t%s\t\n", strings.Join(dirs, ", "), config.FormatSize(report.Data))
+	for _, pkg := range report.Packages {
+		name := pkg.Name
+		if name == "" {
+			name = "no package"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d entries\n", name, config.FormatSize(pkg.Size), pkg.Entries)
+	}
+	fmt.Fprintf(tw, "git objects\t%s\t\n", config.FormatSize(report.Git))
+	fmt.Fprintf(tw, "journal\t%s\t\n", config.FormatSize(report.Journal))
+	fmt.Fprintf(tw, "backups\t%s\t\n", config.FormatSize(report.Backups))
+	fmt.Fprintf(tw, "offloaded files\t%s\t\n", config.FormatSize(report.Offload))
+	fmt.Fprintf(tw, "total\t%s\t\n", config.FormatSize(report.Total))
+	tw.Flush()
+
+	if len(report.Suggestions) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nSuggestions:")
+	for _, suggestion := range report.Suggestions {
+		fmt.Fprintf(w, "  - %s\n", suggestion)
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestCollectDiskUsage(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.BackupDir = "/mnt/backups"
+	manfile := `{"entries":[{"path":".zshrc","type":"file","package":"zsh"},{"path":".zshenv","type":"file","package":"zsh"},{"path":".vimrc","type":"file","package":"vim"},{"path":".local/bin/tool","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	files := map[string][]byte{
+		".zshrc":          []byte(strings.Repeat("z", 300)),
+		".zshenv":         []byte(strings.Repeat("z", 100)),
+		".vimrc":          []byte(strings.Repeat("v", 1000)),
+		".local/bin/tool": append([]byte{0x7f, 'E', 'L', 'F', 0}, make([]byte, 2<<20)...),
+	}
+	for name, data := range files {
+		path := filepath.Join(dotmanDir, "data", name)
+		fsys.MkdirAll(filepath.Dir(path), 0755)
+		if err := fsys.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+	fsys.MkdirAll(filepath.Join(cfg.BackupDir, "20200101-120000"), 0755)
+	fsys.WriteFile(filepath.Join(cfg.BackupDir, "20200101-120000", ".vimrc"), []byte("old"), 0644)
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	entry, err := jm.CreateEntry(journal.OperationTypeLink, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := jm.MoveEntry(entry, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+
+	report, err := collectDiskUsage(fsys, cfg, time.Now())
+	if err != nil {
+		t.Fatalf("collectDiskUsage failed: %v", err)
+	}
+	if report.Data != 1400+int64(len(files[".local/bin/tool"])) {
+		t.Errorf("unexpected data size %d", report.Data)
+	}
+	if report.Backups != 3 || report.Journal == 0 {
+		t.Errorf("expected the backup and the journal to be measured, got %d and %d", report.Backups, report.Journal)
+	}
+	expected := []duPackage{{Name: "vim", Entries: 1, Size: 1000}, {Name: "zsh", Entries: 2, Size: 400}, {Name: "", Entries: 1, Size: int64(len(files[".local/bin/tool"]))}}
+	if len(report.Packages) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, report.Packages)
+	}
+	for i, pkg := range expected {
+		if report.Packages[i] != pkg {
+			t.Errorf("expected %+v, got %+v", pkg, report.Packages[i])
+		}
+	}
+
+	// The journal entry is not old yet, the backup and the binary are
+	if len(report.Suggestions) != 2 || !strings.Contains(report.Suggestions[0], "1 backups") || !strings.HasPrefix(report.Suggestions[1], "data/.local/bin/tool is 2.0 MB of binary data") {
+		t.Errorf("unexpected suggestions %q", report.Suggestions)
+	}
+	report, err = collectDiskUsage(fsys, cfg, time.Now().Add(100*24*time.Hour))
+	if err != nil {
+		t.Fatalf("collectDiskUsage failed: %v", err)
+	}
+	if !strings.HasPrefix(report.Suggestions[0], "1 journal entries are older than 90 days") {
+		t.Errorf("expected the journal entry to be suggested for pruning, got %q", report.Suggestions)
+	}
+
+	var out bytes.Buffer
+	printDiskUsage(&out, report)
+	if !strings.HasPrefix(out.String(), "data/, system/ ") || !strings.Contains(out.String(), "  zsh ") || !strings.Contains(out.String(), "  no package ") || !strings.Contains(out.String(), "Suggestions:\n  - 1 journal entries") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// A custom layout is reported by its directories
+	fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(`{"layout":{"home":"dotfiles/home","system":"dotfiles/etc"}}`), 0644)
+	report, err = collectDiskUsage(fsys, cfg, time.Now())
+	if err != nil {
+		t.Fatalf("collectDiskUsage failed: %v", err)
+	}
+	out.Reset()
+	printDiskUsage(&out, report)
+	if !strings.HasPrefix(out.String(), "dotfiles/home/, dotfiles/etc/ ") {
+		t.Errorf("expected the layout directories as label, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env [bash|zsh|fish|powershell]",
+	Short: "Print shell code exporting the repository location",
+	Long: `Print shell code that exports where the repository is and defines helper
+functions, so scripts never hard-code the location. The shell is taken from
+$SHELL when not given.
+
+The code exports:
+  DOTMAN_REPO            the dotman directory of the active profile
+  DOTMAN_ACTIVE_PROFILE  the name of the active profile
+  DOTMAN_STATUS          the word 'dotman status --porcelain' prints
+
+and defines dotcd, which changes to the dotman directory or a directory
+inside it.
+
+DOTMAN_REPO is only read by the helpers and your scripts, dotman itself
+keeps following the active profile. Evaluate the code again after switching
+profiles to update it.`,
+	Example: `  eval "$(dotman env)"
+  dotman env fish | source
+  dotman env powershell | Out-String | Invoke-Expression`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := detectShell()
+		if len(args) == 1 {
+			shell = args[0]
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		profile, _ := cfg.CurrentProfile()
+		vars := []envVar{
+			{"DOTMAN_REPO", cfg.DotmanDir},
+			{"DOTMAN_ACTIVE_PROFILE", profile},
+		}
+		// A repository status cannot read leaves the variable unset, the
+		// rest of the code is still worth evaluating
+		if status, err := fastPorcelain(fsys, cfg); err == nil {
+			vars = append(vars, envVar{"DOTMAN_STATUS", status})
+		}
+
+		return writeEnv(cmd.OutOrStdout(), shell, vars)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+}
+
+// envVar is a variable exported by dotman env
+type envVar struct {
+	name  string
+	value string
+}
+
+// detectShell returns the shell dotman env writes for by default: the one
+// $SHELL names, PowerShell on Windows without it
+func detectShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return strings.TrimSuffix(filepath.Base(shell), ".exe")
+	}
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "bash"
+}
+
+// writeEnv writes the code exporting vars and defining the helpers in the
+// syntax of shell
+func writeEnv(w io.Writer, shell string, vars []envVar) error {
+	switch shell {
+	case "bash", "zsh", "sh":
+		for _, v := range vars {
+			fmt.Fprintf(w, "export %s=%s\n", v.name, posixQuote(v.value))
+		}
+		fmt.Fprintln(w, `dotcd() { cd "$DOTMAN_REPO/${1:-}"; }`)
+	case "fish":
+		for _, v := range vars {
+			fmt.Fprintf(w, "set -gx %s %s\n", v.name, fishQuote(v.value))
+		}
+		fmt.Fprintln(w, `function dotcd; cd "$DOTMAN_REPO/$argv[1]"; end`)
+	case "powershell", "pwsh":
+		for _, v := range vars {
+			fmt.Fprintf(w, "$env:%s = %s\n", v.name, powershellQuote(v.value))
+		}
+		fmt.Fprintln(w, `function dotcd { param([string]$Path = ""); Set-Location (Join-Path $env:DOTMAN_REPO $Path) }`)
+	default:
+		return fmt.Errorf("unsupported shell '%s'. Supported shells are: bash, zsh, fish, powershell", shell)
+	}
+	return nil
+}
+
+// posixQuote quotes s for POSIX shells
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes s for fish, where backslashes and single quotes are
+// escaped inside single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// powershellQuote quotes s for PowerShell, doubling single quotes
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestWriteEnv(t *testing.T) {
+	vars := []envVar{{"DOTMAN_REPO", "/home/o'neil/.dotman"}, {"DOTMAN_STATUS", "clean"}}
+
+	tests := []struct {
+		shell    string
+		expected string
+	}{
+		{
+			shell: "zsh",
+			expected: `export DOTMAN_REPO='/home/o'\''neil/.dotman'
+export DOTMAN_STATUS='clean'
+dotcd() { cd "$DOTMAN_REPO/${1:-}"; }
+`,
+		},
+		{
+			shell: "fish",
+			expected: `set -gx DOTMAN_REPO '/home/o\'neil/.dotman'
+set -gx DOTMAN_STATUS 'clean'
+function dotcd; cd "$DOTMAN_REPO/$argv[1]"; end
+`,
+		},
+		{
+			shell: "powershell",
+			expected: `$env:DOTMAN_REPO = '/home/o''neil/.dotman'
+$env:DOTMAN_STATUS = 'clean'
+function dotcd { param([string]$Path = ""); Set-Location (Join-Path $env:DOTMAN_REPO $Path) }
+`,
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := writeEnv(&out, tt.shell, vars); err != nil {
+			t.Fatalf("writeEnv(%s) failed: %v", tt.shell, err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("writeEnv(%s) =\n%s\nexpected\n%s", tt.shell, out.String(), tt.expected)
+		}
+	}
+
+	if err := writeEnv(&bytes.Buffer{}, "tcsh", vars); err == nil {
+		t.Error("expected an unsupported shell to be refused")
+	}
+}
+
+func TestEnv_InheritedDotmanDir(t *testing.T) {
+	mockFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	testutil.SetupTestConfig(t, mockFS, dotmanDir)
+
+	oldFsys, oldConfigPath := fsys, configPath
+	fsys, configPath = mockFS, filepath.Join(testutil.TestHomeDir, ".dotconfig")
+	defer func() { fsys, configPath = oldFsys, oldConfigPath }()
+
+	// As left behind by evaluating the code of an older dotman
+	t.Setenv("DOTMAN_DIR", "/old/dotman")
+
+	var out bytes.Buffer
+	envCmd.SetOut(&out)
+	defer envCmd.SetOut(nil)
+	if err := envCmd.RunE(envCmd, []string{"bash"}); err != nil {
+		t.Fatalf("env failed: %v", err)
+	}
+
+	// Exporting DOTMAN_DIR would pin every later dotman command in the
+	// shell to one directory and make profile switches do nothing
+	if strings.Contains(out.String(), "DOTMAN_DIR=") {
+		t.Errorf("expected DOTMAN_DIR not to be exported, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "export DOTMAN_REPO='/old/dotman'\n") {
+		t.Errorf("expected DOTMAN_REPO to be exported, got:\n%s", out.String())
+	}
+}
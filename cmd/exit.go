@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of dotman. They are part of its interface, scripts rely on
+// them, so existing codes must keep their meaning.
+const (
+	// exitOK means the command succeeded and found nothing to report
+	exitOK = 0
+	// exitError means the command failed
+	exitError = 1
+	// exitDrift means the command worked and found the dotfiles out of
+	// step: changes not committed or pushed, links not in place, or doctor
+	// problems
+	exitDrift = 2
+	// exitConflict means files are in the way of links, hijacked or
+	// replaced, and need a decision before dotman can link them
+	exitConflict = 3
+	// exitLocked means an interrupted operation is recorded as in progress
+	// and has to be finished or rolled back first
+	exitLocked = 4
+)
+
+var exitCodesCmd = &cobra.Command{
+	Use:   "exit-codes",
+	Short: "Exit codes of dotman commands",
+	Long: `dotman exits with one of these codes, so scripts and cron jobs can act on the
+outcome without parsing output:
+
+  0  success, nothing to report
+  1  error, the command failed
+  2  drift: status found uncommitted or unpushed changes or links that are
+     not in place, or doctor found problems
+  3  conflict: status found files in the way of links, hijacked or replaced
+  4  locked: status or doctor found an interrupted operation that has to be
+     finished or rolled back first
+
+When more than one applies, the highest code is returned.
+
+With --quiet, nothing is printed when the command succeeds with code 0.
+Otherwise what the command printed is shown as usual, so a cron job only
+sends mail when something needs attention. Questions dotman has to ask, and
+editors it runs, still use the terminal.`,
+}
+
+func init() {
+	rootCmd.AddCommand(exitCodesCmd)
+}
+
+// exitCodeError makes Execute exit with a code other than 1. What the
+// command found was printed already, so it has no message of its own.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// exitWith returns the error that makes cmd exit with code, without cobra
+// printing an error or the usage
+func exitWith(cmd *cobra.Command, code int) error {
+	if code == exitOK {
+		return nil
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return &exitCodeError{code: code}
+}
+
+// quietOutput holds what was printed while --quiet held the output back
+var quietOutput *os.File
+
+// saved output of the process while quietOutput replaces it
+var stdout, stderr *os.File
+
+// holdOutput redirects stdout and stderr to a temporary file until
+// releaseOutput decides whether to show it
+func holdOutput() error {
+	f, err := os.CreateTemp("", "dotman-quiet-*")
+	if err != nil {
+		return fmt.Errorf("error creating quiet output buffer: %w", err)
+	}
+	os.Remove(f.Name())
+
+	quietOutput = f
+	stdout, stderr = os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = f, f
+	return nil
+}
+
+// terminalOutput returns where questions and interactive programs such as
+// an editor write to: stdout of the process, even while --quiet holds the
+// output back, so nobody is asked a question they cannot see
+func terminalOutput() *os.File {
+	if quietOutput != nil {
+		return stdout
+	}
+	return os.Stdout
+}
+
+// releaseOutput restores stdout and stderr, printing what was held back
+// unless the command succeeded
+func releaseOutput(code int) {
+	if quietOutput == nil {
+		return
+	}
+	os.Stdout, os.Stderr = stdout, stderr
+	if code != exitOK {
+		if _, err := quietOutput.Seek(0, io.SeekStart); err == nil {
+			io.Copy(os.Stdout, quietOutput)
+		}
+	}
+	quietOutput.Close()
+	quietOutput = nil
+}
+
+// exit ends the process with code, first printing the --trace timings and
+// releasing output held back by --quiet. Commands use it instead of os.Exit.
+func exit(code int) {
+	printTrace()
+	releaseOutput(code)
+	os.Exit(code)
+}
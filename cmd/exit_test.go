@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+func TestStatusExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		report statusReport
+		want   int
+	}{
+		{name: "clean", report: statusReport{Links: []linkStatus{{State: "linked"}}}, want: exitOK},
+		{name: "dirty", report: statusReport{Files: []statusFile{{Staging: "unmodified", Worktree: "modified"}}}, want: exitDrift},
+		{name: "unpushed", report: statusReport{Branch: statusBranch{Ahead: 2}}, want: exitDrift},
+		{name: "missing link", report: statusReport{Links: []linkStatus{{State: "linked"}, {State: "missing"}}}, want: exitDrift},
+		{name: "hijacked", report: statusReport{Links: []linkStatus{{State: "missing"}, {State: "hijacked"}}}, want: exitConflict},
+		{name: "interrupted", report: statusReport{
+			Interrupted: []journal.IndexRecord{{ID: "add-1"}},
+			Links:       []linkStatus{{State: "replaced"}},
+		}, want: exitLocked},
+	}
+
+	for _, tt := range tests {
+		if got := statusExitCode(&tt.report); got != tt.want {
+			t.Errorf("%s: statusExitCode = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHoldOutput(t *testing.T) {
+	for _, code := range []int{exitOK, exitDrift} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("Pipe failed: %v", err)
+			}
+			origStdout, origStderr := os.Stdout, os.Stderr
+			os.Stdout, os.Stderr = w, w
+			defer func() { os.Stdout, os.Stderr = origStdout, origStderr }()
+
+			if err := holdOutput(); err != nil {
+				t.Fatalf("holdOutput failed: %v", err)
+			}
+			fmt.Println("Links:")
+			fmt.Fprintln(os.Stderr, "Loading config")
+			releaseOutput(code)
+
+			if os.Stdout != w || os.Stderr != w {
+				t.Fatal("expected releaseOutput to restore stdout and stderr")
+			}
+			w.Close()
+			out, _ := io.ReadAll(r)
+
+			want := ""
+			if code != exitOK {
+				want = "Links:\nLoading config\n"
+			}
+			if string(out) != want {
+				t.Errorf("released output %q, want %q", out, want)
+			}
+		})
+	}
+}
+
+func TestHoldOutput_Prompt(t *testing.T) {
+	oldInput, oldInteractive, oldYes := promptInput, isInteractive, assumeYes
+	defer func() { promptInput, isInteractive, assumeYes = oldInput, oldInteractive, oldYes }()
+	isInteractive = func() bool { return true }
+	promptInput = strings.NewReader("y\n")
+	assumeYes = false
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe failed: %v", err)
+	}
+	origStdout, origStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	defer func() { os.Stdout, os.Stderr = origStdout, origStderr }()
+
+	if err := holdOutput(); err != nil {
+		t.Fatalf("holdOutput failed: %v", err)
+	}
+	// The question is asked on the terminal while the rest is held back
+	if !confirmDestructive("Delete?") {
+		t.Error("expected the answer to be read")
+	}
+	fmt.Println("Deleted")
+	releaseOutput(exitOK)
+
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if want := "Delete? [y/N] "; string(out) != want {
+		t.Errorf("terminal got %q, want %q", out, want)
+	}
+}
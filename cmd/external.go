@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// findExternals returns the git repositories below the directory root that
+// can be cloned again: those with an origin remote and a checked out commit.
+// Repositories without them are returned as local, their files are copied
+// like any other but without their history.
+func findExternals(fsys dotmanfs.FileSystem, root string) ([]manifest.External, []string, error) {
+	var externals []manifest.External
+	var local []string
+
+	err := fsys.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root || !d.IsDir() {
+			return nil
+		}
+		if info, err := fsys.Lstat(filepath.Join(path, ".git")); err != nil || !info.IsDir() {
+			return nil
+		}
+
+		rel, err := fsys.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		external, ok := readExternal(fsys, path)
+		if !ok {
+			local = append(local, rel)
+			return nil
+		}
+		external.Path = rel
+		externals = append(externals, external)
+		return filepath.SkipDir
+	})
+	return externals, local, err
+}
+
+// readExternal reads where the repository at dir can be cloned from and the
+// commit it has checked out
+func readExternal(fsys dotmanfs.FileSystem, dir string) (manifest.External, bool) {
+	repo, err := git.Open(newGitStorage(fsys, dir), dotmanfs.NewBillyFileSystem(fsys, dir, dotmanfs.Perm{}))
+	if err != nil {
+		return manifest.External{}, false
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return manifest.External{}, false
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return manifest.External{}, false
+	}
+	return manifest.External{URL: remote.Config().URLs[0], Commit: head.Hash().String()}, true
+}
+
+// isExternal reports whether rel, relative to the entry, is the checkout of
+// one of externals
+func isExternal(externals []manifest.External, rel string) bool {
+	for _, external := range externals {
+		if external.Path == filepath.ToSlash(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// externalDir returns the location of the checkout of external below the copy
+// of entry in the dotman directory
+func externalDir(layout manifest.Layout, dotmanDir string, entry manifest.Entry, external manifest.External) string {
+	return filepath.Join(layout.RepoPath(dotmanDir, entry), filepath.FromSlash(external.Path))
+}
+
+// ignoreExternals adds the checkouts of the externals of entry to the
+// .gitignore of the dotman directory, so their files are never committed.
+// It reports whether the file changed.
+func ignoreExternals(fsys dotmanfs.FileSystem, dotmanDir string, layout manifest.Layout, entry manifest.Entry) (bool, error) {
+	var patterns []string
+	for _, external := range entry.Externals {
+		patterns = append(patterns, "/"+filepath.ToSlash(externalDir(layout, "", entry, external))+"/")
+	}
+	return ignorePatterns(fsys, dotmanDir, patterns...)
+}
+
+// ignorePatterns appends the patterns the .gitignore of the dotman directory
+// does not have yet. It reports whether the file changed.
+func ignorePatterns(fsys dotmanfs.FileSystem, dotmanDir string, patterns ...string) (bool, error) {
+	path := filepath.Join(dotmanDir, ".gitignore")
+	data, err := fsys.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("error reading .gitignore: %w", err)
+	}
+
+	content := string(data)
+	lines := strings.Split(content, "\n")
+	changed := false
+	for _, pattern := range patterns {
+		if containsLine(lines, pattern) {
+			continue
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += pattern + "\n"
+		lines = append(lines, pattern)
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := fsys.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("error writing .gitignore: %w", err)
+	}
+	return true, nil
+}
+
+// containsLine reports whether lines holds line, ignoring surrounding spaces
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneExternal clones external into dir and checks out its recorded commit
+func cloneExternal(fsys dotmanfs.FileSystem, cfg *config.Config, dir string, external manifest.External) error {
+	rt, err := newRemoteTransport(fsys, external.URL)
+	if err != nil {
+		return err
+	}
+
+	var repo *git.Repository
+	err = withRetry(cfg, "clone "+external.URL, func() error {
+		var err error
+		repo, err = git.Clone(newGitStorage(fsys, dir), dotmanfs.NewBillyFileSystem(fsys, dir, cfg.Perm()), &git.CloneOptions{
+			URL:          external.URL,
+			Auth:         rt.Auth,
+			ProxyOptions: rt.Proxy,
+		})
+		if err != nil {
+			// A failed attempt leaves a partial clone behind
+			fsys.RemoveAll(dir)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error cloning %s: %w", external.URL, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree of %s: %w", dir, err)
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(external.Commit)}); err != nil {
+		return fmt.Errorf("error checking out %s in %s: %w", external.Commit, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/noosxe/dotman/internal/checksum"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+// gcLooseObjects is the number of loose git objects from which gc --auto
+// packs them and du suggests it
+const gcLooseObjects = 1000
+
+// gcPruneExpiry is the age past which unreachable loose objects are deleted,
+// the default of git gc
+const gcPruneExpiry = 14 * 24 * time.Hour
+
+// defaultGCAge is the age past which gc archives journal entries and
+// compresses backups without --older-than, as when the daemon runs it
+const defaultGCAge = 90 * 24 * time.Hour
+
+var (
+	gcAuto      bool
+	gcOlderThan string
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Pack the repository and clean up the journal, backups and caches",
+	Long: `Run the maintenance a long-lived dotman directory needs, in one go:
+
+  - pack the loose git objects and delete the unreachable ones older than two
+    weeks, with git gc when git is installed, and go-git otherwise
+  - move the journal entries older than --older-than, 90 days by default, to
+    compressed archives, as 'dotman journal prune' does
+  - compress the backups of link made before then, and delete the backups
+    older than backup_retention when it is set
+  - drop the checksums of files that no longer exist from the checksum cache
+
+With --auto the git objects are only packed once there are more than 1000 of
+them, and nothing is printed when there was nothing to do. The daemon runs
+'dotman gc --auto' periodically.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age, err := config.ParseAge(gcOlderThan)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		result, err := runGC(fsys, cfg, gcAuto, age, time.Now())
+		if err != nil {
+			return err
+		}
+		if lines := result.summary(); len(lines) > 0 {
+			fmt.Println(strings.Join(lines, "\n"))
+		} else if !gcAuto {
+			fmt.Println("Nothing to clean up")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().BoolVar(&gcAuto, "auto", false, "only pack git objects when there are many loose ones, and stay quiet when there is nothing to do")
+	gcCmd.Flags().StringVar(&gcOlderThan, "older-than", "90d", "age past which journal entries are archived and backups compressed")
+}
+
+// gcResult is what a run of gc cleaned up
+type gcResult struct {
+	// Packed is whether the git objects were packed, LooseBefore and
+	// LooseAfter the number of loose objects before and after
+	Packed      bool
+	LooseBefore int
+	LooseAfter  int
+	// Pruned is the number of journal entries moved to Archive
+	Pruned     int
+	Archive    string
+	Compressed int
+	Expired    int
+	Checksums  int
+}
+
+// summary returns a line for everything the run cleaned up
+func (r *gcResult) summary() []string {
+	var lines []string
+	if r.Packed {
+		lines = append(lines, fmt.Sprintf("Packed git objects, %d loose objects left of %d", r.LooseAfter, r.LooseBefore))
+	}
+	if r.Pruned > 0 {
+		lines = append(lines, fmt.Sprintf("Moved %d journal entries to %s", r.Pruned, r.Archive))
+	}
+	if r.Compressed > 0 {
+		lines = append(lines, fmt.Sprintf("Compressed %d backups", r.Compressed))
+	}
+	if r.Expired > 0 {
+		lines = append(lines, fmt.Sprintf("Deleted %d expired backups", r.Expired))
+	}
+	if r.Checksums > 0 {
+		lines = append(lines, fmt.Sprintf("Dropped %d stale checksums", r.Checksums))
+	}
+	return lines
+}
+
+// runGC cleans up the repository of cfg, judging ages as of now: journal
+// entries and backups older than age are archived and compressed. With auto
+// the git objects are only packed once there are gcLooseObjects of them.
+func runGC(fsys dotmanfs.FileSystem, cfg *config.Config, auto bool, age time.Duration, now time.Time) (*gcResult, error) {
+	retention, err := cfg.BackupRetentionAge()
+	if err != nil {
+		return nil, err
+	}
+	result := &gcResult{}
+
+	gitDir := filepath.Join(cfg.DotmanDir, ".git")
+	if _, err := fsys.Stat(gitDir); err == nil {
+		result.LooseBefore = looseObjects(fsys, gitDir)
+		if !auto || result.LooseBefore >= gcLooseObjects {
+			if err := gcRepo(fsys, cfg.DotmanDir, now); err != nil {
+				return nil, err
+			}
+			result.Packed = true
+			result.LooseAfter = looseObjects(fsys, gitDir)
+		}
+	}
+
+	cutoff := now.Add(-age)
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	if result.Pruned, result.Archive, err = jm.Prune(cutoff); err != nil {
+		return nil, fmt.Errorf("error pruning journal: %w", err)
+	}
+	if result.Compressed, err = compressBackups(fsys, cfg, cutoff); err != nil {
+		return nil, err
+	}
+	if retention > 0 {
+		if result.Expired, err = expireBackups(fsys, cfg, now.Add(-retention)); err != nil {
+			return nil, err
+		}
+	}
+
+	cache, err := checksum.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	result.Checksums = cache.Prune()
+	if err := cache.Save(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// gcRepo packs the objects of the repository in dotmanDir and deletes the
+// unreachable loose objects older than gcPruneExpiry as of now. git gc does
+// it when the repository is on disk and git is installed, go-git otherwise.
+func gcRepo(fsys dotmanfs.FileSystem, dotmanDir string, now time.Time) error {
+	if _, ok := fsys.(*dotmanfs.OSFileSystem); ok && hasCommand("git") {
+		out, err := exec.Command("git", "--git-dir", filepath.Join(dotmanDir, ".git"), "gc", "--quiet").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git gc failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	repo, err := git.Open(newGitStorage(fsys, dotmanDir), nil)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	// Packing deletes the loose objects it packed, those left are
+	// unreachable from any ref
+	if err := repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		return fmt.Errorf("error packing git objects: %w", err)
+	}
+
+	// Staged files are only referenced by the index
+	staged := make(map[plumbing.Hash]bool)
+	if idx, err := repo.Storer.Index(); err == nil {
+		for _, entry := range idx.Entries {
+			staged[entry.Hash] = true
+		}
+	}
+	los, ok := repo.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return nil
+	}
+	err = repo.Prune(git.PruneOptions{
+		OnlyObjectsOlderThan: now.Add(-gcPruneExpiry),
+		Handler: func(hash plumbing.Hash) error {
+			if staged[hash] {
+				return nil
+			}
+			return los.DeleteLooseObject(hash)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error pruning git objects: %w", err)
+	}
+	return nil
+}
+
+// expireBackups deletes the backups of link made before cutoff, compressed
+// or not, and returns the number deleted
+func expireBackups(fsys dotmanfs.FileSystem, cfg *config.Config, cutoff time.Time) (int, error) {
+	root, err := backupRoot(fsys, cfg)
+	if err != nil {
+		return 0, err
+	}
+	infos, err := fsys.Readdir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error reading backups: %w", err)
+	}
+
+	expired := 0
+	for _, info := range infos {
+		made, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(info.Name(), ".tar.gz"), time.Local)
+		if err != nil || !made.Before(cutoff) {
+			continue
+		}
+		if err := fsys.RemoveAll(filepath.Join(root, info.Name())); err != nil {
+			return expired, fmt.Errorf("error removing expired backup: %w", err)
+		}
+		expired++
+	}
+	return expired, nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/noosxe/dotman/internal/checksum"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestRunGC(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.vimrc", "staged")
+	unreachable := storeBlob(t, repo, "unreachable")
+
+	// An expired backup, and the checksum of a file removed since
+	if err := cfg.Set("backup_retention", "365d"); err != nil {
+		t.Fatalf("failed to set backup_retention: %v", err)
+	}
+	cfg.BackupDir = "/mnt/backups"
+	fsys.MkdirAll(cfg.BackupDir, 0755)
+	fsys.WriteFile(filepath.Join(cfg.BackupDir, "20200101-120000.tar.gz"), []byte("backup"), 0644)
+	cache, _ := checksum.Load(fsys, dotmanDir)
+	removed := filepath.Join(dotmanDir, "data/.bashrc")
+	fsys.WriteFile(removed, []byte("bash"), 0644)
+	cache.Update(removed)
+	cache.Save()
+	fsys.Remove(removed)
+
+	// Nothing is packed below the threshold of --auto
+	result, err := runGC(fsys, cfg, true, defaultGCAge, time.Now())
+	if err != nil {
+		t.Fatalf("gc --auto failed: %v", err)
+	}
+	if result.Packed || result.LooseBefore == 0 {
+		t.Errorf("expected loose objects to be left alone, got %+v", result)
+	}
+	if result.Expired != 1 || result.Checksums != 1 {
+		t.Errorf("expected the backup and the checksum to be cleaned up, got %+v", result)
+	}
+
+	// Unreachable objects are only deleted once old enough
+	result, err = runGC(fsys, cfg, false, defaultGCAge, time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if !result.Packed || result.LooseAfter != 1 {
+		t.Errorf("expected only the staged blob to stay loose, got %+v", result)
+	}
+	if _, err := fsys.Stat(filepath.Join(cfg.BackupDir, "20200101-120000.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired backup to be deleted, got %v", err)
+	}
+
+	// The packed history is intact
+	repo, err = git.Open(newGitStorage(fsys, dotmanDir), nil)
+	if err != nil {
+		t.Fatalf("failed to open repository after gc: %v", err)
+	}
+	if _, err := repo.BlobObject(unreachable); err == nil {
+		t.Error("expected the unreachable blob to be deleted")
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to resolve HEAD: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to read HEAD commit after gc: %v", err)
+	}
+	if _, err := commit.File("data/.zshrc"); err != nil {
+		t.Errorf("expected data/.zshrc in HEAD after gc: %v", err)
+	}
+	if idx, err := repo.Storer.Index(); err != nil || len(idx.Entries) != 3 {
+		t.Fatalf("expected the index to be kept, got %v", err)
+	} else if _, err := repo.BlobObject(idx.Entries[1].Hash); err != nil {
+		t.Errorf("expected the staged blob of %s to be kept: %v", idx.Entries[1].Name, err)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var (
+	genDocsFormat string
+	genDocsDir    string
+)
+
+var genDocsCmd = &cobra.Command{
+	Use:    "gen-docs",
+	Short:  "Generate manual pages or markdown reference docs",
+	Long:   `Generate manual pages or markdown reference documentation for every command from the CLI help, e.g. for packaging.`,
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := genDocs(genDocsFormat, genDocsDir); err != nil {
+			return err
+		}
+		fmt.Printf("Generated %s docs in %s\n", genDocsFormat, genDocsDir)
+		return nil
+	},
+}
+
+// genDocs generates the docs of every command in format into dir
+func genDocs(format, dir string) error {
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Dates in generated docs would make packaged output differ between builds
+	rootCmd.DisableAutoGenTag = true
+	// The default config path is in the home directory of whoever builds
+	config := rootCmd.PersistentFlags().Lookup("config")
+	defValue := config.DefValue
+	config.DefValue = "~/.dotconfig"
+	defer func() { config.DefValue = defValue }()
+
+	switch format {
+	case "man":
+		header := &doc.GenManHeader{
+			Title:   "DOTMAN",
+			Section: "1",
+			Source:  "dotman",
+			Manual:  "dotman manual",
+		}
+		if err := doc.GenManTree(rootCmd, header, dir); err != nil {
+			return fmt.Errorf("failed to generate man pages: %w", err)
+		}
+	case "markdown":
+		if err := doc.GenMarkdownTree(rootCmd, dir); err != nil {
+			return fmt.Errorf("failed to generate markdown docs: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid format '%s'. Valid formats are: man, markdown", format)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(genDocsCmd)
+
+	genDocsCmd.Flags().StringVarP(&genDocsFormat, "format", "f", "man", "output format (man, markdown)")
+	genDocsCmd.Flags().StringVarP(&genDocsDir, "dir", "d", "docs", "output directory")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenDocs(t *testing.T) {
+	builderConfig := rootCmd.PersistentFlags().Lookup("config").DefValue
+
+	for format, page := range map[string]string{"man": "dotman-add.1", "markdown": "dotman_add.md"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := genDocs(format, dir); err != nil {
+				t.Fatalf("failed to generate %s docs: %v", format, err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, page))
+			if err != nil {
+				t.Fatalf("expected %s to be generated: %v", page, err)
+			}
+			if !strings.Contains(string(data), "~/.dotconfig") {
+				t.Errorf("expected the portable config default in %s", page)
+			}
+			if filepath.IsAbs(builderConfig) && strings.Contains(string(data), builderConfig) {
+				t.Errorf("expected %s not to contain the builder's config path %s", page, builderConfig)
+			}
+		})
+	}
+
+	if err := genDocs("html", t.TempDir()); err == nil {
+		t.Error("expected an unknown format to be refused")
+	}
+	if rootCmd.PersistentFlags().Lookup("config").DefValue != builderConfig {
+		t.Error("expected the config default to be restored")
+	}
+}
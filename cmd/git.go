@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// newGitStorage creates go-git object storage for the repository in dotmanDir.
+// The storage lives in the .git directory, while the worktree is dotmanDir itself.
+func newGitStorage(fsys dotmanfs.FileSystem, dotmanDir string) storage.Storer {
+	billyFs := dotmanfs.NewBillyFileSystem(fsys, filepath.Join(dotmanDir, ".git"), dotmanfs.Perm{})
+	return filesystem.NewStorage(billyFs, cache.NewObjectLRUDefault())
+}
+
+// stageOnly stages the changes below paths and nothing else, unstaging what
+// was staged before. It returns a function that, once the staged changes are
+// committed, stages the unstaged changes again.
+func stageOnly(repo *git.Repository, worktree *git.Worktree, paths []string) (func() error, error) {
+	saved, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	staged := slices.Clone(saved.Entries)
+
+	// Start from HEAD, or from nothing in a repository without commits
+	if _, err := repo.Head(); err == nil {
+		if err := worktree.Reset(&git.ResetOptions{Mode: git.MixedReset}); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		if err := repo.Storer.SetIndex(&index.Index{Version: saved.Version}); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		if _, err := worktree.Add(path); err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", path, err)
+		}
+	}
+
+	within := func(name string) bool {
+		return slices.ContainsFunc(paths, func(path string) bool {
+			return name == path || strings.HasPrefix(name, path+"/")
+		})
+	}
+	return func() error {
+		idx, err := repo.Storer.Index()
+		if err != nil {
+			return err
+		}
+		entries := slices.DeleteFunc(idx.Entries, func(e *index.Entry) bool { return !within(e.Name) })
+		for _, e := range staged {
+			if !within(e.Name) {
+				entries = append(entries, e)
+			}
+		}
+		slices.SortFunc(entries, func(a, b *index.Entry) int { return strings.Compare(a.Name, b.Name) })
+		idx.Entries = entries
+		return repo.Storer.SetIndex(idx)
+	}, nil
+}
+
+// stageRemoval removes path, or every entry below it when path is a directory,
+// from the index without touching the worktree
+func stageRemoval(repo *git.Repository, path string) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+	entries := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Name == path || strings.HasPrefix(e.Name, path+"/") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	idx.Entries = entries
+
+	return repo.Storer.SetIndex(idx)
+}
+
+// setOriginURL points the origin remote of repo at url, replacing any existing origin
+func setOriginURL(repo *git.Repository, url string) error {
+	if _, err := repo.Remote("origin"); err == nil {
+		if err := repo.DeleteRemote("origin"); err != nil {
+			return err
+		}
+	}
+
+	_, err := repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	return err
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"golang.org/x/term"
+)
+
+// promptInput is where a missing git identity is read from, replaced in tests
+var promptInput io.Reader = os.Stdin
+
+// isInteractive reports whether stdin is a terminal to ask on, replaced in
+// tests. /dev/null is a character device too, as under cron or systemd, so
+// only a real terminal counts.
+var isInteractive = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// parseAuthor parses an --author value of the form "Name <email>"
+func parseAuthor(author string) (string, string, error) {
+	addr, err := mail.ParseAddress(author)
+	if err != nil || addr.Name == "" {
+		return "", "", fmt.Errorf("invalid author %q, expected \"Name <email>\"", author)
+	}
+	return addr.Name, addr.Address, nil
+}
+
+// gitIdentity returns the signature dotman commits and tags with. It is taken
+// from --author when given, otherwise from git_user_name and git_user_email,
+// falling back to user.name and user.email from git config. Whatever is still
+// missing is asked for on a terminal and saved to the config file, so it is
+// only asked once.
+func gitIdentity(fsys dotmanfs.FileSystem, cfg *config.Config, repo *git.Repository, author string) (*object.Signature, error) {
+	if author != "" {
+		name, email, err := parseAuthor(author)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Signature{Name: name, Email: email, When: time.Now()}, nil
+	}
+
+	name, email := cfg.GitUserName, cfg.GitUserEmail
+	if name == "" || email == "" {
+		gitCfg, err := repo.ConfigScoped(gitconfig.GlobalScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get git config: %w", err)
+		}
+		if name == "" {
+			name = gitCfg.User.Name
+		}
+		if email == "" {
+			email = gitCfg.User.Email
+		}
+	}
+
+	if name == "" || email == "" {
+		if !isInteractive() {
+			return nil, fmt.Errorf("no git identity to commit with: pass --author, set git_user_name and git_user_email with \"dotman config set\", or set user.name and user.email in git config")
+		}
+
+		var err error
+		if name, email, err = promptIdentity(name, email); err != nil {
+			return nil, err
+		}
+		if err := saveIdentity(fsys, cfg, name, email); err != nil {
+			return nil, err
+		}
+	}
+
+	return &object.Signature{Name: name, Email: email, When: time.Now()}, nil
+}
+
+// promptIdentity asks for the name and email that are missing
+func promptIdentity(name, email string) (string, string, error) {
+	out := terminalOutput()
+	fmt.Fprintln(out, "dotman needs a name and email to commit with.")
+	reader := bufio.NewReader(promptInput)
+
+	for name == "" {
+		fmt.Fprint(out, "Name: ")
+		line, err := reader.ReadString('\n')
+		name = strings.TrimSpace(line)
+		if err != nil && name == "" {
+			return "", "", fmt.Errorf("no git identity given")
+		}
+	}
+	for email == "" {
+		fmt.Fprint(out, "Email: ")
+		line, err := reader.ReadString('\n')
+		email = strings.TrimSpace(line)
+		if err != nil && email == "" {
+			return "", "", fmt.Errorf("no git identity given")
+		}
+	}
+	return name, email, nil
+}
+
+// saveIdentity records the identity in cfg and in the config file
+func saveIdentity(fsys dotmanfs.FileSystem, cfg *config.Config, name, email string) error {
+	if err := cfg.Set("git_user_name", name); err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+	if err := cfg.Set("git_user_email", email); err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+
+	// Write the file as it is on disk, not the resolved settings
+	fileCfg, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	fileCfg.GitUserName = name
+	fileCfg.GitUserEmail = email
+	if err := config.SaveConfig(configPath, fileCfg, fsys); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+
+	fmt.Printf("Saved %s <%s> as git_user_name and git_user_email\n", name, email)
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestGitIdentity(t *testing.T) {
+	// Keep the user's git config out of the test
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	mockFS, dotmanDir, err := testutil.NewMockFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	oldFsys, oldConfigPath, oldInput, oldInteractive := fsys, configPath, promptInput, isInteractive
+	fsys, configPath = mockFS, filepath.Join(testutil.TestHomeDir, ".dotconfig")
+	defer func() {
+		fsys, configPath, promptInput, isInteractive = oldFsys, oldConfigPath, oldInput, oldInteractive
+	}()
+
+	repo, _, _ := testutil.SetupTestGitRepo(t, mockFS, dotmanDir)
+	cfg := &config.Config{DotmanDir: dotmanDir}
+
+	// --author wins
+	signature, err := gitIdentity(mockFS, cfg, repo, "Jane Doe <jane@example.com>")
+	if err != nil {
+		t.Fatalf("gitIdentity failed: %v", err)
+	}
+	if signature.Name != "Jane Doe" || signature.Email != "jane@example.com" {
+		t.Errorf("unexpected signature %s <%s>", signature.Name, signature.Email)
+	}
+	if _, err := gitIdentity(mockFS, cfg, repo, "jane@example.com"); err == nil {
+		t.Error("expected an author without a name to be rejected")
+	}
+
+	// Without a terminal a missing identity is an error, not an empty author
+	isInteractive = func() bool { return false }
+	if _, err := gitIdentity(mockFS, cfg, repo, ""); err == nil || !strings.Contains(err.Error(), "no git identity") {
+		t.Fatalf("expected missing identity error, got %v", err)
+	}
+
+	// On a terminal it is asked for and saved for future commits
+	isInteractive = func() bool { return true }
+	promptInput = strings.NewReader("\nJane Doe\njane@example.com\n")
+	signature, err = gitIdentity(mockFS, cfg, repo, "")
+	if err != nil {
+		t.Fatalf("gitIdentity failed: %v", err)
+	}
+	if signature.Name != "Jane Doe" || signature.Email != "jane@example.com" {
+		t.Errorf("unexpected signature %s <%s>", signature.Name, signature.Email)
+	}
+	saved, err := config.ReadConfig(configPath, mockFS)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if saved.GitUserName != "Jane Doe" || saved.GitUserEmail != "jane@example.com" {
+		t.Errorf("expected the identity to be saved, got %q <%s>", saved.GitUserName, saved.GitUserEmail)
+	}
+
+	// The saved identity is used without asking again
+	isInteractive = func() bool { return false }
+	if _, err := gitIdentity(mockFS, saved, repo, ""); err != nil {
+		t.Fatalf("expected the saved identity to be used: %v", err)
+	}
+}
+
+func TestIsInteractive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", os.DevNull, err)
+	}
+	defer null.Close()
+	oldStdin := os.Stdin
+	os.Stdin = null
+	defer func() { os.Stdin = oldStdin }()
+
+	// /dev/null is a character device but no terminal
+	if isInteractive() {
+		t.Error("expected /dev/null not to count as a terminal")
+	}
+
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+	repo, _, _ := testutil.SetupTestGitRepo(t, memFS, dotmanDir)
+	if _, err := gitIdentity(memFS, &config.Config{DotmanDir: dotmanDir}, repo, ""); err == nil || !strings.Contains(err.Error(), "pass --author") {
+		t.Errorf("expected guidance on setting an identity, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Summarize the repository and environment",
+	Long: `Print what dotman runs with on this machine: its version and platform, the
+config file, the dotman directory and active profile, the git branch and
+remote, the number of tracked entries, the journal entries by state and the
+disk space taken by the copies and the journal, which 'dotman du' breaks down.
+
+The output is meant to be pasted into bug reports. Parts that cannot be read
+are reported as such instead of failing the command.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		printInfo(os.Stdout, collectInfo(fsys, cfg))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+}
+
+// infoLine is a labelled value of the info screen
+type infoLine struct {
+	label string
+	value string
+}
+
+// collectInfo gathers the info screen of the repository of cfg. Values that
+// cannot be read say why.
+func collectInfo(fsys dotmanfs.FileSystem, cfg *config.Config) []infoLine {
+	build := version.Get()
+	profile, _ := cfg.CurrentProfile()
+	lines := []infoLine{
+		{"Version", fmt.Sprintf("%s (commit %s, built %s)", build.Version, build.Commit, build.Date)},
+		{"Platform", fmt.Sprintf("%s/%s, %s", runtime.GOOS, runtime.GOARCH, build.GoVersion)},
+		{"Config", configPath},
+		{"Profile", profile},
+		{"Dotman dir", cfg.DotmanDir},
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return append(lines, infoLine{"Manifest", fmt.Sprintf("unreadable: %v", err)})
+	}
+
+	backendName := manifest.BackendSymlink
+	if m.InPlace() {
+		backendName = manifest.BackendWorktree
+	}
+	lines = append(lines, infoLine{"Backend", fmt.Sprintf("%s, linked by %s", backendName, newLinker(fsys, cfg, m).mode())})
+
+	branch, remote := infoGit(fsys, cfg.DotmanDir, m)
+	lines = append(lines, infoLine{"Branch", branch}, infoLine{"Remote", remote})
+
+	system := 0
+	for _, entry := range m.Entries {
+		if entry.IsSystem() {
+			system++
+		}
+	}
+	lines = append(lines, infoLine{"Entries", fmt.Sprintf("%d tracked, %d system", len(m.Entries), system)})
+	lines = append(lines, infoLine{"Journal", infoJournal(fsys, cfg)})
+
+	var dirs []string
+	for _, dir := range m.Layout.Dirs() {
+		dirs = append(dirs, dir+"/")
+	}
+	dataSize := diskUsage(fsys, m.Layout.HomeDir(cfg.DotmanDir)) + diskUsage(fsys, m.Layout.SystemDir(cfg.DotmanDir))
+	lines = append(lines,
+		infoLine{"Data size", fmt.Sprintf("%s in %s", config.FormatSize(dataSize), strings.Join(dirs, ", "))},
+		infoLine{"Journal size", config.FormatSize(diskUsage(fsys, cfg.JournalPath(cfg.DotmanDir)))},
+	)
+
+	return lines
+}
+
+// infoGit returns the checked out branch and the origin remote of the
+// repository in dotmanDir
+func infoGit(fsys dotmanfs.FileSystem, dotmanDir string, m *manifest.Manifest) (branch, remote string) {
+	b, err := newBackend(fsys, dotmanDir, m, dotmanfs.Perm{})
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err), "unknown"
+	}
+	repo, err := openRepo(fsys, dotmanDir, b)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err), "unknown"
+	}
+
+	branch = "none"
+	if head, err := repo.Head(); err == nil {
+		branch = head.Name().Short()
+	}
+	remote = "none"
+	if origin, err := repo.Remote("origin"); err == nil && len(origin.Config().URLs) > 0 {
+		remote = origin.Config().URLs[0]
+	}
+	return branch, remote
+}
+
+// infoJournal returns the number of journal entries by state
+func infoJournal(fsys dotmanfs.FileSystem, cfg *config.Config) string {
+	records, err := newJournalManager(fsys, cfg, cfg.DotmanDir).Index()
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err)
+	}
+
+	counts := make(map[journal.EntryState]int)
+	for _, record := range records {
+		counts[record.State]++
+	}
+	return fmt.Sprintf("%d completed, %d failed, %d current",
+		counts[journal.EntryStateCompleted], counts[journal.EntryStateFailed], counts[journal.EntryStateCurrent])
+}
+
+// diskUsage returns the size of the files below dir, not following symlinks.
+// A missing dir takes no space.
+func diskUsage(fsys dotmanfs.FileSystem, dir string) int64 {
+	var size int64
+	fsys.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// printInfo prints the info screen as aligned columns
+func printInfo(w io.Writer, lines []infoLine) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, line := range lines {
+		fmt.Fprintf(tw, "%s:\t%s\n", line.label, line.value)
+	}
+	tw.Flush()
+}
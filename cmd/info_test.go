@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestCollectInfo(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/dotfiles.git"}}); err != nil {
+		t.Fatalf("failed to create remote: %v", err)
+	}
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":"/etc/hosts","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	entry, err := jm.CreateEntry(journal.OperationTypeLink, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := jm.MoveEntry(entry, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+	if _, err := jm.CreateEntry(journal.OperationTypeAdd, "", ""); err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range collectInfo(fsys, cfg) {
+		values[line.label] = line.value
+	}
+	expected := map[string]string{
+		"Dotman dir": dotmanDir,
+		"Profile":    "default",
+		"Backend":    "symlink, linked by symlink",
+		"Branch":     "main",
+		"Remote":     "https://example.com/dotfiles.git",
+		"Entries":    "2 tracked, 1 system",
+		"Journal":    "1 completed, 0 failed, 1 current",
+		"Data size":  "3 B in data/, system/",
+	}
+	for label, value := range expected {
+		if values[label] != value {
+			t.Errorf("expected %s to be %q, got %q", label, value, values[label])
+		}
+	}
+
+	var out bytes.Buffer
+	printInfo(&out, []infoLine{{"Branch", "main"}, {"Dotman dir", dotmanDir}})
+	if !strings.Contains(out.String(), "Branch:      main\n") {
+		t.Errorf("expected aligned columns, got %q", out.String())
+	}
+}
@@ -1,169 +1,938 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
-	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	dotmanconfig "github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/exclude"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/machines"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/noosxe/dotman/internal/store"
 	"github.com/spf13/cobra"
 )
 
 var (
-	force bool
-	dir   string
+	force        bool
+	wipe         bool
+	dir          string
+	cloneURL     string
+	templateRepo string
+	initAuthor   string
+	initLayout   manifest.Layout
+	initWorktree bool
+	initRelease  string
+	initSigners  string
 )
 
+// dotmanGitignore is the part of .gitignore dotman relies on
+const dotmanGitignore = `# dotman specific
+journal/
+config.json
+.offload/
+`
+
+// forceKeeps are the entries init --force keeps in place, unless --wipe is
+// given: the repository with its unpushed commits, the journal, the manifest
+// and what its entries point into, the content store, the offload store and
+// the machine records. The directories holding the tracked files are kept
+// too, see keptEntries. Only the scaffolding around them is regenerated.
+var forceKeeps = []string{".git", "journal", ".manfile", store.Dir, offload.Dir, machines.Dir}
+
+// initOperation represents the state of creating or cloning a dotman directory
+type initOperation struct {
+	config *dotmanconfig.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	dir   string
+	force bool
+	// replace the whole directory with --force, not only its files
+	wipe bool
+	// repository to clone instead of creating a new one
+	cloneURL string
+	// repository whose files a new one starts from
+	template string
+	// "Name <email>" to commit as instead of the configured identity
+	author string
+	// where the new repository keeps the copies, from --data-dir and
+	// --system-dir or the template's manifest
+	layout manifest.Layout
+	// track the dotfiles in place with the worktree backend
+	inPlace bool
+	// release a clone starts at, latest for the newest one, instead of the
+	// default branch
+	release string
+
+	repo *git.Repository
+	// how the new repository holds the entries, once it is created
+	backend backend
+
+	// where --force moved what it replaced, and the entries it moved
+	backup   string
+	backedUp []string
+	// the existing repository was kept by --force
+	keptRepo bool
+}
+
 // isDotmanDir checks if a directory is a dotman directory by checking for .manfile
-func isDotmanDir(path string) bool {
+func isDotmanDir(fsys dotmanfs.FileSystem, path string) bool {
 	manfile := filepath.Join(path, ".manfile")
-	_, err := os.Stat(manfile)
+	_, err := fsys.Stat(manfile)
 	return err == nil
 }
 
+// selectedProfile returns the profile chosen with --profile, DOTMAN_PROFILE or
+// the config file, if it is not the default one
+func selectedProfile(cfg *dotmanconfig.Config) (string, bool) {
+	name := os.Getenv("DOTMAN_PROFILE")
+	if name == "" {
+		name = cfg.ActiveProfile
+	}
+	if name == "" || name == dotmanconfig.DefaultProfile {
+		return "", false
+	}
+	return name, true
+}
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize dotman in the current directory",
 	Long: `Initialize dotman in the current directory by creating necessary
-configuration files and directory structure.`,
+configuration files and directory structure.
+
+Use --clone to start from an existing dotman repository instead, e.g. the one
+you push to from another machine, then run "dotman link" to link its files.
+Add --release to start at a release rather than the default branch, see
+"dotman release". Linking a clone runs code from it, such as shell startup
+files, so --allowed-signers can name an ssh-keygen allowed signers file the
+HEAD commit must have a valid SSH signature by, as git verifies commits
+signed with gpg.format ssh. A clone that fails the check is removed, and
+link checks every later HEAD against the file too.
+
+Use --from-template to start a new repository from the files of a template
+repository, such as hooks, a manifest skeleton and a README. The template's
+history is not kept.
+
+Use --data-dir and --system-dir to keep the copies of tracked files somewhere
+else than data/ and system/, such as home and root or dotfiles/home. The
+layout is recorded in the manifest, so every clone finds the copies.
+
+Use --worktree to track dotfiles where they are instead, with the home
+directory as the worktree of the git repository, like yadm. Nothing is
+copied or replaced with a symlink: add, commit and status work on the files
+in the home directory, of which git only sees the tracked ones. The dotman
+directory has to be inside the home directory, and system files cannot be
+tracked.
+
+With --force an existing directory is reinitialized. It keeps its git
+repository with any unpushed commits, the manifest and the directories
+holding the tracked files, the journal, the content store, the offloaded
+files and the machine records. Everything else, like .gitignore, is moved to
+a timestamped backup next to it, or in backup_dir when set, and the
+scaffolding is generated anew. Add --wipe to move the whole directory to the backup and
+start over. On a terminal, dotman asks before doing either unless --yes is
+given.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			fmt.Println("Initializing dotman...")
 		}
 
-		// Check if directory exists
-		info, err := os.Stat(dir)
-		if err == nil {
-			if !info.IsDir() {
-				fmt.Printf("Error: %s exists but is not a directory\n", dir)
-				os.Exit(1)
+		if wipe && !force {
+			fmt.Println("Error: --wipe requires --force")
+			exit(1)
+		}
+
+		if err := initLayout.Validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		if initWorktree && force && !wipe {
+			fmt.Println("Error: the kept repository tracks copies, add --wipe to start over with --worktree")
+			exit(1)
+		}
+		if initRelease != "" && cloneURL == "" {
+			fmt.Println("Error: --release picks the release a clone starts at, it needs --clone")
+			exit(1)
+		}
+		if cloneURL != "" && initLayout != (manifest.Layout{}) {
+			fmt.Println("Error: a clone keeps the layout of the cloned repository, --data-dir and --system-dir cannot be used with --clone")
+			exit(1)
+		}
+
+		cfg, err := readConfigFile()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			exit(1)
+		}
+		if initSigners != "" {
+			if err := cfg.Set("allowed_signers", initSigners); err != nil {
+				fmt.Printf("Error: --allowed-signers %v\n", err)
+				exit(1)
 			}
+		}
 
-			if isDotmanDir(dir) && !force {
-				fmt.Printf("Error: %s is already a dotman directory. Use --force to overwrite\n", dir)
-				os.Exit(1)
+		// A profile initializes its own directory unless --dir is given
+		if profileName, ok := selectedProfile(cfg); ok && !cmd.Flags().Changed("dir") {
+			if profile, exists := cfg.Profiles[profileName]; exists {
+				dir = profile.DotmanDir
 			}
+		}
+
+		op := &initOperation{
+			config:   cfg,
+			fsys:     fsys,
+			ctx:      context.Background(),
+			dir:      dir,
+			force:    force,
+			wipe:     wipe,
+			cloneURL: cloneURL,
+			template: templateRepo,
+			author:   initAuthor,
+			layout:   initLayout,
+			inPlace:  initWorktree,
+			release:  initRelease,
+		}
 
-			if !force {
-				fmt.Printf("Error: %s already exists. Use --force to overwrite\n", dir)
-				os.Exit(1)
+		if force {
+			prompt := fmt.Sprintf("Reinitialize %s? Everything but its git repository, manifest, tracked files and journal is moved to a backup.", dir)
+			if wipe {
+				prompt = fmt.Sprintf("Move all of %s to a backup and start over?", dir)
 			}
+			if !confirmDestructive(prompt) {
+				fmt.Println("Aborted")
+				exit(1)
+			}
+		}
+
+		err = op.run()
+		if op.backup != "" {
+			fmt.Printf("Moved the previous contents of %s to %s\n", dir, op.backup)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
 
-			if verbose {
-				fmt.Printf("Force flag used, deleting existing directory: %s\n", dir)
+		// Save dotman directory to the selected profile, or to the top-level config
+		if profileName, ok := selectedProfile(cfg); ok {
+			profile := cfg.Profiles[profileName]
+			profile.DotmanDir = dir
+			if err := cfg.AddProfile(profileName, profile); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exit(1)
 			}
 
-			// Remove existing directory if force is true
-			if err := os.RemoveAll(dir); err != nil {
-				fmt.Printf("Error removing directory: %v\n", err)
-				os.Exit(1)
+			// A clone keeps the origin it was cloned from
+			if profile.Remote != "" && cloneURL == "" {
+				if err := setOriginURL(op.repo, profile.Remote); err != nil {
+					fmt.Printf("Error setting remote: %v\n", err)
+					exit(1)
+				}
 			}
+		} else {
+			cfg.DotmanDir = dir
+		}
+
+		if err := dotmanconfig.SaveConfig(configPath, cfg, fsys); err != nil {
+			fmt.Printf("Error saving config: %v\n", err)
+			exit(1)
+		}
+
+		fmt.Printf("dotman initialized in %s\n", dir)
+		if cloneURL != "" {
+			fmt.Println("Run \"dotman link\" to link the cloned dotfiles into your home directory.")
+		}
+	},
+}
+
+func (op *initOperation) run() error {
+	if err := op.prepare(); err != nil {
+		return err
+	}
+
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.recordBackup(); err != nil {
+		return err
+	}
+
+	if op.cloneURL != "" {
+		if err := op.clone(); err != nil {
+			return err
+		}
+	} else if err := op.create(); err != nil {
+		return err
+	}
+
+	return op.complete()
+}
+
+// prepare checks that the directory can be initialized, removing it when
+// --force is given. A directory holding nothing but the journal of an earlier
+// init that failed is reused, so the failed attempt stays in its history.
+func (op *initOperation) prepare() error {
+	// The manifest is tracked along with the dotfiles, below the home directory
+	if op.inPlace {
+		homeDir, err := op.fsys.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("error getting user home directory: %w", err)
+		}
+		absDir, err := op.fsys.Abs(op.dir)
+		if err != nil {
+			return fmt.Errorf("error getting absolute path: %w", err)
+		}
+		if _, err := homeRel(homeDir, absDir); err != nil {
+			return err
+		}
+	}
+
+	info, err := op.fsys.Stat(op.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking %s: %w", op.dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s exists but is not a directory", op.dir)
+	}
+
+	if !op.force {
+		if isDotmanDir(op.fsys, op.dir) {
+			return fmt.Errorf("%s is already a dotman directory. Use --force to overwrite", op.dir)
+		}
+		if op.onlyJournal() {
+			return nil
+		}
+		return fmt.Errorf("%s already exists. Use --force to overwrite", op.dir)
+	}
+
+	return op.backUp()
+}
+
+// backUp moves what --force replaces to a timestamped backup next to the
+// directory, or in backup_dir: everything but forceKeeps, or the whole
+// directory with --wipe
+func (op *initOperation) backUp() error {
+	base := fmt.Sprintf("%s.backup-%s", filepath.Clean(op.dir), time.Now().Format("20060102-150405"))
+	if op.config.BackupDir != "" {
+		base = filepath.Join(op.config.BackupDir, filepath.Base(base))
+		if err := op.fsys.MkdirAll(op.config.BackupDir, op.config.DirPerm()); err != nil {
+			return fmt.Errorf("error creating backup directory: %w", err)
+		}
+	}
+	backup := base
+	for i := 2; ; i++ {
+		if _, err := op.fsys.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	if op.wipe {
+		if verbose {
+			fmt.Printf("Wipe flag used, moving existing directory to %s\n", backup)
+		}
+		if err := moveAside(op.fsys, op.dir, backup, op.config.Perm()); err != nil {
+			return fmt.Errorf("error moving %s to %s: %w", op.dir, backup, err)
+		}
+		op.backup = backup
+		op.backedUp = []string{filepath.Base(op.dir)}
+		return nil
+	}
+
+	// A clone or template brings its own repository
+	if _, err := op.fsys.Stat(filepath.Join(op.dir, ".git")); err == nil {
+		if op.cloneURL != "" || op.template != "" {
+			return fmt.Errorf("%s has a git repository, which --force keeps. Add --wipe to replace it", op.dir)
+		}
+		op.keptRepo = true
+	}
 
-			if verbose {
-				fmt.Printf("Directory deleted successfully: %s\n", dir)
+	entries, err := op.fsys.Readdir(op.dir)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", op.dir, err)
+	}
+	keeps := op.keptEntries()
+	for _, entry := range entries {
+		if slices.Contains(keeps, entry.Name()) {
+			continue
+		}
+		if op.backup == "" {
+			if err := op.fsys.MkdirAll(backup, op.config.DirPerm()); err != nil {
+				return fmt.Errorf("error creating backup directory: %w", err)
 			}
+			op.backup = backup
+		}
+		if err := moveAside(op.fsys, filepath.Join(op.dir, entry.Name()), filepath.Join(backup, entry.Name()), op.config.Perm()); err != nil {
+			return fmt.Errorf("error moving %s to %s: %w", entry.Name(), backup, err)
 		}
+		op.backedUp = append(op.backedUp, entry.Name())
+	}
+
+	if verbose && op.backup != "" {
+		fmt.Printf("Force flag used, moved %d entries of %s to %s\n", len(op.backedUp), op.dir, op.backup)
+	}
+	return nil
+}
+
+// moveAside moves src to dst. When it cannot be renamed, as when backup_dir
+// is on another filesystem, it is copied within perm, the copy verified and
+// only then src removed.
+func moveAside(fsys dotmanfs.FileSystem, src, dst string, perm dotmanfs.Perm) error {
+	if err := fsys.Rename(src, dst); err == nil {
+		return nil
+	}
+	info, err := fsys.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		err = dotmanfs.CopyDir(fsys, src, dst, dotmanfs.CopyOptions{Perm: perm})
+		if err == nil {
+			err = dotmanfs.VerifyDir(fsys, src, dst, dotmanfs.CopyOptions{})
+		}
+	case info.Mode()&os.ModeSymlink != 0:
+		err = dotmanfs.CopySymlink(fsys, src, dst)
+	default:
+		err = dotmanfs.CopyFile(fsys, src, dst, perm)
+		if err == nil {
+			err = dotmanfs.VerifyFile(fsys, src, dst)
+		}
+	}
+	if err != nil {
+		fsys.RemoveAll(dst)
+		return err
+	}
+	return fsys.RemoveAll(src)
+}
+
+// recordBackup records in the journal what --force moved to the backup. The
+// move happens before the journal exists, the journal itself may be moved.
+func (op *initOperation) recordBackup() error {
+	if op.backup == "" {
+		return nil
+	}
+	return op.step(journal.StepTypeMove, "Back up existing directory", op.backup, func() (string, error) {
+		return fmt.Sprintf("Moved %s", strings.Join(op.backedUp, ", ")), nil
+	})
+}
 
-		// Create directory
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Printf("Error creating directory: %v\n", err)
-			os.Exit(1)
+// onlyJournal reports whether the directory holds nothing but a journal
+func (op *initOperation) onlyJournal() bool {
+	entries, err := op.fsys.Readdir(op.dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Name() != "journal" {
+			return false
 		}
+	}
+	return true
+}
 
-		// Create data directory
-		dataDir := filepath.Join(dir, "data")
-		if err := os.MkdirAll(dataDir, 0755); err != nil {
-			fmt.Printf("Error creating data directory: %v\n", err)
-			os.Exit(1)
+// clearDir removes everything in the directory but the journal and what
+// --force kept, undoing a clone that failed or was refused
+func (op *initOperation) clearDir() {
+	entries, err := op.fsys.Readdir(op.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != "journal" && !(op.force && !op.wipe && slices.Contains(op.keptEntries(), entry.Name())) {
+			op.fsys.RemoveAll(filepath.Join(op.dir, entry.Name()))
 		}
+	}
+}
+
+func (op *initOperation) initialize() error {
+	// The journal lives in the directory being initialized
+	jm := newJournalManager(op.fsys, op.config, op.dir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	source := op.cloneURL
+	if source == "" {
+		source = op.template
+	}
+	entry, err := jm.CreateEntry(journal.OperationTypeInit, source, op.dir)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// step runs fn as a journaled step, failing the entry when it fails. fn
+// returns the details recorded with the completed step.
+func (op *initOperation) step(stepType journal.StepType, description, target string, fn func() (string, error)) error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, stepType, description, "", target)
+	if err != nil {
+		return fmt.Errorf("failed to add step: %w", err)
+	}
+
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
 
-		// Create .manfile
-		manfile := filepath.Join(dir, ".manfile")
-		if err := os.WriteFile(manfile, []byte("{}"), 0644); err != nil {
-			fmt.Printf("Error creating .manfile: %v\n", err)
-			os.Exit(1)
+	details, err := fn()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
 		}
+		return err
+	}
 
-		// Create .gitignore
-		gitignore := filepath.Join(dir, ".gitignore")
-		gitignoreContent := `# dotman specific
-journal/
-config.json
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
 
-# Common patterns
-*.swp
-*.swo
-*~
-.DS_Store
-`
-		if err := os.WriteFile(gitignore, []byte(gitignoreContent), 0644); err != nil {
-			fmt.Printf("Error creating .gitignore: %v\n", err)
-			os.Exit(1)
+// clone clones an existing dotman repository into the directory
+func (op *initOperation) clone() error {
+	err := op.step(journal.StepTypeGit, "Clone repository", op.dir, func() (string, error) {
+		repo, err := op.cloneRepo(op.cloneURL)
+		if err != nil {
+			return "", err
+		}
+		op.repo = repo
+		return fmt.Sprintf("Cloned %s", op.cloneURL), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = op.step(journal.StepTypeVerify, "Verify dotman repository", op.dir, func() (string, error) {
+		if !isDotmanDir(op.fsys, op.dir) {
+			op.clearDir()
+			return "", fmt.Errorf("%s is not a dotman repository, it has no .manfile", op.cloneURL)
 		}
+		return "Found .manfile", nil
+	})
+	if err != nil {
+		return err
+	}
 
-		repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
-			Bare: false,
-			InitOptions: git.InitOptions{
-				DefaultBranch: "refs/heads/main",
-			},
+	if op.release != "" {
+		err = op.step(journal.StepTypeGit, "Check out release", op.dir, func() (string, error) {
+			b, err := loadBackend(op.fsys, op.dir, op.config.Perm())
+			if err != nil {
+				return "", err
+			}
+			release, err := findRelease(op.repo, op.release)
+			if err != nil {
+				return "", err
+			}
+			if _, err := checkoutCommit(op.fsys, op.repo, b, release.Hash, op.config.Perm()); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Checked out release %s at %s", release.Name, release.Hash), nil
 		})
+		if err != nil {
+			return err
+		}
+	}
 
+	// What a clone links, such as shell startup files and externals, runs
+	// code from the repository, so an unsigned one goes before it is used
+	if op.config.AllowedSigners != "" {
+		err = op.step(journal.StepTypeVerify, "Verify signature of HEAD", op.dir, func() (string, error) {
+			head, err := op.repo.Head()
+			if err != nil {
+				return "", fmt.Errorf("error reading HEAD: %w", err)
+			}
+			details, err := verifySignature(op.repo, head.Hash(), op.config.AllowedSigners)
+			if err != nil {
+				op.clearDir()
+				return "", err
+			}
+			return details, nil
+		})
 		if err != nil {
-			fmt.Printf("Error initializing git repository: %v\n", err)
-			os.Exit(1)
+			return err
 		}
+	}
 
-		if verbose {
-			fmt.Printf("Git repository initialized successfully: %s\n", dir)
+	// git does not keep empty directories
+	if err := op.existingLayout(); err != nil {
+		return err
+	}
+
+	if err := op.mkdirData(); err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Printf("Cloned %s into %s\n", op.cloneURL, op.dir)
+	}
+	return nil
+}
+
+// cloneRepo clones the repository at url into the directory, retrying while
+// the remote cannot be reached
+func (op *initOperation) cloneRepo(url string) (*git.Repository, error) {
+	rt, err := newRemoteTransport(op.fsys, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo *git.Repository
+	err = withRetry(op.config, "clone "+url, func() error {
+		var err error
+		repo, err = git.Clone(newGitStorage(op.fsys, op.dir), dotmanfs.NewBillyFileSystem(op.fsys, op.dir, op.config.Perm()), &git.CloneOptions{
+			URL:          url,
+			Auth:         rt.Auth,
+			ProxyOptions: rt.Proxy,
+			NoCheckout:   true,
+		})
+		if err == nil {
+			err = checkoutHead(repo)
+		}
+		if err != nil {
+			// A failed attempt leaves a partial clone behind
+			op.clearDir()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error cloning %s: %w", url, err)
+	}
+	return repo, nil
+}
+
+// checkoutHead checks out the files of HEAD. A full checkout would remove the
+// journal, which is already in the directory and not part of HEAD.
+func checkoutHead(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error reading HEAD: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("error reading HEAD commit: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("error reading HEAD tree: %w", err)
+	}
+
+	var files []string
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error listing HEAD files: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree: %w", err)
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset, Files: files}); err != nil {
+		return fmt.Errorf("error checking out %s: %w", head.Name().Short(), err)
+	}
+	return nil
+}
+
+// create creates a new dotman repository in the directory, starting from the
+// files of the template when one is given
+func (op *initOperation) create() error {
+	if op.template != "" {
+		err := op.step(journal.StepTypeGit, "Copy template", op.dir, func() (string, error) {
+			if _, err := op.cloneRepo(op.template); err != nil {
+				return "", err
+			}
+			// Only the files are kept, the new repository starts its own history
+			if err := op.fsys.RemoveAll(filepath.Join(op.dir, ".git")); err != nil {
+				return "", fmt.Errorf("error removing template history: %w", err)
+			}
+			return fmt.Sprintf("Copied the files of %s", op.template), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := op.existingLayout(); err != nil {
+		return err
+	}
+
+	// Entries tracked in place need neither a data directory nor a
+	// .gitignore, git only sees them and the manifest
+	if !op.inPlace {
+		if err := op.mkdirData(); err != nil {
+			return err
+		}
+	}
+
+	if err := op.writeManfile(); err != nil {
+		return err
+	}
+
+	if !op.inPlace {
+		if err := op.writeGitignore(); err != nil {
+			return err
+		}
+	}
+
+	if err := op.gitInit(); err != nil {
+		return err
+	}
+
+	return op.initialCommit()
+}
+
+// keptEntries returns the entries of the directory --force keeps: forceKeeps
+// and the top directories holding the tracked files, by the layout of the
+// manifest being kept. A clone or template brings its own manifest and
+// files, only the journal is kept for it.
+func (op *initOperation) keptEntries() []string {
+	if op.cloneURL != "" || op.template != "" {
+		return []string{"journal"}
+	}
+	var layout manifest.Layout
+	if m, err := manifest.Load(op.fsys, op.dir); err == nil {
+		layout = m.Layout
+	}
+	keeps := slices.Clone(forceKeeps)
+	for _, dir := range layout.Dirs() {
+		top, _, _ := strings.Cut(dir, "/")
+		if !slices.Contains(keeps, top) {
+			keeps = append(keeps, top)
+		}
+	}
+	return keeps
+}
+
+// existingLayout takes the layout of the manifest already in the directory,
+// the template's, the clone's or the one --force kept, when no other was
+// asked for
+func (op *initOperation) existingLayout() error {
+	if op.layout != (manifest.Layout{}) {
+		return nil
+	}
+	if _, err := op.fsys.Stat(manifest.Path(op.dir)); err != nil {
+		return nil
+	}
+	m, err := manifest.Load(op.fsys, op.dir)
+	if err != nil {
+		return fmt.Errorf("error reading the existing .manfile: %w", err)
+	}
+	op.layout = m.Layout
+	return nil
+}
+
+// mkdirData creates the data directory
+func (op *initOperation) mkdirData() error {
+	dataDir := op.layout.HomeDir(op.dir)
+	return op.step(journal.StepTypeMkdir, "Create data directory", dataDir, func() (string, error) {
+		if err := op.fsys.MkdirAll(dataDir, op.config.DirPerm()); err != nil {
+			return "", fmt.Errorf("error creating data directory: %w", err)
+		}
+		return "Created data directory", nil
+	})
+}
+
+// writeManfile creates an empty .manfile, unless the template has a skeleton
+// or --force kept the existing one
+func (op *initOperation) writeManfile() error {
+	manfile := filepath.Join(op.dir, ".manfile")
+	return op.step(journal.StepTypeManifest, "Create .manfile", manfile, func() (string, error) {
+		if _, err := op.fsys.Stat(manfile); err == nil {
+			m, err := manifest.Load(op.fsys, op.dir)
+			if err != nil {
+				return "", err
+			}
+			if m.Layout == op.layout {
+				return "Kept the existing .manfile", nil
+			}
+			// The copies of the entries stay where the old layout put them
+			if len(m.Entries) > 0 {
+				return "", fmt.Errorf("the .manfile tracks %d entries in another layout, which --layout would leave behind. Add --wipe to start over", len(m.Entries))
+			}
+			m.Layout = op.layout
+			if err := manifest.Save(op.fsys, op.dir, m); err != nil {
+				return "", err
+			}
+			return "Set the layout of the template's .manfile", nil
+		}
+
+		data := []byte("{}")
+		if op.layout != (manifest.Layout{}) || op.inPlace {
+			m := &manifest.Manifest{Layout: op.layout}
+			if op.inPlace {
+				m.Backend = manifest.BackendWorktree
+			}
+			var err error
+			if data, err = m.Marshal(); err != nil {
+				return "", err
+			}
+		}
+		if err := op.fsys.WriteFile(manfile, data, 0644); err != nil {
+			return "", fmt.Errorf("error creating .manfile: %w", err)
+		}
+		return "Created empty .manfile", nil
+	})
+}
+
+// writeGitignore creates .gitignore. A template's own .gitignore is kept, with
+// the dotman patterns appended when it does not ignore the journal.
+func (op *initOperation) writeGitignore() error {
+	gitignore := filepath.Join(op.dir, ".gitignore")
+	return op.step(journal.StepTypeWrite, "Create .gitignore", gitignore, func() (string, error) {
+		data, err := op.fsys.ReadFile(gitignore)
+		if err == nil {
+			if strings.Contains(string(data), "journal/") {
+				return "Kept the template's .gitignore", nil
+			}
+			if err := op.fsys.AppendFile(gitignore, []byte("\n"+dotmanGitignore), 0644); err != nil {
+				return "", fmt.Errorf("error updating .gitignore: %w", err)
+			}
+			return "Added the dotman patterns to the template's .gitignore", nil
 		}
 
-		wt, err := repo.Worktree()
+		content := dotmanGitignore + `
+# Junk patterns, also skipped when adding directories
+` + exclude.Gitignore()
+		if err := op.fsys.WriteFile(gitignore, []byte(content), 0644); err != nil {
+			return "", fmt.Errorf("error creating .gitignore: %w", err)
+		}
+		return "Created .gitignore", nil
+	})
+}
+
+// gitInit initializes the git repository, or opens the one --force kept
+func (op *initOperation) gitInit() error {
+	return op.step(journal.StepTypeGit, "Initialize git repository", op.dir, func() (string, error) {
+		if op.keptRepo {
+			repo, err := git.Open(newGitStorage(op.fsys, op.dir), dotmanfs.NewBillyFileSystem(op.fsys, op.dir, op.config.Perm()))
+			if err != nil {
+				return "", fmt.Errorf("error opening git repository: %w", err)
+			}
+			op.repo = repo
+			return "Kept the existing repository", nil
+		}
+
+		if op.inPlace {
+			return op.initWorktree()
+		}
+
+		repo, err := git.InitWithOptions(newGitStorage(op.fsys, op.dir), dotmanfs.NewBillyFileSystem(op.fsys, op.dir, op.config.Perm()), git.InitOptions{
+			DefaultBranch: "refs/heads/main",
+		})
 		if err != nil {
-			fmt.Printf("Error getting worktree: %v\n", err)
-			os.Exit(1)
+			return "", fmt.Errorf("error initializing git repository: %w", err)
 		}
+		op.repo = repo
+
+		if verbose {
+			fmt.Printf("Git repository initialized successfully: %s\n", op.dir)
+		}
+		return "Initialized repository on branch main", nil
+	})
+}
 
-		wt.Add(".manfile")
-		wt.Add(".gitignore")
+// initWorktree initializes the repository of the worktree backend, whose
+// worktree is the home directory
+func (op *initOperation) initWorktree() (string, error) {
+	if err := initWorktreeRepo(op.fsys, op.dir); err != nil {
+		return "", fmt.Errorf("error initializing git repository: %w", err)
+	}
+
+	b, err := loadBackend(op.fsys, op.dir, op.config.Perm())
+	if err != nil {
+		return "", err
+	}
+	repo, err := openRepo(op.fsys, op.dir, b)
+	if err != nil {
+		return "", fmt.Errorf("error opening git repository: %w", err)
+	}
+	op.repo, op.backend = repo, b
 
-		// Get author info from git config
-		gitCfg, err := repo.ConfigScoped(gitconfig.GlobalScope)
+	if verbose {
+		fmt.Printf("Git repository initialized successfully: %s\n", op.dir)
+	}
+	return "Initialized repository on branch main with the home directory as its worktree", nil
+}
+
+// initialCommit commits the skeleton, or every file of the template. In a
+// repository kept by --force the new skeleton is committed on top of its
+// history.
+func (op *initOperation) initialCommit() error {
+	return op.step(journal.StepTypeGit, "Create initial commit", op.dir, func() (string, error) {
+		wt, err := op.repo.Worktree()
 		if err != nil {
-			fmt.Printf("Error getting git config: %v\n", err)
-			os.Exit(1)
+			return "", fmt.Errorf("error getting worktree: %w", err)
 		}
 
-		if _, err := wt.Commit("Initial commit", &git.CommitOptions{
-			Author: &object.Signature{
-				Name:  gitCfg.User.Name,
-				Email: gitCfg.User.Email,
-				When:  time.Now(),
-			},
-		}); err != nil {
-			fmt.Printf("Error committing .manfile: %v\n", err)
-			os.Exit(1)
+		message := "Initial commit"
+		if op.keptRepo {
+			message = "Reinitialize dotman"
+		}
+		if op.template != "" {
+			if err := wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+				return "", fmt.Errorf("error adding template files: %w", err)
+			}
+			message = fmt.Sprintf("Initial commit from template %s", op.template)
+		} else if op.backend != nil {
+			wt.Add(op.backend.manifestPath())
+		} else {
+			wt.Add(".manfile")
+			wt.Add(".gitignore")
 		}
 
-		// Save dotman directory to config
-		cfg, err := dotmanconfig.LoadConfig(configPath, fsys)
+		if op.keptRepo {
+			if err := op.checkKeptEntries(); err != nil {
+				return "", err
+			}
+		}
+
+		signature, err := gitIdentity(op.fsys, op.config, op.repo, op.author)
 		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
+			return "", err
 		}
 
-		cfg.DotmanDir = dir
-		if err := dotmanconfig.SaveConfig(configPath, cfg, fsys); err != nil {
-			fmt.Printf("Error saving config: %v\n", err)
-			os.Exit(1)
+		hash, err := wt.Commit(message, &git.CommitOptions{Author: signature})
+		if errors.Is(err, git.ErrEmptyCommit) {
+			return "Nothing to commit", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("error creating initial commit: %w", err)
 		}
+		return fmt.Sprintf("Created commit %s", hash), nil
+	})
+}
 
-		fmt.Printf("dotman initialized in %s\n", dir)
-	},
+func (op *initOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
 }
 
 func init() {
@@ -176,6 +945,56 @@ func init() {
 	defaultDir := filepath.Join(home, ".dotman")
 
 	// Local flags for init command
-	initCmd.Flags().BoolVarP(&force, "force", "f", false, "force initialization even if directory is not empty")
+	initCmd.Flags().BoolVarP(&force, "force", "f", false, "reinitialize an existing directory, moving what is replaced to a backup")
+	initCmd.Flags().BoolVar(&wipe, "wipe", false, "with --force, also replace the git repository, data and journal")
 	initCmd.Flags().StringVarP(&dir, "dir", "d", defaultDir, "directory to initialize dotman in")
+	initCmd.Flags().StringVar(&cloneURL, "clone", "", "clone an existing dotman repository instead of creating a new one")
+	initCmd.Flags().StringVar(&templateRepo, "from-template", "", "start the new repository from the files of this template repository")
+	initCmd.Flags().StringVar(&initAuthor, "author", "", "create the initial commit as \"Name <email>\" instead of the configured identity")
+	initCmd.Flags().StringVar(&initLayout.Home, "data-dir", "", "keep the copies of dotfiles in this directory of the repository instead of data")
+	initCmd.Flags().StringVar(&initLayout.System, "system-dir", "", "keep the copies of system files in this directory of the repository instead of system")
+	initCmd.Flags().StringVar(&initRelease, "release", "", "with --clone, start at this release, or latest for the newest one, instead of the default branch")
+	initCmd.Flags().StringVar(&initSigners, "allowed-signers", "", "ssh-keygen allowed signers file the HEAD commit of the clone must be signed by, saved as allowed_signers for link")
+	initCmd.Flags().BoolVar(&initWorktree, "worktree", false, "track dotfiles in place with the home directory as the git worktree, instead of copying and linking them")
+	initCmd.MarkFlagsMutuallyExclusive("clone", "from-template")
+	initCmd.MarkFlagsMutuallyExclusive("worktree", "clone")
+	initCmd.MarkFlagsMutuallyExclusive("worktree", "from-template")
+	initCmd.MarkFlagsMutuallyExclusive("worktree", "data-dir")
+	initCmd.MarkFlagsMutuallyExclusive("worktree", "system-dir")
+}
+
+// checkKeptEntries refuses to commit a manifest that no longer tracks every
+// entry of the one at HEAD, so reinitializing never untracks files
+func (op *initOperation) checkKeptEntries() error {
+	head, err := op.repo.Head()
+	if err != nil {
+		// Nothing was committed yet
+		return nil
+	}
+	commit, err := op.repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("error reading HEAD commit: %w", err)
+	}
+	file, err := commit.File(".manfile")
+	if err != nil {
+		return nil
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return fmt.Errorf("error reading the committed .manfile: %w", err)
+	}
+	committed, err := manifest.Parse([]byte(content))
+	if err != nil {
+		return fmt.Errorf("error parsing the committed .manfile: %w", err)
+	}
+	m, err := manifest.Load(op.fsys, op.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range committed.Entries {
+		if _, ok := m.Find(entry.Path); !ok {
+			return fmt.Errorf("reinitializing would untrack %s, which HEAD tracks", entry.Path)
+		}
+	}
+	return nil
 }
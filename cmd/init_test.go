@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+// runInit runs init into dir, returning the operation
+func runInit(t *testing.T, fsys testutil.FS, dir, clone, template string) (*initOperation, error) {
+	t.Helper()
+
+	op := newTestInitOperation(fsys, dir)
+	op.cloneURL = clone
+	op.template = template
+	return op, op.run()
+}
+
+// newTestInitOperation returns an init of dir that does not retry clones
+func newTestInitOperation(fsys testutil.FS, dir string) *initOperation {
+	return &initOperation{
+		config: &config.Config{NetworkRetries: "0", GitUserName: "dotman", GitUserEmail: "dotman@localhost"},
+		fsys:   fsys,
+		ctx:    context.Background(),
+		dir:    dir,
+	}
+}
+
+// initEntry returns the only init entry with state in the journal of dir
+func initEntry(t *testing.T, fsys testutil.FS, dir string, state journal.EntryState) *journal.JournalEntry {
+	t.Helper()
+
+	jm := journal.NewJournalManager(fsys, filepath.Join(dir, "journal"))
+	entries, err := jm.ListEntries(state)
+	if err != nil {
+		t.Fatalf("failed to list journal entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 %s entry, got %d", state, len(entries))
+	}
+	return entries[0]
+}
+
+func TestInitOperation(t *testing.T) {
+	fsys, err := testutil.NewMockFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dotmanDir := filepath.Join(testutil.TestHomeDir, ".dotman")
+	op, err := runInit(t, fsys, dotmanDir, "", "")
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	for _, name := range []string{".manfile", ".gitignore", "data", ".git"} {
+		if _, err := fsys.Stat(filepath.Join(dotmanDir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	testutil.VerifyLastCommit(t, op.repo, "Initial commit")
+
+	entry := initEntry(t, fsys, dotmanDir, journal.EntryStateCompleted)
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeInit, journal.EntryStateCompleted, 5)
+	testutil.VerifyStep(t, entry.Steps[0], journal.StepTypeMkdir, journal.StepStatusCompleted, "Create data directory")
+	testutil.VerifyStepWithDetails(t, entry.Steps[1], journal.StepTypeManifest, journal.StepStatusCompleted, "Create .manfile", "Created empty .manfile")
+	testutil.VerifyStepWithDetails(t, entry.Steps[2], journal.StepTypeWrite, journal.StepStatusCompleted, "Create .gitignore", "Created .gitignore")
+	testutil.VerifyStep(t, entry.Steps[3], journal.StepTypeGit, journal.StepStatusCompleted, "Initialize git repository")
+	testutil.VerifyStep(t, entry.Steps[4], journal.StepTypeGit, journal.StepStatusCompleted, "Create initial commit")
+
+	// An existing dotman directory is only replaced with --force
+	if _, err := runInit(t, fsys, dotmanDir, "", ""); err == nil || !strings.Contains(err.Error(), "already a dotman directory") {
+		t.Fatalf("expected init to refuse an existing dotman directory, got %v", err)
+	}
+}
+
+func TestInitOperation_FromTemplateAndClone(t *testing.T) {
+	fsys, err := testutil.NewMockFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	// A template with a README, a hook and its own .gitignore but no manifest
+	templateDir := "home/template"
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, templateDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, templateDir, "README.md", "my dotfiles")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, templateDir, ".gitignore", "*.swp\n")
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, templateDir, "hooks/post-link", "#!/bin/sh\n")
+	template := fsys.RealPath(templateDir)
+
+	// Cloning a repository that is not a dotman one is refused, leaving only
+	// the journal of the failed attempt behind
+	bad := filepath.Join(testutil.TestHomeDir, "bad")
+	if _, err := runInit(t, fsys, bad, template, ""); err == nil {
+		t.Fatal("expected cloning a repository without .manfile to fail")
+	}
+	entries, err := fsys.Readdir(bad)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", bad, err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "journal" {
+		t.Fatalf("expected only the journal to be left, got %v", entries)
+	}
+	failed := initEntry(t, fsys, bad, journal.EntryStateFailed)
+	testutil.VerifyStep(t, failed.Steps[1], journal.StepTypeVerify, journal.StepStatusFailed, "Verify dotman repository")
+
+	// The template's files start a new history with the dotman skeleton
+	created := filepath.Join(testutil.TestHomeDir, "created")
+	op, err := runInit(t, fsys, created, "", template)
+	if err != nil {
+		t.Fatalf("failed to create from template: %v", err)
+	}
+	for _, name := range []string{"README.md", "hooks/post-link", ".manfile", ".gitignore", "data"} {
+		if _, err := fsys.Stat(filepath.Join(created, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	gitignore, err := fsys.ReadFile(filepath.Join(created, ".gitignore"))
+	if err != nil {
+		t.Fatalf("failed to read .gitignore: %v", err)
+	}
+	if !strings.HasPrefix(string(gitignore), "*.swp\n") || !strings.Contains(string(gitignore), "journal/") {
+		t.Errorf("expected the dotman patterns appended to the template's .gitignore, got %q", gitignore)
+	}
+	commits, err := op.repo.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	count := 0
+	commits.ForEach(func(c *object.Commit) error {
+		count++
+		if c.Message != "Initial commit from template "+template {
+			t.Errorf("unexpected commit message %q", c.Message)
+		}
+		if _, err := c.File("journal/index.json"); err == nil {
+			t.Error("expected the journal to be left out of the commit")
+		}
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("expected a single commit, got %d", count)
+	}
+	entry := initEntry(t, fsys, created, journal.EntryStateCompleted)
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeInit, journal.EntryStateCompleted, 6)
+
+	// The directory of the refused clone is reused to clone the new repository
+	if _, err := runInit(t, fsys, bad, fsys.RealPath(created), ""); err != nil {
+		t.Fatalf("failed to clone: %v", err)
+	}
+	if _, err := fsys.Stat(filepath.Join(bad, "data")); err != nil {
+		t.Errorf("expected the data directory to exist: %v", err)
+	}
+	entry = initEntry(t, fsys, bad, journal.EntryStateCompleted)
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeInit, journal.EntryStateCompleted, 3)
+}
+
+func TestInitOperation_Layout(t *testing.T) {
+	fsys, err := testutil.NewMockFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dotmanDir := filepath.Join(testutil.TestHomeDir, ".dotman")
+	op := newTestInitOperation(fsys, dotmanDir)
+	op.layout = manifest.Layout{Home: "files/home", System: "files/root"}
+	if err := op.run(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "files/home")); err != nil {
+		t.Errorf("expected the data directory of the layout to exist: %v", err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data")); err == nil {
+		t.Error("expected no data directory")
+	}
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil || m.Layout != op.layout {
+		t.Fatalf("expected the manifest to record the layout, got %+v (%v)", m, err)
+	}
+
+	// Added files are copied where the layout says
+	add := &addOperation{path: filepath.Join(testutil.TestHomeDir, ".zshrc"), fsys: fsys, config: &config.Config{DotmanDir: dotmanDir}}
+	if err := add.initialize(); err != nil {
+		t.Fatalf("initialize() returned error: %v", err)
+	}
+	if got, want := add.repoPath(dotmanDir), filepath.Join(dotmanDir, "files/home/.zshrc"); got != want {
+		t.Errorf("expected the copy at %s, got %s", want, got)
+	}
+}
+
+func TestInitOperation_Worktree(t *testing.T) {
+	fsys, err := testutil.NewMockFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dotmanDir := filepath.Join(testutil.TestHomeDir, ".dotman")
+	op := newTestInitOperation(fsys, dotmanDir)
+	op.inPlace = true
+	if err := op.run(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data")); err == nil {
+		t.Error("expected no data directory")
+	}
+	if _, err := fsys.Stat(filepath.Join(testutil.TestHomeDir, ".git")); err == nil {
+		t.Error("expected nothing written to the home directory")
+	}
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil || !m.InPlace() {
+		t.Fatalf("expected the manifest to name the worktree backend, got %+v (%v)", m, err)
+	}
+	head, err := op.repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	commit, err := op.repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to read the initial commit: %v", err)
+	}
+	if _, err := commit.File(".dotman/.manfile"); err != nil {
+		t.Errorf("expected the initial commit to track the manifest below the home directory: %v", err)
+	}
+
+	// An added file stays where it is and is staged from there
+	zshrc := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	if err := fsys.WriteFile(zshrc, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write .zshrc: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(testutil.TestHomeDir, ".bashrc"), []byte("bash"), 0644); err != nil {
+		t.Fatalf("failed to write .bashrc: %v", err)
+	}
+	cfg := &config.Config{DotmanDir: dotmanDir}
+	add := &addOperation{path: zshrc, fsys: fsys, config: cfg}
+	if err := add.run(); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if info, err := fsys.Lstat(zshrc); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("expected .zshrc to stay a regular file, got %v (%v)", info, err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data", ".zshrc")); err == nil {
+		t.Error("expected no copy in the dotman directory")
+	}
+
+	// Status sees the tracked file only, and no links
+	report, err := loadStatus(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != ".zshrc" || report.Files[0].Staging != "added" {
+		t.Errorf("expected .zshrc to be staged, got %+v", report.Files)
+	}
+	if len(report.Links) != 0 {
+		t.Errorf("expected no links, got %+v", report.Links)
+	}
+}
+
+func TestInitOperation_Force(t *testing.T) {
+	fsys, err := testutil.NewMockFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dotmanDir := filepath.Join(testutil.TestHomeDir, ".dotman")
+	first, err := runInit(t, fsys, dotmanDir, "", "")
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	// A tracked file with an unpushed commit, and a stray file
+	worktree, err := first.repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":"bashrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/bashrc", "alias ll='ls -l'")
+	head, err := first.repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("failed to write notes: %v", err)
+	}
+	// What tracked entries point into
+	for _, dir := range []string{"store/f3", ".offload", "machines"} {
+		fsys.MkdirAll(filepath.Join(dotmanDir, dir), 0755)
+		fsys.WriteFile(filepath.Join(dotmanDir, dir, "file"), []byte("kept"), 0644)
+	}
+
+	// --force keeps the repository, manifest and tracked files, moving the
+	// rest to a backup
+	op := newTestInitOperation(fsys, dotmanDir)
+	op.force = true
+	if err := op.run(); err != nil {
+		t.Fatalf("init --force failed: %v", err)
+	}
+	if op.backup == "" {
+		t.Fatal("expected a backup")
+	}
+	for _, name := range []string{"notes.txt", ".gitignore"} {
+		if _, err := fsys.Stat(filepath.Join(op.backup, name)); err != nil {
+			t.Errorf("expected %s in the backup: %v", name, err)
+		}
+	}
+	for _, dir := range []string{"store/f3", ".offload", "machines"} {
+		if _, err := fsys.Stat(filepath.Join(dotmanDir, dir, "file")); err != nil {
+			t.Errorf("expected %s to be kept: %v", dir, err)
+		}
+	}
+	if m, err := manifest.Load(fsys, dotmanDir); err != nil || len(m.Entries) != 1 {
+		t.Errorf("expected the manifest to keep its entry, got %+v (%v)", m, err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "notes.txt")); err == nil {
+		t.Error("expected notes.txt to be moved")
+	}
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data", "bashrc")); err != nil {
+		t.Errorf("expected the data directory to be kept: %v", err)
+	}
+	kept, err := op.repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	if kept.Hash() != head.Hash() {
+		t.Errorf("expected the unchanged skeleton to keep HEAD at %s, got %s", head.Hash(), kept.Hash())
+	}
+
+	// Both runs are in the kept journal
+	jm := journal.NewJournalManager(fsys, filepath.Join(dotmanDir, "journal"))
+	testutil.VerifyJournalEntryCount(t, jm, journal.EntryStateCompleted, 2)
+
+	// A manifest dropping entries HEAD tracks is never committed
+	fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte("{}"), 0644)
+	dropped := newTestInitOperation(fsys, dotmanDir)
+	dropped.force = true
+	if err := dropped.run(); err == nil || !strings.Contains(err.Error(), "would untrack bashrc") {
+		t.Errorf("expected init --force to refuse untracking bashrc, got %v", err)
+	}
+
+	// --wipe moves the whole directory to a new backup
+	wiped := newTestInitOperation(fsys, dotmanDir)
+	wiped.force = true
+	wiped.wipe = true
+	if err := wiped.run(); err != nil {
+		t.Fatalf("init --force --wipe failed: %v", err)
+	}
+	if wiped.backup == op.backup {
+		t.Fatalf("expected a new backup, got %s again", wiped.backup)
+	}
+	if _, err := fsys.Stat(filepath.Join(wiped.backup, "data", "bashrc")); err != nil {
+		t.Errorf("expected the data directory in the backup: %v", err)
+	}
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data", "bashrc")); err == nil {
+		t.Error("expected the data directory to be replaced")
+	}
+	testutil.VerifyLastCommit(t, wiped.repo, "Initial commit")
+	entry := initEntry(t, fsys, dotmanDir, journal.EntryStateCompleted)
+	testutil.VerifyStepWithDetails(t, entry.Steps[0], journal.StepTypeMove, journal.StepStatusCompleted, "Back up existing directory", "Moved .dotman")
+}
@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"path/filepath"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/noosxe/dotman/internal/journal"
 	"github.com/spf13/cobra"
 )
@@ -14,13 +20,23 @@ import (
 var (
 	stateFilters     []string
 	operationFilters []string
+
+	statsSlowest int
+
+	exportFile   string
+	exportFormat string
+
+	pruneOlderThan string
 )
 
 var journalCmd = &cobra.Command{
-	Use:   "journal",
+	Use:   "journal [id]",
 	Short: "Show the status of actions from the journal",
 	Long: `Show the status of actions from the journal, including completed, failed, and current operations.
-The journal keeps track of all operations performed by dotman.`,
+The journal keeps track of all operations performed by dotman. Pass an entry ID to show a single entry,
+including one moved to an archive by 'dotman journal prune'.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeJournalIDs,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		// Validate state filters
 		for _, state := range stateFilters {
@@ -34,11 +50,8 @@ The journal keeps track of all operations performed by dotman.`,
 
 		// Validate operation filters
 		for _, op := range operationFilters {
-			switch journal.OperationType(op) {
-			case journal.OperationTypeAdd, journal.OperationTypeRemove, journal.OperationTypeLink:
-				// Valid operation
-			default:
-				return fmt.Errorf("invalid operation '%s'. Valid operations are: add, remove, link", op)
+			if !journal.OperationType(op).Valid() {
+				return fmt.Errorf("invalid operation '%s'. Valid operations are: %s", op, operationTypeNames())
 			}
 		}
 
@@ -52,40 +65,41 @@ The journal keeps track of all operations performed by dotman.`,
 		}
 
 		// Initialize journal manager with the correct path
-		jm := journal.NewJournalManager(fsys, filepath.Join(cfg.DotmanDir, "journal"))
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
 
-		// List entries with state filters
-		var allEntries []*journal.JournalEntry
-		if len(stateFilters) == 0 {
-			// If no state filters specified, get all entries
-			entries, err := jm.ListEntries("")
+		// Show a single entry when an ID is given
+		if len(args) == 1 {
+			entry, err := jm.GetEntry(args[0])
 			if err != nil {
-				return fmt.Errorf("error listing journal entries: %v", err)
-			}
-			allEntries = entries
-		} else {
-			// Get entries for each specified state
-			for _, state := range stateFilters {
-				entries, err := jm.ListEntries(journal.EntryState(state))
-				if err != nil {
-					return fmt.Errorf("error listing journal entries for state '%s': %v", state, err)
-				}
-				allEntries = append(allEntries, entries...)
+				return fmt.Errorf("error reading journal entry: %v", err)
 			}
+			printJournalEntry(jm, entry)
+			return nil
 		}
 
-		// Filter by operation if specified
-		if len(operationFilters) > 0 {
-			filteredEntries := make([]*journal.JournalEntry, 0)
-			for _, entry := range allEntries {
-				for _, op := range operationFilters {
-					if string(entry.Operation) == op {
-						filteredEntries = append(filteredEntries, entry)
-						break
-					}
-				}
+		// Filter the index, so only the entries shown are read. Grouped
+		// entries are printed with their group.
+		records, err := jm.Index()
+		if err != nil {
+			return fmt.Errorf("error reading journal index: %v", err)
+		}
+		var ids []string
+		for _, record := range records {
+			if record.ParentID != "" {
+				continue
+			}
+			if len(stateFilters) > 0 && !slices.Contains(stateFilters, string(record.State)) {
+				continue
+			}
+			if len(operationFilters) > 0 && !slices.Contains(operationFilters, string(record.Operation)) {
+				continue
 			}
-			allEntries = filteredEntries
+			ids = append(ids, record.ID)
+		}
+
+		allEntries, err := jm.GetEntries(ids)
+		if err != nil {
+			return fmt.Errorf("error reading journal entries: %v (run 'dotman journal reindex' if the index is stale)", err)
 		}
 
 		if len(allEntries) == 0 {
@@ -107,53 +121,554 @@ The journal keeps track of all operations performed by dotman.`,
 
 		// Print entries in reverse chronological order
 		for i := len(allEntries) - 1; i >= 0; i-- {
-			entry := allEntries[i]
-			fmt.Printf("\nOperation: %s\n", entry.Operation)
-			fmt.Printf("ID: %s\n", entry.ID)
-			fmt.Printf("Timestamp: %s\n", entry.Timestamp.Format(time.RFC3339))
-			fmt.Printf("State: %s\n", entry.State)
-			if entry.Source != "" {
-				fmt.Printf("Source: %s\n", entry.Source)
+			printJournalEntry(jm, allEntries[i])
+		}
+
+		return nil
+	},
+}
+
+var journalVerifyCmd = &cobra.Command{
+	Use:   "verify-integrity",
+	Short: "Check the journal history against its hash chain",
+	Long: `Check the journal history against its hash chain and report entries that were
+edited, deleted or injected. Only entries created with journal_chain enabled are
+chained. The chain head printed at the end can be noted down elsewhere, to detect
+the whole history being rewritten.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		problems, head, err := jm.VerifyIntegrity()
+		if err != nil {
+			return fmt.Errorf("error verifying journal: %v", err)
+		}
+
+		if head == "" {
+			fmt.Println("The journal has no chained entries, enable them with 'dotman config set journal_chain true'")
+			return nil
+		}
+
+		for _, p := range problems {
+			if p.ID == "" {
+				fmt.Printf("#%d: %s\n", p.Sequence, p.Problem)
+				continue
+			}
+			fmt.Printf("#%d %s: %s\n", p.Sequence, p.ID, p.Problem)
+		}
+		fmt.Printf("Chain head: %s\n", head)
+
+		if len(problems) > 0 {
+			return fmt.Errorf("journal integrity check found %d problems", len(problems))
+		}
+		fmt.Println("Journal history is intact")
+		return nil
+	},
+}
+
+var journalReindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the journal index from the journal entries",
+	Long: `Rebuild the index used to list and filter journal entries from the entries
+themselves. Use it when 'dotman journal' lists entries that do not exist or misses
+some that do.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		n, err := jm.Reindex()
+		if err != nil {
+			return fmt.Errorf("error reindexing journal: %v", err)
+		}
+
+		fmt.Printf("Indexed %d journal entries\n", n)
+		return nil
+	},
+}
+
+var journalStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how long the steps of journaled operations took",
+	Long: `Sum up the time the steps of journaled operations took by step type, so it
+shows whether the time goes to copying, verifying, git or something else.
+--slowest lists the 10 slowest steps with the entries they belong to,
+--slowest=N the N slowest. Use --trace on a command to see the steps of a
+single run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, op := range operationFilters {
+			if !journal.OperationType(op).Valid() {
+				return fmt.Errorf("invalid operation '%s'. Valid operations are: %s", op, operationTypeNames())
 			}
-			if entry.Target != "" {
-				fmt.Printf("Target: %s\n", entry.Target)
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		// Grouped entries hold the steps of their group
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		records, err := jm.Index()
+		if err != nil {
+			return fmt.Errorf("error reading journal index: %v", err)
+		}
+		var ids []string
+		for _, record := range records {
+			if len(operationFilters) > 0 && !slices.Contains(operationFilters, string(record.Operation)) {
+				continue
 			}
+			ids = append(ids, record.ID)
+		}
+		entries, err := jm.GetEntries(ids)
+		if err != nil {
+			return fmt.Errorf("error reading journal entries: %v (run 'dotman journal reindex' if the index is stale)", err)
+		}
 
-			// Print steps
-			if len(entry.Steps) > 0 {
-				fmt.Println("\nSteps:")
-				for _, step := range entry.Steps {
-					fmt.Printf("  - %s: %s\n", step.Type, step.Status)
-					if step.Description != "" {
-						fmt.Printf("    Description: %s\n", step.Description)
-					}
-					if step.Error != "" {
-						fmt.Printf("    Error: %s\n", step.Error)
-					}
-					if step.Details != "" {
-						fmt.Printf("    Details: %s\n", step.Details)
-					}
-					if !step.StartTime.IsZero() {
-						fmt.Printf("    Started: %s\n", step.StartTime.Format(time.RFC3339))
-					}
-					if !step.EndTime.IsZero() {
-						fmt.Printf("    Ended: %s\n", step.EndTime.Format(time.RFC3339))
-					}
-				}
+		timings := journal.Timings(entries)
+		if len(timings) == 0 {
+			fmt.Println("No timed steps in the journal")
+			return nil
+		}
+
+		printStepStats(os.Stdout, journal.Stats(timings))
+		if statsSlowest > 0 {
+			fmt.Println()
+			printSlowestSteps(os.Stdout, timings[:min(statsSlowest, len(timings))])
+		}
+		return nil
+	},
+}
+
+var journalRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rewrite the journal entry files from the journal log",
+	Long: `Rewrite the journal entry files in the current, completed and failed directories
+from the append-only journal log, which is the journal's source of truth. Use it
+when entry files were edited or lost.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		n, err := jm.Rebuild()
+		if err != nil {
+			return fmt.Errorf("error rebuilding journal: %v", err)
+		}
+
+		fmt.Printf("Rebuilt %d journal entries\n", n)
+		return nil
+	},
+}
+
+var journalPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Move old journal entries and backups to compressed archives",
+	Long: `Move the completed and failed journal entries older than --older-than, 90 days
+by default, out of the journal into a gzip compressed archive named by the date
+in the archive directory of the journal, and compress the backups link made
+before then into .tar.gz files of the same name, keeping long-lived installs
+small. Operations still in progress are never pruned.
+
+Pruned entries are listed in the index of the archive directory. 'dotman journal
+<id>' still shows them and 'dotman journal verify-integrity' still checks the
+hash chain through them, but 'dotman journal' no longer lists them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age, err := config.ParseAge(pruneOlderThan)
+		if err != nil {
+			return err
+		}
+		cutoff := time.Now().Add(-age)
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		n, archive, err := jm.Prune(cutoff)
+		if err != nil {
+			return fmt.Errorf("error pruning journal: %v", err)
+		}
+		if n == 0 {
+			fmt.Println("No journal entries to prune")
+		} else {
+			fmt.Printf("Moved %d journal entries to %s\n", n, archive)
+		}
+
+		backups, err := compressBackups(fsys, cfg, cutoff)
+		if err != nil {
+			return err
+		}
+		if backups > 0 {
+			fmt.Printf("Compressed %d backups\n", backups)
+		}
+		return nil
+	},
+}
+
+var journalExportCmd = &cobra.Command{
+	Use:   "export [id...]",
+	Short: "Write journal entries to an archive",
+	Long: `Write journal entries to a single archive, to carry the operation history along
+when migrating to another machine or to share it when debugging a setup. The
+archive holds one entry per line with --format jsonl, the default, or one JSON
+file per entry with --format tar.
+
+Pass entry IDs to export only those, or filter with --state and --operation.
+Entries grouped under an exported entry are always exported with it.`,
+	ValidArgsFunction: completeJournalIDs,
+	PreRunE:           journalCmd.PreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format := journal.ArchiveFormat(exportFormat)
+		if format == "" {
+			format = journal.ArchiveJSONL
+			if strings.HasSuffix(exportFile, ".tar") {
+				format = journal.ArchiveTar
+			}
+		}
+		if format != journal.ArchiveJSONL && format != journal.ArchiveTar {
+			return fmt.Errorf("invalid format '%s'. Valid formats are: jsonl, tar", exportFormat)
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		entries, err := exportedEntries(jm, args)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("no journal entries to export")
+		}
+
+		var buf bytes.Buffer
+		if err := journal.WriteArchive(&buf, format, entries); err != nil {
+			return fmt.Errorf("error writing archive: %v", err)
+		}
+		if exportFile == "" || exportFile == "-" {
+			_, err := os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		if err := fsys.WriteFile(exportFile, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", exportFile, err)
+		}
+
+		fmt.Printf("Exported %d journal entries to %s\n", len(entries), exportFile)
+		return nil
+	},
+}
+
+var journalImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Add journal entries from an archive",
+	Long: `Add the journal entries of an archive written by 'dotman journal export', in
+either format, or by 'dotman journal prune', to this machine's journal. Gzip
+compressed archives are read as they are. Entries the journal already has are
+skipped. Use - to read the archive from standard input.
+
+Imported entries show the host they came from. They are not part of the hash
+chain of this journal, and entries that were still in progress are imported as
+failed, as they can never finish here.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			data, err := fsys.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", args[0], err)
 			}
-			fmt.Println("----------------------------------------")
+			r = bytes.NewReader(data)
+		}
+		entries, err := journal.ReadArchive(r)
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+
+		jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+		if err := jm.Initialize(); err != nil {
+			return fmt.Errorf("error initializing journal: %v", err)
+		}
+		n, err := jm.Import(entries)
+		if err != nil {
+			return fmt.Errorf("error importing journal entries: %v", err)
 		}
 
+		fmt.Printf("Imported %d journal entries, %d already present\n", n, len(entries)-n)
 		return nil
 	},
 }
 
+// exportedEntries returns the entries with the given IDs, or those the state
+// and operation filters select, along with the entries they group. Entries
+// are marked with this host as their origin.
+func exportedEntries(jm *journal.JournalManager, ids []string) ([]*journal.JournalEntry, error) {
+	if len(ids) == 0 {
+		records, err := jm.Index()
+		if err != nil {
+			return nil, fmt.Errorf("error reading journal index: %v", err)
+		}
+		for _, record := range records {
+			if record.ParentID != "" {
+				continue
+			}
+			if len(stateFilters) > 0 && !slices.Contains(stateFilters, string(record.State)) {
+				continue
+			}
+			if len(operationFilters) > 0 && !slices.Contains(operationFilters, string(record.Operation)) {
+				continue
+			}
+			ids = append(ids, record.ID)
+		}
+	}
+
+	entries, err := jm.GetEntries(ids)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal entries: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	var exported []*journal.JournalEntry
+	for _, entry := range entries {
+		exported = append(exported, entry)
+		children, err := jm.ChildEntries(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error reading grouped entries of %s: %v", entry.ID, err)
+		}
+		exported = append(exported, children...)
+	}
+	for _, entry := range exported {
+		if entry.Origin == "" {
+			entry.Origin = hostname
+		}
+	}
+	return exported, nil
+}
+
 func init() {
 	rootCmd.AddCommand(journalCmd)
+	journalCmd.AddCommand(journalExportCmd)
+	journalCmd.AddCommand(journalImportCmd)
+	journalCmd.AddCommand(journalPruneCmd)
+	journalCmd.AddCommand(journalVerifyCmd)
+	journalCmd.AddCommand(journalRebuildCmd)
+	journalCmd.AddCommand(journalReindexCmd)
+	journalCmd.AddCommand(journalStatsCmd)
 
 	// Add state filter flag
 	journalCmd.Flags().StringSliceVarP(&stateFilters, "state", "s", nil, "Filter entries by state (current, completed, failed). Can be specified multiple times.")
 
 	// Add operation filter flag
-	journalCmd.Flags().StringSliceVarP(&operationFilters, "operation", "o", nil, "Filter entries by operation type (add, remove, link). Can be specified multiple times.")
+	journalCmd.Flags().StringSliceVarP(&operationFilters, "operation", "o", nil, "Filter entries by operation type ("+operationTypeNames()+"). Can be specified multiple times.")
+
+	journalStatsCmd.Flags().IntVar(&statsSlowest, "slowest", 0, "also list the slowest steps, 10 unless given as --slowest=N")
+	journalStatsCmd.Flags().Lookup("slowest").NoOptDefVal = "10"
+	journalStatsCmd.Flags().StringSliceVarP(&operationFilters, "operation", "o", nil, "only count steps of this operation type ("+operationTypeNames()+"). Can be specified multiple times.")
+
+	journalPruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "90d", "prune entries and backups older than this, e.g. 36h or 30d")
+
+	journalExportCmd.Flags().StringSliceVarP(&stateFilters, "state", "s", nil, "Export entries in this state (current, completed, failed). Can be specified multiple times.")
+	journalExportCmd.Flags().StringSliceVarP(&operationFilters, "operation", "o", nil, "Export entries of this operation type ("+operationTypeNames()+"). Can be specified multiple times.")
+	journalExportCmd.Flags().StringVarP(&exportFile, "file", "f", "", "file to write the archive to (default is standard output)")
+	journalExportCmd.Flags().StringVar(&exportFormat, "format", "", "archive format, jsonl or tar (default is tar for a .tar file, jsonl otherwise)")
+}
+
+// printStepStats prints the time taken by step type
+func printStepStats(w io.Writer, stats []journal.StepStats) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tCOUNT\tTOTAL\tAVERAGE\tMAX")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", s.Type, s.Count, formatDuration(s.Total), formatDuration(s.Average()), formatDuration(s.Max))
+	}
+	tw.Flush()
+}
+
+// printSlowestSteps lists steps with their duration and entry
+func printSlowestSteps(w io.Writer, timings []journal.StepTiming) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSTEP\tOPERATION\tENTRY\tDESCRIPTION")
+	for _, t := range timings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", formatDuration(t.Step.Duration()), t.Step.Type, t.Operation, t.EntryID, t.Step.Description)
+	}
+	tw.Flush()
+}
+
+// operationTypeNames returns the known operation types as a comma separated list
+func operationTypeNames() string {
+	names := make([]string, len(journal.OperationTypes))
+	for i, op := range journal.OperationTypes {
+		names[i] = string(op)
+	}
+	return strings.Join(names, ", ")
+}
+
+// newJournalManager returns the manager of the journal of the dotman
+// directory dir, set up as cfg and the global flags ask
+func newJournalManager(fsys dotmanfs.FileSystem, cfg *config.Config, dir string) *journal.JournalManager {
+	jm := journal.NewJournalManager(fsys, cfg.JournalPath(dir))
+	jm.SetHashChain(cfg.JournalChain)
+	jm.SetFsync(fsyncLevel(cfg.Fsync))
+	if verbose {
+		jm.Observe(journal.NewProgressObserver(os.Stderr))
+	}
+	if logFile != "" {
+		handler := slog.NewJSONHandler(&appendWriter{fsys: fsys, path: logFile}, &slog.HandlerOptions{Level: slog.LevelDebug})
+		jm.Observe(journal.NewLogObserver(slog.New(handler)))
+	}
+	if !noScripts {
+		for _, hook := range cfg.Hooks {
+			jm.Observe(&hookObserver{command: hook, cfg: cfg, jm: jm})
+		}
+	}
+	if background && cfg.Notify != "" {
+		jm.Observe(&notifyObserver{level: cfg.Notify})
+	}
+	if tracer != nil {
+		jm.Observe(tracer)
+	}
+	return jm
+}
+
+// fsyncLevel returns the journal fsync level of the fsync setting,
+// transitions when it is not set
+func fsyncLevel(setting string) journal.FsyncLevel {
+	switch setting {
+	case config.FsyncOff:
+		return journal.FsyncOff
+	case config.FsyncAll:
+		return journal.FsyncAll
+	}
+	return journal.FsyncTransitions
+}
+
+// appendWriter appends every write to a file, so a log is written without
+// keeping the file open
+type appendWriter struct {
+	fsys dotmanfs.FileSystem
+	path string
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	if err := w.fsys.AppendFile(w.path, p, 0644); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// printJournalEntry prints an entry and its steps, or the entries it groups
+func printJournalEntry(jm *journal.JournalManager, entry *journal.JournalEntry) {
+	fmt.Printf("\nOperation: %s\n", paint(colorBold, string(entry.Operation)))
+	fmt.Printf("ID: %s\n", entry.ID)
+	fmt.Printf("Timestamp: %s\n", entry.Timestamp.Format(time.RFC3339))
+	fmt.Printf("State: %s\n", paintState(string(entry.State), 0))
+	if entry.ParentID != "" {
+		fmt.Printf("Group: %s\n", entry.ParentID)
+	}
+	if entry.Source != "" {
+		fmt.Printf("Source: %s\n", entry.Source)
+	}
+	if entry.Target != "" {
+		fmt.Printf("Target: %s\n", entry.Target)
+	}
+	if entry.Error != "" {
+		fmt.Printf("Error: %s\n", paint(colorRed, entry.Error))
+	}
+	if entry.Origin != "" {
+		fmt.Printf("Imported from: %s\n", entry.Origin)
+	}
+
+	printJournalSteps(entry.Steps, "")
+
+	// A group has no steps of its own, print those of its children
+	if entry.IsGroup() {
+		children, err := jm.ChildEntries(entry)
+		if err != nil {
+			fmt.Printf("Error reading grouped entries: %v\n", err)
+		}
+		fmt.Println("\nEntries:")
+		for _, child := range children {
+			fmt.Printf("  - %s %s: %s (%s)\n", child.Operation, child.Source, paintState(string(child.State), 0), child.ID)
+			printJournalSteps(child.Steps, "    ")
+		}
+	}
+	fmt.Println("----------------------------------------")
+}
+
+// printJournalSteps prints a list of steps indented by indent
+func printJournalSteps(steps []journal.Step, indent string) {
+	if len(steps) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%sSteps:\n", indent)
+	indent += "  "
+	for _, step := range steps {
+		fmt.Printf("%s- %s: %s\n", indent, step.Type, paintState(string(step.Status), 0))
+		if step.Description != "" {
+			fmt.Printf("%s  Description: %s\n", indent, step.Description)
+		}
+		if step.Error != "" {
+			fmt.Printf("%s  Error: %s\n", indent, paint(colorRed, step.Error))
+		}
+		if step.Details != "" {
+			fmt.Printf("%s  Details: %s\n", indent, step.Details)
+		}
+		if !step.StartTime.IsZero() {
+			fmt.Printf("%s  Started: %s\n", indent, step.StartTime.Format(time.RFC3339))
+		}
+		if !step.EndTime.IsZero() {
+			fmt.Printf("%s  Ended: %s\n", indent, step.EndTime.Format(time.RFC3339))
+		}
+		if step.Rollback != nil {
+			fmt.Printf("%s  Rollback: %s\n", indent, describeRollback(step.Rollback))
+		}
+	}
+}
+
+// describeRollback summarizes the rollback data of a step on one line
+func describeRollback(rollback *journal.Rollback) string {
+	var parts []string
+	if len(rollback.Created) > 0 {
+		parts = append(parts, "remove "+strings.Join(rollback.Created, ", "))
+	}
+	if rollback.Backup != "" {
+		parts = append(parts, "restore from "+rollback.Backup)
+	}
+	if rollback.Mode != 0 {
+		parts = append(parts, "mode "+rollback.Mode.String())
+	}
+	if rollback.LinkTarget != "" {
+		parts = append(parts, "relink to "+rollback.LinkTarget)
+	}
+	if rollback.GitRef != "" {
+		ref := "HEAD"
+		if rollback.GitRefName != "" {
+			ref = rollback.GitRefName
+		}
+		parts = append(parts, fmt.Sprintf("reset %s to %s", ref, rollback.GitRef))
+	}
+	if len(parts) == 0 {
+		return "nothing to undo"
+	}
+	return strings.Join(parts, "; ")
 }
@@ -0,0 +1,837 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/machines"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/noosxe/dotman/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// linkOperation represents the state of a link operation
+type linkOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	// only link entries of these packages, all packages when empty
+	packages []string
+	// where the manifest keeps the copies
+	layout manifest.Layout
+
+	// what landed in the repository since the last link, nil for nothing
+	changes *changelog
+	// number of symlinks created by the operation
+	linked int
+	// leave the symlinks of dropped entries in place
+	keepDropped bool
+	// number of symlinks of dropped entries removed by the operation
+	unlinked int
+	// where the removed symlinks were backed up
+	backup string
+	// number of externals cloned by the operation
+	cloned int
+	// number of offloaded files fetched by the operation
+	fetched int
+	// number of entries whose recorded mode the operation applied
+	chmodded int
+}
+
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Create missing symlinks for tracked dotfiles",
+	Long: `Create symlinks in the home directory for every tracked dotfile whose home
+path does not exist yet, e.g. after cloning the repository on a new machine.
+
+Entries of packages whose host conditions do not match this machine are
+skipped. Use --package to link only the given packages.
+
+Git repositories recorded as externals of a tracked directory, such as plugin
+checkouts, are cloned into its copy at their recorded commit when missing.
+
+Files offloaded because they were larger than offload_size are fetched from
+offload_store when their content is not on this machine yet.
+
+Entries with a mode recorded by 'dotman chmod' get it, whether they were just
+linked or already were.
+
+Symlinks of entries dropped from the manifest since the last link, e.g. by
+merging the deletion of a dotfile on another machine, are removed after
+confirmation when they still point into the dotman directory. Each is backed
+up first to backup_dir, or dotman/backups in $XDG_STATE_HOME, ~/.local/state
+by default: the content it still leads to, or the symlink itself when its
+copy is gone.
+Declined links are offered again by the next link. Other files left at
+their paths are kept.
+
+The commits made since the last link on this machine, e.g. merged from
+another one, are listed along with the files of entries they added, modified
+or removed, grouped by package. The summary is kept in the journal entry of
+the link.
+
+With the allowed_signers config key set, link refuses to link a HEAD commit
+that is not signed with an SSH key the file allows, see 'dotman init'.
+
+With --release, or the follow_release config key, the given release is
+checked out first, see 'dotman release'.
+
+Every link records this machine in the machines/ directory of the repository,
+committed with the next commit. 'dotman machines list' shows when each
+machine last linked.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		packages, _ := cmd.Flags().GetStringSlice("package")
+		target, _ := cmd.Flags().GetString("release")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		// Stable machines link releases rather than the branch
+		if target == "" {
+			target = cfg.FollowRelease
+		}
+		if target != "" {
+			release, err := followRelease(fsys, cfg, target)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Linking release %s\n", release.Name)
+		}
+
+		op := &linkOperation{
+			fsys:     fsys,
+			ctx:      context.Background(),
+			config:   cfg,
+			packages: packages,
+		}
+
+		// Entries deleted on another machine leave links to nothing behind
+		m, err := manifest.Load(fsys, cfg.DotmanDir)
+		if err != nil {
+			return err
+		}
+		dropped, err := droppedLinks(fsys, cfg, m)
+		if err != nil {
+			return err
+		}
+		if len(dropped) > 0 {
+			fmt.Printf("%d entries were removed from the repository since the last link:\n", len(dropped))
+			for _, link := range dropped {
+				fmt.Printf("  %s\n", link.Path)
+			}
+			op.keepDropped = !confirmDestructive("Remove their symlinks? Each is backed up first.")
+		}
+
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		if op.changes != nil {
+			fmt.Printf("Changes since the last link, %s\n\n", op.changes)
+		}
+		if op.cloned > 0 {
+			fmt.Printf("Cloned %d external repositories\n", op.cloned)
+		}
+		if op.fetched > 0 {
+			fmt.Printf("Fetched %d offloaded files\n", op.fetched)
+		}
+		if op.unlinked > 0 {
+			fmt.Printf("Removed %d symlinks of entries no longer tracked, backed up to %s\n", op.unlinked, op.backup)
+		} else if op.keepDropped {
+			fmt.Printf("Kept %d symlinks of entries no longer tracked\n", len(dropped))
+		}
+		fmt.Printf("Created %d symlinks\n", op.linked)
+		if op.chmodded > 0 {
+			fmt.Printf("Applied the mode of %d entries\n", op.chmodded)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(linkCmd)
+
+	linkCmd.Flags().StringSlice("package", nil, "only link entries of this package. Can be specified multiple times.")
+	linkCmd.RegisterFlagCompletionFunc("package", completePackages)
+	linkCmd.Flags().String("release", "", "check out this release, or latest for the newest one, before linking. Overrides follow_release.")
+}
+
+func (op *linkOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.verifySignature(); err != nil {
+		return err
+	}
+
+	if err := op.preflight(); err != nil {
+		return err
+	}
+
+	if err := op.summarizeChanges(); err != nil {
+		return err
+	}
+
+	if err := op.cloneExternals(); err != nil {
+		return err
+	}
+
+	if err := op.fetchOffloaded(); err != nil {
+		return err
+	}
+
+	if err := op.unlinkDropped(); err != nil {
+		return err
+	}
+
+	if err := op.link(); err != nil {
+		return err
+	}
+
+	if err := op.enforceModes(); err != nil {
+		return err
+	}
+
+	op.recordMachine()
+
+	if err := op.complete(); err != nil {
+		return err
+	}
+	recordState(op.fsys, op.config)
+	return nil
+}
+
+func (op *linkOperation) initialize() error {
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	op.layout = m.Layout
+
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(journal.OperationTypeLink, op.layout.HomeDir(op.config.DotmanDir), "")
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// verifySignature checks that HEAD is signed by one of allowed_signers
+// before anything of the repository is linked or cloned. Without
+// allowed_signers there is nothing to check.
+func (op *linkOperation) verifySignature() error {
+	if op.config.AllowedSigners == "" {
+		return nil
+	}
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify signature of HEAD", op.config.DotmanDir, op.config.AllowedSigners)
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	var details string
+	b, err := loadBackend(op.fsys, op.config.DotmanDir, op.config.Perm())
+	if err == nil {
+		var repo *git.Repository
+		if repo, err = openRepo(op.fsys, op.config.DotmanDir, b); err == nil {
+			var head *plumbing.Reference
+			if head, err = repo.Head(); err == nil {
+				details, err = verifySignature(repo, head.Hash(), op.config.AllowedSigners)
+			}
+		}
+	}
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// preflight checks that the symlinks can be created before any of them is, so
+// a read-only directory does not leave the entries half linked
+func (op *linkOperation) preflight() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Pre-flight checks", op.layout.HomeDir(op.config.DotmanDir), "")
+	if err != nil {
+		return fmt.Errorf("failed to add pre-flight step: %w", err)
+	}
+
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	filter, err := newEntryFilter(op.packages)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	entries, _, homeDir, err := missingEntries(op.fsys, op.config.DotmanDir, filter)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	var problems []string
+	for _, entry := range entries {
+		// System entries fall back to sudo when they are not writable
+		if entry.IsSystem() {
+			continue
+		}
+		if err := dotmanfs.CheckWritable(op.fsys, filepath.Dir(entry.TargetPath(homeDir))); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		err := preflightFailed(problems)
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Checked %d symlink targets", len(entries))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// cloneExternals clones the externals of the selected entries that have no
+// checkout in the dotman directory yet
+func (op *linkOperation) cloneExternals() error {
+	filter, err := newEntryFilter(op.packages)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	type clone struct {
+		dir      string
+		external manifest.External
+	}
+	var clones []clone
+	for _, entry := range m.Entries {
+		if !filter.match(m, entry) {
+			continue
+		}
+		for _, external := range entry.Externals {
+			dir := externalDir(m.Layout, op.config.DotmanDir, entry, external)
+			if _, err := op.fsys.Lstat(dir); os.IsNotExist(err) {
+				clones = append(clones, clone{dir, external})
+			}
+		}
+	}
+	if len(clones) == 0 {
+		return nil
+	}
+
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Clone external repositories", "", op.layout.HomeDir(op.config.DotmanDir))
+	if err != nil {
+		return fmt.Errorf("failed to add clone step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	var rollback journal.Rollback
+	for _, c := range clones {
+		rollback.Created = append(rollback.Created, c.dir)
+	}
+	if err := journal.RecordRollback(op.ctx, step, rollback); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	for _, c := range clones {
+		if err := cloneExternal(op.fsys, op.config, c.dir, c.external); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return err
+		}
+		op.cloned++
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Cloned %d external repositories", op.cloned)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// fetchOffloaded downloads the content of the offloaded files of the selected
+// entries that is not on this machine yet, so their links resolve
+func (op *linkOperation) fetchOffloaded() error {
+	filter, err := newEntryFilter(op.packages)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, entry := range m.Entries {
+		if !filter.match(m, entry) {
+			continue
+		}
+		repoPath := m.Layout.RepoPath(op.config.DotmanDir, entry)
+		missing, err := offload.Missing(op.fsys, op.config.DotmanDir, repoPath)
+		if err != nil {
+			return fmt.Errorf("error checking offloaded files: %w", err)
+		}
+		if len(missing) > 0 {
+			paths = append(paths, repoPath)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeCopy, "Fetch offloaded files", op.config.OffloadStore, filepath.Join(op.config.DotmanDir, offload.Dir))
+	if err != nil {
+		return fmt.Errorf("failed to add fetch step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	blobs, err := offload.New(op.fsys, op.config.OffloadStore)
+	if err == nil {
+		for _, path := range paths {
+			var fetched int
+			fetched, err = offload.Fetch(op.fsys, op.config.DotmanDir, path, blobs)
+			op.fetched += fetched
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("error fetching offloaded files: %w", err)
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Fetched %d offloaded files", op.fetched)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// summarizeChanges records in the journal what the commits made since the
+// last link, e.g. merged from another machine, changed
+func (op *linkOperation) summarizeChanges() error {
+	state, err := loadState(op.fsys)
+	if err != nil {
+		return err
+	}
+	profile, _ := op.config.CurrentProfile()
+	last, ok := state.Repos[profile]
+	if !ok || last.Commit == "" || last.DotmanDir != filepath.Clean(op.config.DotmanDir) {
+		return nil
+	}
+	b, err := loadBackend(op.fsys, op.config.DotmanDir, op.config.Perm())
+	if err != nil {
+		return err
+	}
+	repo, err := openRepo(op.fsys, op.config.DotmanDir, b)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil
+	}
+	changes, err := newChangelog(repo, b, plumbing.NewHash(last.Commit), head.Hash())
+	if err != nil || changes == nil {
+		return err
+	}
+
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Summarize changes since the last link", last.Commit, head.Hash().String())
+	if err != nil {
+		return fmt.Errorf("failed to add summary step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+	if err := journal.CompleteStep(op.ctx, step, changes.String()); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	op.changes = changes
+	return nil
+}
+
+// unlinkDropped removes the symlinks of entries the manifest dropped since
+// it was last applied
+func (op *linkOperation) unlinkDropped() error {
+	if op.keepDropped {
+		return nil
+	}
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	links, err := droppedLinks(op.fsys, op.config, m)
+	if err != nil || len(links) == 0 {
+		return err
+	}
+
+	op.backup, op.unlinked, err = unlinkEntries(op.ctx, op.fsys, op.config, op.layout, links)
+	return err
+}
+
+// unlinkEntries removes the symlinks of links, entries no longer tracked, in
+// a journal step, backing up each first: the content it still leads to, or
+// the symlink itself when its copy is gone. It returns the backup directory
+// and the number of symlinks removed.
+func unlinkEntries(ctx context.Context, fsys dotmanfs.FileSystem, cfg *config.Config, layout manifest.Layout, links []manifest.Entry) (string, int, error) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", 0, fmt.Errorf("error getting user home directory: %w", err)
+	}
+	backup, err := backupDir(fsys, cfg)
+	if err != nil {
+		return "", 0, err
+	}
+
+	step, err := journal.AddStepToCurrentEntry(ctx, journal.StepTypeSymlink, "Remove links of dropped entries", layout.HomeDir(cfg.DotmanDir), backup)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to add unlink step: %w", err)
+	}
+	if err := journal.StartStep(ctx, step); err != nil {
+		return "", 0, fmt.Errorf("failed to start step: %w", err)
+	}
+	if err := journal.RecordRollback(ctx, step, journal.Rollback{Backup: backup}); err != nil {
+		return "", 0, fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	var removed []string
+	for _, link := range links {
+		homePath := link.TargetPath(homeDir)
+		err := backUpLink(fsys, homePath, filepath.Join(backup, link.Path), cfg.Perm())
+		if err == nil {
+			err = (&symlinkLinker{fsys: fsys, sudo: link.IsSystem()}).unlink(homePath)
+		}
+		if err != nil {
+			err = fmt.Errorf("error removing link of dropped entry %s: %w", link.Path, err)
+			if err := journal.FailEntry(ctx, err); err != nil {
+				return backup, len(removed), fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return backup, len(removed), err
+		}
+		removed = append(removed, link.Path)
+	}
+
+	if err := journal.CompleteStep(ctx, step, fmt.Sprintf("Removed %d links: %s", len(removed), strings.Join(removed, ", "))); err != nil {
+		return backup, len(removed), fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return backup, len(removed), nil
+}
+
+// backUpLink copies what the symlink at homePath leads to to dst within
+// perm, or the symlink itself when it is dangling
+func backUpLink(fsys dotmanfs.FileSystem, homePath, dst string, perm dotmanfs.Perm) error {
+	if err := fsys.MkdirAll(filepath.Dir(dst), perm.DirMode()); err != nil {
+		return err
+	}
+	info, err := fsys.Stat(homePath)
+	switch {
+	case err != nil:
+		return dotmanfs.CopySymlink(fsys, homePath, dst)
+	case info.IsDir():
+		return dotmanfs.CopyDir(fsys, homePath, dst, dotmanfs.CopyOptions{Perm: perm})
+	}
+	return dotmanfs.CopyFile(fsys, homePath, dst, perm)
+}
+
+func (op *linkOperation) link() error {
+	// Add symlink step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, "Link tracked entries", op.layout.HomeDir(op.config.DotmanDir), "")
+	if err != nil {
+		return fmt.Errorf("failed to add link step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	filter, err := newEntryFilter(op.packages)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := recordLinkRollback(op.ctx, step, op.fsys, op.config.DotmanDir, filter); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	linked, err := linkMissingEntries(op.fsys, op.config, filter)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+	op.linked = linked
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Created %d missing symlinks", linked)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// enforceModes gives the selected entries the modes recorded for them
+func (op *linkOperation) enforceModes() error {
+	filter, err := newEntryFilter(op.packages)
+	if err != nil {
+		return err
+	}
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(m.Entries, func(entry manifest.Entry) bool {
+		return entry.Mode != "" && filter.match(m, entry)
+	}) {
+		return nil
+	}
+
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Apply recorded modes", op.layout.HomeDir(op.config.DotmanDir), "")
+	if err != nil {
+		return fmt.Errorf("failed to add mode step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	op.chmodded, err = enforceModes(op.fsys, op.config, filter)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Applied the mode of %d entries", op.chmodded)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// recordMachine records in the machine registry that this machine linked
+// the repository. The registry is informational, a machine it cannot be
+// written for is warned about instead of failing the link.
+func (op *linkOperation) recordMachine() {
+	// A machine without an ID is still worth recording
+	id, _ := machineID(op.fsys)
+	hostname, err := os.Hostname()
+	if err == nil {
+		err = machines.Record(op.fsys, op.config.DotmanDir, machines.Machine{
+			ID:       id,
+			Hostname: hostname,
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			Version:  version.Get().Version,
+			LastLink: time.Now().UTC(),
+		}, op.config.Perm())
+	}
+	if err != nil {
+		fmt.Printf("Warning: not recorded in the machine registry: %v\n", err)
+	}
+}
+
+func (op *linkOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
+
+// entryFilter selects the manifest entries an operation applies to
+type entryFilter struct {
+	// packages to include, all packages when empty
+	packages []string
+	// hostname matched against package host conditions
+	hostname string
+}
+
+// newEntryFilter returns a filter for the given packages on this machine
+func newEntryFilter(packages []string) (entryFilter, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return entryFilter{}, fmt.Errorf("error getting hostname: %w", err)
+	}
+	return entryFilter{packages: packages, hostname: hostname}, nil
+}
+
+// inPackages reports whether entry belongs to one of the selected packages
+func (f entryFilter) inPackages(entry manifest.Entry) bool {
+	return len(f.packages) == 0 || slices.Contains(f.packages, entry.Package)
+}
+
+// match reports whether entry is in the selected packages and enabled on this host
+func (f entryFilter) match(m *manifest.Manifest, entry manifest.Entry) bool {
+	return f.inPackages(entry) && m.AppliesToHost(entry, f.hostname)
+}
+
+// missingEntries returns the manifest entries matching filter whose home path
+// does not exist, along with the home directory they are linked into. The
+// included paths of a partially tracked directory stand for it.
+func missingEntries(fsys dotmanfs.FileSystem, dotmanDir string, filter entryFilter) ([]manifest.Entry, manifest.Layout, string, error) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, manifest.Layout{}, "", fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil {
+		return nil, manifest.Layout{}, "", err
+	}
+
+	// Entries tracked in place are never linked
+	if m.InPlace() {
+		return nil, m.Layout, homeDir, nil
+	}
+
+	var entries []manifest.Entry
+	for _, entry := range m.Entries {
+		if !filter.match(m, entry) {
+			continue
+		}
+
+		// The included paths of a partially tracked directory are linked
+		// one by one
+		for _, link := range entry.Links() {
+			if _, err := fsys.Lstat(link.TargetPath(homeDir)); err == nil || !os.IsNotExist(err) {
+				continue
+			}
+			entries = append(entries, link)
+		}
+	}
+
+	return entries, m.Layout, homeDir, nil
+}
+
+// recordLinkRollback records that undoing a link step removes the symlinks
+// linkMissingEntries is about to create
+func recordLinkRollback(ctx context.Context, step *journal.Step, fsys dotmanfs.FileSystem, dotmanDir string, filter entryFilter) error {
+	entries, _, homeDir, err := missingEntries(fsys, dotmanDir, filter)
+	if err != nil {
+		return err
+	}
+
+	var rollback journal.Rollback
+	for _, entry := range entries {
+		rollback.Created = append(rollback.Created, entry.TargetPath(homeDir))
+	}
+	return journal.RecordRollback(ctx, step, rollback)
+}
+
+// linkMissingEntries links manifest entries matching filter whose home path
+// does not exist, by the link_mode of cfg
+func linkMissingEntries(fsys dotmanfs.FileSystem, cfg *config.Config, filter entryFilter) (int, error) {
+	dotmanDir := cfg.DotmanDir
+	entries, layout, homeDir, err := missingEntries(fsys, dotmanDir, filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil {
+		return 0, err
+	}
+	l := newLinker(fsys, cfg, m)
+	if err := l.available(); err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for _, entry := range entries {
+		homePath := entry.TargetPath(homeDir)
+
+		// System entries may need sudo to be linked outside the home directory
+		mkdirAll := fsys.MkdirAll
+		if entry.IsSystem() {
+			mkdirAll = func(path string, perm os.FileMode) error { return systemMkdirAll(fsys, path, perm) }
+		}
+
+		// A copy linking to blobs that are not in the store would leave
+		// dangling links in the home directory
+		repoPath := layout.RepoPath(dotmanDir, entry)
+		missing, err := store.Missing(fsys, dotmanDir, repoPath)
+		if err != nil {
+			return linked, fmt.Errorf("error checking tracked copy of %s: %w", entry.Path, err)
+		}
+		if len(missing) > 0 {
+			return linked, fmt.Errorf("tracked copy of %s links to %d missing store blobs", entry.Path, len(missing))
+		}
+
+		if err := mkdirAll(filepath.Dir(homePath), cfg.DirPerm()); err != nil {
+			return linked, fmt.Errorf("error creating parent directory for %s: %w", homePath, err)
+		}
+
+		if err := entryLinker(fsys, l, entry).link(repoPath, homePath); err != nil {
+			return linked, fmt.Errorf("error linking %s: %w", homePath, err)
+		}
+
+		recordChecksums(fsys, dotmanDir, repoPath)
+		linked++
+	}
+
+	return linked, nil
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/machines"
+	"github.com/noosxe/dotman/internal/offload"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestLinkOperation(t *testing.T) {
+	// Create mock filesystem with dotman structure
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	// Setup test config
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	// Track two files, one of which is already linked
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".config/nvim","type":"directory"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(dotmanDir, "data/.config/nvim"), 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.config/nvim/init.lua"), []byte("nvim"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	op := &linkOperation{
+		fsys:   fsys,
+		ctx:    context.Background(),
+		config: cfg,
+	}
+
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+
+	if op.linked != 1 {
+		t.Fatalf("expected 1 symlink to be created, got %d", op.linked)
+	}
+
+	data, err := fsys.ReadFile(filepath.Join(testutil.TestHomeDir, ".config/nvim/init.lua"))
+	if err != nil {
+		t.Fatalf("expected .config/nvim to be linked: %v", err)
+	}
+	if string(data) != "nvim" {
+		t.Fatalf("expected content 'nvim', got '%s'", data)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeLink, journal.EntryStateCompleted, 2)
+	testutil.VerifyStepWithDetails(t, entry.Steps[0], journal.StepTypeVerify, journal.StepStatusCompleted, "Pre-flight checks", "Checked 1 symlink targets")
+	testutil.VerifyStepWithDetails(t, entry.Steps[1], journal.StepTypeSymlink, journal.StepStatusCompleted, "Link tracked entries", "Created 1 missing symlinks")
+
+	// The machine is recorded in the registry of the repository
+	hostname, _ := os.Hostname()
+	list, err := machines.List(fsys, dotmanDir)
+	if err != nil || len(list) != 1 || list[0].Hostname != hostname {
+		t.Fatalf("expected %s in the machine registry, got %v (%v)", hostname, list, err)
+	}
+}
+
+func TestLinkOperation_Preflight(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".config/nvim/init.lua","type":"file"}]}`
+	fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644)
+	fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh"), 0644)
+	fsys.MkdirAll(filepath.Join(dotmanDir, "data/.config/nvim"), 0755)
+	fsys.WriteFile(filepath.Join(dotmanDir, "data/.config/nvim/init.lua"), []byte("nvim"), 0644)
+
+	// A dangling .config symlink makes the nvim link impossible
+	fsys.Symlink("mnt/config", filepath.Join(testutil.TestHomeDir, ".config"))
+
+	op := &linkOperation{
+		fsys:   fsys,
+		ctx:    context.Background(),
+		config: cfg,
+	}
+	err = op.run()
+	if err == nil || !strings.Contains(err.Error(), "pre-flight checks failed") {
+		t.Fatalf("expected the pre-flight checks to fail, got %v", err)
+	}
+
+	// Nothing was linked, not even the entry that could have been
+	if _, err := fsys.Lstat(filepath.Join(testutil.TestHomeDir, ".zshrc")); err == nil {
+		t.Fatal("expected .zshrc not to be linked after a failed pre-flight check")
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeLink, journal.EntryStateFailed, 1)
+	testutil.VerifyStep(t, entry.Steps[0], journal.StepTypeVerify, journal.StepStatusFailed, "Pre-flight checks")
+}
+
+func TestLinkMissingEntries_PackagesAndHosts(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+	cfg := &config.Config{DotmanDir: dotmanDir}
+
+	manfile := `{
+		"entries": [
+			{"path": ".zshrc", "type": "file", "package": "zsh"},
+			{"path": ".vimrc", "type": "file", "package": "vim"},
+			{"path": ".work", "type": "file", "package": "work-only"}
+		],
+		"packages": {"work-only": {"hosts": ["work-*"]}}
+	}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	for _, name := range []string{".zshrc", ".vimrc", ".work"} {
+		if err := fsys.WriteFile(filepath.Join(dotmanDir, "data", name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+
+	// Only the selected package is linked
+	linked, err := linkMissingEntries(fsys, cfg, entryFilter{packages: []string{"zsh"}, hostname: "laptop"})
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if linked != 1 {
+		t.Fatalf("expected 1 symlink to be created, got %d", linked)
+	}
+	if _, err := fsys.Stat(filepath.Join(testutil.TestHomeDir, ".vimrc")); err == nil {
+		t.Fatal("expected .vimrc not to be linked")
+	}
+
+	// Host conditions skip work-only on other machines
+	linked, err = linkMissingEntries(fsys, cfg, entryFilter{hostname: "laptop"})
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if linked != 1 {
+		t.Fatalf("expected only .vimrc to be linked, got %d symlinks", linked)
+	}
+
+	linked, err = linkMissingEntries(fsys, cfg, entryFilter{hostname: "work-desktop"})
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if linked != 1 {
+		t.Fatalf("expected .work to be linked on a work host, got %d symlinks", linked)
+	}
+}
+
+func TestLinkOperation_Externals(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMockFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.NetworkRetries = "0"
+
+	// The plugin's upstream has moved on since the recorded commit
+	upstream := "home/upstream"
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, upstream)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, upstream, "plugin/foo.lua", "foo")
+	recorded, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, upstream, "plugin/foo.lua", "foo v2")
+
+	manfile := fmt.Sprintf(`{"entries":[{"path":".config/nvim","type":"directory","externals":[{"path":"pack/plugins/start/foo","url":%q,"commit":%q}]}]}`,
+		fsys.RealPath(upstream), recorded.Hash().String())
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(dotmanDir, "data/.config/nvim"), 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.config/nvim/init.lua"), []byte("nvim"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.cloned != 1 || op.linked != 1 {
+		t.Fatalf("expected 1 clone and 1 symlink, got %d and %d", op.cloned, op.linked)
+	}
+
+	// The checkout is at the recorded commit, reachable through the symlink
+	data, err := fsys.ReadFile(filepath.Join(testutil.TestHomeDir, ".config/nvim/pack/plugins/start/foo/plugin/foo.lua"))
+	if err != nil || string(data) != "foo" {
+		t.Fatalf("expected the recorded commit to be checked out, got %q (%v)", data, err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeLink, journal.EntryStateCompleted, 3)
+	testutil.VerifyStepWithDetails(t, entry.Steps[1], journal.StepTypeGit, journal.StepStatusCompleted, "Clone external repositories", "Cloned 1 external repositories")
+
+	// A checkout that exists is left alone
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.cloned != 0 {
+		t.Errorf("expected nothing to clone, got %d", op.cloned)
+	}
+}
+
+func TestLinkOperation_Offload(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.OffloadSize = "1K"
+	cfg.OffloadStore = "/blobs"
+
+	manfile := `{"entries":[{"path":".wallpaper.png","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	dataFile := filepath.Join(dotmanDir, "data/.wallpaper.png")
+	if err := fsys.WriteFile(dataFile, []byte("png"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	blobs, err := offload.New(fsys, cfg.OffloadStore)
+	if err != nil {
+		t.Fatalf("failed to open offload store: %v", err)
+	}
+	if _, err := offload.Offload(fsys, dotmanDir, dataFile, 0, blobs); err != nil {
+		t.Fatalf("failed to offload: %v", err)
+	}
+
+	// A fresh clone has the pointer but not the content
+	if err := fsys.RemoveAll(filepath.Join(dotmanDir, offload.Dir)); err != nil {
+		t.Fatalf("failed to remove local copies: %v", err)
+	}
+
+	op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.fetched != 1 || op.linked != 1 {
+		t.Fatalf("expected 1 fetch and 1 symlink, got %d and %d", op.fetched, op.linked)
+	}
+
+	hash, ok := offload.Resolve(fsys, dataFile)
+	if !ok {
+		t.Fatal("expected the tracked copy to stay a pointer")
+	}
+	data, err := fsys.ReadFile(offload.BlobPath(dotmanDir, hash))
+	if err != nil || string(data) != "png" {
+		t.Fatalf("expected the offloaded content to be fetched, got %q (%v)", data, err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeLink, journal.EntryStateCompleted, 3)
+	testutil.VerifyStepWithDetails(t, entry.Steps[1], journal.StepTypeCopy, journal.StepStatusCompleted, "Fetch offloaded files", "Fetched 1 offloaded files")
+}
+
+func TestLinkOperation_Mode(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	manfile := `{"entries":[{"path":".ssh/config","type":"file","mode":"0600"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	copyPath := filepath.Join(dotmanDir, "data/.ssh/config")
+	if err := fsys.MkdirAll(filepath.Dir(copyPath), 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(copyPath, []byte("Host *"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	op := &linkOperation{
+		fsys:   fsys,
+		ctx:    context.Background(),
+		config: cfg,
+	}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.chmodded != 1 {
+		t.Errorf("expected the mode of 1 entry to be applied, got %d", op.chmodded)
+	}
+
+	info, err := fsys.Stat(filepath.Join(testutil.TestHomeDir, ".ssh/config"))
+	if err != nil {
+		t.Fatalf("failed to stat linked file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// doctor reports the mode once it drifts
+	problems, err := checkHealth(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %+v", problems)
+	}
+	if err := fsys.Chmod(copyPath, 0644); err != nil {
+		t.Fatalf("failed to chmod copy: %v", err)
+	}
+	problems, err = checkHealth(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to check health: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Check != "mode" {
+		t.Errorf("expected a mode problem, got %+v", problems)
+	}
+}
+
+func TestLinkOperation_Dropped(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "")
+
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"},{"path":".bashrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	for _, name := range []string{".zshrc", ".vimrc", ".bashrc"} {
+		if err := fsys.WriteFile(filepath.Join(dotmanDir, "data", name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+	op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+
+	// A merge deletes .vimrc and drops .bashrc, whose link was replaced by
+	// a file
+	bashrc := filepath.Join(testutil.TestHomeDir, ".bashrc")
+	fsys.Remove(bashrc)
+	fsys.WriteFile(bashrc, []byte("local"), 0644)
+	fsys.Remove(filepath.Join(dotmanDir, "data/.vimrc"))
+	manfile = `{"entries":[{"path":".zshrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	// Declined links stay and are offered again
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg, keepDropped: true}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.unlinked != 0 {
+		t.Errorf("expected declined links to be kept, got %d removed", op.unlinked)
+	}
+
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.unlinked != 1 {
+		t.Errorf("expected 1 link to be removed, got %d", op.unlinked)
+	}
+	if _, err := fsys.Lstat(filepath.Join(testutil.TestHomeDir, ".vimrc")); !os.IsNotExist(err) {
+		t.Errorf("expected the link of .vimrc to be removed, got %v", err)
+	}
+	// The dangling link is backed up as it was
+	if target, err := fsys.Readlink(filepath.Join(op.backup, ".vimrc")); err != nil || target != filepath.Join(dotmanDir, "data/.vimrc") {
+		t.Errorf("expected the link of .vimrc to be backed up, got %q (%v)", target, err)
+	}
+	if data, err := fsys.ReadFile(bashrc); err != nil || string(data) != "local" {
+		t.Errorf("expected the file at .bashrc to be kept, got %q (%v)", data, err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeLink, journal.EntryStateCompleted, 3)
+	testutil.VerifyStepWithDetails(t, entry.Steps[1], journal.StepTypeSymlink, journal.StepStatusCompleted, "Remove links of dropped entries", "Removed 1 links: .vimrc")
+
+	// Nothing is dropped twice
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if op.unlinked != 0 {
+		t.Errorf("expected no link to be removed again, got %d", op.unlinked)
+	}
+}
+
+func TestLinkOperation_Locations(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "")
+
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	// The journal and backups are kept on another disk
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.JournalDir = "/mnt/local/journal"
+	cfg.BackupDir = "/mnt/local/backups"
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	for _, name := range []string{".zshrc", ".vimrc"} {
+		if err := fsys.WriteFile(filepath.Join(dotmanDir, "data", name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+	op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+
+	manfile = `{"entries":[{"path":".zshrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if !strings.HasPrefix(op.backup, cfg.BackupDir+string(filepath.Separator)) {
+		t.Errorf("expected the backup in %s, got %s", cfg.BackupDir, op.backup)
+	}
+	if _, err := fsys.Lstat(filepath.Join(op.backup, ".vimrc")); err != nil {
+		t.Errorf("expected the link of .vimrc to be backed up: %v", err)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	if _, err := fsys.Stat(filepath.Join(cfg.JournalDir, config.DefaultProfile, "completed", entry.ID+".json")); err != nil {
+		t.Errorf("expected the entry in journal_dir: %v", err)
+	}
+	if entries, _ := fsys.Readdir(filepath.Join(dotmanDir, "journal", "completed")); len(entries) != 0 {
+		t.Errorf("expected nothing in the journal of the repository, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// linker puts the tracked copy of an entry in place at its home path and
+// tells whether it still is. The link_mode config key picks one per machine,
+// the worktree backend has its own. Commands that link entries go through
+// it, so a new platform or mode only needs a new linker.
+type linker interface {
+	// mode returns the link_mode value selecting the linker
+	mode() string
+	// available fails when the linker cannot work on this platform
+	available() error
+	// link puts the copy at repoPath in place at homePath, which does not
+	// exist
+	link(repoPath, homePath string) error
+	// unlink removes what link put at homePath
+	unlink(homePath string) error
+	// state returns the link state of homePath, see linkState
+	state(homePath, repoPath string) string
+}
+
+// newLinker returns the linker of the repository with manifest m, by the
+// link_mode of cfg
+func newLinker(fsys dotmanfs.FileSystem, cfg *config.Config, m *manifest.Manifest) linker {
+	if m.InPlace() {
+		return &worktreeLinker{fsys: fsys}
+	}
+	switch cfg.LinkMode {
+	case config.LinkHardlink:
+		return &hardlinkLinker{fsys: fsys, perm: cfg.Perm()}
+	case config.LinkCopy:
+		return &copyLinker{fsys: fsys, perm: cfg.Perm()}
+	case config.LinkJunction:
+		return &junctionLinker{hardlinkLinker{fsys: fsys, perm: cfg.Perm()}}
+	}
+	return &symlinkLinker{fsys: fsys}
+}
+
+// crlfPlatform reports whether text files use CRLF line endings on this
+// platform, replaced in tests
+var crlfPlatform = runtime.GOOS == "windows"
+
+// entryLinker returns the linker putting entry in place: l, except that
+// system files are always symlinked, with sudo where the current user lacks
+// permission, as hard links and copies would not survive package upgrades
+// rewriting them. Copies of entries stored with LF line endings are
+// rendered with the line endings of the platform.
+func entryLinker(fsys dotmanfs.FileSystem, l linker, entry manifest.Entry) linker {
+	if entry.IsSystem() {
+		return &symlinkLinker{fsys: fsys, sudo: true}
+	}
+	if c, ok := l.(*copyLinker); ok && entry.LineEndings == manifest.LineEndingsLF && crlfPlatform {
+		return &copyLinker{fsys: c.fsys, perm: c.perm, crlf: true}
+	}
+	return l
+}
+
+// entryState returns the link state of entry by linker l. A partially
+// tracked directory takes the state of the first included path that is not
+// linked.
+func entryState(fsys dotmanfs.FileSystem, l linker, dotmanDir string, m *manifest.Manifest, entry manifest.Entry, homeDir string) string {
+	for _, link := range entry.Links() {
+		state := entryLinker(fsys, l, link).state(link.TargetPath(homeDir), m.Layout.RepoPath(dotmanDir, link))
+		if state != "linked" {
+			return state
+		}
+	}
+	return "linked"
+}
+
+// symlinkLinker links entries with symlinks to their copies
+type symlinkLinker struct {
+	fsys dotmanfs.FileSystem
+	// retry with sudo when permission is denied, for system files
+	sudo bool
+}
+
+func (l *symlinkLinker) mode() string {
+	return config.LinkSymlink
+}
+
+func (l *symlinkLinker) available() error {
+	return nil
+}
+
+func (l *symlinkLinker) link(repoPath, homePath string) error {
+	if l.sudo {
+		return systemSymlink(l.fsys, repoPath, homePath)
+	}
+	return l.fsys.Symlink(repoPath, homePath)
+}
+
+func (l *symlinkLinker) unlink(homePath string) error {
+	if l.sudo {
+		return systemRemoveAll(l.fsys, homePath)
+	}
+	return l.fsys.Remove(homePath)
+}
+
+func (l *symlinkLinker) state(homePath, repoPath string) string {
+	return linkState(l.fsys, homePath, repoPath)
+}
+
+// hardlinkLinker recreates the directories of entries and hard links their
+// files to the copies, so programs that refuse symlinks see regular files.
+// Symlinks inside the copies are recreated as they are.
+type hardlinkLinker struct {
+	fsys dotmanfs.FileSystem
+	// limits the permissions of the directories created
+	perm dotmanfs.Perm
+}
+
+func (l *hardlinkLinker) mode() string {
+	return config.LinkHardlink
+}
+
+func (l *hardlinkLinker) available() error {
+	return nil
+}
+
+func (l *hardlinkLinker) link(repoPath, homePath string) error {
+	return mirrorTree(l.fsys, repoPath, homePath, l.perm, func(src, dst string, d fs.DirEntry) error {
+		return l.fsys.Link(src, dst)
+	})
+}
+
+func (l *hardlinkLinker) unlink(homePath string) error {
+	return l.fsys.RemoveAll(homePath)
+}
+
+func (l *hardlinkLinker) state(homePath, repoPath string) string {
+	return treeState(l.fsys, homePath, repoPath, func(src, dst string) bool {
+		srcInfo, err := l.fsys.Stat(src)
+		if err != nil {
+			return false
+		}
+		dstInfo, err := l.fsys.Stat(dst)
+		return err == nil && dotmanfs.SameFile(srcInfo, dstInfo)
+	})
+}
+
+// copyLinker copies entries into place, for filesystems without links. A
+// copy edited in the home directory no longer matches the tracked one.
+type copyLinker struct {
+	fsys dotmanfs.FileSystem
+	// limits the permissions of the copies
+	perm dotmanfs.Perm
+	// render the line endings of text files as CRLF
+	crlf bool
+}
+
+func (l *copyLinker) mode() string {
+	return config.LinkCopy
+}
+
+func (l *copyLinker) available() error {
+	return nil
+}
+
+func (l *copyLinker) link(repoPath, homePath string) error {
+	return mirrorTree(l.fsys, repoPath, homePath, l.perm, func(src, dst string, d fs.DirEntry) error {
+		if l.crlf {
+			return dotmanfs.CopyFileCRLF(l.fsys, src, dst, l.perm)
+		}
+		return dotmanfs.CopyFile(l.fsys, src, dst, l.perm)
+	})
+}
+
+func (l *copyLinker) unlink(homePath string) error {
+	return l.fsys.RemoveAll(homePath)
+}
+
+func (l *copyLinker) state(homePath, repoPath string) string {
+	return treeState(l.fsys, homePath, repoPath, func(src, dst string) bool {
+		if l.crlf {
+			return dotmanfs.VerifyFileCRLF(l.fsys, src, dst) == nil
+		}
+		return dotmanfs.VerifyFile(l.fsys, src, dst) == nil
+	})
+}
+
+// junctionLinker links directory entries with junctions and hard links file
+// entries, neither of which needs the privilege Windows asks for symlinks
+type junctionLinker struct {
+	hardlinkLinker
+}
+
+func (l *junctionLinker) mode() string {
+	return config.LinkJunction
+}
+
+func (l *junctionLinker) available() error {
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("link_mode %s only works on Windows", config.LinkJunction)
+	}
+	return nil
+}
+
+func (l *junctionLinker) link(repoPath, homePath string) error {
+	info, err := l.fsys.Lstat(repoPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return dotmanfs.Junction(l.fsys, repoPath, homePath)
+	}
+	return l.hardlinkLinker.link(repoPath, homePath)
+}
+
+// unlink removes the junction only, never the copy it leads to
+func (l *junctionLinker) unlink(homePath string) error {
+	return l.fsys.Remove(homePath)
+}
+
+func (l *junctionLinker) state(homePath, repoPath string) string {
+	if _, err := l.fsys.Lstat(homePath); err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return "error"
+	}
+	repoInfo, err := l.fsys.Stat(repoPath)
+	if err != nil {
+		return "no data"
+	}
+	if !repoInfo.IsDir() {
+		return l.hardlinkLinker.state(homePath, repoPath)
+	}
+	homeInfo, err := l.fsys.Stat(homePath)
+	if err != nil {
+		return "broken"
+	}
+	if !dotmanfs.SameFile(homeInfo, repoInfo) {
+		return "replaced"
+	}
+	return "linked"
+}
+
+// worktreeLinker is the linker of the worktree backend, which tracks entries
+// where they are, so there is nothing to link
+type worktreeLinker struct {
+	fsys dotmanfs.FileSystem
+}
+
+func (l *worktreeLinker) mode() string {
+	return manifest.BackendWorktree
+}
+
+func (l *worktreeLinker) available() error {
+	return nil
+}
+
+func (l *worktreeLinker) link(repoPath, homePath string) error {
+	return nil
+}
+
+func (l *worktreeLinker) unlink(homePath string) error {
+	return nil
+}
+
+// state is "in place" while the entry exists
+func (l *worktreeLinker) state(homePath, repoPath string) string {
+	if _, err := l.fsys.Lstat(homePath); err != nil {
+		return "missing"
+	}
+	return "in place"
+}
+
+// mirrorTree recreates the copy at src at dst: directories are created
+// within perm, symlinks copied and regular files put there by file
+func mirrorTree(fsys dotmanfs.FileSystem, src, dst string, perm dotmanfs.Perm, file func(src, dst string, d fs.DirEntry) error) error {
+	// WalkDir would walk a copy that is a symlink to a directory
+	info, err := fsys.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return dotmanfs.CopySymlink(fsys, src, dst)
+	}
+
+	return fsys.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case d.IsDir():
+			return fsys.MkdirAll(target, perm.DirMode())
+		case d.Type()&fs.ModeSymlink != 0:
+			return dotmanfs.CopySymlink(fsys, path, target)
+		default:
+			return file(path, target, d)
+		}
+	})
+}
+
+// errDiffers stops treeState at the first file that differs
+var errDiffers = errors.New("differs from the tracked copy")
+
+// treeState returns the link state of the tree mirrorTree put at homePath:
+// linked while every regular file of the copy at repoPath has a counterpart
+// same reports as the same, and every symlink points where it does
+func treeState(fsys dotmanfs.FileSystem, homePath, repoPath string, same func(src, dst string) bool) string {
+	homeInfo, err := fsys.Lstat(homePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return "error"
+	}
+	repoInfo, err := fsys.Lstat(repoPath)
+	if err != nil {
+		return "no data"
+	}
+	if homeInfo.Mode().Type() != repoInfo.Mode().Type() {
+		return "replaced"
+	}
+	if repoInfo.Mode()&fs.ModeSymlink != 0 {
+		if dotmanfs.VerifySymlink(fsys, repoPath, homePath) != nil {
+			return "replaced"
+		}
+		return "linked"
+	}
+
+	err = fsys.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(homePath, rel)
+
+		switch {
+		case d.IsDir():
+			if info, err := fsys.Lstat(target); err != nil || !info.IsDir() {
+				return errDiffers
+			}
+		case d.Type()&fs.ModeSymlink != 0:
+			if dotmanfs.VerifySymlink(fsys, path, target) != nil {
+				return errDiffers
+			}
+		default:
+			if !same(path, target) {
+				return errDiffers
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errDiffers) {
+		return "replaced"
+	}
+	if err != nil {
+		return "error"
+	}
+	return "linked"
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestLinkers(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	repoPath := filepath.Join(dotmanDir, "data/.config/nvim")
+	if err := fsys.MkdirAll(filepath.Join(repoPath, "lua"), 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(repoPath, "init.lua"), []byte("nvim"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(repoPath, "lua/plugins.lua"), []byte("plugins"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	// Callers create the parent of the home path
+	if err := fsys.MkdirAll(filepath.Join(testutil.TestHomeDir, ".config"), 0755); err != nil {
+		t.Fatalf("failed to create home directory: %v", err)
+	}
+
+	for _, l := range []linker{&symlinkLinker{fsys: fsys}, &hardlinkLinker{fsys: fsys}, &copyLinker{fsys: fsys}} {
+		t.Run(l.mode(), func(t *testing.T) {
+			homePath := filepath.Join(testutil.TestHomeDir, ".config", l.mode())
+
+			if state := l.state(homePath, repoPath); state != "missing" {
+				t.Errorf("expected missing before linking, got %s", state)
+			}
+			if err := l.link(repoPath, homePath); err != nil {
+				t.Fatalf("failed to link: %v", err)
+			}
+			if state := l.state(homePath, repoPath); state != "linked" {
+				t.Errorf("expected linked, got %s", state)
+			}
+
+			data, err := fsys.ReadFile(filepath.Join(homePath, "lua/plugins.lua"))
+			if err != nil {
+				t.Fatalf("failed to read linked file: %v", err)
+			}
+			if string(data) != "plugins" {
+				t.Errorf("expected linked content plugins, got %q", data)
+			}
+
+			if err := l.unlink(homePath); err != nil {
+				t.Fatalf("failed to unlink: %v", err)
+			}
+			if state := l.state(homePath, repoPath); state != "missing" {
+				t.Errorf("expected missing after unlinking, got %s", state)
+			}
+			if _, err := fsys.Stat(filepath.Join(repoPath, "init.lua")); err != nil {
+				t.Errorf("expected unlinking to leave the tracked copy alone, got %v", err)
+			}
+		})
+	}
+
+	// A file replaced in the home directory is no longer linked
+	for _, l := range []linker{&hardlinkLinker{fsys: fsys}, &copyLinker{fsys: fsys}} {
+		homePath := filepath.Join(testutil.TestHomeDir, ".config", l.mode())
+		if err := l.link(repoPath, homePath); err != nil {
+			t.Fatalf("failed to link with %s: %v", l.mode(), err)
+		}
+		if err := fsys.Remove(filepath.Join(homePath, "init.lua")); err != nil {
+			t.Fatalf("failed to remove linked file: %v", err)
+		}
+		if err := fsys.WriteFile(filepath.Join(homePath, "init.lua"), []byte("edited"), 0644); err != nil {
+			t.Fatalf("failed to write home file: %v", err)
+		}
+		if state := l.state(homePath, repoPath); state != "replaced" {
+			t.Errorf("expected %s link of an edited file to be replaced, got %s", l.mode(), state)
+		}
+	}
+}
+
+func TestCopyLinkerCRLF(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	repoPath := filepath.Join(dotmanDir, "data/.config/app")
+	if err := fsys.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(repoPath, "app.conf"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(repoPath, "app.bin"), []byte("\x00\n"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(testutil.TestHomeDir, ".config"), 0755); err != nil {
+		t.Fatalf("failed to create home directory: %v", err)
+	}
+
+	saved := crlfPlatform
+	crlfPlatform = true
+	defer func() { crlfPlatform = saved }()
+
+	copies := &copyLinker{fsys: fsys}
+	if l := entryLinker(fsys, copies, manifest.Entry{Path: ".config/app"}); l != copies {
+		t.Error("expected entries keeping their line endings to be copied as they are")
+	}
+	l := entryLinker(fsys, copies, manifest.Entry{Path: ".config/app", LineEndings: manifest.LineEndingsLF})
+	homePath := filepath.Join(testutil.TestHomeDir, ".config/app")
+	if err := l.link(repoPath, homePath); err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+
+	want := map[string]string{"app.conf": "a\r\nb\r\n", "app.bin": "\x00\n"}
+	for name, content := range want {
+		if data, err := fsys.ReadFile(filepath.Join(homePath, name)); err != nil || string(data) != content {
+			t.Errorf("%s has %q (%v), want %q", name, data, err, content)
+		}
+	}
+	if state := l.state(homePath, repoPath); state != "linked" {
+		t.Errorf("expected the rendered copy to be linked, got %s", state)
+	}
+	if state := copies.state(homePath, repoPath); state != "replaced" {
+		t.Errorf("expected the rendered copy to differ from the tracked one, got %s", state)
+	}
+}
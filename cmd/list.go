@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tracked dotfiles",
+	Long: `List tracked dotfiles with their package and link state. Entries of packages
+disabled on this host are shown as "other host".
+
+With the secrets_profile config key set, the entries of the secrets repository
+are listed too, and a last column shows the profile whose repository tracks
+each entry. --repo lists the entries of a single profile's repository.
+
+The last column shows the tags and note set with annotate.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		packages, _ := cmd.Flags().GetStringSlice("package")
+		repo, _ := cmd.Flags().GetString("repo")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		homeDir, err := fsys.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get user home directory: %w", err)
+		}
+
+		repos, err := listedRepos(cfg, repo)
+		if err != nil {
+			return err
+		}
+
+		filter, err := newEntryFilter(packages)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		listed := 0
+		for _, r := range repos {
+			m, err := manifest.Load(fsys, r.config.DotmanDir)
+			if err != nil {
+				return fmt.Errorf("failed to load manifest: %w", err)
+			}
+
+			l := newLinker(fsys, r.config, m)
+			for _, entry := range m.Entries {
+				if !filter.inPackages(entry) {
+					continue
+				}
+
+				state := "other host"
+				if m.AppliesToHost(entry, filter.hostname) {
+					state = entryState(fsys, l, r.config.DotmanDir, m, entry, homeDir)
+				}
+
+				pkg := entry.Package
+				if pkg == "" {
+					pkg = "-"
+				}
+
+				if len(repos) > 1 {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Path, entry.Type, pkg, state, r.name, annotation(entry))
+				} else {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Path, entry.Type, pkg, state, annotation(entry))
+				}
+				listed++
+			}
+		}
+
+		if listed == 0 {
+			fmt.Println("No tracked dotfiles")
+			return nil
+		}
+
+		return w.Flush()
+	},
+}
+
+// annotation formats the tags and note of an entry for a listing
+func annotation(entry manifest.Entry) string {
+	var parts []string
+	if entry.Alias != "" {
+		parts = append(parts, "alias "+entry.Alias)
+	}
+	if len(entry.Tags) > 0 {
+		parts = append(parts, "["+strings.Join(entry.Tags, ", ")+"]")
+	}
+	if entry.Note != "" {
+		parts = append(parts, entry.Note)
+	}
+	return strings.Join(parts, " ")
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringSlice("package", nil, "only list entries of this package. Can be specified multiple times.")
+	listCmd.RegisterFlagCompletionFunc("package", completePackages)
+	listCmd.Flags().String("repo", "", "only list entries of the repository of this profile")
+	listCmd.RegisterFlagCompletionFunc("repo", completeProfiles)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/machines"
+	"github.com/spf13/cobra"
+)
+
+var machinesCmd = &cobra.Command{
+	Use:   "machines",
+	Short: "Show the machines that link the repository",
+	Long: `Show the machines that link the repository. Every link records the machine it
+runs on in the machines/ directory of the repository: its hostname, OS, the
+dotman version and when it last linked. The records are committed and pushed
+with the dotfiles, so every machine sees the others.`,
+}
+
+var machinesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the machines and which of them are stale",
+	Long: `List the machines of the registry, marking this one with * and those that
+have not linked for longer than --stale-after as stale. A stale machine
+likely runs old dotfiles, or is not used anymore.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		staleAfter, _ := cmd.Flags().GetString("stale-after")
+		age, err := config.ParseAge(staleAfter)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		list, err := machines.List(fsys, cfg.DotmanDir)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No machines recorded, run 'dotman link' to record this one")
+			return nil
+		}
+
+		hostname, _ := os.Hostname()
+		printMachines(os.Stdout, list, hostname, time.Now(), age)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(machinesCmd)
+	machinesCmd.AddCommand(machinesListCmd)
+
+	machinesListCmd.Flags().String("stale-after", "30d", "mark machines that have not linked for this long as stale, e.g. 36h or 30d; 0 never does")
+}
+
+// printMachines prints the machines as aligned columns, marking the one
+// named hostname and those that have not linked within age of now
+func printMachines(w io.Writer, list []machines.Machine, hostname string, now time.Time, age time.Duration) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, m := range list {
+		marker := " "
+		if m.Hostname == hostname {
+			marker = "*"
+		}
+		state := ""
+		if m.Stale(now, age) {
+			state = paint(colorYellow, "stale")
+		}
+		fmt.Fprintf(tw, "%s %s\t%s/%s\t%s\t%s\t%s\n", marker, m.Hostname, m.OS, m.Arch, m.Version, m.LastLink.Local().Format(time.RFC3339), state)
+	}
+	tw.Flush()
+}
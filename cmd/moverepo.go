@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+// moveRepoOperation represents the state of a dotman directory relocation
+type moveRepoOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	// config file updated with the new location
+	configPath string
+
+	oldDir string
+	newDir string
+	// the directory was already moved by hand, only links and config are updated
+	alreadyMoved bool
+
+	// symlinks pointing into the old directory, rewritten by the operation
+	relinked []string
+}
+
+var moveRepoCmd = &cobra.Command{
+	Use:   "move-repo <new-dir>",
+	Short: "Move the dotman directory and repoint every symlink to it",
+	Long: `Move the dotman directory to a new location. Every symlink of a tracked
+entry that points into the old directory is rewritten to point into the new
+one and verified, and dotman_dir in the config, or the directory of the active
+profile, is updated.
+
+If the directory was already moved by hand, only the symlinks and the config
+are updated. When the config names the new location already, give the old
+one with --from.`,
+	Example: `  dotman move-repo ~/src/dotfiles
+  dotman move-repo --from ~/.dotman ~/src/dotfiles`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		newDir, err := dotmanfs.AbsHome(fsys, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", args[0], err)
+		}
+
+		oldDir := cfg.DotmanDir
+		if from, _ := cmd.Flags().GetString("from"); from != "" {
+			if oldDir, err = dotmanfs.AbsHome(fsys, from); err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", from, err)
+			}
+		}
+
+		op := &moveRepoOperation{
+			config:     cfg,
+			fsys:       fsys,
+			ctx:        context.Background(),
+			configPath: configPath,
+			oldDir:     oldDir,
+			newDir:     newDir,
+		}
+
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Moved %s to %s and updated %d symlinks\n", op.oldDir, op.newDir, len(op.relinked))
+		if _, ok := os.LookupEnv("DOTMAN_DIR"); ok {
+			fmt.Println("DOTMAN_DIR is set and overrides the config, update it to the new location")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(moveRepoCmd)
+
+	moveRepoCmd.Flags().String("from", "", "the location the directory was moved from, when the config does not name it anymore")
+}
+
+func (op *moveRepoOperation) run() error {
+	if err := op.checkPaths(); err != nil {
+		return err
+	}
+
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.moveDir(); err != nil {
+		return err
+	}
+
+	if err := op.relink(); err != nil {
+		return err
+	}
+
+	if err := op.verify(); err != nil {
+		return err
+	}
+
+	if err := op.updateConfig(); err != nil {
+		return err
+	}
+
+	if err := op.complete(); err != nil {
+		return err
+	}
+	recordState(op.fsys, op.config)
+	return nil
+}
+
+// checkPaths validates the new location and detects a directory that was
+// already moved by hand
+func (op *moveRepoOperation) checkPaths() error {
+	op.oldDir = filepath.Clean(op.oldDir)
+	op.newDir = filepath.Clean(op.newDir)
+
+	if op.newDir == op.oldDir {
+		return fmt.Errorf("%s is already the dotman directory", op.newDir)
+	}
+	if isWithin(op.oldDir, op.newDir) {
+		return fmt.Errorf("cannot move the dotman directory into itself")
+	}
+
+	_, oldErr := op.fsys.Stat(op.oldDir)
+	_, newErr := op.fsys.Stat(op.newDir)
+	switch {
+	case oldErr == nil && newErr == nil:
+		return fmt.Errorf("%s already exists", op.newDir)
+	case oldErr == nil:
+		return nil
+	case !os.IsNotExist(oldErr):
+		return fmt.Errorf("error reading dotman directory: %w", oldErr)
+	}
+
+	// The old directory is gone, accept a new one that holds the repository
+	if _, err := op.fsys.Stat(manifest.Path(op.newDir)); err != nil {
+		return fmt.Errorf("dotman directory %s does not exist and %s is not a dotman directory", op.oldDir, op.newDir)
+	}
+	op.alreadyMoved = true
+
+	return nil
+}
+
+func (op *moveRepoOperation) initialize() error {
+	// The journal lives in the dotman directory and moves along with it,
+	// unless journal_dir keeps it elsewhere
+	journalDir := op.oldDir
+	if op.alreadyMoved {
+		journalDir = op.newDir
+	}
+
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, journalDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(journal.OperationTypeRelocate, op.oldDir, op.newDir)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// moveDir moves the dotman directory, copying it when a rename is not
+// possible, e.g. across filesystems
+func (op *moveRepoOperation) moveDir() error {
+	// Add move step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeMove, "Move dotman directory", op.oldDir, op.newDir)
+	if err != nil {
+		return fmt.Errorf("failed to add move step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if op.alreadyMoved {
+		if err := journal.CompleteStep(op.ctx, step, "Directory was already moved"); err != nil {
+			return fmt.Errorf("failed to complete step: %w", err)
+		}
+		return nil
+	}
+
+	if err := op.fsys.MkdirAll(filepath.Dir(op.newDir), op.config.DirPerm()); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("error creating parent directory: %w", err)
+	}
+
+	details := "Renamed dotman directory"
+	if err := op.fsys.Rename(op.oldDir, op.newDir); err != nil {
+		if err := op.copyDir(); err != nil {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return err
+		}
+		details = "Copied and verified dotman directory"
+	}
+
+	// The journal entry moved with the directory, keep writing it there
+	jm := newJournalManager(op.fsys, op.config, op.newDir)
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// copyDir copies the dotman directory to the new location, verifies the copy
+// and only then removes the old directory
+func (op *moveRepoOperation) copyDir() error {
+	if err := dotmanfs.CopyDir(op.fsys, op.oldDir, op.newDir, dotmanfs.CopyOptions{Perm: op.config.Perm()}); err != nil {
+		op.fsys.RemoveAll(op.newDir)
+		return fmt.Errorf("error copying dotman directory: %w", err)
+	}
+
+	if err := dotmanfs.VerifyDir(op.fsys, op.oldDir, op.newDir, dotmanfs.CopyOptions{}); err != nil {
+		op.fsys.RemoveAll(op.newDir)
+		return fmt.Errorf("error verifying dotman directory copy: %w", err)
+	}
+
+	if err := op.fsys.RemoveAll(op.oldDir); err != nil {
+		return fmt.Errorf("error removing old dotman directory: %w", err)
+	}
+
+	return nil
+}
+
+// relink rewrites the symlinks of tracked entries that point into the old
+// directory
+func (op *moveRepoOperation) relink() error {
+	// Add symlink step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, "Rewrite symlinks", op.oldDir, op.newDir)
+	if err != nil {
+		return fmt.Errorf("failed to add symlink step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.relinkEntries(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Rewrote %d symlinks", len(op.relinked))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *moveRepoOperation) relinkEntries() error {
+	homeDir, err := op.fsys.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	m, err := manifest.Load(op.fsys, op.newDir)
+	if err != nil {
+		return err
+	}
+	l := newLinker(op.fsys, op.config, m)
+
+	// Hard links and copies do not depend on where the repository is, only
+	// the symlinks into it need rewriting
+	for _, entry := range m.Entries {
+		homePath := entry.TargetPath(homeDir)
+
+		info, err := op.fsys.Lstat(homePath)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		target, err := op.fsys.Readlink(homePath)
+		if err != nil || filepath.Clean(target) != m.Layout.RepoPath(op.oldDir, entry) {
+			continue
+		}
+
+		// System entries may need sudo to be relinked outside the home directory
+		old := &symlinkLinker{fsys: op.fsys, sudo: entry.IsSystem()}
+		if err := old.unlink(homePath); err != nil {
+			return fmt.Errorf("error removing symlink %s: %w", homePath, err)
+		}
+		if err := entryLinker(op.fsys, l, entry).link(m.Layout.RepoPath(op.newDir, entry), homePath); err != nil {
+			return fmt.Errorf("error relinking %s: %w", homePath, err)
+		}
+
+		op.relinked = append(op.relinked, homePath)
+	}
+
+	return nil
+}
+
+// verify checks that every rewritten symlink points into the new directory
+// and resolves
+func (op *moveRepoOperation) verify() error {
+	// Add verification step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify symlinks", op.newDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	for _, link := range op.relinked {
+		target, err := op.fsys.Readlink(link)
+		if err == nil && !isWithin(op.newDir, target) {
+			err = fmt.Errorf("points to %s", target)
+		}
+		if err == nil {
+			_, err = op.fsys.Stat(link)
+		}
+		if err != nil {
+			err = fmt.Errorf("error verifying symlink %s: %w", link, err)
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return err
+		}
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Verified %d symlinks", len(op.relinked))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// updateConfig points the config file, or the active profile, at the new
+// directory
+func (op *moveRepoOperation) updateConfig() error {
+	// Add config step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeManifest, "Update config", op.oldDir, op.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to add config step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.saveConfig(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Set dotman directory to %s", op.newDir)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *moveRepoOperation) saveConfig() error {
+	// Write the file as it is on disk, not the resolved settings
+	fileCfg, err := config.ReadConfig(op.configPath, op.fsys)
+	if err != nil {
+		return err
+	}
+
+	if name, profile := op.config.CurrentProfile(); profile != nil {
+		profile.DotmanDir = op.newDir
+		if err := fileCfg.AddProfile(name, *profile); err != nil {
+			return err
+		}
+	} else {
+		fileCfg.DotmanDir = op.newDir
+	}
+
+	if err := config.SaveConfig(op.configPath, fileCfg, op.fsys); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+	op.config.DotmanDir = op.newDir
+
+	return nil
+}
+
+func (op *moveRepoOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
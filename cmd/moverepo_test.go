@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestMoveRepoOperation(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	configPath := filepath.Join(testutil.TestHomeDir, ".dotconfig")
+
+	fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(`{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`), 0644)
+	fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh config"), 0644)
+	fsys.WriteFile(filepath.Join(dotmanDir, "data/.vimrc"), []byte("vim config"), 0644)
+
+	// .zshrc is linked, .vimrc was replaced by a local file and is left alone
+	zshrc := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	vimrc := filepath.Join(testutil.TestHomeDir, ".vimrc")
+	fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), zshrc)
+	fsys.WriteFile(vimrc, []byte("local vim"), 0644)
+
+	newDir := filepath.Join(testutil.TestHomeDir, "dev/dotfiles")
+	op := &moveRepoOperation{
+		config:     cfg,
+		fsys:       fsys,
+		ctx:        context.Background(),
+		configPath: configPath,
+		oldDir:     dotmanDir,
+		newDir:     newDir,
+	}
+	if err := op.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+
+	if _, err := fsys.Stat(dotmanDir); err == nil {
+		t.Fatal("expected the old dotman directory to be gone")
+	}
+
+	target, err := fsys.Readlink(zshrc)
+	if err != nil || target != filepath.Join(newDir, "data/.zshrc") {
+		t.Fatalf("expected .zshrc to point into the new directory, got %q (%v)", target, err)
+	}
+	if data, err := fsys.ReadFile(zshrc); err != nil || string(data) != "zsh config" {
+		t.Fatalf("expected .zshrc to resolve, got %q (%v)", data, err)
+	}
+	if data, err := fsys.ReadFile(vimrc); err != nil || string(data) != "local vim" {
+		t.Fatalf("expected the local .vimrc to be untouched, got %q (%v)", data, err)
+	}
+	if len(op.relinked) != 1 {
+		t.Fatalf("expected 1 relinked symlink, got %v", op.relinked)
+	}
+
+	saved, err := config.ReadConfig(configPath, fsys)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if saved.DotmanDir != newDir {
+		t.Fatalf("expected dotman_dir %s in the config, got %s", newDir, saved.DotmanDir)
+	}
+
+	// The journal moved along and records the completed migration
+	jm := journal.NewJournalManager(fsys, filepath.Join(newDir, "journal"))
+	entries, err := jm.ListEntries(journal.EntryStateCompleted)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected 1 completed journal entry, got %d (%v)", len(entries), err)
+	}
+	if entries[0].Operation != journal.OperationTypeRelocate || len(entries[0].Steps) != 4 {
+		t.Fatalf("unexpected journal entry: %+v", entries[0])
+	}
+}
+
+func TestMoveRepoOperation_AlreadyMoved(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(`{"entries":[{"path":".zshrc","type":"file"}]}`), 0644)
+	fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh config"), 0644)
+	zshrc := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), zshrc)
+
+	// The user moved the directory by hand, leaving the symlink dangling
+	newDir := filepath.Join(testutil.TestHomeDir, "dotfiles")
+	if err := fsys.Rename(dotmanDir, newDir); err != nil {
+		t.Fatalf("failed to move directory: %v", err)
+	}
+
+	op := &moveRepoOperation{
+		config:     cfg,
+		fsys:       fsys,
+		ctx:        context.Background(),
+		configPath: filepath.Join(testutil.TestHomeDir, ".dotconfig"),
+		oldDir:     dotmanDir,
+		newDir:     newDir,
+	}
+	if err := op.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if !op.alreadyMoved {
+		t.Fatal("expected the manual move to be detected")
+	}
+	if data, err := fsys.ReadFile(zshrc); err != nil || string(data) != "zsh config" {
+		t.Fatalf("expected .zshrc to resolve again, got %q (%v)", data, err)
+	}
+
+	// Moving into the repository itself is refused
+	op = &moveRepoOperation{
+		config: cfg,
+		fsys:   fsys,
+		ctx:    context.Background(),
+		oldDir: newDir,
+		newDir: filepath.Join(newDir, "nested"),
+	}
+	if err := op.run(); err == nil {
+		t.Fatal("expected moving the directory into itself to fail")
+	}
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// mvOperation represents the state of a move operation
+type mvOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	from    string
+	to      string
+	storage storage.Storer
+
+	// home-relative paths resolved during initialization
+	fromRel string
+	toRel   string
+	// where the manifest keeps the copies
+	layout manifest.Layout
+	// whether the old home path is a link to the tracked copy
+	linked bool
+	// puts the tracked copy in place at the new home path
+	linker linker
+}
+
+var mvCmd = &cobra.Command{
+	Use:   "mv <from> <to>",
+	Short: "Move or rename a tracked dotfile",
+	Long: `Move or rename a tracked dotfile. The tracked copy in the dotman repository
+is moved, the symlink in the home directory is recreated at the new location,
+the rename is staged in git and the manifest is updated.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeFirstArg(completeTrackedPaths),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		op := &mvOperation{
+			from:    aliasPath(args[0]),
+			to:      args[1],
+			fsys:    fsys,
+			ctx:     context.Background(),
+			config:  cfg,
+			storage: newGitStorage(fsys, cfg.DotmanDir),
+		}
+
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Moved %s to %s\n", op.from, op.to)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mvCmd)
+}
+
+func (op *mvOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.verify(); err != nil {
+		return err
+	}
+
+	if err := op.moveData(); err != nil {
+		return err
+	}
+
+	if err := op.moveSymlink(); err != nil {
+		return err
+	}
+
+	if err := op.updateManifest(); err != nil {
+		return err
+	}
+
+	if err := op.gitMove(); err != nil {
+		return err
+	}
+
+	return op.complete()
+}
+
+func (op *mvOperation) initialize() error {
+	fromRel, err := homeRelativePath(op.fsys, op.from)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+
+	toRel, err := homeRelativePath(op.fsys, op.to)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	if fromRel == toRel {
+		return fmt.Errorf("source and destination are the same path")
+	}
+
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	if err := requireSymlinks(m, "mv"); err != nil {
+		return err
+	}
+
+	if _, ok := m.Find(fromRel); !ok {
+		return fmt.Errorf("%s is not tracked by dotman", op.from)
+	}
+
+	if _, ok := m.Find(toRel); ok {
+		return fmt.Errorf("%s is already tracked by dotman", op.to)
+	}
+	if parent, ok := m.FindParent(toRel); ok {
+		return fmt.Errorf("%s is inside the tracked directory %s", op.to, parent.Path)
+	}
+	if children := m.Children(toRel); len(children) > 0 {
+		return fmt.Errorf("%s holds the tracked entries %s", op.to, strings.Join(children, ", "))
+	}
+
+	op.fromRel = fromRel
+	op.toRel = toRel
+	op.layout = m.Layout
+	op.linker = newLinker(op.fsys, op.config, m)
+
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(journal.OperationTypeMove, fromRel, toRel)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+func (op *mvOperation) dataPath(rel string) string {
+	return op.layout.RepoPath(op.config.DotmanDir, manifest.Entry{Path: rel})
+}
+
+func (op *mvOperation) homePath(rel string) (string, error) {
+	homeDir, err := op.fsys.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, rel), nil
+}
+
+func (op *mvOperation) verify() error {
+	// Add verification step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify move destination is free", op.fromRel, op.toRel)
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.checkPaths(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	details := "Destination is free"
+	if !op.linked {
+		details += "; source is not linked to the tracked copy and will be left in place"
+	}
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) checkPaths() error {
+	oldData := op.dataPath(op.fromRel)
+	if _, err := op.fsys.Stat(oldData); err != nil {
+		return fmt.Errorf("tracked copy %s is missing: %w", oldData, err)
+	}
+
+	if _, err := op.fsys.Stat(op.dataPath(op.toRel)); err == nil {
+		return fmt.Errorf("destination %s already exists in the dotman repository", op.dataPath(op.toRel))
+	}
+
+	newHome, err := op.homePath(op.toRel)
+	if err != nil {
+		return err
+	}
+	if _, err := op.fsys.Stat(newHome); err == nil {
+		return fmt.Errorf("destination %s already exists", newHome)
+	}
+
+	// Only the link we created may be removed; anything else at the old
+	// location belongs to the user
+	oldHome, err := op.homePath(op.fromRel)
+	if err != nil {
+		return err
+	}
+	op.linked = op.linker.state(oldHome, oldData) == "linked"
+
+	return nil
+}
+
+func (op *mvOperation) moveData() error {
+	oldData := op.dataPath(op.fromRel)
+	newData := op.dataPath(op.toRel)
+
+	// Add move step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeMove, "Move tracked copy", oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to add move step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	// The old copy is removed once the new one is verified, undoing the
+	// move copies it back from there
+	rollback := pathRollback(op.fsys, oldData)
+	rollback.Created = []string{newData}
+	rollback.Backup = newData
+	if err := journal.RecordRollback(op.ctx, step, rollback); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	if err := op.moveTree(oldData, newData); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Successfully moved tracked copy"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// copyDir copies a whole tracked directory tree within perm
+func copyDir(fsys dotmanfs.FileSystem, src, dst string, perm dotmanfs.Perm) error {
+	return dotmanfs.CopyDir(fsys, src, dst, dotmanfs.CopyOptions{Perm: perm})
+}
+
+// verifyDir checks a directory tree copied by copyDir
+func verifyDir(fsys dotmanfs.FileSystem, src, dst string) error {
+	return dotmanfs.VerifyDir(fsys, src, dst, dotmanfs.CopyOptions{})
+}
+
+// moveTree copies src to dst, verifies the copy and only then removes src
+func (op *mvOperation) moveTree(src, dst string) error {
+	info, err := op.fsys.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("error reading tracked copy: %w", err)
+	}
+
+	if err := op.fsys.MkdirAll(filepath.Dir(dst), op.config.DirPerm()); err != nil {
+		return fmt.Errorf("error creating destination directory: %w", err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if err := dotmanfs.CopySymlink(op.fsys, src, dst); err != nil {
+			return fmt.Errorf("error copying symlink: %w", err)
+		}
+		if err := dotmanfs.VerifySymlink(op.fsys, src, dst); err != nil {
+			return fmt.Errorf("error verifying symlink copy: %w", err)
+		}
+	} else if info.IsDir() {
+		if err := copyDir(op.fsys, src, dst, op.config.Perm()); err != nil {
+			return fmt.Errorf("error copying directory: %w", err)
+		}
+		if err := verifyDir(op.fsys, src, dst); err != nil {
+			return fmt.Errorf("error verifying directory copy: %w", err)
+		}
+	} else {
+		if err := dotmanfs.CopyFile(op.fsys, src, dst, op.config.Perm()); err != nil {
+			return fmt.Errorf("error copying file: %w", err)
+		}
+		if err := dotmanfs.VerifyFile(op.fsys, src, dst); err != nil {
+			return fmt.Errorf("error verifying file copy: %w", err)
+		}
+	}
+
+	// Blob links keep their relative target when copied
+	if err := store.Retarget(op.fsys, op.config.DotmanDir, dst); err != nil {
+		return fmt.Errorf("error relinking store blobs: %w", err)
+	}
+
+	if err := op.fsys.RemoveAll(src); err != nil {
+		return fmt.Errorf("error removing old tracked copy: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) moveSymlink() error {
+	oldHome, err := op.homePath(op.fromRel)
+	if err != nil {
+		return err
+	}
+	newHome, err := op.homePath(op.toRel)
+	if err != nil {
+		return err
+	}
+
+	// Add symlink step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, "Move symlink", oldHome, newHome)
+	if err != nil {
+		return fmt.Errorf("failed to add symlink step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	rollback := journal.Rollback{Created: []string{newHome}}
+	if op.linked {
+		rollback = pathRollback(op.fsys, oldHome)
+		rollback.Created = []string{newHome}
+	}
+	if err := journal.RecordRollback(op.ctx, step, rollback); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	if op.linked {
+		if err := op.linker.unlink(oldHome); err != nil && !os.IsNotExist(err) {
+			if err := journal.FailEntry(op.ctx, err); err != nil {
+				return fmt.Errorf("failed to fail entry: %w", err)
+			}
+			return fmt.Errorf("error removing old symlink: %w", err)
+		}
+	}
+
+	if err := op.fsys.MkdirAll(filepath.Dir(newHome), op.config.DirPerm()); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("error creating parent directory: %w", err)
+	}
+
+	if err := op.linker.link(op.dataPath(op.toRel), newHome); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("error creating symlink: %w", err)
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Successfully moved symlink"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) updateManifest() error {
+	// Add manifest step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeManifest, "Update manifest entry", op.fromRel, op.toRel)
+	if err != nil {
+		return fmt.Errorf("failed to add manifest step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	entry, _ := m.Find(op.fromRel)
+	moved := *entry
+	moved.Path = op.toRel
+	m.Remove(op.fromRel)
+	m.Add(moved)
+
+	if err := manifest.Save(op.fsys, op.config.DotmanDir, m); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+	recordState(op.fsys, op.config)
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Renamed manifest entry %s to %s", op.fromRel, op.toRel)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) gitMove() error {
+	oldData := op.layout.RepoPath("", manifest.Entry{Path: op.fromRel})
+	newData := op.layout.RepoPath("", manifest.Entry{Path: op.toRel})
+
+	// Add git step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Stage rename in git", oldData, newData)
+	if err != nil {
+		return fmt.Errorf("failed to add git step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.stageRename(oldData, newData); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Successfully staged rename"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) stageRename(oldData, newData string) error {
+	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir, op.config.Perm())
+
+	repo, err := git.Open(op.storage, billyFs)
+	if err != nil {
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	if err := stageRemoval(repo, oldData); err != nil {
+		return fmt.Errorf("failed to stage removal of %s: %w", oldData, err)
+	}
+
+	if _, err := worktree.Add(newData); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", newData, err)
+	}
+
+	if _, err := worktree.Add(manifest.FileName); err != nil {
+		return fmt.Errorf("failed to stage manifest: %w", err)
+	}
+
+	return nil
+}
+
+func (op *mvOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestMvOperation(t *testing.T) {
+	// Create mock filesystem with dotman structure
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	// Setup test config
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	// Setup git repository with a tracked and linked file
+	_, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh config")
+
+	oldHome := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	newHome := filepath.Join(testutil.TestHomeDir, ".config/zsh/.zshrc")
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), oldHome); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	op := &mvOperation{
+		from:    oldHome,
+		to:      newHome,
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to move: %v", err)
+	}
+
+	// Tracked copy moved
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data/.zshrc")); err == nil {
+		t.Fatal("expected old tracked copy to be removed")
+	}
+	data, err := fsys.ReadFile(newHome)
+	if err != nil {
+		t.Fatalf("expected new symlink to resolve: %v", err)
+	}
+	if string(data) != "zsh config" {
+		t.Fatalf("expected content 'zsh config', got '%s'", data)
+	}
+
+	// Old symlink removed
+	if _, err := fsys.Stat(oldHome); err == nil {
+		t.Fatal("expected old symlink to be removed")
+	}
+
+	// Manifest updated
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil {
+		t.Fatalf("failed to load manifest: %v", err)
+	}
+	if _, ok := m.Find(".zshrc"); ok {
+		t.Fatal("expected old manifest entry to be removed")
+	}
+	if _, ok := m.Find(".config/zsh/.zshrc"); !ok {
+		t.Fatal("expected new manifest entry")
+	}
+
+	// Rename staged in git
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if status.File("data/.zshrc").Staging != git.Deleted {
+		t.Fatalf("expected data/.zshrc to be staged as deleted, got %q", status.File("data/.zshrc").Staging)
+	}
+	if status.File("data/.config/zsh/.zshrc").Staging != git.Added {
+		t.Fatalf("expected data/.config/zsh/.zshrc to be staged as added, got %q", status.File("data/.config/zsh/.zshrc").Staging)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeMove, journal.EntryStateCompleted, 5)
+	testutil.VerifyStep(t, entry.Steps[1], journal.StepTypeMove, journal.StepStatusCompleted, "Move tracked copy")
+}
+
+func TestMvOperation_UntrackedSource(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	op := &mvOperation{
+		from:   filepath.Join(testutil.TestHomeDir, ".bashrc"),
+		to:     filepath.Join(testutil.TestHomeDir, ".config/bash/bashrc"),
+		fsys:   fsys,
+		ctx:    context.Background(),
+		config: cfg,
+	}
+
+	if err := op.run(); err == nil {
+		t.Fatal("expected moving an untracked path to fail")
+	}
+}
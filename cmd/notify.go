@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+// background is set by commands running operations nobody watches, whose
+// outcome is then reported with desktop notifications as notify asks
+var background bool
+
+// notifyDesktop shows a desktop notification, with notify-send on Linux and
+// the BSDs and osascript on macOS
+var notifyDesktop = func(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=dotman", title, message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// notifyObserver reports operations that complete or fail with desktop
+// notifications. Child entries are left out, their group is reported.
+type notifyObserver struct {
+	journal.NopObserver
+	level string
+}
+
+func (n *notifyObserver) EntryCompleted(entry *journal.JournalEntry) error {
+	if n.level != config.NotifyAlways || entry.ParentID != "" {
+		return nil
+	}
+	n.send(fmt.Sprintf("dotman %s completed", entry.Operation), entrySummary(entry))
+	return nil
+}
+
+func (n *notifyObserver) EntryFailed(entry *journal.JournalEntry, err error) error {
+	if entry.ParentID != "" {
+		return nil
+	}
+	n.send(fmt.Sprintf("dotman %s failed", entry.Operation), err.Error())
+	return nil
+}
+
+// send shows a notification. Failing to do so must not fail the operation,
+// the journal has its outcome either way.
+func (n *notifyObserver) send(title, message string) {
+	if err := notifyDesktop(title, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send desktop notification: %v\n", err)
+	}
+}
+
+// entrySummary describes what an entry worked on, for a notification
+func entrySummary(entry *journal.JournalEntry) string {
+	switch {
+	case entry.Source != "" && entry.Target != "":
+		return entry.Source + " to " + entry.Target
+	case entry.Source != "":
+		return entry.Source
+	case entry.Target != "":
+		return entry.Target
+	}
+	return entry.ID
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestNotifyObserver(t *testing.T) {
+	var sent []string
+	orig := notifyDesktop
+	notifyDesktop = func(title, message string) error {
+		sent = append(sent, title+": "+message)
+		return nil
+	}
+	defer func() { notifyDesktop = orig }()
+
+	tests := []struct {
+		name       string
+		background bool
+		notify     string
+		want       []string
+	}{
+		{name: "in the foreground", notify: config.NotifyAlways},
+		{name: "not configured", background: true},
+		{name: "failures", background: true, notify: config.NotifyFailures, want: []string{
+			"dotman link failed: disk full",
+		}},
+		{name: "always", background: true, notify: config.NotifyAlways, want: []string{
+			"dotman link completed: data",
+			"dotman link failed: disk full",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+			if err != nil {
+				t.Fatalf("failed to create mock filesystem: %v", err)
+			}
+			defer fsys.CleanUp()
+
+			sent = nil
+			background = tt.background
+			defer func() { background = false }()
+
+			cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+			cfg.Notify = tt.notify
+			jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+			if err := jm.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			for _, fail := range []bool{false, true} {
+				entry, err := jm.CreateEntry(journal.OperationTypeLink, "data", "")
+				if err != nil {
+					t.Fatalf("CreateEntry failed: %v", err)
+				}
+				ctx := journal.WithJournalEntry(journal.WithJournalManager(context.Background(), jm), entry)
+				if _, err := journal.AddStepToCurrentEntry(ctx, journal.StepTypeSymlink, "Create symlinks", "", ""); err != nil {
+					t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+				}
+				if fail {
+					err = journal.FailEntry(ctx, errors.New("disk full"))
+				} else {
+					err = journal.CompleteEntry(ctx)
+				}
+				if err != nil {
+					t.Fatalf("finishing the entry failed: %v", err)
+				}
+			}
+
+			if len(sent) != len(tt.want) {
+				t.Fatalf("expected notifications %v, got %v", tt.want, sent)
+			}
+			for i := range sent {
+				if sent[i] != tt.want[i] {
+					t.Errorf("notification %d = %q, want %q", i, sent[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
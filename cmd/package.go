@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+// packageOperation represents a journaled change to the packages or
+// annotations in the manifest
+type packageOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	storage storage.Storer
+
+	// operation is the journal operation type of the change
+	operation journal.OperationType
+
+	// description of the change, used for the manifest step
+	description string
+	// apply changes the loaded manifest and returns the step details
+	apply func(m *manifest.Manifest) (string, error)
+}
+
+var packageCmd = &cobra.Command{
+	Use:   "package",
+	Short: "Manage packages of tracked dotfiles",
+	Long: `Manage packages, named groups of tracked dotfiles such as zsh, nvim or
+work-only. Packages can be limited to certain hosts and linked on their own
+with "dotman link --package".`,
+}
+
+var packageListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List packages with their entries and host conditions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		m, err := manifest.Load(fsys, cfg.DotmanDir)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+
+		names := m.PackageNames()
+		if len(names) == 0 {
+			fmt.Println("No packages defined")
+			return nil
+		}
+
+		for _, name := range names {
+			count := 0
+			for _, entry := range m.Entries {
+				if entry.Package == name {
+					count++
+				}
+			}
+
+			hosts := "all hosts"
+			if pkg, ok := m.Packages[name]; ok && len(pkg.Hosts) > 0 {
+				hosts = strings.Join(pkg.Hosts, ", ")
+			}
+
+			fmt.Printf("%s\t%d entries\t%s\n", name, count, hosts)
+		}
+
+		return nil
+	},
+}
+
+var packageHostsCmd = &cobra.Command{
+	Use:   "hosts <package> [pattern...]",
+	Short: "Limit a package to hosts matching glob patterns",
+	Long: `Limit a package to machines whose hostname matches one of the glob patterns,
+e.g. "dotman package hosts work-only 'work-*'". Without patterns the package
+applies to every host again.`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completePackages,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, hosts := args[0], args[1:]
+		if err := manifest.ValidatePackageName(name); err != nil {
+			return err
+		}
+
+		return runPackageOperation(fmt.Sprintf("Set hosts of package %s", name), func(m *manifest.Manifest) (string, error) {
+			if err := m.SetHosts(name, hosts); err != nil {
+				return "", err
+			}
+			if len(hosts) == 0 {
+				return fmt.Sprintf("Package %s applies to all hosts", name), nil
+			}
+			return fmt.Sprintf("Package %s limited to %s", name, strings.Join(hosts, ", ")), nil
+		})
+	},
+}
+
+var packageAssignCmd = &cobra.Command{
+	Use:   "assign <package> <path>...",
+	Short: "Move tracked dotfiles into a package",
+	Long:  `Move tracked dotfiles into a package. Use "" as the package to remove them from their package.`,
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, paths := args[0], args[1:]
+		if name != "" {
+			if err := manifest.ValidatePackageName(name); err != nil {
+				return err
+			}
+		}
+
+		relPaths := make([]string, len(paths))
+		for i, path := range paths {
+			relPath, err := homeRelativePath(fsys, path)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			relPaths[i] = relPath
+		}
+
+		return runPackageOperation(fmt.Sprintf("Assign entries to package %s", name), func(m *manifest.Manifest) (string, error) {
+			for _, relPath := range relPaths {
+				entry, ok := m.Find(relPath)
+				if !ok {
+					return "", fmt.Errorf("%s is not tracked", relPath)
+				}
+				entry.Package = name
+			}
+			return fmt.Sprintf("Assigned %s to package %s", strings.Join(relPaths, ", "), name), nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packageCmd)
+	packageCmd.AddCommand(packageListCmd)
+	packageCmd.AddCommand(packageHostsCmd)
+	packageCmd.AddCommand(packageAssignCmd)
+}
+
+// runPackageOperation loads the config and runs a package operation with apply
+func runPackageOperation(description string, apply func(m *manifest.Manifest) (string, error)) error {
+	if err := runManifestOperation(journal.OperationTypePackage, description, apply); err != nil {
+		return err
+	}
+
+	fmt.Println("Updated packages")
+	return nil
+}
+
+// runManifestOperation loads the config and runs a journaled manifest change
+// of the given operation type with apply
+func runManifestOperation(operation journal.OperationType, description string, apply func(m *manifest.Manifest) (string, error)) error {
+	cfg, err := config.LoadConfig(configPath, fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	op := &packageOperation{
+		config:      cfg,
+		fsys:        fsys,
+		ctx:         context.Background(),
+		storage:     newGitStorage(fsys, cfg.DotmanDir),
+		operation:   operation,
+		description: description,
+		apply:       apply,
+	}
+
+	return op.run()
+}
+
+func (op *packageOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.updateManifest(); err != nil {
+		return err
+	}
+
+	if err := op.stageManifest(); err != nil {
+		return err
+	}
+
+	return op.complete()
+}
+
+func (op *packageOperation) initialize() error {
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(op.operation, "", manifest.Path(op.config.DotmanDir))
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+func (op *packageOperation) updateManifest() error {
+	// Add manifest step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeManifest, op.description, "", manifest.Path(op.config.DotmanDir))
+	if err != nil {
+		return fmt.Errorf("failed to add manifest step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	details, err := op.apply(m)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := manifest.Save(op.fsys, op.config.DotmanDir, m); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+	recordState(op.fsys, op.config)
+
+	if err := journal.CompleteStep(op.ctx, step, details); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *packageOperation) stageManifest() error {
+	// Add git step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Stage manifest in git", manifest.FileName, "")
+	if err != nil {
+		return fmt.Errorf("failed to add git step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.stage(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Successfully staged manifest"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *packageOperation) stage() error {
+	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir, op.config.Perm())
+
+	repo, err := git.Open(op.storage, billyFs)
+	if err != nil {
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	if _, err := worktree.Add(manifest.FileName); err != nil {
+		return fmt.Errorf("failed to stage manifest: %w", err)
+	}
+
+	return nil
+}
+
+func (op *packageOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pickerModel is a multi-select list with fuzzy filtering
+type pickerModel struct {
+	title    string
+	items    []string
+	selected []bool
+
+	filter  textinput.Model
+	visible []int // indexes of the items matching the filter
+	cursor  int
+
+	confirmed bool
+}
+
+func newPickerModel(title string, items []string) pickerModel {
+	input := textinput.New()
+	input.Prompt = "filter: "
+	input.Focus()
+
+	m := pickerModel{
+		title:    title,
+		items:    items,
+		selected: make([]bool, len(items)),
+		filter:   input,
+	}
+	m.applyFilter()
+
+	return m
+}
+
+// runPicker lets the user choose any number of items and returns the chosen
+// ones in their original order. Nothing is returned if the picker is cancelled.
+func runPicker(title string, items []string) ([]string, error) {
+	result, err := tea.NewProgram(newPickerModel(title, items), tea.WithOutput(terminalOutput())).Run()
+	if err != nil {
+		return nil, fmt.Errorf("error running picker: %w", err)
+	}
+
+	return result.(pickerModel).chosen(), nil
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in s in order,
+// ignoring case
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i == -1 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+func (m *pickerModel) applyFilter() {
+	m.visible = m.visible[:0]
+	for i, item := range m.items {
+		if fuzzyMatch(m.filter.Value(), item) {
+			m.visible = append(m.visible, i)
+		}
+	}
+
+	if m.cursor >= len(m.visible) {
+		m.cursor = max(len(m.visible)-1, 0)
+	}
+}
+
+func (m pickerModel) chosen() []string {
+	if !m.confirmed {
+		return nil
+	}
+
+	var chosen []string
+	for i, item := range m.items {
+		if m.selected[i] {
+			chosen = append(chosen, item)
+		}
+	}
+	return chosen
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch key.String() {
+	case "ctrl+c", "esc":
+		return m, tea.Quit
+	case "enter":
+		m.confirmed = true
+		return m, tea.Quit
+	case "up", "ctrl+p":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.cursor < len(m.visible)-1 {
+			m.cursor++
+		}
+		return m, nil
+	case "tab", " ":
+		if len(m.visible) > 0 {
+			i := m.visible[m.cursor]
+			m.selected[i] = !m.selected[i]
+		}
+		return m, nil
+	case "ctrl+a":
+		for _, i := range m.visible {
+			m.selected[i] = true
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.filter, cmd = m.filter.Update(msg)
+	m.applyFilter()
+
+	return m, cmd
+}
+
+func (m pickerModel) View() string {
+	var b strings.Builder
+
+	b.WriteString(m.title + "\n\n")
+	b.WriteString(m.filter.View() + "\n\n")
+
+	if len(m.visible) == 0 {
+		b.WriteString(uiDimStyle.Render("  no matches") + "\n")
+	}
+	for pos, i := range m.visible {
+		box := "[ ]"
+		if m.selected[i] {
+			box = "[x]"
+		}
+
+		line := fmt.Sprintf("%s %s", box, m.items[i])
+		if pos == m.cursor {
+			b.WriteString(uiCursorStyle.Render("> "+line) + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n")
+	b.WriteString(uiDimStyle.Render("type to filter • ↑/↓ move • space/tab toggle • ctrl+a select all • enter confirm • esc cancel"))
+	b.WriteString("\n")
+
+	return b.String()
+}
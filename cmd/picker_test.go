@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"", ".zshrc", true},
+		{"zrc", ".zshrc", true},
+		{"NVIM", ".config/nvim", true},
+		{"cfgnv", ".config/nvim", true},
+		{"vimn", ".config/nvim", false},
+	}
+
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.pattern, tt.s); got != tt.match {
+			t.Fatalf("fuzzyMatch(%q, %q) = %v, expected %v", tt.pattern, tt.s, got, tt.match)
+		}
+	}
+}
+
+func TestPickerModel(t *testing.T) {
+	var model tea.Model = newPickerModel("pick", []string{".bashrc", ".config/nvim", ".zshrc"})
+
+	send := func(msg tea.KeyMsg) {
+		model, _ = model.Update(msg)
+	}
+
+	// Filter down to .zshrc and select it
+	for _, r := range "zsh" {
+		send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	if visible := model.(pickerModel).visible; len(visible) != 1 || visible[0] != 2 {
+		t.Fatalf("expected only .zshrc to be visible, got %v", visible)
+	}
+	send(tea.KeyMsg{Type: tea.KeyTab})
+
+	// Clear the filter and select the first item as well
+	for range "zsh" {
+		send(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	send(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+
+	if chosen := model.(pickerModel).chosen(); chosen != nil {
+		t.Fatalf("expected nothing chosen before confirmation, got %v", chosen)
+	}
+
+	send(tea.KeyMsg{Type: tea.KeyEnter})
+	chosen := model.(pickerModel).chosen()
+	if len(chosen) != 2 || chosen[0] != ".bashrc" || chosen[1] != ".zshrc" {
+		t.Fatalf("expected [.bashrc .zshrc], got %v", chosen)
+	}
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// addPlanVersion is the version of the plan format written by add --dry-run
+const addPlanVersion = 1
+
+// addPlan is what add --dry-run would add, for apply-plan to carry out later
+// or on another machine. Paths are relative to the home directory, so a plan
+// checked into a repository works for every user.
+type addPlan struct {
+	Version int      `json:"version"`
+	Paths   []string `json:"paths"`
+	Package string   `json:"package,omitempty"`
+	// Symlinks is follow or keep for sources that are symlinks, empty to
+	// refuse them
+	Symlinks    string `json:"symlinks,omitempty"`
+	ForceLarge  bool   `json:"force_large,omitempty"`
+	LineEndings string `json:"line_endings,omitempty"`
+	CopyNested  bool   `json:"copy_nested,omitempty"`
+}
+
+// Values of addPlan.Symlinks
+const (
+	planSymlinksFollow = "follow"
+	planSymlinksKeep   = "keep"
+)
+
+var applyPlanCmd = &cobra.Command{
+	Use:   "apply-plan <plan.json|->",
+	Short: "Add the dotfiles of a plan written by add --dry-run",
+	Long: `Add the dotfiles listed in a plan written by 'dotman add --dry-run', with the
+options it was made with, as a single batch. Use - to read the plan from
+stdin.
+
+Plans record paths relative to the home directory, so a plan checked into
+a repository onboards every machine the same way. Paths tracked since the
+plan was made are skipped.`,
+	Example: `  dotman add --from-file dotfiles.txt --dry-run > plan.json
+  dotman apply-plan plan.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		plan, err := readAddPlan(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			exit(1)
+		}
+
+		homeDir, err := fsys.UserHomeDir()
+		if err != nil {
+			fmt.Printf("Error getting user home directory: %v\n", err)
+			exit(1)
+		}
+
+		op := &addBatchOperation{
+			fsys:        fsys,
+			config:      cfg,
+			pkg:         plan.Package,
+			forceLarge:  plan.ForceLarge,
+			lineEndings: plan.LineEndings,
+			copyNested:  plan.CopyNested,
+		}
+		switch plan.Symlinks {
+		case planSymlinksFollow:
+			op.symlinks = symlinkFollow
+		case planSymlinksKeep:
+			op.symlinks = symlinkKeep
+		}
+		for _, path := range plan.Paths {
+			op.paths = append(op.paths, filepath.Join(homeDir, filepath.FromSlash(path)))
+		}
+
+		runBatchAdd(op, false)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyPlanCmd)
+}
+
+// readAddPlan reads the plan at name, or stdin for -
+func readAddPlan(name string) (*addPlan, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan: %w", err)
+	}
+
+	var plan addPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan: %w", err)
+	}
+	if plan.Version != addPlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d, expected %d", plan.Version, addPlanVersion)
+	}
+	if plan.Symlinks != "" && plan.Symlinks != planSymlinksFollow && plan.Symlinks != planSymlinksKeep {
+		return nil, fmt.Errorf("invalid plan: symlinks must be %s, %s or empty", planSymlinksFollow, planSymlinksKeep)
+	}
+	for _, path := range plan.Paths {
+		if path == "" || filepath.IsAbs(path) {
+			return nil, fmt.Errorf("invalid plan: path %q must be relative to the home directory", path)
+		}
+	}
+	return &plan, nil
+}
+
+// readPathList reads the newline separated paths at name, or stdin for -.
+// Blank lines and lines starting with # are skipped.
+func readPathList(name string) ([]string, error) {
+	data, err := readInput(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading path list: %w", err)
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+// readInput reads the file at name, or stdin for -
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return fsys.ReadFile(name)
+}
+
+// runBatchAdd adds the paths of op after one confirmation, or with dryRun
+// prints the plan of what it would add without changing anything
+func runBatchAdd(op *addBatchOperation, dryRun bool) {
+	if dryRun {
+		if _, err := op.prepare(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		data, err := json.MarshalIndent(op.plan(), "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(op.paths) == 0 {
+		fmt.Println("Nothing to add")
+		return
+	}
+	if !tracksInPlace(op.config) && !confirmDestructive(fmt.Sprintf("Move %d paths into the dotman repository and replace them with symlinks?", len(op.paths))) {
+		fmt.Println("Aborted")
+		exit(1)
+	}
+
+	if err := op.run(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(1)
+	}
+
+	if len(op.items) == 0 {
+		fmt.Println("All paths are already tracked")
+		return
+	}
+
+	fmt.Printf("Successfully added and verified %d paths to dotman repository\n", len(op.items))
+}
+
+// plan returns the plan of the prepared batch
+func (op *addBatchOperation) plan() *addPlan {
+	plan := &addPlan{
+		Version:     addPlanVersion,
+		Paths:       []string{},
+		Package:     op.pkg,
+		ForceLarge:  op.forceLarge,
+		LineEndings: op.lineEndings,
+		CopyNested:  op.copyNested,
+	}
+	switch op.symlinks {
+	case symlinkFollow:
+		plan.Symlinks = planSymlinksFollow
+	case symlinkKeep:
+		plan.Symlinks = planSymlinksKeep
+	}
+	for _, item := range op.items {
+		plan.Paths = append(plan.Paths, filepath.ToSlash(item.relPath))
+	}
+	return plan
+}
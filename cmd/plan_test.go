@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestAddPlan(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+
+	// Point the command globals at the memory filesystem
+	oldFsys := fsys
+	fsys = memFS
+	defer func() { fsys = oldFsys }()
+
+	list := filepath.Join(testutil.TestHomeDir, "dotfiles.txt")
+	memFS.WriteFile(list, []byte("# shell\n~/.zshrc\n\n  ~/.config/nvim  \n"), 0644)
+	paths, err := readPathList(list)
+	if err != nil {
+		t.Fatalf("readPathList() returned error: %v", err)
+	}
+	if expected := []string{"~/.zshrc", "~/.config/nvim"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+
+	memFS.WriteFile(filepath.Join(testutil.TestHomeDir, ".config/nvim/init.lua"), []byte("nvim"), 0644)
+
+	// ~/.zshrc is tracked already
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".zshrc", Type: manifest.EntryTypeFile, AddedAt: time.Now()})
+	if err := manifest.Save(memFS, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+	copyPath := filepath.Join(m.Layout.HomeDir(dotmanDir), ".zshrc")
+	memFS.WriteFile(copyPath, []byte("zsh"), 0644)
+	if err := memFS.Symlink(copyPath, filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil {
+		t.Fatalf("failed to link .zshrc: %v", err)
+	}
+
+	// The plan lists the untracked paths relative to the home directory
+	op := &addBatchOperation{
+		paths:    []string{filepath.Join(testutil.TestHomeDir, ".zshrc"), filepath.Join(testutil.TestHomeDir, ".config/nvim")},
+		fsys:     memFS,
+		config:   cfg,
+		pkg:      "editor",
+		symlinks: symlinkFollow,
+	}
+	if _, err := op.prepare(); err != nil {
+		t.Fatalf("prepare() returned error: %v", err)
+	}
+	plan := op.plan()
+	if !reflect.DeepEqual(plan.Paths, []string{".config/nvim"}) {
+		t.Errorf("expected the plan to list .config/nvim, got %v", plan.Paths)
+	}
+	if plan.Version != addPlanVersion || plan.Package != "editor" || plan.Symlinks != planSymlinksFollow {
+		t.Errorf("expected the plan to keep the options, got %+v", plan)
+	}
+
+	tests := map[string]bool{
+		`{"version": 1, "paths": [".zshrc"], "symlinks": "keep"}`: true,
+		`{"version": 2, "paths": [".zshrc"]}`:                     false,
+		`{"version": 1, "paths": ["/etc/hosts"]}`:                 false,
+		`{"version": 1, "paths": [""]}`:                           false,
+		`{"version": 1, "symlinks": "copy"}`:                      false,
+		`not json`:                                                false,
+	}
+	name := filepath.Join(testutil.TestHomeDir, "plan.json")
+	for data, valid := range tests {
+		memFS.WriteFile(name, []byte(data), 0644)
+		if _, err := readAddPlan(name); (err == nil) != valid {
+			t.Errorf("readAddPlan(%s): expected valid %v, got error %v", data, valid, err)
+		}
+	}
+}
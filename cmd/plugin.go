@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix starts the names of executables run as dotman subcommands
+const pluginPrefix = "dotman-"
+
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "List installed plugins and configured hooks",
+	Long: `List the plugins found on PATH and the hooks set in the config.
+
+An executable named dotman-<name> on PATH is run by 'dotman <name> [args...]'
+like a built-in command, so dotman can be extended without changing it. The
+plugin name must come first, global flags of dotman do not apply to it. Built-in
+commands take precedence over plugins of the same name.
+
+Hooks, set with 'dotman config set hooks <cmd>,...', are commands run for every
+operation event: an operation or a child of it starting, its steps starting,
+completing or failing, and the operation completing or failing. Each event is
+written to the hook's stdin as a JSON document:
+
+  {"event": "step_completed", "entry": {...}, "step": {...}}
+
+with event one of operation_started, step_started, step_completed, step_failed,
+entry_completed and entry_failed, and "error" set for entry_failed. A failing
+hook is reported but does not fail the operation.
+
+Hooks run with a restricted environment: PATH, HOME, USER, LOGNAME, SHELL,
+TERM, TMPDIR, TZ, LANG, the LC_* and XDG_* variables, those listed in hook_env
+and the DOTMAN_* variables below. They run in hook_dir, the dotman directory by
+default, and are killed after hook_timeout, 30s by default. What a hook prints
+is recorded in the details of the step it ran for, see 'dotman journal <id>'.
+The global --no-scripts flag runs no hooks at all.
+
+Plugins and hooks find dotman through the environment:
+
+  DOTMAN_CONFIG   path of the config file
+  DOTMAN_DIR      the dotman directory of the active profile
+  DOTMAN_BIN      the dotman executable, to run its commands`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		plugins := findPlugins(filepath.SplitList(os.Getenv("PATH")))
+		if len(plugins) == 0 {
+			fmt.Println("No plugins found on PATH")
+		} else {
+			fmt.Println("Plugins:")
+			for _, plugin := range plugins {
+				fmt.Printf("  %-16s %s\n", plugin.name, plugin.path)
+			}
+		}
+
+		if len(cfg.Hooks) == 0 {
+			fmt.Println("No hooks configured")
+			return nil
+		}
+		fmt.Println("Hooks:")
+		for _, hook := range cfg.Hooks {
+			path, err := exec.LookPath(hook)
+			if err != nil {
+				fmt.Printf("  %-16s not found\n", hook)
+				continue
+			}
+			fmt.Printf("  %-16s %s\n", hook, path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pluginsCmd)
+}
+
+// plugin is an executable run as a dotman subcommand
+type plugin struct {
+	name string
+	path string
+}
+
+// findPlugins returns the plugins in dirs, by name. A plugin found in more
+// than one directory is the one PATH would run.
+func findPlugins(dirs []string) []plugin {
+	seen := make(map[string]bool)
+	var plugins []plugin
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, pluginPrefix+"*"))
+		for _, path := range matches {
+			name := strings.TrimPrefix(filepath.Base(path), pluginPrefix)
+			if name == "" || seen[name] || !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, plugin{name: name, path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].name < plugins[j].name })
+	return plugins
+}
+
+// isExecutable reports whether path is a file that can be executed
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// pluginForArgs returns the plugin to run for the command line args, if the
+// first of them names no built-in command but a dotman-<name> executable
+func pluginForArgs(args []string) (string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", false
+	}
+	if cmd, _, err := rootCmd.Find(args); err == nil && cmd != rootCmd {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginPrefix + args[0])
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// runPlugin runs the plugin at path with args, connected to the terminal,
+// and returns its exit code
+func runPlugin(path string, args []string) (int, error) {
+	cfg, err := config.LoadConfig(configPath, fsys)
+	if err != nil {
+		return 1, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = pluginEnv(cfg)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, fmt.Errorf("failed to run plugin: %w", err)
+	}
+	return 0, nil
+}
+
+// pluginEnv returns the environment plugins run with
+func pluginEnv(cfg *config.Config) []string {
+	return append(os.Environ(), dotmanEnv(cfg)...)
+}
+
+// dotmanEnv returns the variables plugins and hooks find dotman with
+func dotmanEnv(cfg *config.Config) []string {
+	env := []string{
+		"DOTMAN_CONFIG=" + configPath,
+		"DOTMAN_DIR=" + cfg.DotmanDir,
+	}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "DOTMAN_BIN="+exe)
+	}
+	return env
+}
+
+// hookEnvNames are the variables of the environment hooks always get. Those
+// starting with LC_ or XDG_ are passed on as well.
+var hookEnvNames = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR", "TZ", "LANG"}
+
+// hookEnv returns the environment hooks run with: the variables of
+// hookEnvNames and hook_env taken from environ, and those of dotmanEnv.
+// Anything else, tokens and secrets alike, is left out.
+func hookEnv(cfg *config.Config, environ []string) []string {
+	allowed := make(map[string]bool)
+	for _, name := range append(hookEnvNames, cfg.HookEnv...) {
+		allowed[name] = true
+	}
+	var env []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if allowed[name] || strings.HasPrefix(name, "LC_") || strings.HasPrefix(name, "XDG_") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, dotmanEnv(cfg)...)
+}
+
+// hookEvent is the document a hook reads from stdin
+type hookEvent struct {
+	Event string                `json:"event"`
+	Entry *journal.JournalEntry `json:"entry"`
+	Step  *journal.Step         `json:"step,omitempty"`
+	Error string                `json:"error,omitempty"`
+}
+
+// hookOutputLimit is how much of the output of a hook is kept
+const hookOutputLimit = 4096
+
+// hookObserver runs a hook plugin for every operation event and records what
+// it printed in the journal
+type hookObserver struct {
+	command string
+	cfg     *config.Config
+	jm      *journal.JournalManager
+	// pending is the output of hooks run before there was a finished step
+	// to record it in
+	pending []string
+}
+
+func (h *hookObserver) OperationStarted(entry *journal.JournalEntry) error {
+	return h.run(hookEvent{Event: "operation_started", Entry: entry})
+}
+
+func (h *hookObserver) StepStarted(entry *journal.JournalEntry, step *journal.Step) error {
+	return h.run(hookEvent{Event: "step_started", Entry: entry, Step: step})
+}
+
+func (h *hookObserver) StepCompleted(entry *journal.JournalEntry, step *journal.Step) error {
+	return h.run(hookEvent{Event: "step_completed", Entry: entry, Step: step})
+}
+
+func (h *hookObserver) StepFailed(entry *journal.JournalEntry, step *journal.Step) error {
+	return h.run(hookEvent{Event: "step_failed", Entry: entry, Step: step})
+}
+
+func (h *hookObserver) EntryCompleted(entry *journal.JournalEntry) error {
+	return h.run(hookEvent{Event: "entry_completed", Entry: entry})
+}
+
+func (h *hookObserver) EntryFailed(entry *journal.JournalEntry, err error) error {
+	return h.run(hookEvent{Event: "entry_failed", Entry: entry, Error: err.Error()})
+}
+
+// run writes event to the stdin of the hook and records what it printed in
+// the details of the step, once the step has finished. Output of a hook run
+// for an entry that has finished goes to stderr. A hook that fails is
+// reported and otherwise ignored, it must not fail the operation it observes.
+func (h *hookObserver) run(event hookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	timeout, err := h.cfg.HookTimeoutDuration()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	output := &limitedBuffer{limit: hookOutputLimit}
+	cmd := exec.CommandContext(ctx, h.command)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Dir = h.cfg.HookWorkDir()
+	cmd.Env = hookEnv(h.cfg, os.Environ())
+	// A hook that leaves children holding its output open is not waited for
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	name := filepath.Base(h.command)
+	var record []string
+	if out := strings.TrimSpace(output.String()); out != "" {
+		record = append(record, fmt.Sprintf("hook %s on %s: %s", name, event.Event, out))
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", timeout)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: hook %s failed on %s: %v\n", h.command, event.Event, err)
+		record = append(record, fmt.Sprintf("hook %s failed on %s: %v", name, event.Event, err))
+	}
+
+	switch event.Event {
+	case "step_completed", "step_failed":
+		record = append(h.pending, record...)
+		h.pending = nil
+		if len(record) > 0 {
+			return h.jm.AnnotateStep(event.Entry, event.Step, strings.Join(record, "\n"))
+		}
+	case "entry_completed", "entry_failed":
+		for _, line := range append(h.pending, record...) {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		h.pending = nil
+	default:
+		h.pending = append(h.pending, record...)
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
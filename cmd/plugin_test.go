@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+// writeScript writes an executable shell script to dir
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	return path
+}
+
+func TestFindPlugins(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeScript(t, first, "dotman-hello", "echo first")
+	writeScript(t, second, "dotman-hello", "echo second")
+	writeScript(t, second, "dotman-backup", "true")
+	if err := os.WriteFile(filepath.Join(second, "dotman-notes"), []byte("not a program"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	plugins := findPlugins([]string{first, second})
+	if len(plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %+v", plugins)
+	}
+	if plugins[0].name != "backup" || plugins[1].name != "hello" {
+		t.Errorf("expected plugins sorted by name, got %+v", plugins)
+	}
+	if plugins[1].path != filepath.Join(first, "dotman-hello") {
+		t.Errorf("expected the plugin first on PATH, got %s", plugins[1].path)
+	}
+}
+
+func TestPluginForArgs(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "dotman-hello", "true")
+	writeScript(t, dir, "dotman-add", "true")
+	t.Setenv("PATH", dir)
+
+	if path, ok := pluginForArgs([]string{"hello", "--loud"}); !ok || path != filepath.Join(dir, "dotman-hello") {
+		t.Errorf("expected dotman-hello to run, got %q %v", path, ok)
+	}
+	for _, args := range [][]string{{"add", "x"}, {"--verbose", "hello"}, {"missing"}, nil} {
+		if path, ok := pluginForArgs(args); ok {
+			t.Errorf("expected no plugin for %v, got %s", args, path)
+		}
+	}
+}
+
+func TestHookObserver(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dir := t.TempDir()
+	events := filepath.Join(dir, "events")
+	hook := writeScript(t, dir, "hook", `cat >> "`+events+`"; echo "$DOTMAN_DIR" >> "`+events+`.dir"; echo "in $(pwd) token=$DOTMAN_TEST_TOKEN"`)
+	broken := writeScript(t, dir, "broken", "exit 3")
+	t.Setenv("DOTMAN_TEST_TOKEN", "secret")
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.Hooks = []string{broken, hook}
+	cfg.HookDir = dir
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	entry, err := jm.CreateEntry(journal.OperationTypeLink, "data", "")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := journal.WithJournalEntry(journal.WithJournalManager(context.Background(), jm), entry)
+	step, err := journal.AddStepToCurrentEntry(ctx, journal.StepTypeSymlink, "Create symlinks", "", "")
+	if err != nil {
+		t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+	}
+	if err := journal.StartStep(ctx, step); err != nil {
+		t.Fatalf("StartStep failed: %v", err)
+	}
+	// A failing hook does not fail the operation
+	if err := journal.CompleteStep(ctx, step, "Linked 1 file"); err != nil {
+		t.Fatalf("CompleteStep failed: %v", err)
+	}
+	if err := journal.CompleteEntry(ctx); err != nil {
+		t.Fatalf("CompleteEntry failed: %v", err)
+	}
+
+	data, err := os.ReadFile(events)
+	if err != nil {
+		t.Fatalf("expected the hook to run: %v", err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event hookEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("failed to parse event %q: %v", line, err)
+		}
+		if event.Entry == nil || event.Entry.ID != entry.ID {
+			t.Errorf("expected an event for %s, got %+v", entry.ID, event)
+		}
+		names = append(names, event.Event)
+	}
+	if got := strings.Join(names, ","); got != "operation_started,step_started,step_completed,entry_completed" {
+		t.Errorf("unexpected events %s", got)
+	}
+
+	dirs, err := os.ReadFile(events + ".dir")
+	if err != nil || !strings.HasPrefix(string(dirs), dotmanDir+"\n") {
+		t.Errorf("expected hooks to get DOTMAN_DIR=%s, got %q (%v)", dotmanDir, dirs, err)
+	}
+
+	// What the hooks printed and how they failed is recorded in the step,
+	// without the variables they were not given
+	saved, err := jm.GetEntry(entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	details := saved.Steps[0].Details
+	for _, want := range []string{
+		"Linked 1 file\n",
+		"hook broken failed on operation_started: exit status 3",
+		"hook hook on step_started: in " + dir + " token=\n",
+		"hook hook on step_completed:",
+	} {
+		if !strings.Contains(details, want) {
+			t.Errorf("expected the step details to contain %q, got:\n%s", want, details)
+		}
+	}
+
+	// A hook that runs too long is killed
+	cfg.HookTimeout = "100ms"
+	slow := &hookObserver{command: writeScript(t, dir, "slow", "exec sleep 5"), cfg: cfg, jm: jm}
+	if err := slow.run(hookEvent{Event: "step_started", Entry: saved, Step: &saved.Steps[0]}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if len(slow.pending) != 1 || !strings.Contains(slow.pending[0], "timed out after 100ms") {
+		t.Errorf("expected the slow hook to time out, got %v", slow.pending)
+	}
+
+	// --no-scripts runs no hooks
+	noScripts = true
+	defer func() { noScripts = false }()
+	os.Remove(events)
+	jm = newJournalManager(fsys, cfg, cfg.DotmanDir)
+	if _, err := jm.CreateEntry(journal.OperationTypeLink, "data", ""); err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if _, err := os.Stat(events); err == nil {
+		t.Error("expected no hook to run with --no-scripts")
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+	cfg := &config.Config{DotmanDir: "/home/user/.dotman", HookEnv: []string{"EDITOR"}}
+	env := hookEnv(cfg, []string{"PATH=/bin", "HOME=/home/user", "LC_ALL=C", "XDG_CONFIG_HOME=/x", "EDITOR=vim", "GITHUB_TOKEN=secret", "DOTMAN_DIR=/elsewhere"})
+
+	got := make(map[string]string)
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		got[name] = value
+	}
+	for name, value := range map[string]string{"PATH": "/bin", "HOME": "/home/user", "LC_ALL": "C", "XDG_CONFIG_HOME": "/x", "EDITOR": "vim", "DOTMAN_DIR": "/home/user/.dotman"} {
+		if got[name] != value {
+			t.Errorf("expected %s=%s, got %q", name, value, got[name])
+		}
+	}
+	if _, ok := got["GITHUB_TOKEN"]; ok {
+		t.Error("expected GITHUB_TOKEN to be left out")
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// checkFreeSpace reports an error when the filesystem holding dir has less
+// than need bytes available. Platforms that cannot tell pass the check.
+func checkFreeSpace(fsys dotmanfs.FileSystem, dir string, need int64) error {
+	free, err := fsys.FreeSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking free space in %s: %w", dir, err)
+	}
+
+	if need > 0 && uint64(need) > free {
+		return fmt.Errorf("not enough space in %s: %s needed, %s available",
+			dir, config.FormatSize(need), config.FormatSize(int64(free)))
+	}
+	return nil
+}
+
+// preflightFailed returns the error of a pre-flight step that found
+// problems, listing all of them so they can be fixed in one go
+func preflightFailed(problems []string) error {
+	return fmt.Errorf("pre-flight checks failed: %s", strings.Join(problems, "; "))
+}
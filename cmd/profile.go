@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileDir    string
+	profileRemote string
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage repository profiles",
+	Long: `Manage named profiles, each with its own dotman directory and remote, e.g. to
+keep work dotfiles in a separate repository. The active profile scopes the
+journal, manifest and git operations of every command; --profile or
+DOTMAN_PROFILE select a profile for a single invocation.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		fileCfg, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		active, _ := cfg.CurrentProfile()
+		printProfile := func(name, dir, remote string) {
+			marker := " "
+			if name == active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\t%s", marker, name, dir)
+			if remote != "" {
+				fmt.Printf("\t%s", remote)
+			}
+			fmt.Println()
+		}
+
+		printProfile(config.DefaultProfile, fileCfg.DotmanDir, "")
+		for _, name := range fileCfg.ProfileNames() {
+			profile := fileCfg.Profiles[name]
+			printProfile(name, profile.DotmanDir, profile.Remote)
+		}
+
+		return nil
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:               "use <name>",
+	Short:             "Make a profile the active one",
+	Long:              `Make a profile the active one. Use "default" to go back to the top-level dotman directory.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeProfiles,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.Set("active_profile", args[0]); err != nil {
+			return err
+		}
+
+		if err := config.SaveConfig(configPath, cfg, fsys); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+
+		fmt.Printf("Switched to profile %s\n", args[0])
+		return nil
+	},
+}
+
+var profileAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a profile",
+	Long: `Add a profile with its own dotman directory and optional remote. If the
+directory already holds a dotman repository, its origin remote is set;
+otherwise run "dotman --profile <name> init" to create it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := cfg.Profiles[name]; ok {
+			return fmt.Errorf("profile '%s' already exists", name)
+		}
+
+		dir := profileDir
+		if dir == "" {
+			homeDir, err := fsys.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to get user home directory: %w", err)
+			}
+			dir = filepath.Join(homeDir, ".dotman-"+name)
+		}
+		if dir, err = dotmanfs.AbsHome(fsys, dir); err != nil {
+			return fmt.Errorf("failed to resolve profile directory: %w", err)
+		}
+
+		if err := cfg.AddProfile(name, config.Profile{DotmanDir: dir, Remote: profileRemote}); err != nil {
+			return err
+		}
+
+		if err := config.SaveConfig(configPath, cfg, fsys); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+
+		if profileRemote != "" && isDotmanDir(fsys, dir) {
+			repo, err := git.PlainOpen(dir)
+			if err != nil {
+				return fmt.Errorf("failed to open repository: %w", err)
+			}
+			if err := setOriginURL(repo, profileRemote); err != nil {
+				return fmt.Errorf("failed to set remote: %w", err)
+			}
+		}
+
+		fmt.Printf("Added profile %s using %s\n", name, dir)
+		if !isDotmanDir(fsys, dir) {
+			fmt.Printf("Run \"dotman --profile %s init\" to create its repository\n", name)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileCmd.AddCommand(profileAddCmd)
+
+	profileAddCmd.Flags().StringVarP(&profileDir, "dir", "d", "", "dotman directory of the profile (default is $HOME/.dotman-<name>)")
+	profileAddCmd.Flags().StringVarP(&profileRemote, "remote", "r", "", "URL of the profile's git remote")
+
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+}
+
+// completeProfiles completes profile names for the first argument
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	cfg, err := config.ReadConfig(configPath, fsys)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	return append([]string{config.DefaultProfile}, cfg.ProfileNames()...), cobra.ShellCompDirectiveNoFileComp
+}
+
+// repoConfig scopes cfg to the repository an entry goes to: the secrets
+// repository with secret, the named profile's with repo, the active one
+// otherwise
+func repoConfig(cfg *config.Config, repo string, secret bool) (*config.Config, error) {
+	switch {
+	case secret:
+		return cfg.SecretsConfig()
+	case repo != "":
+		return cfg.ForProfile(repo)
+	}
+	return cfg, nil
+}
+
+// listedRepo is a repository whose entries are listed together with others
+type listedRepo struct {
+	name   string
+	config *config.Config
+}
+
+// listedRepos returns the repositories list shows: the one named by repo, or
+// the active one followed by the secrets repository when it is another one
+func listedRepos(cfg *config.Config, repo string) ([]listedRepo, error) {
+	if repo != "" {
+		scoped, err := cfg.ForProfile(repo)
+		if err != nil {
+			return nil, err
+		}
+		return []listedRepo{{repo, scoped}}, nil
+	}
+
+	active, _ := cfg.CurrentProfile()
+	repos := []listedRepo{{active, cfg}}
+	if cfg.SecretsProfile != "" && cfg.SecretsProfile != active {
+		secrets, err := cfg.SecretsConfig()
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, listedRepo{cfg.SecretsProfile, secrets})
+	}
+	return repos, nil
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+)
+
+const (
+	// progressDelay is how long a step runs before its progress is drawn on
+	// a terminal, so quick steps print nothing
+	progressDelay = 500 * time.Millisecond
+	// progressRedraw is how often the progress on a terminal is redrawn
+	progressRedraw = 100 * time.Millisecond
+	// progressLogInterval is how often progress is logged as a line when
+	// stderr is not a terminal
+	progressLogInterval = 10 * time.Second
+	// progressBarWidth is the number of cells of the progress bar
+	progressBarWidth = 20
+)
+
+// spinnerFrames are drawn in turn for steps without a known total
+var spinnerFrames = []string{"|", "/", "-", `\`}
+
+// isTerminalError reports whether stderr is a terminal, replaced in tests
+var isTerminalError = func() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progress shows how far a long step got on stderr: a bar with files, bytes
+// and the time left, or a spinner when there is no total, redrawn on a
+// terminal. Otherwise a line is logged every progressLogInterval, so a cron
+// job or log shows the step is still running.
+type progress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	label    string
+	terminal bool
+	now      func() time.Time
+
+	// totals of the step, 0 when not known
+	totalFiles int
+	totalBytes int64
+
+	files int
+	bytes int64
+
+	start time.Time
+	// shown is when the progress was last drawn or logged
+	shown time.Time
+	// drawn is set while a bar is on the terminal line
+	drawn  bool
+	logged bool
+	frame  int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newProgress starts showing the progress of a step on stderr. totalFiles
+// and totalBytes may be 0 when not known. finish must be called when the
+// step ends.
+func newProgress(label string, totalFiles int, totalBytes int64) *progress {
+	p := &progress{
+		w:          os.Stderr,
+		label:      label,
+		terminal:   isTerminalError(),
+		now:        time.Now,
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		stop:       make(chan struct{}),
+	}
+	p.start = p.now()
+	p.shown = p.start
+
+	// Keep the spinner and the time left moving between files
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressRedraw)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.render()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add records a file of size bytes as done
+func (p *progress) add(size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files++
+	p.bytes += size
+	p.render()
+}
+
+// finish stops showing the progress, clearing the bar from the terminal.
+// When progress was logged, a last line says how the step ended.
+func (p *progress) finish() {
+	close(p.stop)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+	if p.logged {
+		fmt.Fprintf(p.w, "%s: done after %s\n", p.label, p.now().Sub(p.start).Round(time.Second))
+	}
+}
+
+// render draws or logs the progress when it is due. The caller holds mu.
+func (p *progress) render() {
+	now := p.now()
+	if p.terminal {
+		if now.Sub(p.start) < progressDelay || now.Sub(p.shown) < progressRedraw {
+			return
+		}
+		fmt.Fprintf(p.w, "\r\033[K%s", p.line(now))
+		p.drawn = true
+	} else {
+		if now.Sub(p.shown) < progressLogInterval {
+			return
+		}
+		fmt.Fprintln(p.w, p.line(now))
+		p.logged = true
+	}
+	p.shown = now
+	p.frame++
+}
+
+// line describes the progress at now
+func (p *progress) line(now time.Time) string {
+	elapsed := now.Sub(p.start)
+
+	var parts []string
+	if p.totalFiles == 0 && p.files == 0 {
+		// Nothing to count, only that the step is still running
+		parts = append(parts, fmt.Sprintf("%s elapsed", elapsed.Round(time.Second)))
+	} else {
+		files := fmt.Sprintf("%d files", p.files)
+		if p.totalFiles > 0 {
+			files = fmt.Sprintf("%d/%d files", p.files, p.totalFiles)
+		}
+		size := config.FormatSize(p.bytes)
+		if p.totalBytes > 0 {
+			size += " of " + config.FormatSize(p.totalBytes)
+		}
+		parts = append(parts, files, size)
+		if left, ok := p.left(elapsed); ok {
+			parts = append(parts, fmt.Sprintf("%s left", left))
+		}
+	}
+	status := strings.Join(parts, ", ")
+
+	if !p.terminal {
+		return p.label + ": " + status
+	}
+	if p.totalBytes == 0 && p.totalFiles == 0 {
+		return fmt.Sprintf("%s %s %s", p.label, spinnerFrames[p.frame%len(spinnerFrames)], status)
+	}
+	return fmt.Sprintf("%s %s %s", p.label, p.bar(), status)
+}
+
+// left estimates the time the step still needs from the rate so far, by
+// bytes when their total is known and by files otherwise
+func (p *progress) left(elapsed time.Duration) (time.Duration, bool) {
+	var done, total float64
+	switch {
+	case p.totalBytes > 0 && p.bytes > 0:
+		done, total = float64(p.bytes), float64(p.totalBytes)
+	case p.totalFiles > 0 && p.files > 0:
+		done, total = float64(p.files), float64(p.totalFiles)
+	default:
+		return 0, false
+	}
+	if done >= total {
+		return 0, false
+	}
+	left := time.Duration(float64(elapsed) * (total - done) / done)
+	return left.Round(time.Second), true
+}
+
+// bar draws the share of the step that is done
+func (p *progress) bar() string {
+	share := 0.0
+	switch {
+	case p.totalBytes > 0:
+		share = float64(p.bytes) / float64(p.totalBytes)
+	case p.totalFiles > 0:
+		share = float64(p.files) / float64(p.totalFiles)
+	}
+	filled := min(int(share*progressBarWidth), progressBarWidth)
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "]"
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProgress returns a progress drawn to out whose clock is moved by the
+// returned function, without the goroutine newProgress starts
+func testProgress(terminal bool, totalFiles int, totalBytes int64) (*progress, *bytes.Buffer, func(time.Duration)) {
+	out := &bytes.Buffer{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &progress{
+		w:          out,
+		label:      "Copying .config",
+		terminal:   terminal,
+		now:        func() time.Time { return now },
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		stop:       make(chan struct{}),
+		start:      now,
+		shown:      now,
+	}
+	return p, out, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestProgressTerminal(t *testing.T) {
+	p, out, advance := testProgress(true, 4, 4<<20)
+
+	// Quick steps print nothing
+	p.add(1 << 20)
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing before the delay, got %q", out.String())
+	}
+
+	advance(time.Second)
+	p.add(1 << 20)
+	want := "\r\033[KCopying .config [==========          ] 2/4 files, 2.0 MB of 4.0 MB, 1s left"
+	if out.String() != want {
+		t.Errorf("unexpected bar %q, want %q", out.String(), want)
+	}
+
+	// Redraws are throttled
+	out.Reset()
+	p.add(1 << 20)
+	if out.Len() != 0 {
+		t.Errorf("expected no redraw within %s, got %q", progressRedraw, out.String())
+	}
+
+	// The bar is cleared when the step ends
+	out.Reset()
+	p.finish()
+	if out.String() != "\r\033[K" {
+		t.Errorf("expected the bar to be cleared, got %q", out.String())
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	p, out, advance := testProgress(false, 0, 0)
+
+	advance(progressLogInterval / 2)
+	p.render()
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing before the log interval, got %q", out.String())
+	}
+
+	advance(progressLogInterval)
+	p.render()
+	if out.String() != "Copying .config: 15s elapsed\n" {
+		t.Errorf("unexpected log line %q", out.String())
+	}
+
+	p.add(100)
+	advance(progressLogInterval)
+	p.add(100)
+	if !strings.HasSuffix(out.String(), "Copying .config: 2 files, 200 B\n") {
+		t.Errorf("unexpected log line %q", out.String())
+	}
+
+	out.Reset()
+	p.finish()
+	if out.String() != "Copying .config: done after 25s\n" {
+		t.Errorf("unexpected last line %q", out.String())
+	}
+}
+
+func TestProgressSpinner(t *testing.T) {
+	p, out, advance := testProgress(true, 0, 0)
+	p.label = "Pushing to origin"
+
+	advance(time.Second)
+	p.render()
+	advance(progressRedraw)
+	p.render()
+	want := "\r\033[KPushing to origin | 1s elapsed\r\033[KPushing to origin / 1s elapsed"
+	if out.String() != want {
+		t.Errorf("unexpected spinner %q, want %q", out.String(), want)
+	}
+}
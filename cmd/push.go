@@ -3,11 +3,9 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"path/filepath"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/storage"
-	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/noosxe/dotman/internal/config"
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/noosxe/dotman/internal/journal"
@@ -19,26 +17,38 @@ type pushOperation struct {
 	fsys    dotmanfs.FileSystem
 	ctx     context.Context
 	storage storage.Storer
+
+	// skip the doctor checks verify_before_push asks for
+	noVerify bool
 }
 
 var pushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Push changes to the remote repository",
-	Long:  `Push committed changes to the remote repository. This command will push all local commits that haven't been pushed yet.`,
+	Long: `Push committed changes to the remote repository. This command will push all local commits that haven't been pushed yet.
+
+When the remote cannot be reached the push is retried network_retries times,
+waiting retry_backoff before the first retry and twice as long before each
+further one. With offline_queue set, a push that still cannot reach the
+remote is queued instead of failing, and the next push sends it.
+
+With verify_before_push set, the doctor checks run first and the push is
+refused when they find a problem, so a broken repository does not reach your
+other machines. Use --no-verify to push anyway.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.LoadConfig(configPath, fsys)
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		// Create billy filesystem adapter
-		billyFs := dotmanfs.NewBillyFileSystem(fsys, cfg.DotmanDir)
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
 
 		op := &pushOperation{
-			fsys:    fsys,
-			ctx:     context.Background(),
-			config:  cfg,
-			storage: filesystem.NewStorage(billyFs, nil),
+			fsys:     fsys,
+			ctx:      context.Background(),
+			config:   cfg,
+			storage:  newGitStorage(fsys, cfg.DotmanDir),
+			noVerify: noVerify,
 		}
 
 		return op.run()
@@ -47,9 +57,14 @@ var pushCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(pushCmd)
+	pushCmd.Flags().Bool("no-verify", false, "push without the doctor checks verify_before_push runs")
 }
 
 func (op *pushOperation) run() error {
+	if err := op.verify(); err != nil {
+		return err
+	}
+
 	if err := op.initialize(); err != nil {
 		return err
 	}
@@ -63,7 +78,7 @@ func (op *pushOperation) run() error {
 
 func (op *pushOperation) initialize() error {
 	// Create journal manager
-	jm := journal.NewJournalManager(op.fsys, filepath.Join(op.config.DotmanDir, "journal"))
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
 	if err := jm.Initialize(); err != nil {
 		return fmt.Errorf("failed to initialize journal: %w", err)
 	}
@@ -83,6 +98,24 @@ func (op *pushOperation) initialize() error {
 	return nil
 }
 
+// verify runs the doctor checks when verify_before_push is set, before the
+// push is journaled so it does not count as interrupted itself
+func (op *pushOperation) verify() error {
+	if !op.config.VerifyPush || op.noVerify {
+		return nil
+	}
+
+	problems, err := checkHealth(op.fsys, op.config)
+	if err != nil {
+		return fmt.Errorf("failed to check repository health: %w", err)
+	}
+	if len(problems) > 0 {
+		printProblems(problems)
+		return fmt.Errorf("push refused, the repository has %d problems: fix them or push with --no-verify", len(problems))
+	}
+	return nil
+}
+
 func (op *pushOperation) push() error {
 	// Add push step
 	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Push changes to remote", "", "")
@@ -96,7 +129,7 @@ func (op *pushOperation) push() error {
 	}
 
 	// Create billy filesystem adapter
-	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir)
+	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir, op.config.Perm())
 
 	// Open the repository with our filesystem
 	repo, err := git.Open(op.storage, billyFs)
@@ -116,14 +149,45 @@ func (op *pushOperation) push() error {
 		return fmt.Errorf("failed to get remote: %w", err)
 	}
 
-	// Push changes
-	if err := remote.Push(&git.PushOptions{}); err != nil {
+	// Undoing the push moves the remote branch back to where it was
+	if err := journal.RecordRollback(op.ctx, step, remoteRollback(repo, "origin")); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	// Reach the remote through the configured proxy and ssh settings
+	rt, err := newRemoteTransport(op.fsys, remote.Config().URLs[0])
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	// Push changes, retrying while the remote cannot be reached
+	err = withRetry(op.config, "push changes", func() error {
+		progress := newProgress("Pushing to origin", 0, 0)
+		defer progress.finish()
+		return remote.Push(&git.PushOptions{Auth: rt.Auth, ProxyOptions: rt.Proxy})
+	})
+	if err != nil && op.config.OfflineQueue && isOffline(err) {
+		return op.queue(step, err)
+	}
+	if err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to push changes: %w", err)); err != nil {
 			return fmt.Errorf("failed to fail entry: %w", err)
 		}
 		return fmt.Errorf("failed to push changes: %w", err)
 	}
 
+	// This push sent whatever earlier ones queued
+	jm, err := journal.GetJournalManager(op.ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := jm.ClearPending(journal.OperationTypePush); err != nil {
+		return fmt.Errorf("failed to clear pending push: %w", err)
+	}
+
 	// Complete the step
 	if err := journal.CompleteStep(op.ctx, step, "Successfully pushed changes to remote"); err != nil {
 		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to complete step: %w", err)); err != nil {
@@ -136,6 +200,44 @@ func (op *pushOperation) push() error {
 	return nil
 }
 
+// queue records a push that failed because the remote cannot be reached as
+// pending, so the next push sends the commits instead of this one failing
+func (op *pushOperation) queue(step *journal.Step, cause error) error {
+	if err := journal.FailStep(op.ctx, step, cause); err != nil {
+		return fmt.Errorf("failed to fail step: %w", err)
+	}
+
+	queueStep, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Queue push for later", "", "")
+	if err != nil {
+		return fmt.Errorf("failed to add queue step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, queueStep); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	jm, err := journal.GetJournalManager(op.ctx)
+	if err != nil {
+		return err
+	}
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		return err
+	}
+	if err := jm.MarkPending(entry, cause); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to queue push: %w", err)
+	}
+
+	if err := journal.CompleteStep(op.ctx, queueStep, "Remote unreachable, push queued"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	fmt.Println("Remote unreachable, push queued: the next push sends the changes")
+	return nil
+}
+
 func (op *pushOperation) complete() error {
 	return journal.CompleteEntry(op.ctx)
 }
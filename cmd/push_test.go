@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/noosxe/dotman/internal/journal"
@@ -38,6 +41,15 @@ func TestPushOperation(t *testing.T) {
 	// Setup context with journal
 	ctx := testutil.SetupContextWithJournal(t, jm, journal.OperationTypePush, "", "")
 
+	// An earlier push was queued while offline
+	queued, err := journal.GetJournalEntry(ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	if err := jm.MarkPending(queued, nil); err != nil {
+		t.Fatalf("failed to mark push pending: %v", err)
+	}
+
 	// Create push operation
 	op := &pushOperation{
 		fsys:    fsys,
@@ -65,4 +77,134 @@ func TestPushOperation(t *testing.T) {
 
 	step := lastEntry.Steps[0]
 	testutil.VerifyStep(t, step, journal.StepTypeGit, journal.StepStatusCompleted, "Push changes to remote")
+
+	pending, err := jm.Pending()
+	if err != nil {
+		t.Fatalf("failed to read pending operations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected the queued push to be cleared, got %+v", pending)
+	}
+}
+
+func TestPushOperation_OfflineQueue(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMockFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.NetworkRetries = "1"
+	cfg.RetryBackoff = "1ms"
+	cfg.OfflineQueue = true
+
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/sample.txt", "sample content")
+
+	// Nothing listens on port 1
+	repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{"http://127.0.0.1:1/remote.git"},
+	})
+
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	op := &pushOperation{
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+	if err := op.run(); err != nil {
+		t.Fatalf("expected the push to be queued, got %v", err)
+	}
+
+	if len(waits) != 1 || waits[0] != time.Millisecond {
+		t.Fatalf("expected one retry after 1ms, got %v", waits)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypePush, journal.EntryStateCompleted, 2)
+	testutil.VerifyStep(t, entry.Steps[0], journal.StepTypeGit, journal.StepStatusFailed, "Push changes to remote")
+	testutil.VerifyStep(t, entry.Steps[1], journal.StepTypeGit, journal.StepStatusCompleted, "Queue push for later")
+
+	pending, err := jm.Pending()
+	if err != nil {
+		t.Fatalf("failed to read pending operations: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Operation != journal.OperationTypePush || pending[0].EntryID != entry.ID {
+		t.Fatalf("expected a pending push for %s, got %+v", entry.ID, pending)
+	}
+
+	// Without the queue the push fails
+	cfg.OfflineQueue = false
+	op = &pushOperation{
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+	if err := op.run(); err == nil {
+		t.Fatal("expected the push to fail")
+	}
+}
+
+func TestPushOperation_VerifyBeforePush(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMockFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.VerifyPush = true
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	// .vimrc is tracked but its copy was never committed
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", manfile)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+
+	_ = testutil.SetupBareRepo(t, fsys, "home/remote")
+	repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{fsys.RealPath("home/remote")},
+	})
+
+	newOp := func(noVerify bool) *pushOperation {
+		return &pushOperation{
+			fsys:     fsys,
+			ctx:      context.Background(),
+			config:   cfg,
+			storage:  storage,
+			noVerify: noVerify,
+		}
+	}
+
+	// The push is refused before it is journaled
+	if err := newOp(false).run(); err == nil || !strings.Contains(err.Error(), "push refused") {
+		t.Fatalf("expected the push to be refused, got %v", err)
+	}
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	testutil.VerifyJournalEntryCount(t, jm, journal.EntryStateCurrent, 0)
+	testutil.VerifyJournalEntryCount(t, jm, journal.EntryStateCompleted, 0)
+
+	// --no-verify pushes anyway
+	if err := newOp(true).run(); err != nil {
+		t.Fatalf("failed to push with --no-verify: %v", err)
+	}
+
+	// Once the copy exists the checks pass
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.vimrc", "vim")
+	if err := newOp(false).run(); err != nil {
+		t.Fatalf("failed to push a healthy repository: %v", err)
+	}
+	testutil.VerifyJournalEntryCount(t, jm, journal.EntryStateCompleted, 2)
 }
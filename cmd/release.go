@@ -0,0 +1,486 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/spf13/cobra"
+)
+
+// releaseTagPrefix namespaces release tags so they don't clash with user tags
+const releaseTagPrefix = "release/"
+
+// latestRelease names the newest release wherever a release is given
+const latestRelease = "latest"
+
+// releaseOperation represents the state of a release operation
+type releaseOperation struct {
+	config  *config.Config
+	fsys    dotmanfs.FileSystem
+	ctx     context.Context
+	repo    *git.Repository
+	backend backend
+
+	name    string
+	message string
+	// note is the generated release note the tag is annotated with
+	note string
+}
+
+// checkoutOperation represents the state of moving the repository to a
+// release
+type checkoutOperation struct {
+	config  *config.Config
+	fsys    dotmanfs.FileSystem
+	ctx     context.Context
+	repo    *git.Repository
+	backend backend
+
+	release releaseInfo
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release [name]",
+	Short: "Tag the current commit as a release of the dotfiles",
+	Long: `Tag the current commit as a release with an annotated tag, release/<name>,
+whose note lists the commits and the files of entries changed since the
+previous release, grouped by package. Without a name, release lists the
+releases, oldest first.
+
+Machines that should only get released dotfiles follow releases instead of
+the branch: 'dotman link --release latest' checks out the newest release
+before linking, and so does every link with the follow_release config key
+set to latest. A release name pins that release instead. A clone can start
+at a release too, with 'dotman init --clone <url> --release latest'.
+'git -C <dotman_dir> checkout main' goes back to following the branch.`,
+	Example: `  dotman release 2024.1 -m "New prompt"
+  dotman config set follow_release latest`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, _ := cmd.Flags().GetString("message")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(fsys, cfg.DotmanDir, b)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		if len(args) == 0 {
+			releases, err := listReleases(repo)
+			if err != nil {
+				return err
+			}
+			if len(releases) == 0 {
+				fmt.Println("No releases found")
+				return nil
+			}
+			for _, r := range releases {
+				fmt.Printf("%s\t%s\t%s\n", r.Name, r.Hash.String()[:8], r.When.Format(time.RFC3339))
+			}
+			return nil
+		}
+
+		op := &releaseOperation{
+			config:  cfg,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			repo:    repo,
+			backend: b,
+			name:    args[0],
+			message: message,
+		}
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Released %s\n\n%s\n", op.name, op.note)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+
+	releaseCmd.Flags().StringP("message", "m", "", "text to start the release note with")
+}
+
+// releaseInfo describes a single release tag
+type releaseInfo struct {
+	Name string
+	// Hash is the commit the release tags
+	Hash plumbing.Hash
+	When time.Time
+}
+
+// listReleases returns the releases of repo, oldest first
+func listReleases(repo *git.Repository) ([]releaseInfo, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	releases := make([]releaseInfo, 0)
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		if !strings.HasPrefix(name, releaseTagPrefix) {
+			return nil
+		}
+
+		info := releaseInfo{Name: strings.TrimPrefix(name, releaseTagPrefix), Hash: ref.Hash()}
+		// Releases are annotated tags, but tolerate lightweight ones created by hand
+		if tag, err := repo.TagObject(ref.Hash()); err == nil {
+			info.Hash = tag.Target
+			info.When = tag.Tagger.When
+		} else if commit, err := repo.CommitObject(ref.Hash()); err == nil {
+			info.When = commit.Committer.When
+		}
+
+		releases = append(releases, info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].When.Before(releases[j].When)
+	})
+	return releases, nil
+}
+
+// findRelease returns the release with name, the newest one for latest
+func findRelease(repo *git.Repository, name string) (releaseInfo, error) {
+	releases, err := listReleases(repo)
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	if name == latestRelease {
+		if len(releases) == 0 {
+			return releaseInfo{}, fmt.Errorf("the repository has no releases yet")
+		}
+		return releases[len(releases)-1], nil
+	}
+	for _, r := range releases {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return releaseInfo{}, fmt.Errorf("release '%s' not found, see 'dotman release'", name)
+}
+
+func (op *releaseOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.tag(); err != nil {
+		return err
+	}
+
+	return journal.CompleteEntry(op.ctx)
+}
+
+func (op *releaseOperation) initialize() error {
+	if op.name == latestRelease {
+		return fmt.Errorf("'%s' stands for the newest release and cannot name one", latestRelease)
+	}
+	if err := plumbing.NewTagReferenceName(releaseTagPrefix + op.name).Validate(); err != nil {
+		return fmt.Errorf("invalid release name '%s': %w", op.name, err)
+	}
+	if _, err := op.repo.Tag(releaseTagPrefix + op.name); err == nil {
+		return fmt.Errorf("release '%s' already exists", op.name)
+	}
+	// Changes that are not committed would not be part of the release
+	if files, err := changedFiles(op.repo, op.backend); err != nil {
+		return err
+	} else if len(files) > 0 {
+		return fmt.Errorf("%s has uncommitted changes, commit or stash them first", files[0])
+	}
+
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	entry, err := jm.CreateEntry(journal.OperationTypeRelease, "HEAD", releaseTagPrefix+op.name)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// tag creates the annotated release tag on HEAD
+func (op *releaseOperation) tag() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Create release tag", "HEAD", releaseTagPrefix+op.name)
+	if err != nil {
+		return fmt.Errorf("failed to add tag step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	err = op.createTag()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, op.note); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+func (op *releaseOperation) createTag() error {
+	head, err := op.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if op.note, err = op.releaseNote(head.Hash()); err != nil {
+		return err
+	}
+	signature, err := gitIdentity(op.fsys, op.config, op.repo, "")
+	if err != nil {
+		return err
+	}
+
+	if _, err := op.repo.CreateTag(releaseTagPrefix+op.name, head.Hash(), &git.CreateTagOptions{
+		Tagger:  signature,
+		Message: op.note,
+	}); err != nil {
+		return fmt.Errorf("failed to create tag: %w", err)
+	}
+	return nil
+}
+
+// releaseNote returns the note of a release of the commit with hash: the
+// message, then what changed since the previous release
+func (op *releaseOperation) releaseNote(hash plumbing.Hash) (string, error) {
+	var note []string
+	if op.message != "" {
+		note = append(note, strings.TrimSpace(op.message))
+	}
+
+	releases, err := listReleases(op.repo)
+	if err != nil {
+		return "", err
+	}
+	if len(releases) == 0 {
+		count := 0
+		commits, err := op.repo.Log(&git.LogOptions{From: hash})
+		if err == nil {
+			err = commits.ForEach(func(*object.Commit) error {
+				count++
+				return nil
+			})
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read history: %w", err)
+		}
+		note = append(note, fmt.Sprintf("First release, %d commits", count))
+		return strings.Join(note, "\n\n"), nil
+	}
+
+	last := releases[len(releases)-1]
+	changes, err := newChangelog(op.repo, op.backend, last.Hash, hash)
+	if err != nil {
+		return "", err
+	}
+	if changes == nil {
+		note = append(note, fmt.Sprintf("No changes since %s", last.Name))
+	} else {
+		note = append(note, fmt.Sprintf("Changes since %s, %s", last.Name, changes))
+	}
+	return strings.Join(note, "\n\n"), nil
+}
+
+func (op *checkoutOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.verify(); err != nil {
+		return err
+	}
+
+	if err := op.checkout(); err != nil {
+		return err
+	}
+
+	return journal.CompleteEntry(op.ctx)
+}
+
+func (op *checkoutOperation) initialize() error {
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	entry, err := jm.CreateEntry(journal.OperationTypeCheckout, releaseTagPrefix+op.release.Name, op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// verify checks that no uncommitted change would be lost to the checkout
+func (op *checkoutOperation) verify() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify repository has no uncommitted changes", op.config.DotmanDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	files, err := changedFiles(op.repo, op.backend)
+	if err == nil && len(files) > 0 {
+		err = fmt.Errorf("%s has uncommitted changes, commit or stash them before following releases", files[0])
+	}
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Repository is clean"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// checkout moves HEAD to the release, detached, and writes its files
+func (op *checkoutOperation) checkout() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Check out release", releaseTagPrefix+op.release.Name, op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to add checkout step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+	if err := journal.RecordRollback(op.ctx, step, headRollback(op.repo)); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	written, err := checkoutCommit(op.fsys, op.repo, op.backend, op.release.Hash, op.config.Perm())
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Checked out %s, %d files changed", op.release.Hash, written)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// checkoutCommit points HEAD of repo at the commit with hash, detached, and
+// writes the files that differ from the commit HEAD pointed at, leaving the
+// rest of the worktree such as the journal alone. It returns the number of
+// files written or removed. Directories are created within perm.
+func checkoutCommit(fsys dotmanfs.FileSystem, repo *git.Repository, b backend, hash plumbing.Hash, perm dotmanfs.Perm) (int, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if head.Hash() == hash && head.Name() == plumbing.HEAD {
+		return 0, nil
+	}
+	current, err := commitFiles(repo, head.Hash())
+	if err != nil {
+		return 0, err
+	}
+	target, err := commitFiles(repo, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	var files []string
+	for file, entry := range target {
+		if current[file] != entry {
+			files = append(files, file)
+		}
+	}
+	for file := range current {
+		if _, ok := target[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		// A zero entry removes files the commit does not have
+		if err := checkoutFile(fsys, repo, b.filePath(file), target[file], perm); err != nil {
+			return 0, fmt.Errorf("error writing %s: %w", file, err)
+		}
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash)); err != nil {
+		return 0, fmt.Errorf("error moving HEAD: %w", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.MixedReset}); err != nil {
+		return 0, fmt.Errorf("error updating the index: %w", err)
+	}
+	return len(files), nil
+}
+
+// followRelease checks out release, a release name or latest, in the
+// repository of cfg unless HEAD already points at it, and returns the
+// release
+func followRelease(fsys dotmanfs.FileSystem, cfg *config.Config, name string) (releaseInfo, error) {
+	b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	repo, err := openRepo(fsys, cfg.DotmanDir, b)
+	if err != nil {
+		return releaseInfo{}, fmt.Errorf("failed to open repository: %w", err)
+	}
+	release, err := findRelease(repo, name)
+	if err != nil {
+		return releaseInfo{}, err
+	}
+	if head, err := repo.Head(); err == nil && head.Name() == plumbing.HEAD && head.Hash() == release.Hash {
+		return release, nil
+	}
+
+	op := &checkoutOperation{
+		config:  cfg,
+		fsys:    fsys,
+		ctx:     context.Background(),
+		repo:    repo,
+		backend: b,
+		release: release,
+	}
+	return release, op.run()
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestReleaseAndFollow(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".gitignore", "journal/\n")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file","package":"zsh"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+
+	b, err := loadBackend(fsys, dotmanDir, dotmanfs.Perm{})
+	if err != nil {
+		t.Fatalf("failed to load backend: %v", err)
+	}
+	release := func(name, message string) *releaseOperation {
+		return &releaseOperation{config: cfg, fsys: fsys, ctx: context.Background(), repo: repo, backend: b, name: name, message: message}
+	}
+
+	first := release("v1", "")
+	if err := first.run(); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if first.note != "First release, 1 commits" {
+		t.Errorf("unexpected first release note %q", first.note)
+	}
+	if err := release("v1", "").run(); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected a second v1 to be refused, got %v", err)
+	}
+	if err := release(latestRelease, "").run(); err == nil {
+		t.Error("expected latest to be refused as a release name")
+	}
+
+	// Uncommitted changes are not released
+	zshrc := filepath.Join(dotmanDir, "data/.zshrc")
+	fsys.WriteFile(zshrc, []byte("changed"), 0644)
+	if err := release("v2", "").run(); err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Fatalf("expected uncommitted changes to be refused, got %v", err)
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "changed")
+	second := release("v2", "New prompt")
+	if err := second.run(); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if !strings.HasPrefix(second.note, "New prompt\n\nChanges since v1, 1 new commits:") || !strings.Contains(second.note, "zsh:\n  modified .zshrc") {
+		t.Errorf("unexpected release note:\n%s", second.note)
+	}
+
+	releases, err := listReleases(repo)
+	if err != nil {
+		t.Fatalf("failed to list releases: %v", err)
+	}
+	if len(releases) != 2 || releases[0].Name != "v1" || releases[1].Name != "v2" {
+		t.Fatalf("expected v1 and v2, got %+v", releases)
+	}
+
+	// A stable machine pins v1
+	if _, err := followRelease(fsys, cfg, "v1"); err != nil {
+		t.Fatalf("failed to follow v1: %v", err)
+	}
+	if data, _ := fsys.ReadFile(zshrc); string(data) != "original" {
+		t.Errorf("expected the v1 .zshrc, got %q", data)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to resolve HEAD: %v", err)
+	}
+	if head.Name() != plumbing.HEAD || head.Hash() != releases[0].Hash {
+		t.Errorf("expected HEAD detached at v1, got %s %s", head.Name(), head.Hash())
+	}
+	if files, err := changedFiles(repo, b); err != nil || len(files) != 0 {
+		t.Errorf("expected a clean checkout, got %v (%v)", files, err)
+	}
+
+	if r, err := followRelease(fsys, cfg, latestRelease); err != nil || r.Name != "v2" {
+		t.Fatalf("expected to follow v2, got %+v (%v)", r, err)
+	}
+	if data, _ := fsys.ReadFile(zshrc); string(data) != "changed" {
+		t.Errorf("expected the v2 .zshrc, got %q", data)
+	}
+	if _, err := followRelease(fsys, cfg, "v3"); err == nil {
+		t.Error("expected an unknown release to be refused")
+	}
+}
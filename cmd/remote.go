@@ -2,10 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/go-git/go-git/v5"
-	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/noosxe/dotman/internal/config"
 	"github.com/spf13/cobra"
 )
@@ -25,28 +23,28 @@ var remoteShowCmd = &cobra.Command{
 		cfg, err := config.LoadConfig(configPath, fsys)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Open the repository
 		repo, err := git.PlainOpen(cfg.DotmanDir)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Get the remote
 		remote, err := repo.Remote("origin")
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Get the URL
 		urls := remote.Config().URLs
 		if len(urls) == 0 {
 			fmt.Println("No remote URL configured")
-			os.Exit(1)
+			exit(1)
 		}
 
 		fmt.Println("Remote URL:", urls[0])
@@ -61,40 +59,45 @@ var remoteSetCmd = &cobra.Command{
 		url, _ := cmd.Flags().GetString("url")
 		if url == "" {
 			fmt.Println("Error: URL is required")
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Load config
 		cfg, err := config.LoadConfig(configPath, fsys)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Open the repository
 		repo, err := git.PlainOpen(cfg.DotmanDir)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
-		// Remove existing remote if it exists
-		_, err = repo.Remote("origin")
-		if err == nil {
-			if err := repo.DeleteRemote("origin"); err != nil {
-				fmt.Printf("Error: %v\n", err)
-				os.Exit(1)
-			}
+		// Replace the origin remote
+		if err := setOriginURL(repo, url); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exit(1)
 		}
 
-		// Create new remote
-		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
-			Name: "origin",
-			URLs: []string{url},
-		})
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+		// Remember the remote in the active profile
+		if name, profile := cfg.CurrentProfile(); profile != nil {
+			fileCfg, err := readConfigFile()
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exit(1)
+			}
+			profile.Remote = url
+			if err := fileCfg.AddProfile(name, *profile); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				exit(1)
+			}
+			if err := config.SaveConfig(configPath, fileCfg, fsys); err != nil {
+				fmt.Printf("Error saving config: %v\n", err)
+				exit(1)
+			}
 		}
 
 		fmt.Printf("Successfully set remote URL to: %s\n", url)
@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+// conflict is a file a merge left unmerged in the index, with the blob of
+// each side. A side that does not have the file has a zero hash.
+type conflict struct {
+	// file is the path git reports the file as
+	file   string
+	base   plumbing.Hash
+	ours   plumbing.Hash
+	theirs plumbing.Hash
+}
+
+// resolveOperation merges the sides of a conflicted file with the merge tool
+// and marks the conflict resolved
+type resolveOperation struct {
+	config   *config.Config
+	fsys     dotmanfs.FileSystem
+	ctx      context.Context
+	repo     *git.Repository
+	backend  backend
+	conflict conflict
+	// mergeTool runs the merge tool command with env added to the
+	// environment
+	mergeTool func(command string, env []string) error
+}
+
+var resolveCmd = &cobra.Command{
+	Use:   "resolve [path]",
+	Short: "Merge a tracked file left conflicted by a merge",
+	Long: `Resolve a content conflict a git merge left in a tracked file, e.g. after
+'git -C <dotman_dir> merge' brought in edits made on another machine.
+
+The merge base, this machine's version and the other one are extracted from
+git into temporary files, and the merge_tool config key is run through sh
+with $BASE, $LOCAL, $REMOTE and $MERGED set to them, like git mergetool.
+$MERGED starts as the conflicted file, conflict markers included. Without
+merge_tool, $VISUAL or $EDITOR opens $MERGED.
+
+Once the tool succeeds and no conflict markers are left, the result is
+written to the tracked copy and staged, marking the conflict resolved.
+Commit it with 'dotman commit'.
+
+Without a path, resolve lists the conflicted files.`,
+	Example: `  dotman config set merge_tool 'vimdiff "$LOCAL" "$MERGED" "$REMOTE"'
+  dotman resolve ~/.zshrc`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(fsys, cfg.DotmanDir, b)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		conflicts, err := listConflicts(repo)
+		if err != nil {
+			return fmt.Errorf("error reading conflicts: %w", err)
+		}
+
+		if len(args) == 0 {
+			return printConflicts(b, conflicts)
+		}
+
+		rel, err := entryPath(args[0])
+		if err != nil {
+			return err
+		}
+		file := b.gitPath(manifest.Entry{Path: rel})
+		i := slices.IndexFunc(conflicts, func(c conflict) bool { return c.file == file })
+		if i < 0 {
+			return fmt.Errorf("%s has no conflict to resolve", args[0])
+		}
+
+		op := &resolveOperation{
+			config:    cfg,
+			fsys:      fsys,
+			ctx:       context.Background(),
+			repo:      repo,
+			backend:   b,
+			conflict:  conflicts[i],
+			mergeTool: runMergeTool,
+		}
+		if err := op.run(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Resolved %s, commit it with 'dotman commit'\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+}
+
+// listConflicts returns the conflicted files of the index of repo, sorted
+func listConflicts(repo *git.Repository) ([]conflict, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []conflict
+	for _, e := range idx.Entries {
+		// Merged entries are stage 0 on disk, go-git's index.Merged is 1 and
+		// would be mistaken for the ancestor
+		if e.Stage == 0 {
+			continue
+		}
+		i := slices.IndexFunc(conflicts, func(c conflict) bool { return c.file == e.Name })
+		if i < 0 {
+			conflicts = append(conflicts, conflict{file: e.Name})
+			i = len(conflicts) - 1
+		}
+		switch e.Stage {
+		case index.AncestorMode:
+			conflicts[i].base = e.Hash
+		case index.OurMode:
+			conflicts[i].ours = e.Hash
+		case index.TheirMode:
+			conflicts[i].theirs = e.Hash
+		}
+	}
+	slices.SortFunc(conflicts, func(a, b conflict) int { return strings.Compare(a.file, b.file) })
+	return conflicts, nil
+}
+
+// printConflicts lists the conflicted files by their home path, or their
+// path in the repository for files that belong to no entry
+func printConflicts(b backend, conflicts []conflict) error {
+	if len(conflicts) == 0 {
+		fmt.Println("No conflicts")
+		return nil
+	}
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error getting user home directory: %w", err)
+	}
+	for _, c := range conflicts {
+		if rel, ok := b.entryPath(c.file); ok {
+			fmt.Println(manifest.Entry{Path: filepath.FromSlash(rel)}.TargetPath(homeDir))
+			continue
+		}
+		fmt.Println(c.file)
+	}
+	return nil
+}
+
+func (op *resolveOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.merge(); err != nil {
+		return err
+	}
+
+	if err := op.markResolved(); err != nil {
+		return err
+	}
+
+	return journal.CompleteEntry(op.ctx)
+}
+
+func (op *resolveOperation) initialize() error {
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	entry, err := jm.CreateEntry(journal.OperationTypeResolve, "", op.backend.filePath(op.conflict.file))
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// merge runs the merge tool on the sides of the conflict and writes its
+// result over the conflicted file
+func (op *resolveOperation) merge() error {
+	merged := op.backend.filePath(op.conflict.file)
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeWrite, "Merge conflicted file", "", merged)
+	if err != nil {
+		return fmt.Errorf("failed to add merge step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	result, err := op.runTool(merged)
+	if err == nil && hasConflictMarkers(result) {
+		err = fmt.Errorf("the merge of %s still has conflict markers, run resolve again", op.conflict.file)
+	}
+	// A deduplicated copy links to a shared blob, which must not be
+	// written through
+	if info, lerr := op.fsys.Lstat(merged); err == nil && lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+		err = op.fsys.Remove(merged)
+	}
+	if err == nil {
+		err = op.fsys.WriteFile(merged, result, op.config.FilePerm())
+	}
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Merged %d bytes", len(result))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// runTool writes the sides of the conflict and the conflicted file at merged
+// to a temporary directory, runs the merge tool on them and returns the
+// merged content
+func (op *resolveOperation) runTool(merged string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "dotman-resolve-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The sides are named like git mergetool names them, keeping the
+	// extension for the tool's syntax highlighting
+	name := path.Base(op.conflict.file)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	current, err := op.fsys.ReadFile(merged)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading conflicted file: %w", err)
+	}
+	result := filepath.Join(dir, name)
+	if err := os.WriteFile(result, current, 0600); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", result, err)
+	}
+	env := []string{"MERGED=" + result}
+
+	sides := []struct {
+		name string
+		hash plumbing.Hash
+	}{{"BASE", op.conflict.base}, {"LOCAL", op.conflict.ours}, {"REMOTE", op.conflict.theirs}}
+	for _, side := range sides {
+		data, err := op.blob(side.hash)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the %s version: %w", strings.ToLower(side.name), err)
+		}
+		file := filepath.Join(dir, fmt.Sprintf("%s_%s%s", stem, side.name, ext))
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", file, err)
+		}
+		env = append(env, side.name+"="+file)
+	}
+
+	command := op.config.MergeTool
+	if command == "" {
+		command = editorCommand() + ` "$MERGED"`
+	}
+	if err := op.mergeTool(command, env); err != nil {
+		return nil, fmt.Errorf("merge tool failed, the conflict is left as is: %w", err)
+	}
+
+	return os.ReadFile(result)
+}
+
+// blob returns the content of the blob with hash, empty for a side that
+// does not have the file
+func (op *resolveOperation) blob(hash plumbing.Hash) ([]byte, error) {
+	if hash.IsZero() {
+		return nil, nil
+	}
+	blob, err := op.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// markResolved stages the merged file in place of the sides of the conflict
+func (op *resolveOperation) markResolved() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Mark conflict resolved", op.conflict.file, "")
+	if err != nil {
+		return fmt.Errorf("failed to add git step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	err = stageRemoval(op.repo, op.conflict.file)
+	if err == nil {
+		var worktree *git.Worktree
+		if worktree, err = op.repo.Worktree(); err == nil {
+			_, err = worktree.Add(op.conflict.file)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("error staging %s: %w", op.conflict.file, err)
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Staged %s", op.conflict.file)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// hasConflictMarkers reports whether data still holds a conflict marker at
+// the start of a line
+func hasConflictMarkers(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		for _, marker := range []string{"<<<<<<< ", "=======", ">>>>>>> "} {
+			if bytes.HasPrefix(line, []byte(marker)) && (marker != "=======" || len(bytes.TrimRight(line, "\r")) == len(marker)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// editorCommand returns the editor the user configured, vi without one
+func editorCommand() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	return "vi"
+}
+
+// runMergeTool runs command through sh on the terminal, with env added to
+// the environment
+func runMergeTool(command string, env []string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = terminalOutput()
+	cmd.Stderr = terminalOutput()
+	return cmd.Run()
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+// storeBlob writes content to the object storage of repo
+func storeBlob(t *testing.T, repo *git.Repository, content string) plumbing.Hash {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+	w.Write([]byte(content))
+	w.Close()
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store blob: %v", err)
+	}
+	return hash
+}
+
+func TestResolveOperation(t *testing.T) {
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+	repo, _, _ := testutil.SetupTestGitRepo(t, memFS, dotmanDir)
+
+	// A merge left .zshrc conflicted, with markers in the worktree
+	conflicted := "<<<<<<< HEAD\nexport EDITOR=vim\n=======\nexport EDITOR=nvim\n>>>>>>> origin/main\n"
+	zshrc := filepath.Join(dotmanDir, "data/.zshrc")
+	memFS.WriteFile(zshrc, []byte(conflicted), 0644)
+	idx := &index.Index{Version: 2}
+	for stage, content := range map[index.Stage]string{
+		index.AncestorMode: "export EDITOR=vi\n",
+		index.OurMode:      "export EDITOR=vim\n",
+		index.TheirMode:    "export EDITOR=nvim\n",
+	} {
+		idx.Entries = append(idx.Entries, &index.Entry{Name: "data/.zshrc", Hash: storeBlob(t, repo, content), Mode: filemode.Regular, Stage: stage})
+	}
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	b, err := loadBackend(memFS, dotmanDir, dotmanfs.Perm{})
+	if err != nil {
+		t.Fatalf("failed to load backend: %v", err)
+	}
+	conflicts, err := listConflicts(repo)
+	if err != nil {
+		t.Fatalf("listConflicts() returned error: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].file != "data/.zshrc" || conflicts[0].base.IsZero() || conflicts[0].ours.IsZero() || conflicts[0].theirs.IsZero() {
+		t.Fatalf("expected .zshrc to be conflicted with three sides, got %+v", conflicts)
+	}
+
+	// A tool leaving the markers in place resolves nothing
+	op := &resolveOperation{
+		config:    cfg,
+		fsys:      memFS,
+		ctx:       context.Background(),
+		repo:      repo,
+		backend:   b,
+		conflict:  conflicts[0],
+		mergeTool: func(command string, env []string) error { return nil },
+	}
+	if err := op.run(); err == nil || !strings.Contains(err.Error(), "conflict markers") {
+		t.Fatalf("expected the markers to be refused, got %v", err)
+	}
+	if data, _ := memFS.ReadFile(zshrc); string(data) != conflicted {
+		t.Errorf("expected the conflicted file to be left alone, got %q", data)
+	}
+
+	// The tool gets every side and writes the merge
+	cfg.MergeTool = "merge"
+	sides := make(map[string]string)
+	op = &resolveOperation{
+		config:   cfg,
+		fsys:     memFS,
+		ctx:      context.Background(),
+		repo:     repo,
+		backend:  b,
+		conflict: conflicts[0],
+		mergeTool: func(command string, env []string) error {
+			if command != "merge" {
+				t.Errorf("expected the merge_tool command, got %q", command)
+			}
+			for _, v := range env {
+				name, path, _ := strings.Cut(v, "=")
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				sides[name] = string(data)
+				if name == "MERGED" {
+					os.WriteFile(path, []byte("export EDITOR=nvim\n"), 0600)
+				}
+			}
+			return nil
+		},
+	}
+	if err := op.run(); err != nil {
+		t.Fatalf("run() returned error: %v", err)
+	}
+	if sides["BASE"] != "export EDITOR=vi\n" || sides["LOCAL"] != "export EDITOR=vim\n" || sides["REMOTE"] != "export EDITOR=nvim\n" || sides["MERGED"] != conflicted {
+		t.Errorf("expected the tool to get every side, got %+v", sides)
+	}
+	if data, _ := memFS.ReadFile(zshrc); string(data) != "export EDITOR=nvim\n" {
+		t.Errorf("expected the merge to be written to the copy, got %q", data)
+	}
+
+	// The conflict is resolved in the index
+	if conflicts, err := listConflicts(repo); err != nil || len(conflicts) != 0 {
+		t.Errorf("expected no conflicts left, got %+v (%v)", conflicts, err)
+	}
+	idx, err = repo.Storer.Index()
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	if len(idx.Entries) != 1 || idx.Entries[0].Stage != 0 {
+		t.Errorf("expected .zshrc to be staged as merged, got %+v", idx.Entries)
+	}
+
+	entry, err := journal.GetJournalEntry(op.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeResolve, journal.EntryStateCompleted, 2)
+}
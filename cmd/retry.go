@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+)
+
+// sleep waits between retries, replaced in tests
+var sleep = time.Sleep
+
+// isOffline reports whether err means the remote could not be reached, as
+// opposed to the remote refusing the operation
+func isOffline(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH)
+}
+
+// withRetry runs fn, running it again after connectivity failures as often
+// as the config allows. The wait before each retry doubles, starting at the
+// configured backoff. Other failures are returned right away.
+func withRetry(cfg *config.Config, what string, fn func() error) error {
+	retries, err := cfg.NetworkRetryCount()
+	if err != nil {
+		return err
+	}
+	backoff, err := cfg.RetryBackoffDuration()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isOffline(err) || attempt >= retries {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Failed to %s, retrying in %s: %v\n", what, backoff, err)
+		sleep(backoff)
+		backoff *= 2
+	}
+}
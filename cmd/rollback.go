@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+// pathRollback returns the rollback data describing path before a step
+// replaces or removes it: its mode and, for a symlink, its target
+func pathRollback(fsys dotmanfs.FileSystem, path string) journal.Rollback {
+	info, err := fsys.Lstat(path)
+	if err != nil {
+		return journal.Rollback{}
+	}
+
+	rollback := journal.Rollback{Mode: info.Mode()}
+	if info.Mode()&os.ModeSymlink != 0 {
+		rollback.LinkTarget, _ = fsys.Readlink(path)
+	}
+	return rollback
+}
+
+// headRollback returns the rollback data of a step that moves HEAD or
+// changes the index: the commit HEAD points at. An unborn HEAD has none.
+func headRollback(repo *git.Repository) journal.Rollback {
+	head, err := repo.Head()
+	if err != nil {
+		return journal.Rollback{}
+	}
+	return journal.Rollback{GitRef: head.Hash().String()}
+}
+
+// remoteRollback returns the rollback data of a push: the commit the
+// remote-tracking branch of HEAD points at, none when it does not exist yet
+func remoteRollback(repo *git.Repository, remote string) journal.Rollback {
+	head, err := repo.Head()
+	if err != nil {
+		return journal.Rollback{}
+	}
+
+	name := plumbing.NewRemoteReferenceName(remote, head.Name().Short())
+	rollback := journal.Rollback{GitRefName: name.String()}
+	if ref, err := repo.Reference(name, true); err == nil {
+		rollback.GitRef = ref.Hash().String()
+	}
+	return rollback
+}
@@ -1,18 +1,25 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
+	"github.com/noosxe/dotman/internal/config"
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 	"github.com/spf13/cobra"
 )
 
 var (
-	configPath string
-	verbose    bool
-	fsys       = dotmanfs.NewOSFileSystem()
+	configPath  string
+	profileName string
+	verbose     bool
+	logFile     string
+	quiet       bool
+	assumeYes   bool
+	trace       bool
+	noScripts   bool
+	fsys        dotmanfs.FileSystem = dotmanfs.NewOSFileSystem()
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -21,14 +28,40 @@ var rootCmd = &cobra.Command{
 	Short: "A dotfile manager",
 	Long: `dotman is a CLI tool for managing dotfiles.
 It helps you track, version control, and sync your dotfiles across different machines.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if quiet {
+			if err := holdOutput(); err != nil {
+				return err
+			}
+		}
+		if trace {
+			tracer = newTraceObserver()
+		}
+		return applyProfileFlag()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
+	// Commands dotman does not know may be plugins
+	if path, ok := pluginForArgs(os.Args[1:]); ok {
+		code, err := runPlugin(path, os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+		}
+		exit(code)
+	}
+
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			exit(exitErr.code)
+		}
 		fmt.Println(err)
-		os.Exit(1)
+		exit(exitError)
 	}
+	printTrace()
+	releaseOutput(exitOK)
 }
 
 func init() {
@@ -37,9 +70,26 @@ func init() {
 	if err != nil {
 		home = "~"
 	}
-	defaultConfigPath := filepath.Join(home, ".dotconfig")
+	defaultConfigPath := config.FindConfigFile(fsys, home)
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", defaultConfigPath, "path to config file (default is $HOME/.dotconfig)")
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", defaultConfigPath, "path to config file, JSON, TOML or YAML by extension (default is $HOME/.dotconfig, .dotconfig.toml or .dotconfig.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "P", "", "profile to use instead of the active one (also DOTMAN_PROFILE)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output, including the progress of every operation step")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "print nothing when the command succeeds, see 'dotman help exit-codes'")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "do not ask before destructive actions, for scripts")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "no-input", false, "same as --yes")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "append a JSON log of operation events to this file")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "do not color output (also NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "print the time every operation step took when the command is done")
+	rootCmd.PersistentFlags().BoolVar(&noScripts, "no-scripts", false, "run no hooks, for a repository you do not trust yet")
+}
+
+// applyProfileFlag selects the profile given with --profile. It is passed on
+// as DOTMAN_PROFILE, so config loading scopes every command to the profile.
+func applyProfileFlag() error {
+	if profileName == "" {
+		return nil
+	}
+	return os.Setenv("DOTMAN_PROFILE", profileName)
 }
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/scan"
+	"github.com/spf13/cobra"
+)
+
+var scanJSON bool
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "List well-known dotfiles that are not tracked yet",
+	Long: `Scan the home directory for well-known dotfiles such as shell rc files,
+editor configs, terminal emulator configs and git config, and report the ones
+that exist but are not tracked by dotman. Nothing is modified.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		homeDir, err := fsys.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get user home directory: %w", err)
+		}
+
+		m, err := manifest.Load(fsys, cfg.DotmanDir)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %w", err)
+		}
+
+		candidates, err := scan.Scan(fsys, homeDir, m)
+		if err != nil {
+			return fmt.Errorf("failed to scan home directory: %w", err)
+		}
+
+		if scanJSON {
+			if candidates == nil {
+				candidates = []scan.Candidate{}
+			}
+			data, err := json.MarshalIndent(candidates, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode candidates: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(candidates) == 0 {
+			fmt.Println("No untracked dotfiles found")
+			return nil
+		}
+
+		fmt.Println("Untracked dotfiles:")
+		categories := []scan.Category{scan.CategoryShell, scan.CategoryEditor, scan.CategoryTerminal, scan.CategoryGit, scan.CategoryOther}
+		for _, category := range categories {
+			var paths []string
+			for _, c := range candidates {
+				if c.Category != category {
+					continue
+				}
+				if c.IsDir {
+					paths = append(paths, c.Path+"/")
+				} else {
+					paths = append(paths, c.Path)
+				}
+			}
+			if len(paths) == 0 {
+				continue
+			}
+
+			fmt.Printf("\n%s:\n", category)
+			for _, path := range paths {
+				fmt.Printf("  %s\n", path)
+			}
+		}
+
+		fmt.Println("\nUse \"dotman add --path <path>\" or \"dotman add --interactive\" to track them.")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.Flags().BoolVar(&scanJSON, "json", false, "print the candidates as JSON")
+}
@@ -0,0 +1,457 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+// scheduleName names the units, agent and crontab line dotman installs
+const scheduleName = "dotman-schedule"
+
+// launchdLabel is the label of the launchd agent
+const launchdLabel = "com.github.noosxe.dotman.schedule"
+
+var (
+	scheduleInterval time.Duration
+	scheduleRun      string
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run dotman periodically with the system scheduler",
+	Long: `Install, inspect and remove a periodic run of dotman, so machines keep in step
+without anyone remembering to run it.
+
+The run uses a systemd user timer where systemd is available, a launchd agent
+on macOS, and a crontab entry otherwise.`,
+}
+
+var scheduleInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install a periodic run of dotman",
+	Long: `Install a periodic run of dotman, replacing the one installed before.
+
+The run is 'dotman push' every hour unless --run and --interval say otherwise.
+It uses the config file of this invocation and the dotman binary running it.`,
+	Example: `  dotman schedule install
+  dotman schedule install --interval 30m --run "link"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if scheduleInterval < time.Minute {
+			return fmt.Errorf("interval must be at least a minute")
+		}
+		run := strings.Fields(scheduleRun)
+		if len(run) == 0 {
+			return fmt.Errorf("--run must name a dotman command")
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find the dotman executable: %w", err)
+		}
+
+		s, err := newScheduler(fsys, runtime.GOOS, hasCommand)
+		if err != nil {
+			return err
+		}
+		job := scheduledJob{
+			args:     append([]string{exe, "--config", configPath}, run...),
+			interval: scheduleInterval,
+		}
+		if err := s.install(job); err != nil {
+			return err
+		}
+
+		fmt.Printf("Scheduled 'dotman %s' every %s with %s\n", strings.Join(run, " "), scheduleInterval, s.name())
+		return nil
+	},
+}
+
+var scheduleStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the installed periodic run",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := newScheduler(fsys, runtime.GOOS, hasCommand)
+		if err != nil {
+			return err
+		}
+		status, installed, err := s.status()
+		if err != nil {
+			return err
+		}
+		if !installed {
+			fmt.Printf("No periodic run installed with %s\n", s.name())
+			return nil
+		}
+		fmt.Printf("Installed with %s\n%s\n", s.name(), status)
+		return nil
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove the installed periodic run",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := newScheduler(fsys, runtime.GOOS, hasCommand)
+		if err != nil {
+			return err
+		}
+		if _, installed, err := s.status(); err != nil {
+			return err
+		} else if !installed {
+			fmt.Printf("No periodic run installed with %s\n", s.name())
+			return nil
+		}
+		if err := s.remove(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed the periodic run from %s\n", s.name())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleInstallCmd)
+	scheduleCmd.AddCommand(scheduleStatusCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+
+	scheduleInstallCmd.Flags().DurationVar(&scheduleInterval, "interval", time.Hour, "time between runs, e.g. 30m or 6h")
+	scheduleInstallCmd.Flags().StringVar(&scheduleRun, "run", "push", "dotman command and arguments to run")
+}
+
+// scheduleCommand runs a command of the system scheduler with stdin as its
+// input and returns its output. Tests replace it.
+var scheduleCommand = func(stdin, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// hasCommand reports whether the named command is on PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// scheduledJob is a periodic run of dotman
+type scheduledJob struct {
+	// args is the command line, the executable first
+	args     []string
+	interval time.Duration
+}
+
+// scheduler installs a periodic run with a scheduler of the system
+type scheduler interface {
+	name() string
+	install(job scheduledJob) error
+	// status describes the installed run, if there is one
+	status() (string, bool, error)
+	remove() error
+}
+
+// newScheduler returns the scheduler to use on goos, given which commands
+// are available
+func newScheduler(fsys dotmanfs.FileSystem, goos string, has func(string) bool) (scheduler, error) {
+	home, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	switch {
+	case goos == "darwin":
+		return &launchdScheduler{fsys: fsys, path: filepath.Join(home, "Library/LaunchAgents", launchdLabel+".plist")}, nil
+	case goos == "linux" && has("systemctl"):
+		return &systemdScheduler{fsys: fsys, dir: filepath.Join(home, ".config/systemd/user")}, nil
+	case goos != "windows" && has("crontab"):
+		return &cronScheduler{}, nil
+	}
+	return nil, fmt.Errorf("no supported scheduler found, dotman needs systemd, launchd or cron")
+}
+
+// systemdScheduler installs a systemd user timer and the service it starts
+type systemdScheduler struct {
+	fsys dotmanfs.FileSystem
+	dir  string
+}
+
+func (s *systemdScheduler) name() string { return "a systemd user timer" }
+
+func (s *systemdScheduler) install(job scheduledJob) error {
+	service := fmt.Sprintf(`[Unit]
+Description=Periodic run of dotman
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, systemdJoin(job.args))
+	timer := fmt.Sprintf(`[Unit]
+Description=Run dotman every %s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, job.interval, int(job.interval.Seconds()))
+
+	if err := s.fsys.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", s.dir, err)
+	}
+	if err := s.fsys.WriteFile(filepath.Join(s.dir, scheduleName+".service"), []byte(service), 0644); err != nil {
+		return fmt.Errorf("error writing service: %w", err)
+	}
+	if err := s.fsys.WriteFile(filepath.Join(s.dir, scheduleName+".timer"), []byte(timer), 0644); err != nil {
+		return fmt.Errorf("error writing timer: %w", err)
+	}
+
+	if _, err := scheduleCommand("", "systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	_, err := scheduleCommand("", "systemctl", "--user", "enable", "--now", scheduleName+".timer")
+	return err
+}
+
+func (s *systemdScheduler) status() (string, bool, error) {
+	timer := filepath.Join(s.dir, scheduleName+".timer")
+	if _, err := s.fsys.Stat(timer); os.IsNotExist(err) {
+		return "", false, nil
+	}
+	// is-active fails for inactive timers, its output says which
+	state, _ := scheduleCommand("", "systemctl", "--user", "is-active", scheduleName+".timer")
+	service, err := s.fsys.ReadFile(filepath.Join(s.dir, scheduleName+".service"))
+	if err != nil {
+		return "", false, fmt.Errorf("error reading service: %w", err)
+	}
+	var command string
+	for _, line := range strings.Split(string(service), "\n") {
+		if value, ok := strings.CutPrefix(line, "ExecStart="); ok {
+			command = value
+		}
+	}
+	return fmt.Sprintf("Timer: %s (%s)\nCommand: %s", timer, strings.TrimSpace(state), command), true, nil
+}
+
+func (s *systemdScheduler) remove() error {
+	if _, err := scheduleCommand("", "systemctl", "--user", "disable", "--now", scheduleName+".timer"); err != nil {
+		return err
+	}
+	for _, unit := range []string{scheduleName + ".timer", scheduleName + ".service"} {
+		if err := s.fsys.Remove(filepath.Join(s.dir, unit)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", unit, err)
+		}
+	}
+	_, err := scheduleCommand("", "systemctl", "--user", "daemon-reload")
+	return err
+}
+
+// launchdScheduler installs a launchd agent
+type launchdScheduler struct {
+	fsys dotmanfs.FileSystem
+	path string
+}
+
+func (s *launchdScheduler) name() string { return "a launchd agent" }
+
+func (s *launchdScheduler) install(job scheduledJob) error {
+	var args strings.Builder
+	for _, arg := range job.args {
+		args.WriteString("\t\t<string>")
+		xml.EscapeText(&args, []byte(arg))
+		args.WriteString("</string>\n")
+	}
+	plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>StartInterval</key>
+	<integer>%d</integer>
+	<key>RunAtLoad</key>
+	<true/>
+</dict>
+</plist>
+`, launchdLabel, args.String(), int(job.interval.Seconds()))
+
+	// A previous agent is unloaded first, launchd keeps its old settings
+	// otherwise
+	if _, err := s.fsys.Stat(s.path); err == nil {
+		scheduleCommand("", "launchctl", "unload", s.path)
+	}
+	if err := s.fsys.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("error creating %s: %w", filepath.Dir(s.path), err)
+	}
+	if err := s.fsys.WriteFile(s.path, []byte(plist), 0644); err != nil {
+		return fmt.Errorf("error writing agent: %w", err)
+	}
+	_, err := scheduleCommand("", "launchctl", "load", "-w", s.path)
+	return err
+}
+
+func (s *launchdScheduler) status() (string, bool, error) {
+	if _, err := s.fsys.Stat(s.path); os.IsNotExist(err) {
+		return "", false, nil
+	}
+	state := "loaded"
+	if _, err := scheduleCommand("", "launchctl", "list", launchdLabel); err != nil {
+		state = "not loaded"
+	}
+	return fmt.Sprintf("Agent: %s (%s)", s.path, state), true, nil
+}
+
+func (s *launchdScheduler) remove() error {
+	if _, err := scheduleCommand("", "launchctl", "unload", "-w", s.path); err != nil {
+		return err
+	}
+	if err := s.fsys.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing agent: %w", err)
+	}
+	return nil
+}
+
+// cronScheduler installs a line in the user's crontab, marked so it can be
+// found again
+type cronScheduler struct{}
+
+func (s *cronScheduler) name() string { return "cron" }
+
+// cronMarker ends the crontab line dotman manages
+const cronMarker = "# " + scheduleName
+
+func (s *cronScheduler) install(job scheduledJob) error {
+	spec, err := cronSpec(job.interval)
+	if err != nil {
+		return err
+	}
+	lines, err := s.lines()
+	if err != nil {
+		return err
+	}
+	lines = append(lines, fmt.Sprintf("%s %s %s", spec, cronJoin(job.args), cronMarker))
+	return s.write(lines)
+}
+
+func (s *cronScheduler) status() (string, bool, error) {
+	out, err := s.crontab()
+	if err != nil {
+		return "", false, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasSuffix(line, cronMarker) {
+			return "Entry: " + strings.TrimSpace(strings.TrimSuffix(line, cronMarker)), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (s *cronScheduler) remove() error {
+	lines, err := s.lines()
+	if err != nil {
+		return err
+	}
+	return s.write(lines)
+}
+
+// crontab returns the user's crontab, empty when there is none
+func (s *cronScheduler) crontab() (string, error) {
+	out, err := scheduleCommand("", "crontab", "-l")
+	if err != nil {
+		if strings.Contains(out, "no crontab") {
+			return "", nil
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+// lines returns the lines of the crontab without the one dotman manages
+func (s *cronScheduler) lines() ([]string, error) {
+	out, err := s.crontab()
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if line != "" && !strings.HasSuffix(line, cronMarker) {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// write replaces the crontab with lines
+func (s *cronScheduler) write(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	_, err := scheduleCommand(buf.String(), "crontab", "-")
+	return err
+}
+
+// cronSpec returns the schedule of a crontab line running every interval.
+// Cron counts from the start of the hour and the day, so the interval has
+// to divide one of them evenly.
+func cronSpec(interval time.Duration) (string, error) {
+	switch {
+	case interval%time.Minute != 0:
+	case interval < time.Hour && time.Hour%interval == 0:
+		return fmt.Sprintf("*/%d * * * *", int(interval.Minutes())), nil
+	case interval == time.Hour:
+		return "0 * * * *", nil
+	case interval < 24*time.Hour && interval%time.Hour == 0 && (24*time.Hour)%interval == 0:
+		return fmt.Sprintf("0 */%d * * *", int(interval.Hours())), nil
+	case interval%(24*time.Hour) == 0:
+		return fmt.Sprintf("0 0 */%d * *", int(interval.Hours()/24)), nil
+	}
+	return "", fmt.Errorf("cron cannot run every %s, use an interval dividing an hour or a day, or whole days", interval)
+}
+
+// cronJoin quotes args for the shell cron runs them with. Cron itself
+// turns % into a newline, so it is escaped as well.
+func cronJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.ReplaceAll(strings.Join(quoted, " "), "%", `\%`)
+}
+
+// systemdJoin quotes args for an ExecStart line, where % starts a specifier
+func systemdJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "%", "%%")
+		if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$") {
+			quoted[i] = arg
+		} else {
+			quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(arg) + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
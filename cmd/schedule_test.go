@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+// fakeScheduler replaces scheduleCommand, keeping a crontab and recording
+// the commands run
+type fakeScheduler struct {
+	calls   []string
+	crontab string
+}
+
+func (f *fakeScheduler) run(stdin, name string, args ...string) (string, error) {
+	call := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, call)
+	switch call {
+	case "crontab -l":
+		if f.crontab == "" {
+			return "no crontab for test\n", fmt.Errorf("exit status 1")
+		}
+		return f.crontab, nil
+	case "crontab -":
+		f.crontab = stdin
+	case "systemctl --user is-active " + scheduleName + ".timer":
+		return "active\n", nil
+	}
+	return "", nil
+}
+
+func useFakeScheduler(t *testing.T) *fakeScheduler {
+	fake := &fakeScheduler{}
+	orig := scheduleCommand
+	scheduleCommand = fake.run
+	t.Cleanup(func() { scheduleCommand = orig })
+	return fake
+}
+
+func TestNewScheduler(t *testing.T) {
+	fsys, err := testutil.NewMemFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	tests := []struct {
+		goos     string
+		commands string
+		want     string
+	}{
+		{goos: "linux", commands: "systemctl crontab", want: "a systemd user timer"},
+		{goos: "linux", commands: "crontab", want: "cron"},
+		{goos: "freebsd", commands: "crontab", want: "cron"},
+		{goos: "darwin", want: "a launchd agent"},
+		{goos: "windows", commands: "crontab"},
+	}
+	for _, tt := range tests {
+		has := func(name string) bool { return strings.Contains(tt.commands, name) }
+		s, err := newScheduler(fsys, tt.goos, has)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected no scheduler, got %s", tt.goos, s.name())
+			}
+			continue
+		}
+		if err != nil || s.name() != tt.want {
+			t.Errorf("%s with %q: expected %s, got %v (%v)", tt.goos, tt.commands, tt.want, s, err)
+		}
+	}
+}
+
+func TestSystemdScheduler(t *testing.T) {
+	fsys, err := testutil.NewMemFS()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+	fake := useFakeScheduler(t)
+
+	dir := filepath.Join(testutil.TestHomeDir, ".config/systemd/user")
+	s := &systemdScheduler{fsys: fsys, dir: dir}
+	job := scheduledJob{args: []string{"/usr/bin/dotman", "--config", "/home/test/my config", "push"}, interval: 90 * time.Minute}
+	if err := s.install(job); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	service, err := fsys.ReadFile(filepath.Join(dir, scheduleName+".service"))
+	if err != nil || !strings.Contains(string(service), `ExecStart=/usr/bin/dotman --config "/home/test/my config" push`) {
+		t.Errorf("unexpected service %q (%v)", service, err)
+	}
+	timer, err := fsys.ReadFile(filepath.Join(dir, scheduleName+".timer"))
+	if err != nil || !strings.Contains(string(timer), "OnUnitActiveSec=5400s") {
+		t.Errorf("unexpected timer %q (%v)", timer, err)
+	}
+	if got := strings.Join(fake.calls, "; "); got != "systemctl --user daemon-reload; systemctl --user enable --now "+scheduleName+".timer" {
+		t.Errorf("unexpected commands %s", got)
+	}
+
+	status, installed, err := s.status()
+	if err != nil || !installed || !strings.Contains(status, "(active)") || !strings.Contains(status, "push") {
+		t.Errorf("unexpected status %q %v (%v)", status, installed, err)
+	}
+
+	if err := s.remove(); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, installed, _ := s.status(); installed {
+		t.Error("expected the timer to be removed")
+	}
+}
+
+func TestCronScheduler(t *testing.T) {
+	fake := useFakeScheduler(t)
+	fake.crontab = "0 3 * * * backup\n"
+
+	s := &cronScheduler{}
+	job := scheduledJob{args: []string{"/usr/bin/dotman", "--config", "/home/test/.dotconfig", "push"}, interval: 30 * time.Minute}
+	if err := s.install(job); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	// Installing again replaces the line
+	job.interval = 6 * time.Hour
+	if err := s.install(job); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	want := "0 3 * * * backup\n0 */6 * * * /usr/bin/dotman --config /home/test/.dotconfig push " + cronMarker + "\n"
+	if fake.crontab != want {
+		t.Errorf("crontab = %q, want %q", fake.crontab, want)
+	}
+	if status, installed, err := s.status(); err != nil || !installed || !strings.HasPrefix(status, "Entry: 0 */6") {
+		t.Errorf("unexpected status %q %v (%v)", status, installed, err)
+	}
+
+	if err := s.remove(); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if fake.crontab != "0 3 * * * backup\n" {
+		t.Errorf("expected only the other line to be left, got %q", fake.crontab)
+	}
+}
+
+func TestCronSpec(t *testing.T) {
+	tests := map[time.Duration]string{
+		15 * time.Minute: "*/15 * * * *",
+		time.Hour:        "0 * * * *",
+		8 * time.Hour:    "0 */8 * * *",
+		48 * time.Hour:   "0 0 */2 * *",
+	}
+	for interval, want := range tests {
+		if got, err := cronSpec(interval); err != nil || got != want {
+			t.Errorf("cronSpec(%s) = %q (%v), want %q", interval, got, err, want)
+		}
+	}
+	for _, interval := range []time.Duration{7 * time.Minute, 90 * time.Minute, 36 * time.Hour, 90 * time.Second} {
+		if spec, err := cronSpec(interval); err == nil {
+			t.Errorf("expected cronSpec(%s) to fail, got %q", interval, spec)
+		}
+	}
+}
+
+func TestCronJoin(t *testing.T) {
+	got := cronJoin([]string{"/opt/dot man/dotman", "--run", "it's", "50%"})
+	want := `'/opt/dot man/dotman' --run 'it'\''s' '50\%'`
+	if got != want {
+		t.Errorf("cronJoin = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/noosxe/dotman/internal/release"
+	"github.com/noosxe/dotman/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateChannel string
+	updateForce   bool
+)
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update dotman to the latest release",
+	Long: `Download the release binary for the current OS and architecture, verify it
+against the release checksums and atomically replace the running executable.
+
+Use --channel prerelease to also consider pre-releases.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var prerelease bool
+		switch updateChannel {
+		case "stable":
+		case "prerelease":
+			prerelease = true
+		default:
+			return fmt.Errorf("invalid channel '%s'. Valid channels are: stable, prerelease", updateChannel)
+		}
+
+		ctx := context.Background()
+		client := release.NewClient()
+		current := version.Get().Version
+
+		latest, err := client.Latest(ctx, prerelease)
+		if err != nil {
+			return fmt.Errorf("failed to find latest release: %w", err)
+		}
+
+		if !updateForce && !release.Newer(current, latest.TagName) {
+			fmt.Printf("dotman %s is up to date (latest %s release is %s)\n", current, updateChannel, latest.TagName)
+			return nil
+		}
+
+		assetName := release.AssetName(runtime.GOOS, runtime.GOARCH)
+		asset, ok := latest.FindAsset(assetName)
+		if !ok {
+			return fmt.Errorf("release %s has no binary for %s/%s", latest.TagName, runtime.GOOS, runtime.GOARCH)
+		}
+		checksumsAsset, ok := latest.FindAsset(release.ChecksumsAsset)
+		if !ok {
+			return fmt.Errorf("release %s has no %s, refusing to install an unverified binary", latest.TagName, release.ChecksumsAsset)
+		}
+
+		checksums, err := client.Download(ctx, checksumsAsset)
+		if err != nil {
+			return fmt.Errorf("failed to download checksums: %w", err)
+		}
+		expected, ok := release.ParseChecksums(checksums)[assetName]
+		if !ok {
+			return fmt.Errorf("no checksum listed for %s", assetName)
+		}
+
+		fmt.Printf("Downloading %s %s...\n", assetName, latest.TagName)
+		binary, err := client.Download(ctx, asset)
+		if err != nil {
+			return fmt.Errorf("failed to download release: %w", err)
+		}
+		if err := release.VerifyChecksum(binary, expected); err != nil {
+			return fmt.Errorf("failed to verify download: %w", err)
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate executable: %w", err)
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return fmt.Errorf("failed to resolve executable: %w", err)
+		}
+
+		if err := release.ReplaceExecutable(exe, binary); err != nil {
+			return fmt.Errorf("failed to install update: %w", err)
+		}
+
+		fmt.Printf("Updated dotman %s to %s\n", current, latest.TagName)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+
+	selfUpdateCmd.Flags().StringVar(&updateChannel, "channel", "stable", "release channel (stable, prerelease)")
+	selfUpdateCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "install the latest release even if it is not newer, e.g. over a development build")
+}
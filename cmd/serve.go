@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+// Default number of journal entries and commits served
+const (
+	defaultServedEntries = 50
+	defaultServedCommits = 20
+)
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a read-only web interface to the repository",
+	Long: `Serve a small read-only web interface showing the tracked files and the state
+of their links, the journal timeline with step durations, and recent commits.
+
+The same data is served as JSON:
+
+  /api/entries   tracked files with their package and link state
+  /api/status    the document of 'dotman status --json'
+  /api/journal   journal entries, newest first, ?limit=N
+  /api/commits   recent commits, newest first, ?limit=N
+
+Nothing is ever changed through it. It listens on 127.0.0.1:7777 by default;
+the data includes paths in your home directory, so think twice before
+listening on other addresses.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		fmt.Printf("Serving %s on http://%s\n", cfg.DotmanDir, serveAddr)
+		server := &http.Server{
+			Addr:              serveAddr,
+			Handler:           newServeHandler(fsys, cfg),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		return server.ListenAndServe()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:7777", "address to listen on")
+}
+
+// servedEntry is a tracked file as the web interface shows it
+type servedEntry struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Package string `json:"package,omitempty"`
+	// State is the link state of the home path, "other host" for entries of
+	// packages disabled on this host
+	State string `json:"state"`
+}
+
+// servedJournalEntry is a journal entry with the durations of its steps
+type servedJournalEntry struct {
+	ID        string                `json:"id"`
+	Timestamp time.Time             `json:"timestamp"`
+	Operation journal.OperationType `json:"operation"`
+	State     journal.EntryState    `json:"state"`
+	Source    string                `json:"source,omitempty"`
+	Target    string                `json:"target,omitempty"`
+	Error     string                `json:"error,omitempty"`
+	Origin    string                `json:"origin,omitempty"`
+	// Duration is from the entry's creation to the end of its last step
+	Duration time.Duration `json:"duration_ns"`
+	Steps    []servedStep  `json:"steps"`
+}
+
+// servedStep is a journal step with how long it took
+type servedStep struct {
+	Type        journal.StepType   `json:"type"`
+	Description string             `json:"description"`
+	Status      journal.StepStatus `json:"status"`
+	Details     string             `json:"details,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Duration    time.Duration      `json:"duration_ns"`
+}
+
+// servedCommit is a commit of the dotman repository
+type servedCommit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	When    time.Time `json:"when"`
+	Message string    `json:"message"`
+}
+
+// newServeHandler returns the handler of the web interface and its JSON API.
+// Only GET requests are served.
+func newServeHandler(fsys dotmanfs.FileSystem, cfg *config.Config) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/entries", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := servedEntries(fsys, cfg)
+		writeJSON(w, entries, err)
+	})
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		report, err := loadStatus(fsys, cfg)
+		writeJSON(w, report, err)
+	})
+	mux.HandleFunc("GET /api/journal", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := servedJournal(fsys, cfg, queryLimit(r, defaultServedEntries))
+		writeJSON(w, entries, err)
+	})
+	mux.HandleFunc("GET /api/commits", func(w http.ResponseWriter, r *http.Request) {
+		commits, err := servedCommits(fsys, cfg, queryLimit(r, defaultServedCommits))
+		writeJSON(w, commits, err)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		var page servedPage
+		var err error
+		page.DotmanDir = cfg.DotmanDir
+		if page.Entries, err = servedEntries(fsys, cfg); err == nil {
+			if page.Journal, err = servedJournal(fsys, cfg, defaultServedEntries); err == nil {
+				page.Commits, err = servedCommits(fsys, cfg, defaultServedCommits)
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := servePage.Execute(w, page); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return mux
+}
+
+// writeJSON writes v as the JSON response, or err as a server error
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// queryLimit returns the limit query parameter, or def when it is missing or
+// not a positive number
+func queryLimit(r *http.Request, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// servedEntries returns the tracked files with the state of their links
+func servedEntries(fsys dotmanfs.FileSystem, cfg *config.Config) ([]servedEntry, error) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newEntryFilter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []servedEntry{}
+	l := newLinker(fsys, cfg, m)
+	for _, entry := range m.Entries {
+		state := "other host"
+		if m.AppliesToHost(entry, filter.hostname) {
+			state = entryState(fsys, l, cfg.DotmanDir, m, entry, homeDir)
+		}
+		entries = append(entries, servedEntry{Path: entry.Path, Type: string(entry.Type), Package: entry.Package, State: state})
+	}
+	return entries, nil
+}
+
+// servedJournal returns the limit newest top-level journal entries, with the
+// steps of grouped entries listed under their group
+func servedJournal(fsys dotmanfs.FileSystem, cfg *config.Config, limit int) ([]servedJournalEntry, error) {
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	records, err := jm.Index()
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal index: %w", err)
+	}
+
+	var ids []string
+	for i := len(records) - 1; i >= 0 && len(ids) < limit; i-- {
+		if records[i].ParentID == "" {
+			ids = append(ids, records[i].ID)
+		}
+	}
+	entries, err := jm.GetEntries(ids)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal entries: %w", err)
+	}
+
+	served := []servedJournalEntry{}
+	for _, entry := range entries {
+		steps := entry.Steps
+		if entry.IsGroup() {
+			children, err := jm.ChildEntries(entry)
+			if err != nil {
+				return nil, fmt.Errorf("error reading grouped entries of %s: %w", entry.ID, err)
+			}
+			for _, child := range children {
+				steps = append(steps, child.Steps...)
+			}
+		}
+
+		s := servedJournalEntry{
+			ID:        entry.ID,
+			Timestamp: entry.Timestamp,
+			Operation: entry.Operation,
+			State:     entry.State,
+			Source:    entry.Source,
+			Target:    entry.Target,
+			Error:     entry.Error,
+			Origin:    entry.Origin,
+			Steps:     []servedStep{},
+		}
+		for _, step := range steps {
+			s.Steps = append(s.Steps, servedStep{
+				Type:        step.Type,
+				Description: step.Description,
+				Status:      step.Status,
+				Details:     step.Details,
+				Error:       step.Error,
+				Duration:    stepDuration(step),
+			})
+			if !step.EndTime.IsZero() && step.EndTime.Sub(entry.Timestamp) > s.Duration {
+				s.Duration = step.EndTime.Sub(entry.Timestamp)
+			}
+		}
+		served = append(served, s)
+	}
+	return served, nil
+}
+
+// stepDuration returns how long a step ran, 0 when it did not finish
+func stepDuration(step journal.Step) time.Duration {
+	if step.StartTime.IsZero() || step.EndTime.IsZero() {
+		return 0
+	}
+	return step.EndTime.Sub(step.StartTime)
+}
+
+// servedCommits returns the limit newest commits of the checked out branch,
+// none in a repository without commits
+func servedCommits(fsys dotmanfs.FileSystem, cfg *config.Config, limit int) ([]servedCommit, error) {
+	repo, err := git.Open(newGitStorage(fsys, cfg.DotmanDir), dotmanfs.NewBillyFileSystem(fsys, cfg.DotmanDir, cfg.Perm()))
+	if err != nil {
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	commits := []servedCommit{}
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return commits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading HEAD: %w", err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if len(commits) == limit {
+			return storer.ErrStop
+		}
+		commits = append(commits, servedCommit{
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			When:    c.Author.When,
+			Message: strings.TrimSpace(strings.SplitN(c.Message, "\n", 2)[0]),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	return commits, nil
+}
+
+// servedPage is what the HTML page shows
+type servedPage struct {
+	DotmanDir string
+	Entries   []servedEntry
+	Journal   []servedJournalEntry
+	Commits   []servedCommit
+}
+
+// linkHealthy lists the link states that need no attention
+var linkHealthy = []string{"linked", "in place", "other host"}
+
+var servePage = template.Must(template.New("page").Funcs(template.FuncMap{
+	"healthy": func(state string) bool { return slices.Contains(linkHealthy, state) },
+	"short":   func(hash string) string { return hash[:7] },
+	"time":    func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"duration": func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return d.Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dotman</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+code, .mono { font-family: monospace; }
+.bad { color: #b00; font-weight: bold; }
+.steps { color: #555; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>dotman</h1>
+<p class="mono">{{.DotmanDir}}</p>
+
+<h2>Tracked files</h2>
+{{if .Entries}}<table>
+<tr><th>Path</th><th>Type</th><th>Package</th><th>Link</th></tr>
+{{range .Entries}}<tr><td class="mono">{{.Path}}</td><td>{{.Type}}</td><td>{{or .Package "-"}}</td><td{{if not (healthy .State)}} class="bad"{{end}}>{{.State}}</td></tr>
+{{end}}</table>{{else}}<p>No tracked dotfiles</p>{{end}}
+
+<h2>Journal</h2>
+{{if .Journal}}<table>
+<tr><th>Time</th><th>Operation</th><th>State</th><th>Duration</th><th>Steps</th></tr>
+{{range .Journal}}<tr>
+<td>{{time .Timestamp}}</td>
+<td>{{.Operation}}{{if .Origin}} <small>({{.Origin}})</small>{{end}}<br><small class="mono">{{.ID}}</small></td>
+<td{{if eq .State "failed"}} class="bad"{{end}}>{{.State}}{{if .Error}}<br><small>{{.Error}}</small>{{end}}</td>
+<td>{{duration .Duration}}</td>
+<td class="steps">{{range .Steps}}{{.Description}}: {{.Status}} ({{duration .Duration}}){{if .Error}} <span class="bad">{{.Error}}</span>{{end}}<br>{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>No journal entries</p>{{end}}
+
+<h2>Recent commits</h2>
+{{if .Commits}}<table>
+<tr><th>Commit</th><th>Date</th><th>Author</th><th>Message</th></tr>
+{{range .Commits}}<tr><td class="mono">{{short .Hash}}</td><td>{{time .When}}</td><td>{{.Author}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>{{else}}<p>No commits</p>{{end}}
+</body>
+</html>
+`))
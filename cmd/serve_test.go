@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestServeHandler(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	ctx := testutil.SetupContextWithJournal(t, jm, journal.OperationTypeLink, "data", "home")
+	step, err := journal.AddStepToCurrentEntry(ctx, journal.StepTypeSymlink, "Link tracked entries", "", "")
+	if err != nil {
+		t.Fatalf("failed to add step: %v", err)
+	}
+	if err := journal.StartStep(ctx, step); err != nil {
+		t.Fatalf("failed to start step: %v", err)
+	}
+	if err := journal.CompleteStep(ctx, step, "Created 0 symlinks"); err != nil {
+		t.Fatalf("failed to complete step: %v", err)
+	}
+	if err := journal.CompleteEntry(ctx); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+
+	handler := newServeHandler(fsys, cfg)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s returned %d: %s", path, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	var entries []servedEntry
+	if err := json.Unmarshal(get("/api/entries").Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to decode entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != ".zshrc" || entries[0].State != "missing" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	var timeline []servedJournalEntry
+	if err := json.Unmarshal(get("/api/journal").Body.Bytes(), &timeline); err != nil {
+		t.Fatalf("failed to decode journal: %v", err)
+	}
+	if len(timeline) != 1 || len(timeline[0].Steps) != 1 || timeline[0].Steps[0].Description != "Link tracked entries" {
+		t.Errorf("unexpected journal %+v", timeline)
+	}
+
+	var commits []servedCommit
+	if err := json.Unmarshal(get("/api/commits?limit=5").Body.Bytes(), &commits); err != nil {
+		t.Fatalf("failed to decode commits: %v", err)
+	}
+	if len(commits) != 1 || commits[0].Message != "test commit" {
+		t.Errorf("unexpected commits %+v", commits)
+	}
+
+	page := get("/").Body.String()
+	for _, want := range []string{".zshrc", "Link tracked entries", "test commit"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected the page to show %q", want)
+		}
+	}
+
+	// Nothing can be changed through it
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/entries", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// verifySignature checks that the commit with hash is signed with an SSH key
+// allowedSigners lists for its committer, the way git verifies commits with
+// gpg.format set to ssh, and returns what ssh-keygen says of the signature
+func verifySignature(repo *git.Repository, hash plumbing.Hash, allowedSigners string) (string, error) {
+	short := hash.String()[:8]
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit object: %w", err)
+	}
+	if commit.PGPSignature == "" {
+		return "", fmt.Errorf("commit %s is not signed", short)
+	}
+	if !strings.Contains(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----") {
+		return "", fmt.Errorf("commit %s is not signed with an SSH key", short)
+	}
+
+	// The signature covers the commit as encoded without it
+	payload := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		return "", fmt.Errorf("error encoding commit %s: %w", short, err)
+	}
+	reader, err := payload.Reader()
+	if err != nil {
+		return "", fmt.Errorf("error encoding commit %s: %w", short, err)
+	}
+	defer reader.Close()
+
+	dir, err := os.MkdirTemp("", "dotman-verify-")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	sig := filepath.Join(dir, "commit.sig")
+	if err := os.WriteFile(sig, []byte(commit.PGPSignature), 0600); err != nil {
+		return "", fmt.Errorf("error writing %s: %w", sig, err)
+	}
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedSigners, "-I", commit.Committer.Email, "-n", "git", "-s", sig)
+	cmd.Stdin = reader
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("the signature of commit %s by %s does not verify against %s: %s", short, commit.Committer.Email, allowedSigners, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
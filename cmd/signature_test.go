@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+// signedCommit commits the tree of HEAD again with message, signed with the
+// SSH key at key, and moves the branch to it
+func signedCommit(t *testing.T, repo *git.Repository, key, message string) plumbing.Hash {
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to resolve HEAD: %v", err)
+	}
+	parent, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to get HEAD commit: %v", err)
+	}
+	commit := &object.Commit{
+		Author:       parent.Author,
+		Committer:    parent.Committer,
+		Message:      message,
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+
+	payload := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		t.Fatalf("failed to encode commit: %v", err)
+	}
+	data := filepath.Join(t.TempDir(), "commit")
+	reader, _ := payload.Reader()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	os.WriteFile(data, content, 0600)
+	if out, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", "git", data).CombinedOutput(); err != nil {
+		t.Fatalf("failed to sign commit: %v: %s", err, out)
+	}
+	sig, err := os.ReadFile(data + ".sig")
+	if err != nil {
+		t.Fatalf("failed to read signature: %v", err)
+	}
+	commit.PGPSignature = string(sig)
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("failed to encode commit: %v", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("failed to store commit: %v", err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash)); err != nil {
+		t.Fatalf("failed to move branch: %v", err)
+	}
+	return hash
+}
+
+func TestVerifySignature(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+
+	// A key of the committer, dotman@localhost, and one of somebody else
+	dir := t.TempDir()
+	for _, name := range []string{"trusted", "other"} {
+		if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", filepath.Join(dir, name)).CombinedOutput(); err != nil {
+			t.Fatalf("failed to generate key: %v: %s", err, out)
+		}
+	}
+	pub, err := os.ReadFile(filepath.Join(dir, "trusted.pub"))
+	if err != nil {
+		t.Fatalf("failed to read public key: %v", err)
+	}
+	signers := filepath.Join(dir, "allowed_signers")
+	os.WriteFile(signers, []byte("dotman@localhost "+string(pub)), 0600)
+
+	head, _ := repo.Head()
+	if _, err := verifySignature(repo, head.Hash(), signers); err == nil || !strings.Contains(err.Error(), "is not signed") {
+		t.Errorf("expected an unsigned commit to be refused, got %v", err)
+	}
+
+	// link refuses the unsigned HEAD before linking anything
+	cfg.AllowedSigners = signers
+	op := &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err == nil || !strings.Contains(err.Error(), "is not signed") {
+		t.Errorf("expected link to refuse an unsigned HEAD, got %v", err)
+	}
+	if _, err := fsys.Lstat(filepath.Join(testutil.TestHomeDir, ".zshrc")); err == nil {
+		t.Error("expected nothing to be linked")
+	}
+
+	forged := signedCommit(t, repo, filepath.Join(dir, "other"), "forged")
+	if _, err := verifySignature(repo, forged, signers); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Errorf("expected a signature by another key to be refused, got %v", err)
+	}
+
+	signed := signedCommit(t, repo, filepath.Join(dir, "trusted"), "signed")
+	if details, err := verifySignature(repo, signed, signers); err != nil || !strings.Contains(details, "Good") {
+		t.Fatalf("expected the signature to verify, got %q (%v)", details, err)
+	}
+	op = &linkOperation{fsys: fsys, ctx: context.Background(), config: cfg}
+	if err := op.run(); err != nil {
+		t.Fatalf("failed to link a signed HEAD: %v", err)
+	}
+	if op.linked != 1 {
+		t.Errorf("expected .zshrc to be linked, got %d links", op.linked)
+	}
+}
@@ -0,0 +1,823 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+// snapshotTagPrefix namespaces snapshot tags so they don't clash with user tags
+const snapshotTagPrefix = "snapshot/"
+
+// snapshotCreateOperation represents the state of a snapshot create operation
+type snapshotCreateOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	name    string
+	message string
+	storage storage.Storer
+}
+
+// snapshotRestoreOperation represents the state of a snapshot restore operation
+type snapshotRestoreOperation struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+	ctx    context.Context
+
+	name    string
+	force   bool
+	storage storage.Storer
+
+	// symlinks removed because the snapshot does not track them, or not
+	// where they lead
+	unlinked int
+	backup   string
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage named snapshots of the dotman repository",
+	Long: `Manage named snapshots of the dotman repository. A snapshot is a git tag
+pointing at the current commit together with a journal entry that captures
+the manifest state, so the whole working set can be restored later.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a snapshot of the current commit",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, _ := cmd.Flags().GetString("message")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		op := &snapshotCreateOperation{
+			name:    args[0],
+			message: message,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			config:  cfg,
+			storage: newGitStorage(fsys, cfg.DotmanDir),
+		}
+
+		return op.run()
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		billyFs := dotmanfs.NewBillyFileSystem(fsys, cfg.DotmanDir, cfg.Perm())
+		repo, err := git.Open(newGitStorage(fsys, cfg.DotmanDir), billyFs)
+		if err != nil {
+			return fmt.Errorf("failed to open git repository: %w", err)
+		}
+
+		snapshots, err := listSnapshots(repo)
+		if err != nil {
+			return err
+		}
+
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots found")
+			return nil
+		}
+
+		for _, s := range snapshots {
+			fmt.Printf("%s\t%s\t%s", s.Name, s.Hash.String()[:8], s.When.Format(time.RFC3339))
+			if s.Message != "" {
+				fmt.Printf("\t%s", s.Message)
+			}
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore the tracked files to a snapshot",
+	Long: `Restore the repository files to the state recorded by a snapshot and
+relink the home directory to match: symlinks of entries the snapshot does not
+track are removed, each backed up first like link does, and tracked entries
+that are missing are linked. The restored files are left uncommitted so they
+can be reviewed with 'dotman status'. On a terminal, dotman asks first unless
+--yes is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if !confirmDestructive(fmt.Sprintf("Restore the tracked files to snapshot %s? Changes made since are overwritten.", args[0])) {
+			return fmt.Errorf("restore aborted")
+		}
+
+		op := &snapshotRestoreOperation{
+			name:    args[0],
+			force:   force,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			config:  cfg,
+			storage: newGitStorage(fsys, cfg.DotmanDir),
+		}
+
+		return op.run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	snapshotCreateCmd.Flags().StringP("message", "m", "", "snapshot description")
+	snapshotRestoreCmd.Flags().BoolP("force", "f", false, "restore even if the repository has uncommitted changes")
+}
+
+// snapshotInfo describes a single snapshot tag
+type snapshotInfo struct {
+	Name    string
+	Hash    plumbing.Hash
+	When    time.Time
+	Message string
+}
+
+// listSnapshots returns all snapshot tags sorted by creation time
+func listSnapshots(repo *git.Repository) ([]snapshotInfo, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	snapshots := make([]snapshotInfo, 0)
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		if !strings.HasPrefix(name, snapshotTagPrefix) {
+			return nil
+		}
+
+		info := snapshotInfo{
+			Name: strings.TrimPrefix(name, snapshotTagPrefix),
+			Hash: ref.Hash(),
+		}
+
+		// Snapshots are annotated tags, but tolerate lightweight ones created by hand
+		if tag, err := repo.TagObject(ref.Hash()); err == nil {
+			info.Hash = tag.Target
+			info.When = tag.Tagger.When
+			info.Message = strings.TrimSpace(tag.Message)
+		} else if commit, err := repo.CommitObject(ref.Hash()); err == nil {
+			info.When = commit.Committer.When
+		}
+
+		snapshots = append(snapshots, info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].When.Before(snapshots[j].When)
+	})
+
+	return snapshots, nil
+}
+
+// resolveSnapshotCommit returns the commit a snapshot tag points at
+func resolveSnapshotCommit(repo *git.Repository, name string) (*object.Commit, error) {
+	ref, err := repo.Tag(snapshotTagPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot '%s' not found: %w", name, err)
+	}
+
+	if tag, err := repo.TagObject(ref.Hash()); err == nil {
+		return tag.Commit()
+	}
+
+	return repo.CommitObject(ref.Hash())
+}
+
+func (op *snapshotCreateOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	hash, err := op.createTag()
+	if err != nil {
+		return err
+	}
+
+	if err := op.captureManifest(hash); err != nil {
+		return err
+	}
+
+	return op.complete()
+}
+
+func (op *snapshotCreateOperation) initialize() error {
+	if err := plumbing.NewTagReferenceName(snapshotTagPrefix + op.name).Validate(); err != nil {
+		return fmt.Errorf("invalid snapshot name '%s': %w", op.name, err)
+	}
+
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(journal.OperationTypeSnapshot, "", op.name)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+func (op *snapshotCreateOperation) openRepo() (*git.Repository, error) {
+	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir, op.config.Perm())
+	return git.Open(op.storage, billyFs)
+}
+
+func (op *snapshotCreateOperation) createTag() (plumbing.Hash, error) {
+	tagName := snapshotTagPrefix + op.name
+
+	// Add tag step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Create snapshot tag", "HEAD", tagName)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to add tag step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to start step: %w", err)
+	}
+
+	repo, err := op.openRepo()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to open git repository: %w", err)); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return plumbing.ZeroHash, fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to resolve HEAD: %w", err)); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	// Get the tagger
+	signature, err := gitIdentity(op.fsys, op.config, repo, "")
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return plumbing.ZeroHash, err
+	}
+
+	message := op.message
+	if message == "" {
+		message = fmt.Sprintf("dotman snapshot %s", op.name)
+	}
+
+	if _, err := repo.CreateTag(tagName, head.Hash(), &git.CreateTagOptions{
+		Tagger:  signature,
+		Message: message,
+	}); err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to create tag: %w", err)); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return plumbing.ZeroHash, fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	// Complete the step
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Tagged commit %s as %s", head.Hash().String(), tagName)); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return head.Hash(), nil
+}
+
+// captureManifest records the manifest as of the snapshot commit in the journal entry
+func (op *snapshotCreateOperation) captureManifest(hash plumbing.Hash) error {
+	// Add manifest step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeManifest, "Capture manifest state", hash.String(), "")
+	if err != nil {
+		return fmt.Errorf("failed to add manifest step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	repo, err := op.openRepo()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to open git repository: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	m, err := manifestAtCommit(repo, hash)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to encode manifest: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	// The checksum lets a restore confirm it produced the recorded manifest
+	entry, _ := journal.GetJournalEntry(op.ctx)
+	sum := sha256.Sum256(data)
+	entry.Checksum = hex.EncodeToString(sum[:])
+
+	if err := journal.CompleteStep(op.ctx, step, string(data)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	fmt.Printf("Created snapshot %s at %s (%d tracked entries)\n", op.name, hash.String()[:8], len(m.Entries))
+	return nil
+}
+
+func (op *snapshotCreateOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
+
+// manifestAtCommit reads the manifest stored in the given commit
+func manifestAtCommit(repo *git.Repository, hash plumbing.Hash) (*manifest.Manifest, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+
+	file, err := commit.File(manifest.FileName)
+	if err != nil {
+		if err == object.ErrFileNotFound {
+			return &manifest.Manifest{}, nil
+		}
+		return nil, fmt.Errorf("failed to read manifest from commit: %w", err)
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest from commit: %w", err)
+	}
+
+	return manifest.Parse([]byte(contents))
+}
+
+func (op *snapshotRestoreOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.verifyWorktree(); err != nil {
+		return err
+	}
+
+	if err := op.unlinkRemoved(); err != nil {
+		return err
+	}
+
+	if err := op.restoreFiles(); err != nil {
+		return err
+	}
+
+	if err := op.relink(); err != nil {
+		return err
+	}
+
+	if err := op.complete(); err != nil {
+		return err
+	}
+	recordState(op.fsys, op.config)
+	return nil
+}
+
+func (op *snapshotRestoreOperation) initialize() error {
+	// Create journal manager
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	// Add journal manager to context
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	// Create journal entry
+	entry, err := jm.CreateEntry(journal.OperationTypeRestore, op.name, "")
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	// Add entry to context
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+func (op *snapshotRestoreOperation) openRepo() (*git.Repository, error) {
+	billyFs := dotmanfs.NewBillyFileSystem(op.fsys, op.config.DotmanDir, op.config.Perm())
+	return git.Open(op.storage, billyFs)
+}
+
+func (op *snapshotRestoreOperation) verifyWorktree() error {
+	// Add verification step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify repository has no uncommitted changes", op.config.DotmanDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if op.force {
+		if err := journal.CompleteStep(op.ctx, step, "Skipped because --force was given"); err != nil {
+			return fmt.Errorf("failed to complete step: %w", err)
+		}
+		return nil
+	}
+
+	repo, err := op.openRepo()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to open git repository: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to get worktree: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to get status: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+
+	if !status.IsClean() {
+		err := fmt.Errorf("repository has uncommitted changes; commit them or use --force")
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Repository is clean"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+func (op *snapshotRestoreOperation) restoreFiles() error {
+	// Add restore step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Restore files from snapshot", snapshotTagPrefix+op.name, op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to add restore step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	// The repository was checked to be clean, so checking out the commit
+	// HEAD points at undoes the restore
+	repo, err := op.openRepo()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, fmt.Errorf("failed to open git repository: %w", err)); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return fmt.Errorf("failed to open git repository: %w", err)
+	}
+	if err := journal.RecordRollback(op.ctx, step, headRollback(repo)); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	restored, removed, err := op.checkoutSnapshot()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Restored %d files, removed %d files", restored, removed)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	return nil
+}
+
+// checkoutSnapshot writes the snapshot tree into the worktree and removes files
+// that were added after the snapshot was taken
+func (op *snapshotRestoreOperation) checkoutSnapshot() (int, int, error) {
+	repo, err := op.openRepo()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	commit, err := resolveSnapshotCommit(repo, op.name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get snapshot tree: %w", err)
+	}
+
+	snapshotFiles := make(map[string]bool)
+	restored := 0
+	err = tree.Files().ForEach(func(f *object.File) error {
+		snapshotFiles[f.Name] = true
+
+		reader, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		if err := writeRepoFile(op.fsys, filepath.Join(op.config.DotmanDir, f.Name), data, f.Mode, op.config.Perm()); err != nil {
+			return err
+		}
+
+		restored++
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to restore snapshot files: %w", err)
+	}
+
+	// Remove files that HEAD tracks but the snapshot does not
+	removed := 0
+	head, err := repo.Head()
+	if err != nil {
+		return restored, 0, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return restored, 0, fmt.Errorf("failed to get HEAD commit: %w", err)
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return restored, 0, fmt.Errorf("failed to get HEAD tree: %w", err)
+	}
+
+	err = headTree.Files().ForEach(func(f *object.File) error {
+		if snapshotFiles[f.Name] {
+			return nil
+		}
+
+		if err := op.fsys.Remove(filepath.Join(op.config.DotmanDir, f.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		removed++
+		return nil
+	})
+	if err != nil {
+		return restored, removed, fmt.Errorf("failed to remove files missing from snapshot: %w", err)
+	}
+
+	return restored, removed, nil
+}
+
+// writeRepoFile writes data to path in the worktree as a file of mode, which
+// is a symlink to data for filemode.Symlink. Directories are created within
+// limit.
+func writeRepoFile(fsys dotmanfs.FileSystem, path string, data []byte, mode filemode.FileMode, limit dotmanfs.Perm) error {
+	perm, err := mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(path), limit.DirMode()); err != nil {
+		return err
+	}
+
+	// Replace symlinks instead of writing through them, they may point
+	// at shared blobs in the store
+	if info, err := fsys.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := fsys.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	// Symlinks are stored as a blob holding their target
+	if mode == filemode.Symlink {
+		if err := fsys.RemoveAll(path); err != nil {
+			return err
+		}
+		return fsys.Symlink(string(data), path)
+	}
+	return fsys.WriteFile(path, data, perm)
+}
+
+// unlinkRemoved removes the symlinks of entries the snapshot does not track,
+// and of entries it keeps elsewhere in the repository, which relink links
+// again. It runs before the restore so the backups hold what the symlinks
+// lead to.
+func (op *snapshotRestoreOperation) unlinkRemoved() error {
+	links, layout, err := op.removedLinks()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	op.backup, op.unlinked, err = unlinkEntries(op.ctx, op.fsys, op.config, layout, links)
+	return err
+}
+
+// removedLinks returns the links of the current manifest that do not match
+// the manifest of the snapshot, and the layout of the snapshot
+func (op *snapshotRestoreOperation) removedLinks() ([]manifest.Entry, manifest.Layout, error) {
+	current, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return nil, manifest.Layout{}, err
+	}
+	repo, err := op.openRepo()
+	if err != nil {
+		return nil, manifest.Layout{}, fmt.Errorf("failed to open git repository: %w", err)
+	}
+	commit, err := resolveSnapshotCommit(repo, op.name)
+	if err != nil {
+		return nil, manifest.Layout{}, err
+	}
+	snapshot, err := manifestAtCommit(repo, commit.Hash)
+	if err != nil {
+		return nil, manifest.Layout{}, err
+	}
+
+	var paths []string
+	for _, entry := range current.Entries {
+		for _, link := range entry.Links() {
+			paths = append(paths, link.Path)
+		}
+	}
+	links, err := removedLinks(op.fsys, op.config, paths, snapshot)
+	if err != nil {
+		return nil, manifest.Layout{}, err
+	}
+	stale, err := staleLinks(op.fsys, op.config.DotmanDir, snapshot)
+	if err != nil {
+		return nil, manifest.Layout{}, err
+	}
+	return append(links, stale...), snapshot.Layout, nil
+}
+
+// staleLinks returns the links of m whose symlinks lead into dotmanDir but
+// not to the copy m keeps, e.g. after the layout changed
+func staleLinks(fsys dotmanfs.FileSystem, dotmanDir string, m *manifest.Manifest) ([]manifest.Entry, error) {
+	if m.InPlace() {
+		return nil, nil
+	}
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	var stale []manifest.Entry
+	for _, entry := range m.Entries {
+		for _, link := range entry.Links() {
+			target, err := fsys.Readlink(link.TargetPath(homeDir))
+			if err != nil || !isWithin(dotmanDir, target) {
+				continue
+			}
+			if filepath.Clean(target) != m.Layout.RepoPath(dotmanDir, link) {
+				stale = append(stale, link)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// relink creates symlinks for restored manifest entries missing from the home directory
+func (op *snapshotRestoreOperation) relink() error {
+	m, err := manifest.Load(op.fsys, op.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	// Add symlink step
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeSymlink, "Relink tracked entries", m.Layout.HomeDir(op.config.DotmanDir), "")
+	if err != nil {
+		return fmt.Errorf("failed to add relink step: %w", err)
+	}
+
+	// Start the step
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	filter, err := newEntryFilter(nil)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := recordLinkRollback(op.ctx, step, op.fsys, op.config.DotmanDir, filter); err != nil {
+		return fmt.Errorf("failed to record rollback: %w", err)
+	}
+
+	linked, err := linkMissingEntries(op.fsys, op.config, filter)
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Created %d missing symlinks", linked)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+
+	if op.unlinked > 0 {
+		fmt.Printf("Removed %d symlinks not matching the snapshot, backed up to %s\n", op.unlinked, op.backup)
+	}
+	fmt.Printf("Restored snapshot %s; review the changes with 'dotman status' and commit them\n", op.name)
+	return nil
+}
+
+func (op *snapshotRestoreOperation) complete() error {
+	return journal.CompleteEntry(op.ctx)
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestSnapshotCreateAndRestore(t *testing.T) {
+	// Create mock filesystem with dotman structure
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	// Setup test config
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	// Setup git repository with a tracked file
+	repo, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".gitignore", "journal/\n")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+
+	create := &snapshotCreateOperation{
+		name:    "pre-upgrade",
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+	if err := create.run(); err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+
+	snapshots, err := listSnapshots(repo)
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "pre-upgrade" {
+		t.Fatalf("expected snapshot 'pre-upgrade', got %+v", snapshots)
+	}
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	entries, err := jm.ListEntries(journal.EntryStateCompleted)
+	if err != nil {
+		t.Fatalf("failed to get journal entries: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entries[0], journal.OperationTypeSnapshot, journal.EntryStateCompleted, 2)
+	if entries[0].Checksum == "" {
+		t.Fatal("expected snapshot entry to record a manifest checksum")
+	}
+
+	// Diverge from the snapshot
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshrc", "changed")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.vimrc", "new file")
+	if _, err := worktree.Commit("diverge", &git.CommitOptions{
+		Author: &object.Signature{Name: "dotman", Email: "dotman@localhost"},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	restore := &snapshotRestoreOperation{
+		name:    "pre-upgrade",
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+	if err := restore.run(); err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+
+	data, err := fsys.ReadFile(filepath.Join(dotmanDir, "data/.zshrc"))
+	if err != nil {
+		t.Fatalf("failed to read restored file: %v", err)
+	}
+	if string(data) != "original" {
+		t.Fatalf("expected restored content 'original', got '%s'", data)
+	}
+
+	if _, err := fsys.Stat(filepath.Join(dotmanDir, "data/.vimrc")); err == nil {
+		t.Fatal("expected file added after the snapshot to be removed")
+	}
+
+	// The missing home symlink should have been created
+	homeData, err := fsys.ReadFile(filepath.Join(testutil.TestHomeDir, ".zshrc"))
+	if err != nil {
+		t.Fatalf("expected .zshrc to be relinked: %v", err)
+	}
+	if string(homeData) != "original" {
+		t.Fatalf("expected relinked content 'original', got '%s'", homeData)
+	}
+}
+
+func TestSnapshotRestore_RefusesDirtyWorktree(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshrc", "uncommitted")
+
+	restore := &snapshotRestoreOperation{
+		name:    "missing",
+		fsys:    fsys,
+		ctx:     context.Background(),
+		config:  cfg,
+		storage: storage,
+	}
+	if err := restore.run(); err == nil {
+		t.Fatal("expected restore to fail on a dirty worktree")
+	}
+
+	entry, err := journal.GetJournalEntry(restore.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntry(t, entry, journal.OperationTypeRestore, journal.EntryStateFailed)
+}
+
+func TestSnapshotRestore_UnlinksDroppedEntries(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, storage := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".gitignore", "journal/\n")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+
+	create := &snapshotCreateOperation{name: "before-vim", fsys: fsys, ctx: context.Background(), config: cfg, storage: storage}
+	if err := create.run(); err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+
+	// Track and link .vimrc after the snapshot
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.vimrc", "set number")
+	vimrc := filepath.Join(testutil.TestHomeDir, ".vimrc")
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.vimrc"), vimrc); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	restore := &snapshotRestoreOperation{name: "before-vim", fsys: fsys, ctx: context.Background(), config: cfg, storage: storage}
+	if err := restore.run(); err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+
+	// The snapshot does not track .vimrc, so its link goes, backed up first
+	if _, err := fsys.Lstat(vimrc); err == nil {
+		t.Fatal("expected the link of .vimrc to be removed")
+	}
+	if restore.unlinked != 1 {
+		t.Errorf("expected 1 link removed, got %d", restore.unlinked)
+	}
+	backup, err := fsys.ReadFile(filepath.Join(restore.backup, ".vimrc"))
+	if err != nil || string(backup) != "set number" {
+		t.Errorf("expected .vimrc to be backed up, got %q (%v)", backup, err)
+	}
+	if _, err := fsys.ReadFile(filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil {
+		t.Errorf("expected .zshrc to be linked: %v", err)
+	}
+}
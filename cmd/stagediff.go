@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// stagedFile is one side of a staged change
+type stagedFile struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *stagedFile) Hash() plumbing.Hash     { return f.hash }
+func (f *stagedFile) Mode() filemode.FileMode { return f.mode }
+func (f *stagedFile) Path() string            { return f.path }
+
+// stagedChunk is a run of lines a staged change keeps, adds or deletes
+type stagedChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c stagedChunk) Content() string       { return c.content }
+func (c stagedChunk) Type() fdiff.Operation { return c.op }
+
+// stagedChange is the change to a file between HEAD and the index
+type stagedChange struct {
+	// from is nil for an added file, to for a deleted one
+	from, to *stagedFile
+	binary   bool
+	chunks   []fdiff.Chunk
+}
+
+// path returns the path of the changed file
+func (c *stagedChange) path() string {
+	if c.to != nil {
+		return c.to.path
+	}
+	return c.from.path
+}
+
+func (c *stagedChange) IsBinary() bool        { return c.binary }
+func (c *stagedChange) Chunks() []fdiff.Chunk { return c.chunks }
+
+func (c *stagedChange) Files() (fdiff.File, fdiff.File) {
+	// A nil side must be a nil interface, not a nil *stagedFile
+	var from, to fdiff.File
+	if c.from != nil {
+		from = c.from
+	}
+	if c.to != nil {
+		to = c.to
+	}
+	return from, to
+}
+
+// stagedPatch is the patch of the changes a commit would record
+type stagedPatch []*stagedChange
+
+func (p stagedPatch) Message() string { return "" }
+
+func (p stagedPatch) FilePatches() []fdiff.FilePatch {
+	patches := make([]fdiff.FilePatch, len(p))
+	for i, change := range p {
+		patches[i] = change
+	}
+	return patches
+}
+
+// writeDiff writes the changes as a unified diff, colored like git's when
+// output is
+func writeDiff(w io.Writer, changes ...*stagedChange) error {
+	encoder := fdiff.NewUnifiedEncoder(w, fdiff.DefaultContextLines)
+	if colorOutput() {
+		encoder.SetColor(fdiff.NewColorConfig())
+	}
+	return encoder.Encode(stagedPatch(changes))
+}
+
+// headFiles returns the files of HEAD, none in a repository without commits
+func headFiles(repo *git.Repository) (map[string]*stagedFile, error) {
+	files := make(map[string]*stagedFile)
+
+	head, err := repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = &stagedFile{path: f.Name, hash: f.Hash, mode: f.Mode}
+		return nil
+	})
+	return files, err
+}
+
+// stagedChanges returns the changes between HEAD and the index, by path
+func stagedChanges(repo *git.Repository) ([]*stagedChange, error) {
+	head, err := headFiles(repo)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*stagedChange
+	staged := make(map[string]bool)
+	for _, e := range idx.Entries {
+		staged[e.Name] = true
+		from := head[e.Name]
+		if from != nil && from.hash == e.Hash && from.mode == e.Mode {
+			continue
+		}
+		changes = append(changes, &stagedChange{from: from, to: &stagedFile{path: e.Name, hash: e.Hash, mode: e.Mode}})
+	}
+	for path, from := range head {
+		if !staged[path] {
+			changes = append(changes, &stagedChange{from: from})
+		}
+	}
+	slices.SortFunc(changes, func(a, b *stagedChange) int {
+		if a.path() < b.path() {
+			return -1
+		}
+		if a.path() > b.path() {
+			return 1
+		}
+		return 0
+	})
+
+	for _, change := range changes {
+		if err := change.load(repo); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// load computes the chunks of the change from the blobs of both sides
+func (c *stagedChange) load(repo *git.Repository) error {
+	var contents [2][]byte
+	for i, side := range []*stagedFile{c.from, c.to} {
+		if side == nil {
+			continue
+		}
+		blob, err := repo.BlobObject(side.hash)
+		if err != nil {
+			return err
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			return err
+		}
+		contents[i], err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if isBinary, _ := binary.IsBinary(bytes.NewReader(contents[i])); isBinary {
+			c.binary = true
+		}
+	}
+	if c.binary {
+		return nil
+	}
+
+	for _, d := range diff.Do(string(contents[0]), string(contents[1])) {
+		op := fdiff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		c.chunks = append(c.chunks, stagedChunk{content: d.Text, op: op})
+	}
+	return nil
+}
+
+// unstage puts the file of the change back in the index as HEAD has it
+func unstage(repo *git.Repository, change *stagedChange) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if change.from == nil {
+		if _, err := idx.Remove(change.path()); err != nil {
+			return err
+		}
+		return repo.Storer.SetIndex(idx)
+	}
+
+	e, err := idx.Entry(change.path())
+	if errors.Is(err, index.ErrEntryNotFound) {
+		e = idx.Add(change.path())
+	} else if err != nil {
+		return err
+	}
+	e.Hash = change.from.hash
+	e.Mode = change.from.mode
+	// The cached stat no longer describes the staged content
+	e.Size = 0
+
+	slices.SortFunc(idx.Entries, func(a, b *index.Entry) int {
+		if a.Name < b.Name {
+			return -1
+		}
+		if a.Name > b.Name {
+			return 1
+		}
+		return 0
+	})
+	return repo.Storer.SetIndex(idx)
+}
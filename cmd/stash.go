@@ -0,0 +1,791 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/spf13/cobra"
+)
+
+// stashRefPrefix namespaces the refs of stashes, out of the way of branches
+// and tags. Each ref is named by the time of its stash in nanoseconds, so
+// stashes made within a second still sort.
+const stashRefPrefix = "refs/dotman/stash/"
+
+// stashPushOperation represents the state of a stash push operation
+type stashPushOperation struct {
+	config  *config.Config
+	fsys    dotmanfs.FileSystem
+	ctx     context.Context
+	repo    *git.Repository
+	backend backend
+
+	message string
+	// files are the changed files of tracked entries, as git reports them
+	files []string
+	// head holds the files of the commit HEAD points at
+	head map[string]object.TreeEntry
+}
+
+// stashPopOperation represents the state of a stash pop operation
+type stashPopOperation struct {
+	config  *config.Config
+	fsys    dotmanfs.FileSystem
+	ctx     context.Context
+	repo    *git.Repository
+	backend backend
+
+	stash stashInfo
+	// base holds the files of the commit the stash was made on top of
+	base map[string]object.TreeEntry
+	// changes holds the stashed files by their path in the repository, with
+	// a zero hash for files the stash removed
+	changes map[string]object.TreeEntry
+	// added are the stashed files HEAD did not have when they were stashed
+	added map[string]bool
+}
+
+var stashCmd = &cobra.Command{
+	Use:   "stash",
+	Short: "Set uncommitted changes to tracked files aside",
+	Long: `Set the uncommitted changes to tracked files aside and bring them back
+later, to try a risky change and revert it at once.
+
+'dotman stash push' saves the changes as a commit under refs/dotman/stash/,
+which no branch or push reaches, and puts the tracked files back to the last
+commit. 'dotman stash pop' brings the newest stash back, or the one given
+by its number in 'dotman stash list', and drops it. The manifest and files
+outside tracked entries are left alone.`,
+	Example: `  dotman stash push -m "before trying the new prompt"
+  dotman stash list
+  dotman stash pop`,
+}
+
+var stashPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Stash the uncommitted changes to tracked files",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, _ := cmd.Flags().GetString("message")
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(fsys, cfg.DotmanDir, b)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		op := &stashPushOperation{
+			config:  cfg,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			repo:    repo,
+			backend: b,
+			message: message,
+		}
+		return op.run()
+	},
+}
+
+var stashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stashes, newest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(fsys, cfg.DotmanDir, b)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		stashes, err := listStashes(repo)
+		if err != nil {
+			return err
+		}
+		if len(stashes) == 0 {
+			fmt.Println("No stashes found")
+			return nil
+		}
+		for _, s := range stashes {
+			fmt.Printf("%d\t%s\t%s\t%s\n", s.Index, s.Hash.String()[:8], s.When.Format(time.RFC3339), s.Message)
+		}
+		return nil
+	},
+}
+
+var stashPopCmd = &cobra.Command{
+	Use:   "pop [number]",
+	Short: "Bring a stash back and drop it",
+	Long: `Write the files of a stash back and drop it, the newest stash without a
+number. Files changed since they were stashed, by an uncommitted edit or a
+commit, are not overwritten: pop refuses and leaves the stash in place.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		index := 0
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid stash number '%s'", args[0])
+			}
+			index = n
+		}
+
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		b, err := loadBackend(fsys, cfg.DotmanDir, cfg.Perm())
+		if err != nil {
+			return err
+		}
+		repo, err := openRepo(fsys, cfg.DotmanDir, b)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		stashes, err := listStashes(repo)
+		if err != nil {
+			return err
+		}
+		if index >= len(stashes) {
+			return fmt.Errorf("no stash %d, see 'dotman stash list'", index)
+		}
+
+		op := &stashPopOperation{
+			config:  cfg,
+			fsys:    fsys,
+			ctx:     context.Background(),
+			repo:    repo,
+			backend: b,
+			stash:   stashes[index],
+		}
+		return op.run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stashCmd)
+	stashCmd.AddCommand(stashPushCmd)
+	stashCmd.AddCommand(stashListCmd)
+	stashCmd.AddCommand(stashPopCmd)
+
+	stashPushCmd.Flags().StringP("message", "m", "", "stash description")
+}
+
+// stashInfo describes a single stash
+type stashInfo struct {
+	// Index is the number of the stash, 0 for the newest
+	Index   int
+	Ref     plumbing.ReferenceName
+	Hash    plumbing.Hash
+	When    time.Time
+	Message string
+}
+
+// listStashes returns the stashes of repo, newest first
+func listStashes(repo *git.Repository) ([]stashInfo, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	stashes := make([]stashInfo, 0)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !strings.HasPrefix(ref.Name().String(), stashRefPrefix) {
+			return nil
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to read stash %s: %w", ref.Name(), err)
+		}
+		stashes = append(stashes, stashInfo{
+			Ref:     ref.Name(),
+			Hash:    ref.Hash(),
+			When:    commit.Committer.When,
+			Message: strings.TrimSpace(commit.Message),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(stashes, func(i, j int) bool {
+		return stashes[i].Ref > stashes[j].Ref
+	})
+	for i := range stashes {
+		stashes[i].Index = i
+	}
+	return stashes, nil
+}
+
+// commitFiles returns the files of the commit with hash by their path in the
+// repository
+func commitFiles(repo *git.Repository, hash plumbing.Hash) (map[string]object.TreeEntry, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+
+	files := make(map[string]object.TreeEntry)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = object.TreeEntry{Name: f.Name, Mode: f.Mode, Hash: f.Hash}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit tree: %w", err)
+	}
+	return files, nil
+}
+
+// writeTree stores the tree holding files, by their slash separated path in
+// the repository, along with its subtrees and returns its hash
+func writeTree(s storer.EncodedObjectStorer, files map[string]object.TreeEntry) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := make(map[string]map[string]object.TreeEntry)
+	for name, entry := range files {
+		dir, rest, nested := strings.Cut(name, "/")
+		if !nested {
+			entry.Name = name
+			tree.Entries = append(tree.Entries, entry)
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]object.TreeEntry)
+		}
+		dirs[dir][rest] = entry
+	}
+	for dir, files := range dirs {
+		hash, err := writeTree(s, files)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// Git orders directories as if their names ended with a slash
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return key(tree.Entries[i]) < key(tree.Entries[j])
+	})
+
+	obj := s.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
+
+// storeFile stores the file at path in the worktree as a blob and returns its
+// tree entry. A symlink is stored as a blob holding its target.
+func storeFile(fsys dotmanfs.FileSystem, s storer.EncodedObjectStorer, path string) (object.TreeEntry, error) {
+	info, err := fsys.Lstat(path)
+	if err != nil {
+		return object.TreeEntry{}, err
+	}
+
+	var data []byte
+	mode := filemode.Regular
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := fsys.Readlink(path)
+		if err != nil {
+			return object.TreeEntry{}, err
+		}
+		data, mode = []byte(target), filemode.Symlink
+	default:
+		if data, err = fsys.ReadFile(path); err != nil {
+			return object.TreeEntry{}, err
+		}
+		if info.Mode()&0111 != 0 {
+			mode = filemode.Executable
+		}
+	}
+
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return object.TreeEntry{}, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return object.TreeEntry{}, err
+	}
+	if err := w.Close(); err != nil {
+		return object.TreeEntry{}, err
+	}
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		return object.TreeEntry{}, err
+	}
+	return object.TreeEntry{Mode: mode, Hash: hash}, nil
+}
+
+// checkoutFile writes the file of entry to path in the worktree, removing it
+// for a zero hash. Directories are created within perm.
+func checkoutFile(fsys dotmanfs.FileSystem, repo *git.Repository, path string, entry object.TreeEntry, perm dotmanfs.Perm) error {
+	if entry.Hash.IsZero() {
+		if err := fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		return err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return writeRepoFile(fsys, path, data, entry.Mode, perm)
+}
+
+// changedFiles returns the files of tracked entries with uncommitted changes,
+// staged or not, sorted
+func changedFiles(repo *git.Repository, b backend) ([]string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var files []string
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked {
+			continue
+		}
+		if fileStatus.Worktree == git.Unmodified && fileStatus.Staging == git.Unmodified {
+			continue
+		}
+		if _, ok := b.entryPath(file); ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (op *stashPushOperation) run() error {
+	conflicts, err := listConflicts(op.repo)
+	if err != nil {
+		return fmt.Errorf("error reading conflicts: %w", err)
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%s is conflicted, resolve it with 'dotman resolve' first", conflicts[0].file)
+	}
+
+	if op.files, err = changedFiles(op.repo, op.backend); err != nil {
+		return err
+	}
+	if len(op.files) == 0 {
+		fmt.Println("No uncommitted changes to tracked files to stash")
+		return nil
+	}
+
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	hash, err := op.save()
+	if err != nil {
+		return err
+	}
+
+	if err := op.restoreHead(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stashed changes to %d files as %s, bring them back with 'dotman stash pop'\n", len(op.files), hash.String()[:8])
+	return journal.CompleteEntry(op.ctx)
+}
+
+func (op *stashPushOperation) initialize() error {
+	head, err := op.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if op.head, err = commitFiles(op.repo, head.Hash()); err != nil {
+		return err
+	}
+	if op.message == "" {
+		op.message = fmt.Sprintf("WIP on %s", head.Hash().String()[:8])
+	}
+
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	entry, err := jm.CreateEntry(journal.OperationTypeStash, "", op.message)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// save commits the changed files on top of HEAD, outside any branch, and
+// points a stash ref at the commit
+func (op *stashPushOperation) save() (plumbing.Hash, error) {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Save changes to a stash", "HEAD", stashRefPrefix)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to add stash step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to start step: %w", err)
+	}
+
+	hash, err := op.commit()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return plumbing.ZeroHash, err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Stashed %d files as %s", len(op.files), hash.String())); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to complete step: %w", err)
+	}
+	return hash, nil
+}
+
+// commit writes the stash commit and its ref
+func (op *stashPushOperation) commit() (plumbing.Hash, error) {
+	files := make(map[string]object.TreeEntry, len(op.head))
+	for name, entry := range op.head {
+		files[name] = entry
+	}
+	for _, file := range op.files {
+		entry, err := storeFile(op.fsys, op.repo.Storer, op.backend.filePath(file))
+		if os.IsNotExist(err) {
+			delete(files, file)
+			continue
+		}
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("error storing %s: %w", file, err)
+		}
+		files[file] = entry
+	}
+
+	tree, err := writeTree(op.repo.Storer, files)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("error writing stash tree: %w", err)
+	}
+	head, err := op.repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	signature, err := gitIdentity(op.fsys, op.config, op.repo, "")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit := &object.Commit{
+		Author:       *signature,
+		Committer:    *signature,
+		Message:      op.message,
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{head.Hash()},
+	}
+	obj := op.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("error encoding stash commit: %w", err)
+	}
+	hash, err := op.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("error writing stash commit: %w", err)
+	}
+
+	ref := plumbing.NewHashReference(plumbing.ReferenceName(stashRefPrefix+strconv.FormatInt(time.Now().UnixNano(), 10)), hash)
+	if err := op.repo.Storer.SetReference(ref); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("error writing stash ref: %w", err)
+	}
+	return hash, nil
+}
+
+// restoreHead puts the changed files back to HEAD, in the worktree and in
+// the index
+func (op *stashPushOperation) restoreHead() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeWrite, "Restore tracked files to HEAD", "HEAD", op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to add restore step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.checkoutHead(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Restored %d files", len(op.files))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// checkoutHead writes the changed files as HEAD has them and stages them,
+// removing those HEAD does not have
+func (op *stashPushOperation) checkoutHead() error {
+	worktree, err := op.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	for _, file := range op.files {
+		entry, tracked := op.head[file]
+		if err := checkoutFile(op.fsys, op.repo, op.backend.filePath(file), entry, op.config.Perm()); err != nil {
+			return fmt.Errorf("error restoring %s: %w", file, err)
+		}
+		err := stageRemoval(op.repo, file)
+		if err == nil && tracked {
+			_, err = worktree.Add(file)
+		}
+		if err != nil {
+			return fmt.Errorf("error staging %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func (op *stashPopOperation) run() error {
+	if err := op.initialize(); err != nil {
+		return err
+	}
+
+	if err := op.verify(); err != nil {
+		return err
+	}
+
+	if err := op.apply(); err != nil {
+		return err
+	}
+
+	if err := op.drop(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d files from stash %d, review them with 'dotman status'\n", len(op.changes), op.stash.Index)
+	return journal.CompleteEntry(op.ctx)
+}
+
+func (op *stashPopOperation) initialize() error {
+	stashed, err := commitFiles(op.repo, op.stash.Hash)
+	if err != nil {
+		return err
+	}
+	commit, err := op.repo.CommitObject(op.stash.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to get stash commit: %w", err)
+	}
+	if commit.NumParents() != 1 {
+		return fmt.Errorf("stash %d is not a commit on top of another", op.stash.Index)
+	}
+	if op.base, err = commitFiles(op.repo, commit.ParentHashes[0]); err != nil {
+		return err
+	}
+
+	op.changes = make(map[string]object.TreeEntry)
+	op.added = make(map[string]bool)
+	for name, entry := range stashed {
+		if old, ok := op.base[name]; !ok || old != entry {
+			op.changes[name] = entry
+			op.added[name] = !ok
+		}
+	}
+	for name := range op.base {
+		if _, ok := stashed[name]; !ok {
+			op.changes[name] = object.TreeEntry{Name: name}
+		}
+	}
+
+	jm := newJournalManager(op.fsys, op.config, op.config.DotmanDir)
+	if err := jm.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize journal: %w", err)
+	}
+	op.ctx = journal.WithJournalManager(op.ctx, jm)
+
+	entry, err := jm.CreateEntry(journal.OperationTypeStashPop, op.stash.Ref.String(), op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to create journal entry: %w", err)
+	}
+	op.ctx = journal.WithJournalEntry(op.ctx, entry)
+
+	return nil
+}
+
+// verify checks that the stashed files are as they were when stashed, with
+// no uncommitted changes and no commits changing them since
+func (op *stashPopOperation) verify() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeVerify, "Verify stashed files are unchanged", op.config.DotmanDir, "")
+	if err != nil {
+		return fmt.Errorf("failed to add verify step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	err = op.unchanged()
+	if err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, "Stashed files are unchanged"); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// unchanged returns an error naming the first stashed file that changed
+func (op *stashPopOperation) unchanged() error {
+	changed, err := changedFiles(op.repo, op.backend)
+	if err != nil {
+		return err
+	}
+	for _, file := range changed {
+		if _, ok := op.changes[file]; ok {
+			return fmt.Errorf("%s has uncommitted changes, commit or stash them first", file)
+		}
+	}
+
+	head, err := op.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	current, err := commitFiles(op.repo, head.Hash())
+	if err != nil {
+		return err
+	}
+	for file := range op.changes {
+		if current[file] != op.base[file] {
+			return fmt.Errorf("%s was committed since it was stashed, apply the stash by hand with 'git -C %s checkout %s -- %s'", file, op.config.DotmanDir, op.stash.Hash.String()[:8], file)
+		}
+	}
+	return nil
+}
+
+// apply writes the stashed files to the worktree. Files the stash added to
+// the index are added again, other changes are left unstaged.
+func (op *stashPopOperation) apply() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeWrite, "Write stashed files", op.stash.Ref.String(), op.config.DotmanDir)
+	if err != nil {
+		return fmt.Errorf("failed to add write step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.writeFiles(); err != nil {
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Wrote %d files", len(op.changes))); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
+
+// writeFiles checks the stashed files out, in order
+func (op *stashPopOperation) writeFiles() error {
+	worktree, err := op.repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	files := make([]string, 0, len(op.changes))
+	for file := range op.changes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if err := checkoutFile(op.fsys, op.repo, op.backend.filePath(file), op.changes[file], op.config.Perm()); err != nil {
+			return fmt.Errorf("error writing %s: %w", file, err)
+		}
+		if op.added[file] {
+			if _, err := worktree.Add(file); err != nil {
+				return fmt.Errorf("error staging %s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// drop removes the ref of the applied stash
+func (op *stashPopOperation) drop() error {
+	step, err := journal.AddStepToCurrentEntry(op.ctx, journal.StepTypeGit, "Drop stash", op.stash.Ref.String(), "")
+	if err != nil {
+		return fmt.Errorf("failed to add drop step: %w", err)
+	}
+	if err := journal.StartStep(op.ctx, step); err != nil {
+		return fmt.Errorf("failed to start step: %w", err)
+	}
+
+	if err := op.repo.Storer.RemoveReference(op.stash.Ref); err != nil {
+		err = fmt.Errorf("error removing %s: %w", op.stash.Ref, err)
+		if err := journal.FailEntry(op.ctx, err); err != nil {
+			return fmt.Errorf("failed to fail entry: %w", err)
+		}
+		return err
+	}
+
+	if err := journal.CompleteStep(op.ctx, step, fmt.Sprintf("Dropped %s", op.stash.Hash)); err != nil {
+		return fmt.Errorf("failed to complete step: %w", err)
+	}
+	return nil
+}
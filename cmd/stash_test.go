@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestStashPushAndPop(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".gitignore", "journal/\n")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"},{"path":".zshenv","type":"file"}]}`)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "original")
+
+	// A risky edit and a new file staged, next to a file of no entry
+	zshrc := filepath.Join(dotmanDir, "data/.zshrc")
+	zshenv := filepath.Join(dotmanDir, "data/.zshenv")
+	fsys.WriteFile(zshrc, []byte("risky"), 0644)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshenv", "new")
+	fsys.WriteFile(filepath.Join(dotmanDir, "notes.txt"), []byte("mine"), 0644)
+
+	b, err := loadBackend(fsys, dotmanDir, dotmanfs.Perm{})
+	if err != nil {
+		t.Fatalf("failed to load backend: %v", err)
+	}
+	push := &stashPushOperation{config: cfg, fsys: fsys, ctx: context.Background(), repo: repo, backend: b, message: "prompt"}
+	if err := push.run(); err != nil {
+		t.Fatalf("failed to stash: %v", err)
+	}
+
+	if data, _ := fsys.ReadFile(zshrc); string(data) != "original" {
+		t.Errorf("expected .zshrc to be back to the commit, got %q", data)
+	}
+	if _, err := fsys.Stat(zshenv); err == nil {
+		t.Error("expected the new .zshenv to be removed")
+	}
+	if data, _ := fsys.ReadFile(filepath.Join(dotmanDir, "notes.txt")); string(data) != "mine" {
+		t.Errorf("expected a file of no entry to be left alone, got %q", data)
+	}
+	if files, err := changedFiles(repo, b); err != nil || len(files) != 0 {
+		t.Errorf("expected no changes left, got %v (%v)", files, err)
+	}
+	entry, err := journal.GetJournalEntry(push.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeStash, journal.EntryStateCompleted, 2)
+
+	stashes, err := listStashes(repo)
+	if err != nil {
+		t.Fatalf("failed to list stashes: %v", err)
+	}
+	if len(stashes) != 1 || stashes[0].Message != "prompt" {
+		t.Fatalf("expected one stash named prompt, got %+v", stashes)
+	}
+
+	// A stashed file edited since is not overwritten
+	fsys.WriteFile(zshrc, []byte("edited"), 0644)
+	pop := &stashPopOperation{config: cfg, fsys: fsys, ctx: context.Background(), repo: repo, backend: b, stash: stashes[0]}
+	if err := pop.run(); err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Fatalf("expected the edited file to stop the pop, got %v", err)
+	}
+	if stashes, _ := listStashes(repo); len(stashes) != 1 {
+		t.Fatalf("expected the stash to be kept, got %+v", stashes)
+	}
+
+	fsys.WriteFile(zshrc, []byte("original"), 0644)
+	pop = &stashPopOperation{config: cfg, fsys: fsys, ctx: context.Background(), repo: repo, backend: b, stash: stashes[0]}
+	if err := pop.run(); err != nil {
+		t.Fatalf("failed to pop: %v", err)
+	}
+	if data, _ := fsys.ReadFile(zshrc); string(data) != "risky" {
+		t.Errorf("expected the stashed .zshrc back, got %q", data)
+	}
+	if data, _ := fsys.ReadFile(zshenv); string(data) != "new" {
+		t.Errorf("expected the stashed .zshenv back, got %q", data)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	if s := status.File("data/.zshenv"); s.Staging != git.Added {
+		t.Errorf("expected .zshenv to be added again, got %+v", s)
+	}
+	if stashes, _ := listStashes(repo); len(stashes) != 0 {
+		t.Errorf("expected the stash to be dropped, got %+v", stashes)
+	}
+	entry, err = journal.GetJournalEntry(pop.ctx)
+	if err != nil {
+		t.Fatalf("failed to get journal entry: %v", err)
+	}
+	testutil.VerifyEntryWithSteps(t, entry, journal.OperationTypeStashPop, journal.EntryStateCompleted, 3)
+}
@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// machineState is what dotman remembers about this machine outside the
+// repository, to notice changes made to the repository behind its back
+type machineState struct {
+	// MachineID identifies the machine, whatever its hostname
+	MachineID string `json:"machine_id"`
+	// Repos holds the state of the repository of each profile by name
+	Repos map[string]repoState `json:"repos"`
+}
+
+// repoState is the last state dotman left the repository of a profile in
+type repoState struct {
+	DotmanDir string `json:"dotman_dir"`
+	// ManifestHash is the SHA-256 of the manifest last applied, by link or
+	// by an operation changing the manifest
+	ManifestHash string    `json:"manifest_hash"`
+	Updated      time.Time `json:"updated"`
+	// Links are the paths the manifest last applied links, as recorded in
+	// entries, so link finds the links of entries dropped since
+	Links []string `json:"links,omitempty"`
+	// Commit is the commit HEAD pointed at, so link summarizes what landed
+	// since
+	Commit string `json:"commit,omitempty"`
+}
+
+// stateProblem is a change to the repository dotman did not make, with the
+// command that repairs it
+type stateProblem struct {
+	Problem string `json:"problem"`
+	Fix     string `json:"fix"`
+}
+
+// statePath returns the state file of this machine: dotman/state.json in
+// $XDG_STATE_HOME, or in ~/.local/state without it
+func statePath(fsys dotmanfs.FileSystem) (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(stateHome) {
+		homeDir, err := fsys.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting user home directory: %w", err)
+		}
+		stateHome = filepath.Join(homeDir, ".local", "state")
+	}
+	return filepath.Join(stateHome, "dotman", "state.json"), nil
+}
+
+// loadState reads the state file. A missing or unreadable one loads empty,
+// as if dotman never ran on the machine.
+func loadState(fsys dotmanfs.FileSystem) (*machineState, error) {
+	state := &machineState{Repos: map[string]repoState{}}
+
+	path, err := statePath(fsys)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fsys.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("error reading state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil || state.Repos == nil {
+		state.Repos = map[string]repoState{}
+	}
+	return state, nil
+}
+
+// save writes the state file, giving the machine an ID the first time
+func (s *machineState) save(fsys dotmanfs.FileSystem) error {
+	if s.MachineID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return fmt.Errorf("error generating machine ID: %w", err)
+		}
+		s.MachineID = hex.EncodeToString(id)
+	}
+
+	path, err := statePath(fsys)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %w", err)
+	}
+	if err := fsys.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing state: %w", err)
+	}
+	return nil
+}
+
+// machineID returns the ID of this machine, creating the state file when
+// there is none yet
+func machineID(fsys dotmanfs.FileSystem) (string, error) {
+	state, err := loadState(fsys)
+	if err != nil {
+		return "", err
+	}
+	if state.MachineID == "" {
+		if err := state.save(fsys); err != nil {
+			return "", err
+		}
+	}
+	return state.MachineID, nil
+}
+
+// manifestHash returns the SHA-256 of the manifest of dotmanDir, empty when
+// there is none
+func manifestHash(fsys dotmanfs.FileSystem, dotmanDir string) (string, error) {
+	data, err := fsys.ReadFile(manifest.Path(dotmanDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading manifest: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordState remembers the dotman directory of cfg and its manifest as
+// applied on this machine. The state only feeds hints, so failing to write
+// it never fails the operation that applied the manifest.
+func recordState(fsys dotmanfs.FileSystem, cfg *config.Config) {
+	state, err := loadState(fsys)
+	if err != nil {
+		return
+	}
+	hash, err := manifestHash(fsys, cfg.DotmanDir)
+	if err != nil {
+		return
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return
+	}
+	var links []string
+	for _, entry := range m.Entries {
+		for _, link := range entry.Links() {
+			links = append(links, link.Path)
+		}
+	}
+	// Dropped links kept in place are offered for removal again
+	if dropped, err := droppedLinks(fsys, cfg, m); err == nil {
+		for _, link := range dropped {
+			links = append(links, link.Path)
+		}
+	}
+	profile, _ := cfg.CurrentProfile()
+	state.Repos[profile] = repoState{DotmanDir: filepath.Clean(cfg.DotmanDir), ManifestHash: hash, Updated: time.Now().UTC(), Links: links, Commit: headHash(fsys, cfg.DotmanDir, m)}
+	state.save(fsys)
+}
+
+// recordCommit remembers the commit HEAD points at after a commit made by
+// dotman on this machine, which is no news to the next link
+func recordCommit(fsys dotmanfs.FileSystem, cfg *config.Config) {
+	state, err := loadState(fsys)
+	if err != nil {
+		return
+	}
+	profile, _ := cfg.CurrentProfile()
+	last, ok := state.Repos[profile]
+	if !ok || last.DotmanDir != filepath.Clean(cfg.DotmanDir) {
+		return
+	}
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return
+	}
+	last.Commit = headHash(fsys, cfg.DotmanDir, m)
+	state.Repos[profile] = last
+	state.save(fsys)
+}
+
+// headHash returns the commit HEAD of the repository in dotmanDir points at,
+// empty without one
+func headHash(fsys dotmanfs.FileSystem, dotmanDir string, m *manifest.Manifest) string {
+	b, err := newBackend(fsys, dotmanDir, m, dotmanfs.Perm{})
+	if err != nil {
+		return ""
+	}
+	repo, err := openRepo(fsys, dotmanDir, b)
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
+
+// droppedLinks returns the links of entries the manifest last applied had
+// and m no longer has, e.g. after merging the deletion of an entry on another
+// machine. Only symlinks into the dotman directory are returned, anything
+// else at their paths is the user's.
+func droppedLinks(fsys dotmanfs.FileSystem, cfg *config.Config, m *manifest.Manifest) ([]manifest.Entry, error) {
+	state, err := loadState(fsys)
+	if err != nil {
+		return nil, err
+	}
+	profile, _ := cfg.CurrentProfile()
+	last, ok := state.Repos[profile]
+	if !ok || last.DotmanDir != filepath.Clean(cfg.DotmanDir) {
+		return nil, nil
+	}
+	return removedLinks(fsys, cfg, last.Links, m)
+}
+
+// removedLinks returns the links at paths, such as the links of an earlier
+// manifest, that m no longer has. Only symlinks into the dotman directory
+// are returned.
+func removedLinks(fsys dotmanfs.FileSystem, cfg *config.Config, paths []string, m *manifest.Manifest) ([]manifest.Entry, error) {
+	if m.InPlace() {
+		return nil, nil
+	}
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	current := make(map[string]bool)
+	for _, entry := range m.Entries {
+		for _, link := range entry.Links() {
+			current[link.Path] = true
+		}
+	}
+	var dropped []manifest.Entry
+	for _, path := range paths {
+		if current[path] {
+			continue
+		}
+		link := manifest.Entry{Path: path}
+		target, err := fsys.Readlink(link.TargetPath(homeDir))
+		if err == nil && isWithin(cfg.DotmanDir, target) {
+			dropped = append(dropped, link)
+		}
+	}
+	return dropped, nil
+}
+
+// backupTimeFormat names the backup directories of link by the time they
+// were made
+const backupTimeFormat = "20060102-150405"
+
+// backupRoot returns the directory holding the backups of link: backup_dir
+// when set, dotman/backups next to the state file otherwise
+func backupRoot(fsys dotmanfs.FileSystem, cfg *config.Config) (string, error) {
+	if cfg.BackupDir != "" {
+		return cfg.BackupDir, nil
+	}
+	path, err := statePath(fsys)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "backups"), nil
+}
+
+// backupDir returns a new timestamped directory in backupRoot to back up
+// what link removes
+func backupDir(fsys dotmanfs.FileSystem, cfg *config.Config) (string, error) {
+	root, err := backupRoot(fsys, cfg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, time.Now().Format(backupTimeFormat)), nil
+}
+
+// compressBackups replaces the backup directories of link made before
+// cutoff with gzip compressed tar archives of the same name, and returns the
+// number compressed
+func compressBackups(fsys dotmanfs.FileSystem, cfg *config.Config, cutoff time.Time) (int, error) {
+	root, err := backupRoot(fsys, cfg)
+	if err != nil {
+		return 0, err
+	}
+	infos, err := fsys.Readdir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error reading backups: %w", err)
+	}
+
+	compressed := 0
+	for _, info := range infos {
+		made, err := time.ParseInLocation(backupTimeFormat, info.Name(), time.Local)
+		if err != nil || !info.IsDir() || !made.Before(cutoff) {
+			continue
+		}
+		dir := filepath.Join(root, info.Name())
+		if err := writeTarGz(fsys, dir, dir+".tar.gz"); err != nil {
+			fsys.Remove(dir + ".tar.gz")
+			return compressed, fmt.Errorf("error compressing backup %s: %w", dir, err)
+		}
+		if err := fsys.RemoveAll(dir); err != nil {
+			return compressed, fmt.Errorf("error removing compressed backup %s: %w", dir, err)
+		}
+		compressed++
+	}
+	return compressed, nil
+}
+
+// writeTarGz writes the tree at dir to a gzip compressed tar archive at
+// path. Symlinks are archived as symlinks.
+func writeTarGz(fsys dotmanfs.FileSystem, dir, path string) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	err := fsys.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := fsys.Lstat(file)
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = fsys.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := fsys.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return fsys.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// checkState compares the repository of cfg with the state recorded last,
+// reporting a dotman directory moved by hand and a manifest changed by
+// something other than dotman, such as a git pull
+func checkState(fsys dotmanfs.FileSystem, cfg *config.Config) ([]stateProblem, error) {
+	state, err := loadState(fsys)
+	if err != nil {
+		return nil, err
+	}
+	profile, _ := cfg.CurrentProfile()
+	last, ok := state.Repos[profile]
+	if !ok {
+		return nil, nil
+	}
+
+	dotmanDir := filepath.Clean(cfg.DotmanDir)
+	if last.DotmanDir != dotmanDir {
+		// Only a directory that is gone was moved, otherwise the config
+		// points at another repository on purpose
+		if _, err := fsys.Stat(last.DotmanDir); os.IsNotExist(err) {
+			return []stateProblem{{
+				Problem: fmt.Sprintf("the dotman directory moved from %s to %s, symlinks may still point into the old location", last.DotmanDir, dotmanDir),
+				Fix:     fmt.Sprintf("dotman move-repo --from %s %s", last.DotmanDir, dotmanDir),
+			}}, nil
+		}
+		return nil, nil
+	}
+
+	if _, err := fsys.Stat(dotmanDir); os.IsNotExist(err) {
+		return []stateProblem{{
+			Problem: fmt.Sprintf("the dotman directory %s is gone", dotmanDir),
+			Fix:     "dotman move-repo <new-dir>, if it was moved",
+		}}, nil
+	}
+
+	hash, err := manifestHash(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	if hash != last.ManifestHash {
+		return []stateProblem{{
+			Problem: fmt.Sprintf("the manifest changed outside dotman since %s", last.Updated.Local().Format(time.RFC3339)),
+			Fix:     "dotman link",
+		}}, nil
+	}
+	return nil, nil
+}
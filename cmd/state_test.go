@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestCheckState(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "")
+
+	memFS, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	defer memFS.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, memFS, dotmanDir)
+
+	// Nothing is known before dotman applied the manifest once
+	if problems, err := checkState(memFS, cfg); err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems without state, got %v (%v)", problems, err)
+	}
+
+	recordState(memFS, cfg)
+	if _, err := memFS.Stat(filepath.Join(testutil.TestHomeDir, ".local/state/dotman/state.json")); err != nil {
+		t.Fatalf("expected the state in ~/.local/state: %v", err)
+	}
+	if problems, err := checkState(memFS, cfg); err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems after recording, got %v (%v)", problems, err)
+	}
+
+	id, err := machineID(memFS)
+	if err != nil || len(id) != 32 {
+		t.Fatalf("expected a machine ID, got %q (%v)", id, err)
+	}
+
+	// A manifest changed by a pull needs a link
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".zshrc", Type: manifest.EntryTypeFile})
+	if err := manifest.Save(memFS, dotmanDir, m); err != nil {
+		t.Fatalf("failed to save manifest: %v", err)
+	}
+	problems, err := checkState(memFS, cfg)
+	if err != nil || len(problems) != 1 || problems[0].Fix != "dotman link" {
+		t.Fatalf("expected the changed manifest to ask for a link, got %v (%v)", problems, err)
+	}
+	recordState(memFS, cfg)
+
+	// A directory moved by hand, with the config pointing at the new one
+	movedDir := filepath.Join(testutil.TestHomeDir, "dotfiles")
+	if err := memFS.Rename(dotmanDir, movedDir); err != nil {
+		t.Fatalf("failed to move dotman directory: %v", err)
+	}
+	cfg.DotmanDir = movedDir
+	problems, err = checkState(memFS, cfg)
+	if err != nil || len(problems) != 1 || !strings.HasPrefix(problems[0].Fix, "dotman move-repo --from ") {
+		t.Fatalf("expected the move to ask for move-repo, got %v (%v)", problems, err)
+	}
+
+	// The machine keeps its ID
+	if again, _ := machineID(memFS); again != id {
+		t.Errorf("expected the machine ID to stay %s, got %s", id, again)
+	}
+}
+
+func TestCompressBackups(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	cfg.BackupDir = "/mnt/backups"
+	old := filepath.Join(cfg.BackupDir, "20200101-120000")
+	recent, err := backupDir(fsys, cfg)
+	if err != nil {
+		t.Fatalf("backupDir failed: %v", err)
+	}
+	for _, dir := range []string{old, recent} {
+		fsys.MkdirAll(filepath.Join(dir, ".config"), 0755)
+		fsys.WriteFile(filepath.Join(dir, ".config", "app.toml"), []byte("theme = 'dark'"), 0644)
+		fsys.Symlink(filepath.Join(dotmanDir, "data/.vimrc"), filepath.Join(dir, ".vimrc"))
+	}
+
+	n, err := compressBackups(fsys, cfg, time.Now().Add(-time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("expected the old backup to be compressed, got %d (%v)", n, err)
+	}
+	if _, err := fsys.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected the old backup directory to be removed, got %v", err)
+	}
+	if _, err := fsys.Stat(recent); err != nil {
+		t.Errorf("expected the recent backup to be kept: %v", err)
+	}
+
+	f, err := fsys.Open(old + ".tar.gz")
+	if err != nil {
+		t.Fatalf("failed to open the compressed backup: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to decompress backup: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	found := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		found[header.Name] = string(data) + header.Linkname
+	}
+	if found[".config/app.toml"] != "theme = 'dark'" || found[".vimrc"] != filepath.Join(dotmanDir, "data/.vimrc") {
+		t.Errorf("unexpected backup contents %v", found)
+	}
+}
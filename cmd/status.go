@@ -1,67 +1,125 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/store"
 	"github.com/spf13/cobra"
 )
 
+var (
+	statusJSON      bool
+	statusPorcelain bool
+	statusFast      bool
+)
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the status of the dotfiles",
+	Long: `Show the git status of the tracked copies in data/, followed by the
+symlinks in the home directory that are missing, point somewhere else, or
+were replaced by a regular file or directory. A deduplicated copy shows as
+modified when the blob it shares in the store was changed, as by an edit
+through its link, and so do the other copies sharing it.
+
+Operations the journal still records as in progress are listed first: they
+were interrupted, and the files they touched may be half changed. A dotman
+directory moved by hand, or a manifest changed outside dotman since the last
+link, such as by a git pull, is pointed out with the command repairing it. Commits
+left unpushed for longer than push_reminder (3 days by default) are warned
+about too.
+
+Use --json to get the same information as a JSON document, along with how
+many commits the branch is ahead of and behind origin as of the last fetch.
+
+Use --porcelain in shell prompts: it prints a single word, clean, dirty,
+unpushed or dirty+unpushed. With --fast the answer comes from a cache of the
+last full status when no file in data/ and no branch changed since, which
+skips the worktree status and takes a few milliseconds.
+
+The exit code tells what status found: 2 for changes not committed or pushed
+and links not in place, 3 for files in the way of links and 4 for interrupted
+operations. See 'dotman help exit-codes'.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if statusFast && !statusPorcelain {
+			fmt.Println("Error: --fast can only be used with --porcelain")
+			exit(1)
+		}
+
 		// Load config
 		cfg, err := config.LoadConfig(configPath, fsys)
 		if err != nil {
 			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 
-		// Open the repository
-		repo, err := git.PlainOpen(cfg.DotmanDir)
-		if err != nil {
-			fmt.Printf("Error opening repository: %v\n", err)
-			os.Exit(1)
+		if statusFast {
+			token, err := fastPorcelain(fsys, cfg)
+			if err != nil {
+				fmt.Printf("Error getting status: %v\n", err)
+				exit(1)
+			}
+			fmt.Println(token)
+			if token != porcelainToken(false, false) {
+				exit(exitDrift)
+			}
+			return
 		}
 
-		// Get the working tree
-		worktree, err := repo.Worktree()
+		report, err := loadStatus(fsys, cfg)
 		if err != nil {
-			fmt.Printf("Error getting worktree: %v\n", err)
-			os.Exit(1)
+			fmt.Printf("Error getting status: %v\n", err)
+			exit(1)
 		}
 
-		// Get the status
-		status, err := worktree.Status()
-		if err != nil {
-			fmt.Printf("Error getting status: %v\n", err)
-			os.Exit(1)
+		if statusJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Printf("Error encoding status: %v\n", err)
+				exit(1)
+			}
+			fmt.Println(string(data))
+			exitStatus(report)
+			return
 		}
 
+		if statusPorcelain {
+			fmt.Println(porcelainToken(reportDirty(report), report.Branch.Ahead > 0))
+			exitStatus(report)
+			return
+		}
+
+		// Warn about operations that never finished first, the files they
+		// touched may be half changed
+		printInterrupted(report.Interrupted)
+		printPending(report.Pending)
+		printStateProblems(report.State)
+		printUnpushed(report.Unpushed)
+
 		// Create a map to store the tree structure
 		tree := make(map[string]interface{})
 
-		// Build the tree structure, only including files from data directory
-		for file, fileStatus := range status {
-			// Skip files not in the data directory
-			if !strings.HasPrefix(file, "data/") {
-				continue
-			}
-			// Remove the "data/" prefix for display
-			file = strings.TrimPrefix(file, "data/")
-
-			parts := strings.Split(file, string(filepath.Separator))
+		// Build the tree structure
+		for _, file := range report.Files {
+			parts := strings.Split(file.Path, string(filepath.Separator))
 			current := tree
 			for i, part := range parts {
 				if i == len(parts)-1 {
-					// This is a file - store a copy of the FileStatus struct
-					statusCopy := *fileStatus
-					current[part] = statusCopy
+					// This is a file
+					current[part] = file.status
 				} else {
 					// This is a directory
 					if _, exists := current[part]; !exists {
@@ -75,15 +133,448 @@ var statusCmd = &cobra.Command{
 		// Print the tree
 		fmt.Println("Git Status:")
 		fmt.Println("-----------")
+		if report.Branch.Upstream != "" {
+			fmt.Printf("On branch %s, %d ahead and %d behind %s\n", report.Branch.Name, report.Branch.Ahead, report.Branch.Behind, report.Branch.Upstream)
+		}
 		if len(tree) == 0 {
-			fmt.Println("Working directory clean")
-			return
+			fmt.Println(paint(colorGreen, symbols().ok+"Working directory clean"))
+		} else {
+			printTree(tree, "", true)
 		}
-		printTree(tree, "", true)
+
+		fmt.Println()
+		fmt.Println("Links:")
+		fmt.Println("------")
+		printLinks(report.Links)
+		exitStatus(report)
 	},
 }
 
+// exitStatus exits with the code for what report found, if it is not 0
+func exitStatus(report *statusReport) {
+	if code := statusExitCode(report); code != exitOK {
+		exit(code)
+	}
+}
+
+// statusExitCode returns the exit code for what report found, the highest
+// that applies
+func statusExitCode(report *statusReport) int {
+	if len(report.Interrupted) > 0 {
+		return exitLocked
+	}
+	code := exitOK
+	if reportDirty(report) || report.Branch.Ahead > 0 {
+		code = exitDrift
+	}
+	for _, link := range report.Links {
+		switch link.State {
+		case "linked":
+		case "hijacked", "replaced":
+			return exitConflict
+		default:
+			code = exitDrift
+		}
+	}
+	return code
+}
+
+// statusReport is everything `dotman status` shows
+type statusReport struct {
+	Interrupted []journal.IndexRecord `json:"interrupted"`
+	Pending     []journal.Pending     `json:"pending"`
+	// State holds the changes made to the repository behind dotman's back
+	State    []stateProblem  `json:"state,omitempty"`
+	Branch   statusBranch    `json:"branch"`
+	Unpushed *unpushedReport `json:"unpushed,omitempty"`
+	Files    []statusFile    `json:"files"`
+	Links    []linkStatus    `json:"links"`
+}
+
+// statusBranch is the checked out branch and how it compares to origin
+type statusBranch struct {
+	// Name is empty when HEAD is detached or there are no commits yet
+	Name string `json:"name,omitempty"`
+	// Upstream is the remote-tracking branch, empty when there is none
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+}
+
+// statusFile is the git status of a changed file in data/
+type statusFile struct {
+	// Path is relative to data/
+	Path     string `json:"path"`
+	Staging  string `json:"staging"`
+	Worktree string `json:"worktree"`
+
+	status git.FileStatus
+}
+
+// loadStatus gathers the status of the dotman directory
+func loadStatus(fsys dotmanfs.FileSystem, cfg *config.Config) (*statusReport, error) {
+	report := &statusReport{
+		Interrupted: []journal.IndexRecord{},
+		Files:       []statusFile{},
+		Links:       []linkStatus{},
+	}
+
+	interrupted, err := interruptedOperations(fsys, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	report.Interrupted = append(report.Interrupted, interrupted...)
+
+	if report.Pending, err = newJournalManager(fsys, cfg, cfg.DotmanDir).Pending(); err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+
+	if report.State, err = checkState(fsys, cfg); err != nil {
+		return nil, err
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBackend(fsys, cfg.DotmanDir, m, cfg.Perm())
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the repository
+	repo, err := openRepo(fsys, cfg.DotmanDir, b)
+	if err != nil {
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	// Get the working tree
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	// Get the status, only including the files of tracked entries
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("error getting git status: %w", err)
+	}
+	changedBlobs := make(map[string]bool)
+	for file, fileStatus := range status {
+		if strings.HasPrefix(file, store.Dir+"/") && fileStatus.Worktree == git.Modified {
+			changedBlobs[b.filePath(file)] = true
+		}
+		rel, ok := b.entryPath(file)
+		if !ok {
+			continue
+		}
+		report.Files = append(report.Files, statusFile{
+			Path:     rel,
+			Staging:  statusCodeName(fileStatus.Staging),
+			Worktree: statusCodeName(fileStatus.Worktree),
+			status:   *fileStatus,
+		})
+	}
+	if err := addChangedBlobs(fsys, cfg.DotmanDir, m, b, report, changedBlobs); err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Path < report.Files[j].Path
+	})
+
+	if report.Branch, err = branchStatus(repo); err != nil {
+		return nil, err
+	}
+	if report.Unpushed, err = unpushedCommits(fsys, cfg, repo); err != nil {
+		return nil, err
+	}
+
+	// Entries tracked in place have no symlinks to check, and no copies
+	// for the status cache to fingerprint
+	if !b.links() {
+		return report, nil
+	}
+
+	// Check the symlinks of the tracked entries
+	links, err := checkLinks(fsys, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error checking links: %w", err)
+	}
+	report.Links = append(report.Links, links...)
+
+	// Let the next `status --porcelain --fast` skip all of the above. A
+	// read-only dotman directory goes without.
+	if err := writeStatusCache(fsys, cfg.DotmanDir, report); err != nil && !dotmanfs.IsReadOnly(err) {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// addChangedBlobs reports the deduplicated copies linking to changedBlobs as
+// modified. An edit through the link in the home directory changes the blob
+// the copy shares, while the link git sees in data/ stays the same.
+func addChangedBlobs(fsys dotmanfs.FileSystem, dotmanDir string, m *manifest.Manifest, b backend, report *statusReport, changedBlobs map[string]bool) error {
+	if len(changedBlobs) == 0 {
+		return nil
+	}
+	listed := make(map[string]bool)
+	for _, file := range report.Files {
+		listed[file.Path] = true
+	}
+
+	links, err := store.LinksTo(fsys, dotmanDir, m.Layout.HomeDir(dotmanDir), changedBlobs)
+	if err != nil {
+		return fmt.Errorf("error checking blob links: %w", err)
+	}
+	for _, link := range links {
+		file, err := filepath.Rel(dotmanDir, link)
+		if err != nil {
+			return err
+		}
+		rel, ok := b.entryPath(filepath.ToSlash(file))
+		if !ok || listed[rel] {
+			continue
+		}
+		listed[rel] = true
+		report.Files = append(report.Files, statusFile{
+			Path:     rel,
+			Staging:  statusCodeName(git.Unmodified),
+			Worktree: statusCodeName(git.Modified),
+			status:   git.FileStatus{Staging: git.Unmodified, Worktree: git.Modified},
+		})
+	}
+	return nil
+}
+
+// statusCodeName returns the name of a git status code
+func statusCodeName(code git.StatusCode) string {
+	switch code {
+	case git.Unmodified:
+		return "unmodified"
+	case git.Untracked:
+		return "untracked"
+	case git.Modified:
+		return "modified"
+	case git.Added:
+		return "added"
+	case git.Deleted:
+		return "deleted"
+	case git.Renamed:
+		return "renamed"
+	case git.Copied:
+		return "copied"
+	case git.UpdatedButUnmerged:
+		return "unmerged"
+	default:
+		return string(rune(code))
+	}
+}
+
+// branchStatus compares the checked out branch with its remote-tracking
+// branch on origin. Nothing is fetched, the counts are as of the last fetch.
+func branchStatus(repo *git.Repository) (statusBranch, error) {
+	var branch statusBranch
+
+	head, err := repo.Head()
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return branch, nil
+		}
+		return branch, fmt.Errorf("error reading HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return branch, nil
+	}
+	branch.Name = head.Name().Short()
+
+	upstreamName := plumbing.NewRemoteReferenceName("origin", branch.Name)
+	upstream, err := repo.Reference(upstreamName, true)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return branch, nil
+		}
+		return branch, fmt.Errorf("error reading %s: %w", upstreamName.Short(), err)
+	}
+	branch.Upstream = upstreamName.Short()
+
+	local, err := ancestors(repo, head.Hash())
+	if err != nil {
+		return branch, err
+	}
+	remote, err := ancestors(repo, upstream.Hash())
+	if err != nil {
+		return branch, err
+	}
+	for hash := range local {
+		if !remote[hash] {
+			branch.Ahead++
+		}
+	}
+	for hash := range remote {
+		if !local[hash] {
+			branch.Behind++
+		}
+	}
+
+	return branch, nil
+}
+
+// ancestors returns the commits reachable from hash, including itself
+func ancestors(repo *git.Repository, hash plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	iter, err := repo.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+
+	commits := make(map[plumbing.Hash]bool)
+	err = iter.ForEach(func(c *object.Commit) error {
+		commits[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	return commits, nil
+}
+
+// interruptedOperations returns the journal entries of operations that are
+// still in progress, oldest first. Entries grouped under another entry are
+// left out, their group is reported.
+func interruptedOperations(fsys dotmanfs.FileSystem, cfg *config.Config) ([]journal.IndexRecord, error) {
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	records, err := jm.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var interrupted []journal.IndexRecord
+	for _, record := range records {
+		if record.State == journal.EntryStateCurrent && record.ParentID == "" {
+			interrupted = append(interrupted, record)
+		}
+	}
+	return interrupted, nil
+}
+
+// printInterrupted warns about operations that never finished
+func printInterrupted(interrupted []journal.IndexRecord) {
+	if len(interrupted) == 0 {
+		return
+	}
+
+	noun := "operation"
+	if len(interrupted) > 1 {
+		noun = "operations"
+	}
+	fmt.Println(paint(colorYellow, fmt.Sprintf("%sWARNING: %d interrupted %s, files may be in a half-changed state", symbols().warning, len(interrupted), noun)))
+	for _, record := range interrupted {
+		fmt.Printf("  %s %s started %s\n", record.ID, record.Operation, record.Timestamp.Format(time.RFC3339))
+	}
+	fmt.Println("Run `dotman journal <id>` to see how far each one got.")
+	fmt.Println()
+}
+
+// printPending lists the operations queued to be retried
+func printPending(pending []journal.Pending) {
+	if len(pending) == 0 {
+		return
+	}
+
+	for _, marker := range pending {
+		fmt.Printf("%s waiting since %s (%d attempts): %s\n", paint(colorYellow, "Queued "+string(marker.Operation)), marker.Since.Format(time.RFC3339), marker.Attempts, marker.Error)
+	}
+	fmt.Println("Run `dotman push` once the remote can be reached.")
+	fmt.Println()
+}
+
+// printStateProblems warns about changes made to the repository behind
+// dotman's back, with the command that repairs each
+func printStateProblems(problems []stateProblem) {
+	if len(problems) == 0 {
+		return
+	}
+
+	for _, p := range problems {
+		fmt.Println(paint(colorYellow, fmt.Sprintf("%sNote: %s", symbols().warning, p.Problem)))
+		fmt.Printf("Run `%s` to repair it.\n", p.Fix)
+	}
+	fmt.Println()
+}
+
+// linkStatus is the link state of the home path of a tracked entry
+type linkStatus struct {
+	// Entry is the path of the entry in the manifest
+	Entry string `json:"entry"`
+	// Path is the home path of the entry
+	Path  string `json:"path"`
+	State string `json:"state"`
+}
+
+// checkLinks returns the link state of every tracked entry enabled on this
+// host, in manifest order
+func checkLinks(fsys dotmanfs.FileSystem, cfg *config.Config) ([]linkStatus, error) {
+	filter, err := newEntryFilter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	l := newLinker(fsys, cfg, m)
+
+	var links []linkStatus
+	for _, entry := range m.Entries {
+		if !filter.match(m, entry) {
+			continue
+		}
+		homePath := entry.TargetPath(homeDir)
+		links = append(links, linkStatus{
+			Entry: entry.Path,
+			Path:  homePath,
+			State: entryState(fsys, l, cfg.DotmanDir, m, entry, homeDir),
+		})
+	}
+
+	return links, nil
+}
+
+// linkStates are the states printLinks counts, in summary order
+var linkStates = []string{"linked", "missing", "broken", "hijacked", "replaced", "no data", "error"}
+
+// printLinks lists the home paths that are not linked to their tracked copy,
+// followed by a summary line
+func printLinks(links []linkStatus) {
+	counts := make(map[string]int)
+	for _, link := range links {
+		counts[link.State]++
+		if link.State != "linked" {
+			fmt.Printf("%s %s\n", paintState(link.State, 9), link.Path)
+		}
+	}
+
+	summary := make([]string, 0, len(linkStates))
+	for _, state := range linkStates {
+		if counts[state] > 0 || state == "linked" {
+			text := fmt.Sprintf("%d %s", counts[state], state)
+			if counts[state] > 0 {
+				text = paint(stateColor(state), text)
+			}
+			summary = append(summary, text)
+		}
+	}
+	fmt.Printf("%d links: %s\n", len(links), strings.Join(summary, ", "))
+}
+
 func printTree(tree map[string]interface{}, prefix string, isLast bool) {
+	sym := symbols()
 	keys := make([]string, 0, len(tree))
 	for k := range tree {
 		keys = append(keys, k)
@@ -98,43 +589,23 @@ func printTree(tree map[string]interface{}, prefix string, isLast bool) {
 		if isLast {
 			currentPrefix = prefix + "    "
 		} else {
-			currentPrefix = prefix + "│   "
+			currentPrefix = prefix + sym.pipe
 		}
 
 		var connector string
 		if isLastItem {
-			connector = "└── "
+			connector = sym.corner
 		} else {
-			connector = "├── "
+			connector = sym.tee
 		}
 
 		// Get status symbol
 		var status string
 		if fileStatus, ok := value.(git.FileStatus); ok {
-			// Check both staging and worktree status
-			switch {
-			case fileStatus.Staging == git.Untracked && fileStatus.Worktree == git.Untracked:
-				status = "??"
-			case fileStatus.Staging == git.Added:
-				status = "A "
-			case fileStatus.Staging == git.Modified:
-				status = "M "
-			case fileStatus.Staging == git.Deleted:
-				status = "D "
-			case fileStatus.Staging == git.Renamed:
-				status = "R "
-			case fileStatus.Worktree == git.Modified:
-				status = " M"
-			case fileStatus.Worktree == git.Deleted:
-				status = " D"
-			case fileStatus.Worktree == git.Added:
-				status = " A"
-			default:
-				status = "  "
-			}
+			status = paintStatusCode(fileStatusCode(fileStatus))
 		} else {
 			// For directories, show directory icon
-			status = "📁"
+			status = sym.dir
 		}
 
 		fmt.Printf("%s%s%s %s\n", prefix, connector, status, key)
@@ -146,6 +617,45 @@ func printTree(tree map[string]interface{}, prefix string, isLast bool) {
 	}
 }
 
+// fileStatusCode returns the two-letter short status code for a file
+func fileStatusCode(fileStatus git.FileStatus) string {
+	// Check both staging and worktree status
+	switch {
+	case fileStatus.Staging == git.Untracked && fileStatus.Worktree == git.Untracked:
+		return "??"
+	case fileStatus.Staging == git.Added:
+		return "A "
+	case fileStatus.Staging == git.Modified:
+		return "M "
+	case fileStatus.Staging == git.Deleted:
+		return "D "
+	case fileStatus.Staging == git.Renamed:
+		return "R "
+	case fileStatus.Worktree == git.Modified:
+		return " M"
+	case fileStatus.Worktree == git.Deleted:
+		return " D"
+	case fileStatus.Worktree == git.Added:
+		return " A"
+	default:
+		return "  "
+	}
+}
+
+// paintStatusCode colors a short status code like git does, the staged
+// change green and the unstaged one red
+func paintStatusCode(code string) string {
+	if code == "??" {
+		return paint(colorRed, code)
+	}
+	return paint(colorGreen, code[:1]) + paint(colorRed, code[1:])
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "print the status as JSON")
+	statusCmd.Flags().BoolVar(&statusPorcelain, "porcelain", false, "print a single word: clean, dirty, unpushed or dirty+unpushed")
+	statusCmd.Flags().BoolVar(&statusFast, "fast", false, "answer --porcelain from the cached status when nothing changed since")
+	statusCmd.MarkFlagsMutuallyExclusive("json", "porcelain")
 }
@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/store"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestCheckLinks(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+	cfg := &config.Config{DotmanDir: dotmanDir}
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"},{"path":".bashrc","type":"file"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	for _, name := range []string{".zshrc", ".vimrc", ".bashrc"} {
+		if err := fsys.WriteFile(filepath.Join(dotmanDir, "data", name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+
+	// .zshrc is linked, .vimrc is missing and .bashrc was replaced
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := fsys.WriteFile(filepath.Join(testutil.TestHomeDir, ".bashrc"), []byte("local"), 0644); err != nil {
+		t.Fatalf("failed to write home file: %v", err)
+	}
+
+	links, err := checkLinks(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to check links: %v", err)
+	}
+
+	expected := []string{"linked", "missing", "replaced"}
+	if len(links) != len(expected) {
+		t.Fatalf("expected %d links, got %d", len(expected), len(links))
+	}
+	for i, state := range expected {
+		if links[i].State != state {
+			t.Errorf("expected %s to be %s, got %s", links[i].Path, state, links[i].State)
+		}
+	}
+}
+
+func TestInterruptedOperations(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+
+	// An empty journal has nothing in progress
+	interrupted, err := interruptedOperations(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if len(interrupted) != 0 {
+		t.Fatalf("expected no interrupted operations, got %d", len(interrupted))
+	}
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	done, err := jm.CreateEntry(journal.OperationTypeLink, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := jm.MoveEntry(done, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+	group, err := jm.CreateEntry(journal.OperationTypeAdd, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if _, err := jm.CreateChildEntry(group, journal.OperationTypeAdd, "", ""); err != nil {
+		t.Fatalf("failed to create child entry: %v", err)
+	}
+
+	interrupted, err = interruptedOperations(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if len(interrupted) != 1 || interrupted[0].ID != group.ID {
+		t.Fatalf("expected only %s to be interrupted, got %v", group.ID, interrupted)
+	}
+}
+
+func TestLoadStatus(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	// origin/main is at the first commit, main one commit ahead of it
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	upstream := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", "main"), head.Hash())
+	if err := repo.Storer.SetReference(upstream); err != nil {
+		t.Fatalf("failed to set remote-tracking branch: %v", err)
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.vimrc", "vim")
+
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	report, err := loadStatus(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+
+	expected := statusBranch{Name: "main", Upstream: "origin/main", Ahead: 1, Behind: 0}
+	if report.Branch != expected {
+		t.Errorf("expected branch %+v, got %+v", expected, report.Branch)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != ".zshrc" || report.Files[0].Worktree != "modified" {
+		t.Errorf("expected .zshrc to be modified, got %+v", report.Files)
+	}
+
+	// The document always has lists, never null
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("failed to encode status: %v", err)
+	}
+	if !strings.Contains(string(data), `"interrupted":[]`) || !strings.Contains(string(data), `"links":[]`) {
+		t.Errorf("expected empty lists in %s", data)
+	}
+}
+
+func TestLoadStatus_ReadOnly(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	if _, err := jm.CreateEntry(journal.OperationTypeAdd, "home/.zshrc", "data/.zshrc"); err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+
+	readOnly := testutil.ReadOnlyFS{FileSystem: fsys}
+
+	// Reading works without writing the caches
+	if _, err := loadStatus(readOnly, cfg); err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+	records, err := newJournalManager(readOnly, cfg, dotmanDir).Index()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 journal entry, got %v (%v)", records, err)
+	}
+
+	// Changing anything fails before it starts
+	err = newJournalManager(readOnly, cfg, dotmanDir).Initialize()
+	if !errors.Is(err, journal.ErrReadOnly) {
+		t.Fatalf("expected the journal to be read-only, got %v", err)
+	}
+}
+
+func TestUnpushedCommits(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	repo, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	// Two commits made ten days ago
+	old := &object.Signature{Name: "dotman", Email: "dotman@localhost", When: time.Now().Add(-10 * 24 * time.Hour)}
+	for _, name := range []string{".zshrc", ".vimrc"} {
+		testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/"+name, name)
+		if _, err := worktree.Commit("Add "+name, &git.CommitOptions{Author: old}); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+	}
+
+	// Without a remote there is nowhere to push to
+	if unpushed, err := unpushedCommits(fsys, cfg, repo); err != nil || unpushed != nil {
+		t.Fatalf("expected nothing to push without a remote, got %+v, %v", unpushed, err)
+	}
+
+	// A branch that was never pushed has all of its commits unpushed
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/dotfiles.git"}}); err != nil {
+		t.Fatalf("failed to create remote: %v", err)
+	}
+	unpushed, err := unpushedCommits(fsys, cfg, repo)
+	if err != nil {
+		t.Fatalf("failed to count unpushed commits: %v", err)
+	}
+	if unpushed == nil || unpushed.Commits != 2 || !unpushed.Overdue || unpushed.LastPush != nil {
+		t.Fatalf("expected 2 overdue commits never pushed, got %+v", unpushed)
+	}
+
+	// A queued push did not reach the remote, a completed one did
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	pushed, err := jm.CreateEntry(journal.OperationTypePush, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if err := jm.MoveEntry(pushed, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+	queued, err := jm.CreateEntry(journal.OperationTypePush, "", "")
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	queued.Steps = append(queued.Steps, journal.Step{Type: journal.StepTypeGit, Status: journal.StepStatusFailed})
+	if err := jm.MoveEntry(queued, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("failed to complete entry: %v", err)
+	}
+
+	// Up to the first commit is on origin, and the reminder is a month
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("failed to read HEAD commit: %v", err)
+	}
+	upstream := plumbing.NewHashReference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), commit.ParentHashes[0])
+	if err := repo.Storer.SetReference(upstream); err != nil {
+		t.Fatalf("failed to set remote-tracking branch: %v", err)
+	}
+	cfg.PushReminder = "30d"
+
+	unpushed, err = unpushedCommits(fsys, cfg, repo)
+	if err != nil {
+		t.Fatalf("failed to count unpushed commits: %v", err)
+	}
+	if unpushed == nil || unpushed.Commits != 1 || unpushed.Overdue {
+		t.Fatalf("expected 1 commit that is not overdue, got %+v", unpushed)
+	}
+	if unpushed.LastPush == nil || !unpushed.LastPush.Equal(pushed.Timestamp) {
+		t.Errorf("expected the last push at %s, got %v", pushed.Timestamp, unpushed.LastPush)
+	}
+}
+
+func TestLoadStatus_ChangedBlob(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	// Two identical copies deduplicated into one blob
+	dataDir := filepath.Join(dotmanDir, "data")
+	for _, name := range []string{".zshrc", ".bashrc"} {
+		if err := fsys.WriteFile(filepath.Join(dataDir, name), []byte("alias ll='ls -l'"), 0644); err != nil {
+			t.Fatalf("failed to write data file: %v", err)
+		}
+	}
+	if _, err := store.Dedup(fsys, dotmanDir, dataDir); err != nil {
+		t.Fatalf("failed to dedup: %v", err)
+	}
+	for _, path := range []string{"data", store.Dir} {
+		if _, err := worktree.Add(path); err != nil {
+			t.Fatalf("failed to stage %s: %v", path, err)
+		}
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"},{"path":".bashrc","type":"file"}]}`)
+
+	report, err := loadStatus(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+	if len(report.Files) != 0 {
+		t.Fatalf("expected a clean status, got %+v", report.Files)
+	}
+
+	// An edit through the home link of .zshrc writes to the shared blob
+	blob, _ := store.Resolve(fsys, dotmanDir, filepath.Join(dataDir, ".zshrc"))
+	if err := fsys.Chmod(blob, 0644); err != nil {
+		t.Fatalf("failed to chmod blob: %v", err)
+	}
+	if err := fsys.WriteFile(blob, []byte("alias ll='ls -la'"), 0644); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+
+	report, err = loadStatus(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+	if len(report.Files) != 2 || report.Files[0].Path != ".bashrc" || report.Files[1].Path != ".zshrc" {
+		t.Fatalf("expected both copies sharing the blob to be modified, got %+v", report.Files)
+	}
+	for _, file := range report.Files {
+		if file.Worktree != "modified" {
+			t.Errorf("expected %s to be modified, got %s", file.Path, file.Worktree)
+		}
+	}
+}
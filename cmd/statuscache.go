@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/noosxe/dotman/internal/checksum"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/noosxe/dotman/internal/store"
+)
+
+// statusCacheFile holds the outcome of the last full status. It lives in the
+// .git directory so it never shows up in the worktree status it caches.
+const statusCacheFile = "dotman-status.json"
+
+// statusCache is what `status --porcelain --fast` needs to answer without
+// running a worktree status
+type statusCache struct {
+	// Head and Upstream are the commits HEAD and its remote-tracking branch
+	// pointed at
+	Head     string `json:"head"`
+	Upstream string `json:"upstream,omitempty"`
+	Dirty    bool   `json:"dirty"`
+	Unpushed bool   `json:"unpushed"`
+	// Files holds the checksum of every file in data/
+	Files map[string]string `json:"files"`
+}
+
+// porcelainToken is the single word `status --porcelain` prints
+func porcelainToken(dirty, unpushed bool) string {
+	switch {
+	case dirty && unpushed:
+		return "dirty+unpushed"
+	case dirty:
+		return "dirty"
+	case unpushed:
+		return "unpushed"
+	default:
+		return "clean"
+	}
+}
+
+// reportDirty reports whether any file in data/ has changes
+func reportDirty(report *statusReport) bool {
+	for _, file := range report.Files {
+		if file.Staging != "unmodified" || file.Worktree != "unmodified" {
+			return true
+		}
+	}
+	return false
+}
+
+// headRefs returns the commits HEAD and its remote-tracking branch on origin
+// point at, read straight from the storage without opening the repository
+func headRefs(fsys dotmanfs.FileSystem, dotmanDir string) (string, string, error) {
+	s := newGitStorage(fsys, dotmanDir)
+
+	head, err := storer.ResolveReference(s, plumbing.HEAD)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("error reading HEAD: %w", err)
+	}
+
+	ref, err := s.Reference(plumbing.HEAD)
+	if err != nil || ref.Type() != plumbing.SymbolicReference || !ref.Target().IsBranch() {
+		return head.Hash().String(), "", nil
+	}
+	upstream, err := s.Reference(plumbing.NewRemoteReferenceName("origin", ref.Target().Short()))
+	if err != nil {
+		return head.Hash().String(), "", nil
+	}
+	return head.Hash().String(), upstream.Hash().String(), nil
+}
+
+// dataChecksums returns the checksum of every file in the home directory of
+// the layout, hashing only the files the checksum cache cannot vouch for
+func dataChecksums(fsys dotmanfs.FileSystem, dotmanDir string) (map[string]string, error) {
+	m, err := manifest.Load(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := checksum.Load(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := m.Layout.HomeDir(dotmanDir)
+	files := make(map[string]string)
+	err = fsys.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dataDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		// Deduplicated copies are compared by the content of their blob,
+		// which an edit through the link changes
+		if blob, ok := store.Resolve(fsys, dotmanDir, path); ok {
+			if _, err := fsys.Stat(blob); err == nil {
+				sum, err := cache.Sum(blob)
+				if err != nil {
+					return err
+				}
+				files[rel] = "blob:" + sum
+				return nil
+			}
+		}
+		// Links are compared by target, a dangling one has no content
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := fsys.Readlink(path)
+			if err != nil {
+				return err
+			}
+			files[rel] = "link:" + target
+			return nil
+		}
+		sum, err := cache.Sum(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading data directory: %w", err)
+	}
+
+	if err := cache.Save(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// recordChecksums records the checksums of the tracked copies at paths, so
+// checking them for drift later does not hash them again. The cache only
+// saves work, so failing to update it is a warning.
+func recordChecksums(fsys dotmanfs.FileSystem, dotmanDir string, paths ...string) {
+	err := func() error {
+		cache, err := checksum.Load(fsys, dotmanDir)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if _, err := cache.UpdateTree(path); err != nil {
+				return err
+			}
+		}
+		return cache.Save()
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update checksum cache: %v\n", err)
+	}
+}
+
+// writeStatusCache records the outcome of a full status
+func writeStatusCache(fsys dotmanfs.FileSystem, dotmanDir string, report *statusReport) error {
+	head, upstream, err := headRefs(fsys, dotmanDir)
+	if err != nil {
+		return err
+	}
+	files, err := dataChecksums(fsys, dotmanDir)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(statusCache{
+		Head:     head,
+		Upstream: upstream,
+		Dirty:    reportDirty(report),
+		Unpushed: report.Branch.Ahead > 0,
+		Files:    files,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding status cache: %w", err)
+	}
+	return fsys.WriteFile(filepath.Join(dotmanDir, ".git", statusCacheFile), data, 0644)
+}
+
+// cachedStatus returns the cached outcome of the last full status, or nil
+// when a branch moved or the content of data/ changed since
+func cachedStatus(fsys dotmanfs.FileSystem, dotmanDir string) (*statusCache, error) {
+	data, err := fsys.ReadFile(filepath.Join(dotmanDir, ".git", statusCacheFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading status cache: %w", err)
+	}
+	var cache statusCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		// A cache that cannot be read is simply rebuilt
+		return nil, nil
+	}
+
+	head, upstream, err := headRefs(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	if head != cache.Head || upstream != cache.Upstream {
+		return nil, nil
+	}
+
+	files, err := dataChecksums(fsys, dotmanDir)
+	if err != nil {
+		return nil, err
+	}
+	if !maps.Equal(files, cache.Files) {
+		return nil, nil
+	}
+
+	return &cache, nil
+}
+
+// fastPorcelain answers `status --porcelain --fast` from the status cache.
+// The checksum cache keeps that to a stat of each file in data/ unless one
+// was modified. A stale status cache falls back to a full status, which
+// refreshes it.
+func fastPorcelain(fsys dotmanfs.FileSystem, cfg *config.Config) (string, error) {
+	cache, err := cachedStatus(fsys, cfg.DotmanDir)
+	if err != nil {
+		return "", err
+	}
+	if cache != nil {
+		return porcelainToken(cache.Dirty, cache.Unpushed), nil
+	}
+
+	report, err := loadStatus(fsys, cfg)
+	if err != nil {
+		return "", err
+	}
+	return porcelainToken(reportDirty(report), report.Branch.Ahead > 0), nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestStatusCache(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+
+	report, err := loadStatus(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to load status: %v", err)
+	}
+	if token := porcelainToken(reportDirty(report), report.Branch.Ahead > 0); token != "clean" {
+		t.Fatalf("expected clean, got %s", token)
+	}
+
+	cache, err := cachedStatus(fsys, dotmanDir)
+	if err != nil {
+		t.Fatalf("failed to read status cache: %v", err)
+	}
+	if cache == nil || cache.Dirty || cache.Unpushed {
+		t.Fatalf("expected a clean cached status, got %+v", cache)
+	}
+
+	// Rewriting a file with the same content keeps the cache valid
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if cache, err = cachedStatus(fsys, dotmanDir); err != nil || cache == nil {
+		t.Fatalf("expected the cache to stay valid, got %+v, %v", cache, err)
+	}
+
+	// Any change in data/ makes the cache stale and the full status answers
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, "data/.zshrc"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+	if cache, err = cachedStatus(fsys, dotmanDir); err != nil || cache != nil {
+		t.Fatalf("expected the cache to be stale, got %+v, %v", cache, err)
+	}
+	token, err := fastPorcelain(fsys, cfg)
+	if err != nil {
+		t.Fatalf("failed to get fast status: %v", err)
+	}
+	if token != "dirty" {
+		t.Fatalf("expected dirty, got %s", token)
+	}
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// sudoCommand runs a command with elevated privileges, attached to the
+// terminal so sudo can ask for a password. Tests replace it.
+var sudoCommand = func(name string, args ...string) error {
+	cmd := exec.Command("sudo", append([]string{name}, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sudo %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// systemPath returns the absolute form of path for tracking in system mode,
+// failing for paths that belong in the home directory or the dotman directory
+func systemPath(fsys dotmanfs.FileSystem, path, dotmanDir string) (string, error) {
+	absPath, err := dotmanfs.AbsHome(fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %v", err)
+	}
+	absPath = filepath.Clean(absPath)
+	if !filepath.IsAbs(absPath) {
+		return "", fmt.Errorf("system path must be absolute")
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %v", err)
+	}
+
+	if isWithin(homeDir, absPath) {
+		return "", fmt.Errorf("%s is inside the home directory, add it without --system", absPath)
+	}
+	if isWithin(dotmanDir, absPath) {
+		return "", fmt.Errorf("%s is inside the dotman directory", absPath)
+	}
+
+	return absPath, nil
+}
+
+// isWithin reports whether path is dir or lies below it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// confirm asks a yes/no question on out and reads the answer from in.
+// Anything but an explicit yes declines.
+func confirm(in io.Reader, out io.Writer, prompt string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// confirmDestructive asks before an action that deletes or replaces files
+// the user may want to keep. Without a terminal to ask on, or with --yes, the
+// action goes ahead, so scripts keep working.
+func confirmDestructive(prompt string) bool {
+	if assumeYes || !isInteractive() {
+		return true
+	}
+	return confirm(promptInput, terminalOutput(), prompt)
+}
+
+// systemMkdirAll creates path with perm, retrying with sudo when permission
+// is denied
+func systemMkdirAll(fsys dotmanfs.FileSystem, path string, perm os.FileMode) error {
+	err := fsys.MkdirAll(path, perm)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	return sudoCommand("mkdir", "-p", "--", path)
+}
+
+// systemRemoveAll removes path, retrying with sudo when permission is denied
+func systemRemoveAll(fsys dotmanfs.FileSystem, path string) error {
+	err := fsys.RemoveAll(path)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	return sudoCommand("rm", "-rf", "--", path)
+}
+
+// systemSymlink creates newname pointing at oldname, retrying with sudo when
+// permission is denied
+func systemSymlink(fsys dotmanfs.FileSystem, oldname, newname string) error {
+	err := fsys.Symlink(oldname, newname)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	return sudoCommand("ln", "-s", "--", oldname, newname)
+}
+
+// systemChmod changes the mode of path, retrying with sudo when permission is
+// denied
+func systemChmod(fsys dotmanfs.FileSystem, path string, mode os.FileMode) error {
+	err := fsys.Chmod(path, mode)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	return sudoCommand("chmod", manifest.FormatMode(mode), "--", path)
+}
+
+// sudoCopy copies src to dst with sudo and hands the copy over to the
+// current user, so the repository stays writable and committable
+func sudoCopy(fsys dotmanfs.FileSystem, src, dst string) error {
+	// Drop anything left behind by the unprivileged attempt
+	if err := fsys.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	if err := sudoCommand("cp", "-pR", "--", src, dst); err != nil {
+		return err
+	}
+
+	owner := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	return sudoCommand("chown", "-R", owner, "--", dst)
+}
+
+// sudoVerify compares src and dst with sudo, for sources the current user
+// cannot read
+func sudoVerify(src, dst string) error {
+	if err := sudoCommand("diff", "-r", "-q", "--", src, dst); err != nil {
+		return fmt.Errorf("copy differs from %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	oldInput, oldInteractive, oldYes := promptInput, isInteractive, assumeYes
+	defer func() { promptInput, isInteractive, assumeYes = oldInput, oldInteractive, oldYes }()
+
+	tests := []struct {
+		name        string
+		interactive bool
+		yes         bool
+		answer      string
+		want        bool
+	}{
+		{name: "script", want: true},
+		{name: "terminal declines", interactive: true, answer: "\n", want: false},
+		{name: "terminal confirms", interactive: true, answer: "yes\n", want: true},
+		{name: "terminal with --yes", interactive: true, yes: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isInteractive = func() bool { return tt.interactive }
+			promptInput = strings.NewReader(tt.answer)
+			assumeYes = tt.yes
+
+			if got := confirmDestructive("Delete?"); got != tt.want {
+				t.Errorf("confirmDestructive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmDestructive_NoTerminal(t *testing.T) {
+	oldInteractive, oldYes, oldStdin := isInteractive, assumeYes, os.Stdin
+	defer func() { isInteractive, assumeYes, os.Stdin = oldInteractive, oldYes, oldStdin }()
+
+	// As under cron, systemd or </dev/null: a character device, no terminal
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", os.DevNull, err)
+	}
+	defer null.Close()
+	os.Stdin = null
+	assumeYes = false
+
+	if !confirmDestructive("Delete?") {
+		t.Error("expected the action to go ahead without a terminal")
+	}
+}
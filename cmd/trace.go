@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+// tracer collects the steps the command runs when --trace is given
+var tracer *traceObserver
+
+// printTrace prints what the tracer collected, once
+func printTrace() {
+	if tracer == nil {
+		return
+	}
+	tracer.print(os.Stderr)
+	tracer = nil
+}
+
+// traceObserver records the time every step of the operations a command
+// runs took, to print them when it is done
+type traceObserver struct {
+	journal.NopObserver
+
+	mu      sync.Mutex
+	start   time.Time
+	timings []journal.StepTiming
+}
+
+// newTraceObserver starts tracing a command
+func newTraceObserver() *traceObserver {
+	return &traceObserver{start: time.Now()}
+}
+
+func (o *traceObserver) StepCompleted(entry *journal.JournalEntry, step *journal.Step) error {
+	o.record(entry, step)
+	return nil
+}
+
+func (o *traceObserver) StepFailed(entry *journal.JournalEntry, step *journal.Step) error {
+	o.record(entry, step)
+	return nil
+}
+
+func (o *traceObserver) record(entry *journal.JournalEntry, step *journal.Step) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.timings = append(o.timings, journal.StepTiming{EntryID: entry.ID, Operation: entry.Operation, Step: *step})
+}
+
+// print writes the steps in the order they ran, the time by step type and
+// the time the command took in all, the rest of which went to work that is
+// not a journaled step
+func (o *traceObserver) print(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	total := time.Since(o.start)
+	fmt.Fprintln(w, "\nTrace:")
+	if len(o.timings) == 0 {
+		fmt.Fprintf(w, "  no journaled steps, %s in all\n", formatDuration(total))
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	var steps time.Duration
+	for _, timing := range o.timings {
+		d := timing.Step.Duration()
+		steps += d
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", formatDuration(d), timing.Operation, timing.Step.Type, timing.Step.Description)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nBy step type:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, stats := range journal.Stats(o.timings) {
+		fmt.Fprintf(tw, "  %s\t%s\t%d steps\t%.0f%%\n", stats.Type, formatDuration(stats.Total), stats.Count, share(stats.Total, total))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%s in steps, %s in all\n", formatDuration(steps), formatDuration(total))
+}
+
+// share returns part as a percentage of total
+func share(part, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// formatDuration rounds d for display, to milliseconds unless it is shorter
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
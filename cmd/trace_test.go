@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+func TestTraceObserver(t *testing.T) {
+	start := time.Now()
+	entry := &journal.JournalEntry{ID: "1", Operation: journal.OperationTypeAdd}
+	copyStep := &journal.Step{Type: journal.StepTypeCopy, Description: "Copy directory contents", StartTime: start, EndTime: start.Add(1500 * time.Millisecond)}
+	gitStep := &journal.Step{Type: journal.StepTypeGit, Description: "Stage in git", StartTime: start, EndTime: start.Add(250 * time.Microsecond)}
+
+	o := newTraceObserver()
+	o.start = start.Add(-2 * time.Second)
+	o.StepCompleted(entry, copyStep)
+	o.StepFailed(entry, gitStep)
+	o.EntryFailed(entry, errors.New("failed"))
+
+	var out bytes.Buffer
+	o.print(&out)
+	for _, want := range []string{
+		"1.5s   add  copy  Copy directory contents",
+		"250µs  add  git   Stage in git",
+		"copy  1.5s   1 steps  ",
+		"1.5s in steps, 2s in all",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in trace:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	newTraceObserver().print(&out)
+	if !strings.Contains(out.String(), "no journaled steps") {
+		t.Errorf("expected a trace without steps to say so, got %q", out.String())
+	}
+}
+
+func TestPrintSlowestSteps(t *testing.T) {
+	start := time.Now()
+	timings := journal.Timings([]*journal.JournalEntry{{ID: "1", Operation: journal.OperationTypePush, Steps: []journal.Step{
+		{Type: journal.StepTypeGit, Description: "Push changes", StartTime: start, EndTime: start.Add(2 * time.Second)},
+	}}})
+
+	var out bytes.Buffer
+	printStepStats(&out, journal.Stats(timings))
+	printSlowestSteps(&out, timings)
+	want := `STEP  COUNT  TOTAL  AVERAGE  MAX
+git   1      2s     2s       2s
+TIME  STEP  OPERATION  ENTRY  DESCRIPTION
+2s    git   push       1      Push changes
+`
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestJournalStatsSlowestFlag(t *testing.T) {
+	defer func() { statsSlowest = 0 }()
+
+	for args, want := range map[string]int{"--slowest": 10, "--slowest=3": 3} {
+		statsSlowest = 0
+		if err := journalStatsCmd.ParseFlags([]string{args}); err != nil {
+			t.Fatalf("failed to parse %s: %v", args, err)
+		}
+		if statsSlowest != want {
+			t.Errorf("%s: expected %d slowest steps, got %d", args, want, statsSlowest)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// remoteTransport holds what go-git needs beyond the URL to reach a remote
+// the way git would: the proxy from HTTPS_PROXY, HTTP_PROXY and NO_PROXY for
+// http remotes, and the user and identity file from ~/.ssh/config for ssh
+// remotes. Zero values leave go-git's defaults, like the ssh agent, in place.
+type remoteTransport struct {
+	Auth  transport.AuthMethod
+	Proxy transport.ProxyOptions
+}
+
+// newRemoteTransport returns the transport options for the remote at rawURL
+func newRemoteTransport(fsys dotmanfs.FileSystem, rawURL string) (*remoteTransport, error) {
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote URL %s: %w", rawURL, err)
+	}
+
+	rt := &remoteTransport{}
+	switch endpoint.Protocol {
+	case "http", "https":
+		rt.Proxy = proxyFor(endpoint)
+	case "ssh":
+		cfg, err := loadSSHConfig(fsys)
+		if err != nil {
+			return nil, err
+		}
+		if cfg != nil {
+			// go-git resolves host aliases and ports through this
+			gitssh.DefaultSSHConfig = sshConfigReader{cfg}
+			rt.Auth = sshIdentity(fsys, cfg, endpoint)
+		}
+	}
+	return rt, nil
+}
+
+// proxyFor returns the proxy the environment selects for endpoint
+func proxyFor(endpoint *transport.Endpoint) transport.ProxyOptions {
+	host := endpoint.Host
+	if endpoint.Port > 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(endpoint.Port))
+	}
+	target := &url.URL{Scheme: endpoint.Protocol, Host: host}
+
+	proxy, err := httpproxy.FromEnvironment().ProxyFunc()(target)
+	if err != nil || proxy == nil {
+		return transport.ProxyOptions{}
+	}
+
+	options := transport.ProxyOptions{URL: proxy.Scheme + "://" + proxy.Host}
+	if proxy.User != nil {
+		options.Username = proxy.User.Username()
+		options.Password, _ = proxy.User.Password()
+	}
+	return options
+}
+
+// loadSSHConfig parses ~/.ssh/config, returning nil when there is none
+func loadSSHConfig(fsys dotmanfs.FileSystem) (*ssh_config.Config, error) {
+	home, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	data, err := fsys.ReadFile(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading ssh config: %w", err)
+	}
+
+	cfg, err := ssh_config.DecodeBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ssh config: %w", err)
+	}
+	return cfg, nil
+}
+
+// sshConfigReader adapts a parsed ssh config to the lookups go-git makes
+type sshConfigReader struct {
+	cfg *ssh_config.Config
+}
+
+func (r sshConfigReader) Get(alias, key string) string {
+	value, _ := r.cfg.Get(alias, key)
+	return value
+}
+
+// sshIdentity returns public key auth with the first IdentityFile configured
+// for the endpoint's host that can be loaded, or nil to let go-git use the
+// ssh agent. Keys protected by a passphrase are left to the agent.
+func sshIdentity(fsys dotmanfs.FileSystem, cfg *ssh_config.Config, endpoint *transport.Endpoint) transport.AuthMethod {
+	user := endpoint.User
+	if user == "" {
+		user, _ = cfg.Get(endpoint.Host, "User")
+	}
+	if user == "" {
+		user = "git"
+	}
+
+	identities, _ := cfg.GetAll(endpoint.Host, "IdentityFile")
+	for _, identity := range identities {
+		path, err := dotmanfs.ExpandHome(fsys, identity)
+		if err != nil {
+			continue
+		}
+		pem, err := fsys.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		auth, err := gitssh.NewPublicKeys(user, pem, "")
+		if err != nil {
+			continue
+		}
+		return auth
+	}
+	return nil
+}
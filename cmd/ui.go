@@ -0,0 +1,479 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-git/go-git/v5"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Browse tracked files, the journal and repository status interactively",
+	Long: `Open an interactive terminal interface with panes for tracked files, the
+journal history with step drill-down, and the git status of the dotman
+repository. Missing symlinks can be relinked and changes committed from the UI.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		m := newUIModel(cfg, fsys)
+		if _, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(terminalOutput())).Run(); err != nil {
+			return fmt.Errorf("error running ui: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+}
+
+// uiPane identifies one of the panes of the interactive UI
+type uiPane int
+
+const (
+	uiPaneTracked uiPane = iota
+	uiPaneJournal
+	uiPaneStatus
+)
+
+var uiPaneTitles = []string{"Tracked", "Journal", "Status"}
+
+// uiTrackedItem is a manifest entry together with the state of its home symlink
+type uiTrackedItem struct {
+	entry manifest.Entry
+	state string
+}
+
+// uiStatusItem is a single line of git status
+type uiStatusItem struct {
+	path string
+	code string
+}
+
+// uiData is everything the UI displays, loaded in one go so it can be refreshed after actions
+type uiData struct {
+	tracked []uiTrackedItem
+	entries []*journal.JournalEntry
+	status  []uiStatusItem
+}
+
+type uiDataMsg struct {
+	data *uiData
+	err  error
+}
+
+type uiActionDoneMsg struct {
+	action string
+	err    error
+}
+
+type uiModel struct {
+	config *config.Config
+	fsys   dotmanfs.FileSystem
+
+	data    *uiData
+	pane    uiPane
+	cursors [3]int
+	// journal entry whose steps are being shown, if any
+	detail *journal.JournalEntry
+
+	committing bool
+	input      textinput.Model
+
+	message string
+	width   int
+	height  int
+}
+
+var (
+	uiTabStyle       = lipgloss.NewStyle().Padding(0, 1)
+	uiActiveTabStyle = uiTabStyle.Bold(true).Reverse(true)
+	uiCursorStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	uiDimStyle       = lipgloss.NewStyle().Faint(true)
+	uiErrorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+func newUIModel(cfg *config.Config, fsys dotmanfs.FileSystem) uiModel {
+	input := textinput.New()
+	input.Placeholder = "commit message"
+	input.CharLimit = 200
+
+	return uiModel{
+		config: cfg,
+		fsys:   fsys,
+		data:   &uiData{},
+		input:  input,
+	}
+}
+
+func (m uiModel) Init() tea.Cmd {
+	return m.load()
+}
+
+func (m uiModel) load() tea.Cmd {
+	return func() tea.Msg {
+		data, err := loadUIData(m.config, m.fsys)
+		return uiDataMsg{data: data, err: err}
+	}
+}
+
+// loadUIData gathers the tracked entries, journal history and git status
+func loadUIData(cfg *config.Config, fsys dotmanfs.FileSystem) (*uiData, error) {
+	data := &uiData{}
+
+	m, err := manifest.Load(fsys, cfg.DotmanDir)
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	l := newLinker(fsys, cfg, m)
+	for _, entry := range m.Entries {
+		data.tracked = append(data.tracked, uiTrackedItem{
+			entry: entry,
+			state: entryState(fsys, l, cfg.DotmanDir, m, entry, homeDir),
+		})
+	}
+
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	entries, err := jm.ListEntries("")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	data.entries = entries
+
+	billyFs := dotmanfs.NewBillyFileSystem(fsys, cfg.DotmanDir, cfg.Perm())
+	repo, err := git.Open(newGitStorage(fsys, cfg.DotmanDir), billyFs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	for path, fileStatus := range status {
+		data.status = append(data.status, uiStatusItem{path: path, code: fileStatusCode(*fileStatus)})
+	}
+	sort.Slice(data.status, func(i, j int) bool {
+		return data.status[i].path < data.status[j].path
+	})
+
+	return data, nil
+}
+
+// linkState describes whether homePath is linked to the tracked copy at dataPath
+func linkState(fsys dotmanfs.FileSystem, homePath, dataPath string) string {
+	homeInfo, err := fsys.Lstat(homePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "missing"
+		}
+		return "error"
+	}
+
+	dataInfo, err := fsys.Stat(dataPath)
+	if err != nil {
+		return "no data"
+	}
+
+	// A symlink whose target is gone would otherwise look missing
+	isLink := homeInfo.Mode()&fs.ModeSymlink != 0
+	if isLink {
+		homeInfo, err = fsys.Stat(homePath)
+		if err != nil {
+			return "broken"
+		}
+	}
+
+	if !dotmanfs.SameFile(homeInfo, dataInfo) {
+		// A symlink pointing somewhere else was hijacked, anything else
+		// replaced the symlink
+		if isLink {
+			return "hijacked"
+		}
+		return "replaced"
+	}
+
+	return "linked"
+}
+
+func (m uiModel) itemCount() int {
+	switch m.pane {
+	case uiPaneTracked:
+		return len(m.data.tracked)
+	case uiPaneJournal:
+		if m.detail != nil {
+			return len(m.detail.Steps)
+		}
+		return len(m.data.entries)
+	default:
+		return len(m.data.status)
+	}
+}
+
+func (m uiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case uiDataMsg:
+		if msg.err != nil {
+			m.message = uiErrorStyle.Render(msg.err.Error())
+			return m, nil
+		}
+		m.data = msg.data
+		m.detail = nil
+		for i := range m.cursors {
+			m.cursors[i] = 0
+		}
+		return m, nil
+
+	case uiActionDoneMsg:
+		if msg.err != nil {
+			m.message = uiErrorStyle.Render(fmt.Sprintf("%s failed: %v", msg.action, msg.err))
+		} else {
+			m.message = fmt.Sprintf("%s completed", msg.action)
+		}
+		return m, m.load()
+
+	case tea.KeyMsg:
+		if m.committing {
+			return m.updateCommitInput(msg)
+		}
+		return m.updateKeys(msg)
+	}
+
+	return m, nil
+}
+
+func (m uiModel) updateCommitInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.committing = false
+		m.input.Blur()
+		return m, nil
+	case "enter":
+		message := strings.TrimSpace(m.input.Value())
+		m.committing = false
+		m.input.Blur()
+		m.input.SetValue("")
+		if message == "" {
+			m.message = uiErrorStyle.Render("commit message is required")
+			return m, nil
+		}
+		op := &commitOperation{
+			message: message,
+			fsys:    m.fsys,
+			ctx:     context.Background(),
+			config:  m.config,
+			storage: newGitStorage(m.fsys, m.config.DotmanDir),
+		}
+		return m, runUIAction("commit", op.run)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m uiModel) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "tab", "right", "l":
+		m.pane = (m.pane + 1) % 3
+		m.detail = nil
+	case "shift+tab", "left", "h":
+		m.pane = (m.pane + 2) % 3
+		m.detail = nil
+	case "1", "2", "3":
+		m.pane = uiPane(msg.String()[0] - '1')
+		m.detail = nil
+	case "up", "k":
+		if m.cursors[m.pane] > 0 {
+			m.cursors[m.pane]--
+		}
+	case "down", "j":
+		if m.cursors[m.pane] < m.itemCount()-1 {
+			m.cursors[m.pane]++
+		}
+	case "enter":
+		if m.pane == uiPaneJournal && m.detail == nil && len(m.data.entries) > 0 {
+			m.detail = m.data.entries[m.cursors[m.pane]]
+		}
+	case "esc", "backspace":
+		if m.detail != nil {
+			for i, entry := range m.data.entries {
+				if entry == m.detail {
+					m.cursors[m.pane] = i
+				}
+			}
+			m.detail = nil
+		}
+	case "g":
+		m.message = ""
+		return m, m.load()
+	case "r":
+		op := &linkOperation{
+			fsys:   m.fsys,
+			ctx:    context.Background(),
+			config: m.config,
+		}
+		return m, runUIAction("relink", op.run)
+	case "c":
+		m.committing = true
+		m.message = ""
+		return m, m.input.Focus()
+	}
+
+	return m, nil
+}
+
+// uiActionExec runs an operation while the UI has released the terminal, so
+// that the operation's own output is visible to the user
+type uiActionExec struct {
+	run    func() error
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (e *uiActionExec) SetStdin(r io.Reader)  { e.stdin = r }
+func (e *uiActionExec) SetStdout(w io.Writer) { e.stdout = w }
+func (e *uiActionExec) SetStderr(io.Writer)   {}
+
+func (e *uiActionExec) Run() error {
+	err := e.run()
+	if err != nil {
+		fmt.Fprintf(e.stdout, "Error: %v\n", err)
+	}
+	fmt.Fprint(e.stdout, "\nPress enter to return to dotman ui")
+	bufio.NewReader(e.stdin).ReadString('\n')
+	return err
+}
+
+func runUIAction(action string, run func() error) tea.Cmd {
+	return tea.Exec(&uiActionExec{run: run, stdin: os.Stdin, stdout: terminalOutput()}, func(err error) tea.Msg {
+		return uiActionDoneMsg{action: action, err: err}
+	})
+}
+
+func (m uiModel) View() string {
+	var b strings.Builder
+
+	// Tabs
+	tabs := make([]string, len(uiPaneTitles))
+	for i, title := range uiPaneTitles {
+		label := fmt.Sprintf("%d %s", i+1, title)
+		if uiPane(i) == m.pane {
+			tabs[i] = uiActiveTabStyle.Render(label)
+		} else {
+			tabs[i] = uiTabStyle.Render(label)
+		}
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
+	b.WriteString("\n\n")
+
+	lines := m.paneLines()
+	if len(lines) == 0 {
+		b.WriteString(uiDimStyle.Render("  nothing to show"))
+		b.WriteString("\n")
+	}
+
+	// Keep the cursor visible by scrolling the pane
+	visible := m.height - 6
+	if visible < 1 {
+		visible = len(lines)
+	}
+	start := 0
+	if cursor := m.cursors[m.pane]; cursor >= visible {
+		start = cursor - visible + 1
+	}
+	for i := start; i < len(lines) && i < start+visible; i++ {
+		if i == m.cursors[m.pane] {
+			b.WriteString(uiCursorStyle.Render("> " + lines[i]))
+		} else {
+			b.WriteString("  " + lines[i])
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	if m.committing {
+		b.WriteString("Commit: " + m.input.View())
+	} else if m.message != "" {
+		b.WriteString(m.message)
+	} else {
+		b.WriteString(uiDimStyle.Render("tab switch pane • ↑/↓ move • enter steps • esc back • r relink • c commit • g refresh • q quit"))
+	}
+
+	return b.String()
+}
+
+func (m uiModel) paneLines() []string {
+	var lines []string
+
+	switch m.pane {
+	case uiPaneTracked:
+		for _, item := range m.data.tracked {
+			lines = append(lines, fmt.Sprintf("%-9s %-9s %s", item.state, item.entry.Type, item.entry.Path))
+		}
+	case uiPaneJournal:
+		if m.detail != nil {
+			for _, step := range m.detail.Steps {
+				line := fmt.Sprintf("%-9s %-9s %s", step.Status, step.Type, step.Description)
+				if step.Error != "" {
+					line += uiErrorStyle.Render(" — " + step.Error)
+				} else if step.Details != "" {
+					line += uiDimStyle.Render(" — " + step.Details)
+				}
+				lines = append(lines, line)
+			}
+			break
+		}
+		for _, entry := range m.data.entries {
+			lines = append(lines, fmt.Sprintf("%s  %-9s %-9s %s", entry.Timestamp.Format(time.DateTime), entry.State, entry.Operation, entry.Target))
+		}
+	case uiPaneStatus:
+		for _, item := range m.data.status {
+			lines = append(lines, fmt.Sprintf("%s %s", item.code, item.path))
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestLoadUIData(t *testing.T) {
+	// Create mock filesystem with dotman structure
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, ".manfile", `{"entries":[{"path":".zshrc","type":"file"},{"path":".vimrc","type":"file"}]}`)
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.zshrc", "zsh")
+	testutil.CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, "data/.vimrc", "vim")
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.zshrc"), filepath.Join(testutil.TestHomeDir, ".zshrc")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	jm := testutil.SetupJournalManager(t, fsys, dotmanDir)
+	if _, err := jm.CreateEntry(journal.OperationTypeAdd, "", ".zshrc"); err != nil {
+		t.Fatalf("failed to create journal entry: %v", err)
+	}
+
+	data, err := loadUIData(cfg, fsys)
+	if err != nil {
+		t.Fatalf("loadUIData() returned error: %v", err)
+	}
+
+	states := map[string]string{}
+	for _, item := range data.tracked {
+		states[item.entry.Path] = item.state
+	}
+	if states[".zshrc"] != "linked" {
+		t.Fatalf("expected .zshrc to be linked, got '%s'", states[".zshrc"])
+	}
+	if states[".vimrc"] != "missing" {
+		t.Fatalf("expected .vimrc to be missing, got '%s'", states[".vimrc"])
+	}
+
+	if len(data.entries) != 1 {
+		t.Fatalf("expected 1 journal entry, got %d", len(data.entries))
+	}
+
+	codes := map[string]string{}
+	for _, item := range data.status {
+		codes[item.path] = item.code
+	}
+	if codes["data/.zshrc"] != "A " {
+		t.Fatalf("expected data/.zshrc to be staged, got '%s'", codes["data/.zshrc"])
+	}
+
+	// Drill down into the journal entry and back
+	m := newUIModel(cfg, fsys)
+	m.data = data
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("2")})
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if model.(uiModel).detail != data.entries[0] {
+		t.Fatal("expected enter to open the selected journal entry")
+	}
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if model.(uiModel).detail != nil {
+		t.Fatal("expected esc to close the journal entry")
+	}
+}
+
+func TestLinkState(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	dataPath := filepath.Join(dotmanDir, "data/.zshrc")
+	if err := fsys.WriteFile(dataPath, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	homePath := filepath.Join(testutil.TestHomeDir, ".zshrc")
+	if state := linkState(fsys, homePath, dataPath); state != "missing" {
+		t.Fatalf("expected missing, got %s", state)
+	}
+
+	// A dangling symlink is reported as broken rather than missing
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/gone"), homePath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if state := linkState(fsys, homePath, dataPath); state != "broken" {
+		t.Fatalf("expected broken, got %s", state)
+	}
+
+	if err := fsys.Remove(homePath); err != nil {
+		t.Fatalf("failed to remove symlink: %v", err)
+	}
+	if err := fsys.WriteFile(homePath, []byte("local"), 0644); err != nil {
+		t.Fatalf("failed to write home file: %v", err)
+	}
+	if state := linkState(fsys, homePath, dataPath); state != "replaced" {
+		t.Fatalf("expected replaced, got %s", state)
+	}
+
+	// A symlink to another file was hijacked
+	otherPath := filepath.Join(testutil.TestHomeDir, ".zshrc.local")
+	if err := fsys.Rename(homePath, otherPath); err != nil {
+		t.Fatalf("failed to move home file: %v", err)
+	}
+	if err := fsys.Symlink(otherPath, homePath); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if state := linkState(fsys, homePath, dataPath); state != "hijacked" {
+		t.Fatalf("expected hijacked, got %s", state)
+	}
+}
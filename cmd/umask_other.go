@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package cmd
+
+// privateUmask is a no-op where there is no umask, permissions are set
+// after the fact
+func privateUmask() (restore func()) {
+	return func() {}
+}
@@ -0,0 +1,12 @@
+//go:build linux || darwin || freebsd
+
+package cmd
+
+import "syscall"
+
+// privateUmask makes files created until restore is called accessible to the
+// current user only
+func privateUmask() (restore func()) {
+	old := syscall.Umask(0177)
+	return func() { syscall.Umask(old) }
+}
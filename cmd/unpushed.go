@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+)
+
+// unpushedReport describes the commits origin does not have yet
+type unpushedReport struct {
+	Commits int `json:"commits"`
+	// Since is when the oldest of them was committed
+	Since time.Time `json:"since"`
+	// LastPush is when the journal last recorded a push that reached the
+	// remote, nil when it never did
+	LastPush *time.Time `json:"last_push,omitempty"`
+	// Overdue is set once they are older than push_reminder
+	Overdue bool `json:"overdue"`
+}
+
+// unpushedCommits reports the commits of the checked out branch that are not
+// on its remote-tracking branch, all of them when it was never pushed. It
+// returns nil when there is no origin to push to or nothing to push.
+func unpushedCommits(fsys dotmanfs.FileSystem, cfg *config.Config, repo *git.Repository) (*unpushedReport, error) {
+	if _, err := repo.Remote("origin"); err != nil {
+		return nil, nil
+	}
+	head, err := repo.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return nil, nil
+	}
+
+	pushed := map[plumbing.Hash]bool{}
+	upstream, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+	if err == nil {
+		if pushed, err = ancestors(repo, upstream.Hash()); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, fmt.Errorf("error reading remote-tracking branch: %w", err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	report := &unpushedReport{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if pushed[c.Hash] {
+			return nil
+		}
+		report.Commits++
+		if report.Since.IsZero() || c.Committer.When.Before(report.Since) {
+			report.Since = c.Committer.When
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	if report.Commits == 0 {
+		return nil, nil
+	}
+
+	if report.LastPush, err = lastPush(fsys, cfg); err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+
+	age, err := cfg.PushReminderAge()
+	if err != nil {
+		return nil, err
+	}
+	report.Overdue = age > 0 && time.Since(report.Since) > age
+	return report, nil
+}
+
+// lastPush returns when the journal last recorded a push that reached the
+// remote. A push queued because the remote could not be reached completes
+// too, with its push step failed, and does not count.
+func lastPush(fsys dotmanfs.FileSystem, cfg *config.Config) (*time.Time, error) {
+	jm := newJournalManager(fsys, cfg, cfg.DotmanDir)
+	records, err := jm.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, record := range records {
+		if record.Operation == journal.OperationTypePush && record.State == journal.EntryStateCompleted {
+			ids = append(ids, record.ID)
+		}
+	}
+	entries, err := jm.GetEntries(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *time.Time
+	for _, entry := range entries {
+		queued := slices.ContainsFunc(entry.Steps, func(step journal.Step) bool {
+			return step.Status == journal.StepStatusFailed
+		})
+		if !queued && (last == nil || entry.Timestamp.After(*last)) {
+			timestamp := entry.Timestamp
+			last = &timestamp
+		}
+	}
+	return last, nil
+}
+
+// printUnpushed nags about commits left unpushed for longer than
+// push_reminder, keeping machines in sync is what dotman is for
+func printUnpushed(unpushed *unpushedReport) {
+	if unpushed == nil || !unpushed.Overdue {
+		return
+	}
+
+	noun := "commit"
+	if unpushed.Commits > 1 {
+		noun = "commits"
+	}
+	fmt.Printf("WARNING: %d %s not pushed in %s\n", unpushed.Commits, noun, formatAge(time.Since(unpushed.Since)))
+	if unpushed.LastPush != nil {
+		fmt.Printf("  last push %s\n", unpushed.LastPush.Format(time.RFC3339))
+	} else {
+		fmt.Println("  never pushed from this machine")
+	}
+	fmt.Println("Run `dotman push` to share them with your other machines.")
+	fmt.Println()
+}
+
+// formatAge returns a rough, human readable length of time
+func formatAge(d time.Duration) string {
+	switch days := int(d / (24 * time.Hour)); {
+	case days > 1:
+		return fmt.Sprintf("%d days", days)
+	case days == 1:
+		return "1 day"
+	}
+	if hours := int(d / time.Hour); hours != 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return "1 hour"
+}
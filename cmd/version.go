@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/noosxe/dotman/internal/release"
+	"github.com/noosxe/dotman/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var checkUpdate bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and build information",
+	Long: `Print the version, commit, build date and Go version of this dotman binary.
+With --check-update, the latest GitHub release is looked up and reported if it
+is newer than the running version.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := version.Get()
+
+		fmt.Printf("dotman %s\n", info.Version)
+		fmt.Printf("Commit: %s\n", info.Commit)
+		fmt.Printf("Built: %s\n", info.Date)
+		fmt.Printf("Go version: %s\n", info.GoVersion)
+
+		if !checkUpdate {
+			return nil
+		}
+
+		latest, err := release.NewClient().Latest(context.Background(), false)
+		if err != nil {
+			return fmt.Errorf("failed to check for updates: %w", err)
+		}
+
+		if release.Newer(info.Version, latest.TagName) {
+			fmt.Printf("\nA newer version is available: %s\n", latest.TagName)
+			if latest.HTMLURL != "" {
+				fmt.Printf("Release notes: %s\n", latest.HTMLURL)
+			}
+		} else {
+			fmt.Printf("\nLatest release is %s\n", latest.TagName)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().BoolVar(&checkUpdate, "check-update", false, "check GitHub releases for a newer version")
+}
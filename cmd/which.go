@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/noosxe/dotman/internal/config"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var whichCmd = &cobra.Command{
+	Use:   "which <path>",
+	Short: "Show which tracked entry a path belongs to",
+	Long: `Show whether a path in the home directory, or a system path, is tracked and
+by which entry: the entry itself or a directory entry it lies in. For a
+tracked path the copy in the repository, the package, the tags and note set
+with annotate, the link state, the journal entry that added or moved it and
+the last commit that changed the copy are shown.
+
+Untracked paths make which exit with 1, like which(1) does.`,
+	Example: `  dotman which ~/.zshrc
+  dotman which ~/.config/nvim/lua/plugins.lua`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(configPath, fsys)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		path, err := dotmanfs.AbsHome(fsys, aliasPath(args[0]))
+		if err != nil {
+			return fmt.Errorf("error getting absolute path: %w", err)
+		}
+
+		found, err := findTracked(fsys, cfg, filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			fmt.Printf("%s is not tracked\n", path)
+			return exitWith(cmd, exitError)
+		}
+
+		printTracked(found)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whichCmd)
+}
+
+// trackedPath is what which reports about a tracked path
+type trackedPath struct {
+	// Path is the path asked about
+	Path  string
+	Entry manifest.Entry
+	// Inside is Path relative to a directory entry containing it, empty
+	// when Path is the entry itself
+	Inside string
+	// Repo is the profile whose repository tracks the entry, set when
+	// there is more than one to look in
+	Repo string
+	// DataPath is the copy of Path in the repository
+	DataPath string
+	// Copied is false when DataPath does not exist, e.g. for junk left out
+	// of a directory entry
+	Copied    bool
+	LinkState string
+	// Added is the journal record of the operation that added or last moved
+	// the entry, nil when the journal has none
+	Added *journal.IndexRecord
+	// Commit is the last commit changing the copy, nil when none did
+	Commit *object.Commit
+}
+
+// findTracked returns what tracks path in the repositories list shows, nil
+// when nothing does
+func findTracked(fsys dotmanfs.FileSystem, cfg *config.Config, path string) (*trackedPath, error) {
+	homeDir, err := fsys.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	repos, err := listedRepos(cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newEntryFilter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries record home paths relative to the home directory
+	relPath := path
+	if isWithin(homeDir, path) {
+		if relPath, err = filepath.Rel(homeDir, path); err != nil {
+			return nil, fmt.Errorf("error getting relative path: %w", err)
+		}
+	}
+
+	for _, r := range repos {
+		dotmanDir := r.config.DotmanDir
+		m, err := manifest.Load(fsys, dotmanDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load manifest: %w", err)
+		}
+
+		// The entry itself, or the innermost directory entry holding the
+		// path. Paths of a partially tracked directory outside its include
+		// list are not tracked.
+		entry, ok := m.Find(relPath)
+		if !ok {
+			entry, ok = m.FindParent(relPath)
+		}
+		if !ok {
+			continue
+		}
+
+		b, err := newBackend(fsys, dotmanDir, m, r.config.Perm())
+		if err != nil {
+			return nil, err
+		}
+		l := newLinker(fsys, r.config, m)
+
+		target := entry.TargetPath(homeDir)
+		rel, _ := filepath.Rel(target, path)
+		if rel == "." {
+			rel = ""
+		}
+		repoPath := m.Layout.RepoPath(dotmanDir, *entry)
+		if m.InPlace() {
+			repoPath = target
+		}
+
+		found := &trackedPath{
+			Path:      path,
+			Entry:     *entry,
+			Inside:    rel,
+			DataPath:  filepath.Join(repoPath, rel),
+			LinkState: "other host",
+		}
+		if len(repos) > 1 {
+			found.Repo = r.name
+		}
+		if _, err := fsys.Lstat(found.DataPath); err == nil {
+			found.Copied = true
+		}
+		if m.AppliesToHost(*entry, filter.hostname) {
+			found.LinkState = entryState(fsys, l, dotmanDir, m, *entry, homeDir)
+		}
+		if found.Added, err = addedRecord(fsys, r.config, *entry, repoPath); err != nil {
+			return nil, err
+		}
+		if found.Commit, err = lastCommit(fsys, dotmanDir, b, b.gitPath(manifest.Entry{Path: filepath.Join(entry.Path, rel)})); err != nil {
+			return nil, err
+		}
+		return found, nil
+	}
+
+	return nil, nil
+}
+
+// addedRecord returns the last completed add or move whose target is entry,
+// or its copy at repoPath
+func addedRecord(fsys dotmanfs.FileSystem, cfg *config.Config, entry manifest.Entry, repoPath string) (*journal.IndexRecord, error) {
+	records, err := newJournalManager(fsys, cfg, cfg.DotmanDir).Index()
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+
+	// Entries added in one go with --interactive name the copy instead,
+	// recorded below ~ by newer versions
+	targets := []string{entry.Path, repoPath, dotmanfs.ContractHome(fsys, repoPath)}
+
+	var found *journal.IndexRecord
+	for i, record := range records {
+		if record.State != journal.EntryStateCompleted {
+			continue
+		}
+		if record.Operation != journal.OperationTypeAdd && record.Operation != journal.OperationTypeMove {
+			continue
+		}
+		if !slices.Contains(targets, record.Target) {
+			continue
+		}
+		if found == nil || record.Timestamp.After(found.Timestamp) {
+			found = &records[i]
+		}
+	}
+	return found, nil
+}
+
+// lastCommit returns the last commit of the repository in dotmanDir that
+// changed rel, a path as backend b stages it, or, for a directory, anything
+// below it
+func lastCommit(fsys dotmanfs.FileSystem, dotmanDir string, b backend, rel string) (*object.Commit, error) {
+	repo, err := openRepo(fsys, dotmanDir, b)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{
+		PathFilter: func(path string) bool {
+			return path == rel || strings.HasPrefix(path, rel+"/")
+		},
+	})
+	if err != nil {
+		// A repository without commits has no history to search
+		return nil, nil
+	}
+	defer iter.Close()
+
+	commit, err := iter.Next()
+	if err != nil {
+		return nil, nil
+	}
+	return commit, nil
+}
+
+// printTracked prints what which found
+func printTracked(found *trackedPath) {
+	fmt.Println(found.Path)
+	if found.Inside == "" {
+		fmt.Printf("  Entry:       %s (%s)\n", found.Entry.Path, found.Entry.Type)
+	} else {
+		fmt.Printf("  Entry:       %s (%s), which contains it\n", found.Entry.Path, found.Entry.Type)
+	}
+	if found.Repo != "" {
+		fmt.Printf("  Repository:  %s\n", found.Repo)
+	}
+	if found.Copied {
+		fmt.Printf("  Copy:        %s\n", found.DataPath)
+	} else {
+		fmt.Printf("  Copy:        %s, which does not exist\n", found.DataPath)
+	}
+	pkg := found.Entry.Package
+	if pkg == "" {
+		pkg = "-"
+	}
+	fmt.Printf("  Package:     %s\n", pkg)
+	if len(found.Entry.Tags) > 0 {
+		fmt.Printf("  Tags:        %s\n", strings.Join(found.Entry.Tags, ", "))
+	}
+	if found.Entry.Note != "" {
+		fmt.Printf("  Note:        %s\n", found.Entry.Note)
+	}
+	fmt.Printf("  Link:        %s\n", found.LinkState)
+
+	added := "unknown"
+	if !found.Entry.AddedAt.IsZero() {
+		added = found.Entry.AddedAt.Format(time.RFC3339)
+	}
+	if found.Added != nil {
+		added += fmt.Sprintf(" (journal %s, %s)", found.Added.ID, found.Added.Operation)
+	}
+	fmt.Printf("  Added:       %s\n", added)
+
+	if found.Commit == nil {
+		fmt.Println("  Last commit: none, the copy is not committed")
+		return
+	}
+	subject, _, _ := strings.Cut(found.Commit.Message, "\n")
+	fmt.Printf("  Last commit: %s %s %s\n", found.Commit.Hash.String()[:7], found.Commit.Author.When.Format(time.RFC3339), subject)
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/journal"
+	"github.com/noosxe/dotman/internal/testutil"
+)
+
+func TestFindTracked(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	_, worktree, _ := testutil.SetupTestGitRepo(t, fsys, dotmanDir)
+
+	manfile := `{"entries":[{"path":".zshrc","type":"file"},{"path":".config/nvim","type":"directory","package":"editor"}]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	testutil.CreateTestFileAndCommit(t, fsys, worktree, dotmanDir, "data/.config/nvim/init.lua", "nvim")
+	if err := fsys.MkdirAll(filepath.Join(testutil.TestHomeDir, ".config"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := fsys.Symlink(filepath.Join(dotmanDir, "data/.config/nvim"), filepath.Join(testutil.TestHomeDir, ".config/nvim")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	jm := newJournalManager(fsys, cfg, dotmanDir)
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	entry, err := jm.CreateEntry(journal.OperationTypeAdd, filepath.Join(testutil.TestHomeDir, ".config/nvim"), ".config/nvim")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if err := jm.MoveEntry(entry, journal.EntryStateCompleted); err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+
+	// A file inside a directory entry
+	found, err := findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, ".config/nvim/init.lua"))
+	if err != nil {
+		t.Fatalf("findTracked failed: %v", err)
+	}
+	if found == nil {
+		t.Fatal("expected init.lua to be tracked")
+	}
+	if found.Entry.Path != ".config/nvim" || found.Inside != "init.lua" || found.Entry.Package != "editor" {
+		t.Errorf("unexpected entry %+v", found)
+	}
+	if found.DataPath != filepath.Join(dotmanDir, "data/.config/nvim/init.lua") || !found.Copied {
+		t.Errorf("unexpected copy %s (copied %v)", found.DataPath, found.Copied)
+	}
+	if found.LinkState != "linked" {
+		t.Errorf("expected a linked entry, got %s", found.LinkState)
+	}
+	if found.Added == nil || found.Added.ID != entry.ID {
+		t.Errorf("expected the add to be found in the journal, got %+v", found.Added)
+	}
+	if found.Commit == nil || found.Commit.Message != "test commit" {
+		t.Errorf("expected the last commit, got %v", found.Commit)
+	}
+
+	// A tracked file never copied or committed
+	found, err = findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, ".zshrc"))
+	if err != nil || found == nil {
+		t.Fatalf("expected .zshrc to be tracked, got %v (%v)", found, err)
+	}
+	if found.Inside != "" || found.Copied || found.Commit != nil || found.Added != nil || found.LinkState != "missing" {
+		t.Errorf("unexpected result for .zshrc %+v", found)
+	}
+
+	// Paths next to tracked ones are not tracked
+	for _, path := range []string{".config", ".config/nvim-old", ".bashrc"} {
+		if found, err := findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, path)); err != nil || found != nil {
+			t.Errorf("expected %s to be untracked, got %+v (%v)", path, found, err)
+		}
+	}
+}
+
+func TestFindTracked_Include(t *testing.T) {
+	fsys, dotmanDir, err := testutil.NewMemFSWithDotman()
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer fsys.CleanUp()
+
+	cfg := testutil.SetupTestConfig(t, fsys, dotmanDir)
+	manfile := `{"entries":[
+		{"path":".config","type":"directory"},
+		{"path":".config/nvim","type":"directory","package":"editor"},
+		{"path":".local/fish","type":"directory","package":"shell","include":["functions","config.fish"]}
+	]}`
+	if err := fsys.WriteFile(filepath.Join(dotmanDir, ".manfile"), []byte(manfile), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	// Nested entries attribute a path to the innermost one, whatever the
+	// manifest order
+	found, err := findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, ".config/nvim/init.lua"))
+	if err != nil || found == nil {
+		t.Fatalf("expected init.lua to be tracked, got %v (%v)", found, err)
+	}
+	if found.Entry.Path != ".config/nvim" || found.Inside != "init.lua" {
+		t.Errorf("expected init.lua to be tracked by .config/nvim, got %s", found.Entry.Path)
+	}
+
+	// Included paths and what lies below them are tracked
+	for _, path := range []string{".local/fish/config.fish", ".local/fish/functions/ll.fish"} {
+		found, err := findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, path))
+		if err != nil || found == nil {
+			t.Fatalf("expected %s to be tracked, got %v (%v)", path, found, err)
+		}
+		if found.Entry.Path != ".local/fish" || found.Entry.Package != "shell" {
+			t.Errorf("expected %s to be tracked by .local/fish, got %s", path, found.Entry.Path)
+		}
+	}
+
+	// Unmanaged siblings of the included paths are left out
+	for _, path := range []string{".local/fish/cache/x", ".local/fish/fish_variables"} {
+		if found, err := findTracked(fsys, cfg, filepath.Join(testutil.TestHomeDir, path)); err != nil || found != nil {
+			t.Errorf("expected %s to be untracked, got %+v (%v)", path, found, err)
+		}
+	}
+}
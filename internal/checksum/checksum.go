@@ -0,0 +1,181 @@
+// Package checksum keeps an on-disk cache of the SHA-256 of tracked files,
+// keyed by path and validated by size and modification time, so checking
+// tracked copies for drift only hashes the files whose stat changed.
+package checksum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/store"
+)
+
+// cacheFile is the name of the cache inside the .git directory, where it is
+// never part of the worktree
+const cacheFile = "dotman-checksums.json"
+
+// Path returns the location of the cache of the dotman directory
+func Path(dotmanDir string) string {
+	return filepath.Join(dotmanDir, ".git", cacheFile)
+}
+
+// Record is the cached checksum of a file
+type Record struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+	// Hashed is when the file was hashed. A file modified shortly before
+	// could have changed again without its modification time changing, so
+	// its record is not trusted until the file is hashed again later.
+	Hashed time.Time `json:"hashed"`
+}
+
+// trusted reports whether the record still describes a file with info
+func (r Record) trusted(info os.FileInfo) bool {
+	return r.Size == info.Size() &&
+		r.ModTime.Equal(info.ModTime()) &&
+		info.ModTime().Before(r.Hashed.Add(-time.Second))
+}
+
+// Cache maps files below the dotman directory to their checksums
+type Cache struct {
+	fsys      dotmanfs.FileSystem
+	dotmanDir string
+	records   map[string]Record
+	changed   bool
+}
+
+// Load reads the cache of the dotman directory. A missing or unreadable cache
+// loads empty, every file is then hashed once.
+func Load(fsys dotmanfs.FileSystem, dotmanDir string) (*Cache, error) {
+	c := &Cache{fsys: fsys, dotmanDir: dotmanDir, records: make(map[string]Record)}
+
+	data, err := fsys.ReadFile(Path(dotmanDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("error reading checksum cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.records); err != nil {
+		c.records = make(map[string]Record)
+	}
+	return c, nil
+}
+
+// Save writes the cache if it changed since it was loaded. A dotman
+// directory that is not a git repository yet has nowhere to keep it.
+func (c *Cache) Save() error {
+	if !c.changed {
+		return nil
+	}
+	if _, err := c.fsys.Stat(filepath.Dir(Path(c.dotmanDir))); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := json.Marshal(c.records)
+	if err != nil {
+		return fmt.Errorf("error encoding checksum cache: %w", err)
+	}
+	if err := c.fsys.WriteFile(Path(c.dotmanDir), data, 0644); err != nil {
+		// A read-only dotman directory only costs hashing again next time
+		if dotmanfs.IsReadOnly(err) {
+			return nil
+		}
+		return fmt.Errorf("error writing checksum cache: %w", err)
+	}
+	c.changed = false
+	return nil
+}
+
+// key returns the cache key of path, relative to the dotman directory so the
+// cache survives the directory being moved
+func (c *Cache) key(path string) string {
+	if rel, err := filepath.Rel(c.dotmanDir, path); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// Sum returns the SHA-256 of the file at path, hashing it only when its size
+// or modification time no longer match the cache
+func (c *Cache) Sum(path string) (string, error) {
+	info, err := c.fsys.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if record, ok := c.records[c.key(path)]; ok && record.trusted(info) {
+		return record.SHA256, nil
+	}
+	return c.update(path, info)
+}
+
+// Update hashes the file at path and records its checksum
+func (c *Cache) Update(path string) (string, error) {
+	info, err := c.fsys.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return c.update(path, info)
+}
+
+func (c *Cache) update(path string, info os.FileInfo) (string, error) {
+	hashed := time.Now()
+	sum, err := store.Hash(c.fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error hashing %s: %w", path, err)
+	}
+	c.records[c.key(path)] = Record{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum, Hashed: hashed}
+	c.changed = true
+	return sum, nil
+}
+
+// UpdateTree records the checksum of every file at or below root. Symlinks
+// are followed to the file they point at, like those of deduplicated copies
+// pointing into the store.
+func (c *Cache) UpdateTree(root string) (int, error) {
+	updated := 0
+	err := c.fsys.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := c.fsys.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			// Dangling links and special files have no content to hash
+			return nil
+		}
+		if _, err := c.update(path, info); err != nil {
+			return err
+		}
+		updated++
+		return nil
+	})
+	return updated, err
+}
+
+// Prune drops the records of files that no longer exist and returns the
+// number dropped
+func (c *Cache) Prune() int {
+	dropped := 0
+	for key := range c.records {
+		path := key
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.dotmanDir, filepath.FromSlash(key))
+		}
+		if _, err := c.fsys.Stat(path); os.IsNotExist(err) {
+			delete(c.records, key)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		c.changed = true
+	}
+	return dropped
+}
@@ -0,0 +1,71 @@
+package checksum
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestCache(t *testing.T) {
+	fsys, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	dotmanDir := "dotman"
+	if err := fsys.MkdirAll(filepath.Join(dotmanDir, ".git"), 0755); err != nil {
+		t.Fatalf("failed to create .git: %v", err)
+	}
+	path := filepath.Join(dotmanDir, "data", ".zshrc")
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	if err := fsys.WriteFile(path, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cache, err := Load(fsys, dotmanDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if n, err := cache.UpdateTree(filepath.Join(dotmanDir, "data")); err != nil || n != 1 {
+		t.Fatalf("expected 1 file to be hashed, got %d, %v", n, err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A record hashed well after the last write is trusted without hashing
+	cache, err = Load(fsys, dotmanDir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	record := cache.records["data/.zshrc"]
+	record.Hashed = record.Hashed.Add(time.Minute)
+	record.SHA256 = "cached"
+	cache.records["data/.zshrc"] = record
+	if sum, err := cache.Sum(path); err != nil || sum != "cached" {
+		t.Fatalf("expected the cached checksum, got %q, %v", sum, err)
+	}
+
+	// A file whose size changed is hashed again
+	if err := fsys.WriteFile(path, []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	sum, err := cache.Sum(path)
+	if err != nil {
+		t.Fatalf("Sum failed: %v", err)
+	}
+	if sum == "cached" || len(sum) != 64 {
+		t.Fatalf("expected a fresh checksum, got %q", sum)
+	}
+
+	// The record of a removed file is dropped
+	if err := fsys.Remove(path); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if n := cache.Prune(); n != 1 || len(cache.records) != 0 {
+		t.Errorf("expected 1 record to be dropped, got %d and %v", n, cache.records)
+	}
+}
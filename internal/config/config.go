@@ -1,7 +1,6 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,9 +10,94 @@ import (
 
 // Config represents the dotman configuration
 type Config struct {
-	DotmanDir string `json:"dotman_dir"`
+	DotmanDir       string             `json:"dotman_dir" toml:"dotman_dir" yaml:"dotman_dir"`
+	AutoPush        bool               `json:"auto_push,omitempty" toml:"auto_push,omitempty" yaml:"auto_push,omitempty"`
+	Dedup           bool               `json:"dedup,omitempty" toml:"dedup,omitempty" yaml:"dedup,omitempty"`
+	MaxFileSize     string             `json:"max_file_size,omitempty" toml:"max_file_size,omitempty" yaml:"max_file_size,omitempty"`
+	OffloadSize     string             `json:"offload_size,omitempty" toml:"offload_size,omitempty" yaml:"offload_size,omitempty"`
+	OffloadStore    string             `json:"offload_store,omitempty" toml:"offload_store,omitempty" yaml:"offload_store,omitempty"`
+	Exclude         []string           `json:"exclude,omitempty" toml:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Hooks           []string           `json:"hooks,omitempty" toml:"hooks,omitempty" yaml:"hooks,omitempty"`
+	HookTimeout     string             `json:"hook_timeout,omitempty" toml:"hook_timeout,omitempty" yaml:"hook_timeout,omitempty"`
+	HookDir         string             `json:"hook_dir,omitempty" toml:"hook_dir,omitempty" yaml:"hook_dir,omitempty"`
+	HookEnv         []string           `json:"hook_env,omitempty" toml:"hook_env,omitempty" yaml:"hook_env,omitempty"`
+	Trash           bool               `json:"trash,omitempty" toml:"trash,omitempty" yaml:"trash,omitempty"`
+	Notify          string             `json:"notify,omitempty" toml:"notify,omitempty" yaml:"notify,omitempty"`
+	LineEndings     string             `json:"line_endings,omitempty" toml:"line_endings,omitempty" yaml:"line_endings,omitempty"`
+	LinkMode        string             `json:"link_mode,omitempty" toml:"link_mode,omitempty" yaml:"link_mode,omitempty"`
+	DirMode         string             `json:"dir_mode,omitempty" toml:"dir_mode,omitempty" yaml:"dir_mode,omitempty"`
+	FileMode        string             `json:"file_mode,omitempty" toml:"file_mode,omitempty" yaml:"file_mode,omitempty"`
+	JournalChain    bool               `json:"journal_chain,omitempty" toml:"journal_chain,omitempty" yaml:"journal_chain,omitempty"`
+	Fsync           string             `json:"fsync,omitempty" toml:"fsync,omitempty" yaml:"fsync,omitempty"`
+	NetworkRetries  string             `json:"network_retries,omitempty" toml:"network_retries,omitempty" yaml:"network_retries,omitempty"`
+	RetryBackoff    string             `json:"retry_backoff,omitempty" toml:"retry_backoff,omitempty" yaml:"retry_backoff,omitempty"`
+	OfflineQueue    bool               `json:"offline_queue,omitempty" toml:"offline_queue,omitempty" yaml:"offline_queue,omitempty"`
+	PushReminder    string             `json:"push_reminder,omitempty" toml:"push_reminder,omitempty" yaml:"push_reminder,omitempty"`
+	VerifyPush      bool               `json:"verify_before_push,omitempty" toml:"verify_before_push,omitempty" yaml:"verify_before_push,omitempty"`
+	GitUserName     string             `json:"git_user_name,omitempty" toml:"git_user_name,omitempty" yaml:"git_user_name,omitempty"`
+	GitUserEmail    string             `json:"git_user_email,omitempty" toml:"git_user_email,omitempty" yaml:"git_user_email,omitempty"`
+	MergeTool       string             `json:"merge_tool,omitempty" toml:"merge_tool,omitempty" yaml:"merge_tool,omitempty"`
+	PullStrategy    string             `json:"pull_strategy,omitempty" toml:"pull_strategy,omitempty" yaml:"pull_strategy,omitempty"`
+	FollowRelease   string             `json:"follow_release,omitempty" toml:"follow_release,omitempty" yaml:"follow_release,omitempty"`
+	AllowedSigners  string             `json:"allowed_signers,omitempty" toml:"allowed_signers,omitempty" yaml:"allowed_signers,omitempty"`
+	JournalDir      string             `json:"journal_dir,omitempty" toml:"journal_dir,omitempty" yaml:"journal_dir,omitempty"`
+	BackupDir       string             `json:"backup_dir,omitempty" toml:"backup_dir,omitempty" yaml:"backup_dir,omitempty"`
+	BackupRetention string             `json:"backup_retention,omitempty" toml:"backup_retention,omitempty" yaml:"backup_retention,omitempty"`
+	ActiveProfile   string             `json:"active_profile,omitempty" toml:"active_profile,omitempty" yaml:"active_profile,omitempty"`
+	Profiles        map[string]Profile `json:"profiles,omitempty" toml:"profiles,omitempty" yaml:"profiles,omitempty"`
+	SecretsProfile  string             `json:"secrets_profile,omitempty" toml:"secrets_profile,omitempty" yaml:"secrets_profile,omitempty"`
+
+	// defaultDir is DotmanDir before the active profile replaced it
+	defaultDir string
 }
 
+// Values of the notify key
+const (
+	// NotifyFailures notifies when a background operation fails
+	NotifyFailures = "failures"
+	// NotifyAlways notifies when a background operation completes or fails
+	NotifyAlways = "always"
+)
+
+// Values of the link_mode key
+const (
+	// LinkSymlink links entries with symlinks to their copies. It is the
+	// default.
+	LinkSymlink = "symlink"
+	// LinkHardlink hard links the files of entries to their copies, which
+	// needs the home directory and the repository on one filesystem
+	LinkHardlink = "hardlink"
+	// LinkCopy copies entries into place, for filesystems without links
+	LinkCopy = "copy"
+	// LinkJunction links directories with junctions and hard links files,
+	// for Windows without the privilege to create symlinks
+	LinkJunction = "junction"
+)
+
+// Values of the fsync key
+const (
+	// FsyncOff never waits for journal writes to reach the disk
+	FsyncOff = "off"
+	// FsyncTransitions waits for the journal to reach the disk when an
+	// operation starts, completes or fails. It is the default.
+	FsyncTransitions = "transitions"
+	// FsyncAll also waits for every step the journal records
+	FsyncAll = "all"
+)
+
+// Values of the pull_strategy key
+const (
+	// PullMerge merges commits on the remote, with a merge commit when the
+	// histories diverged. It is the default.
+	PullMerge = "merge"
+	// PullFFOnly only fast-forwards, refusing to bring in commits on the
+	// remote while there are local commits not pushed
+	PullFFOnly = "ff-only"
+	// PullRebase replays local commits on top of the remote, keeping the
+	// history linear
+	PullRebase = "rebase"
+)
+
 // DefaultConfig returns the default configuration
 func DefaultConfig(fsys dotmanfs.FileSystem) *Config {
 	home, err := fsys.UserHomeDir()
@@ -25,16 +109,64 @@ func DefaultConfig(fsys dotmanfs.FileSystem) *Config {
 	}
 }
 
-// LoadConfig loads the configuration from the specified path
+// LoadConfig loads the configuration from the specified path, creating a
+// default one if it does not exist, and applies environment overrides
 func LoadConfig(configPath string, fsys dotmanfs.FileSystem) (*Config, error) {
-	fmt.Printf("Loading config from: %s\n", configPath)
+	config, err := loadConfig(configPath, fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Resolve(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Resolve applies environment overrides and the active profile to a config
+// read from disk. The result reflects the effective settings and should not
+// be saved back.
+func Resolve(config *Config) error {
+	if err := ApplyEnv(config); err != nil {
+		return err
+	}
+
+	return config.applyProfile()
+}
+
+// DirPerm returns the widest permission of the directories dotman
+// materializes, by the dir_mode key
+func (c *Config) DirPerm() os.FileMode {
+	if mode, err := dotmanfs.ParsePerm(c.DirMode); err == nil {
+		return mode
+	}
+	return 0777
+}
+
+// FilePerm returns the widest permission of the files dotman materializes,
+// by the file_mode key
+func (c *Config) FilePerm() os.FileMode {
+	if mode, err := dotmanfs.ParsePerm(c.FileMode); err == nil {
+		return mode
+	}
+	return 0666
+}
+
+// Perm returns DirPerm and FilePerm for the filesystem helpers
+func (c *Config) Perm() dotmanfs.Perm {
+	return dotmanfs.Perm{Dir: c.DirPerm(), File: c.FilePerm()}
+}
+
+func loadConfig(configPath string, fsys dotmanfs.FileSystem) (*Config, error) {
+	fmt.Fprintf(os.Stderr, "Loading config from: %s\n", configPath)
 
 	// Check if config file exists
 	if _, err := fsys.Stat(configPath); err != nil {
 		if !os.IsNotExist(err) {
 			return nil, fmt.Errorf("error checking config file: %v", err)
 		}
-		fmt.Printf("Config file does not exist, creating default config\n")
+		fmt.Fprintf(os.Stderr, "Config file does not exist, creating default config\n")
 		// Create default config if it doesn't exist
 		config := DefaultConfig(fsys)
 		if err := SaveConfig(configPath, config, fsys); err != nil {
@@ -43,23 +175,30 @@ func LoadConfig(configPath string, fsys dotmanfs.FileSystem) (*Config, error) {
 		return config, nil
 	}
 
-	// Read and parse config file
+	return ReadConfig(configPath, fsys)
+}
+
+// ReadConfig reads and parses an existing configuration file without creating
+// a default one or printing anything
+func ReadConfig(configPath string, fsys dotmanfs.FileSystem) (*Config, error) {
 	data, err := fsys.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %v", err)
 	}
 
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := FormatForPath(configPath).unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
 	return &config, nil
 }
 
-// SaveConfig saves the configuration to the specified path
+// SaveConfig saves the configuration to the specified path in the format
+// matching its extension. Existing TOML and YAML files are updated in place,
+// keeping their comments and layout.
 func SaveConfig(configPath string, config *Config, fsys dotmanfs.FileSystem) error {
-	fmt.Printf("Saving config to: %s\n", configPath)
+	fmt.Fprintf(os.Stderr, "Saving config to: %s\n", configPath)
 
 	// Ensure the directory exists
 	dir := filepath.Dir(configPath)
@@ -67,7 +206,14 @@ func SaveConfig(configPath string, config *Config, fsys dotmanfs.FileSystem) err
 		return fmt.Errorf("error creating config directory: %v", err)
 	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	format := FormatForPath(configPath)
+
+	existing, err := fsys.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	data, err := format.marshal(config, existing)
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %v", err)
 	}
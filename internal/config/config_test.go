@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/noosxe/dotman/internal/fs"
 )
@@ -94,3 +95,405 @@ func TestSaveConfig(t *testing.T) {
 		t.Errorf("Expected saved DotmanDir to be %s, got %s", cfg.DotmanDir, savedConfig.DotmanDir)
 	}
 }
+
+func TestConfig_Effective(t *testing.T) {
+	cfg := &Config{DotmanDir: "/home/test/.dotman"}
+
+	// Unset keys show the default that applies, set keys their value
+	tests := map[string]string{
+		"link_mode":       LinkSymlink,
+		"max_file_size":   "100MB",
+		"hook_timeout":    "30s",
+		"network_retries": "2",
+		"retry_backoff":   "2s",
+		"pull_strategy":   PullMerge,
+		"offload_size":    "",
+	}
+	for name, want := range tests {
+		if value, err := cfg.Effective(name); err != nil || value != want {
+			t.Errorf("expected %s to be %q, got %q (%v)", name, want, value, err)
+		}
+	}
+
+	if err := cfg.Set("link_mode", LinkCopy); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, _ := cfg.Effective("link_mode"); value != LinkCopy {
+		t.Errorf("expected the set link_mode, got %q", value)
+	}
+	if _, err := cfg.Effective("unknown"); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestConfig_GetSet(t *testing.T) {
+	cfg := &Config{DotmanDir: "/home/test/.dotman"}
+
+	if err := cfg.Set("auto_push", "true"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !cfg.AutoPush {
+		t.Fatal("expected auto_push to be enabled")
+	}
+
+	value, err := cfg.Get("auto_push")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if value != "true" {
+		t.Fatalf("expected 'true', got '%s'", value)
+	}
+
+	if err := cfg.Set("auto_push", "sometimes"); err == nil {
+		t.Fatal("expected error for invalid boolean")
+	}
+	if err := cfg.Set("dotman_dir", "relative/dir"); err == nil {
+		t.Fatal("expected error for relative dotman_dir")
+	}
+	if err := cfg.Set("unknown", "value"); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+
+	if err := cfg.Set("exclude", "*.log, node_modules/,"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, _ := cfg.Get("exclude"); value != "*.log,node_modules/" {
+		t.Fatalf("expected '*.log,node_modules/', got '%s'", value)
+	}
+	if err := cfg.Set("exclude", "cache/tmp"); err == nil {
+		t.Fatal("expected error for a pattern with a path separator")
+	}
+
+	if err := cfg.Set("hooks", "notify-hook, /usr/local/bin/audit ,"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if len(cfg.Hooks) != 2 || cfg.Hooks[1] != "/usr/local/bin/audit" {
+		t.Fatalf("expected two hooks, got %v", cfg.Hooks)
+	}
+	if err := cfg.Set("notify", "sometimes"); err == nil {
+		t.Fatal("expected error for an unknown notify value")
+	}
+	if err := cfg.Set("fsync", FsyncAll); err != nil || cfg.Fsync != FsyncAll {
+		t.Fatalf("expected fsync to be set to all, got %q (%v)", cfg.Fsync, err)
+	}
+	if err := cfg.Set("fsync", "sometimes"); err == nil {
+		t.Fatal("expected error for an unknown fsync value")
+	}
+	if err := cfg.Set("pull_strategy", PullFFOnly); err != nil || cfg.PullStrategy != PullFFOnly {
+		t.Fatalf("expected pull_strategy to be set to ff-only, got %q (%v)", cfg.PullStrategy, err)
+	}
+	if err := cfg.Set("pull_strategy", "squash"); err == nil {
+		t.Fatal("expected error for an unknown pull_strategy value")
+	}
+	if err := cfg.Set("dir_mode", "0700"); err != nil || cfg.DirMode != "0700" {
+		t.Fatalf("expected dir_mode to be set to 0700, got %q (%v)", cfg.DirMode, err)
+	}
+	if perm := cfg.Perm(); perm.Dir != 0700 || perm.File != 0666 {
+		t.Fatalf("expected dir_mode 0700 and the default file_mode, got %o and %o", perm.Dir, perm.File)
+	}
+	if err := cfg.Set("file_mode", "rw-------"); err == nil {
+		t.Fatal("expected error for a file_mode that is not octal")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"0":     0,
+		"512":   512,
+		"512B":  512,
+		"4k":    4 << 10,
+		"100MB": 100 << 20,
+		"1 G":   1 << 30,
+		" 2GB ": 2 << 30,
+	}
+	for value, want := range tests {
+		got, err := ParseSize(value)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d (%v), want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "MB", "-1", "1.5G", "10TB"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("expected ParseSize(%q) to fail", value)
+		}
+	}
+
+	cfg := &Config{}
+	if size, _ := cfg.MaxFileSizeBytes(); size != DefaultMaxFileSize {
+		t.Errorf("expected the default limit when unset, got %d", size)
+	}
+	if err := cfg.Set("max_file_size", "lots"); err == nil {
+		t.Error("expected error for an invalid max_file_size")
+	}
+}
+
+func TestConfig_NetworkRetries(t *testing.T) {
+	cfg := &Config{}
+
+	retries, err := cfg.NetworkRetryCount()
+	if err != nil || retries != DefaultNetworkRetries {
+		t.Fatalf("expected %d retries by default, got %d, %v", DefaultNetworkRetries, retries, err)
+	}
+	backoff, err := cfg.RetryBackoffDuration()
+	if err != nil || backoff != DefaultRetryBackoff {
+		t.Fatalf("expected %v backoff by default, got %v, %v", DefaultRetryBackoff, backoff, err)
+	}
+
+	if err := cfg.Set("network_retries", "0"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if retries, _ := cfg.NetworkRetryCount(); retries != 0 {
+		t.Fatalf("expected 0 retries, got %d", retries)
+	}
+	if err := cfg.Set("retry_backoff", "500ms"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if backoff, _ := cfg.RetryBackoffDuration(); backoff != 500*time.Millisecond {
+		t.Fatalf("expected 500ms backoff, got %v", backoff)
+	}
+
+	if err := cfg.Set("network_retries", "-1"); err == nil {
+		t.Fatal("expected error for negative retries")
+	}
+	if err := cfg.Set("retry_backoff", "soon"); err == nil {
+		t.Fatal("expected error for invalid backoff")
+	}
+}
+
+func TestConfig_PushReminder(t *testing.T) {
+	cfg := &Config{}
+
+	if age, err := cfg.PushReminderAge(); err != nil || age != DefaultPushReminder {
+		t.Fatalf("expected %v by default, got %v, %v", DefaultPushReminder, age, err)
+	}
+	for value, want := range map[string]time.Duration{"3d": 72 * time.Hour, "36h": 36 * time.Hour, "0": 0} {
+		if err := cfg.Set("push_reminder", value); err != nil {
+			t.Fatalf("Set %s failed: %v", value, err)
+		}
+		if age, _ := cfg.PushReminderAge(); age != want {
+			t.Errorf("expected %s to be %v, got %v", value, want, age)
+		}
+	}
+	for _, value := range []string{"soon", "-1d", "d"} {
+		if err := cfg.Set("push_reminder", value); err == nil {
+			t.Errorf("expected error for push reminder %q", value)
+		}
+	}
+}
+
+func TestConfig_Hooks(t *testing.T) {
+	cfg := &Config{DotmanDir: "/home/user/.dotman"}
+
+	if timeout, err := cfg.HookTimeoutDuration(); err != nil || timeout != DefaultHookTimeout {
+		t.Fatalf("expected %v by default, got %v, %v", DefaultHookTimeout, timeout, err)
+	}
+	if cfg.HookWorkDir() != cfg.DotmanDir {
+		t.Errorf("expected hooks to run in the dotman directory, got %s", cfg.HookWorkDir())
+	}
+	if err := cfg.Set("hook_timeout", "10s"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if timeout, _ := cfg.HookTimeoutDuration(); timeout != 10*time.Second {
+		t.Errorf("expected 10s, got %v", timeout)
+	}
+	for _, value := range []string{"soon", "0", "-1s"} {
+		if err := cfg.Set("hook_timeout", value); err == nil {
+			t.Errorf("expected error for hook timeout %q", value)
+		}
+	}
+
+	if err := cfg.Set("hook_dir", "hooks"); err == nil {
+		t.Error("expected error for a relative hook directory")
+	}
+	if err := cfg.Set("hook_env", "EDITOR, SSH_AUTH_SOCK,"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if len(cfg.HookEnv) != 2 || cfg.HookEnv[1] != "SSH_AUTH_SOCK" {
+		t.Errorf("expected two variables, got %v", cfg.HookEnv)
+	}
+	if err := cfg.Set("hook_env", "A=b"); err == nil {
+		t.Error("expected error for an assignment in hook_env")
+	}
+}
+
+func TestConfig_JournalPath(t *testing.T) {
+	cfg := &Config{DotmanDir: "/home/user/.dotman"}
+	if got := cfg.JournalPath(cfg.DotmanDir); got != "/home/user/.dotman/journal" {
+		t.Errorf("expected the journal in the repository, got %s", got)
+	}
+
+	if err := cfg.Set("journal_dir", "journal"); err == nil {
+		t.Error("expected error for a relative journal directory")
+	}
+	if err := cfg.Set("journal_dir", "/var/lib/dotman"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := cfg.JournalPath(cfg.DotmanDir); got != "/var/lib/dotman/default" {
+		t.Errorf("expected the journal of the default profile, got %s", got)
+	}
+	cfg.ActiveProfile = "work"
+	if got := cfg.JournalPath("/home/user/work"); got != "/var/lib/dotman/work" {
+		t.Errorf("expected the journal of the work profile, got %s", got)
+	}
+}
+
+func TestConfig_BackupRetention(t *testing.T) {
+	cfg := &Config{}
+	if age, err := cfg.BackupRetentionAge(); err != nil || age != 0 {
+		t.Fatalf("expected backups to be kept forever by default, got %v, %v", age, err)
+	}
+	if err := cfg.Set("backup_retention", "a year"); err == nil {
+		t.Error("expected error for an invalid retention")
+	}
+	if err := cfg.Set("backup_retention", "365d"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if age, _ := cfg.BackupRetentionAge(); age != 365*24*time.Hour {
+		t.Errorf("expected 365 days, got %v", age)
+	}
+}
+
+func TestLoadConfig_EnvOverride(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.json": {
+			Data: []byte(`{"dotman_dir": "/custom/dotman/dir"}`),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	t.Setenv("DOTMAN_AUTO_PUSH", "true")
+
+	cfg, err := LoadConfig("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.AutoPush {
+		t.Fatal("expected DOTMAN_AUTO_PUSH to enable auto_push")
+	}
+
+	keys, err := FileKeys("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("FileKeys failed: %v", err)
+	}
+	if !keys["dotman_dir"] || keys["auto_push"] {
+		t.Fatalf("expected only dotman_dir to be set in the file, got %v", keys)
+	}
+}
+
+func TestSaveConfig_PreservesTOMLComments(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.toml": {
+			Data: []byte("# where the repository lives\ndotman_dir = '/old/dir'\n"),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := ReadConfig("config.toml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	if cfg.DotmanDir != "/old/dir" {
+		t.Fatalf("expected DotmanDir /old/dir, got %s", cfg.DotmanDir)
+	}
+
+	cfg.DotmanDir = "/new/dir"
+	cfg.AutoPush = true
+	if err := SaveConfig("config.toml", cfg, mockFS); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, err := mockFS.ReadFile("config.toml")
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	expected := "# where the repository lives\ndotman_dir = '/new/dir'\nauto_push = true\n"
+	if string(data) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+func TestSaveConfig_TOMLMultiLineValues(t *testing.T) {
+	existing := "dotman_dir = '''\n/old/dir'''\nexclude = [\n  \"*.log\", # logs\n  \"cache\",\n]\n\n[profiles.work]\ndotman_dir = '/work'\n"
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.toml": {Data: []byte(existing), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := ReadConfig("config.toml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+
+	cfg.DotmanDir = "/new/dir"
+	cfg.AutoPush = true
+	if err := SaveConfig("config.toml", cfg, mockFS); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	loaded, err := ReadConfig("config.toml", mockFS)
+	if err != nil {
+		data, _ := mockFS.ReadFile("config.toml")
+		t.Fatalf("ReadConfig after save failed: %v\n%s", err, data)
+	}
+	if loaded.DotmanDir != "/new/dir" || !loaded.AutoPush {
+		t.Fatalf("expected saved values, got %+v", loaded)
+	}
+	if len(loaded.Exclude) != 2 || loaded.Exclude[0] != "*.log" || loaded.Exclude[1] != "cache" {
+		t.Fatalf("expected exclude to survive, got %v", loaded.Exclude)
+	}
+	if loaded.Profiles["work"].DotmanDir != "/work" {
+		t.Fatalf("expected work profile to survive, got %v", loaded.Profiles)
+	}
+}
+
+func TestSaveConfig_PreservesYAMLComments(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.yaml": {
+			Data: []byte("# dotman settings\ndotman_dir: /old/dir # repository\n"),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := ReadConfig("config.yaml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+
+	cfg.DotmanDir = "/new/dir"
+	if err := SaveConfig("config.yaml", cfg, mockFS); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, err := mockFS.ReadFile("config.yaml")
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	expected := "# dotman settings\ndotman_dir: /new/dir # repository\n"
+	if string(data) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, data)
+	}
+
+	loaded, err := ReadConfig("config.yaml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	if loaded.DotmanDir != "/new/dir" {
+		t.Fatalf("expected DotmanDir /new/dir, got %s", loaded.DotmanDir)
+	}
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config file encoding
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+	FormatYAML Format = "yaml"
+)
+
+// FormatForPath detects the config format from the file extension, defaulting to JSON
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+func (f Format) unmarshal(data []byte, v any) error {
+	switch f {
+	case FormatTOML:
+		return toml.Unmarshal(data, v)
+	case FormatYAML:
+		return yaml.Unmarshal(data, v)
+	default:
+		return json.Unmarshal(data, v)
+	}
+}
+
+// marshal encodes config. When existing holds the current TOML or YAML file,
+// its keys are updated in place so comments and ordering survive.
+func (f Format) marshal(config *Config, existing []byte) ([]byte, error) {
+	switch f {
+	case FormatTOML:
+		if len(existing) > 0 {
+			return updateTOML(existing, config)
+		}
+		return toml.Marshal(config)
+	case FormatYAML:
+		if len(existing) > 0 {
+			return updateYAML(existing, config)
+		}
+		return yaml.Marshal(config)
+	default:
+		return json.MarshalIndent(config, "", "  ")
+	}
+}
+
+// updateTOML rewrites the top-level key lines of a TOML document, appending
+// keys that are missing and not at their zero value
+func updateTOML(existing []byte, config *Config) ([]byte, error) {
+	lines := strings.Split(string(existing), "\n")
+
+	for _, key := range Keys {
+		value := key.value(config)
+
+		encoded, err := toml.Marshal(map[string]any{key.Name: value})
+		if err != nil {
+			return nil, err
+		}
+		line := strings.TrimSpace(string(encoded))
+
+		pattern := regexp.MustCompile(`^\s*` + regexp.QuoteMeta(key.Name) + `\s*=`)
+		found := false
+		// Only top-level keys are managed, stop at the first table
+		for i := 0; i < tomlTableStart(lines); i++ {
+			if !isTOMLKeyLine(lines[i]) {
+				continue
+			}
+			// Replace the whole value, which may span several lines
+			end := tomlValueEnd(lines, i)
+			if pattern.MatchString(lines[i]) {
+				lines = append(lines[:i], append([]string{line}, lines[end+1:]...)...)
+				found = true
+				break
+			}
+			i = end
+		}
+
+		if !found && !reflect.ValueOf(value).IsZero() {
+			lines = insertTOMLLine(lines, line)
+		}
+	}
+
+	// Profiles are tables, which are rewritten as a whole at the end of the file
+	lines = removeTOMLTables(lines, "profiles")
+	if len(config.Profiles) > 0 {
+		encoded, err := toml.Marshal(map[string]any{"profiles": config.Profiles})
+		if err != nil {
+			return nil, err
+		}
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		lines = append(lines, "", strings.TrimRight(string(encoded), "\n"), "")
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// removeTOMLTables drops the table name and its sub-tables from a TOML document
+func removeTOMLTables(lines []string, name string) []string {
+	var kept []string
+	inTable := false
+	for i := 0; i < len(lines); i++ {
+		end := i
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "[") {
+			header := strings.Trim(trimmed, "[]")
+			inTable = header == name || strings.HasPrefix(header, name+".")
+		} else if isTOMLKeyLine(lines[i]) {
+			end = tomlValueEnd(lines, i)
+		}
+		if !inTable {
+			kept = append(kept, lines[i:end+1]...)
+		}
+		i = end
+	}
+	return kept
+}
+
+// insertTOMLLine adds a top-level key line before the first table, or at the end
+func insertTOMLLine(lines []string, line string) []string {
+	if i := tomlTableStart(lines); i < len(lines) {
+		return append(lines[:i], append([]string{line}, lines[i:]...)...)
+	}
+
+	// Keep a trailing newline at the end of the file
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		return append(lines[:n-1], line, "")
+	}
+	return append(lines, line)
+}
+
+// isTOMLKeyLine reports whether a line outside any value assigns a key
+func isTOMLKeyLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "[")
+}
+
+// tomlTableStart returns the index of the first table header, or len(lines)
+// when the document has none. Lines inside multi-line values are skipped.
+func tomlTableStart(lines []string) int {
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "[") {
+			return i
+		}
+		if isTOMLKeyLine(lines[i]) {
+			i = tomlValueEnd(lines, i)
+		}
+	}
+	return len(lines)
+}
+
+// tomlValueEnd returns the index of the line the value assigned on
+// lines[start] ends on, following arrays, inline tables and strings that
+// span several lines
+func tomlValueEnd(lines []string, start int) int {
+	depth := 0
+	quote := ""
+	for i := start; i < len(lines); i++ {
+		l := lines[i]
+		j := 0
+		if i == start {
+			j = strings.Index(l, "=") + 1
+		}
+		for j < len(l) {
+			switch {
+			case quote != "":
+				if quote[0] == '"' && l[j] == '\\' {
+					j += 2
+				} else if strings.HasPrefix(l[j:], quote) {
+					j += len(quote)
+					quote = ""
+				} else {
+					j++
+				}
+			case strings.HasPrefix(l[j:], `"""`), strings.HasPrefix(l[j:], "'''"):
+				quote = l[j : j+3]
+				j += 3
+			case l[j] == '"', l[j] == '\'':
+				quote = l[j : j+1]
+				j++
+			case l[j] == '#':
+				j = len(l)
+			case l[j] == '[', l[j] == '{':
+				depth++
+				j++
+			case l[j] == ']', l[j] == '}':
+				depth--
+				j++
+			default:
+				j++
+			}
+		}
+
+		// Only triple-quoted strings continue on the next line
+		if len(quote) == 1 {
+			quote = ""
+		}
+		if depth <= 0 && quote == "" {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// yamlValue is a top-level YAML key and the value to store under it
+type yamlValue struct {
+	name  string
+	value any
+}
+
+// updateYAML sets the keys of the top-level YAML mapping, keeping comments
+func updateYAML(existing []byte, config *Config) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(existing, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return yaml.Marshal(config)
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config must be a YAML mapping")
+	}
+
+	values := make([]yamlValue, 0, len(Keys)+1)
+	for _, key := range Keys {
+		values = append(values, yamlValue{key.Name, key.value(config)})
+	}
+	values = append(values, yamlValue{"profiles", config.Profiles})
+
+	for _, kv := range values {
+		value := kv.value
+
+		var valueNode yaml.Node
+		if err := valueNode.Encode(value); err != nil {
+			return nil, err
+		}
+
+		found := false
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == kv.name {
+				// Keep comments attached to the old value
+				valueNode.LineComment = root.Content[i+1].LineComment
+				valueNode.HeadComment = root.Content[i+1].HeadComment
+				valueNode.FootComment = root.Content[i+1].FootComment
+				root.Content[i+1] = &valueNode
+				found = true
+				break
+			}
+		}
+
+		if !found && !reflect.ValueOf(value).IsZero() {
+			keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv.name}
+			root.Content = append(root.Content, keyNode, &valueNode)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// FileNames lists the config file names looked up in the home directory, in order
+var FileNames = []string{".dotconfig", ".dotconfig.toml", ".dotconfig.yaml", ".dotconfig.yml"}
+
+// FindConfigFile returns the first existing config file in homeDir, or the
+// JSON .dotconfig path if there is none
+func FindConfigFile(fsys dotmanfs.FileSystem, homeDir string) string {
+	for _, name := range FileNames {
+		path := filepath.Join(homeDir, name)
+		if _, err := fsys.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(homeDir, FileNames[0])
+}
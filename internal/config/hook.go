@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHookTimeout is how long a hook may run when hook_timeout is not set
+const DefaultHookTimeout = 30 * time.Second
+
+// parseHookTimeout parses a hook timeout such as "10s" or "1m"
+func parseHookTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid hook timeout '%s', use a duration such as 10s or 1m", value)
+	}
+	return d, nil
+}
+
+// HookTimeoutDuration returns how long a hook may run before it is killed
+func (c *Config) HookTimeoutDuration() (time.Duration, error) {
+	if c.HookTimeout == "" {
+		return DefaultHookTimeout, nil
+	}
+	return parseHookTimeout(c.HookTimeout)
+}
+
+// HookWorkDir returns the directory hooks run in
+func (c *Config) HookWorkDir() string {
+	if c.HookDir == "" {
+		return c.DotmanDir
+	}
+	return c.HookDir
+}
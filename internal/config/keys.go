@@ -0,0 +1,628 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/noosxe/dotman/internal/exclude"
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// Key describes a configuration key that can be read and written by name
+type Key struct {
+	Name        string
+	Env         string
+	Description string
+	// Default is the value that applies while the key is empty, empty when
+	// that is the value itself or depends on other settings
+	Default string
+
+	value func(c *Config) any
+	set   func(c *Config, value string) error
+}
+
+// Keys lists the supported configuration keys
+var Keys = []Key{
+	{
+		Name:        "active_profile",
+		Env:         "DOTMAN_PROFILE",
+		Description: "profile whose repository is used",
+		Default:     DefaultProfile,
+		value:       func(c *Config) any { return c.ActiveProfile },
+		set: func(c *Config, value string) error {
+			if value == DefaultProfile {
+				value = ""
+			}
+			if _, ok := c.Profiles[value]; value != "" && !ok {
+				return fmt.Errorf("unknown profile '%s'", value)
+			}
+			c.ActiveProfile = value
+			return nil
+		},
+	},
+	{
+		Name:        "secrets_profile",
+		Env:         "DOTMAN_SECRETS_PROFILE",
+		Description: "profile whose repository holds sensitive entries, added with add --secret",
+		value:       func(c *Config) any { return c.SecretsProfile },
+		set: func(c *Config, value string) error {
+			if _, ok := c.Profiles[value]; value != "" && !ok {
+				return fmt.Errorf("unknown profile '%s'", value)
+			}
+			c.SecretsProfile = value
+			return nil
+		},
+	},
+	{
+		Name:        "dotman_dir",
+		Env:         "DOTMAN_DIR",
+		Description: "directory holding the dotman repository",
+		value:       func(c *Config) any { return c.DotmanDir },
+		set: func(c *Config, value string) error {
+			if !filepath.IsAbs(value) {
+				return fmt.Errorf("must be an absolute path")
+			}
+			c.DotmanDir = filepath.Clean(value)
+			return nil
+		},
+	},
+	{
+		Name:        "auto_push",
+		Env:         "DOTMAN_AUTO_PUSH",
+		Description: "push to the remote after every commit",
+		value:       func(c *Config) any { return c.AutoPush },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.AutoPush = b
+			return nil
+		},
+	},
+	{
+		Name:        "dedup",
+		Env:         "DOTMAN_DEDUP",
+		Description: "store identical files added under data/ once, in a content-addressed store",
+		value:       func(c *Config) any { return c.Dedup },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.Dedup = b
+			return nil
+		},
+	},
+	{
+		Name:        "max_file_size",
+		Env:         "DOTMAN_MAX_FILE_SIZE",
+		Description: "largest file add accepts, e.g. 50MB, 0 for no limit",
+		Default:     "100MB",
+		value:       func(c *Config) any { return c.MaxFileSize },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			c.MaxFileSize = value
+			return nil
+		},
+	},
+	{
+		Name:        "offload_size",
+		Env:         "DOTMAN_OFFLOAD_SIZE",
+		Description: "files larger than this, e.g. 10MB, are kept in offload_store instead of git; off when empty",
+		value:       func(c *Config) any { return c.OffloadSize },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			c.OffloadSize = value
+			return nil
+		},
+	},
+	{
+		Name:        "offload_store",
+		Env:         "DOTMAN_OFFLOAD_STORE",
+		Description: "where offloaded files are kept: an absolute directory, rsync://[user@]host/path or s3://bucket/prefix",
+		value:       func(c *Config) any { return c.OffloadStore },
+		set: func(c *Config, value string) error {
+			c.OffloadStore = value
+			return nil
+		},
+	},
+	{
+		Name:        "exclude",
+		Env:         "DOTMAN_EXCLUDE",
+		Description: "comma-separated junk patterns skipped when adding directories, on top of the defaults",
+		value:       func(c *Config) any { return c.Exclude },
+		set: func(c *Config, value string) error {
+			var patterns []string
+			for _, pattern := range strings.Split(value, ",") {
+				pattern = strings.TrimSpace(pattern)
+				if pattern == "" {
+					continue
+				}
+				if err := exclude.Validate(pattern); err != nil {
+					return err
+				}
+				patterns = append(patterns, pattern)
+			}
+			c.Exclude = patterns
+			return nil
+		},
+	},
+	{
+		Name:        "hooks",
+		Env:         "DOTMAN_HOOKS",
+		Description: "comma-separated hook plugins run with every operation event as JSON on stdin",
+		value:       func(c *Config) any { return c.Hooks },
+		set: func(c *Config, value string) error {
+			var hooks []string
+			for _, hook := range strings.Split(value, ",") {
+				if hook = strings.TrimSpace(hook); hook != "" {
+					hooks = append(hooks, hook)
+				}
+			}
+			c.Hooks = hooks
+			return nil
+		},
+	},
+	{
+		Name:        "hook_timeout",
+		Env:         "DOTMAN_HOOK_TIMEOUT",
+		Description: "how long a hook may run before it is killed, e.g. 10s",
+		Default:     DefaultHookTimeout.String(),
+		value:       func(c *Config) any { return c.HookTimeout },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := parseHookTimeout(value); err != nil {
+					return err
+				}
+			}
+			c.HookTimeout = value
+			return nil
+		},
+	},
+	{
+		Name:        "hook_dir",
+		Env:         "DOTMAN_HOOK_DIR",
+		Description: "working directory of hooks; the dotman directory when empty",
+		value:       func(c *Config) any { return c.HookDir },
+		set: func(c *Config, value string) error {
+			if value != "" && !filepath.IsAbs(value) {
+				return fmt.Errorf("must be an absolute path")
+			}
+			c.HookDir = value
+			return nil
+		},
+	},
+	{
+		Name:        "hook_env",
+		Env:         "DOTMAN_HOOK_ENV",
+		Description: "comma-separated environment variables passed to hooks on top of PATH, HOME and the locale",
+		value:       func(c *Config) any { return c.HookEnv },
+		set: func(c *Config, value string) error {
+			var names []string
+			for _, name := range strings.Split(value, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if strings.ContainsAny(name, "= ") {
+					return fmt.Errorf("invalid variable name '%s'", name)
+				}
+				names = append(names, name)
+			}
+			c.HookEnv = names
+			return nil
+		},
+	},
+	{
+		Name:        "trash",
+		Env:         "DOTMAN_TRASH",
+		Description: "move originals replaced by symlinks to the desktop trash instead of deleting them",
+		value:       func(c *Config) any { return c.Trash },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.Trash = b
+			return nil
+		},
+	},
+	{
+		Name:        "notify",
+		Env:         "DOTMAN_NOTIFY",
+		Description: "desktop notifications for operations run by the daemon: failures, always, or empty for none",
+		value:       func(c *Config) any { return c.Notify },
+		set: func(c *Config, value string) error {
+			if value != "" && value != NotifyFailures && value != NotifyAlways {
+				return fmt.Errorf("must be %s, %s or empty", NotifyFailures, NotifyAlways)
+			}
+			c.Notify = value
+			return nil
+		},
+	},
+	{
+		Name:        "line_endings",
+		Env:         "DOTMAN_LINE_ENDINGS",
+		Description: "line endings of text files added to the repository: keep, or lf to convert CRLF to LF",
+		Default:     manifest.LineEndingsKeep,
+		value:       func(c *Config) any { return c.LineEndings },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if err := manifest.ValidateLineEndings(value); err != nil {
+					return err
+				}
+			}
+			c.LineEndings = value
+			return nil
+		},
+	},
+	{
+		Name:        "link_mode",
+		Env:         "DOTMAN_LINK_MODE",
+		Description: "how entries are put in place: symlink, hardlink, copy or junction",
+		Default:     LinkSymlink,
+		value:       func(c *Config) any { return c.LinkMode },
+		set: func(c *Config, value string) error {
+			if value != "" && value != LinkSymlink && value != LinkHardlink && value != LinkCopy && value != LinkJunction {
+				return fmt.Errorf("must be %s, %s, %s, %s or empty", LinkSymlink, LinkHardlink, LinkCopy, LinkJunction)
+			}
+			c.LinkMode = value
+			return nil
+		},
+	},
+	{
+		Name:        "dir_mode",
+		Env:         "DOTMAN_DIR_MODE",
+		Description: "widest permission of directories dotman creates, in octal, narrowed by the umask",
+		Default:     "0777",
+		value:       func(c *Config) any { return c.DirMode },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := dotmanfs.ParsePerm(value); err != nil {
+					return err
+				}
+			}
+			c.DirMode = value
+			return nil
+		},
+	},
+	{
+		Name:        "file_mode",
+		Env:         "DOTMAN_FILE_MODE",
+		Description: "widest permission of files dotman materializes, in octal, narrowed by the umask",
+		Default:     "0666",
+		value:       func(c *Config) any { return c.FileMode },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := dotmanfs.ParsePerm(value); err != nil {
+					return err
+				}
+			}
+			c.FileMode = value
+			return nil
+		},
+	},
+	{
+		Name:        "journal_chain",
+		Env:         "DOTMAN_JOURNAL_CHAIN",
+		Description: "hash chain new journal entries so 'dotman journal verify-integrity' can detect edited history",
+		value:       func(c *Config) any { return c.JournalChain },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.JournalChain = b
+			return nil
+		},
+	},
+	{
+		Name:        "fsync",
+		Env:         "DOTMAN_FSYNC",
+		Description: "when journal writes wait for the disk, so a power loss cannot lose them: off, transitions or all",
+		Default:     FsyncTransitions,
+		value:       func(c *Config) any { return c.Fsync },
+		set: func(c *Config, value string) error {
+			if value != "" && value != FsyncOff && value != FsyncTransitions && value != FsyncAll {
+				return fmt.Errorf("must be %s, %s, %s or empty", FsyncOff, FsyncTransitions, FsyncAll)
+			}
+			c.Fsync = value
+			return nil
+		},
+	},
+	{
+		Name:        "network_retries",
+		Env:         "DOTMAN_NETWORK_RETRIES",
+		Description: "times push retries when the remote cannot be reached",
+		Default:     strconv.Itoa(DefaultNetworkRetries),
+		value:       func(c *Config) any { return c.NetworkRetries },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := parseRetries(value); err != nil {
+					return err
+				}
+			}
+			c.NetworkRetries = value
+			return nil
+		},
+	},
+	{
+		Name:        "retry_backoff",
+		Env:         "DOTMAN_RETRY_BACKOFF",
+		Description: "wait before the first network retry, doubled for each further one, e.g. 500ms",
+		Default:     DefaultRetryBackoff.String(),
+		value:       func(c *Config) any { return c.RetryBackoff },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := parseBackoff(value); err != nil {
+					return err
+				}
+			}
+			c.RetryBackoff = value
+			return nil
+		},
+	},
+	{
+		Name:        "offline_queue",
+		Env:         "DOTMAN_OFFLINE_QUEUE",
+		Description: "queue pushes that fail because the remote cannot be reached instead of failing, the next push sends them",
+		value:       func(c *Config) any { return c.OfflineQueue },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.OfflineQueue = b
+			return nil
+		},
+	},
+	{
+		Name:        "push_reminder",
+		Env:         "DOTMAN_PUSH_REMINDER",
+		Description: "warn in status when commits stay unpushed longer than this, e.g. 36h or 3d, 0 to never warn",
+		Default:     "3d",
+		value:       func(c *Config) any { return c.PushReminder },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := parseReminder(value); err != nil {
+					return err
+				}
+			}
+			c.PushReminder = value
+			return nil
+		},
+	},
+	{
+		Name:        "verify_before_push",
+		Env:         "DOTMAN_VERIFY_BEFORE_PUSH",
+		Description: "run the doctor checks before every push and refuse to push when they find problems",
+		value:       func(c *Config) any { return c.VerifyPush },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			c.VerifyPush = b
+			return nil
+		},
+	},
+	{
+		Name:        "git_user_name",
+		Env:         "DOTMAN_GIT_USER_NAME",
+		Description: "author name of dotman's commits, user.name from git config when empty",
+		value:       func(c *Config) any { return c.GitUserName },
+		set: func(c *Config, value string) error {
+			if strings.ContainsAny(value, "<>\n") {
+				return fmt.Errorf("must not contain '<', '>' or newlines")
+			}
+			c.GitUserName = value
+			return nil
+		},
+	},
+	{
+		Name:        "git_user_email",
+		Env:         "DOTMAN_GIT_USER_EMAIL",
+		Description: "author email of dotman's commits, user.email from git config when empty",
+		value:       func(c *Config) any { return c.GitUserEmail },
+		set: func(c *Config, value string) error {
+			if strings.ContainsAny(value, "<> \n") {
+				return fmt.Errorf("must not contain '<', '>', spaces or newlines")
+			}
+			c.GitUserEmail = value
+			return nil
+		},
+	},
+	{
+		Name:        "merge_tool",
+		Env:         "DOTMAN_MERGE_TOOL",
+		Description: "command resolve runs through sh with $BASE, $LOCAL, $REMOTE and $MERGED set, $VISUAL or $EDITOR on $MERGED when empty",
+		value:       func(c *Config) any { return c.MergeTool },
+		set: func(c *Config, value string) error {
+			c.MergeTool = value
+			return nil
+		},
+	},
+	{
+		Name:        "pull_strategy",
+		Env:         "DOTMAN_PULL_STRATEGY",
+		Description: "how commits on the remote are brought in: merge, ff-only or rebase",
+		Default:     PullMerge,
+		value:       func(c *Config) any { return c.PullStrategy },
+		set: func(c *Config, value string) error {
+			if value != "" && value != PullMerge && value != PullFFOnly && value != PullRebase {
+				return fmt.Errorf("must be %s, %s, %s or empty", PullMerge, PullFFOnly, PullRebase)
+			}
+			c.PullStrategy = value
+			return nil
+		},
+	},
+	{
+		Name:        "follow_release",
+		Env:         "DOTMAN_FOLLOW_RELEASE",
+		Description: "release link checks out first: latest for the newest one or a release name; the branch is followed when empty",
+		value:       func(c *Config) any { return c.FollowRelease },
+		set: func(c *Config, value string) error {
+			c.FollowRelease = value
+			return nil
+		},
+	},
+	{
+		Name:        "allowed_signers",
+		Env:         "DOTMAN_ALLOWED_SIGNERS",
+		Description: "ssh-keygen allowed signers file; when set, init --clone and link refuse a HEAD commit without a valid SSH signature by one of them",
+		value:       func(c *Config) any { return c.AllowedSigners },
+		set: func(c *Config, value string) error {
+			if value != "" && !filepath.IsAbs(value) {
+				return fmt.Errorf("must be an absolute path")
+			}
+			c.AllowedSigners = value
+			return nil
+		},
+	},
+	{
+		Name:        "journal_dir",
+		Env:         "DOTMAN_JOURNAL_DIR",
+		Description: "directory keeping the journal of each profile, e.g. on a local disk; the journal directory of the repository when empty",
+		value:       func(c *Config) any { return c.JournalDir },
+		set: func(c *Config, value string) error {
+			if value != "" && !filepath.IsAbs(value) {
+				return fmt.Errorf("must be an absolute path")
+			}
+			c.JournalDir = value
+			return nil
+		},
+	},
+	{
+		Name:        "backup_dir",
+		Env:         "DOTMAN_BACKUP_DIR",
+		Description: "directory for what link and init --force back up; dotman/backups in the state directory and next to the dotman directory when empty",
+		value:       func(c *Config) any { return c.BackupDir },
+		set: func(c *Config, value string) error {
+			if value != "" && !filepath.IsAbs(value) {
+				return fmt.Errorf("must be an absolute path")
+			}
+			c.BackupDir = value
+			return nil
+		},
+	},
+	{
+		Name:        "backup_retention",
+		Env:         "DOTMAN_BACKUP_RETENTION",
+		Description: "delete the backups of link older than this in gc, e.g. 365d; kept forever when empty",
+		value:       func(c *Config) any { return c.BackupRetention },
+		set: func(c *Config, value string) error {
+			if value != "" {
+				if _, err := ParseAge(value); err != nil {
+					return err
+				}
+			}
+			c.BackupRetention = value
+			return nil
+		},
+	},
+}
+
+// FindKey looks up a configuration key by name
+func FindKey(name string) (*Key, bool) {
+	for i := range Keys {
+		if Keys[i].Name == name {
+			return &Keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// KeyNames returns the names of all configuration keys, sorted
+func KeyNames() []string {
+	names := make([]string, len(Keys))
+	for i, key := range Keys {
+		names[i] = key.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the value of a configuration key as a string
+func (c *Config) Get(name string) (string, error) {
+	key, ok := FindKey(name)
+	if !ok {
+		return "", fmt.Errorf("unknown config key: %s", name)
+	}
+	if list, ok := key.value(c).([]string); ok {
+		return strings.Join(list, ","), nil
+	}
+	return fmt.Sprint(key.value(c)), nil
+}
+
+// Effective returns the value of a configuration key that applies: its
+// value, or its default while it is empty
+func (c *Config) Effective(name string) (string, error) {
+	value, err := c.Get(name)
+	if err != nil || value != "" {
+		return value, err
+	}
+	key, _ := FindKey(name)
+	return key.Default, nil
+}
+
+// Set validates and sets the value of a configuration key
+func (c *Config) Set(name, value string) error {
+	key, ok := FindKey(name)
+	if !ok {
+		return fmt.Errorf("unknown config key: %s", name)
+	}
+	if err := key.set(c, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", name, err)
+	}
+	return nil
+}
+
+// ApplyEnv overrides configuration keys with their environment variables
+func ApplyEnv(c *Config) error {
+	for _, key := range Keys {
+		value, ok := os.LookupEnv(key.Env)
+		if !ok {
+			continue
+		}
+		if err := key.set(c, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key.Env, err)
+		}
+	}
+	return nil
+}
+
+// FileKeys reports which keys are set explicitly in the configuration file
+func FileKeys(configPath string, fsys dotmanfs.FileSystem) (map[string]bool, error) {
+	data, err := fsys.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	var raw map[string]any
+	if err := FormatForPath(configPath).unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %v", err)
+	}
+
+	keys := make(map[string]bool, len(raw))
+	for name := range raw {
+		keys[name] = true
+	}
+	return keys, nil
+}
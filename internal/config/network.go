@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNetworkRetries is the number of times a network operation is retried
+// after a connectivity failure when network_retries is not set
+const DefaultNetworkRetries = 2
+
+// DefaultRetryBackoff is the wait before the first retry when retry_backoff
+// is not set
+const DefaultRetryBackoff = 2 * time.Second
+
+// DefaultPushReminder is how long commits may stay unpushed before status
+// warns about them when push_reminder is not set
+const DefaultPushReminder = 3 * 24 * time.Hour
+
+// parseRetries parses a number of retries
+func parseRetries(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of retries '%s', use 0 or more", value)
+	}
+	return n, nil
+}
+
+// parseBackoff parses a retry backoff such as "500ms" or "2s"
+func parseBackoff(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid backoff '%s', use a duration such as 500ms or 2s", value)
+	}
+	return d, nil
+}
+
+// ParseAge parses an age such as "36h" or "3d", a day being 24 hours
+func ParseAge(value string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s', use a duration such as 36h or 3d", value)
+	}
+	return d, nil
+}
+
+// parseReminder parses a push reminder such as "36h" or "3d"
+func parseReminder(value string) (time.Duration, error) {
+	d, err := ParseAge(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid push reminder '%s', use a duration such as 36h or 3d, or 0 to never warn", value)
+	}
+	return d, nil
+}
+
+// NetworkRetryCount returns the number of times a network operation is
+// retried after a connectivity failure
+func (c *Config) NetworkRetryCount() (int, error) {
+	if c.NetworkRetries == "" {
+		return DefaultNetworkRetries, nil
+	}
+	return parseRetries(c.NetworkRetries)
+}
+
+// RetryBackoffDuration returns the wait before the first retry of a network
+// operation. Each further retry waits twice as long as the one before.
+func (c *Config) RetryBackoffDuration() (time.Duration, error) {
+	if c.RetryBackoff == "" {
+		return DefaultRetryBackoff, nil
+	}
+	return parseBackoff(c.RetryBackoff)
+}
+
+// PushReminderAge returns how long commits may stay unpushed before status
+// warns about them, 0 when it never should
+func (c *Config) PushReminderAge() (time.Duration, error) {
+	if c.PushReminder == "" {
+		return DefaultPushReminder, nil
+	}
+	return parseReminder(c.PushReminder)
+}
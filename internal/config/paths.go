@@ -0,0 +1,29 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// JournalPath returns the journal directory of the repository in dir: the
+// journal directory inside it, or with journal_dir set the directory of the
+// profile in journal_dir, so profiles sharing it keep separate journals
+func (c *Config) JournalPath(dir string) string {
+	if c.JournalDir == "" {
+		return filepath.Join(dir, "journal")
+	}
+	profile := c.ActiveProfile
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	return filepath.Join(c.JournalDir, profile)
+}
+
+// BackupRetentionAge returns how long the backups of link are kept before gc
+// deletes them, 0 when they are kept forever
+func (c *Config) BackupRetentionAge() (time.Duration, error) {
+	if c.BackupRetention == "" {
+		return 0, nil
+	}
+	return ParseAge(c.BackupRetention)
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DefaultProfile names the top-level configuration, used when no profile is active
+const DefaultProfile = "default"
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Profile is a named dotman repository with its own directory and remote
+type Profile struct {
+	DotmanDir string `json:"dotman_dir" toml:"dotman_dir" yaml:"dotman_dir"`
+	Remote    string `json:"remote,omitempty" toml:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// AddProfile validates and stores a profile, replacing one with the same name
+func (c *Config) AddProfile(name string, profile Profile) error {
+	if name == DefaultProfile || !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s'", name)
+	}
+	if !filepath.IsAbs(profile.DotmanDir) {
+		return fmt.Errorf("profile directory must be an absolute path")
+	}
+	profile.DotmanDir = filepath.Clean(profile.DotmanDir)
+
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]Profile)
+	}
+	c.Profiles[name] = profile
+
+	return nil
+}
+
+// ProfileNames returns the names of the configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CurrentProfile returns the active profile, if any
+func (c *Config) CurrentProfile() (string, *Profile) {
+	if c.ActiveProfile == "" {
+		return DefaultProfile, nil
+	}
+	profile, ok := c.Profiles[c.ActiveProfile]
+	if !ok {
+		return c.ActiveProfile, nil
+	}
+	return c.ActiveProfile, &profile
+}
+
+// applyProfile points DotmanDir at the active profile's directory, unless
+// DOTMAN_DIR overrides it
+func (c *Config) applyProfile() error {
+	if c.ActiveProfile == "" {
+		return nil
+	}
+
+	profile, ok := c.Profiles[c.ActiveProfile]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s'", c.ActiveProfile)
+	}
+
+	if _, ok := os.LookupEnv("DOTMAN_DIR"); !ok {
+		c.defaultDir = c.DotmanDir
+		c.DotmanDir = profile.DotmanDir
+	}
+
+	return nil
+}
+
+// ForProfile returns a copy of the effective configuration scoped to the
+// repository of the named profile instead of the active one
+func (c *Config) ForProfile(name string) (*Config, error) {
+	scoped := *c
+	if name == DefaultProfile || name == "" {
+		if c.defaultDir != "" {
+			scoped.DotmanDir = c.defaultDir
+		}
+		scoped.ActiveProfile = ""
+		return &scoped, nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile '%s'", name)
+	}
+	if c.ActiveProfile == "" {
+		scoped.defaultDir = c.DotmanDir
+	}
+	scoped.DotmanDir = profile.DotmanDir
+	scoped.ActiveProfile = name
+	return &scoped, nil
+}
+
+// SecretsConfig returns the configuration scoped to the repository holding
+// sensitive entries, as named by secrets_profile
+func (c *Config) SecretsConfig() (*Config, error) {
+	if c.SecretsProfile == "" {
+		return nil, fmt.Errorf("secrets_profile is not set; add a profile for the private repository and set it with `dotman config set secrets_profile <name>`")
+	}
+	return c.ForProfile(c.SecretsProfile)
+}
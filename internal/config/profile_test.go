@@ -0,0 +1,159 @@
+package config
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestLoadConfig_ActiveProfile(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.json": {
+			Data: []byte(`{"dotman_dir": "/home/test/.dotman", "active_profile": "work", "profiles": {"work": {"dotman_dir": "/home/test/.dotman-work"}, "oss": {"dotman_dir": "/home/test/.dotman-oss"}}}`),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := LoadConfig("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.DotmanDir != "/home/test/.dotman-work" {
+		t.Fatalf("expected work profile directory, got %s", cfg.DotmanDir)
+	}
+
+	// The environment selects another profile for a single invocation
+	t.Setenv("DOTMAN_PROFILE", "oss")
+	cfg, err = LoadConfig("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.DotmanDir != "/home/test/.dotman-oss" {
+		t.Fatalf("expected oss profile directory, got %s", cfg.DotmanDir)
+	}
+
+	t.Setenv("DOTMAN_PROFILE", "default")
+	cfg, err = LoadConfig("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.DotmanDir != "/home/test/.dotman" {
+		t.Fatalf("expected default directory, got %s", cfg.DotmanDir)
+	}
+
+	t.Setenv("DOTMAN_PROFILE", "missing")
+	if _, err := LoadConfig("config.json", mockFS); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func TestConfig_SecretsProfile(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.json": {
+			Data: []byte(`{"dotman_dir": "/home/test/.dotman", "active_profile": "work", "profiles": {"work": {"dotman_dir": "/home/test/.dotman-work"}, "secrets": {"dotman_dir": "/home/test/.dotman-secrets"}}}`),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := LoadConfig("config.json", mockFS)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if _, err := cfg.SecretsConfig(); err == nil {
+		t.Fatal("expected an error without secrets_profile")
+	}
+	if err := cfg.Set("secrets_profile", "missing"); err == nil {
+		t.Fatal("expected an error for an unknown secrets profile")
+	}
+	if err := cfg.Set("secrets_profile", "secrets"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	secrets, err := cfg.SecretsConfig()
+	if err != nil {
+		t.Fatalf("SecretsConfig failed: %v", err)
+	}
+	if secrets.DotmanDir != "/home/test/.dotman-secrets" || cfg.DotmanDir != "/home/test/.dotman-work" {
+		t.Fatalf("expected only the copy to be scoped to the secrets repository, got %s and %s", secrets.DotmanDir, cfg.DotmanDir)
+	}
+
+	// The default repository is still known with another profile active
+	for _, c := range []*Config{cfg, secrets} {
+		def, err := c.ForProfile(DefaultProfile)
+		if err != nil || def.DotmanDir != "/home/test/.dotman" {
+			t.Errorf("expected the default directory, got %v (%v)", def, err)
+		}
+	}
+}
+
+func TestAddProfile(t *testing.T) {
+	cfg := &Config{}
+
+	if err := cfg.AddProfile("work", Profile{DotmanDir: "/home/test/.dotman-work"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	if err := cfg.AddProfile("default", Profile{DotmanDir: "/home/test/.dotman-default"}); err == nil {
+		t.Fatal("expected error for reserved profile name")
+	}
+	if err := cfg.AddProfile("bad name", Profile{DotmanDir: "/home/test/.dotman-bad"}); err == nil {
+		t.Fatal("expected error for invalid profile name")
+	}
+	if err := cfg.AddProfile("rel", Profile{DotmanDir: "relative"}); err == nil {
+		t.Fatal("expected error for relative profile directory")
+	}
+
+	if names := cfg.ProfileNames(); len(names) != 1 || names[0] != "work" {
+		t.Fatalf("expected [work], got %v", names)
+	}
+}
+
+func TestSaveConfig_TOMLProfiles(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"config.toml": {
+			Data: []byte("# settings\ndotman_dir = '/home/test/.dotman'\n\n[profiles.old]\ndotman_dir = '/home/test/.dotman-old'\n"),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	cfg, err := ReadConfig("config.toml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+
+	delete(cfg.Profiles, "old")
+	if err := cfg.AddProfile("work", Profile{DotmanDir: "/home/test/.dotman-work", Remote: "git@example.com:work.git"}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	if err := SaveConfig("config.toml", cfg, mockFS); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	loaded, err := ReadConfig("config.toml", mockFS)
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	if len(loaded.Profiles) != 1 || loaded.Profiles["work"].Remote != "git@example.com:work.git" {
+		t.Fatalf("expected only the work profile, got %v", loaded.Profiles)
+	}
+
+	data, err := mockFS.ReadFile("config.toml")
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if string(data[:len("# settings\n")]) != "# settings\n" {
+		t.Fatalf("expected leading comment to be kept, got:\n%s", data)
+	}
+}
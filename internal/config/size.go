@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxFileSize is the largest file add accepts when max_file_size is
+// not set
+const DefaultMaxFileSize int64 = 100 << 20
+
+// sizeUnits maps the accepted size suffixes to their multiplier, longest
+// suffixes first so "MB" is not read as "B"
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "512K", "100MB" or "1G" into bytes. Units
+// are powers of 1024 and a plain number is a number of bytes.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s', use a number of bytes or a size such as 512K, 100MB or 1G", value)
+	}
+
+	return n * multiplier, nil
+}
+
+// FormatSize formats a number of bytes for display, e.g. "1.5 MB"
+func FormatSize(size int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if size >= unit.size {
+			return fmt.Sprintf("%.1f %s", float64(size)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// MaxFileSizeBytes returns the largest file add accepts, 0 for no limit
+func (c *Config) MaxFileSizeBytes() (int64, error) {
+	if c.MaxFileSize == "" {
+		return DefaultMaxFileSize, nil
+	}
+	return ParseSize(c.MaxFileSize)
+}
+
+// OffloadSizeBytes returns the size above which add offloads files, 0 when
+// offloading is off
+func (c *Config) OffloadSizeBytes() (int64, error) {
+	if c.OffloadSize == "" {
+		return 0, nil
+	}
+	return ParseSize(c.OffloadSize)
+}
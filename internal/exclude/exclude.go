@@ -0,0 +1,67 @@
+// Package exclude decides which entries of an added directory are junk that
+// is not copied into the repository
+package exclude
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Default lists the junk patterns every add skips. The generated .gitignore
+// lists the same patterns.
+var Default = []string{
+	"*.swp",
+	"*.swo",
+	"*~",
+	".DS_Store",
+	"Thumbs.db",
+	"__pycache__/",
+	".git",
+}
+
+// Matcher matches entry names against junk patterns. A pattern is matched
+// against the base name of an entry with filepath.Match, and a pattern ending
+// in a slash only matches directories.
+type Matcher struct {
+	patterns []string
+}
+
+// New returns a matcher for the default patterns and the given extra ones
+func New(extra []string) Matcher {
+	patterns := make([]string, 0, len(Default)+len(extra))
+	patterns = append(patterns, Default...)
+	patterns = append(patterns, extra...)
+	return Matcher{patterns: patterns}
+}
+
+// Match reports whether an entry with the given base name is junk
+func (m Matcher) Match(name string, isDir bool) bool {
+	for _, pattern := range m.patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		if ok, _ := filepath.Match(strings.TrimSuffix(pattern, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that pattern is a valid junk pattern
+func Validate(pattern string) error {
+	name := strings.TrimSuffix(pattern, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid pattern '%s', patterns match a single file or directory name", pattern)
+	}
+	if _, err := filepath.Match(name, ""); err != nil {
+		return fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+	}
+	return nil
+}
+
+// Gitignore returns the default patterns as .gitignore lines
+func Gitignore() string {
+	return strings.Join(Default, "\n") + "\n"
+}
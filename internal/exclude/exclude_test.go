@@ -0,0 +1,44 @@
+package exclude
+
+import "testing"
+
+func TestMatcher(t *testing.T) {
+	m := New([]string{"*.log", "node_modules/"})
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{".DS_Store", false, true},
+		{"init.lua.swp", false, true},
+		{"init.lua~", false, true},
+		{"__pycache__", true, true},
+		{"__pycache__", false, false},
+		{".git", true, true},
+		{".git", false, true},
+		{"debug.log", false, true},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"init.lua", false, false},
+		{".gitignore", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.name, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, pattern := range []string{"*.log", "cache/", ".idea"} {
+		if err := Validate(pattern); err != nil {
+			t.Errorf("Validate(%q) returned error: %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"", "/", "a/b", "[.log"} {
+		if err := Validate(pattern); err == nil {
+			t.Errorf("expected Validate(%q) to fail", pattern)
+		}
+	}
+}
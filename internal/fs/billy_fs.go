@@ -1,10 +1,15 @@
 package fs
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
-	"time"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/go-git/go-billy/v5"
 )
@@ -13,13 +18,33 @@ import (
 type BillyFileSystem struct {
 	fs       FileSystem
 	basePath string
+	// perm limits the permissions of the files and directories created
+	perm Perm
+
+	// open holds the content of the files with open handles, by path. Handles
+	// of the same file share it, so one sees what another wrote before it is
+	// written back, like go-git reading a packfile while it is being written.
+	mu   sync.Mutex
+	open map[string]*fileContent
 }
 
-// NewBillyFileSystem creates a new BillyFileSystem instance
-func NewBillyFileSystem(fs FileSystem, basePath string) *BillyFileSystem {
+// fileContent is the in-memory content of a file shared by its open handles
+type fileContent struct {
+	mu   sync.Mutex
+	data []byte
+	// data has changes that are not written to the filesystem yet
+	dirty bool
+	// number of open handles
+	refs int
+}
+
+// NewBillyFileSystem creates a new BillyFileSystem instance creating files
+// and directories within perm
+func NewBillyFileSystem(fs FileSystem, basePath string, perm Perm) *BillyFileSystem {
 	return &BillyFileSystem{
 		fs:       fs,
 		basePath: filepath.Join(basePath, ""),
+		perm:     perm,
 	}
 }
 
@@ -33,39 +58,82 @@ func (b *BillyFileSystem) Open(filename string) (billy.File, error) {
 	return b.OpenFile(filename, os.O_RDONLY, 0)
 }
 
-// OpenFile implements billy.Filesystem
+// OpenFile implements billy.Filesystem. The file content is held in memory,
+// shared by the open handles of the file, and written back to the underlying
+// FileSystem on Sync and Close.
 func (b *BillyFileSystem) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
 	filePath := filepath.Join(b.basePath, filename)
-	// Create parent directories if needed
-	if flag&os.O_CREATE != 0 {
-		dir := filepath.Dir(filePath)
-		if err := b.fs.MkdirAll(dir, 0755); err != nil {
-			return nil, err
-		}
-	}
 
-	// Read existing file if it exists
-	var data []byte
-	var err error
-	if flag&os.O_CREATE == 0 {
-		data, err = b.fs.ReadFile(filePath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil, err
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	content, isOpen := b.open[filePath]
+	created := false
+	if isOpen {
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, os.ErrExist
+		}
+	} else {
+		// Read existing content unless it is being replaced
+		data, err := b.fs.ReadFile(filePath)
+		switch {
+		case err == nil:
+			if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+				return nil, os.ErrExist
 			}
+		case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+			data = nil
+			created = true
+		default:
 			return nil, err
 		}
+		content = &fileContent{data: data}
 	}
 
-	return &billyFile{
+	f := &billyFile{
 		fs:       b.fs,
+		owner:    b,
 		name:     filename,
-		data:     data,
+		content:  content,
 		flag:     flag,
-		perm:     perm,
+		perm:     b.perm.ForFile(perm),
 		offset:   0,
 		basePath: b.basePath,
-	}, nil
+	}
+
+	// Like os.OpenFile, a created or truncated file exists once it is opened
+	if created || flag&os.O_TRUNC != 0 {
+		if err := b.fs.MkdirAll(filepath.Dir(filePath), b.perm.DirMode()); err != nil {
+			return nil, err
+		}
+		content.mu.Lock()
+		content.data = nil
+		content.dirty = true
+		content.mu.Unlock()
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.open == nil {
+		b.open = make(map[string]*fileContent)
+	}
+	content.refs++
+	b.open[filePath] = content
+
+	return f, nil
+}
+
+// release drops a handle of the file at path, forgetting its content once
+// no handle is left
+func (b *BillyFileSystem) release(path string, content *fileContent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	content.refs--
+	if content.refs == 0 && b.open[path] == content {
+		delete(b.open, path)
+	}
 }
 
 // Stat implements billy.Filesystem
@@ -75,29 +143,33 @@ func (b *BillyFileSystem) Stat(filename string) (os.FileInfo, error) {
 
 // Rename implements billy.Filesystem
 func (b *BillyFileSystem) Rename(oldpath, newpath string) error {
-	// Read the old file
-	old := filepath.Join(b.basePath, oldpath)
-	data, err := b.fs.ReadFile(old)
-	if err != nil {
-		return err
-	}
-
-	// Write to the new file
 	new := filepath.Join(b.basePath, newpath)
-	if err := b.fs.MkdirAll(filepath.Dir(new), 0755); err != nil {
-		return err
-	}
-	if err := b.fs.WriteFile(new, data, 0644); err != nil {
+	if err := b.fs.MkdirAll(filepath.Dir(new), b.perm.DirMode()); err != nil {
 		return err
 	}
 
-	// Remove the old file
-	return b.fs.Remove(old)
+	old := filepath.Join(b.basePath, oldpath)
+	b.forget(old, new)
+	return b.fs.Rename(old, new)
 }
 
 // Remove implements billy.Filesystem
 func (b *BillyFileSystem) Remove(filename string) error {
-	return b.fs.Remove(filepath.Join(b.basePath, filename))
+	path := filepath.Join(b.basePath, filename)
+	b.forget(path)
+	return b.fs.Remove(path)
+}
+
+// forget detaches the handles open at paths from the files there, so files
+// opened later read what the filesystem holds, like handles of a file that
+// was replaced or removed keep seeing the old file
+func (b *BillyFileSystem) forget(paths ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, path := range paths {
+		delete(b.open, path)
+	}
 }
 
 // Join implements billy.Filesystem
@@ -107,9 +179,18 @@ func (b *BillyFileSystem) Join(elem ...string) string {
 
 // TempFile implements billy.Filesystem
 func (b *BillyFileSystem) TempFile(dir, prefix string) (billy.File, error) {
-	// Create a temporary file name
-	name := filepath.Join(dir, prefix+time.Now().Format("20060102150405"))
-	return b.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	// Random names with O_EXCL, as os.CreateTemp does, so concurrent or
+	// rapid calls never share a file
+	for range 10000 {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := b.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+
+	return nil, fmt.Errorf("failed to create temp file in %s: %w", dir, os.ErrExist)
 }
 
 // ReadDir implements billy.Filesystem
@@ -117,6 +198,18 @@ func (b *BillyFileSystem) ReadDir(path string) ([]os.FileInfo, error) {
 	return b.fs.Readdir(filepath.Join(b.basePath, path))
 }
 
+// WalkDir walks the tree rooted at root below the base path, see
+// FileSystem.WalkDir. Paths passed to fn are relative to the base path.
+func (b *BillyFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return b.fs.WalkDir(filepath.Join(b.basePath, root), func(path string, d fs.DirEntry, err error) error {
+		rel, relErr := filepath.Rel(b.basePath, path)
+		if relErr != nil {
+			return relErr
+		}
+		return fn(rel, d, err)
+	})
+}
+
 // MkdirAll implements billy.Filesystem
 func (b *BillyFileSystem) MkdirAll(filename string, perm os.FileMode) error {
 	return b.fs.MkdirAll(filepath.Join(b.basePath, filename), perm)
@@ -124,19 +217,54 @@ func (b *BillyFileSystem) MkdirAll(filename string, perm os.FileMode) error {
 
 // Lstat implements billy.Filesystem
 func (b *BillyFileSystem) Lstat(filename string) (os.FileInfo, error) {
-	return b.fs.Stat(filepath.Join(b.basePath, filename))
+	return b.fs.Lstat(filepath.Join(b.basePath, filename))
 }
 
-// Symlink implements billy.Filesystem
+// Symlink implements billy.Filesystem. Like billy's chroot helper, absolute
+// targets are taken relative to the base path while relative targets are
+// stored as given, so links checked out by go-git keep their recorded text.
 func (b *BillyFileSystem) Symlink(target, link string) error {
-	return b.fs.Symlink(filepath.Join(b.basePath, target), filepath.Join(b.basePath, link))
+	target = filepath.FromSlash(target)
+	if filepath.IsAbs(target) {
+		target = filepath.Join(b.basePath, target)
+	}
+
+	linkPath := filepath.Join(b.basePath, link)
+	if err := b.fs.MkdirAll(filepath.Dir(linkPath), b.perm.DirMode()); err != nil {
+		return err
+	}
+
+	return b.fs.Symlink(target, linkPath)
 }
 
-// Readlink implements billy.Filesystem
+// Readlink implements billy.Filesystem. Targets inside the base path are
+// returned as absolute paths from the base path, undoing Symlink.
 func (b *BillyFileSystem) Readlink(link string) (string, error) {
-	// For now, we'll just return the link as is
-	// TODO: Implement proper symlink resolution
-	return link, nil
+	target, err := b.fs.Readlink(filepath.Join(b.basePath, link))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, ok := b.within(target); ok {
+		return string(filepath.Separator) + rel, nil
+	}
+	return target, nil
+}
+
+// within returns path relative to the base path if it lies inside it
+func (b *BillyFileSystem) within(path string) (string, bool) {
+	if filepath.IsAbs(path) != filepath.IsAbs(b.basePath) {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(b.basePath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		rel = ""
+	}
+	return rel, true
 }
 
 // Chroot implements billy.Filesystem
@@ -144,6 +272,7 @@ func (b *BillyFileSystem) Chroot(path string) (billy.Filesystem, error) {
 	return &BillyFileSystem{
 		fs:       b.fs,
 		basePath: filepath.Join(b.basePath, path),
+		perm:     b.perm,
 	}, nil
 }
 
@@ -157,15 +286,17 @@ func (b *BillyFileSystem) Capabilities() billy.Capability {
 	return billy.ReadCapability | billy.WriteCapability | billy.ReadAndWriteCapability
 }
 
-// billyFile implements billy.File
+// billyFile implements billy.File on top of the in-memory content of the file
 type billyFile struct {
 	fs       FileSystem
+	owner    *BillyFileSystem
 	name     string
-	data     []byte
+	content  *fileContent
 	flag     int
 	perm     os.FileMode
 	offset   int64
 	basePath string
+	closed   bool
 }
 
 // Name implements billy.File
@@ -173,29 +304,46 @@ func (f *billyFile) Name() string {
 	return f.name
 }
 
-// Write implements billy.File
-func (f *billyFile) Write(p []byte) (n int, err error) {
-	filePath := filepath.Join(f.basePath, f.name)
+// writable reports whether the file was opened for writing
+func (f *billyFile) writable() bool {
+	return f.flag&os.O_WRONLY != 0 || f.flag&os.O_RDWR != 0
+}
 
-	if f.flag&os.O_WRONLY == 0 && f.flag&os.O_RDWR == 0 {
+// Write implements billy.File. Data is written at the current offset, or at
+// the end with O_APPEND, and kept in memory until Sync or Close.
+func (f *billyFile) Write(p []byte) (n int, err error) {
+	if !f.writable() {
 		return 0, os.ErrPermission
 	}
 
-	// Create parent directories if needed
-	dir := filepath.Dir(filePath)
-	if err := f.fs.MkdirAll(dir, 0755); err != nil {
-		return 0, err
+	c := f.content
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(c.data))
 	}
 
-	// Append to the data
-	f.data = append(f.data, p...)
-	f.offset += int64(len(p))
+	end := f.offset + int64(len(p))
+	if size := int64(len(c.data)); end > size {
+		if end > int64(cap(c.data)) {
+			// Grow geometrically so a series of small writes stays linear
+			grown := make([]byte, size, max(end, 2*int64(cap(c.data))))
+			copy(grown, c.data)
+			c.data = grown
+		}
+		c.data = c.data[:end]
 
-	// Write to the filesystem
-	if err := f.fs.WriteFile(filePath, f.data, f.perm); err != nil {
-		return 0, err
+		// Writing past the end after a Seek leaves a zero-filled hole
+		if f.offset > size {
+			clear(c.data[size:f.offset])
+		}
 	}
 
+	copy(c.data[f.offset:], p)
+	f.offset = end
+	c.dirty = true
+
 	return len(p), nil
 }
 
@@ -206,16 +354,15 @@ func (f *billyFile) Read(p []byte) (n int, err error) {
 		return 0, os.ErrPermission
 	}
 
-	// If file doesn't exist and we're not creating it, return EOF
-	if len(f.data) == 0 && f.flag&os.O_CREATE == 0 {
-		return 0, io.EOF
-	}
+	c := f.content
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if f.offset >= int64(len(f.data)) {
+	if f.offset >= int64(len(c.data)) {
 		return 0, io.EOF
 	}
 
-	n = copy(p, f.data[f.offset:])
+	n = copy(p, c.data[f.offset:])
 	f.offset += int64(n)
 	return n, nil
 }
@@ -227,16 +374,22 @@ func (f *billyFile) ReadAt(p []byte, off int64) (n int, err error) {
 		return 0, os.ErrPermission
 	}
 
-	// If file doesn't exist and we're not creating it, return EOF
-	if len(f.data) == 0 && f.flag&os.O_CREATE == 0 {
-		return 0, io.EOF
+	if off < 0 {
+		return 0, os.ErrInvalid
 	}
 
-	if off >= int64(len(f.data)) {
+	c := f.content
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if off >= int64(len(c.data)) {
 		return 0, io.EOF
 	}
 
-	n = copy(p, f.data[off:])
+	n = copy(p, c.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
 	return n, nil
 }
 
@@ -249,7 +402,9 @@ func (f *billyFile) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		newOffset = f.offset + offset
 	case io.SeekEnd:
-		newOffset = int64(len(f.data)) + offset
+		f.content.mu.Lock()
+		newOffset = int64(len(f.content.data)) + offset
+		f.content.mu.Unlock()
 	default:
 		return 0, os.ErrInvalid
 	}
@@ -262,14 +417,33 @@ func (f *billyFile) Seek(offset int64, whence int) (int64, error) {
 	return f.offset, nil
 }
 
+// Sync writes buffered changes to the filesystem
+func (f *billyFile) Sync() error {
+	c := f.content
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	if err := f.fs.WriteFile(filepath.Join(f.basePath, f.name), c.data, f.perm); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
 // Close implements billy.File
 func (f *billyFile) Close() error {
-	filePath := filepath.Join(f.basePath, f.name)
-	// Write any remaining data
-	if f.flag&os.O_WRONLY != 0 || f.flag&os.O_RDWR != 0 {
-		return f.fs.WriteFile(filePath, f.data, f.perm)
+	if f.closed {
+		return nil
 	}
-	return nil
+	err := f.Sync()
+	f.closed = true
+	f.owner.release(filepath.Join(f.basePath, f.name), f.content)
+	return err
 }
 
 // Lock implements billy.File
@@ -286,21 +460,28 @@ func (f *billyFile) Unlock() error {
 
 // Truncate implements billy.File
 func (f *billyFile) Truncate(size int64) error {
-	filePath := filepath.Join(f.basePath, f.name)
+	if !f.writable() {
+		return os.ErrPermission
+	}
 
 	if size < 0 {
 		return os.ErrInvalid
 	}
 
-	if size > int64(len(f.data)) {
+	c := f.content
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if size > int64(len(c.data)) {
 		// Extend the file
 		newData := make([]byte, size)
-		copy(newData, f.data)
-		f.data = newData
+		copy(newData, c.data)
+		c.data = newData
 	} else {
 		// Truncate the file
-		f.data = f.data[:size]
+		c.data = c.data[:size]
 	}
 
-	return f.fs.WriteFile(filePath, f.data, f.perm)
+	c.dirty = true
+	return nil
 }
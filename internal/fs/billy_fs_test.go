@@ -0,0 +1,266 @@
+package fs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+func TestBillyFileSystem_Symlink(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	mockFS.MkdirAll("repo", 0755)
+	mockFS.WriteFile("repo/target.txt", []byte("test content"), 0644)
+	billyFS := NewBillyFileSystem(mockFS, "repo", Perm{})
+
+	// Absolute targets resolve inside the base path
+	if err := billyFS.Symlink("/target.txt", "links/abs"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+	data, err := mockFS.ReadFile("repo/links/abs")
+	if err != nil {
+		t.Fatalf("ReadFile through symlink failed: %v", err)
+	}
+	if string(data) != "test content" {
+		t.Errorf("symlink points to wrong content: got %s", data)
+	}
+
+	// Relative targets are stored as given
+	if err := billyFS.Symlink("target.txt", "links/rel"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	for link, want := range map[string]string{"links/abs": "/target.txt", "links/rel": "target.txt"} {
+		info, err := billyFS.Lstat(link)
+		if err != nil {
+			t.Fatalf("Lstat failed: %v", err)
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("Lstat did not report a symlink for %s: got %v", link, info.Mode())
+		}
+
+		target, err := billyFS.Readlink(link)
+		if err != nil {
+			t.Fatalf("Readlink failed: %v", err)
+		}
+		if target != want {
+			t.Errorf("Readlink returned wrong target for %s: got %s, want %s", link, target, want)
+		}
+	}
+}
+
+func TestBillyFileSystem_SymlinkRoundTrip(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	worktreeFS := NewBillyFileSystem(mockFS, "repo", Perm{})
+	storage := filesystem.NewStorage(NewBillyFileSystem(mockFS, filepath.Join("repo", ".git"), Perm{}), cache.NewObjectLRUDefault())
+
+	repo, err := git.InitWithOptions(storage, worktreeFS, git.InitOptions{})
+	if err != nil {
+		t.Fatalf("failed to initialize repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	mockFS.WriteFile("repo/target.txt", []byte("test content"), 0644)
+	if err := worktreeFS.Symlink("target.txt", "link"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	if _, err := wt.Add("."); err != nil {
+		t.Fatalf("failed to add files: %v", err)
+	}
+	hash, err := wt.Commit("add symlink", &git.CommitOptions{
+		Author: &object.Signature{Name: "dotman", Email: "dotman@localhost"},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// The link is recorded as a symlink whose blob is the target text
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatalf("failed to read commit: %v", err)
+	}
+	file, err := commit.File("link")
+	if err != nil {
+		t.Fatalf("failed to read link from commit: %v", err)
+	}
+	if file.Mode != filemode.Symlink {
+		t.Errorf("expected symlink mode, got %v", file.Mode)
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		t.Fatalf("failed to read blob: %v", err)
+	}
+	defer reader.Close()
+	content, _ := io.ReadAll(reader)
+	if string(content) != "target.txt" {
+		t.Errorf("expected blob 'target.txt', got '%s'", content)
+	}
+
+	// Checking out recreates the symlink with the same target
+	mockFS.Remove("repo/link")
+	if err := wt.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	target, err := worktreeFS.Readlink("link")
+	if err != nil {
+		t.Fatalf("Readlink failed: %v", err)
+	}
+	if target != "target.txt" {
+		t.Errorf("expected restored target 'target.txt', got '%s'", target)
+	}
+}
+
+func TestBillyFile_RandomAccess(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	billyFS := NewBillyFileSystem(mockFS, "repo", Perm{})
+
+	f, err := billyFS.Create("file")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Created files exist before anything is written
+	if _, err := mockFS.Stat("repo/file"); err != nil {
+		t.Fatalf("Create did not create the file: %v", err)
+	}
+
+	f.Write([]byte("hello world"))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	f.Write([]byte("HELLO"))
+	if _, err := f.Seek(13, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	f.Write([]byte("!"))
+
+	// Writes are buffered until Close
+	if data, _ := mockFS.ReadFile("repo/file"); len(data) != 0 {
+		t.Errorf("expected writes to be buffered, file has %q", data)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := mockFS.ReadFile("repo/file")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "HELLO world\x00\x00!"; string(data) != want {
+		t.Errorf("unexpected content: got %q, want %q", data, want)
+	}
+
+	// Opening without O_TRUNC keeps the content, O_APPEND writes at the end
+	f, err = billyFS.OpenFile("file", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	f.Write([]byte("?"))
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 12); n != 3 || err != io.EOF {
+		t.Errorf("ReadAt past the end: got n=%d err=%v, want n=3 err=EOF", n, err)
+	}
+	f.Close()
+
+	if _, err := billyFS.OpenFile("file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); !os.IsExist(err) {
+		t.Errorf("expected O_EXCL to fail on an existing file, got %v", err)
+	}
+}
+
+func TestBillyFileSystem_TempFile(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	billyFS := NewBillyFileSystem(mockFS, "repo", Perm{})
+
+	names := make(map[string]bool)
+	for range 100 {
+		f, err := billyFS.TempFile("tmp", "pack-")
+		if err != nil {
+			t.Fatalf("TempFile failed: %v", err)
+		}
+		if names[f.Name()] {
+			t.Fatalf("TempFile returned duplicate name %s", f.Name())
+		}
+		names[f.Name()] = true
+		f.Close()
+	}
+}
+
+func TestBillyFileSystem_SharedHandles(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	billyFS := NewBillyFileSystem(mockFS, "repo", Perm{})
+
+	// A reader opened while the file is written sees the writes, like go-git
+	// indexing a packfile as it is fetched
+	w, err := billyFS.Create("pack")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	r, err := billyFS.Open("pack")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("reader got %q, want %q", data, "hello")
+	}
+	r.Close()
+	w.Close()
+
+	// Once replaced, the file is read from the filesystem again
+	if err := mockFS.WriteFile("repo/other", []byte("replaced"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := billyFS.Rename("other", "pack"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	r, err = billyFS.Open("pack")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != "replaced" {
+		t.Errorf("reader got %q, want %q", data, "replaced")
+	}
+}
@@ -0,0 +1,28 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+)
+
+// binarySniffSize is how much of a file IsBinary looks at, the same amount
+// git checks before treating a file as binary
+const binarySniffSize = 8000
+
+// IsBinary reports whether the file at path looks binary, i.e. has a NUL
+// byte near its start
+func IsBinary(fsys FileSystem, path string) (bool, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return bytes.IndexByte(buf[:n], 0) != -1, nil
+}
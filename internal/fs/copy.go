@@ -0,0 +1,297 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+)
+
+// copyBufferSize is the chunk size used to stream and compare file contents
+const copyBufferSize = 32 * 1024
+
+// CopyOptions tunes CopyDir and VerifyDir
+type CopyOptions struct {
+	// Exclude skips entries by their path relative to the copied directory.
+	// Excluded directories are skipped with everything below them. VerifyDir
+	// must be given the same Exclude as the CopyDir it checks.
+	Exclude func(rel string, d fs.DirEntry) bool
+	// Progress is called with the size of each regular file once CopyDir
+	// copied it or VerifyDir verified it
+	Progress func(size int64)
+	// Perm limits the permissions CopyDir gives the copies
+	Perm Perm
+}
+
+// progress reports a regular file at path as done to the Progress of opts
+func (opts CopyOptions) progress(entry fs.DirEntry) {
+	if opts.Progress == nil {
+		return
+	}
+	var size int64
+	if info, err := entry.Info(); err == nil {
+		size = info.Size()
+	}
+	opts.Progress(size)
+}
+
+// excluded reports whether opts exclude the entry at rel
+func (opts CopyOptions) excluded(rel string, d fs.DirEntry) bool {
+	return rel != "." && opts.Exclude != nil && opts.Exclude(rel, d)
+}
+
+// CopyFile streams the content of src to dst and gives dst the permission
+// bits of src, within perm and the umask
+func CopyFile(fsys FileSystem, src, dst string, perm Perm) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	mode := perm.ForFile(info.Mode())
+	out, err := fsys.Create(dst, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.CopyBuffer(out, in, make([]byte, copyBufferSize)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// Create leaves the mode of a file that existed alone
+	return fsys.Chmod(dst, mode)
+}
+
+// CopySymlink recreates the symlink src at dst with the same target
+func CopySymlink(fsys FileSystem, src, dst string) error {
+	target, err := fsys.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	return fsys.Symlink(target, dst)
+}
+
+// CopyDir copies the directory tree src to dst. Symlinks inside the tree are
+// recreated as symlinks and permission bits are preserved, within the Perm
+// of opts and the umask.
+func CopyDir(fsys FileSystem, src, dst string, opts CopyOptions) error {
+	return fsys.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if opts.excluded(rel, entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dstPath := filepath.Join(dst, rel)
+
+		switch {
+		case rel != "." && entry.Type()&fs.ModeSymlink != 0:
+			return CopySymlink(fsys, path, dstPath)
+		case entry.IsDir():
+			info, err := fsys.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := fsys.MkdirAll(dstPath, opts.Perm.DirMode()); err != nil {
+				return err
+			}
+			return fsys.Chmod(dstPath, opts.Perm.ForDir(info.Mode()))
+		default:
+			if err := CopyFile(fsys, path, dstPath, opts.Perm); err != nil {
+				return err
+			}
+			opts.progress(entry)
+			return nil
+		}
+	})
+}
+
+// VerifyFile checks that dst has the same content as src, comparing both
+// files chunk by chunk
+func VerifyFile(fsys FileSystem, src, dst string) error {
+	srcFile, err := fsys.Open(src)
+	if err != nil {
+		return fmt.Errorf("error reading source file: %v", err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := fsys.Open(dst)
+	if err != nil {
+		return fmt.Errorf("error reading destination file: %v", err)
+	}
+	defer dstFile.Close()
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting source file info: %v", err)
+	}
+
+	dstInfo, err := dstFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error getting destination file info: %v", err)
+	}
+
+	if srcInfo.Size() != dstInfo.Size() {
+		return fmt.Errorf("file sizes differ: source=%d bytes, destination=%d bytes", srcInfo.Size(), dstInfo.Size())
+	}
+
+	srcBuf := make([]byte, copyBufferSize)
+	dstBuf := make([]byte, copyBufferSize)
+	var offset int64
+	for {
+		srcN, srcErr := io.ReadFull(srcFile, srcBuf)
+		if srcErr != nil && srcErr != io.EOF && srcErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("error reading source file content: %v", srcErr)
+		}
+
+		dstN, dstErr := io.ReadFull(dstFile, dstBuf)
+		if dstErr != nil && dstErr != io.EOF && dstErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("error reading destination file content: %v", dstErr)
+		}
+
+		if srcN != dstN {
+			return fmt.Errorf("file contents differ at byte %d", offset+int64(min(srcN, dstN)))
+		}
+		if !bytes.Equal(srcBuf[:srcN], dstBuf[:dstN]) {
+			for i := range srcN {
+				if srcBuf[i] != dstBuf[i] {
+					return fmt.Errorf("file contents differ at byte %d", offset+int64(i))
+				}
+			}
+		}
+		offset += int64(srcN)
+
+		if srcErr != nil {
+			return nil
+		}
+	}
+}
+
+// VerifySymlink checks that dst is a symlink with the same target as src
+func VerifySymlink(fsys FileSystem, src, dst string) error {
+	info, err := fsys.Lstat(dst)
+	if err != nil {
+		return fmt.Errorf("error reading destination symlink: %v", err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return fmt.Errorf("destination is not a symlink")
+	}
+
+	srcTarget, err := fsys.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("error reading source symlink: %v", err)
+	}
+
+	dstTarget, err := fsys.Readlink(dst)
+	if err != nil {
+		return fmt.Errorf("error reading destination symlink: %v", err)
+	}
+
+	if srcTarget != dstTarget {
+		return fmt.Errorf("symlink targets differ: source=%s, destination=%s", srcTarget, dstTarget)
+	}
+
+	return nil
+}
+
+// VerifyDir checks that dst is a complete copy of the directory tree src, as
+// made by CopyDir with the same options
+func VerifyDir(fsys FileSystem, src, dst string, opts CopyOptions) error {
+	return fsys.WalkDir(src, func(path string, srcEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading source directory: %v", err)
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if opts.excluded(rel, srcEntry) {
+			if srcEntry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dstPath := filepath.Join(dst, rel)
+
+		if rel == "." {
+			return verifyDirEntries(fsys, path, dstPath, rel, opts)
+		}
+
+		dstInfo, err := fsys.Lstat(dstPath)
+		if err != nil {
+			return fmt.Errorf("directory entries differ: source has %s, destination does not", rel)
+		}
+
+		switch {
+		case srcEntry.Type()&fs.ModeSymlink != 0:
+			if err := VerifySymlink(fsys, path, dstPath); err != nil {
+				return fmt.Errorf("error verifying symlink %s: %v", rel, err)
+			}
+		case srcEntry.IsDir():
+			if !dstInfo.IsDir() {
+				return fmt.Errorf("entry type mismatch: %s is a directory in source but not in destination", rel)
+			}
+			return verifyDirEntries(fsys, path, dstPath, rel, opts)
+		default:
+			if dstInfo.IsDir() {
+				return fmt.Errorf("entry type mismatch: %s is a file in source but a directory in destination", rel)
+			}
+			if err := VerifyFile(fsys, path, dstPath); err != nil {
+				return fmt.Errorf("error verifying file %s: %v", rel, err)
+			}
+			opts.progress(srcEntry)
+		}
+
+		return nil
+	})
+}
+
+// verifyDirEntries checks that the directory dst holds as many entries as the
+// directory src has entries that are not excluded. Each source entry is
+// checked when the walk reaches it, so together this catches entries missing
+// from either side.
+func verifyDirEntries(fsys FileSystem, src, dst, rel string, opts CopyOptions) error {
+	srcEntries, err := fsys.Readdir(src)
+	if err != nil {
+		return fmt.Errorf("error reading source directory entries: %v", err)
+	}
+
+	dstEntries, err := fsys.Readdir(dst)
+	if err != nil {
+		return fmt.Errorf("error reading destination directory entries: %v", err)
+	}
+
+	copied := 0
+	for _, info := range srcEntries {
+		if !opts.excluded(filepath.Join(rel, info.Name()), fs.FileInfoToDirEntry(info)) {
+			copied++
+		}
+	}
+
+	if copied != len(dstEntries) {
+		return fmt.Errorf("directory contents differ: source has %d entries, destination has %d entries", copied, len(dstEntries))
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package fs
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// copyBackends returns a mock and a memory filesystem holding the same files
+func copyBackends(t *testing.T, files map[string]*fstest.MapFile) map[string]FileSystem {
+	mockFS, err := NewMockFileSystem(files)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	t.Cleanup(mockFS.CleanUp)
+
+	memFS, err := NewMemoryFileSystem(files)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	return map[string]FileSystem{"mock": mockFS, "memory": memFS}
+}
+
+func TestCopyFile(t *testing.T) {
+	// Larger than the copy buffer so the content is streamed in chunks
+	large := bytes.Repeat([]byte("0123456789"), copyBufferSize/5)
+
+	for name, fsys := range copyBackends(t, map[string]*fstest.MapFile{
+		"src/script.sh": {Data: large, Mode: 0750},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			fsys.MkdirAll("dst", 0755)
+			if err := CopyFile(fsys, "src/script.sh", "dst/script.sh", Perm{}); err != nil {
+				t.Fatalf("CopyFile failed: %v", err)
+			}
+
+			data, err := fsys.ReadFile("dst/script.sh")
+			if err != nil || !bytes.Equal(data, large) {
+				t.Fatalf("CopyFile copied %d bytes (%v), want %d", len(data), err, len(large))
+			}
+			info, err := fsys.Stat("dst/script.sh")
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if info.Mode().Perm() != 0750 {
+				t.Errorf("CopyFile did not preserve the mode: got %v, want 0750", info.Mode().Perm())
+			}
+
+			if err := VerifyFile(fsys, "src/script.sh", "dst/script.sh"); err != nil {
+				t.Errorf("VerifyFile failed on an identical copy: %v", err)
+			}
+
+			// A change past the first chunk is reported at its offset
+			changed := bytes.Clone(large)
+			changed[copyBufferSize+3] = 'x'
+			fsys.WriteFile("dst/script.sh", changed, 0750)
+			err = VerifyFile(fsys, "src/script.sh", "dst/script.sh")
+			if err == nil || !strings.Contains(err.Error(), "differ at byte 32771") {
+				t.Errorf("expected content mismatch at byte 32771, got %v", err)
+			}
+
+			fsys.WriteFile("dst/script.sh", large[:10], 0750)
+			err = VerifyFile(fsys, "src/script.sh", "dst/script.sh")
+			if err == nil || !strings.Contains(err.Error(), "file sizes differ") {
+				t.Errorf("expected size mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	for name, fsys := range copyBackends(t, map[string]*fstest.MapFile{
+		"src/init.lua":        {Data: []byte("init"), Mode: 0644},
+		"src/private/key":     {Data: []byte("key"), Mode: 0600},
+		"src/.git/HEAD":       {Data: []byte("ref"), Mode: 0644},
+		"src/lua/plugins.lua": {Data: []byte("plugins"), Mode: 0644},
+		"src/lua/plugins.swp": {Data: []byte("swap"), Mode: 0644},
+		"src/lua/other/z.lua": {Data: []byte("z"), Mode: 0644},
+		"src/lua/other/a.lua": {Data: []byte("a"), Mode: 0644},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			fsys.Chmod("src/private", 0700)
+			if err := fsys.Symlink("src/init.lua", "src/link.lua"); err != nil {
+				t.Fatalf("failed to create symlink: %v", err)
+			}
+
+			var files int
+			var size int64
+			opts := CopyOptions{
+				Exclude: func(rel string, d fs.DirEntry) bool {
+					return d.Name() == ".git" || filepath.Ext(rel) == ".swp"
+				},
+				Progress: func(n int64) {
+					files++
+					size += n
+				},
+			}
+			if err := CopyDir(fsys, "src", "dst", opts); err != nil {
+				t.Fatalf("CopyDir failed: %v", err)
+			}
+			if files != 5 || size != 16 {
+				t.Errorf("CopyDir reported %d files of %d bytes, want 5 of 16", files, size)
+			}
+			files, size = 0, 0
+			if err := VerifyDir(fsys, "src", "dst", opts); err != nil {
+				t.Fatalf("VerifyDir failed on a fresh copy: %v", err)
+			}
+			if files != 5 || size != 16 {
+				t.Errorf("VerifyDir reported %d files of %d bytes, want 5 of 16", files, size)
+			}
+
+			for _, path := range []string{"dst/.git", "dst/lua/plugins.swp"} {
+				if _, err := fsys.Lstat(path); err == nil {
+					t.Errorf("excluded entry %s was copied", path)
+				}
+			}
+			if data, err := fsys.ReadFile("dst/lua/other/a.lua"); err != nil || string(data) != "a" {
+				t.Errorf("nested file was not copied: %q (%v)", data, err)
+			}
+
+			info, err := fsys.Stat("dst/private")
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if info.Mode().Perm() != 0700 {
+				t.Errorf("CopyDir did not preserve the directory mode: got %v, want 0700", info.Mode().Perm())
+			}
+
+			info, err = fsys.Lstat("dst/link.lua")
+			if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+				t.Fatalf("expected dst/link.lua to be a symlink (%v)", err)
+			}
+			if target, err := fsys.Readlink("dst/link.lua"); err != nil || target != "src/init.lua" {
+				t.Errorf("expected symlink to src/init.lua, got %q (%v)", target, err)
+			}
+
+			// Without the same exclusions the copy is incomplete
+			err = VerifyDir(fsys, "src", "dst", CopyOptions{})
+			if err == nil || !strings.Contains(err.Error(), "directory contents differ") {
+				t.Errorf("expected missing excluded entries to be reported, got %v", err)
+			}
+
+			// Extra, missing and mismatched entries are all reported
+			fsys.WriteFile("dst/extra.lua", []byte("extra"), 0644)
+			if err := VerifyDir(fsys, "src", "dst", opts); err == nil {
+				t.Error("expected an extra destination entry to be reported")
+			}
+			fsys.Remove("dst/extra.lua")
+
+			fsys.Remove("dst/lua/other/a.lua")
+			if err := VerifyDir(fsys, "src", "dst", opts); err == nil {
+				t.Error("expected a missing destination entry to be reported")
+			}
+			fsys.WriteFile("dst/lua/other/a.lua", []byte("a"), 0644)
+
+			fsys.Remove("dst/link.lua")
+			fsys.Symlink("src/lua/plugins.lua", "dst/link.lua")
+			err = VerifyDir(fsys, "src", "dst", opts)
+			if err == nil || !strings.Contains(err.Error(), "symlink targets differ") {
+				t.Errorf("expected a symlink target mismatch, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+)
+
+// NormalizeLineEndings converts CRLF line endings to LF in the text files at
+// or below path. Binary files and symlinks are left alone. It returns the
+// number of files changed.
+func NormalizeLineEndings(fsys FileSystem, path string) (int, error) {
+	changed := 0
+	err := fsys.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		binary, err := IsBinary(fsys, p)
+		if err != nil || binary {
+			return err
+		}
+
+		data, err := fsys.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(data, []byte("\r\n")) {
+			return nil
+		}
+
+		info, err := fsys.Stat(p)
+		if err != nil {
+			return err
+		}
+		if err := fsys.WriteFile(p, bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		changed++
+		return nil
+	})
+	return changed, err
+}
+
+// ToCRLF returns data with every line ending as CRLF, the line endings
+// Windows programs expect
+func ToCRLF(data []byte) []byte {
+	lf := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+}
+
+// CopyFileCRLF copies src to dst as CopyFile does, rendering the line
+// endings of a text file as CRLF. Binary files are copied as they are.
+func CopyFileCRLF(fsys FileSystem, src, dst string, perm Perm) error {
+	binary, err := IsBinary(fsys, src)
+	if err != nil {
+		return err
+	}
+	if binary {
+		return CopyFile(fsys, src, dst, perm)
+	}
+
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := fsys.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	mode := perm.ForFile(info.Mode())
+	if err := fsys.WriteFile(dst, ToCRLF(data), mode); err != nil {
+		return err
+	}
+
+	// WriteFile leaves the mode of a file that existed alone
+	return fsys.Chmod(dst, mode)
+}
+
+// VerifyFileCRLF checks that dst is what CopyFileCRLF renders from src
+func VerifyFileCRLF(fsys FileSystem, src, dst string) error {
+	binary, err := IsBinary(fsys, src)
+	if err != nil {
+		return fmt.Errorf("error reading source file: %v", err)
+	}
+	if binary {
+		return VerifyFile(fsys, src, dst)
+	}
+
+	srcData, err := fsys.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("error reading source file: %v", err)
+	}
+	dstData, err := fsys.ReadFile(dst)
+	if err != nil {
+		return fmt.Errorf("error reading destination file: %v", err)
+	}
+	if !bytes.Equal(ToCRLF(srcData), dstData) {
+		return fmt.Errorf("%s is not %s with CRLF line endings", dst, src)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"dir/crlf.txt":    {Data: []byte("a\r\nb\r\n"), Mode: 0600},
+		"dir/lf.txt":      {Data: []byte("a\nb\n"), Mode: 0644},
+		"dir/sub/mix.txt": {Data: []byte("a\r\nb\nc\r"), Mode: 0644},
+		"dir/image.bin":   {Data: []byte("\x00\r\n\x00"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	changed, err := NormalizeLineEndings(memFS, "dir")
+	if err != nil {
+		t.Fatalf("NormalizeLineEndings failed: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("NormalizeLineEndings changed %d files, want 2", changed)
+	}
+
+	want := map[string]string{
+		"dir/crlf.txt":    "a\nb\n",
+		"dir/lf.txt":      "a\nb\n",
+		"dir/sub/mix.txt": "a\nb\nc\r",
+		"dir/image.bin":   "\x00\r\n\x00",
+	}
+	for path, content := range want {
+		if data, err := memFS.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("%s has %q (%v), want %q", path, data, err, content)
+		}
+	}
+
+	info, err := memFS.Stat("dir/crlf.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("NormalizeLineEndings changed the mode to %v", info.Mode().Perm())
+	}
+}
+
+func TestCopyFileCRLF(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"src/lf.txt":    {Data: []byte("a\nb\r\nc"), Mode: 0600},
+		"src/image.bin": {Data: []byte("\x00\n\x00"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	want := map[string]string{
+		"lf.txt":    "a\r\nb\r\nc",
+		"image.bin": "\x00\n\x00",
+	}
+	for name, content := range want {
+		src, dst := "src/"+name, "dst-"+name
+		if err := CopyFileCRLF(memFS, src, dst, Perm{}); err != nil {
+			t.Fatalf("CopyFileCRLF failed: %v", err)
+		}
+		if data, err := memFS.ReadFile(dst); err != nil || string(data) != content {
+			t.Errorf("%s has %q (%v), want %q", dst, data, err, content)
+		}
+		if err := VerifyFileCRLF(memFS, src, dst); err != nil {
+			t.Errorf("VerifyFileCRLF failed for %s: %v", dst, err)
+		}
+	}
+
+	info, err := memFS.Stat("dst-lf.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("CopyFileCRLF set the mode to %v, want 0600", info.Mode().Perm())
+	}
+
+	if err := memFS.WriteFile("dst-lf.txt", []byte("a\nb\nc"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := VerifyFileCRLF(memFS, "src/lf.txt", "dst-lf.txt"); err == nil {
+		t.Error("expected VerifyFileCRLF to reject a copy with LF line endings")
+	}
+}
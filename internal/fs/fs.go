@@ -1,28 +1,109 @@
 package fs
 
 import (
+	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"syscall"
 )
 
+// File is an open file or directory returned by FileSystem.Open. *os.File
+// implements it.
+type File interface {
+	io.Reader
+	io.Closer
+	Stat() (os.FileInfo, error)
+	ReadDir(n int) ([]os.DirEntry, error)
+}
+
 // FileSystem is an interface that combines read and write filesystem operations
 type FileSystem interface {
 	// Read operations
-	Open(file string) (*os.File, error)
+	Open(file string) (File, error)
 	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Readlink(name string) (string, error)
 	ReadFile(name string) ([]byte, error)
 
 	// Write operations
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
 	MkdirAll(path string, perm os.FileMode) error
 	WriteFile(name string, data []byte, perm os.FileMode) error
+	// WriteFileSync is WriteFile that returns once the file and the directory
+	// entry naming it reached stable storage
+	WriteFileSync(name string, data []byte, perm os.FileMode) error
+	// AppendFile appends data to the named file, creating it with perm if it
+	// does not exist
+	AppendFile(name string, data []byte, perm os.FileMode) error
+	// Sync flushes the named file or directory to stable storage, so what
+	// was written to it survives a power loss
+	Sync(name string) error
 	Remove(name string) error
 	RemoveAll(path string) error
 	Symlink(oldname, newname string) error
+	// Link creates newname as a hard link to the file oldname
+	Link(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode os.FileMode) error
 
 	// User operations
 	UserHomeDir() (string, error)
 
+	// Disk operations
+	// FreeSpace returns the number of bytes available to the process on the
+	// filesystem holding path, or errors.ErrUnsupported when the platform
+	// cannot tell
+	FreeSpace(path string) (uint64, error)
+
 	// Path operations
 	Abs(path string) (string, error)
 	Rel(basepath, targpath string) (string, error)
+	// EvalSymlinks returns path with every symlink in it resolved, like
+	// filepath.EvalSymlinks. The path has to exist.
+	EvalSymlinks(path string) (string, error)
 	Readdir(path string) ([]os.FileInfo, error)
+	// WalkDir walks the tree rooted at root like filepath.WalkDir, in lexical
+	// order and without following symlinks, except that a root which is a
+	// symlink to a directory is walked as that directory
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// SameFile reports whether fi1 and fi2 describe the same file. It behaves
+// like os.SameFile and also understands infos from MemoryFileSystem.
+func SameFile(fi1, fi2 os.FileInfo) bool {
+	if n1, ok := fi1.Sys().(*memNode); ok {
+		n2, ok := fi2.Sys().(*memNode)
+		return ok && n1 == n2
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+// Junction creates link as a directory junction to the directory target.
+// Junctions only exist on Windows, and only the OS filesystem can hold them.
+func Junction(fsys FileSystem, target, link string) error {
+	if _, ok := fsys.(*OSFileSystem); !ok {
+		return &os.LinkError{Op: "junction", Old: target, New: link, Err: errors.ErrUnsupported}
+	}
+	return createJunction(target, link)
+}
+
+// IsReadOnly reports whether err says a write was refused, because the file
+// or directory is not writable or the filesystem is mounted read-only
+func IsReadOnly(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// walkRoot returns the path to hand to filepath.WalkDir so that a root which
+// is a symlink to a directory is followed, which a trailing separator does
+func walkRoot(root string) string {
+	info, err := os.Lstat(root)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return root
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return root
+	}
+	return root + string(filepath.Separator)
 }
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriteFileSync(t *testing.T) {
+	for name, fsys := range copyBackends(t, map[string]*fstest.MapFile{
+		"journal/log/00000001.jsonl": {Data: []byte("{}\n"), Mode: 0644},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			if err := fsys.WriteFileSync("journal/index.json", []byte("[]"), 0644); err != nil {
+				t.Fatalf("WriteFileSync failed: %v", err)
+			}
+			if data, err := fsys.ReadFile("journal/index.json"); err != nil || string(data) != "[]" {
+				t.Errorf("WriteFileSync wrote %q (%v)", data, err)
+			}
+			if err := fsys.WriteFileSync("journal/index.json", []byte("[1]"), 0644); err != nil {
+				t.Fatalf("WriteFileSync failed to overwrite: %v", err)
+			}
+			if data, _ := fsys.ReadFile("journal/index.json"); string(data) != "[1]" {
+				t.Errorf("WriteFileSync did not truncate, got %q", data)
+			}
+			// The new content is renamed in place, no temporary file is left
+			if infos, err := fsys.Readdir("journal"); err != nil || len(infos) != 2 {
+				t.Errorf("expected only index.json next to log, got %d entries (%v)", len(infos), err)
+			}
+
+			// Files and directories can be synced after other writes
+			if err := fsys.AppendFile("journal/log/00000001.jsonl", []byte("{}\n"), 0644); err != nil {
+				t.Fatalf("AppendFile failed: %v", err)
+			}
+			for _, path := range []string{"journal/log/00000001.jsonl", "journal/log"} {
+				if err := fsys.Sync(path); err != nil {
+					t.Errorf("Sync(%s) failed: %v", path, err)
+				}
+			}
+			if err := fsys.Sync("journal/missing"); !os.IsNotExist(err) {
+				t.Errorf("expected not exist error syncing a missing file, got %v", err)
+			}
+		})
+	}
+}
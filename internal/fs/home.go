@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ExpandHome expands a leading ~ to the home directory of fsys, so ~/.zshrc
+// names the same file on every machine. Other paths are returned as they are.
+func ExpandHome(fsys FileSystem, path string) (string, error) {
+	rest, ok := cutHome(path)
+	if !ok {
+		return path, nil
+	}
+	home, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, filepath.FromSlash(rest)), nil
+}
+
+// ContractHome returns path relative to the home directory of fsys in the
+// ~/ form ExpandHome expands, with forward slashes so it reads the same on
+// every platform. Paths outside the home directory are returned as they are.
+func ContractHome(fsys FileSystem, path string) string {
+	if path == "" {
+		return path
+	}
+	if _, ok := cutHome(path); ok {
+		return path
+	}
+	home, err := fsys.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(home, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	if rel == "." {
+		return "~"
+	}
+	return "~/" + filepath.ToSlash(rel)
+}
+
+// cutHome returns what follows a leading ~ or ~/, reporting whether path has
+// one. ~user is not expanded.
+func cutHome(path string) (string, bool) {
+	if path == "~" {
+		return "", true
+	}
+	for _, prefix := range []string{"~/", "~" + string(filepath.Separator)} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// AbsHome returns the absolute form of a path given by the user, expanding a
+// leading ~ first. Shells leave the ~ of --path=~/.zshrc alone.
+func AbsHome(fsys FileSystem, path string) (string, error) {
+	path, err := ExpandHome(fsys, path)
+	if err != nil {
+		return "", err
+	}
+	return fsys.Abs(path)
+}
@@ -0,0 +1,45 @@
+package fs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHomePaths(t *testing.T) {
+	fsys, err := NewMemoryFileSystemWithHome(nil, "/home/alice")
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		contracted string
+	}{
+		{path: "/home/alice/.zshrc", contracted: "~/.zshrc"},
+		{path: "/home/alice/.config/nvim", contracted: "~/.config/nvim"},
+		{path: "/home/alice", contracted: "~"},
+		{path: "/home/alicia/.zshrc", contracted: "/home/alicia/.zshrc"},
+		{path: "/etc/hosts", contracted: "/etc/hosts"},
+		{path: "", contracted: ""},
+	}
+	for _, tt := range tests {
+		contracted := ContractHome(fsys, filepath.FromSlash(tt.path))
+		if contracted != tt.contracted {
+			t.Errorf("ContractHome(%q) = %q, expected %q", tt.path, contracted, tt.contracted)
+		}
+		if tt.path == "" {
+			continue
+		}
+		expanded, err := ExpandHome(fsys, contracted)
+		if err != nil || expanded != filepath.FromSlash(tt.path) {
+			t.Errorf("ExpandHome(%q) = %q (%v), expected %q", contracted, expanded, err, tt.path)
+		}
+	}
+
+	// ~user and a ~ inside a name are not the home directory
+	for _, path := range []string{"~bob/.zshrc", "notes~/a"} {
+		if expanded, _ := ExpandHome(fsys, path); expanded != path {
+			t.Errorf("ExpandHome(%q) = %q, expected it unchanged", path, expanded)
+		}
+	}
+}
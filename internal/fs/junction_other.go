@@ -0,0 +1,13 @@
+//go:build !windows
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// createJunction fails, junctions only exist on Windows
+func createJunction(target, link string) error {
+	return fmt.Errorf("directory junctions only exist on Windows: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package fs
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// createJunction creates link as a directory junction to target. Unlike a
+// symlink, a junction needs neither administrator rights nor developer mode.
+func createJunction(target, link string) error {
+	out, err := exec.Command("cmd", "/c", "mklink", "/J", link, target).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mklink /J %s: %s: %w", link, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
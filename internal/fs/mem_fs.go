@@ -0,0 +1,726 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// maxSymlinkHops bounds symlink resolution, like the kernel's ELOOP limit
+const maxSymlinkHops = 40
+
+var (
+	errNotDir    = errors.New("not a directory")
+	errIsDir     = errors.New("is a directory")
+	errNotEmpty  = errors.New("directory not empty")
+	errNotLink   = errors.New("not a symlink")
+	errLinkLoops = errors.New("too many levels of symbolic links")
+)
+
+// MemoryFileSystem implements FileSystem in memory for testing. It is a
+// drop-in replacement for MockFileSystem that never touches the disk: paths
+// are resolved from its root, so "/a" and "a" name the same file, and
+// symlink targets are resolved from the root as well.
+type MemoryFileSystem struct {
+	mu      sync.Mutex
+	nodes   map[string]*memNode
+	homeDir string
+	// free is what FreeSpace reports, unlimited unless set by SetFreeSpace
+	free uint64
+}
+
+// memNode is a file, directory or symlink. FileInfo.Sys returns it, which
+// lets SameFile compare files.
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string
+	modTime time.Time
+}
+
+// NewMemoryFileSystem creates a new MemoryFileSystem
+func NewMemoryFileSystem(files map[string]*fstest.MapFile) (*MemoryFileSystem, error) {
+	return NewMemoryFileSystemWithHome(files, "/home/test")
+}
+
+// NewMemoryFileSystemWithHome creates a new MemoryFileSystem with a custom home directory
+func NewMemoryFileSystemWithHome(files map[string]*fstest.MapFile, homeDir string) (*MemoryFileSystem, error) {
+	m := &MemoryFileSystem{
+		nodes:   map[string]*memNode{".": {mode: fs.ModeDir | 0755, modTime: time.Now()}},
+		homeDir: homeDir,
+		free:    math.MaxUint64,
+	}
+
+	for key, val := range files {
+		if err := m.MkdirAll(filepath.Dir(key), 0755); err != nil {
+			return nil, err
+		}
+		if err := m.WriteFile(key, val.Data, val.Mode); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// CleanUp implements the MockFileSystem API, there is nothing to remove
+func (m *MemoryFileSystem) CleanUp() {}
+
+// DumpTree lists every path in the filesystem
+func (m *MemoryFileSystem) DumpTree() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.nodes))
+	for p := range m.nodes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return strings.Join(paths, "\n") + "\n"
+}
+
+// clean maps a path to its key in the node map
+func clean(name string) string {
+	p := strings.TrimPrefix(filepath.Clean(string(filepath.Separator)+name), string(filepath.Separator))
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// resolve follows symlinks in name and returns the key of the node it names.
+// The last element is only followed if followLast is set. The returned key
+// may not exist, but its parent directory does.
+func (m *MemoryFileSystem) resolve(op, name string, followLast bool) (string, error) {
+	p := clean(name)
+
+	for hops := 0; hops <= maxSymlinkHops; hops++ {
+		if p == "." {
+			return p, nil
+		}
+
+		parts := strings.Split(p, string(filepath.Separator))
+		cur := "."
+		restarted := false
+		for i, part := range parts {
+			next := filepath.Join(cur, part)
+			last := i == len(parts)-1
+
+			n, ok := m.nodes[next]
+			if !ok {
+				if last {
+					return next, nil
+				}
+				return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+
+			if n.mode&fs.ModeSymlink != 0 && (!last || followLast) {
+				p = clean(filepath.Join(append([]string{n.target}, parts[i+1:]...)...))
+				restarted = true
+				break
+			}
+
+			if !last && !n.mode.IsDir() {
+				return "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+			}
+			cur = next
+		}
+
+		if !restarted {
+			return p, nil
+		}
+	}
+
+	return "", &fs.PathError{Op: op, Path: name, Err: errLinkLoops}
+}
+
+// lookup resolves name and returns its node
+func (m *MemoryFileSystem) lookup(op, name string, followLast bool) (string, *memNode, error) {
+	p, err := m.resolve(op, name, followLast)
+	if err != nil {
+		return "", nil, err
+	}
+
+	n, ok := m.nodes[p]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return p, n, nil
+}
+
+// create resolves name for a new node, requiring its parent directory
+func (m *MemoryFileSystem) create(op, name string, followLast bool) (string, error) {
+	p, err := m.resolve(op, name, followLast)
+	if err != nil {
+		return "", err
+	}
+
+	parent, ok := m.nodes[filepath.Dir(p)]
+	if !ok {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return p, nil
+}
+
+// children returns the keys directly below the directory p
+func (m *MemoryFileSystem) children(p string) []string {
+	var keys []string
+	for key := range m.nodes {
+		if key != "." && filepath.Dir(key) == p {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// descendants returns the keys below p at any depth
+func (m *MemoryFileSystem) descendants(p string) []string {
+	var keys []string
+	prefix := p + string(filepath.Separator)
+	for key := range m.nodes {
+		if (p == "." && key != ".") || strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Open implements FileSystem
+func (m *MemoryFileSystem) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, n, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &memFile{info: memFileInfo{name: filepath.Base(clean(name)), node: n}}
+	if n.mode.IsDir() {
+		for _, key := range m.children(p) {
+			info := memFileInfo{name: filepath.Base(key), node: m.nodes[key]}
+			f.entries = append(f.entries, fs.FileInfoToDirEntry(info))
+		}
+	} else {
+		f.data = append([]byte(nil), n.data...)
+	}
+
+	return f, nil
+}
+
+// Stat implements FileSystem
+func (m *MemoryFileSystem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(clean(name)), node: n}, nil
+}
+
+// Lstat implements FileSystem
+func (m *MemoryFileSystem) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, n, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(p), node: n}, nil
+}
+
+// Readlink implements FileSystem
+func (m *MemoryFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotLink}
+	}
+	return n.target, nil
+}
+
+// ReadFile implements FileSystem
+func (m *MemoryFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// MkdirAll implements FileSystem
+func (m *MemoryFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := ""
+	for _, part := range strings.Split(clean(path), string(filepath.Separator)) {
+		prefix = filepath.Join(prefix, part)
+
+		p, err := m.resolve("mkdir", prefix, true)
+		if err != nil {
+			return err
+		}
+
+		if n, ok := m.nodes[p]; ok {
+			if !n.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+			}
+			continue
+		}
+		m.nodes[p] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+
+	return nil
+}
+
+// Create implements FileSystem. Written data becomes visible on Close.
+func (m *MemoryFileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	// The file exists, empty, from the moment it is created
+	if err := m.WriteFile(name, nil, perm); err != nil {
+		return nil, err
+	}
+	return &memWriter{fs: m, name: name, perm: perm}, nil
+}
+
+// WriteFile implements FileSystem
+func (m *MemoryFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.create("open", name, true)
+	if err != nil {
+		return err
+	}
+
+	// Existing files keep their identity and permissions, like os.WriteFile
+	if n, ok := m.nodes[p]; ok {
+		if n.mode.IsDir() {
+			return &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		n.data = append([]byte(nil), data...)
+		n.modTime = time.Now()
+		return nil
+	}
+
+	m.nodes[p] = &memNode{mode: perm.Perm(), data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+// WriteFileSync implements FileSystem. Memory has no stable storage to
+// wait for.
+func (m *MemoryFileSystem) WriteFileSync(name string, data []byte, perm os.FileMode) error {
+	return m.WriteFile(name, data, perm)
+}
+
+// Sync implements FileSystem, only checking that name exists
+func (m *MemoryFileSystem) Sync(name string) error {
+	_, err := m.Lstat(name)
+	return err
+}
+
+// AppendFile implements FileSystem
+func (m *MemoryFileSystem) AppendFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.create("open", name, true)
+	if err != nil {
+		return err
+	}
+
+	if n, ok := m.nodes[p]; ok {
+		if n.mode.IsDir() {
+			return &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		n.data = append(n.data, data...)
+		n.modTime = time.Now()
+		return nil
+	}
+
+	m.nodes[p] = &memNode{mode: perm.Perm(), data: append([]byte(nil), data...), modTime: time.Now()}
+	return nil
+}
+
+// Remove implements FileSystem
+func (m *MemoryFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, n, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() && len(m.children(p)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+
+	delete(m.nodes, p)
+	return nil
+}
+
+// RemoveAll implements FileSystem
+func (m *MemoryFileSystem) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.resolve("removeall", path, false)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, key := range m.descendants(p) {
+		delete(m.nodes, key)
+	}
+	if p != "." {
+		delete(m.nodes, p)
+	}
+	return nil
+}
+
+// Symlink implements FileSystem. The target is stored as given.
+func (m *MemoryFileSystem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.create("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[p]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+
+	m.nodes[p] = &memNode{mode: fs.ModeSymlink | 0777, target: oldname, modTime: time.Now()}
+	return nil
+}
+
+// Link implements FileSystem. Both names share the node, so SameFile
+// reports them as the same file and a write through one shows in the other.
+func (m *MemoryFileSystem) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("link", oldname, false)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrPermission}
+	}
+
+	p, err := m.create("link", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[p]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+
+	m.nodes[p] = n
+	return nil
+}
+
+// Rename implements FileSystem
+func (m *MemoryFileSystem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, n, err := m.lookup("rename", oldpath, false)
+	if err != nil {
+		return err
+	}
+
+	to, err := m.create("rename", newpath, false)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if strings.HasPrefix(to, from+string(filepath.Separator)) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrInvalid}
+	}
+
+	if existing, ok := m.nodes[to]; ok {
+		if existing.mode.IsDir() && !n.mode.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errIsDir}
+		}
+		if !existing.mode.IsDir() && n.mode.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errNotDir}
+		}
+		if existing.mode.IsDir() && len(m.children(to)) > 0 {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errNotEmpty}
+		}
+	}
+
+	for _, key := range m.descendants(from) {
+		m.nodes[to+strings.TrimPrefix(key, from)] = m.nodes[key]
+		delete(m.nodes, key)
+	}
+	m.nodes[to] = n
+	delete(m.nodes, from)
+
+	return nil
+}
+
+// Chmod implements FileSystem
+func (m *MemoryFileSystem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, n, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+
+	n.mode = n.mode&fs.ModeType | mode.Perm()
+	return nil
+}
+
+// UserHomeDir implements FileSystem
+func (m *MemoryFileSystem) UserHomeDir() (string, error) {
+	return m.homeDir, nil
+}
+
+// FreeSpace implements FileSystem
+func (m *MemoryFileSystem) FreeSpace(path string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, _, err := m.lookup("statfs", path, true); err != nil {
+		return 0, err
+	}
+	return m.free, nil
+}
+
+// SetFreeSpace sets the number of bytes FreeSpace reports, so tests can
+// simulate a full disk
+func (m *MemoryFileSystem) SetFreeSpace(free uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.free = free
+}
+
+// Abs implements FileSystem
+func (m *MemoryFileSystem) Abs(path string) (string, error) {
+	// Like the mock filesystem, paths are returned as is
+	return path, nil
+}
+
+// EvalSymlinks implements FileSystem
+func (m *MemoryFileSystem) EvalSymlinks(path string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, _, err := m.lookup("evalsymlinks", path, true)
+	return p, err
+}
+
+// Rel implements FileSystem
+func (m *MemoryFileSystem) Rel(basepath, targpath string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(basepath), filepath.Clean(targpath))
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", os.ErrInvalid
+	}
+	return rel, nil
+}
+
+// Readdir implements FileSystem
+func (m *MemoryFileSystem) Readdir(path string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, n, err := m.lookup("readdir", path, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: path, Err: errNotDir}
+	}
+
+	var infos []os.FileInfo
+	for _, key := range m.children(p) {
+		infos = append(infos, memFileInfo{name: filepath.Base(key), node: m.nodes[key]})
+	}
+	return infos, nil
+}
+
+// memFileInfo implements fs.FileInfo for a memNode
+type memFileInfo struct {
+	name string
+	node *memNode
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memFileInfo) ModTime() time.Time { return i.node.modTime }
+func (i memFileInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return i.node }
+
+// Size is the length of the target for a symlink, as lstat(2) reports it
+func (i memFileInfo) Size() int64 {
+	if i.node.mode&fs.ModeSymlink != 0 {
+		return int64(len(i.node.target))
+	}
+	return int64(len(i.node.data))
+}
+
+// memFile implements File over a snapshot taken when it was opened
+type memFile struct {
+	info    memFileInfo
+	data    []byte
+	offset  int
+	entries []fs.DirEntry
+}
+
+// Read implements File
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: errIsDir}
+	}
+	if f.offset >= len(f.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+// Close implements File
+func (f *memFile) Close() error {
+	return nil
+}
+
+// Stat implements File
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// ReadDir implements File with the semantics of os.File.ReadDir
+func (f *memFile) ReadDir(n int) ([]os.DirEntry, error) {
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: f.info.name, Err: errNotDir}
+	}
+
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// WalkDir implements FileSystem
+func (m *MemoryFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := m.Lstat(root)
+	if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if target, err := m.Stat(root); err == nil && target.IsDir() {
+			info = target
+		}
+	}
+
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = m.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir recursively descends path, following the rules of filepath.WalkDir
+func (m *MemoryFileSystem) walkDir(path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			// Successfully skipped directory
+			err = nil
+		}
+		return err
+	}
+
+	infos, err := m.Readdir(path)
+	if err != nil {
+		// Second call, to report the ReadDir error
+		if err := fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, info := range infos {
+		if err := m.walkDir(filepath.Join(path, info.Name()), fs.FileInfoToDirEntry(info), fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// memWriter buffers data written to a file created in a MemoryFileSystem
+type memWriter struct {
+	fs   *MemoryFileSystem
+	name string
+	perm os.FileMode
+	buf  bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close implements io.Closer
+func (w *memWriter) Close() error {
+	return w.fs.WriteFile(w.name, w.buf.Bytes(), w.perm)
+}
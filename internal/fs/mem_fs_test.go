@@ -0,0 +1,271 @@
+package fs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemoryFileSystem_BasicOperations(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"dir/test.txt": {Data: []byte("test content"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	data, err := memFS.ReadFile("/dir/test.txt")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != "test content" {
+		t.Errorf("ReadFile returned wrong content: got %s", data)
+	}
+
+	// Writing into a missing directory fails like it does on disk
+	if err := memFS.WriteFile("missing/test.txt", nil, 0644); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	if err := memFS.AppendFile("dir/test.txt", []byte(" appended"), 0644); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if err := memFS.AppendFile("dir/new.txt", []byte("new"), 0644); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if data, _ := memFS.ReadFile("dir/test.txt"); string(data) != "test content appended" {
+		t.Errorf("AppendFile did not append: got %s", data)
+	}
+	if data, _ := memFS.ReadFile("dir/new.txt"); string(data) != "new" {
+		t.Errorf("AppendFile did not create the file: got %s", data)
+	}
+
+	if err := memFS.Remove("dir"); err == nil {
+		t.Error("Remove should fail on a non-empty directory")
+	}
+	if err := memFS.RemoveAll("dir"); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if _, err := memFS.Stat("dir/test.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected RemoveAll to delete the directory contents, got %v", err)
+	}
+	if err := memFS.RemoveAll("dir"); err != nil {
+		t.Errorf("RemoveAll on a missing path should succeed, got %v", err)
+	}
+}
+
+func TestMemoryFileSystem_Symlink(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"data/nvim/init.lua": {Data: []byte("nvim"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	memFS.MkdirAll("home/.config", 0755)
+	if err := memFS.Symlink("data/nvim", "home/.config/nvim"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	// Symlinked directories are followed in the middle of a path
+	data, err := memFS.ReadFile("home/.config/nvim/init.lua")
+	if err != nil {
+		t.Fatalf("ReadFile through symlink failed: %v", err)
+	}
+	if string(data) != "nvim" {
+		t.Errorf("symlink points to wrong content: got %s", data)
+	}
+
+	info, err := memFS.Lstat("home/.config/nvim")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat did not report a symlink: got %v", info.Mode())
+	}
+
+	linked, err := memFS.Stat("home/.config/nvim")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	target, err := memFS.Stat("data/nvim")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !linked.IsDir() || !SameFile(linked, target) {
+		t.Error("Stat should describe the directory the symlink points to")
+	}
+
+	if got, err := memFS.Readlink("home/.config/nvim"); err != nil || got != "data/nvim" {
+		t.Errorf("Readlink returned %q (%v), want data/nvim", got, err)
+	}
+	if got, err := memFS.EvalSymlinks("home/.config/nvim/init.lua"); err != nil || got != "data/nvim/init.lua" {
+		t.Errorf("EvalSymlinks returned %q (%v), want data/nvim/init.lua", got, err)
+	}
+
+	// Dangling links and loops are errors, not hangs
+	memFS.Symlink("nowhere", "dangling")
+	if _, err := memFS.Stat("dangling"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error for a dangling symlink, got %v", err)
+	}
+	memFS.Symlink("loop-b", "loop-a")
+	memFS.Symlink("loop-a", "loop-b")
+	if _, err := memFS.Stat("loop-a"); err == nil {
+		t.Error("expected error for a symlink loop")
+	}
+
+	// Removing a symlink leaves its target alone
+	if err := memFS.RemoveAll("home/.config/nvim"); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if _, err := memFS.Stat("data/nvim/init.lua"); err != nil {
+		t.Errorf("RemoveAll on a symlink removed its target: %v", err)
+	}
+}
+
+func TestMemoryFileSystem_RenameChmod(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"old/a.txt":     {Data: []byte("a"), Mode: 0644},
+		"old/sub/b.txt": {Data: []byte("b"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	if err := memFS.Rename("old", "new"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := memFS.Stat("old"); !os.IsNotExist(err) {
+		t.Errorf("Rename left the old directory in place: %v", err)
+	}
+	if data, err := memFS.ReadFile("new/sub/b.txt"); err != nil || string(data) != "b" {
+		t.Errorf("Rename did not move nested files: %q (%v)", data, err)
+	}
+
+	if err := memFS.Chmod("new/a.txt", 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	info, err := memFS.Stat("new/a.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode() != 0600 {
+		t.Errorf("Chmod did not change the mode: got %v, want 0600", info.Mode())
+	}
+}
+
+func TestMemoryFileSystem_Open(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"dir/a.txt": {Data: []byte("a"), Mode: 0644},
+		"dir/b.txt": {Data: []byte("b"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	memFS.MkdirAll("dir/sub", 0755)
+
+	dir, err := memFS.Open("dir")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer dir.Close()
+
+	entries, err := dir.ReadDir(2)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("ReadDir(2) returned %d entries (%v), want 2", len(entries), err)
+	}
+	if entries[0].Name() != "a.txt" || entries[1].Name() != "b.txt" {
+		t.Errorf("ReadDir returned entries out of order: %s, %s", entries[0].Name(), entries[1].Name())
+	}
+	entries, _ = dir.ReadDir(2)
+	if len(entries) != 1 || !entries[0].IsDir() {
+		t.Fatalf("expected the sub directory last, got %v", entries)
+	}
+	if _, err := dir.ReadDir(2); err != io.EOF {
+		t.Errorf("expected EOF after the last entry, got %v", err)
+	}
+
+	file, err := memFS.Open("dir/a.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil || string(data) != "a" {
+		t.Errorf("Read returned %q (%v), want a", data, err)
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	osRoot := t.TempDir()
+
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	memFS, err := NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	backends := map[string]struct {
+		fsys FileSystem
+		root string
+	}{
+		"os":     {NewOSFileSystem(), osRoot},
+		"mock":   {mockFS, "root"},
+		"memory": {memFS, "root"},
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			fsys, root := backend.fsys, backend.root
+			fsys.MkdirAll(filepath.Join(root, "tree/b/skipped"), 0755)
+			fsys.WriteFile(filepath.Join(root, "tree/a.txt"), []byte("a"), 0644)
+			fsys.WriteFile(filepath.Join(root, "tree/b/c.txt"), []byte("c"), 0644)
+			fsys.WriteFile(filepath.Join(root, "tree/b/skipped/d.txt"), []byte("d"), 0644)
+			fsys.Symlink(filepath.Join(root, "tree/b"), filepath.Join(root, "tree/link"))
+			fsys.Symlink(filepath.Join(root, "tree"), filepath.Join(root, "rootlink"))
+
+			// Symlinks inside the tree are reported but not followed, a
+			// symlinked root is walked as the directory it points to
+			start := filepath.Join(root, "rootlink")
+			var visited []string
+			err := fsys.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				rel, _ := filepath.Rel(start, path)
+				if d.IsDir() && d.Name() == "skipped" {
+					return filepath.SkipDir
+				}
+				if d.Type()&fs.ModeSymlink != 0 {
+					rel += "@"
+				}
+				visited = append(visited, rel)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkDir failed: %v", err)
+			}
+
+			want := []string{".", "a.txt", "b", "b/c.txt", "link@"}
+			if strings.Join(visited, ",") != strings.Join(want, ",") {
+				t.Errorf("WalkDir visited %v, want %v", visited, want)
+			}
+
+			if err := fsys.WalkDir(filepath.Join(root, "missing"), func(path string, d fs.DirEntry, err error) error {
+				return err
+			}); !os.IsNotExist(err) {
+				t.Errorf("expected not exist error for a missing root, got %v", err)
+			}
+		})
+	}
+}
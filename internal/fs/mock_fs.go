@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -73,12 +74,32 @@ func (m *MockFileSystem) MkdirAll(path string, perm os.FileMode) error {
 	return os.MkdirAll(dirPath, perm)
 }
 
+// Create opens a file in the mock filesystem for writing
+func (m *MockFileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Join(m.rootDir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
 // WriteFile adds a file to the mock filesystem
 func (m *MockFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
 	filePath := filepath.Join(m.rootDir, name)
 	return os.WriteFile(filePath, data, perm)
 }
 
+// WriteFileSync implements FileSystem
+func (m *MockFileSystem) WriteFileSync(name string, data []byte, perm os.FileMode) error {
+	return writeFileSync(filepath.Join(m.rootDir, name), data, perm)
+}
+
+// Sync implements FileSystem
+func (m *MockFileSystem) Sync(name string) error {
+	return syncPath(filepath.Join(m.rootDir, name))
+}
+
+// AppendFile implements FileSystem
+func (m *MockFileSystem) AppendFile(name string, data []byte, perm os.FileMode) error {
+	return appendFile(filepath.Join(m.rootDir, name), data, perm)
+}
+
 // ReadFile reads a file from the mock filesystem
 func (m *MockFileSystem) ReadFile(name string) ([]byte, error) {
 	filePath := filepath.Join(m.rootDir, name)
@@ -104,17 +125,58 @@ func (m *MockFileSystem) Symlink(oldname, newname string) error {
 	return os.Symlink(old, new)
 }
 
+// Link implements FileSystem
+func (m *MockFileSystem) Link(oldname, newname string) error {
+	return os.Link(filepath.Join(m.rootDir, oldname), filepath.Join(m.rootDir, newname))
+}
+
+// Rename implements FileSystem
+func (m *MockFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(filepath.Join(m.rootDir, oldpath), filepath.Join(m.rootDir, newpath))
+}
+
+// Chmod implements FileSystem
+func (m *MockFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(filepath.Join(m.rootDir, name), mode)
+}
+
 // UserHomeDir implements FileSystem
 func (m *MockFileSystem) UserHomeDir() (string, error) {
 	return m.homeDir, nil
 }
 
+// FreeSpace implements FileSystem
+func (m *MockFileSystem) FreeSpace(path string) (uint64, error) {
+	return diskFree(filepath.Join(m.rootDir, path))
+}
+
 // Abs implements FileSystem
 func (m *MockFileSystem) Abs(path string) (string, error) {
 	// In the mock filesystem, we'll just return the path as is
 	return path, nil
 }
 
+// EvalSymlinks implements FileSystem
+func (m *MockFileSystem) EvalSymlinks(path string) (string, error) {
+	// The temp directory holding the root may be behind a symlink itself
+	root, err := filepath.EvalSymlinks(m.rootDir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(m.rootDir, path))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(path) {
+		rel = string(filepath.Separator) + rel
+	}
+	return rel, nil
+}
+
 // Rel implements FileSystem
 func (m *MockFileSystem) Rel(basepath, targpath string) (string, error) {
 	// Clean the paths to handle any ".." or "." components
@@ -138,8 +200,28 @@ func (m *MockFileSystem) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(filePath)
 }
 
+// Lstat implements FileSystem
+func (m *MockFileSystem) Lstat(name string) (fs.FileInfo, error) {
+	filePath := filepath.Join(m.rootDir, name)
+	return os.Lstat(filePath)
+}
+
+// Readlink implements FileSystem. Symlinks created through the mock point
+// into its temp directory, so targets are returned relative to the mock root.
+func (m *MockFileSystem) Readlink(name string) (string, error) {
+	target, err := os.Readlink(filepath.Join(m.rootDir, name))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(m.rootDir, target); err == nil && filepath.IsAbs(target) && !strings.HasPrefix(rel, "..") {
+		return rel, nil
+	}
+	return target, nil
+}
+
 // Open implements fs.FS
-func (m *MockFileSystem) Open(name string) (*os.File, error) {
+func (m *MockFileSystem) Open(name string) (File, error) {
 	filePath := filepath.Join(m.rootDir, name)
 	return os.Open(filePath)
 }
@@ -149,10 +231,23 @@ func (m *MockFileSystem) RealPath(path string) string {
 }
 
 func (m *MockFileSystem) Readdir(path string) ([]os.FileInfo, error) {
-	dir, err := m.Open(path)
+	dir, err := os.Open(filepath.Join(m.rootDir, path))
 	if err != nil {
 		return nil, err
 	}
+	defer dir.Close()
 
 	return dir.Readdir(0)
 }
+
+// WalkDir implements FileSystem
+func (m *MockFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	realRoot := filepath.Join(m.rootDir, root)
+	return filepath.WalkDir(walkRoot(realRoot), func(path string, d fs.DirEntry, err error) error {
+		rel, relErr := filepath.Rel(realRoot, path)
+		if relErr != nil {
+			return relErr
+		}
+		return fn(filepath.Join(root, rel), d, err)
+	})
+}
@@ -129,6 +129,10 @@ func TestMockFileSystem_Symlink(t *testing.T) {
 	if string(data) != string(testData) {
 		t.Errorf("Symlink points to wrong content: got %s, want %s", data, testData)
 	}
+
+	if got, err := mockFS.EvalSymlinks("link.txt"); err != nil || got != "source.txt" {
+		t.Errorf("EvalSymlinks returned %q (%v), want source.txt", got, err)
+	}
 }
 
 func TestMockFileSystem_PathOperations(t *testing.T) {
@@ -201,3 +205,72 @@ func TestMockFileSystem_FileInfo(t *testing.T) {
 		t.Error("Sys should not return nil")
 	}
 }
+
+func TestMockFileSystem_LstatReadlink(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	mockFS.WriteFile("source.txt", []byte("test content"), 0644)
+	if err := mockFS.Symlink("source.txt", "link.txt"); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	// Lstat describes the link, Stat what it points to
+	info, err := mockFS.Lstat("link.txt")
+	if err != nil {
+		t.Fatalf("Lstat failed: %v", err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat did not report a symlink: got %v", info.Mode())
+	}
+	info, err = mockFS.Stat("link.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		t.Errorf("Stat reported a symlink: got %v", info.Mode())
+	}
+
+	target, err := mockFS.Readlink("link.txt")
+	if err != nil {
+		t.Fatalf("Readlink failed: %v", err)
+	}
+	if target != "source.txt" {
+		t.Errorf("Readlink returned wrong target: got %s, want source.txt", target)
+	}
+
+	if _, err := mockFS.Readlink("source.txt"); err == nil {
+		t.Error("Readlink on a regular file should fail")
+	}
+}
+
+func TestMockFileSystem_RenameChmod(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	mockFS.WriteFile("old.txt", []byte("test content"), 0644)
+
+	if err := mockFS.Rename("old.txt", "new.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := mockFS.Stat("old.txt"); err == nil {
+		t.Error("Rename left the old file in place")
+	}
+
+	if err := mockFS.Chmod("new.txt", 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	info, err := mockFS.Stat("new.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode() != 0600 {
+		t.Errorf("Chmod did not change the mode: got %v, want 0600", info.Mode())
+	}
+}
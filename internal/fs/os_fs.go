@@ -1,9 +1,15 @@
 package fs
 
 import (
+	"errors"
+	"io"
 	"io/fs"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
 )
 
 // OSFileSystem implements FileSystem using the real filesystem
@@ -15,7 +21,7 @@ func NewOSFileSystem() *OSFileSystem {
 }
 
 // Open implements fs.FS
-func (f *OSFileSystem) Open(name string) (*os.File, error) {
+func (f *OSFileSystem) Open(name string) (File, error) {
 	return os.Open(name)
 }
 
@@ -24,11 +30,26 @@ func (f *OSFileSystem) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(name)
 }
 
+// Lstat implements FileSystem
+func (f *OSFileSystem) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// Readlink implements FileSystem
+func (f *OSFileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
 // ReadFile implements FileSystem
 func (f *OSFileSystem) ReadFile(name string) ([]byte, error) {
 	return os.ReadFile(name)
 }
 
+// Create implements FileSystem
+func (f *OSFileSystem) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
 // MkdirAll implements FileSystem
 func (f *OSFileSystem) MkdirAll(path string, perm os.FileMode) error {
 	return os.MkdirAll(path, perm)
@@ -39,6 +60,21 @@ func (f *OSFileSystem) WriteFile(name string, data []byte, perm os.FileMode) err
 	return os.WriteFile(name, data, perm)
 }
 
+// WriteFileSync implements FileSystem
+func (f *OSFileSystem) WriteFileSync(name string, data []byte, perm os.FileMode) error {
+	return writeFileSync(name, data, perm)
+}
+
+// Sync implements FileSystem
+func (f *OSFileSystem) Sync(name string) error {
+	return syncPath(name)
+}
+
+// AppendFile implements FileSystem
+func (f *OSFileSystem) AppendFile(name string, data []byte, perm os.FileMode) error {
+	return appendFile(name, data, perm)
+}
+
 // Remove implements FileSystem
 func (f *OSFileSystem) Remove(name string) error {
 	return os.Remove(name)
@@ -54,11 +90,31 @@ func (f *OSFileSystem) Symlink(oldname, newname string) error {
 	return os.Symlink(oldname, newname)
 }
 
+// Link implements FileSystem
+func (f *OSFileSystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Rename implements FileSystem
+func (f *OSFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Chmod implements FileSystem
+func (f *OSFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
 // UserHomeDir implements FileSystem
 func (f *OSFileSystem) UserHomeDir() (string, error) {
 	return os.UserHomeDir()
 }
 
+// FreeSpace implements FileSystem
+func (f *OSFileSystem) FreeSpace(path string) (uint64, error) {
+	return diskFree(path)
+}
+
 // Abs implements FileSystem
 func (f *OSFileSystem) Abs(path string) (string, error) {
 	return filepath.Abs(path)
@@ -69,11 +125,112 @@ func (f *OSFileSystem) Rel(basepath, targpath string) (string, error) {
 	return filepath.Rel(basepath, targpath)
 }
 
+// EvalSymlinks implements FileSystem
+func (f *OSFileSystem) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
 func (f *OSFileSystem) Readdir(path string) ([]os.FileInfo, error) {
-	dir, err := f.Open(path)
+	dir, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer dir.Close()
 
 	return dir.Readdir(0)
 }
+
+// WalkDir implements FileSystem
+func (f *OSFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	walked := walkRoot(root)
+	return filepath.WalkDir(walked, func(path string, d fs.DirEntry, err error) error {
+		if path == walked {
+			path = root
+		}
+		return fn(path, d, err)
+	})
+}
+
+// writeFileSync replaces the file name on the real filesystem with data,
+// durably: data is written and synced to a temporary file in the same
+// directory, renamed over name and the directory synced, so a crash leaves
+// either the old content or the new one, never a truncated file. An existing
+// file keeps its mode, a symlink is written through.
+func writeFileSync(name string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(name)
+	var f *os.File
+	var err error
+	// Random names with O_EXCL, as os.CreateTemp does, but created with perm
+	for range 10000 {
+		f, err = os.OpenFile(filepath.Join(dir, "."+filepath.Base(name)+".tmp-"+strconv.FormatUint(uint64(rand.Uint32()), 10)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncPath(dir)
+}
+
+// syncPath flushes the file or directory name on the real filesystem.
+// Directories that cannot be synced, as on Windows or some filesystems that
+// reject it with EINVAL, are left to the operating system.
+func syncPath(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = f.Sync()
+	if err == nil {
+		return nil
+	}
+	if info, statErr := f.Stat(); statErr == nil && info.IsDir() {
+		if runtime.GOOS == "windows" || errors.Is(err, syscall.EINVAL) {
+			return nil
+		}
+	}
+	return err
+}
+
+// appendFile appends data to the file name on the real filesystem
+func appendFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
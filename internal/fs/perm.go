@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Perm holds the widest permissions of the directories and files dotman
+// materializes, in the home directory or the repository. The umask of the
+// process narrows them further, like it does for any program. The dir_mode
+// and file_mode config keys set them, a zero field stands for 0777 or 0666
+// so the umask alone decides.
+type Perm struct {
+	Dir  os.FileMode
+	File os.FileMode
+}
+
+// DirMode returns the permission to create directories with
+func (p Perm) DirMode() os.FileMode {
+	if p.Dir == 0 {
+		return 0777
+	}
+	return p.Dir
+}
+
+// FileMode returns the permission to create files with
+func (p Perm) FileMode() os.FileMode {
+	if p.File == 0 {
+		return 0666
+	}
+	return p.File
+}
+
+// ForFile returns the permission a materialized file wanting perm gets:
+// perm within FileMode and the umask. Execute bits are kept where FileMode
+// lets read.
+func (p Perm) ForFile(perm os.FileMode) os.FileMode {
+	file := p.FileMode()
+	limit := file | (file&0444)>>2
+	return perm.Perm() & limit &^ umask
+}
+
+// ForDir returns the permission a materialized directory wanting perm gets:
+// perm within DirMode and the umask
+func (p Perm) ForDir(perm os.FileMode) os.FileMode {
+	return perm.Perm() & p.DirMode() &^ umask
+}
+
+// ParsePerm parses an octal permission such as 0600 or 644
+func ParsePerm(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("invalid mode '%s', expected octal permission bits such as 0600", mode)
+	}
+	return os.FileMode(perm), nil
+}
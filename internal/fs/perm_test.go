@@ -0,0 +1,35 @@
+package fs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPerm(t *testing.T) {
+	defer func(mask os.FileMode) { umask = mask }(umask)
+
+	tests := []struct {
+		perm  Perm
+		umask os.FileMode
+		mode  os.FileMode
+		file  os.FileMode
+		dir   os.FileMode
+	}{
+		// The zero Perm leaves the umask alone to decide
+		{perm: Perm{}, umask: 0022, mode: 0777, file: 0755, dir: 0755},
+		{perm: Perm{Dir: 0777, File: 0666}, umask: 0002, mode: 0664, file: 0664, dir: 0664},
+		{perm: Perm{}, umask: 0077, mode: 0755, file: 0700, dir: 0700},
+		// Private modes keep execute bits for the owner only
+		{perm: Perm{Dir: 0700, File: 0600}, umask: 0022, mode: 0755, file: 0700, dir: 0700},
+		{perm: Perm{Dir: 0700, File: 0600}, umask: 0022, mode: 0644, file: 0600, dir: 0600},
+	}
+	for _, tt := range tests {
+		umask = tt.umask
+		if got := tt.perm.ForFile(tt.mode); got != tt.file {
+			t.Errorf("ForFile(%o) with %+v and umask %o = %o, want %o", tt.mode, tt.perm, tt.umask, got, tt.file)
+		}
+		if got := tt.perm.ForDir(tt.mode); got != tt.dir {
+			t.Errorf("ForDir(%o) with %+v and umask %o = %o, want %o", tt.mode, tt.perm, tt.umask, got, tt.dir)
+		}
+	}
+}
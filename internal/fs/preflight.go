@@ -0,0 +1,55 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CheckWritable reports an error when the process cannot create entries at
+// path. A path that does not exist yet is checked at its nearest existing
+// ancestor, where MkdirAll would start creating directories.
+func CheckWritable(fsys FileSystem, path string) error {
+	dir, err := existingAncestor(fsys, path)
+	if err != nil {
+		return err
+	}
+
+	// Permission bits do not tell the whole story (ACLs, read-only mounts,
+	// root), so try creating a file
+	probe := filepath.Join(dir, fmt.Sprintf(".dotman-write-check-%d", os.Getpid()))
+	w, err := fsys.Create(probe, 0600)
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	w.Close()
+
+	return fsys.Remove(probe)
+}
+
+// existingAncestor returns path or its nearest ancestor that exists, which
+// must be a directory
+func existingAncestor(fsys FileSystem, path string) (string, error) {
+	dir := filepath.Clean(path)
+	for {
+		info, err := fsys.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", dir)
+			}
+			return dir, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if _, err := fsys.Lstat(dir); err == nil {
+			return "", fmt.Errorf("%s is a dangling symlink", dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", err
+		}
+		dir = parent
+	}
+}
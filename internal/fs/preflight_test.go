@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckWritable(t *testing.T) {
+	memFS, err := NewMemoryFileSystem(map[string]*fstest.MapFile{
+		"home/.zshrc": {Data: []byte("zsh"), Mode: 0644},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	memFS.Symlink("mnt/gone", "home/.config")
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"home", false},
+		// Missing directories are checked where MkdirAll would start
+		{"home/.local/share", false},
+		{"home/.zshrc/sub", true},
+		{"home/.config/nvim", true},
+	}
+	for _, tt := range tests {
+		if err := CheckWritable(memFS, tt.path); (err != nil) != tt.wantErr {
+			t.Errorf("CheckWritable(%s) returned %v, want error %v", tt.path, err, tt.wantErr)
+		}
+	}
+
+	// The probe file is removed again
+	entries, err := memFS.Readdir("home")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("expected only the original entries in home, got %d (%v)", len(entries), err)
+	}
+}
@@ -0,0 +1,108 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// SparseFileSystem is a billy filesystem showing only some paths of the
+// directory it is rooted at, with everything below them and the directories
+// leading to them. Git uses it as the worktree of a repository tracking files
+// in place, such as the home directory, so it never walks the rest.
+// Everything else looks like it does not exist.
+type SparseFileSystem struct {
+	*BillyFileSystem
+	paths []string
+}
+
+// NewSparseFileSystem creates a SparseFileSystem rooted at basePath showing
+// paths, relative to it with forward slashes, and creating files within perm
+func NewSparseFileSystem(fs FileSystem, basePath string, paths []string, perm Perm) *SparseFileSystem {
+	clean := make([]string, 0, len(paths))
+	for _, p := range paths {
+		clean = append(clean, path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "/")))
+	}
+	return &SparseFileSystem{
+		BillyFileSystem: NewBillyFileSystem(fs, basePath, perm),
+		paths:           clean,
+	}
+}
+
+// Visible reports whether filename is one of the paths, lies below one or
+// is a directory leading to one
+func (s *SparseFileSystem) Visible(filename string) bool {
+	name := path.Clean(strings.TrimPrefix(filepath.ToSlash(filename), "/"))
+	if name == "." {
+		return true
+	}
+	for _, p := range s.paths {
+		if name == p || strings.HasPrefix(name, p+"/") || strings.HasPrefix(p, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hidden returns the error for a path the filesystem does not show
+func hidden(op, filename string) error {
+	return &os.PathError{Op: op, Path: filename, Err: os.ErrNotExist}
+}
+
+// Open implements billy.Filesystem
+func (s *SparseFileSystem) Open(filename string) (billy.File, error) {
+	return s.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+// OpenFile implements billy.Filesystem
+func (s *SparseFileSystem) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if !s.Visible(filename) {
+		return nil, hidden("open", filename)
+	}
+	return s.BillyFileSystem.OpenFile(filename, flag, perm)
+}
+
+// Stat implements billy.Filesystem
+func (s *SparseFileSystem) Stat(filename string) (os.FileInfo, error) {
+	if !s.Visible(filename) {
+		return nil, hidden("stat", filename)
+	}
+	return s.BillyFileSystem.Stat(filename)
+}
+
+// Lstat implements billy.Filesystem
+func (s *SparseFileSystem) Lstat(filename string) (os.FileInfo, error) {
+	if !s.Visible(filename) {
+		return nil, hidden("lstat", filename)
+	}
+	return s.BillyFileSystem.Lstat(filename)
+}
+
+// Readlink implements billy.Filesystem
+func (s *SparseFileSystem) Readlink(link string) (string, error) {
+	if !s.Visible(link) {
+		return "", hidden("readlink", link)
+	}
+	return s.BillyFileSystem.Readlink(link)
+}
+
+// ReadDir implements billy.Filesystem, leaving out the entries not shown
+func (s *SparseFileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	if !s.Visible(dir) {
+		return nil, hidden("readdir", dir)
+	}
+	infos, err := s.BillyFileSystem.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	shown := infos[:0]
+	for _, info := range infos {
+		if s.Visible(path.Join(filepath.ToSlash(dir), info.Name())) {
+			shown = append(shown, info)
+		}
+	}
+	return shown, nil
+}
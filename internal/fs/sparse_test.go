@@ -0,0 +1,73 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSparseFileSystem(t *testing.T) {
+	mockFS, err := NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	for _, file := range []string{"home/.zshrc", "home/.bashrc", "home/.config/nvim/init.lua", "home/.config/fish/config.fish", "home/.dotman/.manfile", "home/.dotman/journal/index"} {
+		if err := mockFS.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := mockFS.WriteFile(file, []byte(file), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", file, err)
+		}
+	}
+	sparse := NewSparseFileSystem(mockFS, "home", []string{".zshrc", ".config/nvim", ".dotman/.manfile"}, Perm{})
+
+	tests := []struct {
+		path    string
+		visible bool
+	}{
+		{path: "", visible: true},
+		{path: ".zshrc", visible: true},
+		{path: ".bashrc", visible: false},
+		{path: ".config", visible: true},
+		{path: ".config/nvim/init.lua", visible: true},
+		{path: ".config/fish", visible: false},
+		{path: ".dotman/journal", visible: false},
+		{path: ".zshrc.bak", visible: false},
+	}
+	for _, tt := range tests {
+		_, err := sparse.Lstat(tt.path)
+		if visible := err == nil; visible != tt.visible {
+			t.Errorf("Lstat(%q) returned %v, expected visible %v", tt.path, err, tt.visible)
+		}
+		if !tt.visible && !os.IsNotExist(err) {
+			t.Errorf("expected %q to not exist, got %v", tt.path, err)
+		}
+	}
+
+	// Directories list the shown entries only
+	for dir, expected := range map[string][]string{
+		"":        {".config", ".dotman", ".zshrc"},
+		".config": {"nvim"},
+		".dotman": {".manfile"},
+	} {
+		infos, err := sparse.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("ReadDir(%q) failed: %v", dir, err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, expected) {
+			t.Errorf("ReadDir(%q) = %v, expected %v", dir, names, expected)
+		}
+	}
+
+	if _, err := sparse.Open(".bashrc"); !os.IsNotExist(err) {
+		t.Errorf("expected opening a hidden file to fail with not exist, got %v", err)
+	}
+}
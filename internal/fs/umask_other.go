@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package fs
+
+import "os"
+
+// umask is zero where there is no umask, a Perm alone limits the
+// permissions
+var umask os.FileMode
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// umask is the umask of the process, read once at start before anything
+// could change it for a while
+var umask = readUmask()
+
+// readUmask returns the umask, which can only be read by setting it
+func readUmask() os.FileMode {
+	old := syscall.Umask(0)
+	syscall.Umask(old)
+	return os.FileMode(old)
+}
@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat is the layout of an archive of exported entries
+type ArchiveFormat string
+
+const (
+	// ArchiveJSONL holds one entry per line
+	ArchiveJSONL ArchiveFormat = "jsonl"
+	// ArchiveTar holds one <id>.json file per entry
+	ArchiveTar ArchiveFormat = "tar"
+)
+
+// WriteArchive writes entries to w in the given format
+func WriteArchive(w io.Writer, format ArchiveFormat, entries []*JournalEntry) error {
+	switch format {
+	case ArchiveJSONL:
+		for _, entry := range entries {
+			entry.SchemaVersion = SchemaVersion
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("error marshaling entry %s: %v", entry.ID, err)
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ArchiveTar:
+		tw := tar.NewWriter(w)
+		for _, entry := range entries {
+			entry.SchemaVersion = SchemaVersion
+			data, err := json.MarshalIndent(entry, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error marshaling entry %s: %v", entry.ID, err)
+			}
+			header := &tar.Header{
+				Name:    entry.ID + ".json",
+				Mode:    0644,
+				Size:    int64(len(data)),
+				ModTime: entry.Timestamp,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	}
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// ReadArchive reads the entries of an archive written by WriteArchive, in
+// either format and gzip compressed or not. Entries are migrated and
+// validated like those read from the journal.
+func ReadArchive(r io.Reader) ([]*JournalEntry, error) {
+	br := bufio.NewReader(r)
+	start, err := br.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing archive: %v", err)
+		}
+		defer gz.Close()
+		return ReadArchive(gz)
+	}
+
+	// JSON lines start with an object, tar archives with a file name
+	if start[0] == '{' {
+		return readJSONL(br)
+	}
+	return readTar(br)
+}
+
+func readJSONL(r *bufio.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		entry, err := decodeEntry(data)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func readTar(r io.Reader) ([]*JournalEntry, error) {
+	var entries []*JournalEntry
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(header.Name, ".json") {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", header.Name, err)
+		}
+		entry, err := decodeEntry(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path.Base(header.Name), err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Import adds entries exported from another journal. Entries this journal
+// already has are skipped, so importing the same archive twice is harmless.
+// It returns the number of entries imported.
+//
+// Imported entries keep their ID, timestamp and steps but not their place in
+// the hash chain of the journal they came from. An entry still in progress
+// there can never finish here and is imported as failed.
+func (jm *JournalManager) Import(entries []*JournalEntry) (int, error) {
+	records, err := jm.Index()
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[string]bool, len(records))
+	for _, record := range records {
+		known[record.ID] = true
+	}
+
+	imported := 0
+	for _, entry := range entries {
+		if known[entry.ID] {
+			continue
+		}
+		known[entry.ID] = true
+
+		entry.Sequence = 0
+		entry.PrevHash = ""
+		if entry.State == EntryStateCurrent {
+			entry.State = EntryStateFailed
+			if entry.Error == "" {
+				entry.Error = "interrupted"
+				if entry.Origin != "" {
+					entry.Error += " on " + entry.Origin
+				}
+				entry.Error += ", imported " + time.Now().Format(time.RFC3339)
+			}
+		}
+
+		if err := jm.saveEntry(entry); err != nil {
+			return imported, err
+		}
+		if err := jm.writeView(entry); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+
+	// Imported entries are older than most, rebuild the index to keep it in
+	// timestamp order
+	if imported > 0 {
+		if _, err := jm.reindex(); err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
@@ -0,0 +1,90 @@
+package journal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestArchive_ExportImport(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveJSONL, ArchiveTar} {
+		t.Run(string(format), func(t *testing.T) {
+			memFS, err := fs.NewMemoryFileSystem(nil)
+			if err != nil {
+				t.Fatalf("failed to create memory filesystem: %v", err)
+			}
+
+			src := NewJournalManager(memFS, "src/journal")
+			src.SetHashChain(true)
+			if err := src.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			done, err := src.CreateEntry(OperationTypeAdd, "home/.zshrc", ".zshrc")
+			if err != nil {
+				t.Fatalf("CreateEntry failed: %v", err)
+			}
+			if err := src.MoveEntry(done, EntryStateCompleted); err != nil {
+				t.Fatalf("MoveEntry failed: %v", err)
+			}
+			running, err := src.CreateEntry(OperationTypePush, "", "")
+			if err != nil {
+				t.Fatalf("CreateEntry failed: %v", err)
+			}
+			running.Origin = "laptop"
+
+			var buf bytes.Buffer
+			if err := WriteArchive(&buf, format, []*JournalEntry{done, running}); err != nil {
+				t.Fatalf("WriteArchive failed: %v", err)
+			}
+			entries, err := ReadArchive(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadArchive failed: %v", err)
+			}
+			if len(entries) != 2 || entries[0].ID != done.ID || entries[1].ID != running.ID {
+				t.Fatalf("expected both entries back in order, got %+v", entries)
+			}
+
+			dst := NewJournalManager(memFS, "dst/journal")
+			dst.SetHashChain(true)
+			if err := dst.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			if _, err := dst.CreateEntry(OperationTypeLink, "data", "home"); err != nil {
+				t.Fatalf("CreateEntry failed: %v", err)
+			}
+
+			n, err := dst.Import(entries)
+			if err != nil || n != 2 {
+				t.Fatalf("expected 2 entries imported, got %d (%v)", n, err)
+			}
+
+			imported, err := dst.GetEntry(running.ID)
+			if err != nil {
+				t.Fatalf("GetEntry failed: %v", err)
+			}
+			if imported.State != EntryStateFailed || imported.Error == "" {
+				t.Errorf("expected an entry in progress to be imported as failed, got %s %q", imported.State, imported.Error)
+			}
+
+			// Imported entries are not part of this journal's chain
+			if problems, _, err := dst.VerifyIntegrity(); err != nil || len(problems) != 0 {
+				t.Errorf("expected an intact chain after import, got %v (%v)", problems, err)
+			}
+
+			records, err := dst.Index()
+			if err != nil || len(records) != 3 {
+				t.Fatalf("expected 3 indexed entries, got %v (%v)", records, err)
+			}
+			if records[0].ID != done.ID {
+				t.Errorf("expected the index to stay in timestamp order, got %+v", records)
+			}
+
+			// Importing again skips what is already there
+			entries, _ = ReadArchive(bytes.NewReader(buf.Bytes()))
+			if n, err := dst.Import(entries); err != nil || n != 0 {
+				t.Errorf("expected nothing imported twice, got %d (%v)", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// chainFile records the order of hash chained entries and the hash of the
+// last one, so deleting entries from either end of the history is detected
+const chainFile = "chain.json"
+
+// chain is the content of the chain file
+type chain struct {
+	// Entries are the chained entry IDs, in sequence order
+	Entries []string `json:"entries"`
+	// Head is the hash of the last entry
+	Head string `json:"head"`
+}
+
+// SetHashChain turns hash chaining on or off for entries created from now
+// on. Chained entries record their sequence number and the hash of the
+// previous chained entry, so `VerifyIntegrity` can detect edited and deleted
+// history. Entries created while chaining was off are not chained.
+func (jm *JournalManager) SetHashChain(enabled bool) {
+	jm.hashChain = enabled
+}
+
+// hashEntry returns the hash of an entry's content
+func hashEntry(entry *JournalEntry) (string, error) {
+	entry.SchemaVersion = SchemaVersion
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling entry: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (jm *JournalManager) readChain() (*chain, error) {
+	data, err := jm.fsys.ReadFile(filepath.Join(jm.journalDir, chainFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &chain{}, nil
+		}
+		return nil, fmt.Errorf("error reading journal chain: %v", err)
+	}
+
+	var c chain
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error parsing journal chain: %v", err)
+	}
+	return &c, nil
+}
+
+func (jm *JournalManager) writeChain(c *chain) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling journal chain: %v", err)
+	}
+	return jm.fsys.WriteFile(filepath.Join(jm.journalDir, chainFile), data, 0644)
+}
+
+// appendToChain gives a new entry the next sequence number
+func (jm *JournalManager) appendToChain(entry *JournalEntry) error {
+	c, err := jm.readChain()
+	if err != nil {
+		return err
+	}
+
+	c.Entries = append(c.Entries, entry.ID)
+	entry.Sequence = int64(len(c.Entries))
+	return jm.writeChain(c)
+}
+
+// saveChainedEntry saves an entry linked to the previous one in the chain.
+// Saving changes the entry's hash, so the entries after it are linked again.
+func (jm *JournalManager) saveChainedEntry(entry *JournalEntry) error {
+	c, err := jm.readChain()
+	if err != nil {
+		return err
+	}
+	index := int(entry.Sequence) - 1
+	if index >= len(c.Entries) || c.Entries[index] != entry.ID {
+		return fmt.Errorf("entry %s is not at position %d of the journal chain", entry.ID, entry.Sequence)
+	}
+
+	entry.PrevHash = ""
+	if index > 0 {
+		prev, err := jm.GetEntry(c.Entries[index-1])
+		if err != nil {
+			return fmt.Errorf("error reading previous entry: %v", err)
+		}
+		if entry.PrevHash, err = hashEntry(prev); err != nil {
+			return err
+		}
+	}
+
+	if err := jm.logEntry(entry); err != nil {
+		return err
+	}
+	hash, err := hashEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	// Link the rest of the chain to the new content
+	for _, id := range c.Entries[index+1:] {
+		next, err := jm.GetEntry(id)
+		if err != nil {
+			return fmt.Errorf("error relinking journal chain: %v", err)
+		}
+		next.PrevHash = hash
+		if err := jm.logEntry(next); err != nil {
+			return err
+		}
+		if hash, err = hashEntry(next); err != nil {
+			return err
+		}
+	}
+
+	c.Head = hash
+	return jm.writeChain(c)
+}
+
+// IntegrityProblem describes a place where the journal history does not
+// match its hash chain
+type IntegrityProblem struct {
+	Sequence int64
+	ID       string
+	Problem  string
+}
+
+// VerifyIntegrity replays the journal log and walks the hash chain,
+// reporting chained entries that were edited, deleted, reordered or injected
+// and views that no longer match the log. It returns the hash of the last
+// entry, which can be noted down to detect the whole chain being rewritten.
+func (jm *JournalManager) VerifyIntegrity() ([]IntegrityProblem, string, error) {
+	c, err := jm.readChain()
+	if err != nil {
+		return nil, "", err
+	}
+	history, order, err := jm.history()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Pruned entries are no longer in the log, their archives hold them
+	var pruned []string
+	for _, id := range c.Entries {
+		if _, ok := history[id]; !ok {
+			pruned = append(pruned, id)
+		}
+	}
+	archived, err := jm.archivedEntries(pruned)
+	if err != nil {
+		return nil, "", err
+	}
+	for id, entry := range archived {
+		history[id] = entry
+	}
+
+	var problems []IntegrityProblem
+	chained := make(map[string]bool, len(c.Entries))
+	hash := ""
+	for i, id := range c.Entries {
+		sequence := int64(i + 1)
+		chained[id] = true
+
+		entry, ok := history[id]
+		if !ok {
+			problems = append(problems, IntegrityProblem{sequence, id, "entry was deleted from the journal log"})
+			hash = ""
+			continue
+		}
+
+		switch {
+		case entry.Sequence != sequence:
+			problems = append(problems, IntegrityProblem{sequence, id, fmt.Sprintf("entry claims sequence %d", entry.Sequence)})
+		case hash != "" || i == 0:
+			// The link cannot be checked after a deleted entry
+			if entry.PrevHash != hash {
+				problems = append(problems, IntegrityProblem{sequence, id, "previous entry hash does not match, history before it was changed"})
+			}
+		}
+		if hash, err = hashEntry(entry); err != nil {
+			return nil, "", err
+		}
+
+		// The view is what the journal command shows
+		if view, err := jm.GetEntry(id); err == nil {
+			viewHash, err := hashEntry(view)
+			if err != nil {
+				return nil, "", err
+			}
+			if viewHash != hash {
+				problems = append(problems, IntegrityProblem{sequence, id, "entry file does not match the journal log"})
+			}
+		}
+	}
+	if hash != c.Head {
+		problems = append(problems, IntegrityProblem{int64(len(c.Entries)), "", "chain head does not match the last entry"})
+	}
+
+	// Chained entries missing from the chain file were injected or had
+	// their record removed
+	for _, id := range order {
+		if entry := history[id]; entry.Sequence > 0 && !chained[id] {
+			problems = append(problems, IntegrityProblem{entry.Sequence, id, "entry is not part of the chain"})
+		}
+	}
+
+	return problems, c.Head, nil
+}
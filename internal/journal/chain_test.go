@@ -0,0 +1,175 @@
+package journal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+// newChainedJournal returns a journal with three chained entries, the first
+// two completed and the last one current
+func newChainedJournal(t *testing.T) (*fs.MemoryFileSystem, *JournalManager, []*JournalEntry) {
+	t.Helper()
+
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	jm.SetHashChain(true)
+
+	var entries []*JournalEntry
+	for i := 0; i < 3; i++ {
+		entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+		if err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	for _, entry := range entries[:2] {
+		if err := jm.MoveEntry(entry, EntryStateCompleted); err != nil {
+			t.Fatalf("MoveEntry failed: %v", err)
+		}
+	}
+
+	return memFS, jm, entries
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	_, jm, entries := newChainedJournal(t)
+
+	for i, entry := range entries {
+		if entry.Sequence != int64(i+1) {
+			t.Errorf("expected entry %d to have sequence %d, got %d", i, i+1, entry.Sequence)
+		}
+	}
+
+	// Updating an earlier entry relinks the later ones
+	entries[0].Steps = append(entries[0].Steps, Step{Type: StepTypeCopy, Status: StepStatusCompleted})
+	if err := jm.UpdateEntry(entries[0]); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+
+	problems, head, err := jm.VerifyIntegrity()
+	if err != nil {
+		t.Fatalf("VerifyIntegrity failed: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected an intact chain, got %v", problems)
+	}
+	if head == "" {
+		t.Error("expected a chain head")
+	}
+}
+
+func TestVerifyIntegrity_Tampered(t *testing.T) {
+	t.Run("edited", func(t *testing.T) {
+		memFS, jm, entries := newChainedJournal(t)
+
+		rewriteLog(t, memFS, func(line string) string {
+			if strings.Contains(line, entries[0].ID) {
+				return strings.ReplaceAll(line, "home/.zshrc", "home/.bashrc")
+			}
+			return line
+		})
+
+		problems, _, err := jm.VerifyIntegrity()
+		if err != nil {
+			t.Fatalf("VerifyIntegrity failed: %v", err)
+		}
+		if !hasProblem(problems, entries[1].ID) {
+			t.Errorf("expected the entry after the edited one to be reported, got %v", problems)
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		memFS, jm, entries := newChainedJournal(t)
+
+		rewriteLog(t, memFS, func(line string) string {
+			if strings.Contains(line, `"id":"`+entries[2].ID+`"`) {
+				return ""
+			}
+			return line
+		})
+
+		problems, _, err := jm.VerifyIntegrity()
+		if err != nil {
+			t.Fatalf("VerifyIntegrity failed: %v", err)
+		}
+		if len(problems) != 2 || problems[0].ID != entries[2].ID {
+			t.Errorf("expected the deleted entry and the chain head to be reported, got %v", problems)
+		}
+	})
+
+	t.Run("view edited", func(t *testing.T) {
+		memFS, jm, entries := newChainedJournal(t)
+		if err := jm.Snapshot(); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+
+		path := filepath.Join("journal", "completed", entries[0].ID+".json")
+		data, _ := memFS.ReadFile(path)
+		memFS.WriteFile(path, []byte(strings.Replace(string(data), "home/.zshrc", "home/.bashrc", 1)), 0644)
+
+		problems, _, err := jm.VerifyIntegrity()
+		if err != nil {
+			t.Fatalf("VerifyIntegrity failed: %v", err)
+		}
+		if len(problems) != 1 || problems[0].ID != entries[0].ID {
+			t.Errorf("expected the edited entry file to be reported, got %v", problems)
+		}
+	})
+
+	t.Run("unchained", func(t *testing.T) {
+		_, jm, _ := newChainedJournal(t)
+
+		// Entries created with chaining off are not checked
+		jm.SetHashChain(false)
+		if _, err := jm.CreateEntry(OperationTypeAdd, "", ""); err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+
+		problems, _, err := jm.VerifyIntegrity()
+		if err != nil {
+			t.Fatalf("VerifyIntegrity failed: %v", err)
+		}
+		if len(problems) != 0 {
+			t.Errorf("expected unchained entries to be ignored, got %v", problems)
+		}
+	})
+}
+
+// rewriteLog passes every line of the journal log through edit, dropping the
+// lines it empties
+func rewriteLog(t *testing.T, memFS *fs.MemoryFileSystem, edit func(line string) string) {
+	t.Helper()
+
+	path := filepath.Join("journal", logDir, segmentName(1))
+	data, err := memFS.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read journal log: %v", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line = edit(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	memFS.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func hasProblem(problems []IntegrityProblem, id string) bool {
+	for _, p := range problems {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// indexFile lists every entry with the fields queries filter on, so listing
+// the journal does not read and decode every entry
+const indexFile = "index.json"
+
+// IndexRecord is the summary of an entry kept in the index
+type IndexRecord struct {
+	ID        string        `json:"id"`
+	Timestamp time.Time     `json:"timestamp"`
+	Operation OperationType `json:"operation"`
+	State     EntryState    `json:"state"`
+	Source    string        `json:"source,omitempty"`
+	Target    string        `json:"target,omitempty"`
+	ParentID  string        `json:"parent_id,omitempty"`
+}
+
+// recordFor returns the index record of an entry
+func recordFor(entry *JournalEntry) IndexRecord {
+	return IndexRecord{
+		ID:        entry.ID,
+		Timestamp: entry.Timestamp,
+		Operation: entry.Operation,
+		State:     entry.State,
+		Source:    entry.Source,
+		Target:    entry.Target,
+		ParentID:  entry.ParentID,
+	}
+}
+
+// equal reports whether two records hold the same values. Timestamps read
+// back from JSON lose their monotonic clock reading, so == cannot be used.
+func (r IndexRecord) equal(o IndexRecord) bool {
+	t := o.Timestamp
+	o.Timestamp = r.Timestamp
+	return r == o && r.Timestamp.Equal(t)
+}
+
+// readIndex reads the index, returning nil when there is none
+func (jm *JournalManager) readIndex() ([]IndexRecord, error) {
+	data, err := jm.fsys.ReadFile(filepath.Join(jm.journalDir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading journal index: %v", err)
+	}
+
+	records := make([]IndexRecord, 0)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("error parsing journal index: %v", err)
+	}
+	return records, nil
+}
+
+func (jm *JournalManager) writeIndex(records []IndexRecord) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("error marshaling journal index: %v", err)
+	}
+	return jm.fsys.WriteFile(filepath.Join(jm.journalDir, indexFile), data, 0644)
+}
+
+// updateIndex records the entry in the index. A journal without an index
+// gets one the next time it is queried.
+func (jm *JournalManager) updateIndex(entry *JournalEntry) error {
+	records, err := jm.readIndex()
+	if err != nil || records == nil {
+		return err
+	}
+
+	record := recordFor(entry)
+	for i := range records {
+		if records[i].ID == record.ID {
+			if records[i].equal(record) {
+				return nil
+			}
+			records[i] = record
+			return jm.writeIndex(records)
+		}
+	}
+	return jm.writeIndex(append(records, record))
+}
+
+// Index returns the index records of all entries, oldest first. The index
+// is built from the entries the first time it is needed.
+func (jm *JournalManager) Index() ([]IndexRecord, error) {
+	records, err := jm.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		return jm.reindex()
+	}
+	return records, nil
+}
+
+// Reindex rebuilds the index from the entries, for when it went stale, and
+// returns the number of entries indexed
+func (jm *JournalManager) Reindex() (int, error) {
+	records, err := jm.reindex()
+	return len(records), err
+}
+
+func (jm *JournalManager) reindex() ([]IndexRecord, error) {
+	entries, err := jm.ListEntries("")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]IndexRecord, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, recordFor(entry))
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+
+	// The index only saves work, a read-only journal is listed without it
+	if err := jm.writeIndex(records); err != nil && !dotmanfs.IsReadOnly(err) {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetEntries retrieves the entries with the given IDs, in the same order,
+// replaying the log once for all of them. Entries pruned from the journal
+// are read from their archives.
+func (jm *JournalManager) GetEntries(ids []string) ([]*JournalEntry, error) {
+	tail, _, err := jm.tail()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*JournalEntry, len(ids))
+	var missing []string
+	for i, id := range ids {
+		if entry, ok := tail[id]; ok {
+			entries[i] = entry
+			continue
+		}
+		entry, err := jm.readView(id)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			missing = append(missing, id)
+		}
+		entries[i] = entry
+	}
+	if len(missing) == 0 {
+		return entries, nil
+	}
+
+	archived, err := jm.archivedEntries(missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if entries[i] != nil {
+			continue
+		}
+		entry, ok := archived[id]
+		if !ok {
+			return nil, fmt.Errorf("entry not found: %s", id)
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
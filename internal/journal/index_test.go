@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestIndex(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// The index is built on the first query
+	first, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	records, err := jm.Index()
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 indexed entry, got %v (%v)", records, err)
+	}
+
+	// and kept up to date on create and move
+	second, err := jm.CreateEntry(OperationTypeLink, "data", "home")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if err := jm.MoveEntry(first, EntryStateCompleted); err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+
+	records, err = jm.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 indexed entries, got %d", len(records))
+	}
+	if !records[0].equal(recordFor(first)) || records[0].State != EntryStateCompleted {
+		t.Errorf("expected the first record to follow the move, got %+v", records[0])
+	}
+	if records[1].ID != second.ID || records[1].Operation != OperationTypeLink {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+
+	// A stale index is rebuilt by Reindex
+	if err := jm.writeIndex(records[:1]); err != nil {
+		t.Fatalf("writeIndex failed: %v", err)
+	}
+	if n, err := jm.Reindex(); err != nil || n != 2 {
+		t.Fatalf("expected 2 entries to be reindexed, got %d (%v)", n, err)
+	}
+
+	entries, err := jm.GetEntries([]string{second.ID, first.ID})
+	if err != nil {
+		t.Fatalf("GetEntries failed: %v", err)
+	}
+	if entries[0].ID != second.ID || entries[1].ID != first.ID {
+		t.Errorf("expected entries in the order asked for, got %s and %s", entries[0].ID, entries[1].ID)
+	}
+}
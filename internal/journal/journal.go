@@ -3,8 +3,12 @@ package journal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
@@ -24,24 +28,94 @@ const (
 type StepType string
 
 const (
-	StepTypeVerify  StepType = "verify"
-	StepTypeCopy    StepType = "copy"
-	StepTypeMove    StepType = "move"
-	StepTypeSymlink StepType = "symlink"
-	StepTypeGit     StepType = "git"
+	StepTypeVerify   StepType = "verify"
+	StepTypeMkdir    StepType = "mkdir"
+	StepTypeWrite    StepType = "write"
+	StepTypeCopy     StepType = "copy"
+	StepTypeMove     StepType = "move"
+	StepTypeSymlink  StepType = "symlink"
+	StepTypeRemove   StepType = "remove"
+	StepTypeRestore  StepType = "restore"
+	StepTypeHook     StepType = "hook"
+	StepTypeGit      StepType = "git"
+	StepTypeManifest StepType = "manifest"
 )
 
+// StepTypes lists every step type, in the order they are documented
+var StepTypes = []StepType{
+	StepTypeVerify,
+	StepTypeMkdir,
+	StepTypeWrite,
+	StepTypeCopy,
+	StepTypeMove,
+	StepTypeSymlink,
+	StepTypeRemove,
+	StepTypeRestore,
+	StepTypeHook,
+	StepTypeGit,
+	StepTypeManifest,
+}
+
+// Valid reports whether t is a known step type
+func (t StepType) Valid() bool {
+	return slices.Contains(StepTypes, t)
+}
+
 // OperationType represents the possible types of operations
 type OperationType string
 
 const (
-	OperationTypeAdd    OperationType = "add"
-	OperationTypeRemove OperationType = "remove"
-	OperationTypeLink   OperationType = "link"
-	OperationTypeCommit OperationType = "commit"
-	OperationTypePush   OperationType = "push"
+	OperationTypeInit     OperationType = "init"
+	OperationTypeAdd      OperationType = "add"
+	OperationTypeRemove   OperationType = "remove"
+	OperationTypeLink     OperationType = "link"
+	OperationTypeCommit   OperationType = "commit"
+	OperationTypePush     OperationType = "push"
+	OperationTypePull     OperationType = "pull"
+	OperationTypeSnapshot OperationType = "snapshot"
+	OperationTypeRestore  OperationType = "restore"
+	OperationTypeMove     OperationType = "move"
+	OperationTypePackage  OperationType = "package"
+	OperationTypeRelocate OperationType = "relocate"
+	OperationTypeAnnotate OperationType = "annotate"
+	OperationTypeChmod    OperationType = "chmod"
+	OperationTypeAlias    OperationType = "alias"
+	OperationTypeResolve  OperationType = "resolve"
+	OperationTypeStash    OperationType = "stash"
+	OperationTypeStashPop OperationType = "stash-pop"
+	OperationTypeRelease  OperationType = "release"
+	OperationTypeCheckout OperationType = "checkout"
 )
 
+// OperationTypes lists every operation type, in the order they are documented
+var OperationTypes = []OperationType{
+	OperationTypeInit,
+	OperationTypeAdd,
+	OperationTypeRemove,
+	OperationTypeLink,
+	OperationTypeCommit,
+	OperationTypePush,
+	OperationTypePull,
+	OperationTypeSnapshot,
+	OperationTypeRestore,
+	OperationTypeMove,
+	OperationTypePackage,
+	OperationTypeRelocate,
+	OperationTypeAnnotate,
+	OperationTypeChmod,
+	OperationTypeAlias,
+	OperationTypeResolve,
+	OperationTypeStash,
+	OperationTypeStashPop,
+	OperationTypeRelease,
+	OperationTypeCheckout,
+}
+
+// Valid reports whether t is a known operation type
+func (t OperationType) Valid() bool {
+	return slices.Contains(OperationTypes, t)
+}
+
 // EntryState represents the possible states of a journal entry
 type EntryState string
 
@@ -53,6 +127,9 @@ const (
 
 // JournalEntry represents a single journal entry
 type JournalEntry struct {
+	// SchemaVersion is the format the entry was saved in, see SchemaVersion
+	SchemaVersion int `json:"schema_version"`
+
 	ID        string        `json:"id"`
 	Timestamp time.Time     `json:"timestamp"`
 	Operation OperationType `json:"operation"`
@@ -61,6 +138,27 @@ type JournalEntry struct {
 	State     EntryState    `json:"state"`
 	Checksum  string        `json:"checksum,omitempty"`
 	Steps     []Step        `json:"steps"`
+
+	// Entries grouping several operations record their steps in child
+	// entries and succeed or fail as a whole
+	ParentID string   `json:"parent_id,omitempty"`
+	Children []string `json:"children,omitempty"`
+	// Error is why a group failed, the steps of its children say where
+	Error string `json:"error,omitempty"`
+
+	// Entries created with hash chaining on carry their position in the
+	// chain and the hash of the entry before them
+	Sequence int64  `json:"sequence,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+
+	// Origin is the host an imported entry was exported from, empty for
+	// entries recorded on this machine
+	Origin string `json:"origin,omitempty"`
+}
+
+// IsGroup reports whether the entry groups child entries
+func (e *JournalEntry) IsGroup() bool {
+	return len(e.Children) > 0
 }
 
 // Context keys for journal-related values
@@ -115,6 +213,9 @@ func GetJournalEntry(ctx context.Context) (*JournalEntry, error) {
 
 // AddStep creates and adds a new step to the journal entry and saves it
 func (e *JournalEntry) AddStep(ctx context.Context, stepType StepType, description string, source, target string) (*Step, error) {
+	if !stepType.Valid() {
+		return nil, fmt.Errorf("unknown step type %q", stepType)
+	}
 	jm, err := GetJournalManager(ctx)
 	if err != nil {
 		return nil, err
@@ -124,12 +225,12 @@ func (e *JournalEntry) AddStep(ctx context.Context, stepType StepType, descripti
 		Type:        stepType,
 		Status:      StepStatusPending,
 		Description: description,
-		Source:      source,
-		Target:      target,
+		Source:      jm.homePath(source),
+		Target:      jm.homePath(target),
 		StartTime:   time.Now(),
 	}
 	e.Steps = append(e.Steps, step)
-	if err := jm.UpdateEntry(e); err != nil {
+	if err := jm.saveStep(e, len(e.Steps)-1); err != nil {
 		return nil, fmt.Errorf("error saving step: %v", err)
 	}
 	return &e.Steps[len(e.Steps)-1], nil
@@ -147,7 +248,7 @@ func StartStep(ctx context.Context, step *Step) error {
 	}
 
 	step.Status = StepStatusRunning
-	return jm.UpdateEntry(entry)
+	return jm.publish(func(o Observer) error { return o.StepStarted(entry, step) })
 }
 
 // CompleteStep marks a step as completed and saves the entry
@@ -164,7 +265,7 @@ func CompleteStep(ctx context.Context, step *Step, details string) error {
 	step.Status = StepStatusCompleted
 	step.Details = details
 	step.EndTime = time.Now()
-	return jm.UpdateEntry(entry)
+	return jm.publish(func(o Observer) error { return o.StepCompleted(entry, step) })
 }
 
 // FailStep marks a step as failed and saves the entry
@@ -181,7 +282,39 @@ func FailStep(ctx context.Context, step *Step, err error) error {
 	step.Status = StepStatusFailed
 	step.Error = err.Error()
 	step.EndTime = time.Now()
-	return jm.UpdateEntry(entry)
+	return jm.publish(func(o Observer) error { return o.StepFailed(entry, step) })
+}
+
+// RecordRollback attaches rollback data to a step and saves it. Record it
+// before the step changes anything, so a step failing halfway can still be
+// undone.
+func RecordRollback(ctx context.Context, step *Step, rollback Rollback) error {
+	entry, err := GetJournalEntry(ctx)
+	if err != nil {
+		return err
+	}
+	jm, err := GetJournalManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	rollback.Backup = jm.homePath(rollback.Backup)
+	for i, path := range rollback.Created {
+		rollback.Created[i] = jm.homePath(path)
+	}
+	step.Rollback = &rollback
+	return jm.saveStep(entry, entry.stepIndex(step))
+}
+
+// stepIndex returns the index of step in the entry's steps, or -1 when step
+// does not point into them
+func (e *JournalEntry) stepIndex(step *Step) int {
+	for i := range e.Steps {
+		if &e.Steps[i] == step {
+			return i
+		}
+	}
+	return -1
 }
 
 // FailEntry marks the last step as failed and moves the entry to the failed state
@@ -195,28 +328,33 @@ func FailEntry(ctx context.Context, err error) error {
 		return fmt.Errorf("failed to get journal manager: %v", err2)
 	}
 
-	// Get the last step
-	if len(entry.Steps) == 0 {
-		return fmt.Errorf("no steps in entry %s - this indicates a programming error", entry.ID)
-	}
-	step := &entry.Steps[len(entry.Steps)-1]
-
-	// Update step status
-	step.Status = StepStatusFailed
-	step.Error = err.Error()
-	step.EndTime = time.Now()
-
-	// Update entry
-	if err := jm.UpdateEntry(entry); err != nil {
-		return fmt.Errorf("failed to update journal entry %s: %v", entry.ID, err)
-	}
+	var step *Step
+	if entry.IsGroup() {
+		// A failed child fails the group
+		entry.Error = err.Error()
+	} else {
+		// Get the last step
+		if len(entry.Steps) == 0 {
+			return fmt.Errorf("no steps in entry %s - this indicates a programming error", entry.ID)
+		}
+		step = &entry.Steps[len(entry.Steps)-1]
 
-	// Move entry to failed state
-	if err := jm.MoveEntry(entry, EntryStateFailed); err != nil {
-		return fmt.Errorf("failed to move journal entry %s to failed state: %v", entry.ID, err)
+		// Update step status
+		step.Status = StepStatusFailed
+		step.Error = err.Error()
+		step.EndTime = time.Now()
 	}
 
-	return nil
+	// The journal records the failure first, observers hear of the step and
+	// then of the entry
+	return jm.publish(func(o Observer) error {
+		if step != nil {
+			if err := o.StepFailed(entry, step); err != nil {
+				return err
+			}
+		}
+		return o.EntryFailed(entry, err)
+	})
 }
 
 // CompleteEntry moves the entry to the completed state
@@ -230,13 +368,41 @@ func CompleteEntry(ctx context.Context) error {
 		return err
 	}
 
-	// Update entry
-	if err := jm.UpdateEntry(entry); err != nil {
-		return err
+	// A group only completes when every child did
+	if entry.IsGroup() {
+		children, err := jm.ChildEntries(entry)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if child.State != EntryStateCompleted {
+				return fmt.Errorf("child entry %s is %s, the group cannot complete", child.ID, child.State)
+			}
+		}
 	}
 
-	// Move entry to completed state
-	return jm.MoveEntry(entry, EntryStateCompleted)
+	return jm.publish(func(o Observer) error { return o.EntryCompleted(entry) })
+}
+
+// StartChildEntry creates a child of the entry in ctx and returns a context
+// holding the child, whose steps and completion are then recorded like those
+// of any other entry. The entry in ctx becomes a group.
+func StartChildEntry(ctx context.Context, operation OperationType, source, target string) (context.Context, error) {
+	parent, err := GetJournalEntry(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jm, err := GetJournalManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := jm.CreateChildEntry(parent, operation, source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return WithJournalEntry(ctx, child), nil
 }
 
 // AddStepToCurrentEntry creates a new step in the current journal entry from context
@@ -259,12 +425,42 @@ type Step struct {
 	Details     string     `json:"details,omitempty"`
 	StartTime   time.Time  `json:"start_time"`
 	EndTime     time.Time  `json:"end_time,omitempty"`
+	Rollback    *Rollback  `json:"rollback,omitempty"`
+}
+
+// Rollback records what a step is about to change, so it can be inverted
+// without guessing from the step's source and target. Steps only set the
+// fields that apply to them.
+type Rollback struct {
+	// Created lists paths the step creates, removing them undoes it
+	Created []string `json:"created,omitempty"`
+	// Mode is the file mode of the source before the step
+	Mode os.FileMode `json:"mode,omitempty"`
+	// Backup is where a copy of what the step replaces or removes is kept
+	Backup string `json:"backup,omitempty"`
+	// LinkTarget is the target of the symlink the step replaces or removes
+	LinkTarget string `json:"link_target,omitempty"`
+	// GitRef is the commit the affected git reference pointed at before the
+	// step, HEAD unless GitRefName says otherwise
+	GitRef     string `json:"git_ref,omitempty"`
+	GitRefName string `json:"git_ref_name,omitempty"`
 }
 
 // JournalManager manages journal entries
 type JournalManager struct {
 	fsys       dotmanfs.FileSystem
 	journalDir string
+	// chain new entries, see SetHashChain
+	hashChain bool
+	// which writes wait for the disk, see SetFsync
+	fsync FsyncLevel
+
+	// the log segment last appended to and its number of events
+	segment       string
+	segmentEvents int
+
+	// told about operations after the journal records them, see Observe
+	observers []Observer
 }
 
 // NewJournalManager creates a new JournalManager
@@ -272,48 +468,178 @@ func NewJournalManager(fsys dotmanfs.FileSystem, journalDir string) *JournalMana
 	return &JournalManager{
 		fsys:       fsys,
 		journalDir: journalDir,
+		fsync:      FsyncTransitions,
+	}
+}
+
+// FsyncLevel says which journal writes wait until they reached stable
+// storage
+type FsyncLevel int
+
+const (
+	// FsyncOff leaves flushing writes to the operating system
+	FsyncOff FsyncLevel = iota
+	// FsyncTransitions syncs the log when an entry is created or changes
+	// state, and the views written before the log moves past them, so an
+	// entry recorded as completed stays so after a power loss. It is the
+	// default.
+	FsyncTransitions
+	// FsyncAll also syncs every step
+	FsyncAll
+)
+
+// SetFsync sets which writes wait for the disk
+func (jm *JournalManager) SetFsync(level FsyncLevel) {
+	jm.fsync = level
+}
+
+// writeFile writes a journal file, waiting for the disk when transitions
+// are synced
+func (jm *JournalManager) writeFile(path string, data []byte) error {
+	if jm.fsync >= FsyncTransitions {
+		return jm.fsys.WriteFileSync(path, data, 0644)
 	}
+	return jm.fsys.WriteFile(path, data, 0644)
 }
 
-// Initialize creates the journal directory structure
+// ErrReadOnly is returned by Initialize when the journal cannot be written.
+// Reading it still works.
+var ErrReadOnly = errors.New("journal is read-only, only commands that change nothing can run")
+
+// probeFile is written and removed by Initialize to find out whether the
+// journal can be written
+const probeFile = ".probe"
+
+// Initialize creates the journal directory structure. It fails with
+// ErrReadOnly when the journal cannot be written, before an operation
+// changed anything.
 func (jm *JournalManager) Initialize() error {
 	// Create main journal directory
 	if err := jm.fsys.MkdirAll(jm.journalDir, 0755); err != nil {
-		return fmt.Errorf("error creating journal directory: %v", err)
+		return jm.writeError("error creating journal directory", err)
 	}
 
 	// Create subdirectories
-	subdirs := []string{"current", "completed", "failed"}
+	subdirs := []string{"current", "completed", "failed", logDir}
 	for _, dir := range subdirs {
 		path := filepath.Join(jm.journalDir, dir)
 		if err := jm.fsys.MkdirAll(path, 0755); err != nil {
-			return fmt.Errorf("error creating %s directory: %v", dir, err)
+			return jm.writeError(fmt.Sprintf("error creating %s directory", dir), err)
 		}
 	}
 
-	return nil
+	// Directories that exist are not written to, a file is
+	probe := filepath.Join(jm.journalDir, probeFile)
+	if err := jm.fsys.WriteFile(probe, nil, 0644); err != nil {
+		return jm.writeError("error writing to journal directory", err)
+	}
+	return jm.fsys.Remove(probe)
+}
+
+// writeError wraps an error writing the journal, as ErrReadOnly when the
+// write was refused
+func (jm *JournalManager) writeError(msg string, err error) error {
+	if dotmanfs.IsReadOnly(err) {
+		return fmt.Errorf("%w: %s: %v", ErrReadOnly, jm.journalDir, err)
+	}
+	return fmt.Errorf("%s: %v", msg, err)
 }
 
 // CreateEntry creates a new journal entry
 func (jm *JournalManager) CreateEntry(operation OperationType, source, target string) (*JournalEntry, error) {
+	entry, err := jm.createEntry(operation, source, target)
+	if err != nil {
+		return nil, err
+	}
+	if err := jm.publish(func(o Observer) error { return o.OperationStarted(entry) }); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// homePath returns path as it is recorded: in ~/ form below the home
+// directory, so entries read the same on machines with other user names.
+// dotmanfs.ExpandHome turns it back into a path of this machine.
+func (jm *JournalManager) homePath(path string) string {
+	return dotmanfs.ContractHome(jm.fsys, path)
+}
+
+// createEntry creates and saves a new journal entry without telling observers
+func (jm *JournalManager) createEntry(operation OperationType, source, target string) (*JournalEntry, error) {
+	if !operation.Valid() {
+		return nil, fmt.Errorf("unknown operation type %q", operation)
+	}
+
 	entry := &JournalEntry{
-		ID:        generateOperationID(string(operation)),
-		Timestamp: time.Now(),
-		Operation: operation,
-		Source:    source,
-		Target:    target,
-		State:     "current",
-		Steps:     make([]Step, 0),
+		SchemaVersion: SchemaVersion,
+		ID:            generateOperationID(string(operation)),
+		Timestamp:     time.Now(),
+		Operation:     operation,
+		Source:        jm.homePath(source),
+		Target:        jm.homePath(target),
+		State:         "current",
+		Steps:         make([]Step, 0),
+	}
+
+	if jm.hashChain {
+		if err := jm.appendToChain(entry); err != nil {
+			return nil, err
+		}
 	}
 
-	// Save the entry
+	// Save the entry, and its view so the state directories list it
 	if err := jm.saveEntry(entry); err != nil {
 		return nil, err
 	}
+	if err := jm.writeView(entry); err != nil {
+		return nil, err
+	}
+	if err := jm.updateIndex(entry); err != nil {
+		return nil, err
+	}
 
 	return entry, nil
 }
 
+// CreateChildEntry creates a new journal entry grouped under parent
+func (jm *JournalManager) CreateChildEntry(parent *JournalEntry, operation OperationType, source, target string) (*JournalEntry, error) {
+	child, err := jm.createEntry(operation, source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	child.ParentID = parent.ID
+	if err := jm.saveEntry(child); err != nil {
+		return nil, err
+	}
+	if err := jm.updateIndex(child); err != nil {
+		return nil, err
+	}
+
+	parent.Children = append(parent.Children, child.ID)
+	if err := jm.saveEntry(parent); err != nil {
+		return nil, err
+	}
+
+	if err := jm.publish(func(o Observer) error { return o.OperationStarted(child) }); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// ChildEntries returns the entries grouped under entry, in creation order
+func (jm *JournalManager) ChildEntries(entry *JournalEntry) ([]*JournalEntry, error) {
+	children := make([]*JournalEntry, 0, len(entry.Children))
+	for _, id := range entry.Children {
+		child, err := jm.GetEntry(id)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
 // UpdateEntry updates an existing journal entry
 func (jm *JournalManager) UpdateEntry(entry *JournalEntry) error {
 	return jm.saveEntry(entry)
@@ -321,43 +647,40 @@ func (jm *JournalManager) UpdateEntry(entry *JournalEntry) error {
 
 // MoveEntry moves a journal entry to a different state directory
 func (jm *JournalManager) MoveEntry(entry *JournalEntry, newState EntryState) error {
-	oldPath := filepath.Join(jm.journalDir, string(entry.State), entry.ID+".json")
-
 	// Update the state
 	entry.State = newState
 
-	// Write to new location with updated state
 	if err := jm.saveEntry(entry); err != nil {
 		return fmt.Errorf("error writing entry: %v", err)
 	}
 
-	// Remove old file if it exists
-	if _, err := jm.fsys.Stat(oldPath); err == nil {
-		if err := jm.fsys.Remove(oldPath); err != nil {
-			return fmt.Errorf("error removing old entry: %v", err)
-		}
+	// The view follows the entry to the directory of its new state
+	if err := jm.writeView(entry); err != nil {
+		return err
 	}
-
-	return nil
+	return jm.updateIndex(entry)
 }
 
 // GetEntry retrieves a journal entry by ID
 func (jm *JournalManager) GetEntry(id string) (*JournalEntry, error) {
-	// Try to find the entry in any state directory
-	states := []EntryState{EntryStateCurrent, EntryStateCompleted, EntryStateFailed}
-	for _, state := range states {
-		path := filepath.Join(jm.journalDir, string(state), id+".json")
-		if _, err := jm.fsys.Stat(path); err == nil {
-			return jm.readEntry(path)
-		}
+	entries, err := jm.GetEntries([]string{id})
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("entry not found: %s", id)
+	return entries[0], nil
 }
 
 // ListEntries lists all journal entries in a given state
 func (jm *JournalManager) ListEntries(state EntryState) ([]*JournalEntry, error) {
 	entries := make([]*JournalEntry, 0)
 
+	// Entries changed since the last snapshot are derived from the log and
+	// replace their views
+	tail, order, err := jm.tail()
+	if err != nil {
+		return nil, err
+	}
+
 	// If state is empty, list entries from all states
 	states := []EntryState{EntryStateCurrent, EntryStateCompleted, EntryStateFailed}
 	if state != "" {
@@ -385,6 +708,9 @@ func (jm *JournalManager) ListEntries(state EntryState) ([]*JournalEntry, error)
 
 		for _, entry := range dirEntries {
 			if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+				if _, ok := tail[strings.TrimSuffix(entry.Name(), ".json")]; ok {
+					continue
+				}
 				path := filepath.Join(dir, entry.Name())
 				journalEntry, err := jm.readEntry(path)
 				if err != nil {
@@ -395,19 +721,47 @@ func (jm *JournalManager) ListEntries(state EntryState) ([]*JournalEntry, error)
 		}
 	}
 
+	for _, id := range order {
+		if state == "" || tail[id].State == state {
+			entries = append(entries, tail[id])
+		}
+	}
+
 	return entries, nil
 }
 
 // Helper functions
 
+// saveEntry records the whole entry in the log
 func (jm *JournalManager) saveEntry(entry *JournalEntry) error {
+	if entry.Sequence > 0 {
+		return jm.saveChainedEntry(entry)
+	}
+	return jm.logEntry(entry)
+}
+
+// saveStep records the step at index of entry in the log, or the whole entry
+// when index is -1. Chained entries are always saved whole, a step changes
+// their hash.
+func (jm *JournalManager) saveStep(entry *JournalEntry, index int) error {
+	if index < 0 || entry.Sequence > 0 {
+		return jm.saveEntry(entry)
+	}
+	return jm.logStep(entry, index)
+}
+
+// writeEntry writes the view of an entry to the directory of its state
+func (jm *JournalManager) writeEntry(entry *JournalEntry) error {
+	// Entries read from an older version are saved in the current one
+	entry.SchemaVersion = SchemaVersion
+
 	data, err := json.MarshalIndent(entry, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling entry: %v", err)
 	}
 
 	path := filepath.Join(jm.journalDir, string(entry.State), entry.ID+".json")
-	return jm.fsys.WriteFile(path, data, 0644)
+	return jm.writeFile(path, data)
 }
 
 func (jm *JournalManager) readEntry(path string) (*JournalEntry, error) {
@@ -416,12 +770,12 @@ func (jm *JournalManager) readEntry(path string) (*JournalEntry, error) {
 		return nil, fmt.Errorf("error reading file: %v", err)
 	}
 
-	var entry JournalEntry
-	if err := json.Unmarshal(data, &entry); err != nil {
-		return nil, fmt.Errorf("error unmarshaling entry: %v", err)
+	entry, err := decodeEntry(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding entry %s: %v", path, err)
 	}
 
-	return &entry, nil
+	return entry, nil
 }
 
 func generateOperationID(operation string) string {
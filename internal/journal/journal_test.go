@@ -1,7 +1,9 @@
 package journal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -136,3 +138,162 @@ func TestJournalEntrySerialization(t *testing.T) {
 		t.Errorf("Expected %d steps, got %d", len(entry.Steps), len(unmarshaled.Steps))
 	}
 }
+
+func TestChildEntries(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	group, err := jm.CreateEntry(OperationTypeAdd, "home", "data")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), group)
+
+	// The first child completes, the second is still running
+	first, err := StartChildEntry(ctx, OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+	if err != nil {
+		t.Fatalf("StartChildEntry failed: %v", err)
+	}
+	if _, err := AddStepToCurrentEntry(first, StepTypeCopy, "Copy file contents", "", ""); err != nil {
+		t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+	}
+	if err := CompleteEntry(first); err != nil {
+		t.Fatalf("CompleteEntry failed: %v", err)
+	}
+	second, err := StartChildEntry(ctx, OperationTypeAdd, "home/.vimrc", "data/.vimrc")
+	if err != nil {
+		t.Fatalf("StartChildEntry failed: %v", err)
+	}
+
+	if !group.IsGroup() || len(group.Children) != 2 {
+		t.Fatalf("expected a group of 2 entries, got %v", group.Children)
+	}
+	child, _ := GetJournalEntry(second)
+	if child.ParentID != group.ID {
+		t.Errorf("expected the child to point at its group, got %q", child.ParentID)
+	}
+
+	// The group cannot complete while a child is unfinished
+	if err := CompleteEntry(ctx); err == nil {
+		t.Fatal("expected completing the group with a running child to fail")
+	}
+
+	// Failing the group fails the unfinished child and keeps the finished one
+	if err := FailEntry(ctx, errors.New("disk full")); err != nil {
+		t.Fatalf("FailEntry failed: %v", err)
+	}
+	children, err := jm.ChildEntries(group)
+	if err != nil {
+		t.Fatalf("ChildEntries failed: %v", err)
+	}
+	if children[0].State != EntryStateCompleted || children[1].State != EntryStateFailed {
+		t.Errorf("unexpected child states %s and %s", children[0].State, children[1].State)
+	}
+
+	saved, err := jm.GetEntry(group.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if saved.State != EntryStateFailed || saved.Error != "disk full" {
+		t.Errorf("expected the group to be failed with its error, got %s %q", saved.State, saved.Error)
+	}
+}
+
+func TestReadEntryMigratesOldSchema(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// An entry written before schema versioning, with null steps
+	old := `{"id": "add-1", "timestamp": "2024-01-02T03:04:05Z", "operation": "add", "state": "completed", "steps": null}`
+	memFS.WriteFile("journal/completed/add-1.json", []byte(old), 0644)
+
+	entry, err := jm.GetEntry("add-1")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if entry.SchemaVersion != SchemaVersion {
+		t.Errorf("expected schema version %d, got %d", SchemaVersion, entry.SchemaVersion)
+	}
+	if entry.Steps == nil {
+		t.Error("expected null steps to be migrated to an empty list")
+	}
+
+	// Saving writes the current version, to the view on the next snapshot
+	if err := jm.UpdateEntry(entry); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if err := jm.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	data, _ := memFS.ReadFile("journal/completed/add-1.json")
+	var saved map[string]any
+	json.Unmarshal(data, &saved)
+	if saved["schema_version"] != float64(SchemaVersion) {
+		t.Errorf("expected the saved entry to carry schema version %d, got %v", SchemaVersion, saved["schema_version"])
+	}
+}
+
+func TestReadEntryValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"newer schema", `{"schema_version": 99, "id": "add-1", "timestamp": "2024-01-02T03:04:05Z", "operation": "add", "state": "completed", "steps": []}`},
+		{"missing id", `{"schema_version": 2, "timestamp": "2024-01-02T03:04:05Z", "operation": "add", "state": "completed", "steps": []}`},
+		{"unknown state", `{"schema_version": 2, "id": "add-1", "timestamp": "2024-01-02T03:04:05Z", "operation": "add", "state": "pending", "steps": []}`},
+		{"step without type", `{"schema_version": 2, "id": "add-1", "timestamp": "2024-01-02T03:04:05Z", "operation": "add", "state": "completed", "steps": [{"status": "completed"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeEntry([]byte(tt.entry)); err == nil {
+				t.Error("expected the entry to be rejected")
+			}
+		})
+	}
+}
+
+func TestUnknownTypesRejected(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	if _, err := jm.CreateEntry("frobnicate", "", ""); err == nil {
+		t.Error("expected an unknown operation to be rejected")
+	}
+
+	entry, err := jm.CreateEntry(OperationTypePull, "", "")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+	if _, err := AddStepToCurrentEntry(ctx, "frobnicate", "", "", ""); err == nil {
+		t.Error("expected an unknown step type to be rejected")
+	}
+	if _, err := AddStepToCurrentEntry(ctx, StepTypeHook, "Run post-pull hook", "", ""); err != nil {
+		t.Errorf("AddStepToCurrentEntry failed: %v", err)
+	}
+	if len(entry.Steps) != 1 {
+		t.Errorf("expected 1 step, got %d", len(entry.Steps))
+	}
+}
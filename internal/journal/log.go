@@ -0,0 +1,403 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logDir holds the append-only event log, split into numbered segments.
+// The log is the journal's source of truth: every change to an entry is
+// appended to the current segment, so updating a step costs one small
+// write however long the operation gets. The entry files in the state
+// directories are a view derived from the log, written when an entry is
+// created or changes state and when a segment is snapshotted.
+const logDir = "log"
+
+// snapshotInterval is the number of events after which the entries touched
+// by the current segment are written to their state directories and a new
+// segment is started, so reading the journal never replays more than one
+// segment
+const snapshotInterval = 200
+
+// compactSegments is the number of snapshotted segments after which the
+// next snapshot compacts them into one recording each entry once, so the
+// log grows with the number of entries rather than with every change made
+const compactSegments = 8
+
+// eventType is the kind of change an event records
+type eventType string
+
+const (
+	// eventEntry records the whole entry
+	eventEntry eventType = "entry"
+	// eventStep records one step of an entry, added or updated
+	eventStep eventType = "step"
+)
+
+// event is a line of the log
+type event struct {
+	Time  time.Time       `json:"time"`
+	Type  eventType       `json:"type"`
+	ID    string          `json:"id"`
+	Entry json.RawMessage `json:"entry,omitempty"`
+	Index int             `json:"index,omitempty"`
+	Step  *Step           `json:"step,omitempty"`
+}
+
+// segmentName returns the file name of the nth log segment
+func segmentName(n int) string {
+	return fmt.Sprintf("%08d.jsonl", n)
+}
+
+// segments returns the names of the log segments, oldest first
+func (jm *JournalManager) segments() ([]string, error) {
+	infos, err := jm.fsys.Readdir(filepath.Join(jm.journalDir, logDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading journal log: %v", err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".jsonl") {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// nextSegment returns the name of the segment started after segment
+func nextSegment(segment string) (string, error) {
+	var n int
+	if _, err := fmt.Sscanf(segment, "%08d.jsonl", &n); err != nil {
+		return "", fmt.Errorf("invalid journal log segment %s", segment)
+	}
+	return segmentName(n + 1), nil
+}
+
+// currentSegment returns the name of the segment events are appended to.
+// The segment last appended to is remembered and only looked for again once
+// the one after it exists, as when another process snapshotted the log, so
+// appending costs no directory listing.
+func (jm *JournalManager) currentSegment() (string, error) {
+	if jm.segment != "" {
+		if next, err := nextSegment(jm.segment); err == nil {
+			if _, err := jm.fsys.Stat(filepath.Join(jm.journalDir, logDir, next)); os.IsNotExist(err) {
+				return jm.segment, nil
+			}
+		}
+	}
+
+	names, err := jm.segments()
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return segmentName(1), nil
+	}
+	return names[len(names)-1], nil
+}
+
+// readSegment returns the events of a segment. A last line cut short by a
+// crash is ignored, the change it recorded never completed.
+func (jm *JournalManager) readSegment(name string) ([]event, error) {
+	data, err := jm.fsys.ReadFile(filepath.Join(jm.journalDir, logDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading journal log: %v", err)
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	events := make([]event, 0, len(lines))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var ev event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("error parsing line %d of journal log %s: %v", i+1, name, err)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// appendEvent appends an event to the current segment, snapshotting the
+// segment once it is full. With sync the event is on disk when it returns.
+func (jm *JournalManager) appendEvent(ev event, sync bool) error {
+	segment, err := jm.currentSegment()
+	if err != nil {
+		return err
+	}
+	if segment != jm.segment {
+		events, err := jm.readSegment(segment)
+		if err != nil {
+			return err
+		}
+		jm.segment = segment
+		jm.segmentEvents = len(events)
+	}
+
+	ev.Time = time.Now()
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("error marshaling journal event: %v", err)
+	}
+	path := filepath.Join(jm.journalDir, logDir, segment)
+	if err := jm.fsys.AppendFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error appending to journal log: %v", err)
+	}
+	if sync {
+		if err := jm.fsys.Sync(path); err != nil {
+			return fmt.Errorf("error syncing journal log: %v", err)
+		}
+		// The first event may have created the segment
+		if jm.segmentEvents == 0 {
+			if err := jm.fsys.Sync(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("error syncing journal log: %v", err)
+			}
+		}
+	}
+
+	jm.segmentEvents++
+	if jm.segmentEvents >= snapshotInterval {
+		return jm.Snapshot()
+	}
+	return nil
+}
+
+// logEntry records the whole entry
+func (jm *JournalManager) logEntry(entry *JournalEntry) error {
+	entry.SchemaVersion = SchemaVersion
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling entry: %v", err)
+	}
+	return jm.appendEvent(event{Type: eventEntry, ID: entry.ID, Entry: data}, jm.fsync >= FsyncTransitions)
+}
+
+// logStep records the step at index of entry
+func (jm *JournalManager) logStep(entry *JournalEntry, index int) error {
+	return jm.appendEvent(event{Type: eventStep, ID: entry.ID, Index: index, Step: &entry.Steps[index]}, jm.fsync >= FsyncAll)
+}
+
+// replay derives the entries changed by the given segments. Entries whose
+// first change in the segments is a step start from their view, which holds
+// everything older segments recorded.
+func (jm *JournalManager) replay(segments []string) (map[string]*JournalEntry, []string, error) {
+	entries := make(map[string]*JournalEntry)
+	var order []string
+
+	for _, segment := range segments {
+		events, err := jm.readSegment(segment)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, ev := range events {
+			entry, seen := entries[ev.ID]
+
+			switch ev.Type {
+			case eventEntry:
+				decoded, err := decodeEntry(ev.Entry)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error decoding entry %s from journal log %s: %v", ev.ID, segment, err)
+				}
+				entry = decoded
+			case eventStep:
+				if !seen {
+					if entry, err = jm.readView(ev.ID); err != nil {
+						return nil, nil, err
+					}
+					if entry == nil {
+						return nil, nil, fmt.Errorf("journal log %s updates a step of unknown entry %s", segment, ev.ID)
+					}
+				}
+				if ev.Step == nil || ev.Index < 0 || ev.Index > len(entry.Steps) {
+					return nil, nil, fmt.Errorf("journal log %s has an invalid step %d for entry %s", segment, ev.Index, ev.ID)
+				}
+				if ev.Index == len(entry.Steps) {
+					entry.Steps = append(entry.Steps, *ev.Step)
+				} else {
+					entry.Steps[ev.Index] = *ev.Step
+				}
+			default:
+				return nil, nil, fmt.Errorf("journal log %s has an unknown event %q", segment, ev.Type)
+			}
+
+			if !seen {
+				order = append(order, ev.ID)
+			}
+			entries[ev.ID] = entry
+		}
+	}
+
+	return entries, order, nil
+}
+
+// tail derives the entries changed since the last snapshot
+func (jm *JournalManager) tail() (map[string]*JournalEntry, []string, error) {
+	segment, err := jm.currentSegment()
+	if err != nil {
+		return nil, nil, err
+	}
+	return jm.replay([]string{segment})
+}
+
+// readView reads the view of an entry, or returns nil when it has none
+func (jm *JournalManager) readView(id string) (*JournalEntry, error) {
+	for _, state := range []EntryState{EntryStateCurrent, EntryStateCompleted, EntryStateFailed} {
+		path := filepath.Join(jm.journalDir, string(state), id+".json")
+		if _, err := jm.fsys.Stat(path); err == nil {
+			return jm.readEntry(path)
+		}
+	}
+	return nil, nil
+}
+
+// writeView writes the view of an entry to the directory of its state and
+// removes it from the others
+func (jm *JournalManager) writeView(entry *JournalEntry) error {
+	if err := jm.writeEntry(entry); err != nil {
+		return err
+	}
+
+	for _, state := range []EntryState{EntryStateCurrent, EntryStateCompleted, EntryStateFailed} {
+		if state == entry.State {
+			continue
+		}
+		path := filepath.Join(jm.journalDir, string(state), entry.ID+".json")
+		if _, err := jm.fsys.Stat(path); err == nil {
+			if err := jm.fsys.Remove(path); err != nil {
+				return fmt.Errorf("error removing old entry: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Snapshot writes the entries changed since the last snapshot to their
+// state directories and starts a new log segment. It runs on its own every
+// snapshotInterval events.
+func (jm *JournalManager) Snapshot() error {
+	segment, err := jm.currentSegment()
+	if err != nil {
+		return err
+	}
+	entries, order, err := jm.replay([]string{segment})
+	if err != nil {
+		return err
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	for _, id := range order {
+		if err := jm.writeView(entries[id]); err != nil {
+			return err
+		}
+	}
+
+	// The next segment exists from now on, so readers stop replaying this one
+	next, err := nextSegment(segment)
+	if err != nil {
+		return err
+	}
+	if err := jm.writeFile(filepath.Join(jm.journalDir, logDir, next), nil); err != nil {
+		return fmt.Errorf("error starting journal log segment: %v", err)
+	}
+	jm.segment = next
+	jm.segmentEvents = 0
+
+	return jm.compact()
+}
+
+// compact rewrites the segments before the current one into the oldest of
+// them once there are compactSegments of them, recording each entry once as
+// it was last logged. The views already hold what the segments record, so
+// compacting only bounds the history Rebuild replays.
+func (jm *JournalManager) compact() error {
+	segments, err := jm.segments()
+	if err != nil {
+		return err
+	}
+	closed := slices.DeleteFunc(segments, func(name string) bool { return name == jm.segment })
+	if len(closed) < compactSegments {
+		return nil
+	}
+
+	entries, order, err := jm.replay(closed)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, id := range order {
+		entry := entries[id]
+		entry.SchemaVersion = SchemaVersion
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("error marshaling entry: %v", err)
+		}
+		line, err := json.Marshal(event{Time: time.Now(), Type: eventEntry, ID: id, Entry: data})
+		if err != nil {
+			return fmt.Errorf("error marshaling journal event: %v", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	// Replace the oldest segment first: until the others are gone, replaying
+	// them again on top of it ends in the same entries
+	if err := jm.writeFile(filepath.Join(jm.journalDir, logDir, closed[0]), buf.Bytes()); err != nil {
+		return fmt.Errorf("error compacting journal log: %v", err)
+	}
+	for _, segment := range closed[1:] {
+		if err := jm.fsys.Remove(filepath.Join(jm.journalDir, logDir, segment)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing journal log segment: %v", err)
+		}
+	}
+	return nil
+}
+
+// Rebuild replays the whole log and rewrites the view of every entry it
+// records, repairing state directories that were edited or lost, and then
+// the index. Entries older than the log keep their views.
+func (jm *JournalManager) Rebuild() (int, error) {
+	entries, order, err := jm.history()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range order {
+		if err := jm.writeView(entries[id]); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := jm.Reindex(); err != nil {
+		return 0, err
+	}
+	return len(order), nil
+}
+
+// history derives every entry the log records from all of its segments
+func (jm *JournalManager) history() (map[string]*JournalEntry, []string, error) {
+	segments, err := jm.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+	return jm.replay(segments)
+}
@@ -0,0 +1,337 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestEventLog(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+
+	for i := 0; i < 3; i++ {
+		step, err := AddStepToCurrentEntry(ctx, StepTypeCopy, "Copy file contents", "", "")
+		if err != nil {
+			t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+		}
+		if err := CompleteStep(ctx, step, "done"); err != nil {
+			t.Fatalf("CompleteStep failed: %v", err)
+		}
+	}
+
+	// Steps are only appended to the log, the view is written on create
+	view, err := jm.readEntry(filepath.Join("journal", "current", entry.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read view: %v", err)
+	}
+	if len(view.Steps) != 0 {
+		t.Errorf("expected the view to be untouched by steps, got %d steps", len(view.Steps))
+	}
+
+	current, err := jm.ListEntries(EntryStateCurrent)
+	if err != nil {
+		t.Fatalf("ListEntries failed: %v", err)
+	}
+	if len(current) != 1 || len(current[0].Steps) != 3 || current[0].Steps[2].Details != "done" {
+		t.Fatalf("expected the entry with 3 completed steps from the log, got %+v", current)
+	}
+
+	// Changing state writes the view to the new state directory
+	if err := CompleteEntry(ctx); err != nil {
+		t.Fatalf("CompleteEntry failed: %v", err)
+	}
+	if _, err := memFS.Stat(filepath.Join("journal", "current", entry.ID+".json")); err == nil {
+		t.Error("expected the view to leave the current directory")
+	}
+	view, err = jm.readEntry(filepath.Join("journal", "completed", entry.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read view: %v", err)
+	}
+	if len(view.Steps) != 3 {
+		t.Errorf("expected the completed view to hold 3 steps, got %d", len(view.Steps))
+	}
+
+	// Lost views are rebuilt from the log
+	memFS.Remove(filepath.Join("journal", "completed", entry.ID+".json"))
+	if n, err := jm.Rebuild(); err != nil || n != 1 {
+		t.Fatalf("expected 1 entry to be rebuilt, got %d (%v)", n, err)
+	}
+	if _, err := memFS.Stat(filepath.Join("journal", "completed", entry.ID+".json")); err != nil {
+		t.Errorf("expected the view to be rebuilt: %v", err)
+	}
+}
+
+func TestEventLog_Snapshot(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+
+	// A full segment is snapshotted and a new one started
+	for i := 0; i < snapshotInterval; i++ {
+		if _, err := AddStepToCurrentEntry(ctx, StepTypeVerify, "Verify", "", ""); err != nil {
+			t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+		}
+	}
+
+	segments, err := jm.segments()
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("expected 2 log segments, got %v (%v)", segments, err)
+	}
+	view, err := jm.readEntry(filepath.Join("journal", "current", entry.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read view: %v", err)
+	}
+	if len(view.Steps) != snapshotInterval-1 {
+		t.Errorf("expected the snapshot to write %d steps, got %d", snapshotInterval-1, len(view.Steps))
+	}
+
+	// Later steps build on the snapshot, and a write cut short is ignored
+	if _, err := AddStepToCurrentEntry(ctx, StepTypeVerify, "Verify", "", ""); err != nil {
+		t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+	}
+	memFS.AppendFile(filepath.Join("journal", logDir, segments[1]), []byte(`{"type":"step","id":`), 0644)
+
+	got, err := jm.GetEntry(entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if len(got.Steps) != snapshotInterval+1 {
+		t.Errorf("expected %d steps, got %d", snapshotInterval+1, len(got.Steps))
+	}
+
+	history, _, err := jm.history()
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(history[entry.ID].Steps) != snapshotInterval+1 {
+		t.Errorf("expected the whole history to replay %d steps, got %d", snapshotInterval+1, len(history[entry.ID].Steps))
+	}
+}
+
+// syncCountingFS counts the writes that wait for the disk
+type syncCountingFS struct {
+	fs.FileSystem
+	syncs int
+}
+
+func (f *syncCountingFS) WriteFileSync(name string, data []byte, perm os.FileMode) error {
+	f.syncs++
+	return f.FileSystem.WriteFileSync(name, data, perm)
+}
+
+func (f *syncCountingFS) Sync(name string) error {
+	f.syncs++
+	return f.FileSystem.Sync(name)
+}
+
+func TestEventLog_Fsync(t *testing.T) {
+	tests := []struct {
+		name  string
+		level FsyncLevel
+		// wantSteps is whether steps are synced too
+		wantSteps bool
+		wantNone  bool
+	}{
+		{name: "off", level: FsyncOff, wantNone: true},
+		{name: "transitions", level: FsyncTransitions},
+		{name: "all", level: FsyncAll, wantSteps: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memFS, err := fs.NewMemoryFileSystem(nil)
+			if err != nil {
+				t.Fatalf("failed to create memory filesystem: %v", err)
+			}
+			countingFS := &syncCountingFS{FileSystem: memFS}
+
+			jm := NewJournalManager(countingFS, "journal")
+			jm.SetFsync(tt.level)
+			if err := jm.Initialize(); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+			if err != nil {
+				t.Fatalf("CreateEntry failed: %v", err)
+			}
+			ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+			created := countingFS.syncs
+
+			step, err := AddStepToCurrentEntry(ctx, StepTypeCopy, "Copy file contents", "", "")
+			if err != nil {
+				t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+			}
+			if err := CompleteStep(ctx, step, "done"); err != nil {
+				t.Fatalf("CompleteStep failed: %v", err)
+			}
+			stepped := countingFS.syncs - created
+
+			if err := CompleteEntry(ctx); err != nil {
+				t.Fatalf("CompleteEntry failed: %v", err)
+			}
+			completed := countingFS.syncs - created - stepped
+
+			if tt.wantNone {
+				if countingFS.syncs != 0 {
+					t.Errorf("expected no syncs, got %d", countingFS.syncs)
+				}
+				return
+			}
+			if created == 0 || completed == 0 {
+				t.Errorf("expected creating and completing the entry to sync, got %d and %d", created, completed)
+			}
+			if tt.wantSteps != (stepped > 0) {
+				t.Errorf("expected steps synced to be %v, got %d syncs", tt.wantSteps, stepped)
+			}
+		})
+	}
+
+	if NewJournalManager(nil, "journal").fsync != FsyncTransitions {
+		t.Error("expected transitions to be synced by default")
+	}
+}
+
+// readdirCountingFS counts the directory listings
+type readdirCountingFS struct {
+	fs.FileSystem
+	readdirs int
+}
+
+func (f *readdirCountingFS) Readdir(name string) ([]os.FileInfo, error) {
+	f.readdirs++
+	return f.FileSystem.Readdir(name)
+}
+
+func TestEventLog_CurrentSegment(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+	countingFS := &readdirCountingFS{FileSystem: memFS}
+
+	jm := NewJournalManager(countingFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+
+	// Appending to the segment found once lists the log no more
+	listed := countingFS.readdirs
+	for i := 0; i < 10; i++ {
+		if _, err := AddStepToCurrentEntry(ctx, StepTypeVerify, "Verify", "", ""); err != nil {
+			t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+		}
+	}
+	if countingFS.readdirs != listed {
+		t.Errorf("expected appending not to list the log, got %d listings", countingFS.readdirs-listed)
+	}
+
+	// Another process snapshotting the log starts a segment this one follows
+	other := NewJournalManager(memFS, "journal")
+	if err := other.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if _, err := AddStepToCurrentEntry(ctx, StepTypeVerify, "Verify", "", ""); err != nil {
+		t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+	}
+	if jm.segment != segmentName(2) {
+		t.Errorf("expected events to go to the new segment, got %s", jm.segment)
+	}
+	got, err := other.GetEntry(entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if len(got.Steps) != 11 {
+		t.Errorf("expected 11 steps, got %d", len(got.Steps))
+	}
+}
+
+func TestEventLog_Compact(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// One operation per segment, each snapshotted
+	var ids []string
+	for i := 0; i < compactSegments; i++ {
+		entry, err := jm.CreateEntry(OperationTypeAdd, "home/.zshrc", "data/.zshrc")
+		if err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+		ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+		if _, err := AddStepToCurrentEntry(ctx, StepTypeVerify, "Verify", "", ""); err != nil {
+			t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+		}
+		if err := CompleteEntry(ctx); err != nil {
+			t.Fatalf("CompleteEntry failed: %v", err)
+		}
+		if err := jm.Snapshot(); err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	// The snapshotted segments were compacted into the oldest one
+	segments, err := jm.segments()
+	if err != nil || len(segments) != 2 || segments[0] != segmentName(1) {
+		t.Fatalf("expected a compacted segment and the current one, got %v (%v)", segments, err)
+	}
+	events, err := jm.readSegment(segments[0])
+	if err != nil || len(events) != compactSegments {
+		t.Fatalf("expected one event per entry, got %d (%v)", len(events), err)
+	}
+
+	history, order, err := jm.history()
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if len(order) != len(ids) {
+		t.Fatalf("expected %d entries in the history, got %d", len(ids), len(order))
+	}
+	for _, id := range ids {
+		entry := history[id]
+		if entry == nil || entry.State != EntryStateCompleted || len(entry.Steps) != 1 {
+			t.Errorf("expected %s to be completed with its step, got %+v", id, entry)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Observer is told about the progress of operations as the journal records
+// it. An entry or step passed to an observer belongs to the running
+// operation and must not be modified, other than with AnnotateStep, or kept
+// past the call.
+//
+// Observers are called in the order they were added, after the journal
+// has written the change, so an observer never hears of something that was
+// not recorded. An error stops the remaining observers and is returned to
+// the operation.
+type Observer interface {
+	// OperationStarted is called when an entry, or a child of a group, is created
+	OperationStarted(entry *JournalEntry) error
+	StepStarted(entry *JournalEntry, step *Step) error
+	StepCompleted(entry *JournalEntry, step *Step) error
+	StepFailed(entry *JournalEntry, step *Step) error
+	EntryCompleted(entry *JournalEntry) error
+	// EntryFailed is called with the error the operation failed with
+	EntryFailed(entry *JournalEntry, err error) error
+}
+
+// NopObserver implements Observer by ignoring every event. Embed it to
+// implement only the events of interest.
+type NopObserver struct{}
+
+func (NopObserver) OperationStarted(*JournalEntry) error     { return nil }
+func (NopObserver) StepStarted(*JournalEntry, *Step) error   { return nil }
+func (NopObserver) StepCompleted(*JournalEntry, *Step) error { return nil }
+func (NopObserver) StepFailed(*JournalEntry, *Step) error    { return nil }
+func (NopObserver) EntryCompleted(*JournalEntry) error       { return nil }
+func (NopObserver) EntryFailed(*JournalEntry, error) error   { return nil }
+
+// Observe adds an observer to be told about the operations recorded by jm
+func (jm *JournalManager) Observe(o Observer) {
+	jm.observers = append(jm.observers, o)
+}
+
+// AnnotateStep adds a line of text to the details of a finished step of
+// entry and saves it, for an observer to record what it did about the step.
+// Other observers are not told.
+func (jm *JournalManager) AnnotateStep(entry *JournalEntry, step *Step, text string) error {
+	if step.Details != "" {
+		text = step.Details + "\n" + text
+	}
+	step.Details = text
+	return jm.saveStep(entry, entry.stepIndex(step))
+}
+
+// publish calls fn for the journal itself and then for every observer, in
+// order, stopping at the first error
+func (jm *JournalManager) publish(fn func(o Observer) error) error {
+	if err := fn(recorder{jm}); err != nil {
+		return err
+	}
+	for _, o := range jm.observers {
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recorder is the observer that writes the journal. It always comes first,
+// the entry files are written when an entry is created.
+type recorder struct {
+	jm *JournalManager
+}
+
+func (r recorder) OperationStarted(*JournalEntry) error { return nil }
+
+func (r recorder) StepStarted(entry *JournalEntry, step *Step) error {
+	return r.jm.saveStep(entry, entry.stepIndex(step))
+}
+
+func (r recorder) StepCompleted(entry *JournalEntry, step *Step) error {
+	return r.jm.saveStep(entry, entry.stepIndex(step))
+}
+
+func (r recorder) StepFailed(entry *JournalEntry, step *Step) error {
+	return r.jm.saveStep(entry, entry.stepIndex(step))
+}
+
+func (r recorder) EntryCompleted(entry *JournalEntry) error {
+	if err := r.jm.UpdateEntry(entry); err != nil {
+		return err
+	}
+	return r.jm.MoveEntry(entry, EntryStateCompleted)
+}
+
+func (r recorder) EntryFailed(entry *JournalEntry, err error) error {
+	if entry.IsGroup() {
+		// The group takes the children that have not finished down with it
+		children, err2 := r.jm.ChildEntries(entry)
+		if err2 != nil {
+			return err2
+		}
+		for _, child := range children {
+			if child.State != EntryStateCurrent {
+				continue
+			}
+			child.Error = err.Error()
+			if err := r.jm.MoveEntry(child, EntryStateFailed); err != nil {
+				return fmt.Errorf("failed to move journal entry %s to failed state: %v", child.ID, err)
+			}
+		}
+	}
+
+	if err := r.jm.UpdateEntry(entry); err != nil {
+		return fmt.Errorf("failed to update journal entry %s: %v", entry.ID, err)
+	}
+	if err := r.jm.MoveEntry(entry, EntryStateFailed); err != nil {
+		return fmt.Errorf("failed to move journal entry %s to failed state: %v", entry.ID, err)
+	}
+	return nil
+}
+
+// ProgressObserver prints the steps of operations as they run, one line
+// per step, for a person watching the console
+type ProgressObserver struct {
+	w io.Writer
+}
+
+// NewProgressObserver returns an observer printing progress to w
+func NewProgressObserver(w io.Writer) *ProgressObserver {
+	return &ProgressObserver{w: w}
+}
+
+func (p *ProgressObserver) OperationStarted(entry *JournalEntry) error {
+	if entry.ParentID != "" {
+		fmt.Fprintf(p.w, "  %s %s\n", entry.Operation, entry.Source)
+		return nil
+	}
+	fmt.Fprintf(p.w, "%s started (%s)\n", entry.Operation, entry.ID)
+	return nil
+}
+
+func (p *ProgressObserver) StepStarted(entry *JournalEntry, step *Step) error {
+	fmt.Fprintf(p.w, "  %s...\n", step.Description)
+	return nil
+}
+
+func (p *ProgressObserver) StepCompleted(entry *JournalEntry, step *Step) error {
+	if step.Details != "" {
+		fmt.Fprintf(p.w, "  %s: %s (%s)\n", step.Description, step.Details, stepElapsed(step))
+		return nil
+	}
+	fmt.Fprintf(p.w, "  %s: done (%s)\n", step.Description, stepElapsed(step))
+	return nil
+}
+
+func (p *ProgressObserver) StepFailed(entry *JournalEntry, step *Step) error {
+	fmt.Fprintf(p.w, "  %s: failed: %s\n", step.Description, step.Error)
+	return nil
+}
+
+func (p *ProgressObserver) EntryCompleted(entry *JournalEntry) error {
+	if entry.ParentID == "" {
+		fmt.Fprintf(p.w, "%s completed (%s)\n", entry.Operation, entry.ID)
+	}
+	return nil
+}
+
+func (p *ProgressObserver) EntryFailed(entry *JournalEntry, err error) error {
+	if entry.ParentID == "" {
+		fmt.Fprintf(p.w, "%s failed (%s): %v\n", entry.Operation, entry.ID, err)
+	}
+	return nil
+}
+
+// stepElapsed returns how long a finished step took, rounded for display
+func stepElapsed(step *Step) time.Duration {
+	return step.EndTime.Sub(step.StartTime).Round(time.Millisecond)
+}
+
+// LogObserver writes every event as a structured log record, for tools
+// that collect logs rather than watch the console
+type LogObserver struct {
+	logger *slog.Logger
+}
+
+// NewLogObserver returns an observer logging events to logger
+func NewLogObserver(logger *slog.Logger) *LogObserver {
+	return &LogObserver{logger: logger}
+}
+
+func (l *LogObserver) OperationStarted(entry *JournalEntry) error {
+	l.logger.Info("operation started", entryAttrs(entry)...)
+	return nil
+}
+
+func (l *LogObserver) StepStarted(entry *JournalEntry, step *Step) error {
+	l.logger.Debug("step started", stepAttrs(entry, step)...)
+	return nil
+}
+
+func (l *LogObserver) StepCompleted(entry *JournalEntry, step *Step) error {
+	l.logger.Info("step completed", append(stepAttrs(entry, step),
+		slog.String("details", step.Details),
+		slog.Duration("duration", step.EndTime.Sub(step.StartTime)))...)
+	return nil
+}
+
+func (l *LogObserver) StepFailed(entry *JournalEntry, step *Step) error {
+	l.logger.Error("step failed", append(stepAttrs(entry, step), slog.String("error", step.Error))...)
+	return nil
+}
+
+func (l *LogObserver) EntryCompleted(entry *JournalEntry) error {
+	l.logger.Info("operation completed", entryAttrs(entry)...)
+	return nil
+}
+
+func (l *LogObserver) EntryFailed(entry *JournalEntry, err error) error {
+	l.logger.Error("operation failed", append(entryAttrs(entry), slog.String("error", err.Error()))...)
+	return nil
+}
+
+// entryAttrs returns the log attributes identifying an entry
+func entryAttrs(entry *JournalEntry) []any {
+	attrs := []any{
+		slog.String("id", entry.ID),
+		slog.String("operation", string(entry.Operation)),
+	}
+	if entry.ParentID != "" {
+		attrs = append(attrs, slog.String("parent", entry.ParentID))
+	}
+	if entry.Source != "" {
+		attrs = append(attrs, slog.String("source", entry.Source))
+	}
+	if entry.Target != "" {
+		attrs = append(attrs, slog.String("target", entry.Target))
+	}
+	return attrs
+}
+
+// stepAttrs returns the log attributes identifying a step of entry
+func stepAttrs(entry *JournalEntry, step *Step) []any {
+	return []any{
+		slog.String("id", entry.ID),
+		slog.String("operation", string(entry.Operation)),
+		slog.String("step", step.Description),
+		slog.String("type", string(step.Type)),
+	}
+}
@@ -0,0 +1,168 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+// recordingObserver remembers the events it is told about
+type recordingObserver struct {
+	jm     *JournalManager
+	events []string
+	err    error
+}
+
+func (r *recordingObserver) record(event string, entry *JournalEntry) error {
+	// The journal has written the change before observers hear of it
+	stored, err := r.jm.GetEntry(entry.ID)
+	if err != nil {
+		return err
+	}
+	r.events = append(r.events, event+" "+string(stored.State))
+	return r.err
+}
+
+func (r *recordingObserver) OperationStarted(entry *JournalEntry) error {
+	return r.record("started", entry)
+}
+
+func (r *recordingObserver) StepStarted(entry *JournalEntry, step *Step) error {
+	return r.record("step started "+step.Description, entry)
+}
+
+func (r *recordingObserver) StepCompleted(entry *JournalEntry, step *Step) error {
+	return r.record("step completed "+step.Description, entry)
+}
+
+func (r *recordingObserver) StepFailed(entry *JournalEntry, step *Step) error {
+	return r.record("step failed "+step.Description, entry)
+}
+
+func (r *recordingObserver) EntryCompleted(entry *JournalEntry) error {
+	return r.record("completed", entry)
+}
+
+func (r *recordingObserver) EntryFailed(entry *JournalEntry, err error) error {
+	return r.record("failed", entry)
+}
+
+func TestObserve(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	jm := NewJournalManager(mockFS, "test/journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	observer := &recordingObserver{jm: jm}
+	jm.Observe(observer)
+
+	run := func(fail bool) {
+		entry, err := jm.CreateEntry(OperationTypeAdd, "source", "target")
+		if err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+		ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+		step, err := AddStepToCurrentEntry(ctx, StepTypeCopy, "Copy", "source", "target")
+		if err != nil {
+			t.Fatalf("AddStepToCurrentEntry failed: %v", err)
+		}
+		if err := StartStep(ctx, step); err != nil {
+			t.Fatalf("StartStep failed: %v", err)
+		}
+		if fail {
+			if err := FailEntry(ctx, errors.New("disk full")); err != nil {
+				t.Fatalf("FailEntry failed: %v", err)
+			}
+			return
+		}
+		if err := CompleteStep(ctx, step, ""); err != nil {
+			t.Fatalf("CompleteStep failed: %v", err)
+		}
+		if err := CompleteEntry(ctx); err != nil {
+			t.Fatalf("CompleteEntry failed: %v", err)
+		}
+	}
+
+	run(false)
+	run(true)
+
+	want := []string{
+		"started current", "step started Copy current", "step completed Copy current", "completed completed",
+		"started current", "step started Copy current", "step failed Copy failed", "failed failed",
+	}
+	if strings.Join(observer.events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("observer saw\n%s\nwant\n%s", strings.Join(observer.events, "\n"), strings.Join(want, "\n"))
+	}
+
+	// An observer failing fails the operation, after the journal recorded it
+	observer.err = errors.New("observer failed")
+	entry, err := jm.CreateEntry(OperationTypeAdd, "source", "target")
+	if err == nil || entry != nil {
+		t.Fatalf("expected CreateEntry to return the observer's error, got %v", err)
+	}
+	current, err := jm.ListEntries(EntryStateCurrent)
+	if err != nil || len(current) != 1 {
+		t.Errorf("expected the entry to be recorded anyway, got %d (%v)", len(current), err)
+	}
+}
+
+func TestBuiltinObservers(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	var progress, logs bytes.Buffer
+	jm := NewJournalManager(mockFS, "test/journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	jm.Observe(NewProgressObserver(&progress))
+	jm.Observe(NewLogObserver(slog.New(slog.NewJSONHandler(&logs, nil))))
+
+	entry, err := jm.CreateEntry(OperationTypeLink, "data", "")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	ctx := WithJournalEntry(WithJournalManager(context.Background(), jm), entry)
+	step, _ := AddStepToCurrentEntry(ctx, StepTypeSymlink, "Create symlinks", "", "")
+	StartStep(ctx, step)
+	CompleteStep(ctx, step, "Linked 2 files")
+	if err := CompleteEntry(ctx); err != nil {
+		t.Fatalf("CompleteEntry failed: %v", err)
+	}
+
+	for _, want := range []string{"link started (" + entry.ID + ")", "Create symlinks...", "Create symlinks: Linked 2 files", "link completed"} {
+		if !strings.Contains(progress.String(), want) {
+			t.Errorf("expected progress to contain %q, got\n%s", want, progress.String())
+		}
+	}
+
+	// The default level leaves out the start of steps
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("failed to parse log line %q: %v", line, err)
+		}
+		if record["id"] != entry.ID {
+			t.Errorf("expected log record for %s, got %v", entry.ID, record)
+		}
+		messages = append(messages, record["msg"].(string))
+	}
+	if got := strings.Join(messages, ", "); got != "operation started, step completed, operation completed" {
+		t.Errorf("unexpected log records: %s", got)
+	}
+}
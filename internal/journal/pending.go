@@ -0,0 +1,95 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pendingFile lists the operations that could not finish for a reason
+// outside dotman's control, like the remote being unreachable, and are
+// waiting to be retried
+const pendingFile = "pending.json"
+
+// Pending marks an operation waiting to be retried
+type Pending struct {
+	Operation OperationType `json:"operation"`
+	// EntryID is the entry of the last attempt
+	EntryID string `json:"entry_id"`
+	// Since is when the first attempt failed
+	Since time.Time `json:"since"`
+	// Attempts is the number of operations that failed to finish it
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Pending returns the operations waiting to be retried, oldest first
+func (jm *JournalManager) Pending() ([]Pending, error) {
+	data, err := jm.fsys.ReadFile(filepath.Join(jm.journalDir, pendingFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Pending{}, nil
+		}
+		return nil, fmt.Errorf("error reading pending operations: %v", err)
+	}
+
+	pending := make([]Pending, 0)
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("error parsing pending operations: %v", err)
+	}
+	return pending, nil
+}
+
+func (jm *JournalManager) writePending(pending []Pending) error {
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling pending operations: %v", err)
+	}
+	return jm.fsys.WriteFile(filepath.Join(jm.journalDir, pendingFile), data, 0644)
+}
+
+// MarkPending records that the operation of entry failed with cause and is
+// waiting to be retried. An operation already waiting keeps the time it
+// started waiting.
+func (jm *JournalManager) MarkPending(entry *JournalEntry, cause error) error {
+	pending, err := jm.Pending()
+	if err != nil {
+		return err
+	}
+
+	marker := Pending{Operation: entry.Operation, EntryID: entry.ID, Since: time.Now(), Attempts: 1}
+	if cause != nil {
+		marker.Error = cause.Error()
+	}
+	for i := range pending {
+		if pending[i].Operation == entry.Operation {
+			marker.Since = pending[i].Since
+			marker.Attempts = pending[i].Attempts + 1
+			pending[i] = marker
+			return jm.writePending(pending)
+		}
+	}
+	return jm.writePending(append(pending, marker))
+}
+
+// ClearPending records that operation finished, returning whether it was
+// waiting to be retried
+func (jm *JournalManager) ClearPending(operation OperationType) (bool, error) {
+	pending, err := jm.Pending()
+	if err != nil {
+		return false, err
+	}
+
+	kept := pending[:0]
+	for _, marker := range pending {
+		if marker.Operation != operation {
+			kept = append(kept, marker)
+		}
+	}
+	if len(kept) == len(pending) {
+		return false, nil
+	}
+	return true, jm.writePending(kept)
+}
@@ -0,0 +1,66 @@
+package journal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestPending(t *testing.T) {
+	memFS, err := fs.NewMemoryFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create memory filesystem: %v", err)
+	}
+
+	jm := NewJournalManager(memFS, "journal")
+	if err := jm.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	first, err := jm.CreateEntry(OperationTypePush, "", "")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	second, err := jm.CreateEntry(OperationTypePush, "", "")
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	if err := jm.MarkPending(first, errors.New("offline")); err != nil {
+		t.Fatalf("MarkPending failed: %v", err)
+	}
+	since := mustPending(t, jm)[0].Since
+
+	// A second failure updates the marker but keeps when it started waiting
+	if err := jm.MarkPending(second, errors.New("still offline")); err != nil {
+		t.Fatalf("MarkPending failed: %v", err)
+	}
+	pending := mustPending(t, jm)
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending operation, got %d", len(pending))
+	}
+	marker := pending[0]
+	if marker.EntryID != second.ID || marker.Attempts != 2 || marker.Error != "still offline" || !marker.Since.Equal(since) {
+		t.Errorf("unexpected marker %+v", marker)
+	}
+
+	if cleared, err := jm.ClearPending(OperationTypePush); err != nil || !cleared {
+		t.Fatalf("expected the push to be cleared, got %v, %v", cleared, err)
+	}
+	if cleared, err := jm.ClearPending(OperationTypePush); err != nil || cleared {
+		t.Fatalf("expected nothing left to clear, got %v, %v", cleared, err)
+	}
+	if pending := mustPending(t, jm); len(pending) != 0 {
+		t.Errorf("expected no pending operations, got %+v", pending)
+	}
+}
+
+func mustPending(t *testing.T, jm *JournalManager) []Pending {
+	t.Helper()
+	pending, err := jm.Pending()
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	return pending
+}
@@ -0,0 +1,251 @@
+package journal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// archiveDir holds the entries pruned from the journal, compressed into
+// dated archives, and the index of the entries each archive holds
+const archiveDir = "archive"
+
+// ArchiveRecord is the index record of a pruned entry and the archive it
+// was moved to
+type ArchiveRecord struct {
+	IndexRecord
+	Archive string `json:"archive"`
+}
+
+// readArchiveIndex reads the index of pruned entries, nil when nothing was
+// pruned
+func (jm *JournalManager) readArchiveIndex() ([]ArchiveRecord, error) {
+	data, err := jm.fsys.ReadFile(filepath.Join(jm.journalDir, archiveDir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading journal archive index: %v", err)
+	}
+
+	var records []ArchiveRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("error parsing journal archive index: %v", err)
+	}
+	return records, nil
+}
+
+// ArchiveIndex returns the records of the entries pruned from the journal,
+// oldest first
+func (jm *JournalManager) ArchiveIndex() ([]ArchiveRecord, error) {
+	return jm.readArchiveIndex()
+}
+
+// archivedEntries reads the entries with the given IDs from the archives
+// holding them, reading each archive once. IDs that were never pruned are
+// left out.
+func (jm *JournalManager) archivedEntries(ids []string) (map[string]*JournalEntry, error) {
+	records, err := jm.readArchiveIndex()
+	if err != nil || records == nil {
+		return nil, err
+	}
+	archives := make(map[string]string, len(records))
+	for _, record := range records {
+		archives[record.ID] = record.Archive
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		if archive, ok := archives[id]; ok {
+			wanted[archive] = true
+		}
+	}
+	entries := make(map[string]*JournalEntry)
+	for archive := range wanted {
+		f, err := jm.fsys.Open(filepath.Join(jm.journalDir, archiveDir, archive))
+		if err != nil {
+			return nil, fmt.Errorf("error opening journal archive: %v", err)
+		}
+		archived, err := ReadArchive(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading journal archive %s: %v", archive, err)
+		}
+		for _, entry := range archived {
+			entries[entry.ID] = entry
+		}
+	}
+	return entries, nil
+}
+
+// Prune moves the finished entries that started before cutoff out of the
+// journal, grouped entries along with their group, into a gzip compressed
+// archive named by the date. The archive is added to the archive index, so
+// GetEntry still finds its entries and VerifyIntegrity still walks the hash
+// chain through them. It returns the number of entries moved and the path
+// of the archive, empty when there was nothing to prune.
+func (jm *JournalManager) Prune(cutoff time.Time) (int, string, error) {
+	// Everything but the events of the new segment is in the views now
+	if err := jm.Snapshot(); err != nil {
+		return 0, "", err
+	}
+	records, err := jm.Index()
+	if err != nil {
+		return 0, "", err
+	}
+
+	pruned := make(map[string]bool)
+	for _, record := range records {
+		if record.ParentID == "" && record.State != EntryStateCurrent && record.Timestamp.Before(cutoff) {
+			pruned[record.ID] = true
+		}
+	}
+	var ids []string
+	var kept []IndexRecord
+	for _, record := range records {
+		if pruned[record.ID] || pruned[record.ParentID] {
+			ids = append(ids, record.ID)
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, "", nil
+	}
+	entries, err := jm.GetEntries(ids)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The archive is written before anything is removed from the journal
+	archive, err := jm.writeArchive(entries)
+	if err != nil {
+		return 0, "", err
+	}
+	archived, err := jm.readArchiveIndex()
+	if err != nil {
+		return 0, "", err
+	}
+	for _, entry := range entries {
+		archived = append(archived, ArchiveRecord{IndexRecord: recordFor(entry), Archive: archive})
+	}
+	sort.SliceStable(archived, func(i, j int) bool {
+		return archived[i].Timestamp.Before(archived[j].Timestamp)
+	})
+	data, err := json.Marshal(archived)
+	if err != nil {
+		return 0, "", fmt.Errorf("error marshaling journal archive index: %v", err)
+	}
+	if err := jm.writeFile(filepath.Join(jm.journalDir, archiveDir, indexFile), data); err != nil {
+		return 0, "", fmt.Errorf("error writing journal archive index: %v", err)
+	}
+
+	removed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+		for _, state := range []EntryState{EntryStateCurrent, EntryStateCompleted, EntryStateFailed} {
+			path := filepath.Join(jm.journalDir, string(state), id+".json")
+			if err := jm.fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+				return 0, "", fmt.Errorf("error removing pruned entry: %v", err)
+			}
+		}
+	}
+	if kept == nil {
+		kept = []IndexRecord{}
+	}
+	if err := jm.writeIndex(kept); err != nil {
+		return 0, "", err
+	}
+	if err := jm.dropFromLog(removed); err != nil {
+		return 0, "", err
+	}
+	return len(ids), filepath.Join(jm.journalDir, archiveDir, archive), nil
+}
+
+// writeArchive writes entries to a new gzip compressed archive named by
+// today's date and returns its file name
+func (jm *JournalManager) writeArchive(entries []*JournalEntry) (string, error) {
+	dir := filepath.Join(jm.journalDir, archiveDir)
+	if err := jm.fsys.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating journal archive directory: %v", err)
+	}
+	date := time.Now().Format("2006-01-02")
+	name := date + ".jsonl.gz"
+	for i := 2; ; i++ {
+		if _, err := jm.fsys.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d.jsonl.gz", date, i)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := WriteArchive(gz, ArchiveJSONL, entries); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("error compressing journal archive: %v", err)
+	}
+	if err := jm.writeFile(filepath.Join(dir, name), buf.Bytes()); err != nil {
+		return "", fmt.Errorf("error writing journal archive: %v", err)
+	}
+	return name, nil
+}
+
+// dropFromLog removes the events of the given entries from the log
+// segments before the current one, removing segments left empty, so
+// replaying the log does not bring pruned entries back
+func (jm *JournalManager) dropFromLog(ids map[string]bool) error {
+	segments, err := jm.segments()
+	if err != nil {
+		return err
+	}
+	current, err := jm.currentSegment()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if segment == current {
+			continue
+		}
+		path := filepath.Join(jm.journalDir, logDir, segment)
+		data, err := jm.fsys.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading journal log: %v", err)
+		}
+
+		var kept [][]byte
+		changed := false
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var ev struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(line, &ev); err == nil && ids[ev.ID] {
+				changed = true
+				continue
+			}
+			kept = append(kept, line)
+		}
+
+		switch {
+		case len(kept) == 0:
+			if err := jm.fsys.Remove(path); err != nil {
+				return fmt.Errorf("error removing journal log segment: %v", err)
+			}
+		case changed:
+			if err := jm.writeFile(path, append(bytes.Join(kept, []byte("\n")), '\n')); err != nil {
+				return fmt.Errorf("error rewriting journal log segment: %v", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	memFS, jm, entries := newChainedJournal(t)
+
+	// Nothing is old enough yet
+	if n, archive, err := jm.Prune(time.Now().Add(-time.Hour)); err != nil || n != 0 || archive != "" {
+		t.Fatalf("expected nothing to prune, got %d %q (%v)", n, archive, err)
+	}
+
+	n, archive, err := jm.Prune(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if n != 2 || filepath.Base(archive) != time.Now().Format("2006-01-02")+".jsonl.gz" {
+		t.Fatalf("expected the two completed entries in today's archive, got %d %s", n, archive)
+	}
+
+	// The entry in progress stays
+	records, err := jm.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != entries[2].ID {
+		t.Errorf("expected only the current entry in the index, got %+v", records)
+	}
+	if _, err := memFS.Stat(filepath.Join("journal", "completed", entries[0].ID+".json")); !os.IsNotExist(err) {
+		t.Errorf("expected the view of a pruned entry to be removed, got %v", err)
+	}
+	archived, err := jm.ArchiveIndex()
+	if err != nil || len(archived) != 2 || archived[0].ID != entries[0].ID || archived[0].Archive != filepath.Base(archive) {
+		t.Errorf("expected the pruned entries in the archive index, got %+v (%v)", archived, err)
+	}
+
+	// Pruned entries are still found, and the chain still verifies
+	entry, err := jm.GetEntry(entries[1].ID)
+	if err != nil || entry.State != EntryStateCompleted {
+		t.Fatalf("expected to read a pruned entry, got %+v (%v)", entry, err)
+	}
+	if problems, _, err := jm.VerifyIntegrity(); err != nil || len(problems) != 0 {
+		t.Errorf("expected an intact chain, got %v (%v)", problems, err)
+	}
+
+	// Rebuilding from the log does not bring them back
+	if _, err := jm.Rebuild(); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if records, _ := jm.Index(); len(records) != 1 {
+		t.Errorf("expected pruned entries to stay pruned, got %+v", records)
+	}
+
+	// The archive is an ordinary compressed export
+	f, err := memFS.Open(archive)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer f.Close()
+	if read, err := ReadArchive(f); err != nil || len(read) != 2 {
+		t.Errorf("expected to read two entries from the archive, got %d (%v)", len(read), err)
+	}
+}
@@ -0,0 +1,115 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the entry format this build writes.
+// Entries written before versioning have no schema_version and are read as
+// version 1.
+//
+//	1: entries before versioning, steps could be saved as null
+//	2: schema_version, group entries (parent_id, children, error)
+//
+// Optional fields that older versions simply lack, like the hash chain's
+// sequence and prev_hash, do not need a new version.
+const SchemaVersion = 2
+
+// migration upgrades a decoded entry from one schema version to the next
+type migration func(raw map[string]any) error
+
+// migrations holds the migration from each version to the following one
+var migrations = map[int]migration{
+	1: migrateV1,
+}
+
+// migrateV1 upgrades entries written before versioning. They could hold
+// null steps, which the current format never writes.
+func migrateV1(raw map[string]any) error {
+	if raw["steps"] == nil {
+		raw["steps"] = []any{}
+	}
+	return nil
+}
+
+// decodeEntry decodes an entry in any known schema version, migrating it to
+// the current one and validating the result
+func decodeEntry(data []byte) (*JournalEntry, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if v, ok := raw["schema_version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f != float64(int(f)) {
+			return nil, fmt.Errorf("invalid schema_version %v", v)
+		}
+		version = int(f)
+	}
+	if version < 1 {
+		return nil, fmt.Errorf("invalid schema_version %d", version)
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than %d, the entry was written by a newer dotman", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("error migrating from schema version %d: %v", version, err)
+		}
+	}
+	raw["schema_version"] = SchemaVersion
+
+	// Round-trip through JSON so the struct tags decide the layout
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var entry JournalEntry
+	if err := json.Unmarshal(migrated, &entry); err != nil {
+		return nil, err
+	}
+
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Validate reports an error when fields every entry needs are missing or
+// hold values this build does not know
+func (e *JournalEntry) Validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("entry has no id")
+	}
+	if e.Operation == "" {
+		return fmt.Errorf("entry %s has no operation", e.ID)
+	}
+	switch e.State {
+	case EntryStateCurrent, EntryStateCompleted, EntryStateFailed:
+	default:
+		return fmt.Errorf("entry %s has unknown state %q", e.ID, e.State)
+	}
+	if e.Timestamp.IsZero() {
+		return fmt.Errorf("entry %s has no timestamp", e.ID)
+	}
+
+	for i, step := range e.Steps {
+		if step.Type == "" {
+			return fmt.Errorf("step %d of entry %s has no type", i, e.ID)
+		}
+		switch step.Status {
+		case StepStatusPending, StepStatusRunning, StepStatusCompleted, StepStatusFailed:
+		default:
+			return fmt.Errorf("step %d of entry %s has unknown status %q", i, e.ID, step.Status)
+		}
+	}
+	return nil
+}
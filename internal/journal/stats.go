@@ -0,0 +1,82 @@
+package journal
+
+import (
+	"sort"
+	"time"
+)
+
+// Duration returns how long the step ran, 0 when it has not ended
+func (s *Step) Duration() time.Duration {
+	if s.StartTime.IsZero() || s.EndTime.IsZero() {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// StepTiming is a step that ran, with the entry it belongs to
+type StepTiming struct {
+	EntryID   string
+	Operation OperationType
+	Step      Step
+}
+
+// StepStats sums up the time the steps of one type took
+type StepStats struct {
+	Type  StepType
+	Count int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Average returns the average time a step of the type took
+func (s StepStats) Average() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Timings returns the steps of entries that started and ended, slowest first
+func Timings(entries []*JournalEntry) []StepTiming {
+	var timings []StepTiming
+	for _, entry := range entries {
+		for _, step := range entry.Steps {
+			if step.StartTime.IsZero() || step.EndTime.IsZero() {
+				continue
+			}
+			timings = append(timings, StepTiming{EntryID: entry.ID, Operation: entry.Operation, Step: step})
+		}
+	}
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].Step.Duration() > timings[j].Step.Duration()
+	})
+	return timings
+}
+
+// Stats sums up timings by step type, the type that took the most time first
+func Stats(timings []StepTiming) []StepStats {
+	byType := make(map[StepType]*StepStats)
+	for _, timing := range timings {
+		stats, ok := byType[timing.Step.Type]
+		if !ok {
+			stats = &StepStats{Type: timing.Step.Type}
+			byType[timing.Step.Type] = stats
+		}
+		d := timing.Step.Duration()
+		stats.Count++
+		stats.Total += d
+		stats.Max = max(stats.Max, d)
+	}
+
+	result := make([]StepStats, 0, len(byType))
+	for _, stats := range byType {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
@@ -0,0 +1,49 @@
+package journal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	step := func(stepType StepType, d time.Duration) Step {
+		return Step{Type: stepType, StartTime: start, EndTime: start.Add(d)}
+	}
+
+	entries := []*JournalEntry{
+		{ID: "add", Operation: OperationTypeAdd, Steps: []Step{
+			step(StepTypeCopy, 3*time.Second),
+			step(StepTypeVerify, time.Second),
+			step(StepTypeGit, 500*time.Millisecond),
+		}},
+		{ID: "push", Operation: OperationTypePush, Steps: []Step{
+			step(StepTypeGit, 2*time.Second),
+			// Steps that never ended are left out
+			{Type: StepTypeGit, StartTime: start},
+		}},
+	}
+
+	timings := Timings(entries)
+	if len(timings) != 4 {
+		t.Fatalf("expected 4 timed steps, got %d", len(timings))
+	}
+	if timings[0].EntryID != "add" || timings[0].Step.Type != StepTypeCopy {
+		t.Errorf("expected the copy step to be the slowest, got %+v", timings[0])
+	}
+	if timings[1].Operation != OperationTypePush || timings[1].Step.Duration() != 2*time.Second {
+		t.Errorf("expected the push to come second, got %+v", timings[1])
+	}
+
+	stats := Stats(timings)
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 step types, got %+v", stats)
+	}
+	if stats[0].Type != StepTypeCopy || stats[1].Type != StepTypeGit || stats[2].Type != StepTypeVerify {
+		t.Errorf("expected copy, git and verify by total time, got %+v", stats)
+	}
+	git := stats[1]
+	if git.Count != 2 || git.Total != 2500*time.Millisecond || git.Max != 2*time.Second || git.Average() != 1250*time.Millisecond {
+		t.Errorf("unexpected git stats %+v", git)
+	}
+}
@@ -0,0 +1,105 @@
+// Package machines keeps a registry of the machines that link the dotman
+// repository, one file per machine in the machines directory of the
+// repository, so every machine knows when the others last caught up.
+package machines
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// Dir is the directory of the registry in the dotman directory
+const Dir = "machines"
+
+// Machine is the registry record of a machine
+type Machine struct {
+	// ID is the machine ID dotman keeps in its local state, which outlives
+	// hostname changes
+	ID       string `json:"id,omitempty"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	// Version is the dotman version that last linked on the machine
+	Version string `json:"version"`
+	// LastLink is when the machine last linked the repository
+	LastLink time.Time `json:"last_link"`
+}
+
+// Stale reports whether the machine has not linked for longer than age at
+// now. An age of 0 never makes a machine stale.
+func (m Machine) Stale(now time.Time, age time.Duration) bool {
+	return age > 0 && now.Sub(m.LastLink) > age
+}
+
+// unsafeChars are the characters replaced in hostnames to name their files
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Path returns the file of the machine with hostname in the registry of
+// dotmanDir
+func Path(dotmanDir, hostname string) string {
+	name := strings.Trim(unsafeChars.ReplaceAllString(hostname, "-"), ".")
+	if name == "" {
+		name = "unknown"
+	}
+	return filepath.Join(dotmanDir, Dir, name+".json")
+}
+
+// Record writes the record of m to the registry of dotmanDir, replacing the
+// previous one of its hostname. The record is created within perm.
+func Record(fsys dotmanfs.FileSystem, dotmanDir string, m Machine, perm dotmanfs.Perm) error {
+	path := Path(dotmanDir, m.Hostname)
+	if err := fsys.MkdirAll(filepath.Dir(path), perm.DirMode()); err != nil {
+		return fmt.Errorf("error creating machine registry: %w", err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding machine record: %w", err)
+	}
+	if err := fsys.WriteFile(path, append(data, '\n'), perm.FileMode()); err != nil {
+		return fmt.Errorf("error writing machine record: %w", err)
+	}
+	return nil
+}
+
+// List returns the machines of the registry of dotmanDir by hostname. A
+// missing registry has none, unreadable records are skipped.
+func List(fsys dotmanfs.FileSystem, dotmanDir string) ([]Machine, error) {
+	dir := filepath.Join(dotmanDir, Dir)
+	files, err := fsys.Readdir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading machine registry: %w", err)
+	}
+
+	var machines []Machine
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := fsys.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading machine record: %w", err)
+		}
+		var m Machine
+		if err := json.Unmarshal(data, &m); err != nil || m.Hostname == "" {
+			continue
+		}
+		machines = append(machines, m)
+	}
+
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Hostname < machines[j].Hostname
+	})
+	return machines, nil
+}
@@ -0,0 +1,57 @@
+package machines
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+func TestRegistry(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+
+	// A repository no machine linked yet has no registry
+	machines, err := List(fsys, dotmanDir)
+	if err != nil || len(machines) != 0 {
+		t.Fatalf("expected an empty registry, got %v (%v)", machines, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	records := []Machine{
+		{Hostname: "work", OS: "darwin", Arch: "arm64", Version: "1.0.0", LastLink: now.Add(-40 * 24 * time.Hour)},
+		{Hostname: "desk", OS: "linux", Arch: "amd64", Version: "1.1.0", LastLink: now.Add(-time.Hour)},
+		{Hostname: "desk", OS: "linux", Arch: "amd64", Version: "1.2.0", LastLink: now},
+	}
+	for _, m := range records {
+		if err := Record(fsys, dotmanDir, m, dotmanfs.Perm{}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	// A machine has one record, the latest
+	machines, err = List(fsys, dotmanDir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(machines) != 2 || machines[0].Hostname != "desk" || machines[1].Hostname != "work" {
+		t.Fatalf("expected desk and work, got %v", machines)
+	}
+	if machines[0].Version != "1.2.0" || !machines[0].LastLink.Equal(now) {
+		t.Errorf("expected the latest record of desk, got %+v", machines[0])
+	}
+
+	age := 30 * 24 * time.Hour
+	if machines[0].Stale(now, age) || !machines[1].Stale(now, age) {
+		t.Errorf("expected only work to be stale")
+	}
+	if machines[1].Stale(now, 0) {
+		t.Errorf("expected an age of 0 to never make a machine stale")
+	}
+
+	// Hostnames cannot escape the registry
+	if path := Path(dotmanDir, "../evil/host"); filepath.Dir(path) != filepath.Join(dotmanDir, Dir) {
+		t.Errorf("expected the record to stay in the registry, got %s", path)
+	}
+}
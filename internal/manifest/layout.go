@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Layout names the directories inside the dotman directory that hold the
+// copies of tracked entries. It is kept in the manifest, so every clone of
+// the repository finds the copies in the same place. The zero Layout is the
+// default one, data/ and system/.
+type Layout struct {
+	// Home holds the copies of dotfiles below the home directory, relative
+	// to the dotman directory with forward slashes, such as home or
+	// dotfiles/home
+	Home string `json:"home,omitempty"`
+	// System holds the copies of system files outside the home directory
+	System string `json:"system,omitempty"`
+}
+
+// reservedDirs are the entries of the dotman directory a layout cannot use
+var reservedDirs = []string{".git", "journal", ".offload", FileName}
+
+// home returns the directory holding the copies of home dotfiles
+func (l Layout) home() string {
+	if l.Home == "" {
+		return DataDir
+	}
+	return l.Home
+}
+
+// system returns the directory holding the copies of system files
+func (l Layout) system() string {
+	if l.System == "" {
+		return SystemDir
+	}
+	return l.System
+}
+
+// HomeDir returns the directory inside dotmanDir that holds the copies of
+// dotfiles below the home directory
+func (l Layout) HomeDir(dotmanDir string) string {
+	return filepath.Join(dotmanDir, filepath.FromSlash(l.home()))
+}
+
+// SystemDir returns the directory inside dotmanDir that holds the copies of
+// system files
+func (l Layout) SystemDir(dotmanDir string) string {
+	return filepath.Join(dotmanDir, filepath.FromSlash(l.system()))
+}
+
+// Dirs returns the directories of the layout relative to the dotman
+// directory, with forward slashes: the home one and the system one
+func (l Layout) Dirs() []string {
+	return []string{l.home(), l.system()}
+}
+
+// RepoPath returns the location of the copy of entry inside dotmanDir. With
+// an empty dotmanDir it is the path git stages it as, relative to the
+// repository.
+func (l Layout) RepoPath(dotmanDir string, entry Entry) string {
+	if entry.IsSystem() {
+		return filepath.Join(l.SystemDir(dotmanDir), entry.Path)
+	}
+	return filepath.Join(l.HomeDir(dotmanDir), entry.Path)
+}
+
+// HomeRel returns the home-relative path of the copy at repoPath, a path
+// relative to the repository with forward slashes as git reports it, and
+// whether it lies in the home directory of the layout
+func (l Layout) HomeRel(repoPath string) (string, bool) {
+	return strings.CutPrefix(repoPath, l.home()+"/")
+}
+
+// Validate checks that the directories are distinct, clean relative paths
+// inside the dotman directory that leave its own files alone
+func (l Layout) Validate() error {
+	dirs := l.Dirs()
+	for _, dir := range dirs {
+		if dir != path.Clean(dir) || path.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, "../") || strings.Contains(dir, `\`) {
+			return fmt.Errorf("layout directory %q must be a clean relative path with forward slashes inside the dotman directory", dir)
+		}
+		top, _, _ := strings.Cut(dir, "/")
+		for _, reserved := range reservedDirs {
+			if top == reserved {
+				return fmt.Errorf("layout directory %q is used by dotman itself", dir)
+			}
+		}
+	}
+	if dirs[0] == dirs[1] || strings.HasPrefix(dirs[0], dirs[1]+"/") || strings.HasPrefix(dirs[1], dirs[0]+"/") {
+		return fmt.Errorf("layout directories %q and %q must not contain each other", dirs[0], dirs[1])
+	}
+	return nil
+}
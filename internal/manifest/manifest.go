@@ -0,0 +1,494 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// FileName is the name of the manifest file stored in the root of the dotman directory
+const FileName = ".manfile"
+
+const (
+	// DataDir holds the copies of dotfiles tracked below the home directory,
+	// unless the layout of the manifest names another directory
+	DataDir = "data"
+	// SystemDir holds the copies of system files tracked outside the home
+	// directory, unless the layout of the manifest names another directory
+	SystemDir = "system"
+)
+
+const (
+	// BackendSymlink keeps copies of the entries in the repository and links
+	// them into place. It is the backend of a manifest that names none.
+	BackendSymlink = "symlink"
+	// BackendWorktree tracks the entries in place, with the home directory
+	// as the worktree of the repository, so nothing is copied or linked
+	BackendWorktree = "worktree"
+)
+
+// ValidateBackend checks that value names a backend
+func ValidateBackend(value string) error {
+	if value != BackendSymlink && value != BackendWorktree {
+		return fmt.Errorf("backend must be '%s' or '%s'", BackendSymlink, BackendWorktree)
+	}
+	return nil
+}
+
+// EntryType represents the kind of filesystem object a manifest entry tracks
+type EntryType string
+
+const (
+	EntryTypeFile      EntryType = "file"
+	EntryTypeDirectory EntryType = "directory"
+	EntryTypeSymlink   EntryType = "symlink"
+)
+
+const (
+	// LineEndingsKeep stores text files with the line endings they have
+	LineEndingsKeep = "keep"
+	// LineEndingsLF converts CRLF line endings of text files to LF
+	LineEndingsLF = "lf"
+)
+
+// ValidateLineEndings checks that value names a line ending mode
+func ValidateLineEndings(value string) error {
+	if value != LineEndingsKeep && value != LineEndingsLF {
+		return fmt.Errorf("line endings must be '%s' or '%s'", LineEndingsKeep, LineEndingsLF)
+	}
+	return nil
+}
+
+// Entry represents a single tracked dotfile
+type Entry struct {
+	// Path is the location of the dotfile relative to the user's home directory.
+	// The same relative path is used for the copy stored under the home
+	// directory of the layout, data/ by default. System files outside the
+	// home directory keep their absolute path and are stored under the
+	// system directory of the layout instead.
+	Path    string    `json:"path"`
+	Type    EntryType `json:"type"`
+	AddedAt time.Time `json:"added_at"`
+	// Package optionally groups the entry with related dotfiles
+	Package string `json:"package,omitempty"`
+	// LineEndings is LineEndingsLF when the CRLF line endings of the
+	// entry's text files were converted to LF on add, empty when kept as is
+	LineEndings string `json:"line_endings,omitempty"`
+	// Externals are git repositories inside a directory entry, such as
+	// plugin checkouts, that are cloned instead of copied into the repository
+	Externals []External `json:"externals,omitempty"`
+	// Note is a free-text description of the entry, for whoever else uses
+	// the repository
+	Note string `json:"note,omitempty"`
+	// Tags are short labels of the entry such as macos or gui, kept sorted
+	Tags []string `json:"tags,omitempty"`
+	// Mode is the permission the entry must have in place, in octal such as
+	// 0600, whatever mode its copy has. Empty leaves the mode alone.
+	Mode string `json:"mode,omitempty"`
+	// Alias is a short name commands accept in place of the entry's path,
+	// such as nvim for .config/nvim
+	Alias string `json:"alias,omitempty"`
+	// Include limits a directory entry to the listed paths inside it,
+	// relative to the entry with forward slashes. Each is linked on its own
+	// into the directory, whose other contents such as caches are left
+	// alone. Empty tracks the whole directory.
+	Include []string `json:"include,omitempty"`
+}
+
+// External is a git repository inside a directory entry. Its checkout is
+// kept below the entry's copy but ignored by the dotman repository, which
+// only records where to clone it from.
+type External struct {
+	// Path is the location of the checkout relative to the entry, with
+	// forward slashes
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	// Commit is the commit that was checked out when the entry was added
+	Commit string `json:"commit"`
+}
+
+// IsSystem reports whether the entry tracks a file outside the home directory
+func (e Entry) IsSystem() bool {
+	return filepath.IsAbs(e.Path)
+}
+
+// TargetPath returns the location the entry is linked to on this machine
+func (e Entry) TargetPath(homeDir string) string {
+	if e.IsSystem() {
+		return e.Path
+	}
+	return filepath.Join(homeDir, e.Path)
+}
+
+// Links returns what is linked in place of the entry: the entry itself, or
+// one entry per included path of a partially tracked directory
+func (e Entry) Links() []Entry {
+	if len(e.Include) == 0 {
+		return []Entry{e}
+	}
+	links := make([]Entry, 0, len(e.Include))
+	for _, include := range e.Include {
+		links = append(links, Entry{
+			Path:        filepath.Join(e.Path, filepath.FromSlash(include)),
+			AddedAt:     e.AddedAt,
+			Package:     e.Package,
+			LineEndings: e.LineEndings,
+		})
+	}
+	return links
+}
+
+// ValidateInclude checks that include names a path inside a directory entry
+func ValidateInclude(include string) error {
+	clean := path.Clean(include)
+	if include == "" || clean == "." || path.IsAbs(clean) || filepath.IsAbs(include) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("include '%s' must be a path inside the directory", include)
+	}
+	return nil
+}
+
+// FileMode returns the permission recorded for the entry and whether one is
+func (e Entry) FileMode() (os.FileMode, bool) {
+	if e.Mode == "" {
+		return 0, false
+	}
+	mode, err := ParseMode(e.Mode)
+	return mode, err == nil
+}
+
+// AddTags adds tags the entry does not have yet
+func (e *Entry) AddTags(tags ...string) {
+	for _, tag := range tags {
+		if !slices.Contains(e.Tags, tag) {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	sort.Strings(e.Tags)
+}
+
+// RemoveTags removes tags from the entry
+func (e *Entry) RemoveTags(tags ...string) {
+	e.Tags = slices.DeleteFunc(e.Tags, func(tag string) bool {
+		return slices.Contains(tags, tag)
+	})
+	if len(e.Tags) == 0 {
+		e.Tags = nil
+	}
+}
+
+// Package holds the settings of a named group of entries
+type Package struct {
+	// Hosts limits the package to machines whose hostname matches one of the
+	// glob patterns. An empty list applies the package everywhere.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// Manifest represents the set of dotfiles tracked by the dotman repository
+type Manifest struct {
+	Entries  []Entry            `json:"entries,omitempty"`
+	Packages map[string]Package `json:"packages,omitempty"`
+	// Layout says where the copies of the entries are kept
+	Layout Layout `json:"layout,omitzero"`
+	// Backend is how the repository holds the entries, BackendSymlink when
+	// empty
+	Backend string `json:"backend,omitempty"`
+}
+
+// InPlace reports whether the entries are tracked in place by the worktree
+// backend rather than copied into the repository
+func (m *Manifest) InPlace() bool {
+	return m.Backend == BackendWorktree
+}
+
+// Path returns the location of the manifest file inside the dotman directory
+func Path(dotmanDir string) string {
+	return filepath.Join(dotmanDir, FileName)
+}
+
+// Load reads the manifest from the dotman directory. A missing manifest is
+// treated as an empty one.
+func Load(fsys dotmanfs.FileSystem, dotmanDir string) (*Manifest, error) {
+	data, err := fsys.ReadFile(Path(dotmanDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Manifest{}, nil
+		}
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes manifest data
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	if err := m.Layout.Validate(); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	if m.Backend != "" {
+		if err := ValidateBackend(m.Backend); err != nil {
+			return nil, fmt.Errorf("error parsing manifest: %v", err)
+		}
+	}
+	aliases := make(map[string]bool)
+	for _, entry := range m.Entries {
+		if entry.Mode != "" {
+			if _, err := ParseMode(entry.Mode); err != nil {
+				return nil, fmt.Errorf("error parsing manifest: %s: %v", entry.Path, err)
+			}
+		}
+		for _, include := range entry.Include {
+			if err := ValidateInclude(include); err != nil {
+				return nil, fmt.Errorf("error parsing manifest: %s: %v", entry.Path, err)
+			}
+		}
+		if entry.Alias != "" {
+			if err := ValidateAlias(entry.Alias); err != nil || aliases[entry.Alias] {
+				return nil, fmt.Errorf("error parsing manifest: %s: alias '%s' is invalid or used twice", entry.Path, entry.Alias)
+			}
+			aliases[entry.Alias] = true
+		}
+	}
+
+	return &m, nil
+}
+
+// Save writes the manifest to the dotman directory, waiting until it is on
+// disk so the journal never records a change the manifest lost
+func Save(fsys dotmanfs.FileSystem, dotmanDir string, m *Manifest) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := fsys.WriteFileSync(Path(dotmanDir), data, 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+
+	return nil
+}
+
+// Marshal encodes the manifest with entries sorted by path so that the
+// resulting file produces stable git diffs
+func (m *Manifest) Marshal() ([]byte, error) {
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling manifest: %v", err)
+	}
+
+	return data, nil
+}
+
+// Find returns the entry tracking the given home-relative path
+func (m *Manifest) Find(path string) (*Entry, bool) {
+	path = filepath.Clean(path)
+	for i := range m.Entries {
+		if m.Entries[i].Path == path {
+			return &m.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindAlias returns the entry with the given alias
+func (m *Manifest) FindAlias(alias string) (*Entry, bool) {
+	for i := range m.Entries {
+		if m.Entries[i].Alias == alias {
+			return &m.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindParent returns the directory entry holding path, such as .config for
+// .config/nvim, which tracks path as part of it. A partially tracked
+// directory only holds its included paths and what lies below them. Of
+// nested entries holding path the innermost is returned.
+func (m *Manifest) FindParent(path string) (*Entry, bool) {
+	path = filepath.Clean(path)
+	var found *Entry
+	for i := range m.Entries {
+		entry := &m.Entries[i]
+		if !nested(entry.Path, path) || !entry.holds(path) {
+			continue
+		}
+		if found == nil || nested(found.Path, entry.Path) {
+			found = entry
+		}
+	}
+	return found, found != nil
+}
+
+// holds reports whether path, which lies below the entry, is tracked by it
+func (e *Entry) holds(path string) bool {
+	if len(e.Include) == 0 {
+		return true
+	}
+	for _, link := range e.Links() {
+		if link.Path == path || nested(link.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Children returns the paths of the entries below path, such as
+// .config/nvim for .config, in manifest order
+func (m *Manifest) Children(path string) []string {
+	path = filepath.Clean(path)
+	var children []string
+	for _, entry := range m.Entries {
+		if nested(path, entry.Path) {
+			children = append(children, entry.Path)
+		}
+	}
+	return children
+}
+
+// nested reports whether path lies below dir. Home paths are relative and
+// system paths absolute, so the two never nest.
+func nested(dir, path string) bool {
+	if filepath.IsAbs(dir) != filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Add records an entry, replacing any existing entry for the same path
+func (m *Manifest) Add(entry Entry) {
+	entry.Path = filepath.Clean(entry.Path)
+	if existing, ok := m.Find(entry.Path); ok {
+		*existing = entry
+		return
+	}
+	m.Entries = append(m.Entries, entry)
+}
+
+// Remove deletes the entry for the given path and reports whether it existed
+func (m *Manifest) Remove(path string) bool {
+	path = filepath.Clean(path)
+	for i := range m.Entries {
+		if m.Entries[i].Path == path {
+			m.Entries = append(m.Entries[:i], m.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PackageNames returns the names of all packages used by entries or
+// configured with settings, sorted
+func (m *Manifest) PackageNames() []string {
+	seen := make(map[string]bool)
+	for _, entry := range m.Entries {
+		if entry.Package != "" {
+			seen[entry.Package] = true
+		}
+	}
+	for name := range m.Packages {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AppliesToHost reports whether the entry's package is enabled on the host.
+// Entries without a package apply to every host.
+func (m *Manifest) AppliesToHost(entry Entry, hostname string) bool {
+	pkg, ok := m.Packages[entry.Package]
+	if entry.Package == "" || !ok || len(pkg.Hosts) == 0 {
+		return true
+	}
+
+	for _, pattern := range pkg.Hosts {
+		if matched, err := path.Match(pattern, hostname); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHosts sets the host conditions of a package, removing its settings when
+// no hosts are given
+func (m *Manifest) SetHosts(name string, hosts []string) error {
+	for _, pattern := range hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid host pattern '%s': %v", pattern, err)
+		}
+	}
+
+	if len(hosts) == 0 {
+		delete(m.Packages, name)
+		return nil
+	}
+
+	if m.Packages == nil {
+		m.Packages = make(map[string]Package)
+	}
+	m.Packages[name] = Package{Hosts: hosts}
+	return nil
+}
+
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ValidatePackageName checks that name can be used as a package name
+func ValidatePackageName(name string) error {
+	if !packageNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid package name '%s'", name)
+	}
+	return nil
+}
+
+// ParseMode parses an octal permission such as 0600 or 644
+func ParseMode(mode string) (os.FileMode, error) {
+	return dotmanfs.ParsePerm(mode)
+}
+
+// FormatMode formats a permission the way the manifest records it
+func FormatMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// aliasPattern allows names that cannot be mistaken for paths
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateAlias checks that alias can be used as an entry alias
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias '%s', use letters, digits, - and _", alias)
+	}
+	return nil
+}
+
+// ValidateTag checks that tag can be used as an entry tag
+func ValidateTag(tag string) error {
+	if !packageNamePattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag '%s'", tag)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/noosxe/dotman/internal/fs"
+)
+
+func TestLoad_EmptyManifest(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(map[string]*fstest.MapFile{
+		"dotman/.manfile": {
+			Data: []byte("{}"),
+			Mode: 0644,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	m, err := Load(mockFS, "dotman")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(m.Entries) != 0 {
+		t.Fatalf("expected no entries, got %d", len(m.Entries))
+	}
+}
+
+func TestManifest_SaveAndLoad(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystem(nil)
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	if err := mockFS.MkdirAll("dotman", 0755); err != nil {
+		t.Fatalf("failed to create dotman directory: %v", err)
+	}
+
+	m := &Manifest{}
+	m.Add(Entry{Path: ".zshrc", Type: EntryTypeFile})
+	m.Add(Entry{Path: ".config/nvim/", Type: EntryTypeDirectory})
+
+	if err := Save(mockFS, "dotman", m); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(mockFS, "dotman")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(loaded.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(loaded.Entries))
+	}
+
+	// Entries are sorted by path on save
+	if loaded.Entries[0].Path != ".config/nvim" {
+		t.Fatalf("expected first entry '.config/nvim', got '%s'", loaded.Entries[0].Path)
+	}
+
+	entry, ok := loaded.Find(".zshrc")
+	if !ok {
+		t.Fatal("expected to find .zshrc entry")
+	}
+	if entry.Type != EntryTypeFile {
+		t.Fatalf("expected type '%s', got '%s'", EntryTypeFile, entry.Type)
+	}
+}
+
+func TestManifest_AddReplacesAndRemove(t *testing.T) {
+	m := &Manifest{}
+	m.Add(Entry{Path: ".vimrc", Type: EntryTypeFile})
+	m.Add(Entry{Path: ".vimrc", Type: EntryTypeDirectory})
+
+	if len(m.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(m.Entries))
+	}
+	if m.Entries[0].Type != EntryTypeDirectory {
+		t.Fatalf("expected entry to be replaced, got type '%s'", m.Entries[0].Type)
+	}
+
+	if !m.Remove(".vimrc") {
+		t.Fatal("expected Remove to report existing entry")
+	}
+	if m.Remove(".vimrc") {
+		t.Fatal("expected Remove to report missing entry")
+	}
+}
+
+func TestManifest_Nested(t *testing.T) {
+	m := &Manifest{}
+	m.Add(Entry{Path: ".config", Type: EntryTypeDirectory})
+	m.Add(Entry{Path: ".local/share/fonts", Type: EntryTypeDirectory})
+	m.Add(Entry{Path: ".local/share/applications", Type: EntryTypeDirectory})
+	m.Add(Entry{Path: "/etc/hosts", Type: EntryTypeFile})
+
+	if parent, ok := m.FindParent(".config/nvim/init.lua"); !ok || parent.Path != ".config" {
+		t.Errorf("expected .config to hold .config/nvim/init.lua, got %+v", parent)
+	}
+	m.Add(Entry{Path: ".config/nvim", Type: EntryTypeDirectory})
+	if parent, ok := m.FindParent(".config/nvim/init.lua"); !ok || parent.Path != ".config/nvim" {
+		t.Errorf("expected the innermost entry .config/nvim to hold .config/nvim/init.lua, got %+v", parent)
+	}
+	m.Remove(".config/nvim")
+	for _, path := range []string{".config", ".configs", ".local/share", "/etc"} {
+		if parent, ok := m.FindParent(path); ok {
+			t.Errorf("expected no entry holding %s, got %s", path, parent.Path)
+		}
+	}
+
+	if children := m.Children(".local"); len(children) != 2 || children[0] != ".local/share/fonts" || children[1] != ".local/share/applications" {
+		t.Errorf("expected both .local/share entries below .local, got %v", children)
+	}
+	if children := m.Children(".config"); len(children) != 0 {
+		t.Errorf("expected an entry not to be its own child, got %v", children)
+	}
+	if children := m.Children("/etc"); len(children) != 1 || children[0] != "/etc/hosts" {
+		t.Errorf("expected /etc/hosts below /etc, got %v", children)
+	}
+}
+
+func TestEntry_Include(t *testing.T) {
+	m, err := Parse([]byte(`{"entries": [{"path": ".config/fish", "type": "directory", "include": ["config.fish", "functions"]}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	links := m.Entries[0].Links()
+	if len(links) != 2 || links[0].Path != filepath.Join(".config/fish", "config.fish") || links[1].Path != filepath.Join(".config/fish", "functions") {
+		t.Errorf("expected a link per included path, got %+v", links)
+	}
+	if links := (Entry{Path: ".vimrc"}).Links(); len(links) != 1 || links[0].Path != ".vimrc" {
+		t.Errorf("expected an entry without include list to be its own link, got %+v", links)
+	}
+
+	if _, ok := m.FindParent(".config/fish/functions/ll.fish"); !ok {
+		t.Error("expected an included directory to hold its files")
+	}
+	if _, ok := m.FindParent(".config/fish/fish_variables"); ok {
+		t.Error("expected a sibling of the included paths not to be held")
+	}
+
+	for _, include := range []string{"", ".", "..", "../x", "/etc"} {
+		if err := ValidateInclude(include); err == nil {
+			t.Errorf("expected include %q to be refused", include)
+		}
+	}
+}
+
+func TestManifest_Packages(t *testing.T) {
+	m := &Manifest{}
+	m.Add(Entry{Path: ".zshrc", Type: EntryTypeFile, Package: "zsh"})
+	m.Add(Entry{Path: ".work", Type: EntryTypeFile, Package: "work-only"})
+	m.Add(Entry{Path: ".profile", Type: EntryTypeFile})
+
+	if err := m.SetHosts("work-only", []string{"work-*", "office"}); err != nil {
+		t.Fatalf("SetHosts failed: %v", err)
+	}
+	if err := m.SetHosts("broken", []string{"["}); err == nil {
+		t.Fatal("expected error for invalid host pattern")
+	}
+
+	names := m.PackageNames()
+	if len(names) != 2 || names[0] != "work-only" || names[1] != "zsh" {
+		t.Fatalf("expected [work-only zsh], got %v", names)
+	}
+
+	work, _ := m.Find(".work")
+	if m.AppliesToHost(*work, "laptop") {
+		t.Fatal("expected work-only not to apply to laptop")
+	}
+	if !m.AppliesToHost(*work, "work-desktop") || !m.AppliesToHost(*work, "office") {
+		t.Fatal("expected work-only to apply to work hosts")
+	}
+
+	profile, _ := m.Find(".profile")
+	if !m.AppliesToHost(*profile, "laptop") {
+		t.Fatal("expected entries without package to apply everywhere")
+	}
+
+	if err := m.SetHosts("work-only", nil); err != nil {
+		t.Fatalf("SetHosts failed: %v", err)
+	}
+	if !m.AppliesToHost(*work, "laptop") {
+		t.Fatal("expected cleared host conditions to apply everywhere")
+	}
+}
+
+func TestEntry_Tags(t *testing.T) {
+	entry := Entry{Path: ".config/karabiner", Type: EntryTypeDirectory}
+
+	entry.AddTags("macos", "gui", "macos")
+	if len(entry.Tags) != 2 || entry.Tags[0] != "gui" || entry.Tags[1] != "macos" {
+		t.Fatalf("expected [gui macos], got %v", entry.Tags)
+	}
+
+	entry.RemoveTags("gui", "missing")
+	if len(entry.Tags) != 1 || entry.Tags[0] != "macos" {
+		t.Fatalf("expected [macos], got %v", entry.Tags)
+	}
+	entry.RemoveTags("macos")
+	if entry.Tags != nil {
+		t.Fatalf("expected no tags, got %v", entry.Tags)
+	}
+
+	if err := ValidateTag("work-only"); err != nil {
+		t.Errorf("expected valid tag, got %v", err)
+	}
+	if err := ValidateTag("two words"); err == nil {
+		t.Error("expected error for tag with a space")
+	}
+}
+
+func TestEntry_Paths(t *testing.T) {
+	home := Entry{Path: ".zshrc"}
+	if home.IsSystem() {
+		t.Fatal("expected home entry not to be a system entry")
+	}
+	if got := (Layout{}).RepoPath("/dotman", home); got != "/dotman/data/.zshrc" {
+		t.Fatalf("unexpected repo path '%s'", got)
+	}
+	if got := home.TargetPath("/home/test"); got != "/home/test/.zshrc" {
+		t.Fatalf("unexpected target path '%s'", got)
+	}
+
+	system := Entry{Path: "/etc/hosts"}
+	if !system.IsSystem() {
+		t.Fatal("expected absolute entry to be a system entry")
+	}
+	if got := (Layout{}).RepoPath("/dotman", system); got != "/dotman/system/etc/hosts" {
+		t.Fatalf("unexpected repo path '%s'", got)
+	}
+	if got := system.TargetPath("/home/test"); got != "/etc/hosts" {
+		t.Fatalf("unexpected target path '%s'", got)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	layout := Layout{Home: "dotfiles/home", System: "dotfiles/root"}
+	if err := layout.Validate(); err != nil {
+		t.Fatalf("expected valid layout, got %v", err)
+	}
+	if got := layout.RepoPath("/dotman", Entry{Path: ".zshrc"}); got != "/dotman/dotfiles/home/.zshrc" {
+		t.Errorf("unexpected repo path '%s'", got)
+	}
+	if got := layout.RepoPath("/dotman", Entry{Path: "/etc/hosts"}); got != "/dotman/dotfiles/root/etc/hosts" {
+		t.Errorf("unexpected repo path '%s'", got)
+	}
+	if rel, ok := layout.HomeRel("dotfiles/home/.config/nvim/init.lua"); !ok || rel != ".config/nvim/init.lua" {
+		t.Errorf("unexpected home-relative path '%s' (%v)", rel, ok)
+	}
+	if _, ok := layout.HomeRel("data/.zshrc"); ok {
+		t.Error("expected data/ to be outside the layout")
+	}
+
+	for _, bad := range []Layout{
+		{Home: "/abs"},
+		{Home: "../outside"},
+		{Home: "journal"},
+		{Home: ".git/data"},
+		{Home: "data/"},
+		{Home: "system"},
+		{Home: "files", System: "files/system"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be refused", bad)
+		}
+	}
+
+	// The default layout is not written to the manifest
+	data, err := (&Manifest{}).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "layout") {
+		t.Errorf("expected no layout in %s", data)
+	}
+	if _, err := Parse([]byte(`{"layout": {"home": "journal"}}`)); err == nil {
+		t.Error("expected a manifest with a bad layout to be refused")
+	}
+}
+
+func TestManifest_Backend(t *testing.T) {
+	m, err := Parse([]byte(`{"backend": "worktree"}`))
+	if err != nil || !m.InPlace() {
+		t.Fatalf("expected the worktree backend, got %+v (%v)", m, err)
+	}
+	if m, err := Parse([]byte(`{}`)); err != nil || m.InPlace() {
+		t.Errorf("expected the symlink backend by default, got %+v (%v)", m, err)
+	}
+	if _, err := Parse([]byte(`{"backend": "hardlink"}`)); err == nil {
+		t.Error("expected an unknown backend to be refused")
+	}
+}
+
+func TestEntry_Mode(t *testing.T) {
+	m, err := Parse([]byte(`{"entries": [{"path": ".ssh/config", "type": "file", "mode": "0600"}, {"path": ".zshrc", "type": "file"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if mode, ok := m.Entries[0].FileMode(); !ok || mode != 0600 {
+		t.Errorf("expected mode 0600, got %v (%v)", mode, ok)
+	}
+	if _, ok := m.Entries[1].FileMode(); ok {
+		t.Error("expected no mode for an entry without one")
+	}
+	if _, err := Parse([]byte(`{"entries": [{"path": ".zshrc", "type": "file", "mode": "0999"}]}`)); err == nil {
+		t.Error("expected an invalid mode to be refused")
+	}
+	if mode, err := ParseMode("644"); err != nil || FormatMode(mode) != "0644" {
+		t.Errorf("expected 644 to format as 0644, got %s (%v)", FormatMode(mode), err)
+	}
+}
+
+func TestManifest_Alias(t *testing.T) {
+	m, err := Parse([]byte(`{"entries": [{"path": ".config/nvim", "type": "directory", "alias": "nvim"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if entry, ok := m.FindAlias("nvim"); !ok || entry.Path != ".config/nvim" {
+		t.Errorf("expected nvim to be the alias of .config/nvim, got %+v", entry)
+	}
+	if _, ok := m.FindAlias("vim"); ok {
+		t.Error("expected no entry for an unknown alias")
+	}
+
+	if _, err := Parse([]byte(`{"entries": [{"path": ".vimrc", "type": "file", "alias": "vim"}, {"path": ".gvimrc", "type": "file", "alias": "vim"}]}`)); err == nil {
+		t.Error("expected an alias used twice to be refused")
+	}
+	for _, alias := range []string{".zshrc", "a/b", "~", ""} {
+		if err := ValidateAlias(alias); err == nil {
+			t.Errorf("expected alias %q to be refused", alias)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package offload
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// Store is where offloaded blobs live besides the local .offload/ copies
+type Store interface {
+	// Put uploads the file at src as the blob with the given hash
+	Put(hash, src string) error
+	// Get downloads the blob with the given hash to dst
+	Get(hash, dst string) error
+}
+
+// Command runs an external command. rsync and S3 stores shell out to their
+// command line tools through it. Tests replace it.
+var Command = func(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// New returns the store at location, which is either an absolute path to a
+// local directory, an rsync://[user@]host/path target or an s3://bucket/prefix
+// location
+func New(fsys dotmanfs.FileSystem, location string) (Store, error) {
+	if location == "" {
+		return nil, fmt.Errorf("offload_store is not set")
+	}
+	if filepath.IsAbs(location) {
+		return &dirStore{fsys: fsys, dir: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offload store %q: %w", location, err)
+	}
+	switch u.Scheme {
+	case "rsync":
+		if u.Host == "" || u.Path == "" {
+			return nil, fmt.Errorf("invalid offload store %q: want rsync://[user@]host/path", location)
+		}
+		host := u.Host
+		if u.User != nil {
+			host = u.User.Username() + "@" + host
+		}
+		return &rsyncStore{target: host + ":" + u.Path}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid offload store %q: want s3://bucket/prefix", location)
+		}
+		return &s3Store{prefix: "s3://" + u.Host + "/" + strings.Trim(u.Path, "/")}, nil
+	}
+	return nil, fmt.Errorf("invalid offload store %q: must be an absolute path, rsync:// or s3:// location", location)
+}
+
+// blobName returns the name of the blob with the given hash inside a store
+func blobName(hash string) string {
+	return hash[:2] + "/" + hash[2:]
+}
+
+// dirStore keeps blobs in a local directory, typically a mounted drive or a
+// synced folder
+type dirStore struct {
+	fsys dotmanfs.FileSystem
+	dir  string
+}
+
+func (s *dirStore) Put(hash, src string) error {
+	dst := filepath.Join(s.dir, filepath.FromSlash(blobName(hash)))
+	if _, err := s.fsys.Stat(dst); err == nil {
+		return nil
+	}
+	if err := s.fsys.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return dotmanfs.CopyFile(s.fsys, src, dst, dotmanfs.Perm{})
+}
+
+func (s *dirStore) Get(hash, dst string) error {
+	return dotmanfs.CopyFile(s.fsys, filepath.Join(s.dir, filepath.FromSlash(blobName(hash))), dst, dotmanfs.Perm{})
+}
+
+// rsyncStore keeps blobs in a directory on another host, reached with rsync
+type rsyncStore struct {
+	target string
+}
+
+func (s *rsyncStore) Put(hash, src string) error {
+	return Command("rsync", "--mkpath", "--ignore-existing", src, s.target+"/"+blobName(hash))
+}
+
+func (s *rsyncStore) Get(hash, dst string) error {
+	return Command("rsync", s.target+"/"+blobName(hash), dst)
+}
+
+// s3Store keeps blobs in an S3 bucket, reached with the aws command line tool
+// and its usual credentials
+type s3Store struct {
+	prefix string
+}
+
+func (s *s3Store) key(hash string) string {
+	if strings.HasSuffix(s.prefix, "/") {
+		return s.prefix + blobName(hash)
+	}
+	return s.prefix + "/" + blobName(hash)
+}
+
+func (s *s3Store) Put(hash, src string) error {
+	return Command("aws", "s3", "cp", "--only-show-errors", src, s.key(hash))
+}
+
+func (s *s3Store) Get(hash, dst string) error {
+	return Command("aws", "s3", "cp", "--only-show-errors", s.key(hash), dst)
+}
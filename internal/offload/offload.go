@@ -0,0 +1,143 @@
+// Package offload keeps the content of large files out of the dotman
+// repository.
+//
+// An offloaded file is replaced in data/ by a relative symlink to a blob
+// under .offload/, named by the SHA-256 of its content. The symlink is the
+// pointer git records. The .offload/ directory is ignored by git: its blobs
+// are uploaded to a blob store, a local directory, an rsync target or an S3
+// bucket, and fetched from there on machines that do not have them yet.
+package offload
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/store"
+)
+
+// Dir is the directory inside the dotman directory holding the local copies
+// of offloaded blobs
+const Dir = ".offload"
+
+// blobTarget matches the target of a symlink pointing at an offloaded blob
+var blobTarget = regexp.MustCompile(`(^|/)\.offload/([0-9a-f]{2})/([0-9a-f]{62})$`)
+
+// BlobPath returns the local location of the blob with the given hash
+func BlobPath(dotmanDir, hash string) string {
+	return store.BlobIn(filepath.Join(dotmanDir, Dir), hash)
+}
+
+// Offload moves the regular files at or below path that are larger than
+// threshold into the blob store and replaces each of them with a pointer to
+// its blob. It returns the number of files offloaded.
+func Offload(fsys dotmanfs.FileSystem, dotmanDir, path string, threshold int64, blobs Store) (int, error) {
+	var files []string
+	err := fsys.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > threshold {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, file := range files {
+		// Blobs are read-only like those of the dedup store
+		hash, err := store.Keep(fsys, filepath.Join(dotmanDir, Dir), file)
+		if err != nil {
+			return i, err
+		}
+		if err := blobs.Put(hash, BlobPath(dotmanDir, hash)); err != nil {
+			return i, fmt.Errorf("error uploading %s: %w", file, err)
+		}
+
+		if err := fsys.Remove(file); err != nil {
+			return i, err
+		}
+		if err := store.LinkBlob(fsys, BlobPath(dotmanDir, hash), file); err != nil {
+			return i, err
+		}
+	}
+
+	return len(files), nil
+}
+
+// Resolve returns the hash of the blob the pointer at path points at. ok is
+// false when path is not a pointer.
+func Resolve(fsys dotmanfs.FileSystem, path string) (hash string, ok bool) {
+	target, err := fsys.Readlink(path)
+	if err != nil {
+		return "", false
+	}
+
+	match := blobTarget.FindStringSubmatch(filepath.ToSlash(target))
+	if match == nil {
+		return "", false
+	}
+	return match[2] + match[3], true
+}
+
+// Missing returns the pointers at or below path whose blob is not on this
+// machine yet. A path that does not exist has no missing blobs.
+func Missing(fsys dotmanfs.FileSystem, dotmanDir, path string) ([]string, error) {
+	return store.MissingBlobs(fsys, path, func(link string) (string, bool) {
+		hash, ok := Resolve(fsys, link)
+		if !ok {
+			return "", false
+		}
+		return BlobPath(dotmanDir, hash), true
+	})
+}
+
+// Fetch downloads the blobs of the pointers at or below path that are not on
+// this machine yet, checking each against its hash. It returns the number of
+// blobs fetched.
+func Fetch(fsys dotmanfs.FileSystem, dotmanDir, path string, blobs Store) (int, error) {
+	missing, err := Missing(fsys, dotmanDir, path)
+	if err != nil {
+		return 0, err
+	}
+
+	fetched := 0
+	for _, link := range missing {
+		hash, _ := Resolve(fsys, link)
+		blob := BlobPath(dotmanDir, hash)
+		if _, err := fsys.Lstat(blob); err == nil {
+			// Another pointer to the same content fetched it
+			continue
+		}
+
+		if err := fsys.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return fetched, fmt.Errorf("error creating offload directory: %w", err)
+		}
+		tmp := blob + ".tmp"
+		if err := blobs.Get(hash, tmp); err != nil {
+			fsys.Remove(tmp)
+			return fetched, fmt.Errorf("error fetching %s: %w", link, err)
+		}
+		got, err := store.Hash(fsys, tmp)
+		if err != nil || got != hash {
+			fsys.Remove(tmp)
+			return fetched, fmt.Errorf("blob fetched for %s does not match its hash %s", link, hash)
+		}
+		if err := store.Finish(fsys, tmp, blob); err != nil {
+			return fetched, err
+		}
+		fetched++
+	}
+	return fetched, nil
+}
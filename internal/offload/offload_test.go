@@ -0,0 +1,143 @@
+package offload
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+func TestOffloadAndFetch(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	dataDir := filepath.Join(dotmanDir, "data")
+	blobs, err := New(fsys, t.TempDir())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	fsys.MkdirAll(filepath.Join(dataDir, "wallpapers"), 0755)
+	fsys.WriteFile(filepath.Join(dataDir, "wallpapers/big.png"), []byte(strings.Repeat("x", 64)), 0644)
+	fsys.WriteFile(filepath.Join(dataDir, "wallpapers/small.txt"), []byte("small"), 0644)
+
+	count, err := Offload(fsys, dotmanDir, filepath.Join(dataDir, "wallpapers"), 16, blobs)
+	if err != nil {
+		t.Fatalf("Offload failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Offload replaced %d files, want 1", count)
+	}
+
+	big := filepath.Join(dataDir, "wallpapers/big.png")
+	hash, ok := Resolve(fsys, big)
+	if !ok {
+		t.Fatal("expected the large file to be replaced with a pointer")
+	}
+	if _, ok := Resolve(fsys, filepath.Join(dataDir, "wallpapers/small.txt")); ok {
+		t.Error("expected the small file to stay in the repository")
+	}
+	target, err := fsys.Readlink(big)
+	if err != nil || filepath.IsAbs(target) {
+		t.Errorf("expected a relative pointer, got %q (%v)", target, err)
+	}
+
+	// A fresh clone has the pointer but not the blob
+	if err := fsys.RemoveAll(filepath.Join(dotmanDir, Dir)); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	missing, err := Missing(fsys, dotmanDir, dataDir)
+	if err != nil || len(missing) != 1 || missing[0] != big {
+		t.Fatalf("expected %s to be missing its blob, got %v (%v)", big, missing, err)
+	}
+
+	fetched, err := Fetch(fsys, dotmanDir, dataDir, blobs)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if fetched != 1 {
+		t.Errorf("Fetch downloaded %d blobs, want 1", fetched)
+	}
+	data, err := fsys.ReadFile(big)
+	if err != nil || string(data) != strings.Repeat("x", 64) {
+		t.Errorf("reading the pointer after fetch returned %q (%v)", data, err)
+	}
+	info, err := fsys.Stat(BlobPath(dotmanDir, hash))
+	if err != nil || info.Mode().Perm()&0222 != 0 {
+		t.Errorf("expected a read-only blob, got %v (%v)", info, err)
+	}
+
+	if fetched, err := Fetch(fsys, dotmanDir, dataDir, blobs); err != nil || fetched != 0 {
+		t.Errorf("second Fetch downloaded %d blobs (%v), want 0", fetched, err)
+	}
+}
+
+func TestFetch_HashMismatch(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	storeDir := t.TempDir()
+	blobs, _ := New(fsys, storeDir)
+
+	fsys.MkdirAll(filepath.Join(dotmanDir, "data"), 0755)
+	file := filepath.Join(dotmanDir, "data/archive.tar")
+	fsys.WriteFile(file, []byte("original content"), 0644)
+	if _, err := Offload(fsys, dotmanDir, file, 0, blobs); err != nil {
+		t.Fatalf("Offload failed: %v", err)
+	}
+	hash, _ := Resolve(fsys, file)
+	fsys.RemoveAll(filepath.Join(dotmanDir, Dir))
+
+	// Damage the copy in the store
+	fsys.WriteFile(filepath.Join(storeDir, hash[:2], hash[2:]), []byte("tampered"), 0644)
+
+	if _, err := Fetch(fsys, dotmanDir, file, blobs); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a hash mismatch error, got %v", err)
+	}
+	if _, err := fsys.Lstat(BlobPath(dotmanDir, hash)); err == nil {
+		t.Error("expected no blob to be kept after a mismatch")
+	}
+}
+
+func TestNew(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+
+	var calls [][]string
+	orig := Command
+	Command = func(name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		return nil
+	}
+	defer func() { Command = orig }()
+
+	hash := strings.Repeat("ab", 32)
+
+	rsync, err := New(fsys, "rsync://me@backup/srv/blobs")
+	if err != nil {
+		t.Fatalf("New rsync failed: %v", err)
+	}
+	rsync.Put(hash, "/tmp/blob")
+	s3, err := New(fsys, "s3://bucket/dotman/")
+	if err != nil {
+		t.Fatalf("New s3 failed: %v", err)
+	}
+	s3.Get(hash, "/tmp/blob")
+
+	want := []string{
+		"rsync --mkpath --ignore-existing /tmp/blob me@backup:/srv/blobs/ab/" + hash[2:],
+		"aws s3 cp --only-show-errors s3://bucket/dotman/ab/" + hash[2:] + " /tmp/blob",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d commands, got %v", len(want), calls)
+	}
+	for i, call := range calls {
+		if got := strings.Join(call, " "); got != want[i] {
+			t.Errorf("command %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	for _, location := range []string{"", "relative/dir", "ftp://host/dir", "rsync://host"} {
+		if _, err := New(fsys, location); err == nil {
+			t.Errorf("expected an error for offload store %q", location)
+		}
+	}
+}
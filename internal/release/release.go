@@ -0,0 +1,106 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// DefaultAPIURL lists the releases of the dotman repository
+const DefaultAPIURL = "https://api.github.com/repos/noosxe/dotman/releases"
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// Release is a published GitHub release
+type Release struct {
+	TagName    string  `json:"tag_name"`
+	Name       string  `json:"name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	HTMLURL    string  `json:"html_url"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Client queries the releases API
+type Client struct {
+	HTTPClient *http.Client
+	APIURL     string
+}
+
+// NewClient returns a client for the dotman repository releases
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		APIURL:     DefaultAPIURL,
+	}
+}
+
+// List returns the published releases, newest first as reported by the API
+func (c *Client) List(ctx context.Context) ([]Release, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.APIURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying releases: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error querying releases: unexpected status %s", resp.Status)
+	}
+
+	var releases []Release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("error decoding releases: %v", err)
+	}
+
+	return releases, nil
+}
+
+// Latest returns the release with the highest semantic version, skipping
+// drafts and, unless prerelease is set, pre-releases
+func (c *Client) Latest(ctx context.Context, prerelease bool) (*Release, error) {
+	releases, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Release
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || (r.Prerelease && !prerelease) || !semver.IsValid(r.TagName) {
+			continue
+		}
+		if latest == nil || semver.Compare(r.TagName, latest.TagName) > 0 {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no releases found")
+	}
+
+	return latest, nil
+}
+
+// Newer reports whether candidate is a higher semantic version than current.
+// Builds without a valid version, such as development builds, are never
+// considered outdated.
+func Newer(current, candidate string) bool {
+	if !semver.IsValid(current) || !semver.IsValid(candidate) {
+		return false
+	}
+	return semver.Compare(candidate, current) > 0
+}
@@ -0,0 +1,120 @@
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLatest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"tag_name": "v1.3.0-rc.1", "prerelease": true},
+			{"tag_name": "v1.2.0"},
+			{"tag_name": "v1.10.0", "draft": true},
+			{"tag_name": "v1.1.5"},
+			{"tag_name": "nightly"}
+		]`))
+	}))
+	defer server.Close()
+
+	client := &Client{HTTPClient: server.Client(), APIURL: server.URL}
+
+	latest, err := client.Latest(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest.TagName != "v1.2.0" {
+		t.Fatalf("expected v1.2.0, got %s", latest.TagName)
+	}
+
+	latest, err = client.Latest(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest.TagName != "v1.3.0-rc.1" {
+		t.Fatalf("expected v1.3.0-rc.1, got %s", latest.TagName)
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		current   string
+		candidate string
+		newer     bool
+	}{
+		{"v1.0.0", "v1.0.1", true},
+		{"v1.2.0", "v1.10.0", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.3.0", "v1.2.0", false},
+		{"dev", "v1.2.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := Newer(tt.current, tt.candidate); got != tt.newer {
+			t.Fatalf("Newer(%q, %q) = %v, expected %v", tt.current, tt.candidate, got, tt.newer)
+		}
+	}
+}
+
+func TestParseChecksumsAndVerify(t *testing.T) {
+	binary := []byte("new dotman binary")
+	sum := sha256.Sum256(binary)
+	digest := hex.EncodeToString(sum[:])
+
+	sums := ParseChecksums([]byte(digest + "  dotman_linux_amd64\n" + strings.Repeat("0", 64) + " *dotman_windows_amd64.exe\n"))
+	if sums["dotman_linux_amd64"] != digest {
+		t.Fatalf("expected digest %s, got %s", digest, sums["dotman_linux_amd64"])
+	}
+	if _, ok := sums["dotman_windows_amd64.exe"]; !ok {
+		t.Fatal("expected binary mode entry to be parsed")
+	}
+
+	if err := VerifyChecksum(binary, digest); err != nil {
+		t.Fatalf("VerifyChecksum failed: %v", err)
+	}
+	if err := VerifyChecksum([]byte("tampered"), digest); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotman")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatalf("failed to write executable: %v", err)
+	}
+
+	if err := ReplaceExecutable(path, []byte("new")); err != nil {
+		t.Fatalf("ReplaceExecutable failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read executable: %v", err)
+	}
+	if string(data) != "new" {
+		t.Fatalf("expected new contents, got %q", data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat executable: %v", err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Fatalf("expected executable permissions, got %v", info.Mode())
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary file to be cleaned up, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,134 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+// configDir is the home-relative directory whose children are always considered candidates
+const configDir = ".config"
+
+// Category groups related rules
+type Category string
+
+const (
+	CategoryShell    Category = "shell"
+	CategoryEditor   Category = "editor"
+	CategoryTerminal Category = "terminal"
+	CategoryGit      Category = "git"
+	CategoryOther    Category = "other"
+)
+
+// Rule describes a well-known dotfile by its home-relative path
+type Rule struct {
+	Path     string
+	Category Category
+}
+
+// DefaultRules is the curated set of well-known dotfiles
+var DefaultRules = []Rule{
+	{".bashrc", CategoryShell},
+	{".bash_profile", CategoryShell},
+	{".bash_aliases", CategoryShell},
+	{".profile", CategoryShell},
+	{".zshrc", CategoryShell},
+	{".zprofile", CategoryShell},
+	{".zshenv", CategoryShell},
+	{".inputrc", CategoryShell},
+	{".config/fish", CategoryShell},
+	{".config/starship.toml", CategoryShell},
+
+	{".vimrc", CategoryEditor},
+	{".vim", CategoryEditor},
+	{".emacs", CategoryEditor},
+	{".emacs.d", CategoryEditor},
+	{".config/nvim", CategoryEditor},
+	{".config/helix", CategoryEditor},
+
+	{".tmux.conf", CategoryTerminal},
+	{".screenrc", CategoryTerminal},
+	{".wezterm.lua", CategoryTerminal},
+	{".alacritty.toml", CategoryTerminal},
+	{".config/alacritty", CategoryTerminal},
+	{".config/kitty", CategoryTerminal},
+	{".config/wezterm", CategoryTerminal},
+	{".config/ghostty", CategoryTerminal},
+	{".config/tmux", CategoryTerminal},
+
+	{".gitconfig", CategoryGit},
+	{".gitignore_global", CategoryGit},
+	{".gitmessage", CategoryGit},
+	{".config/git", CategoryGit},
+
+	{".ssh/config", CategoryOther},
+}
+
+// Candidate is an existing, untracked path found by the scanner
+type Candidate struct {
+	Path     string   `json:"path"`
+	Category Category `json:"category"`
+	IsDir    bool     `json:"is_dir"`
+}
+
+// Scan returns the paths matched by DefaultRules and the children of ~/.config
+// that exist in homeDir and are not tracked by the manifest, sorted by path
+func Scan(fsys dotmanfs.FileSystem, homeDir string, m *manifest.Manifest) ([]Candidate, error) {
+	rules := make([]Rule, 0, len(DefaultRules))
+	for _, rule := range DefaultRules {
+		rules = append(rules, Rule{Path: filepath.FromSlash(rule.Path), Category: rule.Category})
+	}
+
+	children, err := fsys.Readdir(filepath.Join(homeDir, configDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %v", configDir, err)
+	}
+	for _, child := range children {
+		rules = append(rules, Rule{Path: filepath.Join(configDir, child.Name()), Category: CategoryOther})
+	}
+
+	seen := make(map[string]bool)
+	var candidates []Candidate
+	for _, rule := range rules {
+		path := rule.Path
+		if seen[path] || tracked(m, path) {
+			continue
+		}
+		seen[path] = true
+
+		info, err := fsys.Stat(filepath.Join(homeDir, path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("error checking %s: %v", path, err)
+		}
+
+		candidates = append(candidates, Candidate{Path: path, Category: rule.Category, IsDir: info.IsDir()})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Path < candidates[j].Path
+	})
+
+	return candidates, nil
+}
+
+// tracked reports whether path overlaps a manifest entry, either by being
+// tracked itself, lying below a tracked directory or containing a tracked entry
+func tracked(m *manifest.Manifest, path string) bool {
+	sep := string(filepath.Separator)
+	for _, entry := range m.Entries {
+		if entry.Path == path ||
+			strings.HasPrefix(path, entry.Path+sep) ||
+			strings.HasPrefix(entry.Path, path+sep) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package scan
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/noosxe/dotman/internal/fs"
+	"github.com/noosxe/dotman/internal/manifest"
+)
+
+func TestScan(t *testing.T) {
+	mockFS, err := fs.NewMockFileSystemWithHome(map[string]*fstest.MapFile{
+		"home/test/.zshrc":                    {Data: []byte("zsh"), Mode: 0644},
+		"home/test/.gitconfig":                {Data: []byte("git"), Mode: 0644},
+		"home/test/.config/nvim/init.lua":     {Data: []byte("nvim"), Mode: 0644},
+		"home/test/.config/kitty/kitty.conf":  {Data: []byte("kitty"), Mode: 0644},
+		"home/test/.config/zed/settings.json": {Data: []byte("zed"), Mode: 0644},
+		"home/test/notes.txt":                 {Data: []byte("notes"), Mode: 0644},
+	}, "home/test")
+	if err != nil {
+		t.Fatalf("failed to create mock filesystem: %v", err)
+	}
+	defer mockFS.CleanUp()
+
+	m := &manifest.Manifest{}
+	m.Add(manifest.Entry{Path: ".gitconfig", Type: manifest.EntryTypeFile, AddedAt: time.Now()})
+	m.Add(manifest.Entry{Path: ".config/kitty/kitty.conf", Type: manifest.EntryTypeFile, AddedAt: time.Now()})
+
+	candidates, err := Scan(mockFS, "home/test", m)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	expected := []Candidate{
+		{Path: ".config/nvim", Category: CategoryEditor, IsDir: true},
+		{Path: ".config/zed", Category: CategoryOther, IsDir: true},
+		{Path: ".zshrc", Category: CategoryShell, IsDir: false},
+	}
+	if len(candidates) != len(expected) {
+		t.Fatalf("expected %d candidates, got %d: %v", len(expected), len(candidates), candidates)
+	}
+	for i, c := range expected {
+		if candidates[i] != c {
+			t.Fatalf("candidate %d: expected %v, got %v", i, c, candidates[i])
+		}
+	}
+}
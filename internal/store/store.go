@@ -0,0 +1,303 @@
+// Package store implements the content-addressed blob store that lets
+// identical files tracked under data/ share a single copy.
+//
+// A deduplicated file is replaced in data/ by a relative symlink to the blob
+// holding its content, stored under store/ by the SHA-256 of that content.
+// Symlinks in the home directory resolve through the blob link like they do
+// through a plain copy.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// Dir is the directory inside the dotman directory holding the blobs
+const Dir = "store"
+
+// blobTarget matches the target of a symlink pointing at a blob
+var blobTarget = regexp.MustCompile(`(^|/)` + Dir + `/([0-9a-f]{2})/([0-9a-f]{62})$`)
+
+// BlobPath returns the location of the blob with the given hash
+func BlobPath(dotmanDir, hash string) string {
+	return BlobIn(filepath.Join(dotmanDir, Dir), hash)
+}
+
+// BlobIn returns the location of the blob with the given hash in a blob
+// directory laid out like the store, such as the offload directory
+func BlobIn(root, hash string) string {
+	return filepath.Join(root, hash[:2], hash[2:])
+}
+
+// Hash returns the SHA-256 of the content of the file at path
+func Hash(fsys dotmanfs.FileSystem, path string) (string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Put stores the content of the regular file at path and returns its hash.
+// Content already in the store is not written again. Blobs are shared between
+// files, so they are made read-only.
+func Put(fsys dotmanfs.FileSystem, dotmanDir, path string) (string, error) {
+	return Keep(fsys, filepath.Join(dotmanDir, Dir), path)
+}
+
+// Keep copies the content of the regular file at path to its blob in the
+// blob directory root and returns its hash. Content already there is not
+// written again. Blobs are made read-only, an edit through a link would
+// change the content under its hash.
+func Keep(fsys dotmanfs.FileSystem, root, path string) (string, error) {
+	hash, err := Hash(fsys, path)
+	if err != nil {
+		return "", fmt.Errorf("error hashing %s: %w", path, err)
+	}
+
+	blob := BlobIn(root, hash)
+	if _, err := fsys.Stat(blob); err == nil {
+		return hash, nil
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", fmt.Errorf("error creating blob directory: %w", err)
+	}
+
+	// Write under a temporary name so a failed copy never looks like a blob
+	tmp := blob + ".tmp"
+	if err := dotmanfs.CopyFile(fsys, path, tmp, dotmanfs.Perm{}); err != nil {
+		fsys.Remove(tmp)
+		return "", fmt.Errorf("error copying %s to %s: %w", path, root, err)
+	}
+	if err := dotmanfs.VerifyFile(fsys, path, tmp); err != nil {
+		fsys.Remove(tmp)
+		return "", fmt.Errorf("error verifying blob for %s: %w", path, err)
+	}
+	if err := Finish(fsys, tmp, blob); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Finish makes the blob written to tmp read-only and moves it in place
+func Finish(fsys dotmanfs.FileSystem, tmp, blob string) error {
+	info, err := fsys.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	if err := fsys.Chmod(tmp, info.Mode().Perm()&^0222); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, blob); err != nil {
+		return fmt.Errorf("error storing blob: %w", err)
+	}
+	return nil
+}
+
+// Dedup moves the content of the regular files at or below path into the
+// store and replaces each of them with a link to its blob. It returns the
+// number of files replaced.
+func Dedup(fsys dotmanfs.FileSystem, dotmanDir, path string) (int, error) {
+	files, err := regularFiles(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, file := range files {
+		hash, err := Put(fsys, dotmanDir, file)
+		if err != nil {
+			return i, err
+		}
+
+		if err := fsys.Remove(file); err != nil {
+			return i, err
+		}
+		if err := LinkBlob(fsys, BlobPath(dotmanDir, hash), file); err != nil {
+			return i, err
+		}
+	}
+
+	return len(files), nil
+}
+
+// Resolve returns the blob the symlink at path points at. ok is false when
+// path is not a blob link.
+func Resolve(fsys dotmanfs.FileSystem, dotmanDir, path string) (blob string, ok bool) {
+	hash, ok := linkHash(fsys, path)
+	if !ok {
+		return "", false
+	}
+	return BlobPath(dotmanDir, hash), true
+}
+
+// Retarget rewrites the blob links at or below path to point into the store
+// from where they are now. Links that were moved keep their old relative
+// target and need this to resolve again.
+func Retarget(fsys dotmanfs.FileSystem, dotmanDir, path string) error {
+	return WalkLinks(fsys, path, func(link string) error {
+		hash, ok := linkHash(fsys, link)
+		if !ok {
+			return nil
+		}
+
+		if err := fsys.Remove(link); err != nil {
+			return err
+		}
+		return LinkBlob(fsys, BlobPath(dotmanDir, hash), link)
+	})
+}
+
+// Missing returns the blob links at or below path whose blob is not in the
+// store. A path that does not exist has no missing blobs.
+func Missing(fsys dotmanfs.FileSystem, dotmanDir, path string) ([]string, error) {
+	return MissingBlobs(fsys, path, func(link string) (string, bool) {
+		return Resolve(fsys, dotmanDir, link)
+	})
+}
+
+// MissingBlobs returns the symlinks at or below path for which blobOf
+// returns a blob that does not exist. A path that does not exist has no
+// missing blobs.
+func MissingBlobs(fsys dotmanfs.FileSystem, path string, blobOf func(link string) (string, bool)) ([]string, error) {
+	if _, err := fsys.Lstat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var missing []string
+	err := WalkLinks(fsys, path, func(link string) error {
+		blob, ok := blobOf(link)
+		if !ok {
+			return nil
+		}
+		if _, err := fsys.Lstat(blob); err != nil {
+			missing = append(missing, link)
+		}
+		return nil
+	})
+	return missing, err
+}
+
+// LinksTo returns the blob links at or below path that point at one of
+// blobs, such as the deduplicated files sharing a blob that was changed. A
+// path that does not exist has none.
+func LinksTo(fsys dotmanfs.FileSystem, dotmanDir, path string, blobs map[string]bool) ([]string, error) {
+	if _, err := fsys.Lstat(path); os.IsNotExist(err) || len(blobs) == 0 {
+		return nil, nil
+	}
+
+	var links []string
+	err := WalkLinks(fsys, path, func(link string) error {
+		if blob, ok := Resolve(fsys, dotmanDir, link); ok && blobs[blob] {
+			links = append(links, link)
+		}
+		return nil
+	})
+	return links, err
+}
+
+// Corrupt returns the blobs in the store whose content no longer matches the
+// hash they are stored under
+func Corrupt(fsys dotmanfs.FileSystem, dotmanDir string) ([]string, error) {
+	root := filepath.Join(dotmanDir, Dir)
+	if _, err := fsys.Lstat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	blobs, err := regularFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var corrupt []string
+	for _, blob := range blobs {
+		rel, err := filepath.Rel(root, blob)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := Hash(fsys, blob)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing %s: %w", blob, err)
+		}
+		if hash != strings.ReplaceAll(filepath.ToSlash(rel), "/", "") {
+			corrupt = append(corrupt, blob)
+		}
+	}
+	return corrupt, nil
+}
+
+// LinkBlob creates a symlink at path to blob. The target is relative so the
+// link survives cloning the repository elsewhere.
+func LinkBlob(fsys dotmanfs.FileSystem, blob, path string) error {
+	target, err := filepath.Rel(filepath.Dir(path), blob)
+	if err != nil {
+		return err
+	}
+	return fsys.Symlink(target, path)
+}
+
+// linkHash returns the hash of the blob the symlink at path points at
+func linkHash(fsys dotmanfs.FileSystem, path string) (string, bool) {
+	target, err := fsys.Readlink(path)
+	if err != nil {
+		return "", false
+	}
+
+	match := blobTarget.FindStringSubmatch(filepath.ToSlash(target))
+	if match == nil {
+		return "", false
+	}
+	return match[2] + match[3], true
+}
+
+// regularFiles returns the regular files at or below path
+func regularFiles(fsys dotmanfs.FileSystem, path string) ([]string, error) {
+	var files []string
+	err := fsys.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// WalkLinks calls fn for the symlinks at or below path
+func WalkLinks(fsys dotmanfs.FileSystem, path string, fn func(link string) error) error {
+	info, err := fsys.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return fn(path)
+	}
+
+	return fsys.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return fn(p)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+func TestDedup(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	dataDir := filepath.Join(dotmanDir, "data")
+
+	fsys.MkdirAll(filepath.Join(dataDir, ".fonts/mono"), 0755)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/a.ttf"), []byte("font"), 0644)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/mono/b.ttf"), []byte("font"), 0644)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/c.ttf"), []byte("other"), 0644)
+
+	count, err := Dedup(fsys, dotmanDir, filepath.Join(dataDir, ".fonts"))
+	if err != nil {
+		t.Fatalf("Dedup failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Dedup replaced %d files, want 3", count)
+	}
+
+	// Identical files share a blob and still read the same through the links
+	blobA, okA := Resolve(fsys, dotmanDir, filepath.Join(dataDir, ".fonts/a.ttf"))
+	blobB, okB := Resolve(fsys, dotmanDir, filepath.Join(dataDir, ".fonts/mono/b.ttf"))
+	if !okA || !okB || blobA != blobB {
+		t.Fatalf("expected identical files to share a blob, got %s and %s", blobA, blobB)
+	}
+	for _, name := range []string{".fonts/a.ttf", ".fonts/mono/b.ttf"} {
+		data, err := fsys.ReadFile(filepath.Join(dataDir, name))
+		if err != nil || string(data) != "font" {
+			t.Errorf("reading %s through the store returned %q (%v)", name, data, err)
+		}
+	}
+
+	// Links are relative so the repository can be cloned anywhere
+	target, err := fsys.Readlink(filepath.Join(dataDir, ".fonts/a.ttf"))
+	if err != nil || filepath.IsAbs(target) {
+		t.Errorf("expected a relative link target, got %q (%v)", target, err)
+	}
+
+	blobs, err := regularFiles(fsys, filepath.Join(dotmanDir, Dir))
+	if err != nil || len(blobs) != 2 {
+		t.Errorf("expected 2 blobs in the store, got %v (%v)", blobs, err)
+	}
+
+	info, err := fsys.Stat(blobA)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm()&0222 != 0 {
+		t.Errorf("expected shared blobs to be read-only, got %v", info.Mode().Perm())
+	}
+
+	// Deduplicating again is a no-op
+	if count, err := Dedup(fsys, dotmanDir, filepath.Join(dataDir, ".fonts")); err != nil || count != 0 {
+		t.Errorf("second Dedup replaced %d files (%v), want 0", count, err)
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	dataDir := filepath.Join(dotmanDir, "data")
+
+	fsys.MkdirAll(filepath.Join(dataDir, "themes"), 0755)
+	fsys.WriteFile(filepath.Join(dataDir, "themes/dark.css"), []byte("dark"), 0644)
+	if _, err := Dedup(fsys, dotmanDir, filepath.Join(dataDir, "themes")); err != nil {
+		t.Fatalf("Dedup failed: %v", err)
+	}
+
+	// Moving a link one level deeper leaves its relative target dangling
+	moved := filepath.Join(dataDir, "config/themes")
+	fsys.MkdirAll(filepath.Dir(moved), 0755)
+	if err := fsys.Rename(filepath.Join(dataDir, "themes"), moved); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := fsys.ReadFile(filepath.Join(moved, "dark.css")); !os.IsNotExist(err) {
+		t.Fatalf("expected the moved link to dangle, got %v", err)
+	}
+
+	if err := Retarget(fsys, dotmanDir, moved); err != nil {
+		t.Fatalf("Retarget failed: %v", err)
+	}
+	data, err := fsys.ReadFile(filepath.Join(moved, "dark.css"))
+	if err != nil || string(data) != "dark" {
+		t.Errorf("reading the retargeted link returned %q (%v)", data, err)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	path := filepath.Join(dotmanDir, "data/.bashrc")
+
+	fsys.MkdirAll(filepath.Dir(path), 0755)
+	fsys.WriteFile(path, []byte("bash"), 0644)
+	if _, err := Dedup(fsys, dotmanDir, path); err != nil {
+		t.Fatalf("Dedup failed: %v", err)
+	}
+
+	if missing, err := Missing(fsys, dotmanDir, path); err != nil || len(missing) != 0 {
+		t.Errorf("expected no missing blobs, got %v (%v)", missing, err)
+	}
+
+	if err := fsys.RemoveAll(filepath.Join(dotmanDir, Dir)); err != nil {
+		t.Fatalf("RemoveAll failed: %v", err)
+	}
+	if missing, err := Missing(fsys, dotmanDir, path); err != nil || len(missing) != 1 {
+		t.Errorf("expected the deleted blob to be reported, got %v (%v)", missing, err)
+	}
+
+	if missing, err := Missing(fsys, dotmanDir, filepath.Join(dotmanDir, "data/none")); err != nil || missing != nil {
+		t.Errorf("expected nothing missing below a missing path, got %v (%v)", missing, err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+
+	if corrupt, err := Corrupt(fsys, dotmanDir); err != nil || corrupt != nil {
+		t.Fatalf("expected nothing corrupt without a store, got %v (%v)", corrupt, err)
+	}
+
+	path := filepath.Join(dotmanDir, "data/.bashrc")
+	fsys.MkdirAll(filepath.Dir(path), 0755)
+	fsys.WriteFile(path, []byte("bash"), 0644)
+	hash, err := Put(fsys, dotmanDir, path)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if corrupt, err := Corrupt(fsys, dotmanDir); err != nil || len(corrupt) != 0 {
+		t.Errorf("expected no corrupt blobs, got %v (%v)", corrupt, err)
+	}
+
+	blob := BlobPath(dotmanDir, hash)
+	fsys.Chmod(blob, 0644)
+	fsys.WriteFile(blob, []byte("zsh"), 0644)
+	if corrupt, err := Corrupt(fsys, dotmanDir); err != nil || len(corrupt) != 1 || corrupt[0] != blob {
+		t.Errorf("expected the changed blob to be reported, got %v (%v)", corrupt, err)
+	}
+}
+
+func TestLinksTo(t *testing.T) {
+	fsys := dotmanfs.NewOSFileSystem()
+	dotmanDir := t.TempDir()
+	dataDir := filepath.Join(dotmanDir, "data")
+
+	fsys.MkdirAll(filepath.Join(dataDir, ".fonts"), 0755)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/a.ttf"), []byte("font"), 0644)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/b.ttf"), []byte("font"), 0644)
+	fsys.WriteFile(filepath.Join(dataDir, ".fonts/c.ttf"), []byte("other"), 0644)
+	if _, err := Dedup(fsys, dotmanDir, dataDir); err != nil {
+		t.Fatalf("Dedup failed: %v", err)
+	}
+
+	blob, _ := Resolve(fsys, dotmanDir, filepath.Join(dataDir, ".fonts/a.ttf"))
+	links, err := LinksTo(fsys, dotmanDir, dataDir, map[string]bool{blob: true})
+	if err != nil {
+		t.Fatalf("LinksTo failed: %v", err)
+	}
+	want := []string{filepath.Join(dataDir, ".fonts/a.ttf"), filepath.Join(dataDir, ".fonts/b.ttf")}
+	if len(links) != 2 || links[0] != want[0] || links[1] != want[1] {
+		t.Errorf("expected the files sharing the blob, got %v", links)
+	}
+
+	if links, err := LinksTo(fsys, dotmanDir, filepath.Join(dataDir, "none"), map[string]bool{blob: true}); err != nil || links != nil {
+		t.Errorf("expected no links below a missing path, got %v (%v)", links, err)
+	}
+}
@@ -1,7 +1,10 @@
 package testutil
 
 import (
+	"io"
+	"os"
 	"path/filepath"
+	"syscall"
 
 	dotmanfs "github.com/noosxe/dotman/internal/fs"
 )
@@ -11,6 +14,13 @@ const (
 	TestHomeDir = "home/test"
 )
 
+// FS is a filesystem for tests, backed by a temp directory or by memory
+type FS interface {
+	dotmanfs.FileSystem
+	CleanUp()
+	DumpTree() string
+}
+
 // NewMockFS creates a new mock filesystem with a home directory at /home/test
 func NewMockFS() (*dotmanfs.MockFileSystem, error) {
 	fsys, err := dotmanfs.NewMockFileSystemWithHome(nil, TestHomeDir)
@@ -29,6 +39,32 @@ func NewMockFSWithDotman() (*dotmanfs.MockFileSystem, string, error) {
 		return nil, "", err
 	}
 
+	return fsys, setupDotmanDir(fsys), nil
+}
+
+// NewMemFS creates a new in-memory filesystem with a home directory at /home/test
+func NewMemFS() (*dotmanfs.MemoryFileSystem, error) {
+	fsys, err := dotmanfs.NewMemoryFileSystemWithHome(nil, TestHomeDir)
+	if err != nil {
+		return nil, err
+	}
+	// Create home directory
+	fsys.MkdirAll(TestHomeDir, 0755)
+	return fsys, nil
+}
+
+// NewMemFSWithDotman creates a new in-memory filesystem with a home directory and dotman directory structure
+func NewMemFSWithDotman() (*dotmanfs.MemoryFileSystem, string, error) {
+	fsys, err := NewMemFS()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return fsys, setupDotmanDir(fsys), nil
+}
+
+// setupDotmanDir creates the dotman directory structure below the test home
+func setupDotmanDir(fsys dotmanfs.FileSystem) string {
 	// Create dotman directory
 	dotmanDir := filepath.Join(TestHomeDir, ".dotman")
 	fsys.MkdirAll(dotmanDir, 0755)
@@ -43,5 +79,64 @@ func NewMockFSWithDotman() (*dotmanfs.MockFileSystem, string, error) {
 		fsys.MkdirAll(filepath.Join(journalDir, subdir), 0755)
 	}
 
-	return fsys, dotmanDir, nil
+	return dotmanDir
+}
+
+// ReadOnlyFS refuses every write to the filesystem it wraps, like a
+// filesystem mounted read-only
+type ReadOnlyFS struct {
+	dotmanfs.FileSystem
+}
+
+// readOnly returns the error of a refused write to path
+func readOnly(op, path string) error {
+	return &os.PathError{Op: op, Path: path, Err: syscall.EROFS}
+}
+
+func (f ReadOnlyFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return nil, readOnly("open", name)
+}
+
+// MkdirAll succeeds for directories that exist, as os.MkdirAll does
+func (f ReadOnlyFS) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := f.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	return readOnly("mkdir", path)
+}
+
+func (f ReadOnlyFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return readOnly("open", name)
+}
+
+func (f ReadOnlyFS) WriteFileSync(name string, data []byte, perm os.FileMode) error {
+	return readOnly("open", name)
+}
+
+func (f ReadOnlyFS) AppendFile(name string, data []byte, perm os.FileMode) error {
+	return readOnly("open", name)
+}
+
+func (f ReadOnlyFS) Remove(name string) error {
+	return readOnly("remove", name)
+}
+
+func (f ReadOnlyFS) RemoveAll(path string) error {
+	return readOnly("remove", path)
+}
+
+func (f ReadOnlyFS) Symlink(oldname, newname string) error {
+	return readOnly("symlink", newname)
+}
+
+func (f ReadOnlyFS) Link(oldname, newname string) error {
+	return readOnly("link", newname)
+}
+
+func (f ReadOnlyFS) Rename(oldpath, newpath string) error {
+	return readOnly("rename", newpath)
+}
+
+func (f ReadOnlyFS) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
 }
@@ -14,10 +14,10 @@ import (
 )
 
 // SetupTestGitRepo creates a git repository in the given directory with an initial commit
-func SetupTestGitRepo(t *testing.T, fsys *dotmanfs.MockFileSystem, dotmanDir string) (*git.Repository, *git.Worktree, storage.Storer) {
-	// Create billy filesystem adapter
-	billyFs := dotmanfs.NewBillyFileSystem(fsys, dotmanDir)
-	storage := filesystem.NewStorage(billyFs, cache.NewObjectLRUDefault())
+func SetupTestGitRepo(t *testing.T, fsys FS, dotmanDir string) (*git.Repository, *git.Worktree, storage.Storer) {
+	// Create billy filesystem adapters for the worktree and the .git storage
+	billyFs := dotmanfs.NewBillyFileSystem(fsys, dotmanDir, dotmanfs.Perm{})
+	storage := filesystem.NewStorage(dotmanfs.NewBillyFileSystem(fsys, filepath.Join(dotmanDir, ".git"), dotmanfs.Perm{}), cache.NewObjectLRUDefault())
 
 	repo, err := git.InitWithOptions(storage, billyFs, git.InitOptions{
 		DefaultBranch: "refs/heads/main",
@@ -36,7 +36,7 @@ func SetupTestGitRepo(t *testing.T, fsys *dotmanfs.MockFileSystem, dotmanDir str
 }
 
 // CreateTestFileAndAdd creates a test file and adds it to git without committing
-func CreateTestFileAndAdd(t *testing.T, fsys *dotmanfs.MockFileSystem, worktree *git.Worktree, dotmanDir, filePath, content string) {
+func CreateTestFileAndAdd(t *testing.T, fsys FS, worktree *git.Worktree, dotmanDir, filePath, content string) {
 	// Create the file
 	fullPath := filepath.Join(dotmanDir, filePath)
 	fsys.MkdirAll(filepath.Dir(fullPath), 0755)
@@ -51,7 +51,7 @@ func CreateTestFileAndAdd(t *testing.T, fsys *dotmanfs.MockFileSystem, worktree
 }
 
 // CreateTestFileAndCommit creates a test file, adds it to git, and commits it
-func CreateTestFileAndCommit(t *testing.T, fsys *dotmanfs.MockFileSystem, worktree *git.Worktree, dotmanDir, filePath, content string) {
+func CreateTestFileAndCommit(t *testing.T, fsys FS, worktree *git.Worktree, dotmanDir, filePath, content string) {
 	// Create and add the file
 	CreateTestFileAndAdd(t, fsys, worktree, dotmanDir, filePath, content)
 
@@ -86,7 +86,9 @@ func VerifyLastCommit(t *testing.T, repo *git.Repository, expectedMessage string
 // SetupTestConfig creates and saves a test configuration
 func SetupTestConfig(t *testing.T, fsys dotmanfs.FileSystem, dotmanDir string) *config.Config {
 	cfg := &config.Config{
-		DotmanDir: dotmanDir,
+		DotmanDir:    dotmanDir,
+		GitUserName:  "dotman",
+		GitUserEmail: "dotman@localhost",
 	}
 	configPath := filepath.Join(TestHomeDir, ".dotconfig")
 	if err := config.SaveConfig(configPath, cfg, fsys); err != nil {
@@ -97,7 +99,7 @@ func SetupTestConfig(t *testing.T, fsys dotmanfs.FileSystem, dotmanDir string) *
 
 func SetupBareRepo(t *testing.T, fsys dotmanfs.FileSystem, dir string) *git.Repository {
 	// Create billy filesystem adapter
-	billyFs := dotmanfs.NewBillyFileSystem(fsys, dir)
+	billyFs := dotmanfs.NewBillyFileSystem(fsys, dir, dotmanfs.Perm{})
 	storage := filesystem.NewStorage(billyFs, nil)
 
 	repo, err := git.InitWithOptions(storage, nil, git.InitOptions{
@@ -0,0 +1,114 @@
+// Package trash moves files to the trash of the desktop, the XDG trash on
+// Linux and the BSDs and ~/.Trash on macOS, so they can be restored from the
+// file manager instead of being deleted for good.
+package trash
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+// Move moves path to the trash and returns where it ended up. The trash has
+// to be on the filesystem of path, files are renamed into it, not copied.
+func Move(fsys dotmanfs.FileSystem, path string) (string, error) {
+	return move(fsys, runtime.GOOS, path, time.Now())
+}
+
+func move(fsys dotmanfs.FileSystem, goos, path string, now time.Time) (string, error) {
+	path, err := fsys.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %v", err)
+	}
+
+	home, err := fsys.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %v", err)
+	}
+
+	switch goos {
+	case "windows", "plan9":
+		return "", fmt.Errorf("moving files to the trash is not supported on %s", goos)
+	case "darwin":
+		return moveDarwin(fsys, filepath.Join(home, ".Trash"), path)
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if !filepath.IsAbs(dataHome) {
+		dataHome = filepath.Join(home, ".local/share")
+	}
+	return moveXDG(fsys, filepath.Join(dataHome, "Trash"), path, now)
+}
+
+// moveDarwin renames path into the macOS trash, picking a free name the way
+// the Finder does
+func moveDarwin(fsys dotmanfs.FileSystem, dir, path string) (string, error) {
+	if err := fsys.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating trash: %v", err)
+	}
+	dst := freeName(fsys, dir, filepath.Base(path))
+	if err := fsys.Rename(path, dst); err != nil {
+		return "", fmt.Errorf("error moving %s to the trash: %v", path, err)
+	}
+	return dst, nil
+}
+
+// moveXDG moves path into a trash following the freedesktop.org trash
+// specification: the file goes to files/ and an info/ file records where it
+// came from and when, which file managers use to restore it
+func moveXDG(fsys dotmanfs.FileSystem, dir, path string, now time.Time) (string, error) {
+	files, info := filepath.Join(dir, "files"), filepath.Join(dir, "info")
+	for _, d := range []string{files, info} {
+		if err := fsys.MkdirAll(d, 0700); err != nil {
+			return "", fmt.Errorf("error creating trash: %v", err)
+		}
+	}
+
+	dst := freeName(fsys, files, filepath.Base(path))
+	name := filepath.Base(dst)
+
+	// The info file comes first, a file in files/ without one is invisible
+	// to file managers
+	infoPath := filepath.Join(info, name+".trashinfo")
+	data := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", escapePath(path), now.Format("2006-01-02T15:04:05"))
+	if err := fsys.WriteFile(infoPath, []byte(data), 0600); err != nil {
+		return "", fmt.Errorf("error writing trash info: %v", err)
+	}
+	if err := fsys.Rename(path, dst); err != nil {
+		fsys.Remove(infoPath)
+		return "", fmt.Errorf("error moving %s to the trash: %v", path, err)
+	}
+	return dst, nil
+}
+
+// freeName returns a path in dir named name, or name with a number added
+// when that is taken
+func freeName(fsys dotmanfs.FileSystem, dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// Dotfiles like .zshrc have no extension
+		base, ext = name, ""
+	}
+
+	candidate := name
+	for n := 2; ; n++ {
+		if _, err := fsys.Lstat(filepath.Join(dir, candidate)); err != nil {
+			return filepath.Join(dir, candidate)
+		}
+		candidate = base + " " + strconv.Itoa(n) + ext
+	}
+}
+
+// escapePath escapes path for the Path key of a trash info file, which
+// holds a URL path
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
@@ -0,0 +1,77 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dotmanfs "github.com/noosxe/dotman/internal/fs"
+)
+
+func TestMove_XDG(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	fsys := dotmanfs.NewOSFileSystem()
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+
+	for i, content := range []string{"first", "second"} {
+		path := filepath.Join(home, "my config")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		dst, err := move(fsys, "linux", path, now)
+		if err != nil {
+			t.Fatalf("move failed: %v", err)
+		}
+
+		// The second file of the same name gets a number
+		name := []string{"my config", "my config 2"}[i]
+		if want := filepath.Join(home, ".local/share/Trash/files", name); dst != want {
+			t.Errorf("moved to %s, want %s", dst, want)
+		}
+		if data, err := os.ReadFile(dst); err != nil || string(data) != content {
+			t.Errorf("expected the file in the trash, got %q (%v)", data, err)
+		}
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone, got %v", path, err)
+		}
+
+		info, err := os.ReadFile(filepath.Join(home, ".local/share/Trash/info", name+".trashinfo"))
+		want := "[Trash Info]\nPath=" + filepath.ToSlash(home) + "/my%20config\nDeletionDate=2024-05-01T12:30:00\n"
+		if err != nil || string(info) != want {
+			t.Errorf("trash info = %q (%v), want %q", info, err, want)
+		}
+	}
+}
+
+func TestMove_Darwin(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	fsys := dotmanfs.NewOSFileSystem()
+
+	path := filepath.Join(home, ".zshrc")
+	if err := os.MkdirAll(filepath.Join(home, ".Trash"), 0700); err != nil {
+		t.Fatalf("failed to create trash: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".Trash/.zshrc"), []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	dst, err := move(fsys, "darwin", path, time.Now())
+	if err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if want := filepath.Join(home, ".Trash/.zshrc 2"); dst != want {
+		t.Errorf("moved to %s, want %s", dst, want)
+	}
+
+	if _, err := move(fsys, "windows", dst, time.Now()); err == nil {
+		t.Error("expected an error on windows")
+	}
+}